@@ -47,6 +47,10 @@ func NewImportCommand() *cobra.Command {
 	cmd.Flags().BoolVar(&ro.TLSClient, "client-tls", false, "Whether client tls is enabled")
 	cmd.Flags().BoolVar(&ro.SkipClientCA, "skipClientCA", false, "Whether to skip tidb server's certificates validation")
 	cmd.Flags().StringVar(&ro.BackupPath, "backupPath", "", "The location of the backup")
+	cmd.Flags().StringVar(&ro.Mode, "mode", "", "The restore mode, lightning reads the dump from the backupPath directly in the logical mode")
+	cmd.Flags().StringVar(&ro.PasswordFile, "tidb-password-file", "", "The file the tidb password is read from instead of the env")
+	cmd.Flags().IntVar(&ro.ShardIndex, "shard-index", 0, "The index of the shard of the tables imported by this pod")
+	cmd.Flags().IntVar(&ro.ShardTotal, "shard-total", 1, "The number of the shards the tables are imported by")
 	return cmd
 }
 
@@ -52,7 +52,11 @@ func NewRestoreCommand() *cobra.Command {
 	cmd.Flags().StringVar(&ro.Mode, "mode", string(v1alpha1.RestoreModeSnapshot), "restore mode, which is pitr or snapshot(default)")
 	cmd.Flags().StringVar(&ro.PitrRestoredTs, "pitrRestoredTs", "0", "The pitr restored ts")
 	cmd.Flags().BoolVar(&ro.Prepare, "prepare", false, "Whether to prepare for restore")
+	cmd.Flags().BoolVar(&ro.BundledBR, "bundledBR", false, "Whether to use the br binary bundled in the backup-manager image")
+	cmd.Flags().StringVar(&ro.Checksum, "checksum", "", "For snapshot restore, whether br runs the checksum after restore, br's default if empty")
+	cmd.Flags().StringVar(&ro.PasswordFile, "tidb-password-file", "", "The file the tidb password is read from instead of the env")
 	cmd.Flags().StringVar(&ro.TargetAZ, "target-az", "", "For volume-snapshot restore, which az the volume snapshots restore to")
+	cmd.Flags().StringVar(&ro.VolumeType, "volumeType", "aws-ebs", "For volume-snapshot restore, the cloud volume type the volume snapshots restore to")
 	return cmd
 }
 
@@ -54,6 +54,14 @@ const (
 	// RcloneConfigArg represents the config argument to rclone cmd
 	RcloneConfigArg = "--config=" + RcloneConfigFile
 
+	// LightningConfigFile is the path to the config file of lightning, which sets the session variables
+	// and the checkpoints
+	LightningConfigFile = "/tmp/tidb-lightning.toml"
+
+	// LightningCheckpointFile is the path to the lightning checkpoints of the file driver, it's in the
+	// restore pvc so that the retried job reads the checkpoints of the interrupted one
+	LightningCheckpointFile = BackupRootPath + "/tidb_lightning_checkpoint.pb"
+
 	// MetaFile is the file name for meta data of backup with BR
 	MetaFile = "backupmeta"
 
@@ -17,24 +17,53 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/mholt/archiver"
 	"github.com/pingcap/tidb-operator/cmd/backup-manager/app/constants"
 	backupUtil "github.com/pingcap/tidb-operator/cmd/backup-manager/app/util"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/apis/util/config"
 	"github.com/pingcap/tidb-operator/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
 
+// lightningSystemSchemas are the schemas filtered out by lightning when no table filter is specified
+var lightningSystemSchemas = []string{"mysql", "sys", "INFORMATION_SCHEMA", "PERFORMANCE_SCHEMA", "METRICS_SCHEMA", "INSPECTION_SCHEMA"}
+
 // Options contains the input arguments to the restore command
 type Options struct {
 	backupUtil.GenericOptions
 	BackupPath string
+	// Mode is the restore mode, the backupPath is the url of the dump which lightning reads from directly
+	// in the logical mode instead of the archive downloaded to the restore pvc
+	Mode string
+	// ShardIndex and ShardTotal are the shard of the tables imported by this pod when the import is sharded
+	// across the pods of the job
+	ShardIndex int
+	ShardTotal int
+}
+
+func (ro *Options) isLogicalRestore() bool {
+	return ro.Mode == string(v1alpha1.RestoreModeLogical)
+}
+
+func (ro *Options) isShardedImport() bool {
+	return ro.ShardTotal > 1
+}
+
+// getCommitTs returns the commitTs from the metadata file of the dump
+func (ro *Options) getCommitTs(ctx context.Context, restorePath string, restore *v1alpha1.Restore) (string, error) {
+	if ro.isLogicalRestore() {
+		return backupUtil.GetCommitTsFromStorage(ctx, restore.Spec.StorageProvider)
+	}
+	return backupUtil.GetCommitTsFromMetadata(restorePath)
 }
 
 func (ro *Options) getRestoreDataPath() string {
@@ -84,9 +113,8 @@ func (ro *Options) downloadBackupData(ctx context.Context, localPath string, opt
 }
 
 func (ro *Options) loadTidbClusterData(ctx context.Context, restorePath string, restore *v1alpha1.Restore) error {
-	tableFilter := restore.Spec.TableFilter
-
-	if exist := backupUtil.IsDirExist(restorePath); !exist {
+	// the dump of the logical restore is in the storage
+	if !ro.isLogicalRestore() && !backupUtil.IsDirExist(restorePath) {
 		return fmt.Errorf("dir %s does not exist or is not a dir", restorePath)
 	}
 	// args for restore
@@ -102,10 +130,6 @@ func (ro *Options) loadTidbClusterData(ctx context.Context, restorePath string,
 		fmt.Sprintf("--tidb-port=%d", ro.Port),
 	}
 
-	for _, filter := range tableFilter {
-		args = append(args, "-f", filter)
-	}
-
 	if ro.TLSClient {
 		if !ro.SkipClientCA {
 			args = append(args, fmt.Sprintf("--ca=%s", path.Join(util.TiDBClientTLSPath, corev1.ServiceAccountRootCAKey)))
@@ -114,35 +138,129 @@ func (ro *Options) loadTidbClusterData(ctx context.Context, restorePath string,
 		args = append(args, fmt.Sprintf("--key=%s", path.Join(util.TiDBClientTLSPath, corev1.TLSPrivateKeyKey)))
 	}
 
+	data, err := lightningConfig(restore)
+	if err != nil {
+		return fmt.Errorf("cluster %s, generate lightning config failed, err: %v", ro, err)
+	}
+	if len(data) > 0 {
+		if err := os.WriteFile(constants.LightningConfigFile, data, 0600); err != nil {
+			return fmt.Errorf("cluster %s, write lightning config %s failed, err: %v", ro, constants.LightningConfigFile, err)
+		}
+		args = append(args, fmt.Sprintf("--config=%s", constants.LightningConfigFile))
+	}
+
 	binPath := "/tidb-lightning"
 	if restore.Spec.ToolImage != "" {
 		binPath = path.Join(util.LightningBinPath, "tidb-lightning")
 	}
 
-	klog.Infof("The lightning process is ready, command \"%s %s\"", binPath, strings.Join(args, " "))
+	passes := lightningImportPasses(restore.Spec.TableFilter, restore.Spec.TableConcurrency)
+	if ro.isShardedImport() {
+		tables, err := dumpTables(ctx, restore.Spec.StorageProvider)
+		if err != nil {
+			return fmt.Errorf("cluster %s, list the tables of the dump failed, err: %v", ro, err)
+		}
+		klog.Infof("cluster %s, import shard %d of %d, the dump has %d tables", ro, ro.ShardIndex, ro.ShardTotal, len(tables))
+		passes = lightningShardPasses(passes, tables, ro.ShardIndex, ro.ShardTotal)
+	}
 
-	output, err := exec.CommandContext(ctx, binPath, args...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("cluster %s, execute loader command %v failed, output: %s, err: %v", ro, args, string(output), err)
+	for _, passArgs := range passes {
+		passArgs = append(append([]string{}, args...), passArgs...)
+		klog.Infof("The lightning process is ready, command \"%s %s\"", binPath, strings.Join(passArgs, " "))
+
+		output, err := exec.CommandContext(ctx, binPath, passArgs...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("cluster %s, execute loader command %v failed, output: %s, err: %v", ro, passArgs, string(output), err)
+		}
 	}
 	return nil
 }
 
-// unarchiveBackupData unarchive backup data to dest dir
-// NOTE: no context/timeout supported for `tarGz.Unarchive`, this may cause to be KILLed when blocking.
-func unarchiveBackupData(backupFile, destDir string) (string, error) {
-	var unarchiveBackupPath string
-	if err := backupUtil.EnsureDirectoryExist(destDir); err != nil {
-		return unarchiveBackupPath, err
-	}
-	backupName := strings.TrimSuffix(filepath.Base(backupFile), constants.DefaultArchiveExtention)
-	tarGz := archiver.NewTarGz()
-	// overwrite if the file already exists
-	tarGz.OverwriteExisting = true
-	err := tarGz.Unarchive(backupFile, destDir)
-	if err != nil {
-		return unarchiveBackupPath, fmt.Errorf("unarchive backup data %s to %s failed, err: %v", backupFile, destDir, err)
+// lightningImportPasses returns the table filter and concurrency args of every lightning run.
+// Each glob of tableConcurrency is imported by a separate run with its own region concurrency,
+// and the tables not matched by any glob are imported by the last run with the default concurrency.
+func lightningImportPasses(tableFilter []string, tableConcurrency map[string]int) [][]string {
+	if len(tableConcurrency) == 0 {
+		var args []string
+		for _, filter := range tableFilter {
+			args = append(args, "-f", filter)
+		}
+		return [][]string{args}
+	}
+
+	globs := make([]string, 0, len(tableConcurrency))
+	for glob := range tableConcurrency {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+
+	passes := make([][]string, 0, len(globs)+1)
+	for i, glob := range globs {
+		args := []string{"-f", glob}
+		// skip the tables which have been imported by the previous runs
+		for _, imported := range globs[:i] {
+			args = append(args, "-f", "!"+imported)
+		}
+		args = append(args, fmt.Sprintf("--region-concurrency=%d", tableConcurrency[glob]))
+		passes = append(passes, args)
+	}
+
+	args := []string{"-f", "*.*"}
+	for _, schema := range lightningSystemSchemas {
+		args = append(args, "-f", fmt.Sprintf("!%s.*", schema))
+	}
+	for _, imported := range globs {
+		args = append(args, "-f", "!"+imported)
+	}
+	return append(passes, args)
+}
+
+// lightningConfig returns the lightning config which sets the session variables and the checkpoints of the restore,
+// it's empty if the restore sets neither of them
+func lightningConfig(restore *v1alpha1.Restore) ([]byte, error) {
+	cfg := make(map[string]interface{})
+	if len(restore.Spec.SessionVariables) > 0 {
+		sessionVars := make(map[string]interface{}, len(restore.Spec.SessionVariables))
+		for variable, value := range restore.Spec.SessionVariables {
+			sessionVars[strings.ToLower(variable)] = value
+		}
+		cfg["tidb"] = map[string]interface{}{
+			"session-vars": sessionVars,
+		}
+	}
+	if cp := restore.Spec.LightningCheckpoint; cp != nil {
+		checkpoint := map[string]interface{}{
+			"enable": true,
+			"driver": string(cp.GetDriver()),
+		}
+		if cp.GetDriver() == v1alpha1.LightningCheckpointDriverMySQL {
+			// the checkpoints are stored in the target cluster when the dsn is not set
+			checkpoint["schema"] = cp.GetSchema()
+		} else {
+			checkpoint["dsn"] = constants.LightningCheckpointFile
+		}
+		cfg["checkpoint"] = checkpoint
+	}
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	return config.New(cfg).MarshalTOML()
+}
+
+// isImportResumed returns true if the import resumes from the lightning checkpoints of a previous attempt.
+// It must be called before the current attempt is recorded in the status of the restore.
+func isImportResumed(restore *v1alpha1.Restore) bool {
+	cp := restore.Spec.LightningCheckpoint
+	if cp == nil {
+		return false
+	}
+	_, subJob := v1alpha1.GetRestoreSubJob(&restore.Status, restore.GetRestoreSubJobType())
+	if subJob == nil || subJob.Attempts == 0 {
+		return false
+	}
+	// the previous attempt may be interrupted before lightning writes any checkpoint
+	if cp.GetDriver() == v1alpha1.LightningCheckpointDriverFile {
+		return backupUtil.IsFileExist(constants.LightningCheckpointFile)
 	}
-	unarchiveBackupPath = filepath.Join(destDir, backupName)
-	return unarchiveBackupPath, nil
+	return true
 }
@@ -0,0 +1,165 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package _import
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+)
+
+func TestLightningImportPasses(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type testcase struct {
+		name             string
+		tableFilter      []string
+		tableConcurrency map[string]int
+		expect           [][]string
+	}
+
+	tests := []*testcase{
+		{
+			name:   "no table filter",
+			expect: [][]string{nil},
+		},
+		{
+			name:        "table filter only",
+			tableFilter: []string{"db.*", "!db.tmp"},
+			expect:      [][]string{{"-f", "db.*", "-f", "!db.tmp"}},
+		},
+		{
+			name: "table concurrency",
+			tableConcurrency: map[string]int{
+				"db.big_*":    16,
+				"db.orders":   8,
+				"logs.events": 4,
+			},
+			expect: [][]string{
+				{"-f", "db.big_*", "--region-concurrency=16"},
+				{"-f", "db.orders", "-f", "!db.big_*", "--region-concurrency=8"},
+				{"-f", "logs.events", "-f", "!db.big_*", "-f", "!db.orders", "--region-concurrency=4"},
+				{
+					"-f", "*.*",
+					"-f", "!mysql.*",
+					"-f", "!sys.*",
+					"-f", "!INFORMATION_SCHEMA.*",
+					"-f", "!PERFORMANCE_SCHEMA.*",
+					"-f", "!METRICS_SCHEMA.*",
+					"-f", "!INSPECTION_SCHEMA.*",
+					"-f", "!db.big_*",
+					"-f", "!db.orders",
+					"-f", "!logs.events",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.Expect(lightningImportPasses(tt.tableFilter, tt.tableConcurrency)).To(Equal(tt.expect))
+		})
+	}
+}
+
+func TestLightningConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type testcase struct {
+		name       string
+		vars       map[string]string
+		checkpoint *v1alpha1.LightningCheckpoint
+		expect     string
+	}
+
+	tests := []*testcase{
+		{
+			name:   "no config",
+			expect: "",
+		},
+		{
+			name: "session variables",
+			vars: map[string]string{
+				"tidb_enable_noop_functions": "ON",
+				"TiDB_DML_Batch_Size":        "100",
+			},
+			expect: `[tidb]
+  [tidb.session-vars]
+    tidb_dml_batch_size = "100"
+    tidb_enable_noop_functions = "ON"
+`,
+		},
+		{
+			name:       "file checkpoint",
+			checkpoint: &v1alpha1.LightningCheckpoint{},
+			expect: `[checkpoint]
+  driver = "file"
+  dsn = "/backup/tidb_lightning_checkpoint.pb"
+  enable = true
+`,
+		},
+		{
+			name: "mysql checkpoint with session variables",
+			vars: map[string]string{"tidb_dml_batch_size": "100"},
+			checkpoint: &v1alpha1.LightningCheckpoint{
+				Driver: v1alpha1.LightningCheckpointDriverMySQL,
+			},
+			expect: `[checkpoint]
+  driver = "mysql"
+  enable = true
+  schema = "tidb_lightning_checkpoint"
+
+[tidb]
+  [tidb.session-vars]
+    tidb_dml_batch_size = "100"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore := &v1alpha1.Restore{
+				Spec: v1alpha1.RestoreSpec{
+					SessionVariables:    tt.vars,
+					LightningCheckpoint: tt.checkpoint,
+				},
+			}
+			data, err := lightningConfig(restore)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(data)).To(Equal(tt.expect))
+		})
+	}
+}
+
+func TestIsImportResumed(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	restore := &v1alpha1.Restore{
+		Spec: v1alpha1.RestoreSpec{
+			LightningCheckpoint: &v1alpha1.LightningCheckpoint{Driver: v1alpha1.LightningCheckpointDriverMySQL},
+		},
+	}
+	g.Expect(isImportResumed(restore)).To(BeFalse())
+
+	restore.Status.SubJobs = []v1alpha1.RestoreSubJobStatus{{
+		Type:     v1alpha1.RestoreSubJobRestore,
+		Phase:    v1alpha1.RestoreSubJobFailed,
+		Attempts: 1,
+	}}
+	g.Expect(isImportResumed(restore)).To(BeTrue())
+
+	restore.Spec.LightningCheckpoint = nil
+	g.Expect(isImportResumed(restore)).To(BeFalse())
+}
@@ -49,7 +49,7 @@ func NewRestoreManager(
 	}
 }
 
-func (rm *RestoreManager) setOptions(restore *v1alpha1.Restore) {
+func (rm *RestoreManager) setOptions(restore *v1alpha1.Restore) (string, error) {
 	rm.Options.Host = restore.Spec.To.Host
 
 	if restore.Spec.To.Port != 0 {
@@ -64,7 +64,12 @@ func (rm *RestoreManager) setOptions(restore *v1alpha1.Restore) {
 		rm.Options.User = v1alpha1.DefaultTidbUser
 	}
 
-	rm.Options.Password = util.GetOptionValueFromEnv(bkconstants.TidbPasswordKey, bkconstants.BackupManagerEnvVarPrefix)
+	password, err := util.GetTidbPassword(rm.Options.PasswordFile, bkconstants.TidbPasswordKey, bkconstants.BackupManagerEnvVarPrefix)
+	if err != nil {
+		return "ReadTidbPasswordFailed", err
+	}
+	rm.Options.Password = password
+	return "", nil
 }
 
 // ProcessRestore used to process the restore logic
@@ -87,13 +92,29 @@ func (rm *RestoreManager) ProcessRestore() error {
 		return errorutils.NewAggregate(errs)
 	}
 
-	rm.setOptions(restore)
+	// report the failures of an attempt with retries left as RetryFailed
+	rm.StatusUpdater = util.NewRetryRestoreConditionUpdater(rm.StatusUpdater, restore)
+
+	if reason, err := rm.setOptions(restore); err != nil {
+		errs = append(errs, err)
+		klog.Errorf("set lightning import %s option for cluster %s failed, err: %v", rm.ResourceName, rm, err)
+		uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: err.Error(),
+		}, nil)
+		errs = append(errs, uerr)
+		return errorutils.NewAggregate(errs)
+	}
 
 	return rm.performRestore(ctx, restore.DeepCopy())
 }
 
 func (rm *RestoreManager) performRestore(ctx context.Context, restore *v1alpha1.Restore) error {
 	started := time.Now()
+	// check the attempts before the running status of the current attempt is updated
+	resumed := isImportResumed(restore)
 
 	err := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 		Type:   v1alpha1.RestoreRunning,
@@ -102,41 +123,49 @@ func (rm *RestoreManager) performRestore(ctx context.Context, restore *v1alpha1.
 	if err != nil {
 		return err
 	}
-
-	var errs []error
-	restoreDataPath := rm.getRestoreDataPath()
-	opts := util.GetOptions(restore.Spec.StorageProvider)
-	if err := rm.downloadBackupData(ctx, restoreDataPath, opts); err != nil {
-		errs = append(errs, err)
-		klog.Errorf("download cluster %s backup %s data failed, err: %s", rm, rm.BackupPath, err)
-		uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
-			Type:    v1alpha1.RestoreFailed,
-			Status:  corev1.ConditionTrue,
-			Reason:  "DownloadBackupDataFailed",
-			Message: fmt.Sprintf("download backup %s data failed, err: %v", rm.BackupPath, err),
-		}, nil)
-		errs = append(errs, uerr)
-		return errorutils.NewAggregate(errs)
+	if id := restore.GetCorrelationID(); id != "" {
+		klog.Infof("restore cluster %s with correlation id %s", rm, id)
 	}
-	klog.Infof("download cluster %s backup %s data success", rm, rm.BackupPath)
 
-	restoreDataDir := filepath.Dir(restoreDataPath)
-	unarchiveDataPath, err := unarchiveBackupData(restoreDataPath, restoreDataDir)
-	if err != nil {
-		errs = append(errs, err)
-		klog.Errorf("unarchive cluster %s backup %s data failed, err: %s", rm, restoreDataPath, err)
-		uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
-			Type:    v1alpha1.RestoreFailed,
-			Status:  corev1.ConditionTrue,
-			Reason:  "UnarchiveBackupDataFailed",
-			Message: fmt.Sprintf("unarchive backup %s data failed, err: %v", restoreDataPath, err),
-		}, nil)
-		errs = append(errs, uerr)
-		return errorutils.NewAggregate(errs)
+	var errs []error
+	// lightning reads the dump of the logical restore from the storage directly
+	restorePath := rm.BackupPath
+	if !rm.isLogicalRestore() {
+		restoreDataPath := rm.getRestoreDataPath()
+		opts := util.GetOptions(restore.Spec.StorageProvider)
+		if err := rm.downloadBackupData(ctx, restoreDataPath, opts); err != nil {
+			errs = append(errs, err)
+			klog.Errorf("download cluster %s backup %s data failed, err: %s", rm, rm.BackupPath, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  "DownloadBackupDataFailed",
+				Message: fmt.Sprintf("download backup %s data failed, err: %v", rm.BackupPath, err),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+		klog.Infof("download cluster %s backup %s data success", rm, rm.BackupPath)
+
+		restoreDataDir := filepath.Dir(restoreDataPath)
+		unarchiveDataPath, err := unarchiveBackupData(restoreDataPath, restoreDataDir)
+		if err != nil {
+			errs = append(errs, err)
+			klog.Errorf("unarchive cluster %s backup %s data failed, err: %s", rm, restoreDataPath, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  "UnarchiveBackupDataFailed",
+				Message: fmt.Sprintf("unarchive backup %s data failed, err: %v", restoreDataPath, err),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+		klog.Infof("unarchive cluster %s backup %s data success", rm, restoreDataPath)
+		restorePath = unarchiveDataPath
 	}
-	klog.Infof("unarchive cluster %s backup %s data success", rm, restoreDataPath)
 
-	commitTs, err := util.GetCommitTsFromMetadata(unarchiveDataPath)
+	commitTs, err := rm.getCommitTs(ctx, restorePath, restore)
 	if err != nil {
 		errs = append(errs, err)
 		klog.Errorf("get cluster %s commitTs failed, err: %s", rm, err)
@@ -151,7 +180,20 @@ func (rm *RestoreManager) performRestore(ctx context.Context, restore *v1alpha1.
 	}
 	klog.Infof("get cluster %s commitTs %s success", rm, commitTs)
 
-	err = rm.loadTidbClusterData(ctx, unarchiveDataPath, restore)
+	if resumed {
+		klog.Infof("restore cluster %s resumes the import from the lightning checkpoints", rm)
+		err := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreResumed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "LightningCheckpointFound",
+			Message: fmt.Sprintf("the import resumes from the lightning checkpoints of the %s driver", restore.Spec.LightningCheckpoint.GetDriver()),
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rm.loadTidbClusterData(ctx, restorePath, restore)
 	if err != nil {
 		errs = append(errs, err)
 		klog.Errorf("restore cluster %s from backup %s failed, err: %s", rm, rm.BackupPath, err)
@@ -159,13 +201,20 @@ func (rm *RestoreManager) performRestore(ctx context.Context, restore *v1alpha1.
 			Type:    v1alpha1.RestoreFailed,
 			Status:  corev1.ConditionTrue,
 			Reason:  "LoaderBackupDataFailed",
-			Message: fmt.Sprintf("loader backup %s data failed, err: %v", restoreDataPath, err),
+			Message: fmt.Sprintf("loader backup %s data failed, err: %v", restorePath, err),
 		}, nil)
 		errs = append(errs, uerr)
 		return errorutils.NewAggregate(errs)
 	}
 	klog.Infof("restore cluster %s from backup %s success", rm, rm.BackupPath)
 
+	// the restore is completed by the controller after the pods of all the shards succeed
+	if rm.isShardedImport() {
+		return rm.StatusUpdater.Update(restore, nil, &controller.RestoreUpdateStatus{
+			CommitTs: &commitTs,
+		})
+	}
+
 	finish := time.Now()
 
 	updateStatus := &controller.RestoreUpdateStatus{
@@ -0,0 +1,111 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package _import
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	backupUtil "github.com/pingcap/tidb-operator/cmd/backup-manager/app/util"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+)
+
+// dumpSchemaFileSuffix is the suffix of the file dumpling writes the create table statement of a table to,
+// the file is named `{schema}.{table}-schema.sql`
+const dumpSchemaFileSuffix = "-schema.sql"
+
+// dumpCompressSuffixes are the suffixes of the files compressed by dumpling
+var dumpCompressSuffixes = []string{".gz", ".zst", ".snappy"}
+
+// dumpTable is a table of the dump
+type dumpTable struct {
+	schema string
+	name   string
+}
+
+// filterRule returns the lightning table filter rule matching the table exactly
+func (t dumpTable) filterRule() string {
+	quote := func(name string) string {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return quote(t.schema) + "." + quote(t.name)
+}
+
+// parseDumpTable returns the table of the schema file of the dump, false is returned if the file is not a
+// schema file of a table
+func parseDumpTable(key string) (dumpTable, bool) {
+	file := path.Base(key)
+	for _, suffix := range dumpCompressSuffixes {
+		file = strings.TrimSuffix(file, suffix)
+	}
+	if !strings.HasSuffix(file, dumpSchemaFileSuffix) {
+		return dumpTable{}, false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(file, dumpSchemaFileSuffix), ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return dumpTable{}, false
+	}
+	return dumpTable{schema: parts[0], name: parts[1]}, true
+}
+
+// dumpTables returns the tables of the dump in the storage in order
+func dumpTables(ctx context.Context, provider v1alpha1.StorageProvider) ([]dumpTable, error) {
+	keys, err := backupUtil.ListFilesFromStorage(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	var tables []dumpTable
+	for _, key := range keys {
+		if table, ok := parseDumpTable(key); ok {
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].schema != tables[j].schema {
+			return tables[i].schema < tables[j].schema
+		}
+		return tables[i].name < tables[j].name
+	})
+	return tables, nil
+}
+
+// lightningShardPasses restricts every lightning run to the tables of the shard. The tables are assigned to
+// the shards in turn, and the tables of the other shards are excluded by the rules appended to every run.
+// The last matched rule decides whether a table is imported, so the tables of the shard are still filtered
+// by the rules of the run.
+func lightningShardPasses(passes [][]string, tables []dumpTable, index, total int) [][]string {
+	var excluded []string
+	for i, table := range tables {
+		if i%total != index {
+			excluded = append(excluded, "-f", "!"+table.filterRule())
+		}
+	}
+
+	sharded := make([][]string, 0, len(passes))
+	for _, pass := range passes {
+		args := append([]string{}, pass...)
+		// lightning imports all the tables except the system schemas without any rule
+		if len(args) == 0 {
+			args = append(args, "-f", "*.*")
+			for _, schema := range lightningSystemSchemas {
+				args = append(args, "-f", fmt.Sprintf("!%s.*", schema))
+			}
+		}
+		sharded = append(sharded, append(args, excluded...))
+	}
+	return sharded
+}
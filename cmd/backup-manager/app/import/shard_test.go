@@ -0,0 +1,81 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package _import
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseDumpTable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for key, expect := range map[string]dumpTable{
+		"db.users-schema.sql":           {schema: "db", name: "users"},
+		"dump/db.orders-schema.sql.gz":  {schema: "db", name: "orders"},
+		"db.tbl.with.dots-schema.sql":   {schema: "db", name: "tbl.with.dots"},
+		"logs.events-schema.sql.zst":    {schema: "logs", name: "events"},
+		"logs.events-schema.sql.snappy": {schema: "logs", name: "events"},
+	} {
+		table, ok := parseDumpTable(key)
+		g.Expect(ok).To(BeTrue(), key)
+		g.Expect(table).To(Equal(expect), key)
+	}
+
+	for _, key := range []string{
+		"metadata",
+		"db-schema-create.sql",
+		"db.users.000000000.sql",
+		"db.v-schema-view.sql",
+	} {
+		_, ok := parseDumpTable(key)
+		g.Expect(ok).To(BeFalse(), key)
+	}
+}
+
+func TestLightningShardPasses(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tables := []dumpTable{
+		{schema: "db", name: "a"},
+		{schema: "db", name: "b"},
+		{schema: "db", name: "c`d"},
+	}
+
+	// the tables of the other shards are excluded from the default filter
+	g.Expect(lightningShardPasses([][]string{nil}, tables, 1, 2)).To(Equal([][]string{{
+		"-f", "*.*",
+		"-f", "!mysql.*",
+		"-f", "!sys.*",
+		"-f", "!INFORMATION_SCHEMA.*",
+		"-f", "!PERFORMANCE_SCHEMA.*",
+		"-f", "!METRICS_SCHEMA.*",
+		"-f", "!INSPECTION_SCHEMA.*",
+		"-f", "!`db`.`a`",
+		"-f", "!`db`.`c``d`",
+	}}))
+
+	// the tables of the other shards are excluded from every run
+	passes := [][]string{
+		{"-f", "db.a", "--region-concurrency=8"},
+		{"-f", "db.*", "-f", "!db.a"},
+	}
+	g.Expect(lightningShardPasses(passes, tables, 0, 2)).To(Equal([][]string{
+		{"-f", "db.a", "--region-concurrency=8", "-f", "!`db`.`b`"},
+		{"-f", "db.*", "-f", "!db.a", "-f", "!`db`.`b`"},
+	}))
+	// the passes of the restore are not changed
+	g.Expect(passes[0]).To(HaveLen(3))
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	bkconstants "github.com/pingcap/tidb-operator/pkg/backup/constants"
+	bkutil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	errorutils "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	gcsServiceAccountJSONKeyEnv = "GCS_SERVICE_ACCOUNT_JSON_KEY"
+	googleCredentialsEnv        = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+// selectStorage tries the storages in the order of bkutil.RestoreStorageProviders, the first available one
+// replaces the storage provider of the restore and its credentials replace the storage env of the process,
+// so BR restores the backup data from it.
+func (rm *Manager) selectStorage(ctx context.Context, restore *v1alpha1.Restore) (string, error) {
+	providers, indexes := bkutil.RestoreStorageProviders(restore)
+	var errs []error
+	for i, provider := range providers {
+		storagePath, err := bkutil.GetStoragePath(provider)
+		if err != nil {
+			return "GetStoragePathFailed", err
+		}
+		if err := useStorageEnv(indexes[i], len(providers)); err != nil {
+			return "SetStorageEnvFailed", err
+		}
+		if err := checkStorageAvailable(ctx, provider, rm.Mode); err != nil {
+			klog.Warningf("cluster %s storage %s is unavailable, err: %s", rm, storagePath, err)
+			errs = append(errs, fmt.Errorf("storage %s: %v", storagePath, err))
+			continue
+		}
+
+		if indexes[i] > 0 {
+			klog.Infof("cluster %s restore from fallback storage %s", rm, storagePath)
+		}
+		restore.Spec.StorageProvider = provider
+		if storagePath != restore.Status.StoragePath {
+			if err := rm.StatusUpdater.Update(restore, nil, &controller.RestoreUpdateStatus{
+				StoragePath: &storagePath,
+			}); err != nil {
+				klog.Warningf("cluster %s record the storage path %s failed, err: %s", rm, storagePath, err)
+			}
+		}
+		return "", nil
+	}
+	return "NoStorageAvailable", fmt.Errorf("none of the storages is available: %v", errorutils.NewAggregate(errs))
+}
+
+// useStorageEnv replaces the storage env of the process with the env of the storage with the index, which
+// is generated by bkutil.GenerateRestoreStorageEnv, the env only set for other storages is unset
+func useStorageEnv(index, count int) error {
+	selected := map[string]string{}
+	others := map[string]struct{}{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		for i := 0; i < count; i++ {
+			prefix := bkutil.StorageEnvPrefix(i)
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if i == index {
+				selected[strings.TrimPrefix(name, prefix)] = value
+			} else {
+				others[strings.TrimPrefix(name, prefix)] = struct{}{}
+			}
+		}
+	}
+	for name := range others {
+		if _, ok := selected[name]; !ok {
+			if err := os.Unsetenv(name); err != nil {
+				return err
+			}
+		}
+	}
+	for name, value := range selected {
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+
+	// the entrypoint only writes the gcs credentials of the primary storage to the file
+	if path := os.Getenv(googleCredentialsEnv); path != "" {
+		if err := os.WriteFile(path, []byte(selected[gcsServiceAccountJSONKeyEnv]), 0600); err != nil {
+			return fmt.Errorf("write gcs credentials to %s failed, err: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// checkStorageAvailable checks whether the storage can be accessed and holds the backup meta, or the checkpoint
+// of the log backup for PiTR restore
+func checkStorageAvailable(ctx context.Context, provider v1alpha1.StorageProvider, mode string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	s, err := bkutil.NewStorageBackend(provider, &bkutil.StorageCredential{})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	keyPrefix := bkconstants.MetaFile
+	if mode == string(v1alpha1.RestoreModePiTR) {
+		keyPrefix = bkconstants.LogBackupCheckpointDir + "/"
+	}
+	return s.CheckAvailable(ctx, keyPrefix)
+}
@@ -16,14 +16,18 @@ package restore
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pingcap/tidb-operator/cmd/backup-manager/app/constants"
 	"github.com/pingcap/tidb-operator/cmd/backup-manager/app/util"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/apis/util/config"
 	bkconstants "github.com/pingcap/tidb-operator/pkg/backup/constants"
+	bkutil "github.com/pingcap/tidb-operator/pkg/backup/util"
 	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/controller"
 	pkgutil "github.com/pingcap/tidb-operator/pkg/util"
@@ -55,7 +59,7 @@ func NewManager(
 	}
 }
 
-func (rm *Manager) setOptions(restore *v1alpha1.Restore) {
+func (rm *Manager) setOptions(restore *v1alpha1.Restore) (string, error) {
 	rm.Options.Host = restore.Spec.To.Host
 
 	if restore.Spec.To.Port != 0 {
@@ -70,7 +74,12 @@ func (rm *Manager) setOptions(restore *v1alpha1.Restore) {
 		rm.Options.User = v1alpha1.DefaultTidbUser
 	}
 
-	rm.Options.Password = util.GetOptionValueFromEnv(bkconstants.TidbPasswordKey, bkconstants.BackupManagerEnvVarPrefix)
+	password, err := util.GetTidbPassword(rm.Options.PasswordFile, bkconstants.TidbPasswordKey, bkconstants.BackupManagerEnvVarPrefix)
+	if err != nil {
+		return "ReadTidbPasswordFailed", err
+	}
+	rm.Options.Password = password
+	return "", nil
 }
 
 // ProcessRestore used to process the restore logic
@@ -92,6 +101,8 @@ func (rm *Manager) ProcessRestore() error {
 		errs = append(errs, uerr)
 		return errorutils.NewAggregate(errs)
 	}
+	// report the failures of an attempt with retries left as RetryFailed
+	rm.StatusUpdater = util.NewRetryRestoreConditionUpdater(rm.StatusUpdater, restore)
 	if restore.Spec.BR == nil {
 		return fmt.Errorf("no br config in %s", rm)
 	}
@@ -100,7 +111,18 @@ func (rm *Manager) ProcessRestore() error {
 		return rm.performRestore(ctx, restore.DeepCopy(), nil)
 	}
 
-	rm.setOptions(restore)
+	if reason, err := rm.setOptions(restore); err != nil {
+		errs = append(errs, err)
+		klog.Errorf("set restore %s option for cluster %s failed, err: %v", rm.ResourceName, rm, err)
+		uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: err.Error(),
+		}, nil)
+		errs = append(errs, uerr)
+		return errorutils.NewAggregate(errs)
+	}
 
 	var db *sql.DB
 	var dsn string
@@ -149,9 +171,62 @@ func (rm *Manager) performRestore(ctx context.Context, restore *v1alpha1.Restore
 	if err != nil {
 		return err
 	}
+	if id := restore.GetCorrelationID(); id != "" {
+		klog.Infof("restore cluster %s with correlation id %s", rm, id)
+	}
 
 	var errs []error
 
+	if len(restore.Spec.FallbackStorageProviders) > 0 {
+		if reason, err := rm.selectStorage(ctx, restore); err != nil {
+			errs = append(errs, err)
+			klog.Errorf("cluster %s select storage failed, err: %s", rm, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+	}
+
+	// check the collations of the backup before changing anything in the target cluster
+	if db != nil && rm.Mode == string(v1alpha1.RestoreModeSnapshot) {
+		if reason, err := rm.checkCollation(ctx, restore, db); err != nil {
+			errs = append(errs, err)
+			klog.Errorf("cluster %s check collation failed, err: %s", rm, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+	}
+
+	// the tables of the canary checks must be present in the backup, check them before restoring
+	var canaryChecksums map[string]util.TableChecksum
+	if db != nil && len(restore.Spec.CanaryChecks) > 0 {
+		checksums, reason, err := rm.prepareCanaryChecks(ctx, restore)
+		if err != nil {
+			errs = append(errs, err)
+			klog.Errorf("cluster %s prepare canary checks failed, err: %s", rm, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+		canaryChecksums = checksums
+	}
+
 	var (
 		oldTikvGCTime, tikvGCLifeTime             string
 		oldTikvGCTimeDuration, tikvGCTimeDuration time.Duration
@@ -238,7 +313,17 @@ func (rm *Manager) performRestore(ctx context.Context, restore *v1alpha1.Restore
 		}
 	}
 
+	// the log backup may go on during the restore, so its checkpoint is read before BR starts
+	var pitrRestoredTS *string
+	if rm.Mode == string(v1alpha1.RestoreModePiTR) {
+		pitrRestoredTS = rm.pitrRestoredTs(restore)
+	}
+
+	// the resource usage is recorded to help tune the resource requirements of the restore jobs
+	sampler := util.NewResourceUsageSampler()
+	sampler.Start()
 	restoreErr := rm.restoreData(ctx, restore, rm.StatusUpdater, rm.RestoreControl)
+	resourceUsage := sampler.Stop()
 
 	if db != nil && oldTikvGCTimeDuration < tikvGCTimeDuration {
 		// use another context to revert `tikv_gc_life_time` back.
@@ -278,8 +363,32 @@ func (rm *Manager) performRestore(ctx context.Context, restore *v1alpha1.Restore
 	}
 	klog.Infof("restore cluster %s from %s succeed", rm, restore.Spec.Type)
 
+	if len(canaryChecksums) > 0 {
+		if reason, err := rm.runCanaryChecks(ctx, restore, db, canaryChecksums); err != nil {
+			errs = append(errs, err)
+			klog.Errorf("cluster %s canary checks failed, err: %s", rm, err)
+			uerr := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreCanaryFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			errs = append(errs, uerr)
+			uerr = rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			errs = append(errs, uerr)
+			return errorutils.NewAggregate(errs)
+		}
+		klog.Infof("cluster %s %d canary checks passed", rm, len(restore.Spec.CanaryChecks))
+	}
+
 	var (
 		commitTS    *string
+		restoredTS  *string
 		restoreType v1alpha1.RestoreConditionType
 		allFinished bool
 	)
@@ -310,12 +419,18 @@ func (rm *Manager) performRestore(ctx context.Context, restore *v1alpha1.Restore
 		restoreType = v1alpha1.RestoreComplete
 		tsStr := strconv.FormatUint(ts, 10)
 		commitTS = &tsStr
+		restoredTS = commitTS
+		if rm.Mode == string(v1alpha1.RestoreModePiTR) {
+			restoredTS = pitrRestoredTS
+		}
 		allFinished = true
 	}
 
 	updateStatus := &controller.RestoreUpdateStatus{
-		TimeStarted: &metav1.Time{Time: started},
-		CommitTs:    commitTS,
+		TimeStarted:   &metav1.Time{Time: started},
+		CommitTs:      commitTS,
+		RestoredTs:    restoredTS,
+		ResourceUsage: resourceUsage,
 	}
 	if allFinished {
 		updateStatus.TimeCompleted = &metav1.Time{Time: time.Now()}
@@ -325,3 +440,120 @@ func (rm *Manager) performRestore(ctx context.Context, restore *v1alpha1.Restore
 		Status: corev1.ConditionTrue,
 	}, updateStatus)
 }
+
+// pitrRestoredTs returns the ts a PiTR restore restores the cluster to. It is the PitrRestoredTs if it's specified,
+// otherwise the global checkpoint of the log backup when the restore starts, which is the latest ts BR restores
+// to. Nil is returned if the ts can't be determined, so a wrong ts is never recorded.
+func (rm *Manager) pitrRestoredTs(restore *v1alpha1.Restore) *string {
+	if rm.PitrRestoredTs != "" {
+		ts, err := config.ParseTSString(rm.PitrRestoredTs)
+		if err != nil {
+			klog.Warningf("cluster %s parse pitrRestoredTs %s failed, err: %s", rm, rm.PitrRestoredTs, err)
+			return nil
+		}
+		tsStr := strconv.FormatUint(ts, 10)
+		return &tsStr
+	}
+	ts, err := bkutil.GetLogBackupCheckpointTs(restore.Spec.StorageProvider, &bkutil.StorageCredential{})
+	if err != nil {
+		klog.Warningf("cluster %s get the checkpoint ts of the log backup failed, err: %s", rm, err)
+		return nil
+	}
+	tsStr := strconv.FormatUint(ts, 10)
+	return &tsStr
+}
+
+// checkCollation compares the collations recorded in the backup meta with the collations supported by the
+// target cluster. The mismatches are only logged unless `StrictCollation` is set.
+func (rm *Manager) checkCollation(ctx context.Context, restore *v1alpha1.Restore, db *sql.DB) (string, error) {
+	backupMeta, err := util.GetBRMetaData(ctx, restore.Spec.StorageProvider)
+	if err != nil {
+		if restore.Spec.StrictCollation {
+			return "GetBRMetaDataFailed", err
+		}
+		klog.Warningf("cluster %s skip collation check, get backup meta failed, err: %s", rm, err)
+		return "", nil
+	}
+	if bkutil.IsBRBackupMetaV2(backupMeta) {
+		rm.recordCheckSkipped(restore, "CollationCheckSkipped", "the schemas of the backup meta v2 are not supported")
+		return "", nil
+	}
+	backupCollations, err := util.GetCollationsFromBRMetaData(backupMeta)
+	if err != nil {
+		return "ParseBackupCollationsFailed", err
+	}
+	if len(backupCollations) == 0 {
+		klog.Infof("cluster %s no collations found in backup meta, skip collation check", rm)
+		return "", nil
+	}
+	targetCollations, err := rm.GetCollations(ctx, db)
+	if err != nil {
+		return "GetTargetCollationsFailed", err
+	}
+
+	mismatches := util.GetCollationMismatches(backupCollations, targetCollations)
+	if len(mismatches) == 0 {
+		return "", nil
+	}
+	msg := fmt.Sprintf("collations of the backup are not compatible with cluster %s: %s", rm, strings.Join(mismatches, "; "))
+	if restore.Spec.StrictCollation {
+		return "CollationMismatch", errors.New(msg)
+	}
+	klog.Warning(msg)
+	return "", nil
+}
+
+// recordCheckSkipped records the skipped check by condition CheckSkipped, the restore goes on
+func (rm *Manager) recordCheckSkipped(restore *v1alpha1.Restore, reason, msg string) {
+	klog.Warningf("cluster %s %s: %s", rm, reason, msg)
+	if err := rm.StatusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreCheckSkipped,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	}, nil); err != nil {
+		klog.Warningf("cluster %s record condition %s failed, err: %s", rm, v1alpha1.RestoreCheckSkipped, err)
+	}
+}
+
+// prepareCanaryChecks reads the checksums of the tables of the canary checks from the backup meta,
+// the restore fails with reason `InvalidCanaryCheck` if any of the tables is not present in the backup.
+// The canary checks are skipped for the backup meta v2, whose checksums are stored in other meta files.
+func (rm *Manager) prepareCanaryChecks(ctx context.Context, restore *v1alpha1.Restore) (map[string]util.TableChecksum, string, error) {
+	backupMeta, err := util.GetBRMetaData(ctx, restore.Spec.StorageProvider)
+	if err != nil {
+		return nil, "GetBRMetaDataFailed", err
+	}
+	if bkutil.IsBRBackupMetaV2(backupMeta) {
+		rm.recordCheckSkipped(restore, "CanaryCheckSkipped", "the checksums of the backup meta v2 are not supported")
+		return nil, "", nil
+	}
+	checksums, err := util.GetTableChecksumsFromBRMetaData(backupMeta)
+	if err != nil {
+		return nil, "ParseBackupChecksumsFailed", err
+	}
+	for _, check := range restore.Spec.CanaryChecks {
+		if _, ok := checksums[util.CanaryCheckTableKey(check.Database, check.Table)]; !ok {
+			return nil, "InvalidCanaryCheck", fmt.Errorf("table %s.%s of canary check is not present in the backup", check.Database, check.Table)
+		}
+	}
+	return checksums, "", nil
+}
+
+// runCanaryChecks checksums the tables of the canary checks in the target cluster and compares the results
+// with the checksums recorded in the backup meta.
+func (rm *Manager) runCanaryChecks(ctx context.Context, restore *v1alpha1.Restore, db *sql.DB, checksums map[string]util.TableChecksum) (string, error) {
+	var mismatches []string
+	for _, check := range restore.Spec.CanaryChecks {
+		actual, err := rm.AdminChecksumTable(ctx, db, check.Database, check.Table)
+		if err != nil {
+			return "ChecksumTableFailed", err
+		}
+		expected := checksums[util.CanaryCheckTableKey(check.Database, check.Table)]
+		mismatches = append(mismatches, util.GetCanaryCheckMismatches(check, expected, actual)...)
+	}
+	if len(mismatches) > 0 {
+		return "CanaryCheckMismatch", fmt.Errorf("canary checks of cluster %s failed: %s", rm, strings.Join(mismatches, "; "))
+	}
+	return "", nil
+}
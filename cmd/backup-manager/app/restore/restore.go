@@ -44,6 +44,13 @@ type Options struct {
 	Prepare bool
 	// TargetAZ indicates which az the volume snapshots restore to. It's used in volume-snapshot mode.
 	TargetAZ string
+	// VolumeType is the cloud volume type the volume snapshots restore to, e.g. aws-ebs or gcp-pd.
+	// It's used in volume-snapshot mode.
+	VolumeType string
+	// BundledBR indicates to use the BR binary bundled in the backup-manager image.
+	BundledBR bool
+	// Checksum is passed to BR as --checksum in snapshot mode, BR's default is used if it's empty.
+	Checksum string
 }
 
 func (ro *Options) restoreData(
@@ -57,12 +64,19 @@ func (ro *Options) restoreData(
 		clusterNamespace = restore.Namespace
 	}
 	args := make([]string, 0)
-	args = append(args, fmt.Sprintf("--pd=%s-pd.%s:%d", restore.Spec.BR.Cluster, clusterNamespace, v1alpha1.DefaultPDClientPort))
+	if len(restore.Spec.PDAddresses) != 0 {
+		args = append(args, fmt.Sprintf("--pd=%s", strings.Join(restore.Spec.PDAddresses, ",")))
+	} else {
+		args = append(args, fmt.Sprintf("--pd=%s-pd.%s:%d", restore.Spec.BR.Cluster, clusterNamespace, v1alpha1.DefaultPDClientPort))
+	}
 	if ro.TLSCluster {
 		args = append(args, fmt.Sprintf("--ca=%s", path.Join(util.ClusterClientTLSPath, corev1.ServiceAccountRootCAKey)))
 		args = append(args, fmt.Sprintf("--cert=%s", path.Join(util.ClusterClientTLSPath, corev1.TLSCertKey)))
 		args = append(args, fmt.Sprintf("--key=%s", path.Join(util.ClusterClientTLSPath, corev1.TLSPrivateKeyKey)))
 	}
+	if ro.Mode == string(v1alpha1.RestoreModeSnapshot) && ro.Checksum != "" {
+		args = append(args, fmt.Sprintf("--checksum=%s", ro.Checksum))
+	}
 	// `options` in spec are put to the last because we want them to have higher priority than generated arguments
 	dataArgs, err := constructBROptions(restore)
 	if err != nil {
@@ -99,8 +113,7 @@ func (ro *Options) restoreData(
 		}
 		restoreType = "point"
 	case string(v1alpha1.RestoreModeVolumeSnapshot):
-		// Currently, we only support aws ebs volume snapshot.
-		args = append(args, "--type=aws-ebs")
+		args = append(args, fmt.Sprintf("--type=%s", ro.VolumeType))
 		if ro.Prepare {
 			args = append(args, "--prepare")
 			csbPath = path.Join(util.BRBinPath, "csb_restore.json")
@@ -120,6 +133,12 @@ func (ro *Options) restoreData(
 	fullArgs = append(fullArgs, args...)
 	klog.Infof("Running br command with args: %v", fullArgs)
 	bin := path.Join(util.BRBinPath, "br")
+	if ro.BundledBR {
+		bin = backupUtil.BundledBRBinPath
+		if err := backupUtil.CheckBRVersion(ctx, bin, ro.TiKVVersion); err != nil {
+			return fmt.Errorf("cluster %s, check bundled br failed, err: %v", ro, err)
+		}
+	}
 	cmd := exec.CommandContext(ctx, bin, fullArgs...)
 
 	stdOut, err := cmd.StdoutPipe()
@@ -219,6 +238,11 @@ func (ro *Options) processCloudSnapBackup(
 		klog.Errorf("read metadata file %s failed, err: %s", csbPath, err)
 		return err
 	}
+	// the large restore meta is gzipped, the operator detects and decompresses it when it's read
+	contents, err = pkgutil.CompressRestoreMeta(contents)
+	if err != nil {
+		return err
+	}
 	// write a file into external storage
 	klog.Infof("save the restore meta to external storage")
 	externalStorage, err := pkgutil.NewStorageBackend(restore.Spec.StorageProvider, &pkgutil.StorageCredential{})
@@ -296,6 +320,7 @@ func (ro *Options) updateResolvedTSForCSB(
 		progress := 100.0
 		if err := statusUpdater.Update(restore, nil, &controller.RestoreUpdateStatus{
 			CommitTs:           &ts,
+			RestoredTs:         &ts,
 			ProgressStep:       &progressStep,
 			Progress:           &progress,
 			ProgressUpdateTime: &metav1.Time{Time: time.Now()},
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/tidb-operator/cmd/backup-manager/app/constants"
@@ -48,6 +49,8 @@ type GenericOptions struct {
 	TruncateUntil  string
 	PitrRestoredTs string
 	Initialize     bool
+	// PasswordFile is the file the password is read from instead of the env if it's set
+	PasswordFile string
 }
 
 func (bo *GenericOptions) String() string {
@@ -105,3 +108,42 @@ func (bo *GenericOptions) SetTikvGCLifeTime(ctx context.Context, db *sql.DB, gcT
 	}
 	return nil
 }
+
+// GetCollations gets the collations supported by the cluster, the key is the collation and the value is its charset
+func (bo *GenericOptions) GetCollations(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	sql := "SELECT COLLATION_NAME, CHARACTER_SET_NAME FROM INFORMATION_SCHEMA.COLLATIONS"
+	rows, err := db.QueryContext(ctx, sql)
+	if err != nil {
+		return nil, fmt.Errorf("query cluster %s collations failed, sql: %s, err: %v", bo, sql, err)
+	}
+	defer rows.Close()
+
+	collations := make(map[string]string)
+	for rows.Next() {
+		var collation, charset string
+		if err := rows.Scan(&collation, &charset); err != nil {
+			return nil, fmt.Errorf("scan cluster %s collations failed, err: %v", bo, err)
+		}
+		collations[strings.ToLower(collation)] = strings.ToLower(charset)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query cluster %s collations failed, sql: %s, err: %v", bo, sql, err)
+	}
+	return collations, nil
+}
+
+// AdminChecksumTable gets the checksum of the table by `ADMIN CHECKSUM TABLE`
+func (bo *GenericOptions) AdminChecksumTable(ctx context.Context, db *sql.DB, database, table string) (TableChecksum, error) {
+	checksum := TableChecksum{}
+	sql := fmt.Sprintf("ADMIN CHECKSUM TABLE %s.%s", quoteIdentifier(database), quoteIdentifier(table))
+	var dbName, tableName string
+	row := db.QueryRowContext(ctx, sql)
+	if err := row.Scan(&dbName, &tableName, &checksum.Crc64Xor, &checksum.TotalKvs, &checksum.TotalBytes); err != nil {
+		return checksum, fmt.Errorf("checksum cluster %s table %s.%s failed, sql: %s, err: %v", bo, database, table, sql, err)
+	}
+	return checksum, nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// resourceUsageSampleInterval is the interval to sample the resource usage of the container
+	resourceUsageSampleInterval = 10 * time.Second
+)
+
+// ResourceUsageSampler samples the CPU and memory usage of the container from its cgroup,
+// both cgroup v1 and v2 are supported. The usage can't be read from metrics-server after the
+// job is finished, so it is sampled by the job itself.
+type ResourceUsageSampler struct {
+	root     string
+	interval time.Duration
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+
+	mu           sync.Mutex
+	started      time.Time
+	lastSampled  time.Time
+	lastCPUUsage time.Duration
+	peakCPU      float64
+	peakMemory   int64
+	cpuSampled   bool
+	memSampled   bool
+}
+
+// NewResourceUsageSampler returns a sampler of the container the process runs in
+func NewResourceUsageSampler() *ResourceUsageSampler {
+	return newResourceUsageSampler(cgroupRoot, resourceUsageSampleInterval)
+}
+
+func newResourceUsageSampler(root string, interval time.Duration) *ResourceUsageSampler {
+	return &ResourceUsageSampler{
+		root:     root,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// Start starts sampling in background until Stop is called
+func (s *ResourceUsageSampler) Start() {
+	now := time.Now()
+	s.mu.Lock()
+	s.started = now
+	s.mu.Unlock()
+	s.sample(now)
+
+	go func() {
+		defer close(s.doneCh)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case now := <-ticker.C:
+				s.sample(now)
+			}
+		}
+	}()
+}
+
+// Stop stops sampling and returns the resource usage, nil is returned if the cgroup can't be read
+func (s *ResourceUsageSampler) Stop() *v1alpha1.RestoreResourceUsage {
+	close(s.stopCh)
+	<-s.doneCh
+	now := time.Now()
+	s.sample(now)
+	return s.usage(now)
+}
+
+func (s *ResourceUsageSampler) usage(now time.Time) *v1alpha1.RestoreResourceUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cpuSampled && !s.memSampled {
+		return nil
+	}
+
+	usage := &v1alpha1.RestoreResourceUsage{
+		Duration: now.Sub(s.started).Round(time.Second).String(),
+	}
+	if s.cpuSampled {
+		usage.PeakCPU = resource.NewMilliQuantity(int64(s.peakCPU*1000), resource.DecimalSI)
+	}
+	if s.memSampled {
+		usage.PeakMemory = resource.NewQuantity(s.peakMemory, resource.BinarySI)
+	}
+	return usage
+}
+
+func (s *ResourceUsageSampler) sample(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cpuUsage, err := readCgroupCPUUsage(s.root); err != nil {
+		klog.V(4).Infof("read cpu usage from cgroup failed, err: %v", err)
+	} else {
+		if !s.lastSampled.IsZero() && now.After(s.lastSampled) {
+			cores := float64(cpuUsage-s.lastCPUUsage) / float64(now.Sub(s.lastSampled))
+			if cores > s.peakCPU {
+				s.peakCPU = cores
+			}
+			s.cpuSampled = true
+		}
+		s.lastCPUUsage = cpuUsage
+		s.lastSampled = now
+	}
+
+	if memUsage, err := readCgroupMemoryUsage(s.root); err != nil {
+		klog.V(4).Infof("read memory usage from cgroup failed, err: %v", err)
+	} else {
+		if memUsage > s.peakMemory {
+			s.peakMemory = memUsage
+		}
+		s.memSampled = true
+	}
+}
+
+// readCgroupCPUUsage returns the cumulative CPU time consumed by the cgroup
+func readCgroupCPUUsage(root string) (time.Duration, error) {
+	// cgroup v2
+	if f, err := os.Open(filepath.Join(root, "cpu.stat")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "usage_usec" {
+				usec, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return 0, err
+				}
+				return time.Duration(usec) * time.Microsecond, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+	// cgroup v1
+	for _, file := range []string{"cpuacct/cpuacct.usage", "cpu,cpuacct/cpuacct.usage"} {
+		if nsec, err := readCgroupInt(filepath.Join(root, file)); err == nil {
+			return time.Duration(nsec), nil
+		}
+	}
+	return 0, fmt.Errorf("cpu usage is not found in cgroup %s", root)
+}
+
+// readCgroupMemoryUsage returns the max of the current and the peak memory usage recorded by the cgroup
+func readCgroupMemoryUsage(root string) (int64, error) {
+	files := []string{
+		// cgroup v2, memory.peak is only available since linux 5.19
+		"memory.current", "memory.peak",
+		// cgroup v1
+		"memory/memory.usage_in_bytes", "memory/memory.max_usage_in_bytes",
+	}
+	var usage int64
+	found := false
+	for _, file := range files {
+		if bytes, err := readCgroupInt(filepath.Join(root, file)); err == nil {
+			found = true
+			if bytes > usage {
+				usage = bytes
+			}
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("memory usage is not found in cgroup %s", root)
+	}
+	return usage, nil
+}
+
+func readCgroupInt(file string) (int64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestResourceUsageSampler(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	writeFile := func(root, file, content string) {
+		g.Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(root, file), []byte(content), 0644)).To(Succeed()) //nolint:gosec
+	}
+	started := time.Now()
+
+	t.Run("cgroup v2", func(t *testing.T) {
+		root := t.TempDir()
+		s := newResourceUsageSampler(root, time.Second)
+		s.started = started
+
+		writeFile(root, "cpu.stat", "usage_usec 1000000\nuser_usec 800000\n")
+		writeFile(root, "memory.current", "1073741824\n")
+		s.sample(started)
+		// 2 cores in 10s
+		writeFile(root, "cpu.stat", "usage_usec 21000000\nuser_usec 800000\n")
+		writeFile(root, "memory.current", "536870912\n")
+		s.sample(started.Add(10 * time.Second))
+		// 0.5 core in 10s
+		writeFile(root, "cpu.stat", "usage_usec 26000000\nuser_usec 800000\n")
+		s.sample(started.Add(20 * time.Second))
+
+		usage := s.usage(started.Add(20 * time.Second))
+		g.Expect(usage).NotTo(BeNil())
+		g.Expect(usage.PeakCPU.Cmp(resource.MustParse("2"))).To(Equal(0))
+		g.Expect(usage.PeakMemory.Cmp(resource.MustParse("1Gi"))).To(Equal(0))
+		g.Expect(usage.Duration).To(Equal("20s"))
+	})
+
+	t.Run("cgroup v1", func(t *testing.T) {
+		root := t.TempDir()
+		s := newResourceUsageSampler(root, time.Second)
+		s.started = started
+
+		writeFile(root, "cpuacct/cpuacct.usage", "0\n")
+		writeFile(root, "memory/memory.usage_in_bytes", "1048576\n")
+		writeFile(root, "memory/memory.max_usage_in_bytes", "2097152\n")
+		s.sample(started)
+		writeFile(root, "cpuacct/cpuacct.usage", "5000000000\n")
+		s.sample(started.Add(10 * time.Second))
+
+		usage := s.usage(started.Add(10 * time.Second))
+		g.Expect(usage).NotTo(BeNil())
+		g.Expect(usage.PeakCPU.Cmp(resource.MustParse("500m"))).To(Equal(0))
+		g.Expect(usage.PeakMemory.Cmp(resource.MustParse("2Mi"))).To(Equal(0))
+	})
+
+	t.Run("cgroup not available", func(t *testing.T) {
+		s := newResourceUsageSampler(t.TempDir(), time.Millisecond)
+		s.Start()
+		g.Expect(s.Stop()).To(BeNil())
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+)
+
+// retryRestoreConditionUpdater records the attempts of the restore job, and reports a failure as condition
+// RetryFailed instead of Failed while the job has retries left, so the restore is not failed before the
+// job gives up.
+type retryRestoreConditionUpdater struct {
+	controller.RestoreConditionUpdaterInterface
+	subJobType  v1alpha1.RestoreSubJobType
+	attempts    int32
+	retriesLeft int32
+}
+
+// NewRetryRestoreConditionUpdater wraps the updater for the attempt of the restore job run by this pod
+func NewRetryRestoreConditionUpdater(updater controller.RestoreConditionUpdaterInterface, restore *v1alpha1.Restore) controller.RestoreConditionUpdaterInterface {
+	subJobType := restore.GetRestoreSubJobType()
+	attempts := int32(1)
+	if _, subJob := v1alpha1.GetRestoreSubJob(&restore.Status, subJobType); subJob != nil {
+		attempts = subJob.Attempts + 1
+	}
+	// every pod of the sharded import is an attempt, the job retries the failed pods of all the shards
+	// within the backoff limit
+	retriesLeft := restore.GetBackoffLimit() + restore.GetImportParallelism() - attempts
+	return &retryRestoreConditionUpdater{
+		RestoreConditionUpdaterInterface: updater,
+		subJobType:                       subJobType,
+		attempts:                         attempts,
+		retriesLeft:                      retriesLeft,
+	}
+}
+
+func (u *retryRestoreConditionUpdater) Update(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error {
+	if condition != nil {
+		switch condition.Type {
+		case v1alpha1.RestoreRunning:
+			if newStatus == nil {
+				newStatus = &controller.RestoreUpdateStatus{}
+			}
+			if newStatus.SubJob == nil {
+				newStatus.SubJob = &v1alpha1.RestoreSubJobStatus{
+					Type:     u.subJobType,
+					Attempts: u.attempts,
+				}
+			}
+		case v1alpha1.RestoreFailed:
+			if u.retriesLeft > 0 {
+				retryCondition := *condition
+				retryCondition.Type = v1alpha1.RestoreRetryFailed
+				retryCondition.Message = fmt.Sprintf("%s, the job will be retried, %d retries left", condition.Message, u.retriesLeft)
+				condition = &retryCondition
+			}
+		}
+	}
+	return u.RestoreConditionUpdaterInterface.Update(restore, condition, newStatus)
+}
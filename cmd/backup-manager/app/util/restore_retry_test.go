@@ -0,0 +1,80 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+type recordRestoreConditionUpdater struct {
+	condition *v1alpha1.RestoreCondition
+	newStatus *controller.RestoreUpdateStatus
+}
+
+func (u *recordRestoreConditionUpdater) Update(_ *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error {
+	u.condition = condition
+	u.newStatus = newStatus
+	return nil
+}
+
+func TestRetryRestoreConditionUpdater(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	restore := &v1alpha1.Restore{}
+	restore.Spec.BackoffLimit = pointer.Int32Ptr(2)
+	restore.Status.SubJobs = []v1alpha1.RestoreSubJobStatus{
+		{Type: v1alpha1.RestoreSubJobRestore, Phase: v1alpha1.RestoreSubJobRunning, Attempts: 1},
+	}
+	failed := &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "RestoreDataFailed",
+		Message: "connection reset",
+	}
+
+	// the second attempt records its attempts and has one retry left
+	record := &recordRestoreConditionUpdater{}
+	updater := NewRetryRestoreConditionUpdater(record, restore)
+	g.Expect(updater.Update(restore, &v1alpha1.RestoreCondition{
+		Type:   v1alpha1.RestoreRunning,
+		Status: corev1.ConditionTrue,
+	}, nil)).To(Succeed())
+	g.Expect(record.newStatus.SubJob.Type).To(Equal(v1alpha1.RestoreSubJobRestore))
+	g.Expect(record.newStatus.SubJob.Attempts).To(Equal(int32(2)))
+
+	g.Expect(updater.Update(restore, failed, nil)).To(Succeed())
+	g.Expect(record.condition.Type).To(Equal(v1alpha1.RestoreRetryFailed))
+	g.Expect(record.condition.Reason).To(Equal("RestoreDataFailed"))
+	g.Expect(record.condition.Message).To(Equal("connection reset, the job will be retried, 1 retries left"))
+
+	// the last attempt fails the restore
+	restore.Status.SubJobs[0].Attempts = 2
+	updater = NewRetryRestoreConditionUpdater(record, restore)
+	g.Expect(updater.Update(restore, failed, nil)).To(Succeed())
+	g.Expect(record.condition).To(Equal(failed))
+
+	// the pods of all the shards of the sharded import are attempts
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(4)
+	restore.Status.SubJobs[0].Attempts = 4
+	updater = NewRetryRestoreConditionUpdater(record, restore)
+	g.Expect(updater.Update(restore, failed, nil)).To(Succeed())
+	g.Expect(record.condition.Type).To(Equal(v1alpha1.RestoreRetryFailed))
+	g.Expect(record.condition.Message).To(Equal("connection reset, the job will be retried, 1 retries left"))
+}
@@ -15,13 +15,17 @@ package util
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -57,6 +61,9 @@ var (
 		"--filter", "*.*",
 		"--filter", constants.DefaultTableFilter,
 	}
+	// BundledBRBinPath is the path of the BR binary bundled in the backup-manager image
+	BundledBRBinPath      = "/br"
+	brReleaseVersionRegex = regexp.MustCompile(`Release Version:\s*(\S+)`)
 )
 
 func validCmdFlagFunc(flag *pflag.Flag) {
@@ -155,6 +162,18 @@ func GetOptionValueFromEnv(option, envPrefix string) string {
 	return os.Getenv(envVar)
 }
 
+// GetTidbPassword reads the password of tidb from the password file if it's set, otherwise from the env of the option
+func GetTidbPassword(passwordFile, option, envPrefix string) (string, error) {
+	if passwordFile == "" {
+		return GetOptionValueFromEnv(option, envPrefix), nil
+	}
+	password, err := ioutil.ReadFile(passwordFile)
+	if err != nil {
+		return "", fmt.Errorf("read tidb password file %s failed, err: %v", passwordFile, err)
+	}
+	return string(password), nil
+}
+
 // ConstructBRGlobalOptionsForBackup constructs BR global options for backup and also return the remote path.
 func ConstructBRGlobalOptionsForBackup(backup *v1alpha1.Backup) ([]string, error) {
 	var args []string
@@ -294,6 +313,40 @@ func Suffix(version string) string {
 	return defaultSuffix
 }
 
+// ParseBRReleaseVersion parses the release version from the output of `br -V`
+func ParseBRReleaseVersion(output string) (*semver.Version, error) {
+	matches := brReleaseVersionRegex.FindStringSubmatch(output)
+	if len(matches) != 2 {
+		return nil, fmt.Errorf("no release version found in br version output %q", output)
+	}
+	return semver.NewVersion(matches[1])
+}
+
+// CheckBRVersion checks that the BR binary at the given path has the same major and minor version as tikvVersion
+func CheckBRVersion(ctx context.Context, bin, tikvVersion string) error {
+	output, err := exec.CommandContext(ctx, bin, "-V").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("get version of br %s failed, output: %s, err: %v", bin, output, err)
+	}
+	brVersion, err := ParseBRReleaseVersion(string(output))
+	if err != nil {
+		return err
+	}
+	return MatchBRVersion(brVersion, tikvVersion)
+}
+
+// MatchBRVersion checks that brVersion has the same major and minor version as tikvVersion
+func MatchBRVersion(brVersion *semver.Version, tikvVersion string) error {
+	v, err := semver.NewVersion(tikvVersion)
+	if err != nil {
+		return fmt.Errorf("parse tikv version %s failed, err: %v", tikvVersion, err)
+	}
+	if brVersion.Major() != v.Major() || brVersion.Minor() != v.Minor() {
+		return fmt.Errorf("br version %s does not match tikv version %s", brVersion.Original(), tikvVersion)
+	}
+	return nil
+}
+
 // GetOptions gets the rclone options
 func GetOptions(provider v1alpha1.StorageProvider) []string {
 	st := util.GetStorageType(provider)
@@ -329,7 +382,52 @@ func GetCommitTsFromMetadata(backupPath string) (string, error) {
 	if err != nil {
 		return commitTs, fmt.Errorf("read metadata file %s failed, err: %v", metaFile, err)
 	}
+	return parseCommitTs(contents, metaFile)
+}
+
+// GetCommitTsFromStorage get the commitTs from the metadata file of the dump in the storage
+func GetCommitTsFromStorage(ctx context.Context, provider v1alpha1.StorageProvider) (string, error) {
+	s, err := util.NewStorageBackend(provider, &util.StorageCredential{})
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+
+	contents, err := s.ReadAll(ctx, constants.MetaDataFile)
+	if err != nil {
+		return "", fmt.Errorf("read metadata file %s from %s failed, err: %v", constants.MetaDataFile, s.GetPrefix(), err)
+	}
+	return parseCommitTs(contents, constants.MetaDataFile)
+}
+
+// ListFilesFromStorage returns the keys of the files in the storage, which are relative to the prefix of the storage
+func ListFilesFromStorage(ctx context.Context, provider v1alpha1.StorageProvider) ([]string, error) {
+	s, err := util.NewStorageBackend(provider, &util.StorageCredential{})
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	var keys []string
+	iter := s.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list files under bucket %s and prefix %s failed, err: %v", s.GetBucket(), s.GetPrefix(), err)
+		}
+		if !obj.IsDir {
+			keys = append(keys, obj.Key)
+		}
+	}
+	return keys, nil
+}
 
+// parseCommitTs parses the commitTs from the contents of the metadata file of the dump
+func parseCommitTs(contents []byte, metaFile string) (string, error) {
+	var commitTs string
 	for _, lineStr := range strings.Split(string(contents), "\n") {
 		if !strings.Contains(lineStr, "Pos") {
 			continue
@@ -408,6 +506,124 @@ func GetCommitTsFromBRMetaData(ctx context.Context, provider v1alpha1.StoragePro
 	return backupMeta.EndVersion, nil
 }
 
+// GetCollationsFromBRMetaData gets the collations used by the databases and tables in the backup meta,
+// the key is the collation and the value is its charset
+func GetCollationsFromBRMetaData(backupMeta *kvbackup.BackupMeta) (map[string]string, error) {
+	type charsetInfo struct {
+		Charset string `json:"charset"`
+		Collate string `json:"collate"`
+	}
+	collations := make(map[string]string)
+	add := func(raw []byte) error {
+		if len(raw) == 0 {
+			return nil
+		}
+		info := charsetInfo{}
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return err
+		}
+		if info.Collate != "" {
+			collations[strings.ToLower(info.Collate)] = strings.ToLower(info.Charset)
+		}
+		return nil
+	}
+	for _, schema := range backupMeta.Schemas {
+		if err := add(schema.Db); err != nil {
+			return nil, fmt.Errorf("parse db info in backup meta failed, err: %v", err)
+		}
+		if err := add(schema.Table); err != nil {
+			return nil, fmt.Errorf("parse table info in backup meta failed, err: %v", err)
+		}
+	}
+	return collations, nil
+}
+
+// GetCollationMismatches returns the collations of the backup which are not supported by the target,
+// or belong to a different charset in the target
+func GetCollationMismatches(backupCollations, targetCollations map[string]string) []string {
+	var mismatches []string
+	for collation, charset := range backupCollations {
+		targetCharset, ok := targetCollations[collation]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("collation %s is not supported", collation))
+			continue
+		}
+		if charset != "" && charset != targetCharset {
+			mismatches = append(mismatches, fmt.Sprintf("collation %s belongs to charset %s instead of %s", collation, targetCharset, charset))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// TableChecksum is the checksum of a table, it is recorded in the backup meta by BR and
+// returned by `ADMIN CHECKSUM TABLE` of TiDB
+type TableChecksum struct {
+	Crc64Xor   uint64
+	TotalKvs   uint64
+	TotalBytes uint64
+}
+
+// GetTableChecksumsFromBRMetaData gets the checksums of the tables in the backup meta,
+// the key is the lower case `db.table`
+func GetTableChecksumsFromBRMetaData(backupMeta *kvbackup.BackupMeta) (map[string]TableChecksum, error) {
+	type cIStr struct {
+		O string `json:"O"`
+	}
+	type dbInfo struct {
+		Name cIStr `json:"db_name"`
+	}
+	type tableInfo struct {
+		Name cIStr `json:"name"`
+	}
+	checksums := make(map[string]TableChecksum)
+	for _, schema := range backupMeta.Schemas {
+		// the schemas without table are the empty databases
+		if len(schema.Db) == 0 || len(schema.Table) == 0 {
+			continue
+		}
+		db := dbInfo{}
+		if err := json.Unmarshal(schema.Db, &db); err != nil {
+			return nil, fmt.Errorf("parse db info in backup meta failed, err: %v", err)
+		}
+		table := tableInfo{}
+		if err := json.Unmarshal(schema.Table, &table); err != nil {
+			return nil, fmt.Errorf("parse table info in backup meta failed, err: %v", err)
+		}
+		checksums[CanaryCheckTableKey(db.Name.O, table.Name.O)] = TableChecksum{
+			Crc64Xor:   schema.Crc64Xor,
+			TotalKvs:   schema.TotalKvs,
+			TotalBytes: schema.TotalBytes,
+		}
+	}
+	return checksums, nil
+}
+
+// CanaryCheckTableKey returns the key of the table of a canary check, database and table names are case-insensitive
+func CanaryCheckTableKey(database, table string) string {
+	return strings.ToLower(database + "." + table)
+}
+
+// GetCanaryCheckMismatches compares the checksum of the restored table with the one in the backup meta
+// according to the type of the canary check
+func GetCanaryCheckMismatches(check v1alpha1.CanaryCheck, expected, actual TableChecksum) []string {
+	var mismatches []string
+	table := fmt.Sprintf("%s.%s", check.Database, check.Table)
+	if expected.TotalKvs != actual.TotalKvs {
+		mismatches = append(mismatches, fmt.Sprintf("total kvs of table %s is %d instead of %d", table, actual.TotalKvs, expected.TotalKvs))
+	}
+	if check.Type == v1alpha1.CanaryCheckTypeKVCount {
+		return mismatches
+	}
+	if expected.TotalBytes != actual.TotalBytes {
+		mismatches = append(mismatches, fmt.Sprintf("total bytes of table %s is %d instead of %d", table, actual.TotalBytes, expected.TotalBytes))
+	}
+	if expected.Crc64Xor != actual.Crc64Xor {
+		mismatches = append(mismatches, fmt.Sprintf("checksum of table %s is %d instead of %d", table, actual.Crc64Xor, expected.Crc64Xor))
+	}
+	return mismatches
+}
+
 // ConstructRcloneArgs constructs the rclone args
 func ConstructRcloneArgs(conf string, opts []string, command, source, dest string, verboseLog bool) []string {
 	var args []string
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	. "github.com/onsi/gomega"
+	kvbackup "github.com/pingcap/kvproto/pkg/backup"
 	appconstant "github.com/pingcap/tidb-operator/cmd/backup-manager/app/constants"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -311,6 +312,147 @@ func TestSuffix(t *testing.T) {
 	}
 }
 
+func TestMatchBRVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type testcase struct {
+		name        string
+		output      string
+		tikvVersion string
+		expectErr   string
+	}
+
+	tests := []*testcase{
+		{
+			name:        "same version",
+			output:      "Release Version: v6.5.0\nGit Commit Hash: 1e3b8e4d\n",
+			tikvVersion: "v6.5.0",
+		},
+		{
+			name:        "different patch version",
+			output:      "Release Version: v6.5.2\n",
+			tikvVersion: "v6.5.0",
+		},
+		{
+			name:        "different minor version",
+			output:      "Release Version: v6.1.0\n",
+			tikvVersion: "v6.5.0",
+			expectErr:   "does not match tikv version",
+		},
+		{
+			name:        "no release version",
+			output:      "unknown flag -V\n",
+			tikvVersion: "v6.5.0",
+			expectErr:   "no release version found",
+		},
+		{
+			name:        "invalid tikv version",
+			output:      "Release Version: v6.5.0\n",
+			tikvVersion: "latest",
+			expectErr:   "parse tikv version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brVersion, err := ParseBRReleaseVersion(tt.output)
+			if err == nil {
+				err = MatchBRVersion(brVersion, tt.tikvVersion)
+			}
+			if tt.expectErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.expectErr))
+			}
+		})
+	}
+}
+
+func TestGetCollationMismatches(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	backupMeta := &kvbackup.BackupMeta{
+		Schemas: []*kvbackup.Schema{
+			{
+				Db:    []byte(`{"db_name":{"O":"test","L":"test"},"charset":"utf8mb4","collate":"utf8mb4_bin"}`),
+				Table: []byte(`{"name":{"O":"t1","L":"t1"},"charset":"utf8mb4","collate":"utf8mb4_general_ci"}`),
+			},
+			{
+				Db:    []byte(`{"db_name":{"O":"test","L":"test"},"charset":"utf8mb4","collate":"utf8mb4_bin"}`),
+				Table: []byte(`{"name":{"O":"t2","L":"t2"},"charset":"latin1","collate":"LATIN1_BIN"}`),
+			},
+		},
+	}
+	backupCollations, err := GetCollationsFromBRMetaData(backupMeta)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(backupCollations).To(Equal(map[string]string{
+		"utf8mb4_bin":        "utf8mb4",
+		"utf8mb4_general_ci": "utf8mb4",
+		"latin1_bin":         "latin1",
+	}))
+
+	target := map[string]string{
+		"utf8mb4_bin":        "utf8mb4",
+		"utf8mb4_general_ci": "utf8mb4",
+		"latin1_bin":         "latin1",
+	}
+	g.Expect(GetCollationMismatches(backupCollations, target)).To(BeEmpty())
+
+	// new collation framework is disabled in the target
+	target = map[string]string{
+		"utf8mb4_bin": "utf8mb4",
+		"latin1_bin":  "utf8mb4",
+	}
+	g.Expect(GetCollationMismatches(backupCollations, target)).To(Equal([]string{
+		"collation latin1_bin belongs to charset utf8mb4 instead of latin1",
+		"collation utf8mb4_general_ci is not supported",
+	}))
+
+	_, err = GetCollationsFromBRMetaData(&kvbackup.BackupMeta{Schemas: []*kvbackup.Schema{{Db: []byte("{")}}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCanaryCheckMismatches(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	backupMeta := &kvbackup.BackupMeta{
+		Schemas: []*kvbackup.Schema{
+			{
+				Db:         []byte(`{"db_name":{"O":"Test","L":"test"}}`),
+				Table:      []byte(`{"name":{"O":"T1","L":"t1"}}`),
+				Crc64Xor:   123,
+				TotalKvs:   10,
+				TotalBytes: 1024,
+			},
+			{
+				// empty database
+				Db: []byte(`{"db_name":{"O":"empty","L":"empty"}}`),
+			},
+		},
+	}
+	checksums, err := GetTableChecksumsFromBRMetaData(backupMeta)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(checksums).To(Equal(map[string]TableChecksum{
+		"test.t1": {Crc64Xor: 123, TotalKvs: 10, TotalBytes: 1024},
+	}))
+
+	expected := checksums[CanaryCheckTableKey("test", "t1")]
+	check := v1alpha1.CanaryCheck{Database: "test", Table: "t1"}
+	g.Expect(GetCanaryCheckMismatches(check, expected, expected)).To(BeEmpty())
+	g.Expect(GetCanaryCheckMismatches(check, expected, TableChecksum{Crc64Xor: 456, TotalKvs: 9, TotalBytes: 1024})).To(Equal([]string{
+		"total kvs of table test.t1 is 9 instead of 10",
+		"checksum of table test.t1 is 456 instead of 123",
+	}))
+
+	// only the total kvs is compared by KVCount
+	check.Type = v1alpha1.CanaryCheckTypeKVCount
+	g.Expect(GetCanaryCheckMismatches(check, expected, TableChecksum{Crc64Xor: 456, TotalKvs: 10, TotalBytes: 1})).To(BeEmpty())
+
+	_, err = GetTableChecksumsFromBRMetaData(&kvbackup.BackupMeta{Schemas: []*kvbackup.Schema{{Db: []byte("{}"), Table: []byte("{")}}})
+	g.Expect(err).To(HaveOccurred())
+}
+
 func TestConstructBRGlobalOptionsForRestore(t *testing.T) {
 	g := NewGomegaWithT(t)
 
@@ -408,6 +550,38 @@ func TestGetCommitTsFromMetadata(t *testing.T) {
 	commitTs, err := GetCommitTsFromMetadata(tmpdir)
 	g.Expect(err).To(Succeed())
 	g.Expect(commitTs).To(Equal("409054741514944513"))
+
+	// the metadata file of the dump read by the logical restore is in the storage
+	commitTs, err = GetCommitTsFromStorage(context.Background(), v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume:      corev1.Volume{Name: "local"},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: tmpdir},
+		},
+	})
+	g.Expect(err).To(Succeed())
+	g.Expect(commitTs).To(Equal("409054741514944513"))
+}
+
+func TestGetTidbPassword(t *testing.T) {
+	g := NewGomegaWithT(t)
+	os.Setenv("TEST_PASSWORD", "env-password")
+	defer os.Unsetenv("TEST_PASSWORD")
+
+	password, err := GetTidbPassword("", "password", "TEST")
+	g.Expect(err).To(Succeed())
+	g.Expect(password).To(Equal("env-password"))
+
+	tmpdir, err := ioutil.TempDir("", "test-get-tidb-password")
+	g.Expect(err).To(Succeed())
+	defer os.RemoveAll(tmpdir)
+	passwordFile := filepath.Join(tmpdir, "password")
+	_, err = GetTidbPassword(passwordFile, "password", "TEST")
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(ioutil.WriteFile(passwordFile, []byte("file-password"), 0600)).To(Succeed())
+	password, err = GetTidbPassword(passwordFile, "password", "TEST")
+	g.Expect(err).To(Succeed())
+	g.Expect(password).To(Equal("file-password"))
 }
 
 func TestConstructRcloneArgs(t *testing.T) {
@@ -239,7 +239,15 @@ func main() {
 		})
 	}, cliCfg.WaitDuration)
 
-	srv := createHTTPServer()
+	srv := createHTTPServer(deps)
+	restoreStatusSrv := createRestoreStatusServer(deps, ns)
+	if restoreStatusSrv != nil {
+		go func() {
+			if err := restoreStatusSrv.ListenAndServe(); err != http.ErrServerClosed {
+				klog.Fatal(err)
+			}
+		}()
+	}
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
 		syscall.SIGHUP,
@@ -251,6 +259,11 @@ func main() {
 	go func() {
 		sig := <-sc
 		klog.Infof("got signal %s to exit", sig)
+		if restoreStatusSrv != nil {
+			if err2 := restoreStatusSrv.Shutdown(context.Background()); err2 != nil {
+				klog.Fatal("fail to shutdown the restore status server", err2)
+			}
+		}
 		if err2 := srv.Shutdown(context.Background()); err2 != nil {
 			klog.Fatal("fail to shutdown the HTTP server", err2)
 		}
@@ -262,7 +275,7 @@ func main() {
 	klog.Infof("tidb-controller-manager exited")
 }
 
-func createHTTPServer() *http.Server {
+func createHTTPServer(deps *controller.Dependencies) *http.Server {
 	serverMux := http.NewServeMux()
 	// HTTP path for pprof
 	serverMux.Handle("/", http.DefaultServeMux)
@@ -275,6 +288,21 @@ func createHTTPServer() *http.Server {
 	}
 }
 
+// createRestoreStatusServer returns the server of the active restores endpoint, which is read-only and served
+// from the informer cache to the requests authorized to list the restores. It listens on its own address so
+// that it's not exposed with pprof, and it's nil if the address is not set.
+func createRestoreStatusServer(deps *controller.Dependencies, ns string) *http.Server {
+	if deps.CLIConfig.RestoreStatusAddr == "" {
+		return nil
+	}
+	serverMux := http.NewServeMux()
+	serverMux.Handle("/restores", restore.NewStatusHandler(deps, ns))
+	return &http.Server{
+		Addr:    deps.CLIConfig.RestoreStatusAddr,
+		Handler: serverMux,
+	}
+}
+
 func logCustomPorts() {
 	if v1alpha1.DefaultTiDBServerPort != 4000 ||
 		v1alpha1.DefaultTiDBStatusPort != 10080 ||
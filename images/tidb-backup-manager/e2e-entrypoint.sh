@@ -28,6 +28,8 @@ region = ${AWS_REGION}
 acl = ${AWS_ACL}
 endpoint = ${S3_ENDPOINT}
 storage_class = ${AWS_STORAGE_CLASS}
+server_side_encryption = ${AWS_SSE}
+sse_kms_key_id = ${AWS_SSE_KMS_KEY_ID}
 [gcs]
 type = google cloud storage
 project_number = ${GCS_PROJECT_ID}
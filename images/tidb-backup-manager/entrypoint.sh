@@ -28,6 +28,8 @@ region = ${AWS_REGION}
 acl = ${AWS_ACL}
 endpoint = ${S3_ENDPOINT}
 storage_class = ${AWS_STORAGE_CLASS}
+server_side_encryption = ${AWS_SSE}
+sse_kms_key_id = ${AWS_SSE_KMS_KEY_ID}
 [gcs]
 type = google cloud storage
 project_number = ${GCS_PROJECT_ID}
@@ -51,6 +53,21 @@ else
     touch ${GOOGLE_APPLICATION_CREDENTIALS}
 fi
 
+if [[ -n "${STORAGE_CA_BUNDLE:-}" ]]; then
+    # AWS_CA_BUNDLE and SSL_CERT_FILE replace the system roots, so trust the CA of the storage together with them
+    echo "Create the CA bundle of the storage."
+    CA_BUNDLE=/tmp/storage-ca-bundle.crt
+    for SYSTEM_CA_BUNDLE in /etc/pki/tls/certs/ca-bundle.crt /etc/ssl/certs/ca-certificates.crt; do
+        if [[ -f "${SYSTEM_CA_BUNDLE}" ]]; then
+            cat ${SYSTEM_CA_BUNDLE} > ${CA_BUNDLE}
+            break
+        fi
+    done
+    cat ${STORAGE_CA_BUNDLE} >> ${CA_BUNDLE}
+    export AWS_CA_BUNDLE=${CA_BUNDLE}
+    export SSL_CERT_FILE=${CA_BUNDLE}
+fi
+
 BACKUP_BIN=/tidb-backup-manager
 if [[ -n "${AWS_DEFAULT_REGION}" ]]; then
 	EXEC_COMMAND="exec"
@@ -82,6 +82,8 @@ type VolumeBackupMemberSpec struct {
 	// - AWS_REGION
 	// - AWS_ACL
 	// - AWS_STORAGE_CLASS
+	// - AWS_SSE
+	// - AWS_SSE_KMS_KEY_ID
 	// - AWS_DEFAULT_REGION
 	// - AWS_ACCESS_KEY_ID
 	// - AWS_SECRET_ACCESS_KEY
@@ -334,6 +336,8 @@ type VolumeRestoreMemberSpec struct {
 	// - AWS_REGION
 	// - AWS_ACL
 	// - AWS_STORAGE_CLASS
+	// - AWS_SSE
+	// - AWS_SSE_KMS_KEY_ID
 	// - AWS_DEFAULT_REGION
 	// - AWS_ACCESS_KEY_ID
 	// - AWS_SECRET_ACCESS_KEY
@@ -15,6 +15,7 @@ package label
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -59,11 +60,18 @@ const (
 	// RestoreLabelKey is restore key
 	RestoreLabelKey string = "tidb.pingcap.com/restore"
 
+	// RestoreGenerationLabelKey is the generation of the restore spec that a restore job is created from
+	RestoreGenerationLabelKey string = "tidb.pingcap.com/restore-generation"
+	// CorrelationIDLabelKey is the correlation id used to trace the resources of a restore across systems
+	CorrelationIDLabelKey string = "tidb.pingcap.com/correlation-id"
+
 	// BackupProtectionFinalizer is the name of finalizer on backups or federation backups
 	BackupProtectionFinalizer string = "tidb.pingcap.com/backup-protection"
 
 	// VolumeRestoreFederationFinalizer is the name of finalizer on federation restores
 	VolumeRestoreFederationFinalizer string = "tidb.pingcap.com/restore-protection"
+	// RestoreJobCleanupFinalizer is the name of finalizer on restores whose job is in another namespace
+	RestoreJobCleanupFinalizer string = "tidb.pingcap.com/restore-job-cleanup"
 
 	// AutoScalingGroupLabelKey describes the autoscaling group of the TiDB
 	AutoScalingGroupLabelKey = "tidb.pingcap.com/autoscaling-group"
@@ -140,6 +148,14 @@ const (
 	// when TiDB cluster is restored from volume snapshot based backup.
 	AnnTiKVVolumesReadyKey = "tidb.pingcap.com/tikv-volumes-ready"
 
+	// AnnCorrelationIDKey is the annotation key to set the correlation id of a restore,
+	// it is used when the correlation id is not set in the restore spec.
+	AnnCorrelationIDKey = "tidb.pingcap.com/correlation-id"
+
+	// AnnRestoreUIDKey is the annotation key to record the UID of the restore the restore pvc is created for,
+	// the restore recreated with the same name is a different restore and doesn't own the pvc.
+	AnnRestoreUIDKey = "tidb.pingcap.com/restore-uid"
+
 	// AnnoTiFlash710KeepPortsKey is the annotation key to indicate whether the TiFlash v7.1.0+ keeps ports to avoid restart.
 	// ports: tcp_port, http_port, tcp_port_secure and https_port.
 	// NOTE: this annotation should only be used for existing TiFlash v7.1.0+ clusters with ports config items.
@@ -370,6 +386,20 @@ func (l Label) Restore(val string) Label {
 	return l
 }
 
+// RestoreGeneration assigns the generation of the restore spec to restore generation key in label
+func (l Label) RestoreGeneration(generation int64) Label {
+	l[RestoreGenerationLabelKey] = strconv.FormatInt(generation, 10)
+	return l
+}
+
+// CorrelationID assigns the correlation id to correlation id key in label, the empty id is skipped
+func (l Label) CorrelationID(id string) Label {
+	if id != "" {
+		l[CorrelationIDLabelKey] = id
+	}
+	return l
+}
+
 // PD assigns pd to component key in label
 func (l Label) PD() Label {
 	return l.Component(PDLabelVal)
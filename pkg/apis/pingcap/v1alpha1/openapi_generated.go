@@ -120,6 +120,7 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StmtSummary":                   schema_pkg_apis_pingcap_v1alpha1_StmtSummary(ref),
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageClaim":                  schema_pkg_apis_pingcap_v1alpha1_StorageClaim(ref),
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageProvider":               schema_pkg_apis_pingcap_v1alpha1_StorageProvider(ref),
+		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StoreVolumeMap":                schema_pkg_apis_pingcap_v1alpha1_StoreVolumeMap(ref),
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.SuspendAction":                 schema_pkg_apis_pingcap_v1alpha1_SuspendAction(ref),
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.TLSConfig":                     schema_pkg_apis_pingcap_v1alpha1_TLSConfig(ref),
 		"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.TiCDCConfig":                   schema_pkg_apis_pingcap_v1alpha1_TiCDCConfig(ref),
@@ -575,6 +576,20 @@ func schema_pkg_apis_pingcap_v1alpha1_AzblobStorageProvider(ref common.Reference
 							Format:      "",
 						},
 					},
+					"storageAccount": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StorageAccount is the name of the storage account, it's required by the workload identity as the account is not read from the secret.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"useWorkloadIdentity": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UseWorkloadIdentity accesses the storage with the Azure workload identity of the service account of the job pod instead of the credentials in SecretName, it's only supported by restore. The service account must be annotated with `azure.workload.identity/client-id` and `azure.workload.identity/tenant-id`.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
@@ -967,7 +982,7 @@ func schema_pkg_apis_pingcap_v1alpha1_BackupSpec(ref common.ReferenceCallback) c
 					},
 					"env": {
 						SchemaProps: spec.SchemaProps{
-							Description: "List of environment variables to set in the container, like v1.Container.Env. Note that the following builtin env vars will be overwritten by values set here - S3_PROVIDER - S3_ENDPOINT - AWS_REGION - AWS_ACL - AWS_STORAGE_CLASS - AWS_DEFAULT_REGION - AWS_ACCESS_KEY_ID - AWS_SECRET_ACCESS_KEY - GCS_PROJECT_ID - GCS_OBJECT_ACL - GCS_BUCKET_ACL - GCS_LOCATION - GCS_STORAGE_CLASS - GCS_SERVICE_ACCOUNT_JSON_KEY - BR_LOG_TO_TERM",
+							Description: "List of environment variables to set in the container, like v1.Container.Env. Note that the following builtin env vars will be overwritten by values set here - S3_PROVIDER - S3_ENDPOINT - AWS_REGION - AWS_ACL - AWS_STORAGE_CLASS - AWS_SSE - AWS_SSE_KMS_KEY_ID - AWS_DEFAULT_REGION - AWS_ACCESS_KEY_ID - AWS_SECRET_ACCESS_KEY - GCS_PROJECT_ID - GCS_OBJECT_ACL - GCS_BUCKET_ACL - GCS_LOCATION - GCS_STORAGE_CLASS - GCS_SERVICE_ACCOUNT_JSON_KEY - BR_LOG_TO_TERM",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
@@ -3658,6 +3673,20 @@ func schema_pkg_apis_pingcap_v1alpha1_GcsStorageProvider(ref common.ReferenceCal
 							Format:      "",
 						},
 					},
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint is the custom endpoint of GCS, e.g. the private endpoint of a VPC Service Controls perimeter.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"requesterPays": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RequesterPays accesses the requester pays bucket, the requests are billed to the project of ProjectId.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"projectId"},
 			},
@@ -7375,7 +7404,7 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 					},
 					"env": {
 						SchemaProps: spec.SchemaProps{
-							Description: "List of environment variables to set in the container, like v1.Container.Env. Note that the following builtin env vars will be overwritten by values set here - S3_PROVIDER - S3_ENDPOINT - AWS_REGION - AWS_ACL - AWS_STORAGE_CLASS - AWS_DEFAULT_REGION - AWS_ACCESS_KEY_ID - AWS_SECRET_ACCESS_KEY - GCS_PROJECT_ID - GCS_OBJECT_ACL - GCS_BUCKET_ACL - GCS_LOCATION - GCS_STORAGE_CLASS - GCS_SERVICE_ACCOUNT_JSON_KEY - BR_LOG_TO_TERM",
+							Description: "List of environment variables to set in the container, like v1.Container.Env. Note that the following builtin env vars will be overwritten by values set here - S3_PROVIDER - S3_ENDPOINT - AWS_REGION - AWS_ACL - AWS_STORAGE_CLASS - AWS_SSE - AWS_SSE_KMS_KEY_ID - AWS_DEFAULT_REGION - AWS_ACCESS_KEY_ID - AWS_SECRET_ACCESS_KEY - GCS_PROJECT_ID - GCS_OBJECT_ACL - GCS_BUCKET_ACL - GCS_LOCATION - GCS_STORAGE_CLASS - GCS_SERVICE_ACCOUNT_JSON_KEY The following env vars are reserved by the operator, the restore setting them here is invalid - BR_LOG_TO_TERM - BACKUP_MANAGER_PASSWORD - KMS_ENCRYPTED_BACKUP_MANAGER_PASSWORD",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
@@ -7430,7 +7459,7 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 					},
 					"volumeAZ": {
 						SchemaProps: spec.SchemaProps{
-							Description: "VolumeAZ indicates which AZ the volume snapshots restore to. it is only valid for mode of volume-snapshot",
+							Description: "VolumeAZ indicates which AZ the volume snapshots restore to. it is only valid for mode of volume-snapshot. It is recorded in the status when the volumes start to be restored, and changing it after that doesn't take effect.",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -7462,6 +7491,13 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Ref: ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.LocalStorageProvider"),
 						},
 					},
+					"caBundleSecretName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CABundleSecretName is the name of the secret holding the CA bundle in key `ca.crt` to trust the S3 compatible storage endpoint. The CA bundle is trusted together with the system roots by the restore job and by the operator when it reads the backup meta.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"pitrFullBackupStorageProvider": {
 						SchemaProps: spec.SchemaProps{
 							Description: "PitrFullBackupStorageProvider configures where and how pitr dependent full backup should be stored.",
@@ -7469,9 +7505,23 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Ref:         ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageProvider"),
 						},
 					},
+					"fallbackStorageProviders": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FallbackStorageProviders are the storages holding the copies of the backup, they are tried in order when the primary storage is unavailable. Every storage uses its own credentials, so the fallbacks may be in other regions or accounts. Only BR restore supports it.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageProvider"),
+									},
+								},
+							},
+						},
+					},
 					"storageClassName": {
 						SchemaProps: spec.SchemaProps{
-							Description: "The storageClassName of the persistent volume for Restore data storage. Defaults to Kubernetes default storage class.",
+							Description: "The storageClassName of the persistent volume for Restore data storage. Defaults to the restore storage class of tidb-operator, or Kubernetes default storage class if it's not set.",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -7509,6 +7559,22 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Ref:         ref("k8s.io/api/core/v1.Affinity"),
 						},
 					},
+					"nodeSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NodeSelector of restore Pods, it is applied together with Affinity",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
 					"useKMS": {
 						SchemaProps: spec.SchemaProps{
 							Description: "Use KMS to decrypt the secrets",
@@ -7523,13 +7589,41 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Format:      "",
 						},
 					},
+					"jobNamespace": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobNamespace is the namespace the restore job is created in, it can only be the namespace of the Restore or the namespace of the target cluster `br.clusterNamespace`, and defaults to the namespace of the Restore. The secrets and the service account used by the job must exist in the job namespace, and the service account needs the permission to get and update the Restore in the namespace of the Restore. As an owner reference can't cross namespaces, the job in another namespace is deleted by the finalizer `tidb.pingcap.com/restore-job-cleanup` of the Restore when the Restore is deleted. It is only valid for BR restore.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"toolImage": {
 						SchemaProps: spec.SchemaProps{
-							Description: "ToolImage specifies the tool image used in `Restore`, which supports BR and TiDB Lightning images. For examples `spec.toolImage: pingcap/br:v4.0.8` or `spec.toolImage: pingcap/tidb-lightning:v4.0.8` For BR image, if it does not contain tag, Pod will use image 'ToolImage:${TiKV_Version}'.",
+							Description: "ToolImage specifies the tool image used in `Restore`, which supports BR and TiDB Lightning images. For examples `spec.toolImage: pingcap/br:v4.0.8` or `spec.toolImage: pingcap/tidb-lightning:v4.0.8` For BR image, if it does not contain tag, Pod will use image 'ToolImage:${TiKV_Version}'. If it is not set, BR image is pulled from the same registry as the TiKV image of the cluster, e.g. 'registry.local/pingcap/br:${TiKV_Version}' for 'registry.local/pingcap/tikv:${TiKV_Version}'.",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
+					"brImageRegistry": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BRImageRegistry overrides the registry and the repository prefix of the BR image, BR image is pulled as '${BRImageRegistry}/br:${TiKV_Version}' with the tag still derived from the TiKV image, e.g. 'mirror.local/pingcap/br:v6.5.0' for 'mirror.local/pingcap'. It takes precedence over the registry of the TiKV image, and is ignored if ToolImage is set.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"brVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BRVersion overrides the version of BR used by the restore, which is the tag of the BR image and the TiKV version passed to BR, instead of the version of the TiKV image of the cluster, e.g. 'v6.5.0'. It must not be older than the version of the cluster the backup is taken from.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"bundledBR": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BundledBR specifies to use the BR binary bundled in the backup-manager image instead of copying it from the BR image with an init container. The bundled BR version must match the TiKV version. It is only valid for BR restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 					"imagePullSecrets": {
 						SchemaProps: spec.SchemaProps{
 							Description: "ImagePullSecrets is an optional list of references to secrets in the same namespace to use for pulling any of the images.",
@@ -7546,7 +7640,7 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 					},
 					"tableFilter": {
 						SchemaProps: spec.SchemaProps{
-							Description: "TableFilter means Table filter expression for 'db.table' matching. BR supports this from v4.0.3.",
+							Description: "TableFilter means Table filter expression for 'db.table' matching. BR supports this from v4.0.3. It is not supported by volume snapshot restore, which restores the whole volumes.",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
@@ -7565,6 +7659,13 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Ref:         ref("k8s.io/api/core/v1.PodSecurityContext"),
 						},
 					},
+					"restrictedSecurityContext": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RestrictedSecurityContext runs the restore pod with a security context satisfying the `restricted` Pod Security Standard if PodSecurityContext is not set, so the restore pod can be admitted in the namespaces enforcing it. The pod runs as uid 65534 with the RuntimeDefault seccomp profile, and the containers without a security context run with a read-only root filesystem and all the capabilities dropped, an emptyDir is mounted at /tmp for the files written by the restore. The restore PVC is made writable by fsGroup, but fsGroup doesn't apply to some volumes such as NFS and hostPath, so it's not enabled by default if the `local` storage or AdditionalVolumes is used, which must be writable by uid 65534 to enable it. Defaults to true, set it to false to opt out.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 					"priorityClassName": {
 						SchemaProps: spec.SchemaProps{
 							Description: "PriorityClassName of Restore Job Pods",
@@ -7572,11 +7673,382 @@ func schema_pkg_apis_pingcap_v1alpha1_RestoreSpec(ref common.ReferenceCallback)
 							Format:      "",
 						},
 					},
+					"backoffLimit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BackoffLimit is the number of retries of the restore job before the restore is marked as failed. A failed attempt with retries left is reported by condition `RetryFailed`. Default to 0.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"activeDeadlineSeconds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ActiveDeadlineSeconds is the duration in seconds the restore job may be active before it is terminated. A restore whose job exceeds the deadline is marked as failed with reason `RestoreTimeout`. Not limited by default.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"ttlSecondsAfterFinished": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TTLSecondsAfterFinished is the duration in seconds the restore job and its pods are kept after the job finishes, the restore PVC of TiDB Lightning is deleted after the job if it's not used by another restore. 0 means they are deleted immediately after the job finishes. They are kept by default.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"dryRun": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DryRun validates the restore against the backup meta and the target cluster without creating any job or changing the cluster, the restore is finished with condition `DryRunComplete` if the checks pass.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"tableConcurrency": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TableConcurrency maps a 'db.table' glob to the region concurrency used by TiDB Lightning when importing the matched tables, so that a few large tables can get more parallelism. Tables not matched by any glob are imported with the default concurrency. It is only valid for the TiDB Lightning import and can not be used together with TableFilter.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: 0,
+										Type:    []string{"integer"},
+										Format:  "int32",
+									},
+								},
+							},
+						},
+					},
+					"sessionVariables": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SessionVariables are the TiDB session variables set on the connection used by TiDB Lightning to import data, such as `tidb_dml_batch_size`. Only the variables that are safe to change for the import session are allowed. It is only valid for the TiDB Lightning import.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"correlationID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CorrelationID is an id to trace the restore across systems. It is added as the label `tidb.pingcap.com/correlation-id` to the restore job, pod and PVC, included in the events of the restore job and recorded in the status. It can also be set by the annotation `tidb.pingcap.com/correlation-id`. It must be a valid label value.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"checkTiKVCapacity": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CheckTiKVCapacity indicates whether to check the available capacity of the target TiKV stores before starting the restore, the restore fails with reason `InsufficientTiKVCapacity` if the stores can't hold the data recorded in the backup meta. It is valid for BR snapshot and pitr restore, and for the lightning import to a tidbcluster, of which the data size is estimated by the size of the dumped data. The check is skipped with condition `CheckSkipped` if the data size isn't known, e.g. the backup meta v2.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"checkColdStorage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CheckColdStorage indicates whether to check if any backup object is archived in the cold storage tier, such as S3 Glacier, before starting the restore. The restore fails with reason `BackupInColdStorage` if any backup object is archived and AutoRehydrate is not set. It is only supported by S3.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"autoRehydrate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AutoRehydrate requests to rehydrate the backup objects archived in the cold storage tier, and the restore waits with condition `WaitingForRehydration` until all of them can be read. It implies CheckColdStorage.",
+							Ref:         ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.RehydrationConfig"),
+						},
+					},
+					"deleteRestoreMetaOnComplete": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DeleteRestoreMetaOnComplete indicates whether to delete the cluster restore meta object from the external storage after the volume snapshot restore is complete. The storage credentials need the delete permission, otherwise a warning event is recorded and the object is kept.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"storeVolumeMapping": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StoreVolumeMapping overrides the automatic mapping from the volume snapshots of the TiKV stores to the PVs recorded in the backup meta. It is only valid for volume snapshot restore.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StoreVolumeMap"),
+									},
+								},
+							},
+						},
+					},
+					"strictCollation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StrictCollation indicates whether to fail the restore with reason `CollationMismatch` when the collations recorded in the backup meta are not compatible with the target cluster. By default only a warning is logged. The check needs `To` and is only done for BR snapshot restore, it is skipped with condition `CheckSkipped` for the backup meta v2.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"volumeRehearsal": {
+						SchemaProps: spec.SchemaProps{
+							Description: "VolumeRehearsal indicates to only rehearse the volume snapshot restore. The TiKV volumes are restored from the snapshots and verified to be attachable, then they are deleted and the restore is completed without starting TiKV. It is only valid for the restore-volume phase of volume snapshot restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"recreateStaleRestorePVC": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RecreateStaleRestorePVC indicates whether to recreate the restore PVC of the TiDB Lightning import when it is left by another Restore, so that the scratch data of the previous restore is not reused, or when it is smaller than StorageSize and its storage class doesn't allow volume expansion. By default the restore fails with reason `PVCOwnedByAnotherRestore` or `PVCStorageSizeTooSmall` and the PVC is kept.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"cleanupRestorePVCOnFailure": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CleanupRestorePVCOnFailure indicates whether to delete the restore PVC of the TiDB Lightning import once the restore fails, so that the bound PVC doesn't block a retried restore. It's deleted after the pods of the job are stopped, without waiting for the job cleaned up by TTLSecondsAfterFinished. By default the PVC of the failed restore is kept for troubleshooting.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"cleanupOrphanedVolumesOnFailure": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CleanupOrphanedVolumesOnFailure indicates whether to delete the cloud volumes restored from the snapshots when preparing the restore metadata fails. The volumes are always recorded in the status, and once they are deleted the restore is failed because it can't be retried any more. It is only valid for volume snapshot restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"allowReplicaMismatch": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowReplicaMismatch indicates whether to continue the restore when the TiKV or TiFlash replicas of the target cluster differ from the backup meta, relying on PD to rebalance the regions afterwards. The mismatch is reported by condition `ReplicasMismatched` instead of failing the restore. It is only valid for volume snapshot restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"allowMasterKeyRotation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowMasterKeyRotation indicates whether to restore the backup whose TiKV encryption master key differs from the one of the target cluster. The backup master key must be configured as `security.encryption.previous-master-key` of TiKV, then TiKV decrypts the data keys with it and re-encrypts them with the new master key when it starts. The rotation is reported by condition `MasterKeyRotated` instead of failing the restore. Only the data keys are re-encrypted, the data files are not rewritten, so the cost is a few more calls to the KMS when TiKV starts, but both master keys must be accessible by TiKV. It is only valid for volume snapshot restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"pdReadyTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PDReadyTimeout is the timeout to wait for all the PD members ready in volume snapshot restore, measured from the time the restore starts to wait for PD. The restore is failed with reason `PDNeverReady` after the timeout.\n\nDefaults to 24h",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"restoreTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RestoreTimeout is the timeout of the whole volume snapshot restore, measured from `status.timeStarted`, which is recorded when the restore starts if it's not set yet. The restore not complete after the timeout is failed with reason `RestoreDeadlineExceeded`, instead of waiting for PD members ready or TiKVs available forever.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"metaReadTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MetaReadTimeout is the timeout of each attempt to read the backup meta and the restore meta written by BR from the external storage. The failed read of the restore meta in volume snapshot restore is retried a few times by requeueing the restore before the restore fails with reason `ReadRestoreMetaTimeout`.\n\nDefaults to 1m",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"tikvRestartBatchSize": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TiKVRestartBatchSize is the max number of TiKV pods restarted in a wave in the restore-finish phase of volume snapshot restore. The next wave is started after the pods of the former waves are ready and all the TiKV stores are available. All the TiKV pods are restarted at once if it is not set.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"tikvRestartBatchInterval": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TiKVRestartBatchInterval is the time to wait after a wave of TiKV pods is ready before restarting the next wave, it is only used with TiKVRestartBatchSize.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"recoveryPlacement": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RecoveryPlacement is the placement constraints of TiKV applied when TiKV is restarted in the restore-finish phase of volume snapshot restore. They are reverted after all the TiKV stores are up.",
+							Ref:         ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.RecoveryPlacement"),
+						},
+					},
+					"canaryChecks": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CanaryChecks are run on a sample of the restored tables after the data is restored, the restore fails with condition `CanaryFailed` instead of being complete if any of them fails. The checks need `To` and are only supported by BR snapshot restore, they are skipped with condition `CheckSkipped` for the backup meta v2.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.CanaryCheck"),
+									},
+								},
+							},
+						},
+					},
+					"debug": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Debug replaces the command of the restore container with a sleep, so that the restore pod keeps running with the same env and volumes for debugging, e.g. checking the mounted credentials and running BR manually. The original arguments are kept quoted in the env `RESTORE_ARGS`, and the restore can be run by `eval /entrypoint.sh $RESTORE_ARGS` in the container. The restore never completes by itself in this mode, so it should only be set for debugging.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"additionalContainers": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AdditionalContainers are the sidecar containers of the restore pod, such as the shippers of the logs or metrics. If the name of a container matches the restore container generated by TiDB Operator, the container is merged into the restore container via strategic merge patch, otherwise it is appended to the pod. The restore pod is never restarted, so the sidecars must exit by themselves after the restore container exits, otherwise the restore job never completes.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/api/core/v1.Container"),
+									},
+								},
+							},
+						},
+					},
+					"additionalVolumes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AdditionalVolumes are the additional volumes of the restore pod, they can be mounted by AdditionalContainers.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/api/core/v1.Volume"),
+									},
+								},
+							},
+						},
+					},
+					"warmupImages": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WarmupImages indicates whether to pre-pull the BR image and the backup manager image onto the nodes which the restore pods can be scheduled to, by a DaemonSet with the same node selector, affinity and tolerations as the restore pods. The images are pulled while the volumes are restored, the warmup is best effort and the restore never waits for it, its result is recorded by condition `ImageWarmupComplete` after the volumes are complete. It is only valid for the restore-volume phase of volume snapshot restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"imagePullPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImagePullPolicy of the containers and the init containers of the restore pods Optional: Defaults to IfNotPresent",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"forceDestructive": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ForceDestructive allows the volume snapshot restore to replace the TiKV volumes of a tidbcluster which has TiKV stores up with regions, the data of the cluster is lost. Without it, the restore fails with reason `TargetClusterNotEmpty` for such a cluster, so a restore pointed at a serving cluster by mistake doesn't destroy its data.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"postRestoreHook": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PostRestoreHook is the container run by a job after the restore completes, such as analyzing the tables, fixing the grants or running a smoke test query. The host, port and user of `to` are passed to it by the env `TIDB_HOST`, `TIDB_PORT` and `TIDB_USER`, the password is passed by the same env as the restore job, and the TLS secrets mounted by the restore job are mounted at the same paths. The result of the hook is recorded in condition `PostHookComplete`, its failure doesn't change the completion of the restore. The hook job is limited by `activeDeadlineSeconds` and cleaned up after `ttlSecondsAfterFinished` like the restore job.",
+							Ref:         ref("k8s.io/api/core/v1.Container"),
+						},
+					},
+					"checksum": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Checksum specifies whether BR runs the checksum of the restored tables against the backup after the snapshot restore, it's BR's default (enabled) if not set. Disabling it saves a significant time on large datasets, but a corrupted or incomplete backup is then restored silently, so only disable it for backups which are trusted, e.g. verified by another restore. It is only supported by BR snapshot restore and can't be set together with `br.checksum`.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"tidbPasswordFromFile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TiDBPasswordFromFile mounts the password of the secret of `to` as a file read by the restore job instead of passing it by the env, so that the password doesn't appear in the env of the pod. The post restore hook gets the path of the file by the env `TIDB_PASSWORD_FILE`. It can't be used together with `useKMS`.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"cancel": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cancel cancels the restore in progress. The jobs of the restore and the restore PVC created for it are deleted, the recovery mode and the annotation `tidb.pingcap.com/tikv-volumes-ready` set on the tidbcluster by the volume snapshot restore are reverted, then the restore is moved to the terminal condition `Canceled`. It has no effect on a completed restore.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"dnsConfig": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DNSConfig specifies the DNS parameters of the restore pods, it's merged with the DNS configuration generated from DNSPolicy.",
+							Ref:         ref("k8s.io/api/core/v1.PodDNSConfig"),
+						},
+					},
+					"dnsPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DNSPolicy specifies the DNS policy of the restore pods, such as `None` to resolve only by DNSConfig. Defaults to the DNS policy of Kubernetes, i.e. `ClusterFirst`.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"hostAliases": {
+						SchemaProps: spec.SchemaProps{
+							Description: "HostAliases are the hosts and IPs injected into the hosts file of the restore pods, e.g. to resolve the storage endpoint to a private VIP.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/api/core/v1.HostAlias"),
+									},
+								},
+							},
+						},
+					},
+					"crossAccountSnapshot": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CrossAccountSnapshot is the config to restore the EBS volume snapshots owned by another AWS account, e.g. the backup account of a DR setup. Before the volumes are restored, the operator assumes the role in the source account to share the snapshots with the account of the restored cluster, then BR creates the volumes from the shared snapshots. It's only supported by volume snapshot restore on AWS.",
+							Ref:         ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.CrossAccountSnapshot"),
+						},
+					},
+					"restoreMetaConfigMap": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RestoreMetaConfigMap references the ConfigMap to read the restore meta from instead of the external storage. The ConfigMap is in the namespace of the restore, and the meta is the JSON in the key `restoremeta` of its data or binaryData, the same as the restore meta file in the external storage, and it may be gzipped in binaryData. It's useful for small backups whose meta can be stored in a ConfigMap, and it's only supported by volume snapshot restore.",
+							Ref:         ref("k8s.io/api/core/v1.LocalObjectReference"),
+						},
+					},
+					"initContainerResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "InitContainerResources is the resource requirements of the init containers copying the BR or TiDB Lightning binary into the restore pod, which need much less resources than the restore container. Defaults to the resource requirements of the restore container if not set.",
+							Ref:         ref("k8s.io/api/core/v1.ResourceRequirements"),
+						},
+					},
+					"backupManagerImage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BackupManagerImage overrides the backup-manager image of the operator for the jobs of this restore, e.g. to verify a patched backup-manager on a single restore without upgrading the operator.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lightningCheckpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LightningCheckpoint enables the checkpoints of TiDB Lightning, so a retried import resumes from the tables and chunks finished by the interrupted attempt instead of importing all the data again. It's only used by the restore with TiDB Lightning.",
+							Ref:         ref("github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.LightningCheckpoint"),
+						},
+					},
+					"importParallelism": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImportParallelism is the number of the lightning pods importing the dump in parallel, the tables of the dump are sharded across the pods by the completion index of the job. The restore completes after all the shards are imported. It's only supported by logical restore. Default to 1.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"pdAddresses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PDAddresses are the PD endpoints in the format of host:port passed to BR instead of the PD service of the target cluster, e.g. the external load balancer of PD when the target cluster is across Kubernetes clusters and its PD service isn't resolvable from the restore job. It's only used by BR restore.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.AzblobStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.BRConfig", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.GcsStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.LocalStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.S3StorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.TiDBAccessConfig", "k8s.io/api/core/v1.Affinity", "k8s.io/api/core/v1.EnvVar", "k8s.io/api/core/v1.LocalObjectReference", "k8s.io/api/core/v1.PodSecurityContext", "k8s.io/api/core/v1.ResourceRequirements", "k8s.io/api/core/v1.Toleration"},
+			"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.AzblobStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.BRConfig", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.CanaryCheck", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.CrossAccountSnapshot", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.GcsStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.LightningCheckpoint", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.LocalStorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.RecoveryPlacement", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.RehydrationConfig", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.S3StorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StorageProvider", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.StoreVolumeMap", "github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1.TiDBAccessConfig", "k8s.io/api/core/v1.Affinity", "k8s.io/api/core/v1.Container", "k8s.io/api/core/v1.EnvVar", "k8s.io/api/core/v1.HostAlias", "k8s.io/api/core/v1.LocalObjectReference", "k8s.io/api/core/v1.PodDNSConfig", "k8s.io/api/core/v1.PodSecurityContext", "k8s.io/api/core/v1.ResourceRequirements", "k8s.io/api/core/v1.Toleration", "k8s.io/api/core/v1.Volume", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
@@ -7658,6 +8130,13 @@ func schema_pkg_apis_pingcap_v1alpha1_S3StorageProvider(ref common.ReferenceCall
 							Format:      "",
 						},
 					},
+					"sseKmsKeyId": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSEKMSKeyID is the ARN of the AWS KMS key used by the server-side encryption, e.g. 'arn:aws:kms:us-west-2:123456789012:key/<key-id>'. It requires `sse` to be `aws:kms`.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"options": {
 						SchemaProps: spec.SchemaProps{
 							Description: "Options Rclone options for backup and restore with dumpling and lightning.",
@@ -8066,6 +8545,44 @@ func schema_pkg_apis_pingcap_v1alpha1_StorageProvider(ref common.ReferenceCallba
 	}
 }
 
+func schema_pkg_apis_pingcap_v1alpha1_StoreVolumeMap(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "StoreVolumeMap maps the volume snapshot of a TiKV store in the backup to a PV.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"storeID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "StoreID is the ID of the TiKV store recorded in the backup meta",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"snapshotID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SnapshotID is the ID of the volume snapshot of the store recorded in the backup meta",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"targetPVName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetPVName is the name of the PV recorded in the backup meta that the volume restored from the snapshot is bound to",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"storeID", "snapshotID", "targetPVName"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_pingcap_v1alpha1_SuspendAction(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -21,6 +21,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// defaultLightningCheckpointSchema is the default schema of the lightning checkpoints with the mysql driver
+const defaultLightningCheckpointSchema = "tidb_lightning_checkpoint"
+
 // GetRestoreJobName return the restore job name
 func (rs *Restore) GetRestoreJobName() string {
 	if IsRestoreVolumeComplete(rs) && !IsRestoreDataComplete(rs) {
@@ -29,6 +32,24 @@ func (rs *Restore) GetRestoreJobName() string {
 	return fmt.Sprintf("restore-%s", rs.GetName())
 }
 
+// GetRestoreJobNamespace return the namespace of the restore job
+func (rs *Restore) GetRestoreJobNamespace() string {
+	if rs.Spec.JobNamespace != "" {
+		return rs.Spec.JobNamespace
+	}
+	return rs.GetNamespace()
+}
+
+// GetImageWarmupName return the name of the DaemonSet pre-pulling the images of the restore jobs
+func (rs *Restore) GetImageWarmupName() string {
+	return fmt.Sprintf("restore-warmup-%s", rs.GetName())
+}
+
+// GetPostRestoreHookJobName return the name of the job running the post restore hook
+func (rs *Restore) GetPostRestoreHookJobName() string {
+	return fmt.Sprintf("restore-hook-%s", rs.GetName())
+}
+
 // GetInstanceName return the restore instance name
 func (rs *Restore) GetInstanceName() string {
 	if rs.Labels != nil {
@@ -49,6 +70,103 @@ func (rs *Restore) GetRestorePVCName() string {
 	return fmt.Sprintf("restore-pvc-%s", rs.GetTidbEndpointHash())
 }
 
+const (
+	// DefaultRehydrationDays is the default number of days that the rehydrated backup objects are kept
+	DefaultRehydrationDays = 7
+	// DefaultRehydrationTier is the default retrieval tier to rehydrate the backup objects
+	DefaultRehydrationTier = "Standard"
+)
+
+// GetRehydrationDays returns the number of days that the rehydrated backup objects are kept
+func (rs *Restore) GetRehydrationDays() int32 {
+	if rs.Spec.AutoRehydrate == nil || rs.Spec.AutoRehydrate.Days == 0 {
+		return DefaultRehydrationDays
+	}
+	return rs.Spec.AutoRehydrate.Days
+}
+
+// GetRehydrationTier returns the retrieval tier to rehydrate the backup objects
+func (rs *Restore) GetRehydrationTier() string {
+	if rs.Spec.AutoRehydrate == nil || rs.Spec.AutoRehydrate.Tier == "" {
+		return DefaultRehydrationTier
+	}
+	return rs.Spec.AutoRehydrate.Tier
+}
+
+// GetBackoffLimit returns the number of retries of the restore job
+func (rs *Restore) GetBackoffLimit() int32 {
+	if rs.Spec.BackoffLimit == nil {
+		return 0
+	}
+	return *rs.Spec.BackoffLimit
+}
+
+// GetImportParallelism returns the number of the pods of the import job, defaults to 1
+func (rs *Restore) GetImportParallelism() int32 {
+	if rs.Spec.ImportParallelism == nil {
+		return 1
+	}
+	return *rs.Spec.ImportParallelism
+}
+
+// GetImagePullPolicy returns the image pull policy of the containers of the restore pods, defaults to IfNotPresent
+func (rs *Restore) GetImagePullPolicy() corev1.PullPolicy {
+	if rs.Spec.ImagePullPolicy == nil {
+		return corev1.PullIfNotPresent
+	}
+	return *rs.Spec.ImagePullPolicy
+}
+
+// GetInitContainerResources returns the resource requirements of the init containers of the restore job
+func (rs *Restore) GetInitContainerResources() corev1.ResourceRequirements {
+	if rs.Spec.InitContainerResources == nil {
+		return rs.Spec.ResourceRequirements
+	}
+	return *rs.Spec.InitContainerResources
+}
+
+// GetDriver returns the driver of the lightning checkpoints, defaults to file
+func (lc *LightningCheckpoint) GetDriver() LightningCheckpointDriver {
+	if lc.Driver == "" {
+		return LightningCheckpointDriverFile
+	}
+	return lc.Driver
+}
+
+// GetSchema returns the schema of the lightning checkpoints with the mysql driver
+func (lc *LightningCheckpoint) GetSchema() string {
+	if lc.Schema == "" {
+		return defaultLightningCheckpointSchema
+	}
+	return lc.Schema
+}
+
+// GetVolumeAZ returns the AZ the volume snapshots restore to, the AZ recorded in the status takes precedence
+// over the spec, so the volumes of a restore are always restored to the same AZ
+func (rs *Restore) GetVolumeAZ() string {
+	if rs.Status.VolumeAZ != "" {
+		return rs.Status.VolumeAZ
+	}
+	return rs.Spec.VolumeAZ
+}
+
+// GetVolumeTargetAZ returns the AZ the backup volume in sourceAZ restores to, the AZ plan recorded in the status
+// takes precedence, an empty string means the volume restores to its own AZ
+func (rs *Restore) GetVolumeTargetAZ(sourceAZ string) string {
+	if az, ok := rs.Status.VolumeAZPlan[sourceAZ]; ok {
+		return az
+	}
+	return rs.GetVolumeAZ()
+}
+
+// GetCorrelationID returns the correlation id of the restore, it is set by the spec or the annotation
+func (rs *Restore) GetCorrelationID() string {
+	if rs.Spec.CorrelationID != "" {
+		return rs.Spec.CorrelationID
+	}
+	return rs.Annotations[label.AnnCorrelationIDKey]
+}
+
 // GetRestoreCondition get the specify type's RestoreCondition from the given RestoreStatus
 func GetRestoreCondition(status *RestoreStatus, conditionType RestoreConditionType) (int, *RestoreCondition) {
 	if status == nil {
@@ -70,7 +188,11 @@ func UpdateRestoreCondition(status *RestoreStatus, condition *RestoreCondition)
 		return false
 	}
 	condition.LastTransitionTime = metav1.Now()
-	status.Phase = condition.Type
+	isSubJobUpdate := false
+	if condition.Status == corev1.ConditionTrue {
+		isSubJobUpdate = updateActiveRestoreSubJob(status, condition.Type)
+	}
+	status.Phase = restorePhase(status, condition.Type)
 	// Try to find this Restore condition.
 	conditionIndex, oldCondition := GetRestoreCondition(status, condition.Type)
 
@@ -91,7 +213,122 @@ func UpdateRestoreCondition(status *RestoreStatus, condition *RestoreCondition)
 
 	status.Conditions[conditionIndex] = *condition
 	// Return true if one of the fields have changed.
-	return !isUpdate
+	return !isUpdate || isSubJobUpdate
+}
+
+// restoreSubJobPhaseOrder is the order of the phases of a restore job, the phase never moves to a lower order
+var restoreSubJobPhaseOrder = map[RestoreSubJobPhase]int{
+	RestoreSubJobScheduled: 1,
+	RestoreSubJobRunning:   2,
+	RestoreSubJobComplete:  3,
+	RestoreSubJobFailed:    3,
+}
+
+// GetRestoreSubJobType returns the type of the job to be created by the Restore, it matches GetRestoreJobName
+func (rs *Restore) GetRestoreSubJobType() RestoreSubJobType {
+	if rs.Spec.Mode != RestoreModeVolumeSnapshot {
+		return RestoreSubJobRestore
+	}
+	if IsRestoreVolumeComplete(rs) && !IsRestoreDataComplete(rs) {
+		return RestoreSubJobFinish
+	}
+	return RestoreSubJobPrepare
+}
+
+// GetRestoreSubJob get the specify type's RestoreSubJobStatus from the given RestoreStatus
+func GetRestoreSubJob(status *RestoreStatus, subJobType RestoreSubJobType) (int, *RestoreSubJobStatus) {
+	if status == nil {
+		return -1, nil
+	}
+	for i := range status.SubJobs {
+		if status.SubJobs[i].Type == subJobType {
+			return i, &status.SubJobs[i]
+		}
+	}
+	return -1, nil
+}
+
+// UpdateRestoreSubJob updates existing Restore job state or records a new one.
+// The phase of a job only moves forward, an update to an earlier phase is ignored.
+// Returns true if the Restore job state has changed or has been added.
+func UpdateRestoreSubJob(status *RestoreStatus, subJob *RestoreSubJobStatus) bool {
+	if subJob == nil {
+		return false
+	}
+	_, oldSubJob := GetRestoreSubJob(status, subJob.Type)
+	if oldSubJob == nil {
+		newSubJob := *subJob
+		newSubJob.LastTransitionTime = metav1.Now()
+		status.SubJobs = append(status.SubJobs, newSubJob)
+		return true
+	}
+
+	isUpdate := false
+	if subJob.JobName != "" && subJob.JobName != oldSubJob.JobName {
+		oldSubJob.JobName = subJob.JobName
+		isUpdate = true
+	}
+	if restoreSubJobPhaseOrder[subJob.Phase] > restoreSubJobPhaseOrder[oldSubJob.Phase] {
+		oldSubJob.Phase = subJob.Phase
+		oldSubJob.LastTransitionTime = metav1.Now()
+		isUpdate = true
+	}
+	if subJob.Attempts > oldSubJob.Attempts {
+		oldSubJob.Attempts = subJob.Attempts
+		isUpdate = true
+	}
+	return isUpdate
+}
+
+// updateActiveRestoreSubJob moves the latest unfinished job of the Restore to the phase implied by the
+// condition which is set to true. Returns true if the job has changed.
+func updateActiveRestoreSubJob(status *RestoreStatus, conditionType RestoreConditionType) bool {
+	var phase RestoreSubJobPhase
+	switch conditionType {
+	case RestoreRunning:
+		phase = RestoreSubJobRunning
+	case RestoreVolumeComplete, RestoreDataComplete, RestoreComplete:
+		phase = RestoreSubJobComplete
+	case RestoreFailed, RestoreCanceled:
+		phase = RestoreSubJobFailed
+	default:
+		return false
+	}
+
+	for i := len(status.SubJobs) - 1; i >= 0; i-- {
+		subJob := &status.SubJobs[i]
+		if subJob.Phase == RestoreSubJobScheduled || subJob.Phase == RestoreSubJobRunning {
+			return UpdateRestoreSubJob(status, &RestoreSubJobStatus{
+				Type:  subJob.Type,
+				Phase: phase,
+			})
+		}
+	}
+	return false
+}
+
+// restorePhase returns the phase of the Restore when the condition is set. A restore which creates multiple
+// jobs is Running once any of its jobs has started, so scheduling a later job doesn't move the phase back.
+func restorePhase(status *RestoreStatus, conditionType RestoreConditionType) RestoreConditionType {
+	// the post restore hook runs after the restore completes, the restore stays in the Complete phase
+	if conditionType == RestorePostHookComplete {
+		return status.Phase
+	}
+	// a skipped check, the result of the image warmup, the allowed replicas mismatch, the resumed import
+	// and the reconfigured TiKV don't change the progress of the restore
+	switch conditionType {
+	case RestoreCheckSkipped, RestoreImageWarmupComplete, RestoreReplicasMismatched, RestoreResumed, RestoreTiKVReconfigured:
+		return status.Phase
+	}
+	if conditionType != RestoreScheduled {
+		return conditionType
+	}
+	for _, subJob := range status.SubJobs {
+		if restoreSubJobPhaseOrder[subJob.Phase] > restoreSubJobPhaseOrder[RestoreSubJobScheduled] {
+			return RestoreRunning
+		}
+	}
+	return conditionType
 }
 
 // IsRestoreInvalid returns true if a Restore has invalid condition set
@@ -100,12 +337,24 @@ func IsRestoreInvalid(restore *Restore) bool {
 	return condition != nil && condition.Status == corev1.ConditionTrue
 }
 
+// IsRestorePostHookFinished returns true if the post restore hook of a Restore has finished, whether it failed or not
+func IsRestorePostHookFinished(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestorePostHookComplete)
+	return condition != nil
+}
+
 // IsRestoreComplete returns true if a Restore has successfully completed
 func IsRestoreComplete(restore *Restore) bool {
 	_, condition := GetRestoreCondition(&restore.Status, RestoreComplete)
 	return condition != nil && condition.Status == corev1.ConditionTrue
 }
 
+// IsRestoreDryRunComplete returns true if the checks of a dry run Restore passed
+func IsRestoreDryRunComplete(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreDryRunComplete)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
 // IsRestoreScheduled returns true if a Restore has successfully scheduled
 func IsRestoreScheduled(restore *Restore) bool {
 	_, condition := GetRestoreCondition(&restore.Status, RestoreScheduled)
@@ -124,18 +373,49 @@ func IsRestoreFailed(restore *Restore) bool {
 	return condition != nil && condition.Status == corev1.ConditionTrue
 }
 
+// IsRestoreCanceled returns true if a Restore is Canceled
+func IsRestoreCanceled(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreCanceled)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// IsRestoreCanaryFailed returns true if the canary checks of a Restore failed
+func IsRestoreCanaryFailed(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreCanaryFailed)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
 // IsRestoreVolumeComplete returns true if a Restore for volume has successfully completed
 func IsRestoreVolumeComplete(restore *Restore) bool {
 	_, condition := GetRestoreCondition(&restore.Status, RestoreVolumeComplete)
 	return condition != nil && condition.Status == corev1.ConditionTrue
 }
 
+// IsRestoreTiKVReconfigured returns true if the TiKV config of the backup is reconciled to the tidbcluster
+// during volume restore
+func IsRestoreTiKVReconfigured(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreTiKVReconfigured)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
 // IsRestoreTiKVComplete returns true if all TiKVs run successfully during volume restore
 func IsRestoreTiKVComplete(restore *Restore) bool {
 	_, condition := GetRestoreCondition(&restore.Status, RestoreTiKVComplete)
 	return condition != nil && condition.Status == corev1.ConditionTrue
 }
 
+// IsRestoreTiFlashComplete returns true if all TiFlash instances run successfully during volume restore
+func IsRestoreTiFlashComplete(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreTiFlashComplete)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// IsRestoreSnapshotsShared returns true if the volume snapshots owned by another AWS account are shared
+func IsRestoreSnapshotsShared(restore *Restore) bool {
+	_, condition := GetRestoreCondition(&restore.Status, RestoreSnapshotsShared)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
 // IsRestoreDataComplete returns true if a Restore for data consistency has successfully completed
 func IsRestoreDataComplete(restore *Restore) bool {
 	_, condition := GetRestoreCondition(&restore.Status, RestoreDataComplete)
@@ -0,0 +1,110 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRestoreSubJobs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	restore := &Restore{}
+	restore.Spec.Mode = RestoreModeVolumeSnapshot
+	setCondition := func(conditionType RestoreConditionType) bool {
+		return UpdateRestoreCondition(&restore.Status, &RestoreCondition{
+			Type:   conditionType,
+			Status: corev1.ConditionTrue,
+		})
+	}
+	scheduleSubJob := func() {
+		UpdateRestoreSubJob(&restore.Status, &RestoreSubJobStatus{
+			Type:    restore.GetRestoreSubJobType(),
+			JobName: restore.GetRestoreJobName(),
+			Phase:   RestoreSubJobScheduled,
+		})
+		setCondition(RestoreScheduled)
+	}
+	expectSubJob := func(subJobType RestoreSubJobType, jobName string, phase RestoreSubJobPhase) {
+		_, subJob := GetRestoreSubJob(&restore.Status, subJobType)
+		g.Expect(subJob).NotTo(BeNil())
+		g.Expect(subJob.JobName).To(Equal(jobName))
+		g.Expect(subJob.Phase).To(Equal(phase))
+	}
+
+	// the prepare job
+	scheduleSubJob()
+	g.Expect(restore.Status.Phase).To(Equal(RestoreScheduled))
+	expectSubJob(RestoreSubJobPrepare, "restore-", RestoreSubJobScheduled)
+	g.Expect(setCondition(RestoreRunning)).To(BeTrue())
+	g.Expect(restore.Status.Phase).To(Equal(RestoreRunning))
+	expectSubJob(RestoreSubJobPrepare, "restore-", RestoreSubJobRunning)
+	setCondition(RestoreVolumeComplete)
+	expectSubJob(RestoreSubJobPrepare, "restore-", RestoreSubJobComplete)
+	setCondition(RestoreTiKVComplete)
+	g.Expect(restore.Status.Phase).To(Equal(RestoreTiKVComplete))
+
+	// the finish job doesn't move the phase back to scheduled
+	scheduleSubJob()
+	g.Expect(restore.Status.Phase).To(Equal(RestoreRunning))
+	expectSubJob(RestoreSubJobFinish, "restore-data-", RestoreSubJobScheduled)
+	g.Expect(setCondition(RestoreRunning)).To(BeTrue())
+	expectSubJob(RestoreSubJobFinish, "restore-data-", RestoreSubJobRunning)
+	setCondition(RestoreDataComplete)
+	expectSubJob(RestoreSubJobPrepare, "restore-", RestoreSubJobComplete)
+	expectSubJob(RestoreSubJobFinish, "restore-data-", RestoreSubJobComplete)
+
+	// the phase of a job never moves backward
+	g.Expect(UpdateRestoreSubJob(&restore.Status, &RestoreSubJobStatus{
+		Type:  RestoreSubJobFinish,
+		Phase: RestoreSubJobRunning,
+	})).To(BeFalse())
+	setCondition(RestoreComplete)
+	g.Expect(restore.Status.Phase).To(Equal(RestoreComplete))
+	g.Expect(restore.Status.SubJobs).To(HaveLen(2))
+}
+
+func TestRestoreSubJobFailed(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	restore := &Restore{}
+	g.Expect(restore.GetRestoreSubJobType()).To(Equal(RestoreSubJobRestore))
+	g.Expect(UpdateRestoreSubJob(&restore.Status, &RestoreSubJobStatus{
+		Type:    RestoreSubJobRestore,
+		JobName: restore.GetRestoreJobName(),
+		Phase:   RestoreSubJobScheduled,
+	})).To(BeTrue())
+	UpdateRestoreCondition(&restore.Status, &RestoreCondition{
+		Type:   RestoreFailed,
+		Status: corev1.ConditionTrue,
+	})
+	_, subJob := GetRestoreSubJob(&restore.Status, RestoreSubJobRestore)
+	g.Expect(subJob.Phase).To(Equal(RestoreSubJobFailed))
+
+	// a retryable failure doesn't fail the job
+	restore = &Restore{}
+	UpdateRestoreSubJob(&restore.Status, &RestoreSubJobStatus{
+		Type:  RestoreSubJobRestore,
+		Phase: RestoreSubJobScheduled,
+	})
+	UpdateRestoreCondition(&restore.Status, &RestoreCondition{
+		Type:   RestoreRetryFailed,
+		Status: corev1.ConditionTrue,
+	})
+	_, subJob = GetRestoreSubJob(&restore.Status, RestoreSubJobRestore)
+	g.Expect(subJob.Phase).To(Equal(RestoreSubJobScheduled))
+}
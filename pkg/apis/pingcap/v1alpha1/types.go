@@ -1746,6 +1746,9 @@ type S3StorageProvider struct {
 	Prefix string `json:"prefix,omitempty"`
 	// SSE Sever-Side Encryption.
 	SSE string `json:"sse,omitempty"`
+	// SSEKMSKeyID is the ARN of the AWS KMS key used by the server-side encryption,
+	// e.g. 'arn:aws:kms:us-west-2:123456789012:key/<key-id>'. It requires `sse` to be `aws:kms`.
+	SSEKMSKeyID string `json:"sseKmsKeyId,omitempty"`
 	// Options Rclone options for backup and restore with dumpling and lightning.
 	Options []string `json:"options,omitempty"`
 }
@@ -1773,6 +1776,10 @@ type GcsStorageProvider struct {
 	SecretName string `json:"secretName,omitempty"`
 	// Prefix of the data path.
 	Prefix string `json:"prefix,omitempty"`
+	// Endpoint is the custom endpoint of GCS, e.g. the private endpoint of a VPC Service Controls perimeter.
+	Endpoint string `json:"endpoint,omitempty"`
+	// RequesterPays accesses the requester pays bucket, the requests are billed to the project of ProjectId.
+	RequesterPays bool `json:"requesterPays,omitempty"`
 }
 
 // +k8s:openapi-gen=true
@@ -1790,6 +1797,16 @@ type AzblobStorageProvider struct {
 	SecretName string `json:"secretName,omitempty"`
 	// Prefix of the data path.
 	Prefix string `json:"prefix,omitempty"`
+	// StorageAccount is the name of the storage account, it's required by the workload identity
+	// as the account is not read from the secret.
+	// +optional
+	StorageAccount string `json:"storageAccount,omitempty"`
+	// UseWorkloadIdentity accesses the storage with the Azure workload identity of the service account
+	// of the job pod instead of the credentials in SecretName, it's only supported by restore.
+	// The service account must be annotated with `azure.workload.identity/client-id` and
+	// `azure.workload.identity/tenant-id`.
+	// +optional
+	UseWorkloadIdentity bool `json:"useWorkloadIdentity,omitempty"`
 }
 
 // BackupType represents the backup type.
@@ -1905,6 +1922,8 @@ type BackupSpec struct {
 	// - AWS_REGION
 	// - AWS_ACL
 	// - AWS_STORAGE_CLASS
+	// - AWS_SSE
+	// - AWS_SSE_KMS_KEY_ID
 	// - AWS_DEFAULT_REGION
 	// - AWS_ACCESS_KEY_ID
 	// - AWS_SECRET_ACCESS_KEY
@@ -2032,8 +2051,10 @@ type BRConfig struct {
 	// StatusAddr is the HTTP listening address for the status report service. Set to empty string to disable
 	StatusAddr string `json:"statusAddr,omitempty"`
 	// Concurrency is the size of thread pool on each node that execute the backup task
+	// +kubebuilder:validation:Minimum=0
 	Concurrency *uint32 `json:"concurrency,omitempty"`
 	// RateLimit is the rate limit of the backup task, MB/s per node
+	// +kubebuilder:validation:Minimum=0
 	RateLimit *uint `json:"rateLimit,omitempty"`
 	// TimeAgo is the history version of the backup task, e.g. 1m, 1h
 	TimeAgo string `json:"timeAgo,omitempty"`
@@ -2297,6 +2318,8 @@ type BackupScheduleStatus struct {
 // +kubebuilder:printcolumn:name="Completed",type=date,JSONPath=`.status.timeCompleted`,description="The time at which the restore was completed",priority=1
 // +kubebuilder:printcolumn:name="TimeTaken",type=string,JSONPath=`.status.timeTaken`,description="The time that the restore takes"
 // +kubebuilder:printcolumn:name="CommitTS",type=string,JSONPath=`.status.commitTs`,description="The commit ts of tidb cluster restore"
+// +kubebuilder:printcolumn:name="RestoredTS",type=string,JSONPath=`.status.restoredTs`,description="The ts the tidb cluster is restored to"
+// +kubebuilder:printcolumn:name="Progress",type=string,JSONPath=`.status.currentProgress`,description="The progress of the current step of the restore"
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type Restore struct {
 	metav1.TypeMeta `json:",inline"`
@@ -2331,6 +2354,9 @@ const (
 	RestoreModePiTR RestoreMode = "pitr"
 	// RestoreModeVolumeSnapshot represents restore from a volume snapshot backup.
 	RestoreModeVolumeSnapshot RestoreMode = "volume-snapshot"
+	// RestoreModeLogical represents restore from a logical dump by TiDB Lightning, which reads the dump
+	// from the storage directly instead of downloading it to a restore PVC. It's only used without BR.
+	RestoreModeLogical RestoreMode = "logical"
 )
 
 // RestoreConditionType represents a valid condition of a Restore.
@@ -2349,6 +2375,9 @@ const (
 	RestoreDataComplete RestoreConditionType = "DataComplete"
 	// RestoreTiKVComplete means in volume restore, all TiKV instances are started and up
 	RestoreTiKVComplete RestoreConditionType = "TikvComplete"
+	// RestoreTiFlashComplete means in volume restore, all TiFlash instances are started and
+	// their volumes restored from the snapshots are tagged
+	RestoreTiFlashComplete RestoreConditionType = "TiFlashComplete"
 	// RestoreComplete means the Restore has successfully executed and the
 	// backup data has been loaded into tidb cluster.
 	RestoreComplete RestoreConditionType = "Complete"
@@ -2358,6 +2387,43 @@ const (
 	RestoreRetryFailed RestoreConditionType = "RetryFailed"
 	// RestoreInvalid means invalid restore CR.
 	RestoreInvalid RestoreConditionType = "Invalid"
+	// RestoreCanaryFailed means the canary checks failed after the data is restored
+	RestoreCanaryFailed RestoreConditionType = "CanaryFailed"
+	// RestoreWaitingForRehydration means the restore is waiting for the backup objects in the
+	// cold storage tier to be rehydrated
+	RestoreWaitingForRehydration RestoreConditionType = "WaitingForRehydration"
+	// RestoreSnapshotsShared means the volume snapshots owned by another AWS account are shared with
+	// the account of the restored cluster, it's false with the progress while sharing
+	RestoreSnapshotsShared RestoreConditionType = "SnapshotsShared"
+	// RestoreThrottled means the restore is waiting for the aggregate bandwidth budget of the
+	// active restores to free up
+	RestoreThrottled RestoreConditionType = "Throttled"
+	// RestoreDryRunComplete means the checks of a dry run restore passed, no job is created
+	RestoreDryRunComplete RestoreConditionType = "DryRunComplete"
+	// RestoreReplicasMismatched means the replicas of the target cluster differ from the backup meta,
+	// and the restore goes on because the mismatch is allowed
+	RestoreReplicasMismatched RestoreConditionType = "ReplicasMismatched"
+	// RestoreImageWarmupComplete means the warmup of the images of the restore jobs is finished, its status
+	// is False if the images were not pulled onto all the nodes when the volumes were complete
+	RestoreImageWarmupComplete RestoreConditionType = "ImageWarmupComplete"
+	// RestorePostHookComplete means the post restore hook job is finished after the restore completes, its status
+	// is False if the hook failed
+	RestorePostHookComplete RestoreConditionType = "PostHookComplete"
+	// RestoreCheckSkipped means a check of the restore is skipped since the backup meta doesn't record what
+	// it needs, e.g. the backup meta v2, the reason tells which check is skipped
+	RestoreCheckSkipped RestoreConditionType = "CheckSkipped"
+	// RestoreCanceled means the Restore is canceled by `cancel`, and its jobs and the changes it made to
+	// the tidbcluster are cleaned up
+	RestoreCanceled RestoreConditionType = "Canceled"
+	// RestoreMasterKeyRotated means the TiKV encryption master key of the backup is rotated to the one of the
+	// target cluster, which is allowed by AllowMasterKeyRotation
+	RestoreMasterKeyRotated RestoreConditionType = "MasterKeyRotated"
+	// RestoreResumed means the import of a retried attempt resumes from the TiDB Lightning checkpoints
+	// of the interrupted attempt
+	RestoreResumed RestoreConditionType = "Resumed"
+	// RestoreTiKVReconfigured means the TiKV config the restored data depends on is copied from the backup meta
+	// to the tidbcluster before TiKV is restarted in volume snapshot restore
+	RestoreTiKVReconfigured RestoreConditionType = "TiKVReconfigured"
 )
 
 // RestoreCondition describes the observed state of a Restore at a certain point.
@@ -2382,6 +2448,8 @@ type RestoreSpec struct {
 	// - AWS_REGION
 	// - AWS_ACL
 	// - AWS_STORAGE_CLASS
+	// - AWS_SSE
+	// - AWS_SSE_KMS_KEY_ID
 	// - AWS_DEFAULT_REGION
 	// - AWS_ACCESS_KEY_ID
 	// - AWS_SECRET_ACCESS_KEY
@@ -2391,7 +2459,10 @@ type RestoreSpec struct {
 	// - GCS_LOCATION
 	// - GCS_STORAGE_CLASS
 	// - GCS_SERVICE_ACCOUNT_JSON_KEY
+	// The following env vars are reserved by the operator, the restore setting them here is invalid
 	// - BR_LOG_TO_TERM
+	// - BACKUP_MANAGER_PASSWORD
+	// - KMS_ENCRYPTED_BACKUP_MANAGER_PASSWORD
 	// +optional
 	Env []corev1.EnvVar `json:"env,omitempty"`
 	// To is the tidb cluster that needs to restore.
@@ -2409,7 +2480,8 @@ type RestoreSpec struct {
 	// +optional
 	FederalVolumeRestorePhase FederalVolumeRestorePhase `json:"federalVolumeRestorePhase,omitempty"`
 	// VolumeAZ indicates which AZ the volume snapshots restore to.
-	// it is only valid for mode of volume-snapshot
+	// it is only valid for mode of volume-snapshot. It is recorded in the status when the volumes
+	// start to be restored, and changing it after that doesn't take effect.
 	// +optional
 	VolumeAZ string `json:"volumeAZ,omitempty"`
 	// TikvGCLifeTime is to specify the safe gc life time for restore.
@@ -2418,10 +2490,20 @@ type RestoreSpec struct {
 	TikvGCLifeTime *string `json:"tikvGCLifeTime,omitempty"`
 	// StorageProvider configures where and how backups should be stored.
 	StorageProvider `json:",inline"`
+	// CABundleSecretName is the name of the secret holding the CA bundle in key `ca.crt` to trust the S3 compatible
+	// storage endpoint. The CA bundle is trusted together with the system roots by the restore job and by the
+	// operator when it reads the backup meta.
+	// +optional
+	CABundleSecretName string `json:"caBundleSecretName,omitempty"`
 	// PitrFullBackupStorageProvider configures where and how pitr dependent full backup should be stored.
 	PitrFullBackupStorageProvider StorageProvider `json:"pitrFullBackupStorageProvider,omitempty"`
+	// FallbackStorageProviders are the storages holding the copies of the backup, they are tried in order
+	// when the primary storage is unavailable. Every storage uses its own credentials, so the fallbacks may be
+	// in other regions or accounts. Only BR restore supports it.
+	// +optional
+	FallbackStorageProviders []StorageProvider `json:"fallbackStorageProviders,omitempty"`
 	// The storageClassName of the persistent volume for Restore data storage.
-	// Defaults to Kubernetes default storage class.
+	// Defaults to the restore storage class of tidb-operator, or Kubernetes default storage class if it's not set.
 	// +optional
 	StorageClassName *string `json:"storageClassName,omitempty"`
 	// StorageSize is the request storage size for backup job
@@ -2434,27 +2516,462 @@ type RestoreSpec struct {
 	// Affinity of restore Pods
 	// +optional
 	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// NodeSelector of restore Pods, it is applied together with Affinity
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 	// Use KMS to decrypt the secrets
 	UseKMS bool `json:"useKMS,omitempty"`
 	// Specify service account of restore
 	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// JobNamespace is the namespace the restore job is created in, it can only be the namespace of the Restore
+	// or the namespace of the target cluster `br.clusterNamespace`, and defaults to the namespace of the Restore.
+	// The secrets and the service account used by the job must exist in the job namespace, and the service account
+	// needs the permission to get and update the Restore in the namespace of the Restore. As an owner reference
+	// can't cross namespaces, the job in another namespace is deleted by the finalizer
+	// `tidb.pingcap.com/restore-job-cleanup` of the Restore when the Restore is deleted.
+	// It is only valid for BR restore.
+	// +optional
+	JobNamespace string `json:"jobNamespace,omitempty"`
 	// ToolImage specifies the tool image used in `Restore`, which supports BR and TiDB Lightning images.
 	// For examples `spec.toolImage: pingcap/br:v4.0.8` or `spec.toolImage: pingcap/tidb-lightning:v4.0.8`
 	// For BR image, if it does not contain tag, Pod will use image 'ToolImage:${TiKV_Version}'.
+	// If it is not set, BR image is pulled from the same registry as the TiKV image of the cluster,
+	// e.g. 'registry.local/pingcap/br:${TiKV_Version}' for 'registry.local/pingcap/tikv:${TiKV_Version}'.
 	// +optional
 	ToolImage string `json:"toolImage,omitempty"`
+	// BRImageRegistry overrides the registry and the repository prefix of the BR image, BR image is pulled as
+	// '${BRImageRegistry}/br:${TiKV_Version}' with the tag still derived from the TiKV image,
+	// e.g. 'mirror.local/pingcap/br:v6.5.0' for 'mirror.local/pingcap'.
+	// It takes precedence over the registry of the TiKV image, and is ignored if ToolImage is set.
+	// +optional
+	BRImageRegistry string `json:"brImageRegistry,omitempty"`
+	// BRVersion overrides the version of BR used by the restore, which is the tag of the BR image and the
+	// TiKV version passed to BR, instead of the version of the TiKV image of the cluster, e.g. 'v6.5.0'.
+	// It must not be older than the version of the cluster the backup is taken from.
+	// +optional
+	BRVersion string `json:"brVersion,omitempty"`
+	// BundledBR specifies to use the BR binary bundled in the backup-manager image
+	// instead of copying it from the BR image with an init container.
+	// The bundled BR version must match the TiKV version. It is only valid for BR restore.
+	// +optional
+	BundledBR bool `json:"bundledBR,omitempty"`
 	// ImagePullSecrets is an optional list of references to secrets in the same namespace to use for pulling any of the images.
 	// +optional
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
 	// TableFilter means Table filter expression for 'db.table' matching. BR supports this from v4.0.3.
+	// It is not supported by volume snapshot restore, which restores the whole volumes.
 	TableFilter []string `json:"tableFilter,omitempty"`
 
 	// PodSecurityContext of the component
 	// +optional
 	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
 
+	// RestrictedSecurityContext runs the restore pod with a security context satisfying the `restricted` Pod Security
+	// Standard if PodSecurityContext is not set, so the restore pod can be admitted in the namespaces enforcing it.
+	// The pod runs as uid 65534 with the RuntimeDefault seccomp profile, and the containers without a security context
+	// run with a read-only root filesystem and all the capabilities dropped, an emptyDir is mounted at /tmp for the
+	// files written by the restore. The restore PVC is made writable by fsGroup, but fsGroup doesn't apply to some
+	// volumes such as NFS and hostPath, so it's not enabled by default if the `local` storage or AdditionalVolumes is
+	// used, which must be writable by uid 65534 to enable it. Defaults to true, set it to false to opt out.
+	// +optional
+	RestrictedSecurityContext *bool `json:"restrictedSecurityContext,omitempty"`
+
 	// PriorityClassName of Restore Job Pods
 	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// BackoffLimit is the number of retries of the restore job before the restore is marked as failed.
+	// A failed attempt with retries left is reported by condition `RetryFailed`. Default to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds is the duration in seconds the restore job may be active before it is terminated.
+	// A restore whose job exceeds the deadline is marked as failed with reason `RestoreTimeout`.
+	// Not limited by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// TTLSecondsAfterFinished is the duration in seconds the restore job and its pods are kept after the job
+	// finishes, the restore PVC of TiDB Lightning is deleted after the job if it's not used by another restore.
+	// 0 means they are deleted immediately after the job finishes. They are kept by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// DryRun validates the restore against the backup meta and the target cluster without creating any job
+	// or changing the cluster, the restore is finished with condition `DryRunComplete` if the checks pass.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// TableConcurrency maps a 'db.table' glob to the region concurrency used by TiDB Lightning
+	// when importing the matched tables, so that a few large tables can get more parallelism.
+	// Tables not matched by any glob are imported with the default concurrency.
+	// It is only valid for the TiDB Lightning import and can not be used together with TableFilter.
+	// +optional
+	TableConcurrency map[string]int `json:"tableConcurrency,omitempty"`
+
+	// SessionVariables are the TiDB session variables set on the connection used by TiDB Lightning to import data,
+	// such as `tidb_dml_batch_size`. Only the variables that are safe to change for the import session are allowed.
+	// It is only valid for the TiDB Lightning import.
+	// +optional
+	SessionVariables map[string]string `json:"sessionVariables,omitempty"`
+
+	// CorrelationID is an id to trace the restore across systems. It is added as the label
+	// `tidb.pingcap.com/correlation-id` to the restore job, pod and PVC, included in the events of the
+	// restore job and recorded in the status. It can also be set by the annotation `tidb.pingcap.com/correlation-id`.
+	// It must be a valid label value.
+	// +optional
+	CorrelationID string `json:"correlationID,omitempty"`
+
+	// CheckTiKVCapacity indicates whether to check the available capacity of the target TiKV stores
+	// before starting the restore, the restore fails with reason `InsufficientTiKVCapacity` if the stores
+	// can't hold the data recorded in the backup meta. It is valid for BR snapshot and pitr restore, and for
+	// the lightning import to a tidbcluster, of which the data size is estimated by the size of the dumped data.
+	// The check is skipped with condition `CheckSkipped` if the data size isn't known, e.g. the backup meta v2.
+	// +optional
+	CheckTiKVCapacity bool `json:"checkTiKVCapacity,omitempty"`
+
+	// CheckColdStorage indicates whether to check if any backup object is archived in the cold storage tier,
+	// such as S3 Glacier, before starting the restore. The restore fails with reason `BackupInColdStorage`
+	// if any backup object is archived and AutoRehydrate is not set. It is only supported by S3.
+	// +optional
+	CheckColdStorage bool `json:"checkColdStorage,omitempty"`
+
+	// AutoRehydrate requests to rehydrate the backup objects archived in the cold storage tier, and the
+	// restore waits with condition `WaitingForRehydration` until all of them can be read. It implies CheckColdStorage.
+	// +optional
+	AutoRehydrate *RehydrationConfig `json:"autoRehydrate,omitempty"`
+
+	// DeleteRestoreMetaOnComplete indicates whether to delete the cluster restore meta object
+	// from the external storage after the volume snapshot restore is complete.
+	// The storage credentials need the delete permission, otherwise a warning event is recorded
+	// and the object is kept.
+	// +optional
+	DeleteRestoreMetaOnComplete bool `json:"deleteRestoreMetaOnComplete,omitempty"`
+
+	// StoreVolumeMapping overrides the automatic mapping from the volume snapshots of the TiKV stores
+	// to the PVs recorded in the backup meta. It is only valid for volume snapshot restore.
+	// +optional
+	StoreVolumeMapping []StoreVolumeMap `json:"storeVolumeMapping,omitempty"`
+
+	// StrictCollation indicates whether to fail the restore with reason `CollationMismatch` when the
+	// collations recorded in the backup meta are not compatible with the target cluster.
+	// By default only a warning is logged. The check needs `To` and is only done for BR snapshot restore,
+	// it is skipped with condition `CheckSkipped` for the backup meta v2.
+	// +optional
+	StrictCollation bool `json:"strictCollation,omitempty"`
+
+	// VolumeRehearsal indicates to only rehearse the volume snapshot restore. The TiKV volumes are
+	// restored from the snapshots and verified to be attachable, then they are deleted and the restore
+	// is completed without starting TiKV. It is only valid for the restore-volume phase of volume snapshot restore.
+	// +optional
+	VolumeRehearsal bool `json:"volumeRehearsal,omitempty"`
+
+	// RecreateStaleRestorePVC indicates whether to recreate the restore PVC of the TiDB Lightning import
+	// when it is left by another Restore, so that the scratch data of the previous restore is not reused,
+	// or when it is smaller than StorageSize and its storage class doesn't allow volume expansion.
+	// By default the restore fails with reason `PVCOwnedByAnotherRestore` or `PVCStorageSizeTooSmall`
+	// and the PVC is kept.
+	// +optional
+	RecreateStaleRestorePVC bool `json:"recreateStaleRestorePVC,omitempty"`
+
+	// CleanupRestorePVCOnFailure indicates whether to delete the restore PVC of the TiDB Lightning import
+	// once the restore fails, so that the bound PVC doesn't block a retried restore. It's deleted after the
+	// pods of the job are stopped, without waiting for the job cleaned up by TTLSecondsAfterFinished.
+	// By default the PVC of the failed restore is kept for troubleshooting.
+	// +optional
+	CleanupRestorePVCOnFailure bool `json:"cleanupRestorePVCOnFailure,omitempty"`
+
+	// CleanupOrphanedVolumesOnFailure indicates whether to delete the cloud volumes restored from the
+	// snapshots when preparing the restore metadata fails. The volumes are always recorded in the status,
+	// and once they are deleted the restore is failed because it can't be retried any more.
+	// It is only valid for volume snapshot restore.
+	// +optional
+	CleanupOrphanedVolumesOnFailure bool `json:"cleanupOrphanedVolumesOnFailure,omitempty"`
+
+	// AllowReplicaMismatch indicates whether to continue the restore when the TiKV or TiFlash replicas of the
+	// target cluster differ from the backup meta, relying on PD to rebalance the regions afterwards. The mismatch
+	// is reported by condition `ReplicasMismatched` instead of failing the restore.
+	// It is only valid for volume snapshot restore.
+	// +optional
+	AllowReplicaMismatch bool `json:"allowReplicaMismatch,omitempty"`
+
+	// AllowMasterKeyRotation indicates whether to restore the backup whose TiKV encryption master key differs
+	// from the one of the target cluster. The backup master key must be configured as
+	// `security.encryption.previous-master-key` of TiKV, then TiKV decrypts the data keys with it and re-encrypts
+	// them with the new master key when it starts. The rotation is reported by condition `MasterKeyRotated`
+	// instead of failing the restore.
+	// Only the data keys are re-encrypted, the data files are not rewritten, so the cost is a few more calls to
+	// the KMS when TiKV starts, but both master keys must be accessible by TiKV.
+	// It is only valid for volume snapshot restore.
+	// +optional
+	AllowMasterKeyRotation bool `json:"allowMasterKeyRotation,omitempty"`
+
+	// PDReadyTimeout is the timeout to wait for all the PD members ready in volume snapshot restore,
+	// measured from the time the restore starts to wait for PD. The restore is failed with reason
+	// `PDNeverReady` after the timeout.
+	//
+	// Defaults to 24h
+	// +optional
+	PDReadyTimeout *metav1.Duration `json:"pdReadyTimeout,omitempty"`
+
+	// RestoreTimeout is the timeout of the whole volume snapshot restore, measured from `status.timeStarted`,
+	// which is recorded when the restore starts if it's not set yet. The restore not complete after the timeout
+	// is failed with reason `RestoreDeadlineExceeded`, instead of waiting for PD members ready or TiKVs available
+	// forever.
+	// +optional
+	RestoreTimeout *metav1.Duration `json:"restoreTimeout,omitempty"`
+
+	// MetaReadTimeout is the timeout of each attempt to read the backup meta and the restore meta written by BR
+	// from the external storage. The failed read of the restore meta in volume snapshot restore is retried a few
+	// times by requeueing the restore before the restore fails with reason `ReadRestoreMetaTimeout`.
+	//
+	// Defaults to 1m
+	// +optional
+	MetaReadTimeout *metav1.Duration `json:"metaReadTimeout,omitempty"`
+
+	// TiKVRestartBatchSize is the max number of TiKV pods restarted in a wave in the restore-finish phase of
+	// volume snapshot restore. The next wave is started after the pods of the former waves are ready and all
+	// the TiKV stores are available. All the TiKV pods are restarted at once if it is not set.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TiKVRestartBatchSize *int32 `json:"tikvRestartBatchSize,omitempty"`
+
+	// TiKVRestartBatchInterval is the time to wait after a wave of TiKV pods is ready before restarting
+	// the next wave, it is only used with TiKVRestartBatchSize.
+	// +optional
+	TiKVRestartBatchInterval *metav1.Duration `json:"tikvRestartBatchInterval,omitempty"`
+
+	// RecoveryPlacement is the placement constraints of TiKV applied when TiKV is restarted in the
+	// restore-finish phase of volume snapshot restore. They are reverted after all the TiKV stores are up.
+	// +optional
+	RecoveryPlacement *RecoveryPlacement `json:"recoveryPlacement,omitempty"`
+
+	// CanaryChecks are run on a sample of the restored tables after the data is restored, the restore
+	// fails with condition `CanaryFailed` instead of being complete if any of them fails.
+	// The checks need `To` and are only supported by BR snapshot restore, they are skipped with condition
+	// `CheckSkipped` for the backup meta v2.
+	// +optional
+	CanaryChecks []CanaryCheck `json:"canaryChecks,omitempty"`
+
+	// Debug replaces the command of the restore container with a sleep, so that the restore pod keeps running
+	// with the same env and volumes for debugging, e.g. checking the mounted credentials and running BR manually.
+	// The original arguments are kept quoted in the env `RESTORE_ARGS`, and the restore can be run by
+	// `eval /entrypoint.sh $RESTORE_ARGS` in the container. The restore never completes by itself in this mode,
+	// so it should only be set for debugging.
+	// +optional
+	Debug bool `json:"debug,omitempty"`
+
+	// AdditionalContainers are the sidecar containers of the restore pod, such as the shippers of the logs or metrics.
+	// If the name of a container matches the restore container generated by TiDB Operator, the container is merged
+	// into the restore container via strategic merge patch, otherwise it is appended to the pod.
+	// The restore pod is never restarted, so the sidecars must exit by themselves after the restore container
+	// exits, otherwise the restore job never completes.
+	// +optional
+	AdditionalContainers []corev1.Container `json:"additionalContainers,omitempty"`
+
+	// AdditionalVolumes are the additional volumes of the restore pod, they can be mounted by AdditionalContainers.
+	// +optional
+	AdditionalVolumes []corev1.Volume `json:"additionalVolumes,omitempty"`
+
+	// WarmupImages indicates whether to pre-pull the BR image and the backup manager image onto the nodes
+	// which the restore pods can be scheduled to, by a DaemonSet with the same node selector, affinity and
+	// tolerations as the restore pods. The images are pulled while the volumes are restored, the warmup is
+	// best effort and the restore never waits for it, its result is recorded by condition `ImageWarmupComplete`
+	// after the volumes are complete.
+	// It is only valid for the restore-volume phase of volume snapshot restore.
+	// +optional
+	WarmupImages bool `json:"warmupImages,omitempty"`
+
+	// ImagePullPolicy of the containers and the init containers of the restore pods
+	// Optional: Defaults to IfNotPresent
+	// +optional
+	ImagePullPolicy *corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ForceDestructive allows the volume snapshot restore to replace the TiKV volumes of a tidbcluster which
+	// has TiKV stores up with regions, the data of the cluster is lost. Without it, the restore fails with
+	// reason `TargetClusterNotEmpty` for such a cluster, so a restore pointed at a serving cluster by mistake
+	// doesn't destroy its data.
+	// +optional
+	ForceDestructive bool `json:"forceDestructive,omitempty"`
+
+	// PostRestoreHook is the container run by a job after the restore completes, such as analyzing the tables,
+	// fixing the grants or running a smoke test query. The host, port and user of `to` are passed to it by the env
+	// `TIDB_HOST`, `TIDB_PORT` and `TIDB_USER`, the password is passed by the same env as the restore job, and
+	// the TLS secrets mounted by the restore job are mounted at the same paths. The result of the hook is recorded
+	// in condition `PostHookComplete`, its failure doesn't change the completion of the restore. The hook job is
+	// limited by `activeDeadlineSeconds` and cleaned up after `ttlSecondsAfterFinished` like the restore job.
+	// +optional
+	PostRestoreHook *corev1.Container `json:"postRestoreHook,omitempty"`
+
+	// Checksum specifies whether BR runs the checksum of the restored tables against the backup after the
+	// snapshot restore, it's BR's default (enabled) if not set. Disabling it saves a significant time on large
+	// datasets, but a corrupted or incomplete backup is then restored silently, so only disable it for backups
+	// which are trusted, e.g. verified by another restore. It is only supported by BR snapshot restore and
+	// can't be set together with `br.checksum`.
+	// +optional
+	Checksum *bool `json:"checksum,omitempty"`
+
+	// TiDBPasswordFromFile mounts the password of the secret of `to` as a file read by the restore job instead of
+	// passing it by the env, so that the password doesn't appear in the env of the pod. The post restore hook gets
+	// the path of the file by the env `TIDB_PASSWORD_FILE`. It can't be used together with `useKMS`.
+	// +optional
+	TiDBPasswordFromFile bool `json:"tidbPasswordFromFile,omitempty"`
+
+	// Cancel cancels the restore in progress. The jobs of the restore and the restore PVC created for it are
+	// deleted, the recovery mode and the annotation `tidb.pingcap.com/tikv-volumes-ready` set on the tidbcluster
+	// by the volume snapshot restore are reverted, then the restore is moved to the terminal condition `Canceled`.
+	// It has no effect on a completed restore.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+
+	// DNSConfig specifies the DNS parameters of the restore pods, it's merged with the DNS configuration
+	// generated from DNSPolicy.
+	// +optional
+	DNSConfig *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+
+	// DNSPolicy specifies the DNS policy of the restore pods, such as `None` to resolve only by DNSConfig.
+	// Defaults to the DNS policy of Kubernetes, i.e. `ClusterFirst`.
+	// +optional
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// HostAliases are the hosts and IPs injected into the hosts file of the restore pods, e.g. to resolve the
+	// storage endpoint to a private VIP.
+	// +optional
+	HostAliases []corev1.HostAlias `json:"hostAliases,omitempty"`
+
+	// CrossAccountSnapshot is the config to restore the EBS volume snapshots owned by another AWS account,
+	// e.g. the backup account of a DR setup. Before the volumes are restored, the operator assumes the role in
+	// the source account to share the snapshots with the account of the restored cluster, then BR creates the
+	// volumes from the shared snapshots. It's only supported by volume snapshot restore on AWS.
+	// +optional
+	CrossAccountSnapshot *CrossAccountSnapshot `json:"crossAccountSnapshot,omitempty"`
+
+	// RestoreMetaConfigMap references the ConfigMap to read the restore meta from instead of the external storage.
+	// The ConfigMap is in the namespace of the restore, and the meta is the JSON in the key `restoremeta` of its
+	// data or binaryData, the same as the restore meta file in the external storage, and it may be gzipped in
+	// binaryData. It's useful for small backups whose meta can be stored in a ConfigMap, and it's only supported
+	// by volume snapshot restore.
+	// +optional
+	RestoreMetaConfigMap *corev1.LocalObjectReference `json:"restoreMetaConfigMap,omitempty"`
+
+	// InitContainerResources is the resource requirements of the init containers copying the BR or TiDB Lightning
+	// binary into the restore pod, which need much less resources than the restore container.
+	// Defaults to the resource requirements of the restore container if not set.
+	// +optional
+	InitContainerResources *corev1.ResourceRequirements `json:"initContainerResources,omitempty"`
+
+	// BackupManagerImage overrides the backup-manager image of the operator for the jobs of this restore,
+	// e.g. to verify a patched backup-manager on a single restore without upgrading the operator.
+	// +optional
+	BackupManagerImage string `json:"backupManagerImage,omitempty"`
+
+	// LightningCheckpoint enables the checkpoints of TiDB Lightning, so a retried import resumes from the
+	// tables and chunks finished by the interrupted attempt instead of importing all the data again.
+	// It's only used by the restore with TiDB Lightning.
+	// +optional
+	LightningCheckpoint *LightningCheckpoint `json:"lightningCheckpoint,omitempty"`
+
+	// ImportParallelism is the number of the lightning pods importing the dump in parallel, the tables of the
+	// dump are sharded across the pods by the completion index of the job. The restore completes after all
+	// the shards are imported. It's only supported by logical restore. Default to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ImportParallelism *int32 `json:"importParallelism,omitempty"`
+
+	// PDAddresses are the PD endpoints in the format of host:port passed to BR instead of the PD service of the
+	// target cluster, e.g. the external load balancer of PD when the target cluster is across Kubernetes clusters
+	// and its PD service isn't resolvable from the restore job. It's only used by BR restore.
+	// +optional
+	PDAddresses []string `json:"pdAddresses,omitempty"`
+}
+
+// CanaryCheckType is the type of a restore canary check.
+type CanaryCheckType string
+
+const (
+	// CanaryCheckTypeChecksum compares the checksum, the total KVs and the total bytes of the table
+	// with the values recorded in the backup meta.
+	CanaryCheckTypeChecksum CanaryCheckType = "Checksum"
+	// CanaryCheckTypeKVCount only compares the total KVs of the table with the value recorded in the backup meta.
+	CanaryCheckTypeKVCount CanaryCheckType = "KVCount"
+)
+
+// CanaryCheck validates a restored table against the backup meta by `ADMIN CHECKSUM TABLE`.
+type CanaryCheck struct {
+	// Database is the database of the table
+	Database string `json:"database"`
+	// Table is the name of the table, it must be present in the backup
+	Table string `json:"table"`
+	// Type is the type of the check, defaults to Checksum
+	// +kubebuilder:validation:Enum=Checksum;KVCount
+	// +optional
+	Type CanaryCheckType `json:"type,omitempty"`
+}
+
+// RehydrationConfig is the configuration to rehydrate the backup objects archived in the cold storage tier.
+type RehydrationConfig struct {
+	// Days is the number of days that the rehydrated copies of the objects are kept, defaults to 7
+	// +optional
+	Days int32 `json:"days,omitempty"`
+	// Tier is the retrieval tier of the rehydration, defaults to Standard
+	// +kubebuilder:validation:Enum=Expedited;Standard;Bulk
+	// +optional
+	Tier string `json:"tier,omitempty"`
+}
+
+// CrossAccountSnapshot is the configuration to share the EBS volume snapshots owned by another AWS account.
+type CrossAccountSnapshot struct {
+	// SourceRoleARN is the ARN of the IAM role in the AWS account owning the snapshots, which is assumed by the
+	// operator to share the snapshots. The role needs the permission of `ec2:ModifySnapshotAttribute`, and the
+	// KMS keys of the encrypted snapshots must be shared with the target account in advance.
+	SourceRoleARN string `json:"sourceRoleARN"`
+	// TargetAccountID is the ID of the AWS account the snapshots are shared with, which restores the volumes.
+	// Defaults to the account of the operator.
+	// +optional
+	TargetAccountID string `json:"targetAccountID,omitempty"`
+}
+
+// LightningCheckpointDriver is the storage of the TiDB Lightning checkpoints.
+type LightningCheckpointDriver string
+
+const (
+	// LightningCheckpointDriverFile stores the checkpoints in a file on the restore PVC.
+	LightningCheckpointDriverFile LightningCheckpointDriver = "file"
+	// LightningCheckpointDriverMySQL stores the checkpoints in a schema of the target TiDB cluster.
+	LightningCheckpointDriverMySQL LightningCheckpointDriver = "mysql"
+)
+
+// LightningCheckpoint is the configuration of the TiDB Lightning checkpoints.
+type LightningCheckpoint struct {
+	// Driver is the storage of the checkpoints, defaults to file. The logical restore has no restore PVC,
+	// so it only supports mysql.
+	// +kubebuilder:validation:Enum=file;mysql
+	// +optional
+	Driver LightningCheckpointDriver `json:"driver,omitempty"`
+	// Schema is the schema of the checkpoints in the target TiDB cluster with the mysql driver,
+	// defaults to tidb_lightning_checkpoint
+	// +optional
+	Schema string `json:"schema,omitempty"`
+}
+
+// RecoveryPlacement is the temporary placement constraints of TiKV in the restore-finish phase.
+type RecoveryPlacement struct {
+	// NodeSelector is merged into the node selector of TiKV
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+// StoreVolumeMap maps the volume snapshot of a TiKV store in the backup to a PV.
+// +k8s:openapi-gen=true
+type StoreVolumeMap struct {
+	// StoreID is the ID of the TiKV store recorded in the backup meta
+	StoreID uint64 `json:"storeID"`
+	// SnapshotID is the ID of the volume snapshot of the store recorded in the backup meta
+	SnapshotID string `json:"snapshotID"`
+	// TargetPVName is the name of the PV recorded in the backup meta that
+	// the volume restored from the snapshot is bound to
+	TargetPVName string `json:"targetPVName"`
 }
 
 // FederalVolumeRestorePhase represents a phase to execute in federal volume restore
@@ -2481,6 +2998,10 @@ type RestoreStatus struct {
 	TimeTaken string `json:"timeTaken,omitempty"`
 	// CommitTs is the snapshot time point of tidb cluster.
 	CommitTs string `json:"commitTs,omitempty"`
+	// RestoredTs is the ts the data of tidb cluster is restored to, the incremental replication can start from it.
+	// It is the CommitTs for a snapshot restore, the PitrRestoredTs in TSO for a PiTR restore, or the checkpoint
+	// ts of the log backup if PitrRestoredTs is not set, and the resolved ts reported by BR for a volume snapshot restore.
+	RestoredTs string `json:"restoredTs,omitempty"`
 	// Phase is a user readable state inferred from the underlying Restore conditions
 	Phase RestoreConditionType `json:"phase,omitempty"`
 	// +nullable
@@ -2488,6 +3009,225 @@ type RestoreStatus struct {
 	// Progresses is the progress of restore.
 	// +nullable
 	Progresses []Progress `json:"progresses,omitempty"`
+	// CurrentProgress is the step and percent of the latest progress, e.g. `Full Restore 45.2%`.
+	// +optional
+	CurrentProgress string `json:"currentProgress,omitempty"`
+	// VolumeRehearsal is the result of the volume rehearsal.
+	// +optional
+	VolumeRehearsal *VolumeRehearsalStatus `json:"volumeRehearsal,omitempty"`
+	// OrphanedVolumes records the volumes left by a failed volume snapshot restore.
+	// +optional
+	OrphanedVolumes *OrphanedVolumesStatus `json:"orphanedVolumes,omitempty"`
+	// ResourceUsage is the resource consumed by the restore job.
+	// +optional
+	ResourceUsage *RestoreResourceUsage `json:"resourceUsage,omitempty"`
+	// RecoveryPlacement records the placement constraints applied to TiKV in the restore-finish phase.
+	// +optional
+	RecoveryPlacement *RecoveryPlacementStatus `json:"recoveryPlacement,omitempty"`
+	// ObservedGeneration is the generation of the restore spec that the latest restore job is created from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Rehydration is the progress of rehydrating the backup objects archived in the cold storage tier.
+	// +optional
+	Rehydration *RehydrationStatus `json:"rehydration,omitempty"`
+	// CorrelationID is the correlation id of the restore, which is propagated to the restore resources.
+	// +optional
+	CorrelationID string `json:"correlationID,omitempty"`
+	// VolumeAZ is the AZ the volume snapshots restore to, which is recorded from the spec when the volumes
+	// start to be restored and used for the rest of the restore.
+	// +optional
+	VolumeAZ string `json:"volumeAZ,omitempty"`
+	// VolumeAZPlan maps the AZ of every backup volume to the AZ it restores to, which is computed once from
+	// the restore meta when the volumes are prepared and reused on every retry, so the volumes of a restore
+	// are placed consistently even if the node topology changes.
+	// +optional
+	VolumeAZPlan map[string]string `json:"volumeAZPlan,omitempty"`
+	// SubJobs is the state of each job created by the restore, the volume snapshot restore creates
+	// a prepare job and a finish job, other restores create only one job.
+	// +nullable
+	SubJobs []RestoreSubJobStatus `json:"subJobs,omitempty"`
+	// PiTRPhase is the phase of a PiTR restore, the full backup is restored first, then the log backup is
+	// restored up to the PitrRestoredTs. It is derived from the progress reported by BR, so a restarted
+	// controller resumes observing the restore from the right phase.
+	// +optional
+	PiTRPhase RestorePiTRPhase `json:"pitrPhase,omitempty"`
+	// StoragePath is the path of the storage the backup data is restored from, it's one of the
+	// FallbackStorageProviders if the primary storage is unavailable. It's only recorded if
+	// FallbackStorageProviders is set.
+	// +optional
+	StoragePath string `json:"storagePath,omitempty"`
+	// PDWaitStartTime is the time at which the restore starts to wait for all the PD members ready in volume
+	// snapshot restore, the PDReadyTimeout is measured from it.
+	// +nullable
+	// +optional
+	PDWaitStartTime *metav1.Time `json:"pdWaitStartTime,omitempty"`
+	// TiKVRestartStartTime is the time at which the TiKV pods start to be restarted in waves in the
+	// restore-finish phase of volume snapshot restore, the pods created after it have been restarted.
+	// +nullable
+	// +optional
+	TiKVRestartStartTime *metav1.Time `json:"tikvRestartStartTime,omitempty"`
+	// TaggedVolumes are the IDs of the volumes tagged after TiKV is restored in volume snapshot restore,
+	// they are skipped when the tagging is retried.
+	// +nullable
+	// +optional
+	TaggedVolumes []string `json:"taggedVolumes,omitempty"`
+	// NextRetryTime is the time at which the volume snapshot restore waiting for the cluster, e.g. PD
+	// members or TiKV stores being ready, is synced again. The wait is retried with exponential backoff.
+	// +nullable
+	// +optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+	// ValidationResult is the result of comparing the backup meta with the target tidbcluster in volume snapshot
+	// restore. It's updated whenever the restore is validated, so the tidbcluster can be reconciled to match the
+	// backup programmatically before the failed restore is retried.
+	// +optional
+	ValidationResult *RestoreValidationResult `json:"validationResult,omitempty"`
+}
+
+// RestorePiTRPhase is the phase of a PiTR restore.
+type RestorePiTRPhase string
+
+const (
+	// RestorePiTRFullRestore means the full backup of a PiTR restore is being restored
+	RestorePiTRFullRestore RestorePiTRPhase = "FullRestore"
+	// RestorePiTRLogRestore means the log backup of a PiTR restore is being restored up to the PitrRestoredTs
+	RestorePiTRLogRestore RestorePiTRPhase = "LogRestore"
+)
+
+// RestoreSubJobType is the type of a job created by a Restore.
+type RestoreSubJobType string
+
+const (
+	// RestoreSubJobRestore is the only job of a restore which is not in volume snapshot mode
+	RestoreSubJobRestore RestoreSubJobType = "Restore"
+	// RestoreSubJobPrepare is the job of a volume snapshot restore to rebuild the volumes from the snapshots
+	RestoreSubJobPrepare RestoreSubJobType = "Prepare"
+	// RestoreSubJobFinish is the job of a volume snapshot restore to make the data in the volumes consistent
+	RestoreSubJobFinish RestoreSubJobType = "Finish"
+)
+
+// RestoreSubJobPhase is the phase of a job created by a Restore.
+type RestoreSubJobPhase string
+
+const (
+	// RestoreSubJobScheduled means the job has been created
+	RestoreSubJobScheduled RestoreSubJobPhase = "Scheduled"
+	// RestoreSubJobRunning means the job is running
+	RestoreSubJobRunning RestoreSubJobPhase = "Running"
+	// RestoreSubJobComplete means the job has successfully finished
+	RestoreSubJobComplete RestoreSubJobPhase = "Complete"
+	// RestoreSubJobFailed means the job has failed
+	RestoreSubJobFailed RestoreSubJobPhase = "Failed"
+)
+
+// RestoreSubJobStatus is the state of a job created by a Restore.
+type RestoreSubJobStatus struct {
+	// Type is the type of the job
+	Type RestoreSubJobType `json:"type"`
+	// JobName is the name of the job
+	JobName string `json:"jobName,omitempty"`
+	// Phase is the phase of the job, it only moves forward from Scheduled to Running, then to Complete or Failed
+	Phase RestoreSubJobPhase `json:"phase,omitempty"`
+	// Attempts is the number of the pods started to run the job, including the retries
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// LastTransitionTime is the time at which the phase of the job was changed
+	// +nullable
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// RehydrationStatus is the progress of rehydrating the backup objects archived in the cold storage tier.
+type RehydrationStatus struct {
+	// Objects is the number of the backup objects archived in the cold storage tier
+	Objects int32 `json:"objects,omitempty"`
+	// Rehydrated is the number of the objects whose rehydrated copies can be read
+	Rehydrated int32 `json:"rehydrated,omitempty"`
+	// Rehydrating is the number of the objects that are being rehydrated
+	Rehydrating int32 `json:"rehydrating,omitempty"`
+}
+
+// VolumeRehearsalStatus is the result of the volume rehearsal of a volume snapshot restore.
+type VolumeRehearsalStatus struct {
+	// Volumes is the number of TiKV volumes restored from the snapshots
+	Volumes int32 `json:"volumes,omitempty"`
+	// ProvisionDuration is the time taken to create the volumes from the snapshots
+	ProvisionDuration string `json:"provisionDuration,omitempty"`
+	// AttachDuration is the time taken to attach all the volumes after they are created
+	AttachDuration string `json:"attachDuration,omitempty"`
+}
+
+// OrphanedVolumesStatus records the cloud volumes restored from the snapshots in a failed volume snapshot restore.
+type OrphanedVolumesStatus struct {
+	// VolumeIDs are the ids of the cloud volumes restored from the snapshots
+	VolumeIDs []string `json:"volumeIDs,omitempty"`
+	// Cleaned indicates whether the volumes have been deleted
+	Cleaned bool `json:"cleaned,omitempty"`
+}
+
+// RestoreResourceUsage is the resource consumed by the restore job container, which is sampled
+// from the cgroup of the container while BR is running.
+type RestoreResourceUsage struct {
+	// PeakCPU is the peak CPU usage in cores
+	PeakCPU *resource.Quantity `json:"peakCPU,omitempty"`
+	// PeakMemory is the peak memory usage
+	PeakMemory *resource.Quantity `json:"peakMemory,omitempty"`
+	// Duration is the time taken by BR
+	Duration string `json:"duration,omitempty"`
+}
+
+// RestoreValidationResult records how the target tidbcluster compares with the tidbcluster in the backup meta.
+type RestoreValidationResult struct {
+	// TiKVReplicas compares the TiKV replicas
+	TiKVReplicas RestoreReplicasValidation `json:"tikvReplicas"`
+	// TiFlashReplicas compares the TiFlash replicas
+	TiFlashReplicas RestoreReplicasValidation `json:"tiflashReplicas"`
+	// TiKVEncryption compares the TiKV encryption config, it's not set if the backup meta has no TiKV config
+	// +optional
+	TiKVEncryption *RestoreEncryptionValidation `json:"tikvEncryption,omitempty"`
+	// TiFlashEncryption compares the encryption config of the TiFlash proxy, it's not set if either the backup
+	// meta or the tidbcluster has no TiFlash config
+	// +optional
+	TiFlashEncryption *RestoreEncryptionValidation `json:"tiflashEncryption,omitempty"`
+}
+
+// RestoreReplicasValidation compares the replicas of a component of the target tidbcluster with the backup.
+type RestoreReplicasValidation struct {
+	// Expected is the replicas in the backup meta
+	Expected int32 `json:"expected"`
+	// Actual is the replicas of the target tidbcluster
+	Actual int32 `json:"actual"`
+	// Matched indicates whether the replicas are the same
+	Matched bool `json:"matched"`
+}
+
+// RestoreEncryptionValidation compares the encryption config of a component of the target tidbcluster with
+// the backup.
+type RestoreEncryptionValidation struct {
+	// ExpectedMethod is the data encryption method in the backup meta
+	// +optional
+	ExpectedMethod string `json:"expectedMethod,omitempty"`
+	// ActualMethod is the data encryption method of the target tidbcluster
+	// +optional
+	ActualMethod string `json:"actualMethod,omitempty"`
+	// ExpectedMasterKeyID is the master key id in the backup meta
+	// +optional
+	ExpectedMasterKeyID string `json:"expectedMasterKeyID,omitempty"`
+	// ActualMasterKeyID is the master key id of the target tidbcluster
+	// +optional
+	ActualMasterKeyID string `json:"actualMasterKeyID,omitempty"`
+	// Matched indicates whether the backup isn't encrypted or the target tidbcluster is encrypted by the same
+	// method and master key. A master key rotation allowed by AllowMasterKeyRotation is still a mismatch here.
+	Matched bool `json:"matched"`
+}
+
+// RecoveryPlacementStatus records the placement constraints applied to TiKV, so that they can be reverted
+// even if the operator is restarted.
+type RecoveryPlacementStatus struct {
+	// NodeSelector is the node selector of TiKV with the recovery placement applied
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// OriginalNodeSelector is the node selector of TiKV before the recovery placement is applied
+	OriginalNodeSelector map[string]string `json:"originalNodeSelector,omitempty"`
+	// Reverted indicates whether the original node selector is restored
+	Reverted bool `json:"reverted,omitempty"`
 }
 
 // +k8s:openapi-gen=true
@@ -692,6 +692,22 @@ func (in *CDCConfigWraper) DeepCopy() *CDCConfigWraper {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryCheck) DeepCopyInto(out *CanaryCheck) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryCheck.
+func (in *CanaryCheck) DeepCopy() *CanaryCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CleanOption) DeepCopyInto(out *CleanOption) {
 	*out = *in
@@ -1117,6 +1133,22 @@ func (in *CrdKinds) DeepCopy() *CrdKinds {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrossAccountSnapshot) DeepCopyInto(out *CrossAccountSnapshot) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrossAccountSnapshot.
+func (in *CrossAccountSnapshot) DeepCopy() *CrossAccountSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(CrossAccountSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DMCluster) DeepCopyInto(out *DMCluster) {
 	*out = *in
@@ -2384,6 +2416,22 @@ func (in *IsolationRead) DeepCopy() *IsolationRead {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LightningCheckpoint) DeepCopyInto(out *LightningCheckpoint) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LightningCheckpoint.
+func (in *LightningCheckpoint) DeepCopy() *LightningCheckpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(LightningCheckpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LocalStorageProvider) DeepCopyInto(out *LocalStorageProvider) {
 	*out = *in
@@ -3069,6 +3117,27 @@ func (in *OpenTracingSampler) DeepCopy() *OpenTracingSampler {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanedVolumesStatus) DeepCopyInto(out *OrphanedVolumesStatus) {
+	*out = *in
+	if in.VolumeIDs != nil {
+		in, out := &in.VolumeIDs, &out.VolumeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanedVolumesStatus.
+func (in *OrphanedVolumesStatus) DeepCopy() *OrphanedVolumesStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanedVolumesStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PDConfig) DeepCopyInto(out *PDConfig) {
 	*out = *in
@@ -4600,6 +4669,91 @@ func (in *Quota) DeepCopy() *Quota {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecoveryPlacement) DeepCopyInto(out *RecoveryPlacement) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecoveryPlacement.
+func (in *RecoveryPlacement) DeepCopy() *RecoveryPlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(RecoveryPlacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RecoveryPlacementStatus) DeepCopyInto(out *RecoveryPlacementStatus) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OriginalNodeSelector != nil {
+		in, out := &in.OriginalNodeSelector, &out.OriginalNodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RecoveryPlacementStatus.
+func (in *RecoveryPlacementStatus) DeepCopy() *RecoveryPlacementStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RecoveryPlacementStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RehydrationConfig) DeepCopyInto(out *RehydrationConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RehydrationConfig.
+func (in *RehydrationConfig) DeepCopy() *RehydrationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RehydrationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RehydrationStatus) DeepCopyInto(out *RehydrationStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RehydrationStatus.
+func (in *RehydrationStatus) DeepCopy() *RehydrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RehydrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RelabelConfig) DeepCopyInto(out *RelabelConfig) {
 	*out = *in
@@ -4744,6 +4898,22 @@ func (in *RestoreCondition) DeepCopy() *RestoreCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreEncryptionValidation) DeepCopyInto(out *RestoreEncryptionValidation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreEncryptionValidation.
+func (in *RestoreEncryptionValidation) DeepCopy() *RestoreEncryptionValidation {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreEncryptionValidation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreList) DeepCopyInto(out *RestoreList) {
 	*out = *in
@@ -4777,6 +4947,48 @@ func (in *RestoreList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreReplicasValidation) DeepCopyInto(out *RestoreReplicasValidation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreReplicasValidation.
+func (in *RestoreReplicasValidation) DeepCopy() *RestoreReplicasValidation {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreReplicasValidation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreResourceUsage) DeepCopyInto(out *RestoreResourceUsage) {
+	*out = *in
+	if in.PeakCPU != nil {
+		in, out := &in.PeakCPU, &out.PeakCPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.PeakMemory != nil {
+		in, out := &in.PeakMemory, &out.PeakMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreResourceUsage.
+func (in *RestoreResourceUsage) DeepCopy() *RestoreResourceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreResourceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
 	*out = *in
@@ -4800,6 +5012,13 @@ func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
 	}
 	in.StorageProvider.DeepCopyInto(&out.StorageProvider)
 	in.PitrFullBackupStorageProvider.DeepCopyInto(&out.PitrFullBackupStorageProvider)
+	if in.FallbackStorageProviders != nil {
+		in, out := &in.FallbackStorageProviders, &out.FallbackStorageProviders
+		*out = make([]StorageProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.StorageClassName != nil {
 		in, out := &in.StorageClassName, &out.StorageClassName
 		*out = new(string)
@@ -4822,6 +5041,13 @@ func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
 		*out = new(v1.Affinity)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ImagePullSecrets != nil {
 		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
 		*out = make([]v1.LocalObjectReference, len(*in))
@@ -4837,6 +5063,156 @@ func (in *RestoreSpec) DeepCopyInto(out *RestoreSpec) {
 		*out = new(v1.PodSecurityContext)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.RestrictedSecurityContext != nil {
+		in, out := &in.RestrictedSecurityContext, &out.RestrictedSecurityContext
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TableConcurrency != nil {
+		in, out := &in.TableConcurrency, &out.TableConcurrency
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SessionVariables != nil {
+		in, out := &in.SessionVariables, &out.SessionVariables
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AutoRehydrate != nil {
+		in, out := &in.AutoRehydrate, &out.AutoRehydrate
+		*out = new(RehydrationConfig)
+		**out = **in
+	}
+	if in.StoreVolumeMapping != nil {
+		in, out := &in.StoreVolumeMapping, &out.StoreVolumeMapping
+		*out = make([]StoreVolumeMap, len(*in))
+		copy(*out, *in)
+	}
+	if in.PDReadyTimeout != nil {
+		in, out := &in.PDReadyTimeout, &out.PDReadyTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RestoreTimeout != nil {
+		in, out := &in.RestoreTimeout, &out.RestoreTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MetaReadTimeout != nil {
+		in, out := &in.MetaReadTimeout, &out.MetaReadTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.TiKVRestartBatchSize != nil {
+		in, out := &in.TiKVRestartBatchSize, &out.TiKVRestartBatchSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TiKVRestartBatchInterval != nil {
+		in, out := &in.TiKVRestartBatchInterval, &out.TiKVRestartBatchInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RecoveryPlacement != nil {
+		in, out := &in.RecoveryPlacement, &out.RecoveryPlacement
+		*out = new(RecoveryPlacement)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CanaryChecks != nil {
+		in, out := &in.CanaryChecks, &out.CanaryChecks
+		*out = make([]CanaryCheck, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalContainers != nil {
+		in, out := &in.AdditionalContainers, &out.AdditionalContainers
+		*out = make([]v1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalVolumes != nil {
+		in, out := &in.AdditionalVolumes, &out.AdditionalVolumes
+		*out = make([]v1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImagePullPolicy != nil {
+		in, out := &in.ImagePullPolicy, &out.ImagePullPolicy
+		*out = new(v1.PullPolicy)
+		**out = **in
+	}
+	if in.PostRestoreHook != nil {
+		in, out := &in.PostRestoreHook, &out.PostRestoreHook
+		*out = new(v1.Container)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Checksum != nil {
+		in, out := &in.Checksum, &out.Checksum
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DNSConfig != nil {
+		in, out := &in.DNSConfig, &out.DNSConfig
+		*out = new(v1.PodDNSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostAliases != nil {
+		in, out := &in.HostAliases, &out.HostAliases
+		*out = make([]v1.HostAlias, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CrossAccountSnapshot != nil {
+		in, out := &in.CrossAccountSnapshot, &out.CrossAccountSnapshot
+		*out = new(CrossAccountSnapshot)
+		**out = **in
+	}
+	if in.RestoreMetaConfigMap != nil {
+		in, out := &in.RestoreMetaConfigMap, &out.RestoreMetaConfigMap
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.InitContainerResources != nil {
+		in, out := &in.InitContainerResources, &out.InitContainerResources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LightningCheckpoint != nil {
+		in, out := &in.LightningCheckpoint, &out.LightningCheckpoint
+		*out = new(LightningCheckpoint)
+		**out = **in
+	}
+	if in.ImportParallelism != nil {
+		in, out := &in.ImportParallelism, &out.ImportParallelism
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PDAddresses != nil {
+		in, out := &in.PDAddresses, &out.PDAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -4869,6 +5245,67 @@ func (in *RestoreStatus) DeepCopyInto(out *RestoreStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.VolumeRehearsal != nil {
+		in, out := &in.VolumeRehearsal, &out.VolumeRehearsal
+		*out = new(VolumeRehearsalStatus)
+		**out = **in
+	}
+	if in.OrphanedVolumes != nil {
+		in, out := &in.OrphanedVolumes, &out.OrphanedVolumes
+		*out = new(OrphanedVolumesStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceUsage != nil {
+		in, out := &in.ResourceUsage, &out.ResourceUsage
+		*out = new(RestoreResourceUsage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RecoveryPlacement != nil {
+		in, out := &in.RecoveryPlacement, &out.RecoveryPlacement
+		*out = new(RecoveryPlacementStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rehydration != nil {
+		in, out := &in.Rehydration, &out.Rehydration
+		*out = new(RehydrationStatus)
+		**out = **in
+	}
+	if in.VolumeAZPlan != nil {
+		in, out := &in.VolumeAZPlan, &out.VolumeAZPlan
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SubJobs != nil {
+		in, out := &in.SubJobs, &out.SubJobs
+		*out = make([]RestoreSubJobStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PDWaitStartTime != nil {
+		in, out := &in.PDWaitStartTime, &out.PDWaitStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.TiKVRestartStartTime != nil {
+		in, out := &in.TiKVRestartStartTime, &out.TiKVRestartStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.TaggedVolumes != nil {
+		in, out := &in.TaggedVolumes, &out.TaggedVolumes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ValidationResult != nil {
+		in, out := &in.ValidationResult, &out.ValidationResult
+		*out = new(RestoreValidationResult)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -4882,6 +5319,51 @@ func (in *RestoreStatus) DeepCopy() *RestoreStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreSubJobStatus) DeepCopyInto(out *RestoreSubJobStatus) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreSubJobStatus.
+func (in *RestoreSubJobStatus) DeepCopy() *RestoreSubJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreSubJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreValidationResult) DeepCopyInto(out *RestoreValidationResult) {
+	*out = *in
+	out.TiKVReplicas = in.TiKVReplicas
+	out.TiFlashReplicas = in.TiFlashReplicas
+	if in.TiKVEncryption != nil {
+		in, out := &in.TiKVEncryption, &out.TiKVEncryption
+		*out = new(RestoreEncryptionValidation)
+		**out = **in
+	}
+	if in.TiFlashEncryption != nil {
+		in, out := &in.TiFlashEncryption, &out.TiFlashEncryption
+		*out = new(RestoreEncryptionValidation)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreValidationResult.
+func (in *RestoreValidationResult) DeepCopy() *RestoreValidationResult {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreValidationResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3StorageProvider) DeepCopyInto(out *S3StorageProvider) {
 	*out = *in
@@ -5299,6 +5781,22 @@ func (in *StorageVolumeStatus) DeepCopy() *StorageVolumeStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StoreVolumeMap) DeepCopyInto(out *StoreVolumeMap) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StoreVolumeMap.
+func (in *StoreVolumeMap) DeepCopy() *StoreVolumeMap {
+	if in == nil {
+		return nil
+	}
+	out := new(StoreVolumeMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SuspendAction) DeepCopyInto(out *SuspendAction) {
 	*out = *in
@@ -9881,6 +10379,22 @@ func (in *User) DeepCopy() *User {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeRehearsalStatus) DeepCopyInto(out *VolumeRehearsalStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeRehearsalStatus.
+func (in *VolumeRehearsalStatus) DeepCopy() *VolumeRehearsalStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeRehearsalStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkerConfig) DeepCopyInto(out *WorkerConfig) {
 	*out = *in
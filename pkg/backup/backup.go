@@ -32,6 +32,8 @@ type RestoreManager interface {
 	Sync(backup *v1alpha1.Restore) error
 	// UpdateCondition updates the condition for a Restore.
 	UpdateCondition(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition) error
+	// UpdateStatus updates the status for a Restore.
+	UpdateStatus(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error
 }
 
 // BackupScheduleManager implements the logic for manage backupSchedule.
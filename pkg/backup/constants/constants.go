@@ -13,6 +13,8 @@
 
 package constants
 
+import "time"
+
 const (
 	// DefaultServiceAccountName is the default name of the ServiceAccount to use to run backup and restore's job pod.
 	DefaultServiceAccountName = "tidb-backup-manager"
@@ -26,9 +28,20 @@ const (
 	// DefaultBackoffLimit specifies the number of retries before marking this job failed.
 	DefaultBackoffLimit = 6
 
+	// DefaultPDReadyTimeout is the default timeout to wait for all the PD members ready in volume snapshot restore
+	DefaultPDReadyTimeout = 24 * time.Hour
+
+	// DefaultMetaReadTimeout is the default timeout of each attempt to read the backup meta and the restore meta
+	DefaultMetaReadTimeout = time.Minute
+
 	// TidbPasswordKey represents the password key in tidb secret
 	TidbPasswordKey = "password"
 
+	// TidbPasswordPath is where the tidb secret is mounted if the password is read from a file
+	TidbPasswordPath = "/var/lib/tidb-password"
+	// TidbPasswordFile is the password file in TidbPasswordPath
+	TidbPasswordFile = TidbPasswordPath + "/" + TidbPasswordKey
+
 	// S3AccessKey represents the S3 compatible access key id in related secret
 	S3AccessKey = "access_key"
 
@@ -53,12 +66,29 @@ const (
 	// AzblobTenantID represents the Azure Directory (tenant) ID for the application using AAD credtentials in related secret
 	AzblobTenantID = "AZURE_TENANT_ID"
 
+	// AzblobFederatedTokenFile represents the path of the projected service account token used by the Azure workload identity
+	AzblobFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+
+	// AzblobAuthorityHost represents the Azure Active Directory endpoint used by the Azure workload identity
+	AzblobAuthorityHost = "AZURE_AUTHORITY_HOST"
+
+	// AzblobClientIDAnnKey is the annotation of the service account with the client ID of the Azure workload identity
+	AzblobClientIDAnnKey = "azure.workload.identity/client-id"
+
+	// AzblobTenantIDAnnKey is the annotation of the service account with the tenant ID of the Azure workload identity
+	AzblobTenantIDAnnKey = "azure.workload.identity/tenant-id"
+
 	// BackupManagerEnvVarPrefix represents the environment variable used for tidb-backup-manager must include this prefix
 	BackupManagerEnvVarPrefix = "BACKUP_MANAGER"
 
 	// BR certificate storage path
 	BRCertPath = "/var/lib/br-tls"
 
+	// StorageCABundlePath is where the CA bundle of the S3 compatible storage endpoint is mounted
+	StorageCABundlePath = "/var/lib/storage-ca"
+	// StorageCABundleKey is the key of the CA bundle in the secret
+	StorageCABundleKey = "ca.crt"
+
 	// ServiceAccountCAPath is where is CABundle of serviceaccount locates
 	ServiceAccountCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
 
@@ -94,14 +124,20 @@ const (
 	KubeAnnBoundByController      = "pv.kubernetes.io/bound-by-controller"
 	KubeAnnDynamicallyProvisioned = "pv.kubernetes.io/provisioned-by"
 
-	NodeAffinityCsiEbsAzKey = "topology.ebs.csi.aws.com/zone"
+	NodeAffinityCsiEbsAzKey  = "topology.ebs.csi.aws.com/zone"
+	NodeAffinityCsiPdZoneKey = "topology.gke.io/zone"
 
 	LocalTmp           = "/tmp"
 	ClusterBackupMeta  = "clustermeta"
 	ClusterRestoreMeta = "restoremeta"
 	MetaFile           = "backupmeta"
 	ClusterManifests   = "manifests"
+	// LogBackupCheckpointDir is the directory of the global checkpoint ts files uploaded by log backup
+	LogBackupCheckpointDir = "v1/global_checkpoint"
 
 	// AWSRegionEnv is the aws region environment variable
 	AWSRegionEnv = "AWS_REGION"
+	// StorageCABundleEnv is the environment variable of the CA bundle of the storage endpoint, the entrypoint
+	// of the backup manager combines it with the system roots and points AWS_CA_BUNDLE and SSL_CERT_FILE to it
+	StorageCABundleEnv = "STORAGE_CA_BUNDLE"
 )
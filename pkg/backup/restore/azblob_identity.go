@@ -0,0 +1,80 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	azblobIdentityTokenVolName   = "azure-identity-token"
+	azblobIdentityTokenMountPath = "/var/run/secrets/azure/tokens"
+	azblobIdentityTokenFile      = "azure-identity-token"
+	// azblobIdentityTokenAudience is the audience of the token exchanged for the Azure AD token
+	azblobIdentityTokenAudience = "api://AzureADTokenExchange"
+	azblobIdentityTokenExpiry   = 3600
+	azblobAuthorityHost         = "https://login.microsoftonline.com/"
+)
+
+// azblobWorkloadIdentity returns the env vars, volume and volume mount for the job pod to access the azure blob
+// storage with the workload identity of its service account. The service account token is projected as the
+// federated token, and the client and tenant of the identity are read from the annotations of the service account.
+func (rm *restoreManager) azblobWorkloadIdentity(ns, serviceAccount string) ([]corev1.EnvVar, corev1.Volume, corev1.VolumeMount, string, error) {
+	sa, err := rm.deps.KubeClientset.CoreV1().ServiceAccounts(ns).Get(context.TODO(), serviceAccount, metav1.GetOptions{})
+	if err != nil {
+		return nil, corev1.Volume{}, corev1.VolumeMount{}, "GetServiceAccountFailed", fmt.Errorf("get service account %s/%s failed, err: %v", ns, serviceAccount, err)
+	}
+	clientID := sa.Annotations[constants.AzblobClientIDAnnKey]
+	tenantID := sa.Annotations[constants.AzblobTenantIDAnnKey]
+	if clientID == "" || tenantID == "" {
+		return nil, corev1.Volume{}, corev1.VolumeMount{}, "ServiceAccountNotAnnotated", fmt.Errorf("service account %s/%s should be annotated with %s and %s to use azure workload identity",
+			ns, serviceAccount, constants.AzblobClientIDAnnKey, constants.AzblobTenantIDAnnKey)
+	}
+
+	envVars := []corev1.EnvVar{
+		{Name: constants.AzblobClientID, Value: clientID},
+		{Name: constants.AzblobTenantID, Value: tenantID},
+		{Name: constants.AzblobFederatedTokenFile, Value: path.Join(azblobIdentityTokenMountPath, azblobIdentityTokenFile)},
+		{Name: constants.AzblobAuthorityHost, Value: azblobAuthorityHost},
+	}
+	volume := corev1.Volume{
+		Name: azblobIdentityTokenVolName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          azblobIdentityTokenAudience,
+							ExpirationSeconds: pointer.Int64Ptr(azblobIdentityTokenExpiry),
+							Path:              azblobIdentityTokenFile,
+						},
+					},
+				},
+			},
+		},
+	}
+	volumeMount := corev1.VolumeMount{
+		Name:      azblobIdentityTokenVolName,
+		ReadOnly:  true,
+		MountPath: azblobIdentityTokenMountPath,
+	}
+	return envVars, volume, volumeMount, "", nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// restoreRateLimit returns the rate limit of the restore in MB/s per TiKV store, 0 means the restore is not limited
+func restoreRateLimit(r *v1alpha1.Restore) uint {
+	if r.Spec.BR == nil || r.Spec.BR.RateLimit == nil {
+		return 0
+	}
+	return *r.Spec.BR.RateLimit
+}
+
+// restoreBandwidth returns the aggregate bandwidth of the restore in MB/s, BR limits the rate of every TiKV store,
+// so it is the rate limit multiplied by the number of the TiKV stores of the target cluster. The target cluster
+// is in the namespace of the restore if the cluster namespace is not set, and it's counted as one store if it's
+// not found.
+func restoreBandwidth(r *v1alpha1.Restore, tcLister listers.TidbClusterLister) uint {
+	rateLimit := restoreRateLimit(r)
+	if rateLimit == 0 {
+		return 0
+	}
+	tcNamespace := r.Spec.BR.ClusterNamespace
+	if tcNamespace == "" {
+		tcNamespace = r.Namespace
+	}
+	stores := uint(1)
+	tc, err := tcLister.TidbClusters(tcNamespace).Get(r.Spec.BR.Cluster)
+	if err != nil {
+		klog.Warningf("restore %s/%s: get tidbcluster %s/%s failed, count it as one TiKV store, err: %v",
+			r.Namespace, r.Name, tcNamespace, r.Spec.BR.Cluster, err)
+	} else if tc.Spec.TiKV != nil && tc.Spec.TiKV.Replicas > 0 {
+		stores = uint(tc.Spec.TiKV.Replicas)
+	}
+	return rateLimit * stores
+}
+
+// isRestoreActive returns true if the restore has created its job and not finished yet
+func isRestoreActive(r *v1alpha1.Restore) bool {
+	return v1alpha1.IsRestoreScheduled(r) &&
+		!v1alpha1.IsRestoreComplete(r) &&
+		!v1alpha1.IsRestoreFailed(r) &&
+		!v1alpha1.IsRestoreCanceled(r) &&
+		!v1alpha1.IsRestoreInvalid(r)
+}
+
+// ActiveRestoresBandwidth returns the sum of the aggregate bandwidth of the active restores in MB/s
+func ActiveRestoresBandwidth(lister listers.RestoreLister, tcLister listers.TidbClusterLister) (uint, error) {
+	restores, err := lister.List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+	var usage uint
+	for _, r := range restores {
+		if isRestoreActive(r) {
+			usage += restoreBandwidth(r, tcLister)
+		}
+	}
+	return usage, nil
+}
+
+// checkBandwidthBudget holds the restore with condition Throttled if its bandwidth and the bandwidth of the
+// active restores exceed the bandwidth budget, until enough active restores finish. A restore without rate limit
+// is not throttled, and a restore whose own bandwidth exceeds the budget is failed since it would wait forever.
+// Condition Throttled is cleared once the restore is admitted.
+// The check is based on the cached restores, restores checked at the same time may exceed the budget a little.
+func (rm *restoreManager) checkBandwidthBudget(r *v1alpha1.Restore) (string, error) {
+	budget := rm.deps.CLIConfig.RestoreBandwidthBudget
+	bandwidth := restoreBandwidth(r, rm.deps.TiDBClusterLister)
+	if budget == 0 || bandwidth == 0 {
+		return "", nil
+	}
+
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if bandwidth > budget {
+		err := fmt.Errorf("bandwidth %d MB/s of the restore exceeds the bandwidth budget %d MB/s", bandwidth, budget)
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BandwidthBudgetExceeded",
+			Message: err.Error(),
+		}, nil)
+		return "", controller.IgnoreErrorf("restore %s/%s: %v", ns, name, err)
+	}
+
+	usage, err := ActiveRestoresBandwidth(rm.deps.RestoreLister, rm.deps.TiDBClusterLister)
+	if err != nil {
+		return "ListRestoresFailed", err
+	}
+	if usage+bandwidth <= budget {
+		if _, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreThrottled); cond != nil && cond.Status == corev1.ConditionTrue {
+			if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreThrottled,
+				Status:  corev1.ConditionFalse,
+				Reason:  "BandwidthBudgetAvailable",
+				Message: fmt.Sprintf("bandwidth %d MB/s fits in the bandwidth budget, %d of %d MB/s is used by the active restores", bandwidth, usage, budget),
+			}, nil); err != nil {
+				return "UpdateRestoreThrottledFailed", err
+			}
+		}
+		return "", nil
+	}
+
+	klog.Infof("restore %s/%s is throttled, bandwidth %d MB/s, %d of %d MB/s budget is used", ns, name, bandwidth, usage, budget)
+	rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreThrottled,
+		Status:  corev1.ConditionTrue,
+		Reason:  "BandwidthBudgetExceeded",
+		Message: fmt.Sprintf("bandwidth %d MB/s exceeds the bandwidth budget, %d of %d MB/s is used by the active restores", bandwidth, usage, budget),
+	}, nil)
+	return "", controller.RequeueErrorf("restore %s/%s: waiting for %d MB/s bandwidth budget", ns, name, bandwidth)
+}
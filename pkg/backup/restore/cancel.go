@@ -0,0 +1,140 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+// NeedCancel returns true if the restore is asked to be canceled and is not finished yet. The completed
+// restore is not canceled, the failed one is still canceled to clean up what it left.
+func NeedCancel(r *v1alpha1.Restore) bool {
+	return r.Spec.Cancel && !v1alpha1.IsRestoreComplete(r) && !v1alpha1.IsRestoreCanceled(r)
+}
+
+// cancelRestore cleans up the canceled restore and moves it to the terminal condition Canceled. Every step
+// checks what is left to clean up, so the restore requeued in the middle is cleaned up again safely.
+//  1. delete the jobs of the restore and wait for them gone, so the backup-manager doesn't update the restore
+//     after it's canceled
+//  2. delete the restore pvc created for the restore
+//  3. delete the image warmup daemonset of the volume snapshot restore
+//  4. revert the recovery mode and the TiKV volumes ready annotation set by the volume snapshot restore, and
+//     the TiKV node selector pinned by the recovery placement in the restore-finish phase
+//
+// The tags added to the restored volumes are kept, the volumes are still used by the TiKV of the tidbcluster and
+// the tags only identify the cluster and the restore they are restored by, the canceled message records them.
+func (rm *restoreManager) cancelRestore(r *v1alpha1.Restore) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+
+	_, remaining, err := rm.deleteRestoreJobs(r)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return controller.RequeueErrorf("restore %s/%s: waiting for %d jobs deleted to cancel the restore", ns, name, remaining)
+	}
+
+	var cleaned []string
+	if r.Spec.BR == nil {
+		deleted, err := rm.deleteRestorePVC(r)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			cleaned = append(cleaned, fmt.Sprintf("restore pvc %s is deleted", r.GetRestorePVCName()))
+		}
+	}
+
+	if r.Spec.BR != nil && r.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+		deleted, err := rm.cleanupImageWarmup(r)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			cleaned = append(cleaned, fmt.Sprintf("image warmup daemonset %s is deleted", r.GetImageWarmupName()))
+		}
+
+		reverted, err := rm.revertTCRecoveryMark(r)
+		if err != nil {
+			return err
+		}
+		cleaned = append(cleaned, reverted...)
+
+		if n := len(r.Status.TaggedVolumes); n > 0 {
+			cleaned = append(cleaned, fmt.Sprintf("tags of %d restored volumes are kept", n))
+		}
+	}
+
+	message := "restore is canceled"
+	if len(cleaned) > 0 {
+		message = fmt.Sprintf("%s, %s", message, strings.Join(cleaned, ", "))
+	}
+	klog.Infof("restore %s/%s: %s", ns, name, message)
+	return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreCanceled,
+		Status:  corev1.ConditionTrue,
+		Reason:  "RestoreCanceled",
+		Message: message,
+	}, nil)
+}
+
+// revertTCRecoveryMark clears the recovery mode and the TiKV volumes ready annotation of the tidbcluster if the
+// annotation is set by the restore, so the tidbcluster isn't left waiting for the restore-data phase of a restore
+// which is gone. The tidbcluster the restore hasn't marked is not touched. The TiKV node selector pinned by the
+// recovery placement is reverted too if it's not reverted yet. It returns what is reverted.
+func (rm *restoreManager) revertTCRecoveryMark(r *v1alpha1.Restore) ([]string, error) {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	tcNamespace := ns
+	if r.Spec.BR.ClusterNamespace != "" {
+		tcNamespace = r.Spec.BR.ClusterNamespace
+	}
+	tc, err := rm.deps.TiDBClusterLister.TidbClusters(tcNamespace).Get(r.Spec.BR.Cluster)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restore %s/%s get tidbcluster %s/%s failed, err: %v", ns, name, tcNamespace, r.Spec.BR.Cluster, err)
+	}
+
+	var reverted []string
+	restoreMark := fmt.Sprintf("%s/%s", ns, name)
+	if tc.Annotations[label.AnnTiKVVolumesReadyKey] == restoreMark {
+		tc = tc.DeepCopy()
+		tc.Spec.RecoveryMode = false
+		delete(tc.Annotations, label.AnnTiKVVolumesReadyKey)
+		if tc, err = rm.deps.TiDBClusterControl.Update(tc); err != nil {
+			return nil, fmt.Errorf("restore %s/%s clear the recovery mark of tidbcluster %s/%s failed, err: %v", ns, name, tcNamespace, r.Spec.BR.Cluster, err)
+		}
+		reverted = append(reverted, fmt.Sprintf("recovery mode of tidbcluster %s/%s is reverted", tcNamespace, tc.Name))
+	}
+
+	// the node selector is patched after the tidbcluster is updated, so the update doesn't overwrite it
+	if placement := r.Status.RecoveryPlacement; placement != nil && !placement.Reverted && tc.Spec.TiKV != nil {
+		if _, err := rm.revertRecoveryPlacement(r, tc); err != nil {
+			return nil, fmt.Errorf("restore %s/%s revert the recovery placement of tidbcluster %s/%s failed, err: %v", ns, name, tcNamespace, tc.Name, err)
+		}
+		reverted = append(reverted, fmt.Sprintf("TiKV node selector of tidbcluster %s/%s is reverted", tcNamespace, tc.Name))
+	}
+	return reverted, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCancelVolumeSnapshotRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	restore.Spec.Cancel = true
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreVolumeComplete, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+
+	// the tidbcluster is marked by the restore
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, true)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	restoreMark := fmt.Sprintf("%s/%s", restore.Namespace, restore.Name)
+	tc.Annotations = map[string]string{label.AnnTiKVVolumesReadyKey: restoreMark}
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() string {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		if err != nil {
+			return ""
+		}
+		return tc.Annotations[label.AnnTiKVVolumesReadyKey]
+	}, time.Second*10).Should(Equal(restoreMark))
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: restore.Namespace,
+			Name:      restore.GetRestoreJobName(),
+			Labels:    label.NewRestore().Instance(restore.GetInstanceName()).Restore(restore.Name),
+		},
+	}
+	_, err = deps.KubeClientset.BatchV1().Jobs(job.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() error {
+		_, err := deps.JobLister.Jobs(job.Namespace).Get(job.Name)
+		return err
+	}, time.Second*10).Should(BeNil())
+
+	// the restore waits for the job gone before it's canceled
+	g.Expect(NeedCancel(restore)).To(BeTrue())
+	m := NewRestoreManager(deps)
+	err = m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	_, err = deps.KubeClientset.BatchV1().Jobs(job.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	g.Eventually(func() bool {
+		_, err := deps.JobLister.Jobs(job.Namespace).Get(job.Name)
+		return errors.IsNotFound(err)
+	}, time.Second*10).Should(BeTrue())
+
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCanceled, "RestoreCanceled")
+	tc, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Get(context.TODO(), tc.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(tc.Spec.RecoveryMode).To(BeFalse())
+	g.Expect(tc.Annotations).NotTo(HaveKey(label.AnnTiKVVolumesReadyKey))
+
+	// the canceled restore is not synced again
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(NeedCancel(get)).To(BeFalse())
+	g.Expect(m.Sync(get)).To(Succeed())
+}
+
+func TestCancelRestoreInRestoreFinish(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	applied := map[string]string{"zone": "recovery", "pool": "restore"}
+	original := map[string]string{"zone": "origin"}
+	restore := genValidBRRestores()[0]
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	restore.Spec.WarmupImages = true
+	restore.Spec.Cancel = true
+	restore.Status.RecoveryPlacement = &v1alpha1.RecoveryPlacementStatus{NodeSelector: applied, OriginalNodeSelector: original}
+	restore.Status.TaggedVolumes = []string{"vol-1", "vol-2"}
+	helper.createRestore(restore)
+
+	// the TiKV node selector is pinned by the recovery placement
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Spec.TiKV.NodeSelector = applied
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() map[string]string {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		if err != nil {
+			return nil
+		}
+		return tc.Spec.TiKV.NodeSelector
+	}, time.Second*10).Should(Equal(applied))
+
+	// the image warmup daemonset is still running
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: restore.Namespace, Name: restore.GetImageWarmupName()}}
+	_, err = deps.KubeClientset.AppsV1().DaemonSets(ds.Namespace).Create(context.TODO(), ds, metav1.CreateOptions{})
+	g.Expect(err).To(Succeed())
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCanceled, "RestoreCanceled")
+	_, err = deps.KubeClientset.AppsV1().DaemonSets(ds.Namespace).Get(context.TODO(), ds.Name, metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	tc, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Get(context.TODO(), tc.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(tc.Spec.TiKV.NodeSelector).To(Equal(original))
+
+	// the tags of the restored volumes are kept and recorded
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, cond := v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreCanceled)
+	g.Expect(cond.Message).To(ContainSubstring("image warmup daemonset %s is deleted", restore.GetImageWarmupName()))
+	g.Expect(cond.Message).To(ContainSubstring("TiKV node selector of tidbcluster"))
+	g.Expect(cond.Message).To(ContainSubstring("tags of 2 restored volumes are kept"))
+}
+
+func TestCancelRestoreNotMarkingTC(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	restore.Spec.Cancel = true
+	helper.createRestore(restore)
+
+	// the tidbcluster marked by another restore is not touched
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, true)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Annotations = map[string]string{label.AnnTiKVVolumesReadyKey: "ns/another"}
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() string {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		if err != nil {
+			return ""
+		}
+		return tc.Annotations[label.AnnTiKVVolumesReadyKey]
+	}, time.Second*10).Should(Equal("ns/another"))
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCanceled, "RestoreCanceled")
+	tc, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Get(context.TODO(), tc.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(tc.Spec.RecoveryMode).To(BeTrue())
+	g.Expect(tc.Annotations[label.AnnTiKVVolumesReadyKey]).To(Equal("ns/another"))
+}
+
+func TestCancelLightningRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.Spec.Cancel = true
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreFailed, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.GetRestorePVCName(),
+			Namespace: restore.Namespace,
+			Labels:    label.NewRestore().Instance(restore.GetInstanceName()).Restore(restore.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(restore.Spec.StorageSize),
+				},
+			},
+		},
+	}
+	_, err := deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(deps.KubeInformerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Add(pvc)).To(Succeed())
+
+	// the failed restore is still canceled to clean up the restore pvc
+	g.Expect(NeedCancel(restore)).To(BeTrue())
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCanceled, "RestoreCanceled")
+	_, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the completed restore is not canceled
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue}}
+	g.Expect(NeedCancel(restore)).To(BeFalse())
+}
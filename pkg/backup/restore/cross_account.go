@@ -0,0 +1,76 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// shareCrossAccountSnapshots shares the volume snapshots owned by the source account of CrossAccountSnapshot with
+// the target account before BR restores the volumes from them. The progress is reported by the condition
+// SnapshotsShared, which is false until all the snapshots are shared, the failed ones are shared again by the retry.
+func (rm *restoreManager) shareCrossAccountSnapshots(r *v1alpha1.Restore) (string, error) {
+	conf := r.Spec.CrossAccountSnapshot
+	if conf == nil || v1alpha1.IsRestoreSnapshotsShared(r) {
+		return "", nil
+	}
+
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
+	if err != nil {
+		return volSnapBackupMetaFailedReason(err), err
+	}
+	snapIDs := metaInfo.SnapshotIDs()
+
+	accountID := conf.TargetAccountID
+	if accountID == "" {
+		if accountID, err = backuputil.GetAWSAccountID(); err != nil {
+			return "GetAWSAccountIDFailed", err
+		}
+	}
+	concurrency := uint(backuputil.CloudAPIConcurrency)
+	if rm.deps.CLIConfig.VolumeTagConcurrency > 0 {
+		concurrency = rm.deps.CLIConfig.VolumeTagConcurrency
+	}
+	ec2Session, err := backuputil.NewEC2SessionWithRole(concurrency, conf.SourceRoleARN)
+	if err != nil {
+		return "NewEC2SessionFailed", err
+	}
+
+	klog.Infof("restore %s/%s: share %d snapshots with account %s by role %s", r.Namespace, r.Name, len(snapIDs), accountID, conf.SourceRoleARN)
+	shared, err := ec2Session.ShareSnapshots(snapIDs, accountID)
+	if err != nil {
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreSnapshotsShared,
+			Status:  corev1.ConditionFalse,
+			Reason:  "SharingSnapshots",
+			Message: fmt.Sprintf("%d of %d snapshots are shared with account %s", shared, len(snapIDs), accountID),
+		}, nil)
+		return "ShareSnapshotsFailed", err
+	}
+
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreSnapshotsShared,
+		Status:  corev1.ConditionTrue,
+		Reason:  "SnapshotsShared",
+		Message: fmt.Sprintf("all %d snapshots are shared with account %s", len(snapIDs), accountID),
+	}, nil); err != nil {
+		return "UpdateSnapshotsSharedFailed", err
+	}
+	return "", nil
+}
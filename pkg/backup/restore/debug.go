@@ -0,0 +1,50 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"strings"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// debugRestoreArgsEnv is the env keeping the original arguments of the restore container in debug mode
+	debugRestoreArgsEnv = "RESTORE_ARGS"
+)
+
+// debugRestoreJob makes the restore container of the job sleep instead of running the restore, the entrypoint
+// still prepares the credentials before running the sleep. The original arguments are kept in debugRestoreArgsEnv.
+func debugRestoreJob(job *batchv1.Job) {
+	containers := job.Spec.Template.Spec.Containers
+	for i := range containers {
+		c := &containers[i]
+		if c.Name != label.RestoreJobLabelVal {
+			continue
+		}
+		quoted := make([]string, 0, len(c.Args))
+		for _, arg := range c.Args {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		c.Env = append(c.Env, corev1.EnvVar{Name: debugRestoreArgsEnv, Value: strings.Join(quoted, " ")})
+		c.Args = []string{"sleep", "infinity"}
+	}
+}
+
+// shellQuote quotes s by single quotes so that it is kept as one word by the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// dryRunRestore runs the checks of the restore against the backup meta and the target tidbcluster,
+// and finishes the restore with condition DryRunComplete listing the checks it performed. It never creates
+// jobs, tags volumes or changes the tidbcluster. The restore spec is validated before it's called.
+func (rm *restoreManager) dryRunRestore(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if v1alpha1.IsRestoreDryRunComplete(r) {
+		return nil
+	}
+
+	checks := []string{"restore spec is valid"}
+	if r.Spec.BR != nil && r.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+		// only the checks actually performed are reported, the skipped ones and the allowed mismatches are not
+		validated, _, err := rm.validateRestoreChecks(r, tc)
+		if err != nil {
+			rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreInvalid,
+				Status:  corev1.ConditionTrue,
+				Reason:  "DryRunFailed",
+				Message: err.Error(),
+			}, nil)
+			return controller.IgnoreErrorf("restore %s/%s: dry run failed, %v", ns, name, err)
+		}
+		checks = append(checks, validated...)
+	}
+
+	klog.Infof("restore %s/%s: dry run passed", ns, name)
+	return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreDryRunComplete,
+		Status:  corev1.ConditionTrue,
+		Reason:  "DryRunPassed",
+		Message: fmt.Sprintf("dry run checked: %s", strings.Join(checks, "; ")),
+	}, nil)
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	imageWarmupComponent = "restore-warmup"
+)
+
+// startImageWarmup pre-pulls the images of the restore jobs by a DaemonSet onto the nodes which the restore pods
+// can be scheduled to, while the volumes are restored. The warmup is best effort, so failures are only reported
+// by events, and the DaemonSet is only looked up once per restore by the operator.
+func (rm *restoreManager) startImageWarmup(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) {
+	key := fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	if _, started := rm.warmupStarted.Load(key); started {
+		return
+	}
+	if _, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreImageWarmupComplete); cond != nil {
+		return
+	}
+
+	dsName := r.GetImageWarmupName()
+	_, err := rm.deps.KubeClientset.AppsV1().DaemonSets(r.Namespace).Get(context.TODO(), dsName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		ds, reason, err := rm.makeImageWarmupDaemonSet(r, tc)
+		if err != nil {
+			rm.deps.Recorder.Event(r, corev1.EventTypeWarning, reason, err.Error())
+			return
+		}
+		if _, err = rm.deps.KubeClientset.AppsV1().DaemonSets(r.Namespace).Create(context.TODO(), ds, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			err = fmt.Errorf("restore %s: create image warmup daemonset %s failed, %v", key, dsName, err)
+			rm.deps.Recorder.Event(r, corev1.EventTypeWarning, "CreateImageWarmupFailed", err.Error())
+			return
+		}
+		klog.Infof("restore %s: created daemonset %s to warm up the images", key, dsName)
+	} else if err != nil {
+		klog.Warningf("restore %s: get image warmup daemonset %s failed, %v", key, dsName, err)
+		return
+	}
+	rm.warmupStarted.Store(key, struct{}{})
+}
+
+// finishImageWarmup records how many nodes the images are pulled onto by condition ImageWarmupComplete and
+// deletes the DaemonSet once the volumes are complete. It never holds the restore back, the nodes the images
+// aren't pulled onto yet pull them when TiKV restarts.
+func (rm *restoreManager) finishImageWarmup(r *v1alpha1.Restore) {
+	key := fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	if _, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreImageWarmupComplete); cond != nil {
+		rm.warmupStarted.Delete(key)
+		return
+	}
+
+	dsName := r.GetImageWarmupName()
+	cond := &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreImageWarmupComplete,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ImageWarmupIncomplete",
+		Message: "the image warmup daemonset is not found",
+	}
+	ds, err := rm.deps.KubeClientset.AppsV1().DaemonSets(r.Namespace).Get(context.TODO(), dsName, metav1.GetOptions{})
+	if err == nil {
+		ready, desired := ds.Status.NumberReady, ds.Status.DesiredNumberScheduled
+		if ds.Status.ObservedGeneration >= ds.Generation && ready >= desired {
+			cond = &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreImageWarmupComplete,
+				Status:  corev1.ConditionTrue,
+				Message: fmt.Sprintf("images are pulled onto %d nodes", desired),
+			}
+		} else {
+			cond.Message = fmt.Sprintf("images are only pulled onto %d of %d nodes when the volumes are complete", ready, desired)
+		}
+		err = rm.deps.KubeClientset.AppsV1().DaemonSets(r.Namespace).Delete(context.TODO(), dsName, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		// the DaemonSet is owned by the restore and garbage collected with it at last
+		klog.Warningf("restore %s: clean up image warmup daemonset %s failed, %v", key, dsName, err)
+	}
+	if err := rm.statusUpdater.Update(r, cond, nil); err != nil {
+		klog.Warningf("restore %s: update condition %s failed, %v", key, v1alpha1.RestoreImageWarmupComplete, err)
+		return
+	}
+	rm.warmupStarted.Delete(key)
+}
+
+// cleanupImageWarmup deletes the image warmup DaemonSet of the restore failed or canceled before the volumes are
+// complete, so its pods don't keep sleeping on every node until the restore is deleted. It returns whether the
+// DaemonSet is deleted.
+func (rm *restoreManager) cleanupImageWarmup(r *v1alpha1.Restore) (bool, error) {
+	if !r.Spec.WarmupImages {
+		return false, nil
+	}
+	key := fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	rm.warmupStarted.Delete(key)
+	dsName := r.GetImageWarmupName()
+	err := rm.deps.KubeClientset.AppsV1().DaemonSets(r.Namespace).Delete(context.TODO(), dsName, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("restore %s: delete image warmup daemonset %s failed, %v", key, dsName, err)
+	}
+	klog.Infof("restore %s: deleted image warmup daemonset %s", key, dsName)
+	return true, nil
+}
+
+// NeedImageWarmupCleanup returns whether the image warmup DaemonSet of the failed or invalid volume snapshot
+// restore may be left, the restore is synced once more to delete it.
+func NeedImageWarmupCleanup(r *v1alpha1.Restore) bool {
+	if !r.Spec.WarmupImages || r.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot || r.DeletionTimestamp != nil {
+		return false
+	}
+	if !v1alpha1.IsRestoreFailed(r) && !v1alpha1.IsRestoreInvalid(r) {
+		return false
+	}
+	_, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreImageWarmupComplete)
+	return cond == nil
+}
+
+// cleanupFailedImageWarmup deletes the image warmup DaemonSet of the failed or invalid restore, and records
+// it by condition ImageWarmupComplete so the restore is not synced again for it.
+func (rm *restoreManager) cleanupFailedImageWarmup(r *v1alpha1.Restore) error {
+	deleted, err := rm.cleanupImageWarmup(r)
+	if err != nil {
+		return err
+	}
+	msg := "the image warmup daemonset is not found"
+	if deleted {
+		msg = fmt.Sprintf("the image warmup daemonset %s is deleted", r.GetImageWarmupName())
+	}
+	return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreImageWarmupComplete,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ImageWarmupAborted",
+		Message: fmt.Sprintf("%s after the restore %s", msg, strings.ToLower(string(r.Status.Phase))),
+	}, nil)
+}
+
+// makeImageWarmupDaemonSet makes the DaemonSet pulling the backup manager image and the BR image, its pods
+// are scheduled like the restore pods and keep sleeping after the images are pulled.
+func (rm *restoreManager) makeImageWarmupDaemonSet(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (*appsv1.DaemonSet, string, error) {
+	var initContainers []corev1.Container
+	if !r.Spec.BundledBR {
+		brImage := restoreBRImage(r, tc.TiKVImage())
+		if err := backuputil.ValidateImage(brImage); err != nil {
+			return nil, "InvalidBRImage", fmt.Errorf("restore %s/%s: %v", r.Namespace, r.Name, err)
+		}
+		initContainers = append(initContainers, corev1.Container{
+			Name:            "br",
+			Image:           brImage,
+			Command:         []string{"/bin/sh", "-c", "echo 'BR image pulled'"},
+			ImagePullPolicy: r.GetImagePullPolicy(),
+		})
+	}
+
+	labels := label.NewRestore().Instance(r.GetInstanceName()).Component(imageWarmupComponent).Restore(r.Name).Labels()
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.GetImageWarmupName(),
+			Namespace: r.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				controller.GetRestoreOwnerRef(r),
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					SecurityContext: r.Spec.PodSecurityContext,
+					InitContainers:  initContainers,
+					Containers: []corev1.Container{
+						{
+							Name:            "backup-manager",
+							Image:           rm.backupManagerImage(r),
+							Command:         []string{"sleep", "infinity"},
+							ImagePullPolicy: r.GetImagePullPolicy(),
+						},
+					},
+					TerminationGracePeriodSeconds: pointer.Int64Ptr(1),
+					Tolerations:                   r.Spec.Tolerations,
+					ImagePullSecrets:              r.Spec.ImagePullSecrets,
+					Affinity:                      r.Spec.Affinity,
+					NodeSelector:                  r.Spec.NodeSelector,
+					PriorityClassName:             r.Spec.PriorityClassName,
+				},
+			},
+		},
+	}
+	return ds, "", nil
+}
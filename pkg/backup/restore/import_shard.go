@@ -0,0 +1,53 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+// importShardIndexEnv is the env of the import container set to the completion index of its pod
+const importShardIndexEnv = "JOB_COMPLETION_INDEX"
+
+// shardImportJob makes the import job run a pod for each shard of the tables with the import parallelism.
+// The job is indexed, each pod imports the shard of its completion index, and the job completes after the
+// pods of all the indexes succeed.
+func shardImportJob(restore *v1alpha1.Restore, job *batchv1.Job) {
+	parallelism := restore.GetImportParallelism()
+	if parallelism <= 1 {
+		return
+	}
+	completionMode := batchv1.IndexedCompletion
+	job.Spec.CompletionMode = &completionMode
+	job.Spec.Completions = pointer.Int32Ptr(parallelism)
+	job.Spec.Parallelism = pointer.Int32Ptr(parallelism)
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name: importShardIndexEnv,
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: fmt.Sprintf("metadata.annotations['%s']", batchv1.JobCompletionIndexAnnotation),
+			},
+		},
+	})
+	container.Args = append(container.Args,
+		fmt.Sprintf("--shard-index=$(%s)", importShardIndexEnv),
+		fmt.Sprintf("--shard-total=%d", parallelism))
+}
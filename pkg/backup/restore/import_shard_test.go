@@ -0,0 +1,51 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestShardImportJob(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	newJob := func() *batchv1.Job {
+		job := &batchv1.Job{}
+		job.Spec.Template.Spec.Containers = []corev1.Container{{Args: []string{"import"}}}
+		return job
+	}
+
+	// the import is not sharded by default
+	restore := &v1alpha1.Restore{}
+	job := newJob()
+	shardImportJob(restore, job)
+	g.Expect(job).To(Equal(newJob()))
+
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(4)
+	shardImportJob(restore, job)
+	g.Expect(*job.Spec.CompletionMode).To(Equal(batchv1.IndexedCompletion))
+	g.Expect(*job.Spec.Completions).To(Equal(int32(4)))
+	g.Expect(*job.Spec.Parallelism).To(Equal(int32(4)))
+	container := job.Spec.Template.Spec.Containers[0]
+	g.Expect(container.Args).To(Equal([]string{"import", "--shard-index=$(JOB_COMPLETION_INDEX)", "--shard-total=4"}))
+	g.Expect(container.Env).To(HaveLen(1))
+	g.Expect(container.Env[0].Name).To(Equal(importShardIndexEnv))
+	g.Expect(container.Env[0].ValueFrom.FieldRef.FieldPath).To(Equal("metadata.annotations['batch.kubernetes.io/job-completion-index']"))
+}
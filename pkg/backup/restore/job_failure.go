@@ -0,0 +1,160 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// jobNameLabelKey is the label set by the job controller on the pods of a job
+	jobNameLabelKey = "job-name"
+
+	// podLogTailLines and podLogTailBytes bound the tail of the logs of the failed container put in the condition
+	podLogTailLines int64 = 10
+	podLogTailBytes       = 1024
+	// podLogTimeout bounds reading the logs of the failed container
+	podLogTimeout = 10 * time.Second
+)
+
+// syncRestoreJobFailure reports the failed pods of the restore job that is already created, so a pod crashing
+// without the backup-manager reporting it, e.g. OOMKilled, is described in the status. The restore is failed
+// if the job has failed, otherwise the failed pod is retried by the job and reported by RetryFailed.
+func (rm *restoreManager) syncRestoreJobFailure(r *v1alpha1.Restore, job *batchv1.Job) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if v1alpha1.IsRestoreComplete(r) || v1alpha1.IsRestoreFailed(r) || (job.Status.Failed == 0 && jobFailedCondition(job) == nil) {
+		return nil
+	}
+
+	pod, err := rm.lastFailedJobPod(job)
+	if err != nil {
+		return fmt.Errorf("restore %s/%s: list the pods of job %s/%s failed, err: %v", ns, name, job.Namespace, job.Name, err)
+	}
+	message := fmt.Sprintf("job %s has %d failed pods", job.Name, job.Status.Failed)
+	if pod != nil {
+		message = fmt.Sprintf("%s, the last one: %s", message, describePodFailure(rm.deps.KubeClientset, pod))
+	}
+
+	if c := jobFailedCondition(job); c != nil {
+		err := fmt.Errorf("job %s failed, reason: %s, %s", job.Name, c.Reason, message)
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "RestoreJobFailed",
+			Message: err.Error(),
+		}, nil)
+		return controller.IgnoreErrorf("restore %s/%s: %v", ns, name, err)
+	}
+
+	klog.Infof("restore %s/%s: %s, retried by the job", ns, name, message)
+	return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreRetryFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "RestoreJobPodFailed",
+		Message: message,
+	}, nil)
+}
+
+// lastFailedJobPod returns the failed pod of the job which started last, it's nil if the failed pods are
+// already deleted
+func (rm *restoreManager) lastFailedJobPod(job *batchv1.Job) (*corev1.Pod, error) {
+	sel := labels.SelectorFromSet(labels.Set{jobNameLabelKey: job.Name})
+	pods, err := rm.deps.PodLister.Pods(job.Namespace).List(sel)
+	if err != nil {
+		return nil, err
+	}
+	var last *corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodFailed {
+			continue
+		}
+		if last == nil || last.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			last = pod
+		}
+	}
+	return last, nil
+}
+
+// DescribePodStatus describes why the pod failed by the termination reason and exit code of its failed
+// container, or by the reason of the pod if no container failed, e.g. the pod is evicted. It only reads the
+// status of the pod, so it's cheap enough for the informer handlers.
+func DescribePodStatus(pod *corev1.Pod) string {
+	status, terminated := failedContainer(pod)
+	if status == nil {
+		return fmt.Sprintf("pod %s failed with reason %s, message: %s", pod.Name, pod.Status.Reason, pod.Status.Message)
+	}
+	desc := fmt.Sprintf("pod %s container %s terminated with reason %s and exit code %d", pod.Name, status.Name, terminated.Reason, terminated.ExitCode)
+	if terminated.Message != "" {
+		desc = fmt.Sprintf("%s, message: %s", desc, terminated.Message)
+	}
+	return desc
+}
+
+// describePodFailure describes the failed pod as DescribePodStatus does, with the tail of the logs of its
+// failed container. It reads the logs from the API server, so it's only called in the sync of the restore.
+func describePodFailure(kubeCli kubernetes.Interface, pod *corev1.Pod) string {
+	desc := DescribePodStatus(pod)
+	if status, _ := failedContainer(pod); status != nil {
+		if logs := podLogTail(kubeCli, pod, status.Name); logs != "" {
+			desc = fmt.Sprintf("%s, last logs: %s", desc, logs)
+		}
+	}
+	return desc
+}
+
+// failedContainer returns the first container of the pod, the init containers first, which terminated with
+// a non-zero exit code, and its termination state. It's nil if no container failed.
+func failedContainer(pod *corev1.Pod) (*corev1.ContainerStatus, *corev1.ContainerStateTerminated) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		terminated := statuses[i].State.Terminated
+		if terminated == nil || terminated.ExitCode == 0 {
+			terminated = statuses[i].LastTerminationState.Terminated
+		}
+		if terminated != nil && terminated.ExitCode != 0 {
+			return &statuses[i], terminated
+		}
+	}
+	return nil, nil
+}
+
+// podLogTail returns the tail of the logs of the container, it's empty if the logs can't be read, the
+// description of the failure is still useful without them
+func podLogTail(kubeCli kubernetes.Interface, pod *corev1.Pod, container string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), podLogTimeout)
+	defer cancel()
+	logs, err := kubeCli.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container:  container,
+		TailLines:  pointer.Int64Ptr(podLogTailLines),
+		LimitBytes: pointer.Int64Ptr(podLogTailBytes),
+	}).DoRaw(ctx)
+	if err != nil {
+		klog.Warningf("read the logs of pod %s/%s container %s failed, %v", pod.Namespace, pod.Name, container, err)
+		return ""
+	}
+	return strings.TrimSpace(string(logs))
+}
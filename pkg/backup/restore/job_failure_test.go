@@ -0,0 +1,109 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncRestoreJobFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: restore.Namespace, Name: restore.GetRestoreJobName()},
+	}
+	m := NewRestoreManager(deps).(*restoreManager)
+	// the job without failed pods is not reported
+	g.Expect(m.syncRestoreJobFailure(restore, job)).To(Succeed())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, condition := v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreRetryFailed)
+	g.Expect(condition).To(BeNil())
+
+	// the failed pod retried by the job is reported with the termination of its container
+	podIndexer := deps.KubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+	g.Expect(podIndexer.Add(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: restore.Namespace,
+			Name:      "restore-pod",
+			Labels:    map[string]string{jobNameLabelKey: job.Name},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "restore",
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137},
+				},
+			}},
+		},
+	})).To(Succeed())
+	job.Status.Failed = 1
+	g.Expect(m.syncRestoreJobFailure(restore, job)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreRetryFailed, "RestoreJobPodFailed")
+	get, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, condition = v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreRetryFailed)
+	g.Expect(condition.Message).To(ContainSubstring("container restore terminated with reason OOMKilled and exit code 137"))
+	g.Expect(condition.Message).To(ContainSubstring("last logs: fake logs"))
+
+	// the failed job fails the restore
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	err = m.syncRestoreJobFailure(restore, job)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "RestoreJobFailed")
+}
+
+func TestDescribePodFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+
+	// the pod without a failed container is described by its reason
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "evicted"},
+		Status: corev1.PodStatus{
+			Phase:   corev1.PodFailed,
+			Reason:  "Evicted",
+			Message: "The node was low on resource: ephemeral-storage.",
+		},
+	}
+	g.Expect(DescribePodStatus(pod)).To(Equal("pod evicted failed with reason Evicted, message: The node was low on resource: ephemeral-storage."))
+	g.Expect(describePodFailure(helper.Deps.KubeClientset, pod)).To(Equal(DescribePodStatus(pod)))
+
+	// the failed init container is described by its last termination
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name: "br",
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1, Message: "copy br failed"},
+		},
+	}}
+	g.Expect(DescribePodStatus(pod)).To(Equal("pod evicted container br terminated with reason Error and exit code 1, message: copy br failed"))
+	g.Expect(describePodFailure(helper.Deps.KubeClientset, pod)).To(HavePrefix(DescribePodStatus(pod)))
+}
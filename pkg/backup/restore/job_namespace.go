@@ -0,0 +1,125 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/util/slice"
+)
+
+// isCrossNamespaceJob returns true if the restore job is created in another namespace than the restore,
+// such a job can't be owned by the restore
+func isCrossNamespaceJob(r *v1alpha1.Restore) bool {
+	return r.GetRestoreJobNamespace() != r.GetNamespace()
+}
+
+// restoreJobOwnerRefs returns the owner references of the restore job, the job in another namespace
+// is cleaned up by the finalizer of the restore instead
+func restoreJobOwnerRefs(r *v1alpha1.Restore) []metav1.OwnerReference {
+	if isCrossNamespaceJob(r) {
+		return nil
+	}
+	return []metav1.OwnerReference{controller.GetRestoreOwnerRef(r)}
+}
+
+// needJobCleanupFinalizer returns true if the restore has jobs not owned by it, which are the restore job in
+// another namespace and the volume rehearsal jobs
+func needJobCleanupFinalizer(r *v1alpha1.Restore) bool {
+	return isCrossNamespaceJob(r) || r.Spec.VolumeRehearsal
+}
+
+// addJobCleanupFinalizer adds the finalizer deleting the jobs not owned by the restore to the restore,
+// it must be added before the jobs are created so that the jobs are never leaked
+func (rm *restoreManager) addJobCleanupFinalizer(r *v1alpha1.Restore) error {
+	if !needJobCleanupFinalizer(r) || slice.ContainsString(r.Finalizers, label.RestoreJobCleanupFinalizer, nil) {
+		return nil
+	}
+	ns := r.GetNamespace()
+	name := r.GetName()
+	r.Finalizers = append(r.Finalizers, label.RestoreJobCleanupFinalizer)
+	updated, err := rm.deps.Clientset.PingcapV1alpha1().Restores(ns).Update(context.TODO(), r, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("add restore %s/%s job cleanup finalizer failed, err: %v", ns, name, err)
+	}
+	r.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// isJobCleanupCandidate returns true if the restore is being deleted and its jobs not owned by it
+// are not cleaned up yet
+func isJobCleanupCandidate(r *v1alpha1.Restore) bool {
+	return r.DeletionTimestamp != nil && slice.ContainsString(r.Finalizers, label.RestoreJobCleanupFinalizer, nil)
+}
+
+// cleanupCrossNamespaceJobs deletes the jobs of the deleted restore in the job namespace, including the
+// post restore hook job, and the volume rehearsal jobs in the namespace of the tidb cluster, then removes
+// the finalizer so that the restore can be deleted
+func (rm *restoreManager) cleanupCrossNamespaceJobs(r *v1alpha1.Restore) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+
+	namespaces, _, err := rm.deleteRestoreJobs(r)
+	if err != nil {
+		return err
+	}
+
+	r.Finalizers = slice.RemoveString(r.Finalizers, label.RestoreJobCleanupFinalizer, nil)
+	if _, err := rm.deps.Clientset.PingcapV1alpha1().Restores(ns).Update(context.TODO(), r, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("remove restore %s/%s job cleanup finalizer failed, err: %v", ns, name, err)
+	}
+	klog.Infof("restore %s/%s jobs in namespaces %v are cleaned up", ns, name, namespaces)
+	return nil
+}
+
+// deleteRestoreJobs deletes the jobs of the restore in the job namespace and the namespace of the tidb cluster,
+// it returns the namespaces and the number of the jobs which are not gone yet, including the ones being deleted
+func (rm *restoreManager) deleteRestoreJobs(r *v1alpha1.Restore) ([]string, int, error) {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	jobNS := r.GetRestoreJobNamespace()
+
+	sel, err := label.NewRestore().Instance(r.GetInstanceName()).Restore(name).Selector()
+	if err != nil {
+		return nil, 0, fmt.Errorf("restore %s/%s build job selector failed, err: %v", ns, name, err)
+	}
+	namespaces := []string{jobNS}
+	if r.Spec.BR != nil && r.Spec.BR.ClusterNamespace != "" && r.Spec.BR.ClusterNamespace != jobNS {
+		namespaces = append(namespaces, r.Spec.BR.ClusterNamespace)
+	}
+	remaining := 0
+	for _, jobNS := range namespaces {
+		jobs, err := rm.deps.JobLister.Jobs(jobNS).List(sel)
+		if err != nil {
+			return nil, 0, fmt.Errorf("restore %s/%s list jobs in namespace %s failed, err: %v", ns, name, jobNS, err)
+		}
+		remaining += len(jobs)
+		for _, job := range jobs {
+			if job.DeletionTimestamp != nil {
+				continue
+			}
+			if err := rm.deps.JobControl.DeleteJob(r, job); err != nil && !errors.IsNotFound(err) {
+				return nil, 0, fmt.Errorf("restore %s/%s delete job %s/%s failed, err: %v", ns, name, jobNS, job.Name, err)
+			}
+		}
+	}
+	return namespaces, remaining, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// jobCompleteCondition returns the Complete condition of the job, it's nil if the job is not complete
+func jobCompleteCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		c := &job.Status.Conditions[i]
+		if c.Type == batchv1.JobComplete && c.Status == corev1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
+
+// syncRestoreJobStatus observes the restore job that is already created. The restore is re-synced by the job
+// events, which may be missed, so the restore is requeued with the jittered backoff of the controller until
+// the job finishes. The failed job fails the restore, and the complete job completes the restore if the
+// backup-manager didn't report it, e.g. the import sharded across the pods of the job.
+func (rm *restoreManager) syncRestoreJobStatus(r *v1alpha1.Restore, job *batchv1.Job) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if v1alpha1.IsRestoreComplete(r) || v1alpha1.IsRestoreFailed(r) {
+		return nil
+	}
+	if err := rm.syncRestoreJobFailure(r, job); err != nil {
+		return err
+	}
+
+	if c := jobCompleteCondition(job); c != nil {
+		// the volume snapshot restore goes on by the conditions of its phases reported by the backup-manager,
+		// the job of a phase being complete doesn't mean the restore is complete
+		if r.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+			return nil
+		}
+		klog.Infof("restore %s/%s: job %s/%s is complete but the restore is not, complete the restore", ns, name, job.Namespace, job.Name)
+		return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreComplete,
+			Status:  corev1.ConditionTrue,
+			Reason:  "RestoreJobComplete",
+			Message: fmt.Sprintf("job %s is complete", job.Name),
+		}, &controller.RestoreUpdateStatus{
+			TimeStarted:   job.Status.StartTime,
+			TimeCompleted: job.Status.CompletionTime,
+		})
+	}
+	return controller.RequeueErrorf("restore %s/%s: job %s/%s is running", ns, name, job.Namespace, job.Name)
+}
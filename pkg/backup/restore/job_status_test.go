@@ -0,0 +1,90 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncRestoreJobStatus(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: restore.Namespace, Name: restore.GetRestoreJobName()},
+		Status:     batchv1.JobStatus{Active: 1},
+	}
+	m := NewRestoreManager(deps).(*restoreManager)
+	// the restore is polled while the job is running
+	err := m.syncRestoreJobStatus(restore, job)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+
+	// the complete job of a volume snapshot restore phase doesn't complete the restore
+	completionTime := metav1.Now()
+	job.Status = batchv1.JobStatus{
+		Succeeded:      1,
+		CompletionTime: &completionTime,
+		Conditions:     []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+	}
+	volumeRestore := restore.DeepCopy()
+	volumeRestore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	g.Expect(m.syncRestoreJobStatus(volumeRestore, job)).To(Succeed())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(v1alpha1.IsRestoreComplete(get)).To(BeFalse())
+
+	// the complete job completes the restore not reported by the backup-manager
+	g.Expect(m.syncRestoreJobStatus(restore, job)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreComplete, "RestoreJobComplete")
+	get, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(get.Status.TimeCompleted.Unix()).To(Equal(completionTime.Unix()))
+	g.Expect(m.syncRestoreJobStatus(get, job)).To(Succeed())
+}
+
+func TestSyncRestoreJobStatusFailed(t *testing.T) {
+	helper := newHelper(t)
+	defer helper.Close()
+	g := NewGomegaWithT(t)
+
+	restore := genValidBRRestores()[0]
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+
+	// the job failed by the deadline has no failed pods
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: restore.Namespace, Name: restore.GetRestoreJobName()},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}},
+		},
+	}
+	m := NewRestoreManager(helper.Deps).(*restoreManager)
+	err := m.syncRestoreJobStatus(restore, job)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "RestoreJobFailed")
+}
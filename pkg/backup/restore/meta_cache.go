@@ -0,0 +1,111 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// restorePhasesMaxEntries is the max number of the restores whose last phase is remembered
+	restorePhasesMaxEntries = 1024
+	// restorePhaseTTL is how long the last phase of a restore is remembered since its last reconcile,
+	// the cached files of a restore forgotten are invalidated on its next reconcile
+	restorePhaseTTL = 24 * time.Hour
+)
+
+// restoreMetaCache caches the backup meta and the restore meta read by the restores, so that the reconciles
+// waiting for the volumes or the jobs don't download them again and again. The cached files of a restore
+// are dropped when the phase of the restore changes, since BR may rewrite them in the next phase, or when
+// the restore is deleted.
+type restoreMetaCache struct {
+	*backuputil.MetaCache
+
+	phases *utilcache.LRUExpireCache
+}
+
+func newRestoreMetaCache() *restoreMetaCache {
+	return &restoreMetaCache{
+		MetaCache: backuputil.NewMetaCache(),
+		phases:    utilcache.NewLRUExpireCache(restorePhasesMaxEntries),
+	}
+}
+
+// syncPhase invalidates the cached files under the storage of the restore if its phase changes since the last
+// reconcile, a finished restore is forgotten.
+func (c *restoreMetaCache) syncPhase(r *v1alpha1.Restore) {
+	key := r.Namespace + "/" + r.Name
+	phase := r.Status.Phase
+
+	var lastPhase v1alpha1.RestoreConditionType
+	cached, ok := c.phases.Get(key)
+	if ok {
+		lastPhase = cached.(v1alpha1.RestoreConditionType)
+	}
+	if phase == v1alpha1.RestoreComplete || phase == v1alpha1.RestoreFailed || phase == v1alpha1.RestoreCanceled {
+		c.phases.Remove(key)
+	} else {
+		c.phases.Add(key, phase, restorePhaseTTL)
+	}
+
+	if ok && lastPhase == phase {
+		return
+	}
+	klog.V(4).Infof("restore %s phase changes from %q to %q, invalidate the meta cache", key, lastPhase, phase)
+	c.invalidate(r)
+}
+
+// forget drops the last phase and the cached files of the deleted restore
+func (c *restoreMetaCache) forget(r *v1alpha1.Restore) {
+	c.phases.Remove(r.Namespace + "/" + r.Name)
+	c.invalidate(r)
+}
+
+// deleteRestore is the handler of the restore informer forgetting the deleted restore
+func (c *restoreMetaCache) deleteRestore(obj interface{}) {
+	r, ok := obj.(*v1alpha1.Restore)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("couldn't get object from tombstone %+v", obj))
+			return
+		}
+		r, ok = tombstone.Obj.(*v1alpha1.Restore)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a restore %+v", obj))
+			return
+		}
+	}
+	c.forget(r)
+}
+
+// invalidate drops the cached files under the storages of the restore
+func (c *restoreMetaCache) invalidate(r *v1alpha1.Restore) {
+	providers, _ := backuputil.RestoreStorageProviders(r)
+	for _, provider := range providers {
+		storagePath, err := backuputil.GetStoragePath(provider)
+		if err != nil {
+			continue
+		}
+		c.Invalidate(storagePath)
+	}
+}
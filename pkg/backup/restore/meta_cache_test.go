@@ -0,0 +1,53 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestRestoreMetaCachePhases(t *testing.T) {
+	g := NewGomegaWithT(t)
+	c := newRestoreMetaCache()
+	restore := genValidBRRestores()[0]
+	key := restore.Namespace + "/" + restore.Name
+
+	restore.Status.Phase = v1alpha1.RestoreRunning
+	c.syncPhase(restore)
+	phase, ok := c.phases.Get(key)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(phase).To(Equal(v1alpha1.RestoreRunning))
+
+	// a finished restore is forgotten
+	restore.Status.Phase = v1alpha1.RestoreComplete
+	c.syncPhase(restore)
+	_, ok = c.phases.Get(key)
+	g.Expect(ok).To(BeFalse())
+
+	// a deleted restore is forgotten, including the one in a tombstone
+	restore.Status.Phase = v1alpha1.RestoreRunning
+	c.syncPhase(restore)
+	c.deleteRestore(restore)
+	_, ok = c.phases.Get(key)
+	g.Expect(ok).To(BeFalse())
+
+	c.syncPhase(restore)
+	c.deleteRestore(cache.DeletedFinalStateUnknown{Key: key, Obj: restore})
+	_, ok = c.phases.Get(key)
+	g.Expect(ok).To(BeFalse())
+}
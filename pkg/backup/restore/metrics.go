@@ -0,0 +1,100 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/metrics"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// restoreMetricsModeImport is the mode label of the restores by lightning
+	restoreMetricsModeImport = "import"
+
+	restoreResultComplete = "complete"
+	restoreResultFailed   = "failed"
+	restoreResultInvalid  = "invalid"
+	restoreResultCanceled = "canceled"
+)
+
+// restoreMetricsModes are the values of the mode label, the gauge of every mode is always exported
+var restoreMetricsModes = []string{
+	string(v1alpha1.RestoreModeSnapshot),
+	string(v1alpha1.RestoreModePiTR),
+	string(v1alpha1.RestoreModeVolumeSnapshot),
+	restoreMetricsModeImport,
+}
+
+// restoreMetricsMode returns the mode label of the restore, the restores by lightning are labeled as import
+// whatever their mode is, since they share the cost profile of lightning
+func restoreMetricsMode(r *v1alpha1.Restore) string {
+	if r.Spec.BR == nil {
+		return restoreMetricsModeImport
+	}
+	if r.Spec.Mode == "" {
+		return string(v1alpha1.RestoreModeSnapshot)
+	}
+	return string(r.Spec.Mode)
+}
+
+// restoreResult returns the result label of the finished restore, it's empty if the restore is not finished
+func restoreResult(r *v1alpha1.Restore) string {
+	switch {
+	case v1alpha1.IsRestoreCanceled(r):
+		return restoreResultCanceled
+	case v1alpha1.IsRestoreInvalid(r):
+		return restoreResultInvalid
+	case v1alpha1.IsRestoreFailed(r):
+		return restoreResultFailed
+	case v1alpha1.IsRestoreComplete(r):
+		return restoreResultComplete
+	}
+	return ""
+}
+
+// RecordRestoreFinished updates the metrics of the finished restores if the restore is finished by the update
+// from old to cur. The update without the transition, like the resync of the informer, is not counted.
+func RecordRestoreFinished(old, cur *v1alpha1.Restore) {
+	result := restoreResult(cur)
+	if result == "" || restoreResult(old) != "" {
+		return
+	}
+	mode := restoreMetricsMode(cur)
+	metrics.RestoreTotal.WithLabelValues(mode, result).Inc()
+	if result != restoreResultComplete || cur.Status.TimeStarted.IsZero() || cur.Status.TimeCompleted.IsZero() {
+		return
+	}
+	duration := cur.Status.TimeCompleted.Sub(cur.Status.TimeStarted.Time)
+	metrics.RestoreDurationSeconds.WithLabelValues(mode).Observe(duration.Seconds())
+}
+
+// UpdateInFlightRestoresMetrics updates the number of the in-flight restores of every mode
+func UpdateInFlightRestoresMetrics(lister listers.RestoreLister) error {
+	restores, err := lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	inFlight := make(map[string]int, len(restoreMetricsModes))
+	for _, r := range restores {
+		if isRestoreActive(r) {
+			inFlight[restoreMetricsMode(r)]++
+		}
+	}
+	for _, mode := range restoreMetricsModes {
+		metrics.RestoreInFlight.WithLabelValues(mode).Set(float64(inFlight[mode]))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordRestoreFinished(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	old := genValidBRRestores()[0]
+	old.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	old.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue}}
+	cur := old.DeepCopy()
+	cur.Status.TimeStarted = metav1.NewTime(time.Now().Add(-time.Hour))
+	cur.Status.TimeCompleted = metav1.Now()
+	cur.Status.Conditions = append(cur.Status.Conditions, v1alpha1.RestoreCondition{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue})
+
+	total := metrics.RestoreTotal.WithLabelValues("volume-snapshot", "complete")
+	before := testutil.ToFloat64(total)
+	RecordRestoreFinished(old, cur)
+	g.Expect(testutil.ToFloat64(total)).To(Equal(before + 1))
+
+	// the resync of the finished restore is not counted again
+	RecordRestoreFinished(cur, cur)
+	g.Expect(testutil.ToFloat64(total)).To(Equal(before + 1))
+
+	// the restore by lightning is labeled as import
+	lightning := validDumpRestore.DeepCopy()
+	g.Expect(restoreMetricsMode(lightning)).To(Equal("import"))
+	lightning.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreFailed, Status: corev1.ConditionTrue}}
+	failed := metrics.RestoreTotal.WithLabelValues("import", "failed")
+	before = testutil.ToFloat64(failed)
+	RecordRestoreFinished(validDumpRestore, lightning)
+	g.Expect(testutil.ToFloat64(failed)).To(Equal(before + 1))
+}
+
+func TestUpdateInFlightRestoresMetrics(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restores := genValidBRRestores()
+	restores[0].Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreScheduled, Status: corev1.ConditionTrue}}
+	restores[1].Status.Conditions = []v1alpha1.RestoreCondition{
+		{Type: v1alpha1.RestoreScheduled, Status: corev1.ConditionTrue},
+		{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue},
+	}
+	indexer := deps.InformerFactory.Pingcap().V1alpha1().Restores().Informer().GetIndexer()
+	g.Expect(indexer.Add(restores[0])).To(Succeed())
+	g.Expect(indexer.Add(restores[1])).To(Succeed())
+
+	g.Expect(UpdateInFlightRestoresMetrics(deps.RestoreLister)).To(Succeed())
+	g.Expect(testutil.ToFloat64(metrics.RestoreInFlight.WithLabelValues(restoreMetricsMode(restores[0])))).To(Equal(float64(1)))
+	g.Expect(testutil.ToFloat64(metrics.RestoreInFlight.WithLabelValues("import"))).To(Equal(float64(0)))
+}
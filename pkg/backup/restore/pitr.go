@@ -0,0 +1,129 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/apis/util/config"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// pitrLogRestoreSteps are the progress steps reported by BR when it restores the log backup of a PiTR restore,
+// the full backup is restored before them.
+var pitrLogRestoreSteps = map[string]struct{}{
+	"Restore Meta Files": {},
+	"Restore KV Files":   {},
+}
+
+// pitrPhase returns the phase of a PiTR restore according to the progress reported by BR
+func pitrPhase(r *v1alpha1.Restore) v1alpha1.RestorePiTRPhase {
+	for _, p := range r.Status.Progresses {
+		if _, ok := pitrLogRestoreSteps[p.Step]; ok {
+			return v1alpha1.RestorePiTRLogRestore
+		}
+	}
+	return v1alpha1.RestorePiTRFullRestore
+}
+
+// PiTRPhaseChanged returns true if the progress reported by BR moves the PiTR restore to another phase than
+// the one recorded in the status
+func PiTRPhaseChanged(r *v1alpha1.Restore) bool {
+	return r.Status.PiTRPhase != pitrPhase(r)
+}
+
+// jobFailedCondition returns the Failed condition of the job if it has failed
+func jobFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		c := &job.Status.Conditions[i]
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
+
+// syncPiTRRestoreJob observes the job of a PiTR restore that is already created, it's also how a restarted
+// controller picks up a PiTR restore in progress. The phase of the restore is recorded in the status, and
+// the restore is failed if the job has failed without the backup-manager reporting it.
+func (rm *restoreManager) syncPiTRRestoreJob(r *v1alpha1.Restore, job *batchv1.Job) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if v1alpha1.IsRestoreComplete(r) || v1alpha1.IsRestoreFailed(r) {
+		return nil
+	}
+
+	phase := pitrPhase(r)
+	if c := jobFailedCondition(job); c != nil {
+		err := fmt.Errorf("job %s failed in PiTR phase %s, reason: %s, message: %s", job.Name, phase, c.Reason, c.Message)
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "PiTRJobFailed",
+			Message: err.Error(),
+		}, &controller.RestoreUpdateStatus{
+			PiTRPhase: &phase,
+		})
+		return controller.IgnoreErrorf("restore %s/%s: %v", ns, name, err)
+	}
+
+	if r.Status.PiTRPhase == phase {
+		return nil
+	}
+	klog.Infof("restore %s/%s: PiTR phase moves from %q to %q, restoring to %s", ns, name, r.Status.PiTRPhase, phase, r.Spec.PitrRestoredTs)
+	return rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+		PiTRPhase: &phase,
+	})
+}
+
+// validatePiTRRestoredTs checks whether the PitrRestoredTs is within the range the backups can restore to,
+// which starts from the end of the full backup and ends at the global checkpoint of the log backup.
+// An empty PitrRestoredTs restores to the latest and is not checked.
+func (rm *restoreManager) validatePiTRRestoredTs(r *v1alpha1.Restore) (string, error) {
+	if r.Spec.PitrRestoredTs == "" {
+		return "", nil
+	}
+	restoredTs, err := config.ParseTSString(r.Spec.PitrRestoredTs)
+	if err != nil {
+		return invalidPitrTimestampReason, err
+	}
+
+	if backuputil.GetStorageType(r.Spec.PitrFullBackupStorageProvider) != v1alpha1.BackupStorageTypeUnknown {
+		backupMeta, err := backuputil.GetBRBackupMetaData(r.Spec.PitrFullBackupStorageProvider, rm.storageCredential(r, r.Spec.PitrFullBackupStorageProvider), rm.metaCache.MetaCache, backuputil.GetMetaReadTimeout(r))
+		if err != nil {
+			return "GetBRBackupMetaDataFailed", err
+		}
+		if restoredTs < backupMeta.EndVersion {
+			return invalidPitrTimestampReason, fmt.Errorf("pitrRestoredTs %s (%d) is before the full backup ends at %d", r.Spec.PitrRestoredTs, restoredTs, backupMeta.EndVersion)
+		}
+	}
+
+	checkpoint, err := backuputil.GetLogBackupCheckpointTs(r.Spec.StorageProvider, rm.storageCredential(r, r.Spec.StorageProvider))
+	if err != nil {
+		return "GetLogBackupCheckpointFailed", err
+	}
+	if checkpoint == 0 {
+		klog.Infof("restore %s/%s: no checkpoint is found in the log backup, skip checking the upper bound of pitrRestoredTs", r.Namespace, r.Name)
+		return "", nil
+	}
+	if restoredTs > checkpoint {
+		return invalidPitrTimestampReason, fmt.Errorf("pitrRestoredTs %s (%d) is after the checkpoint %d of the log backup", r.Spec.PitrRestoredTs, restoredTs, checkpoint)
+	}
+	return "", nil
+}
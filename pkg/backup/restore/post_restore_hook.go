@@ -0,0 +1,194 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"github.com/pingcap/tidb-operator/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	postRestoreHookComponent = "restore-hook"
+	postRestoreHookFailed    = "PostRestoreHookFailed"
+
+	// postRestoreHookMinTTLSeconds is the minimum TTL of the finished hook job, so that its result is observed
+	// before it's deleted, otherwise the hook would be run again
+	postRestoreHookMinTTLSeconds int32 = 300
+)
+
+// syncPostRestoreHook runs the post restore hook by a job after the restore completes, and records the result
+// in condition PostHookComplete. The failure of the hook is reported and doesn't fail the completed restore.
+func (rm *restoreManager) syncPostRestoreHook(r *v1alpha1.Restore) error {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	if v1alpha1.IsRestorePostHookFinished(r) {
+		return nil
+	}
+
+	jobName := r.GetPostRestoreHookJobName()
+	job, err := rm.deps.JobLister.Jobs(r.GetRestoreJobNamespace()).Get(jobName)
+	if errors.IsNotFound(err) {
+		job, reason, err := rm.makePostRestoreHookJob(r)
+		if err != nil {
+			return rm.finishPostRestoreHook(r, corev1.ConditionFalse, reason, err.Error())
+		}
+		if err := rm.deps.JobControl.CreateJob(r, job); err != nil {
+			return fmt.Errorf("restore %s/%s: create post restore hook job %s failed, err: %v", ns, name, jobName, err)
+		}
+		klog.Infof("restore %s/%s: created post restore hook job %s", ns, name, jobName)
+		return controller.RequeueErrorf("restore %s/%s: waiting for post restore hook job %s finished", ns, name, jobName)
+	}
+	if err != nil {
+		return fmt.Errorf("restore %s/%s: get post restore hook job %s failed, err: %v", ns, name, jobName, err)
+	}
+
+	if c := jobFailedCondition(job); c != nil {
+		return rm.finishPostRestoreHook(r, corev1.ConditionFalse, postRestoreHookFailed,
+			fmt.Sprintf("job %s failed, reason: %s, message: %s", jobName, c.Reason, c.Message))
+	}
+	if job.Status.Succeeded == 0 {
+		return controller.RequeueErrorf("restore %s/%s: waiting for post restore hook job %s finished", ns, name, jobName)
+	}
+	return rm.finishPostRestoreHook(r, corev1.ConditionTrue, "PostRestoreHookSucceeded", fmt.Sprintf("job %s succeeded", jobName))
+}
+
+// finishPostRestoreHook records the result of the post restore hook, the failure is also reported by a warning event
+func (rm *restoreManager) finishPostRestoreHook(r *v1alpha1.Restore, status corev1.ConditionStatus, reason, message string) error {
+	if status != corev1.ConditionTrue {
+		klog.Warningf("restore %s/%s: post restore hook failed, %s", r.Namespace, r.Name, message)
+		rm.deps.Recorder.Event(r, corev1.EventTypeWarning, reason, message)
+	}
+	return rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestorePostHookComplete,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}, nil)
+}
+
+// makePostRestoreHookJob makes the job running the post restore hook, it connects to TiDB like the restore job
+func (rm *restoreManager) makePostRestoreHookJob(r *v1alpha1.Restore) (*batchv1.Job, string, error) {
+	ns := r.GetNamespace()
+	name := r.GetName()
+
+	var tc *v1alpha1.TidbCluster
+	if r.Spec.BR != nil {
+		restoreNamespace := ns
+		if r.Spec.BR.ClusterNamespace != "" {
+			restoreNamespace = r.Spec.BR.ClusterNamespace
+		}
+		var err error
+		tc, err = rm.deps.TiDBClusterLister.TidbClusters(restoreNamespace).Get(r.Spec.BR.Cluster)
+		if err != nil {
+			return nil, "GetTidbClusterFailed", fmt.Errorf("restore %s/%s: get tidbcluster %s/%s failed, err: %v", ns, name, restoreNamespace, r.Spec.BR.Cluster, err)
+		}
+	}
+
+	// the hook job runs along with the restore job, it uses the same secrets and service account
+	jobNS := r.GetRestoreJobNamespace()
+	var envVars []corev1.EnvVar
+	if to := r.Spec.To; to != nil {
+		envVars = []corev1.EnvVar{
+			{Name: "TIDB_HOST", Value: to.Host},
+			{Name: "TIDB_PORT", Value: strconv.Itoa(int(to.Port))},
+			{Name: "TIDB_USER", Value: to.User},
+		}
+		if r.Spec.TiDBPasswordFromFile {
+			envVars = append(envVars, corev1.EnvVar{Name: "TIDB_PASSWORD_FILE", Value: constants.TidbPasswordFile})
+		} else {
+			passwordEnv, reason, err := backuputil.GenerateTidbPasswordEnv(jobNS, name, to.SecretName, r.Spec.UseKMS, rm.deps.SecretLister)
+			if err != nil {
+				return nil, reason, err
+			}
+			envVars = append(envVars, passwordEnv...)
+		}
+	}
+
+	volumeMounts, volumes, reason, err := rm.makeTLSVolumes(r, tc)
+	if err != nil {
+		return nil, reason, err
+	}
+	if to := r.Spec.To; to != nil && r.Spec.TiDBPasswordFromFile {
+		volume, volumeMount, reason, err := backuputil.GenerateTidbPasswordVolume(jobNS, name, to.SecretName, rm.deps.SecretLister)
+		if err != nil {
+			return nil, reason, err
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+	}
+
+	container := r.Spec.PostRestoreHook.DeepCopy()
+	container.Env = util.AppendOverwriteEnv(envVars, container.Env)
+	container.VolumeMounts = append(container.VolumeMounts, volumeMounts...)
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = r.GetImagePullPolicy()
+	}
+
+	serviceAccount := constants.DefaultServiceAccountName
+	if r.Spec.ServiceAccount != "" {
+		serviceAccount = r.Spec.ServiceAccount
+	}
+	var ttl *int32
+	if r.Spec.TTLSecondsAfterFinished != nil {
+		ttl = pointer.Int32Ptr(*r.Spec.TTLSecondsAfterFinished)
+		if *ttl < postRestoreHookMinTTLSeconds {
+			*ttl = postRestoreHookMinTTLSeconds
+		}
+	}
+	labels := label.NewRestore().Instance(r.GetInstanceName()).Component(postRestoreHookComponent).Restore(name)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            r.GetPostRestoreHookJobName(),
+			Namespace:       jobNS,
+			Labels:          labels,
+			OwnerReferences: restoreJobOwnerRefs(r),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            pointer.Int32Ptr(r.GetBackoffLimit()),
+			ActiveDeadlineSeconds:   r.Spec.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext:    r.Spec.PodSecurityContext,
+					ServiceAccountName: serviceAccount,
+					Containers:         []corev1.Container{*container},
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Tolerations:        r.Spec.Tolerations,
+					ImagePullSecrets:   r.Spec.ImagePullSecrets,
+					Affinity:           r.Spec.Affinity,
+					NodeSelector:       r.Spec.NodeSelector,
+					Volumes:            volumes,
+					PriorityClassName:  r.Spec.PriorityClassName,
+				},
+			},
+		},
+	}
+	return job, "", nil
+}
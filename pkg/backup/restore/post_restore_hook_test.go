@@ -0,0 +1,89 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"github.com/pingcap/tidb-operator/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestPostRestoreHook(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.PostRestoreHook = &corev1.Container{
+		Name:    "analyze",
+		Image:   "mysql:8.0",
+		Command: []string{"/bin/sh", "-c", "mysql -h $TIDB_HOST -P $TIDB_PORT -u $TIDB_USER -e 'ANALYZE TABLE db.t'"},
+	}
+	restore.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(600)
+	restore.Spec.TTLSecondsAfterFinished = pointer.Int32Ptr(0)
+	restore.Status.Phase = v1alpha1.RestoreComplete
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue}}
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	// the hook job is created after the restore completes
+	err := m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	jobName := restore.GetPostRestoreHookJobName()
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), jobName, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64(600)))
+	// the finished hook job is kept until its result is observed
+	g.Expect(*job.Spec.TTLSecondsAfterFinished).To(Equal(postRestoreHookMinTTLSeconds))
+	container := job.Spec.Template.Spec.Containers[0]
+	g.Expect(container.Name).To(Equal("analyze"))
+	g.Expect(container.ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+	g.Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "TIDB_HOST", Value: "localhost"}))
+	g.Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+		Name:      util.ClusterClientVolName,
+		ReadOnly:  true,
+		MountPath: util.ClusterClientTLSPath,
+	}))
+
+	// the failure of the hook is reported and the restore is still complete
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+	_, err = deps.KubeClientset.BatchV1().Jobs(restore.Namespace).UpdateStatus(context.TODO(), job, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() bool {
+		job, err := deps.JobLister.Jobs(restore.Namespace).Get(jobName)
+		return err == nil && jobFailedCondition(job) != nil
+	}, time.Second*10).Should(BeTrue())
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestorePostHookComplete, postRestoreHookFailed)
+
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(get.Status.Phase).To(Equal(v1alpha1.RestoreComplete))
+	g.Expect(v1alpha1.IsRestoreComplete(get)).To(BeTrue())
+	g.Expect(v1alpha1.IsRestorePostHookFinished(get)).To(BeTrue())
+	// the hook is not run again
+	g.Expect(m.Sync(get)).To(Succeed())
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const priorityClassNotFoundReason = "PriorityClassNotFound"
+
+// checkPriorityClassExist checks the PriorityClass of the restore job pods exists, otherwise the pods are
+// rejected by the API server after the job is created. The check is skipped if the operator has no
+// permission to get the PriorityClasses, e.g. it is deployed without the cluster permissions.
+func (rm *restoreManager) checkPriorityClassExist(r *v1alpha1.Restore) (string, error) {
+	name := r.Spec.PriorityClassName
+	if name == "" {
+		return "", nil
+	}
+	_, err := rm.deps.KubeClientset.SchedulingV1().PriorityClasses().Get(context.TODO(), name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.IsNotFound(err):
+		return priorityClassNotFoundReason, fmt.Errorf("restore %s/%s: priority class %s of the restore job is not found", r.Namespace, r.Name, name)
+	case errors.IsForbidden(err):
+		klog.Warningf("restore %s/%s: no permission to get priority class %s, skip checking it, %v", r.Namespace, r.Name, name, err)
+		return "", nil
+	default:
+		return "GetPriorityClassFailed", fmt.Errorf("restore %s/%s: get priority class %s failed, %v", r.Namespace, r.Name, name, err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// applyRecoveryPlacement merges the recovery placement into the TiKV spec of tc before TiKV is restarted
+// in the restore-finish phase. The original node selector is recorded in the restore status first,
+// so the placement can be reverted even if it is applied again after the operator restarts. The node
+// selector is patched to tc immediately, and the patched tc is returned.
+func (rm *restoreManager) applyRecoveryPlacement(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (*v1alpha1.TidbCluster, string, error) {
+	if r.Spec.RecoveryPlacement == nil || tc.Spec.TiKV == nil {
+		return tc, "", nil
+	}
+
+	placement := r.Status.RecoveryPlacement
+	if placement == nil {
+		placement = &v1alpha1.RecoveryPlacementStatus{
+			NodeSelector:         mergeNodeSelector(tc.Spec.TiKV.NodeSelector, r.Spec.RecoveryPlacement.NodeSelector),
+			OriginalNodeSelector: copyNodeSelector(tc.Spec.TiKV.NodeSelector),
+		}
+		if err := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+			RecoveryPlacement: placement,
+		}); err != nil {
+			return tc, "UpdateRecoveryPlacementFailed", err
+		}
+	}
+	if apiequality.Semantic.DeepEqual(tc.Spec.TiKV.NodeSelector, placement.NodeSelector) {
+		return tc, "", nil
+	}
+
+	klog.Infof("%s/%s apply recovery placement %v to TiKV of tc %s/%s", r.Namespace, r.Name, placement.NodeSelector, tc.Namespace, tc.Name)
+	patched, err := rm.patchTiKVNodeSelector(tc, placement.NodeSelector)
+	if err != nil {
+		return tc, "ApplyRecoveryPlacementFailed", err
+	}
+	return patched, "", nil
+}
+
+// revertRecoveryPlacement restores the original TiKV node selector after all the TiKV stores are up.
+func (rm *restoreManager) revertRecoveryPlacement(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	placement := r.Status.RecoveryPlacement
+	if placement == nil || placement.Reverted || tc.Spec.TiKV == nil {
+		return "", nil
+	}
+
+	klog.Infof("%s/%s revert recovery placement of TiKV of tc %s/%s to %v", r.Namespace, r.Name, tc.Namespace, tc.Name, placement.OriginalNodeSelector)
+	if _, err := rm.patchTiKVNodeSelector(tc, placement.OriginalNodeSelector); err != nil {
+		return "RevertRecoveryPlacementFailed", err
+	}
+
+	reverted := placement.DeepCopy()
+	reverted.Reverted = true
+	if err := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+		RecoveryPlacement: reverted,
+	}); err != nil {
+		return "UpdateRecoveryPlacementFailed", err
+	}
+	return "", nil
+}
+
+// patchTiKVNodeSelector sets the TiKV node selector of tc by a merge patch, the keys not in the selector are
+// removed. Only the node selector is patched, so the other changes of tc are not overwritten by the cached tc.
+func (rm *restoreManager) patchTiKVNodeSelector(tc *v1alpha1.TidbCluster, selector map[string]string) (*v1alpha1.TidbCluster, error) {
+	nodeSelector := make(map[string]interface{}, len(tc.Spec.TiKV.NodeSelector)+len(selector))
+	for k := range tc.Spec.TiKV.NodeSelector {
+		nodeSelector[k] = nil
+	}
+	for k, v := range selector {
+		nodeSelector[k] = v
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"tikv": map[string]interface{}{
+				"nodeSelector": nodeSelector,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal TiKV node selector patch of tc %s/%s failed, err: %v", tc.Namespace, tc.Name, err)
+	}
+	patched, err := rm.deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Patch(context.TODO(), tc.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("patch TiKV node selector of tc %s/%s failed, err: %v", tc.Namespace, tc.Name, err)
+	}
+	return patched, nil
+}
+
+func mergeNodeSelector(base, override map[string]string) map[string]string {
+	merged := copyNodeSelector(base)
+	if merged == nil && len(override) > 0 {
+		merged = make(map[string]string, len(override))
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+func copyNodeSelector(selector map[string]string) map[string]string {
+	if selector == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(selector))
+	for k, v := range selector {
+		copied[k] = v
+	}
+	return copied
+}
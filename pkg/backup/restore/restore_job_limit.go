@@ -0,0 +1,97 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/klog/v2"
+)
+
+// isJobFinished returns true if the job is complete or failed
+func isJobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// RunningRestoreJobs returns the number of the restore jobs that are not finished
+func RunningRestoreJobs(lister batchlisters.JobLister) (int, error) {
+	sel, err := label.NewRestore().RestoreJob().Selector()
+	if err != nil {
+		return 0, err
+	}
+	jobs, err := lister.List(sel)
+	if err != nil {
+		return 0, err
+	}
+	running := 0
+	for _, job := range jobs {
+		if !isJobFinished(job) {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// checkRestoreJobLimit holds the restore with condition Throttled if the number of the running restore jobs
+// reaches the limit, until some of them finish. Condition Throttled set by the limit is cleared once the restore
+// is admitted. The check is based on the cached jobs, restores checked at the same time may exceed the limit a little.
+func (rm *restoreManager) checkRestoreJobLimit(r *v1alpha1.Restore) (string, error) {
+	limit := rm.deps.CLIConfig.MaxConcurrentRestoreJobs
+	if limit <= 0 {
+		return "", nil
+	}
+
+	running, err := RunningRestoreJobs(rm.deps.JobLister)
+	if err != nil {
+		return "ListRestoreJobsFailed", err
+	}
+	if running < limit {
+		if _, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreThrottled); cond != nil &&
+			cond.Status == corev1.ConditionTrue && cond.Reason == "RestoreJobLimitReached" {
+			if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreThrottled,
+				Status:  corev1.ConditionFalse,
+				Reason:  "RestoreJobLimitAvailable",
+				Message: fmt.Sprintf("%d restore jobs are running, the limit is %d", running, limit),
+			}, nil); err != nil {
+				return "UpdateRestoreThrottledFailed", err
+			}
+		}
+		return "", nil
+	}
+
+	ns := r.GetNamespace()
+	name := r.GetName()
+	klog.Infof("restore %s/%s is throttled, %d restore jobs are running, the limit is %d", ns, name, running, limit)
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreThrottled,
+		Status:  corev1.ConditionTrue,
+		Reason:  "RestoreJobLimitReached",
+		Message: fmt.Sprintf("%d restore jobs are running, the limit is %d", running, limit),
+	}, nil); err != nil {
+		return "UpdateRestoreThrottledFailed", err
+	}
+	return "", controller.RequeueErrorf("restore %s/%s: waiting for the running restore jobs under the limit %d", ns, name, limit)
+}
@@ -17,45 +17,161 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Masterminds/semver"
+	"github.com/pingcap/kvproto/pkg/metapb"
 	"github.com/pingcap/tidb-operator/pkg/apis/label"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/apis/util/config"
 	"github.com/pingcap/tidb-operator/pkg/backup"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
 	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
 	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
 	"github.com/pingcap/tidb-operator/pkg/controller"
 	"github.com/pingcap/tidb-operator/pkg/util"
+	"gocloud.dev/gcerrors"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
 	"k8s.io/utils/pointer"
 )
 
 const (
 	TiKVConfigEncryptionMethod      = "security.encryption.data-encryption-method"
 	TiKVConfigEncryptionMasterKeyId = "security.encryption.master-key.key-id"
+	// TiKVConfigEncryptionPreviousMasterKeyId is the master key TiKV rotates from when it starts
+	TiKVConfigEncryptionPreviousMasterKeyId = "security.encryption.previous-master-key.key-id"
+	// TiFlashConfigStorageMainDir is the data directories of TiFlash in its common config, the TiFlash proxy
+	// shares the encryption config keys of TiKV
+	TiFlashConfigStorageMainDir = "storage.main.dir"
+
+	tiflashReplicasMismatchedReason = "TiFlashReplicasMismatched"
+	tikvReplicasMismatchedReason    = "TiKVReplicasMismatched"
+	recoveryModeOffReason           = "RecoveryModeOff"
+	tikvEncryptionMismatchedReason  = "TiKVEncryptionMismatched"
+	tiflashConfigMismatchedReason   = "TiFlashConfigMismatched"
+	invalidPitrTimestampReason      = "InvalidPitrTimestamp"
+	targetClusterNotEmptyReason     = "TargetClusterNotEmpty"
+	brVersionTooOldReason           = "BRVersionTooOld"
+	storageSizeExceedsLimitReason   = "StorageSizeExceedsLimit"
+	// backupMetaDoesnotContainTiKVReason is the reason of the volume snapshot backup meta without TiKV
+	backupMetaDoesnotContainTiKVReason = "BackupMetaDoesnotContainTiKV"
+	// insufficientTiKVCapacityReason is the reason of the TiKV stores without the capacity to hold the restored data
+	insufficientTiKVCapacityReason = "InsufficientTiKVCapacity"
+	// incompatibleBackupMetaVersionReason is the reason of the backup meta newer than the operator supports
+	incompatibleBackupMetaVersionReason = "IncompatibleBackupMetaVersion"
+
+	isDefaultStorageClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaIsDefaultStorageClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
 )
 
+const (
+	// coldStorageScanTimeout bounds the scan of the cold storage objects running in the background, listing
+	// and rehydrating the objects of a large backup may take a while
+	coldStorageScanTimeout = 5 * time.Minute
+	// coldStorageScanWait is how long a reconcile waits for the scan of the cold storage objects
+	coldStorageScanWait = 5 * time.Second
+)
+
+// unrecoverableReasons are the reasons of the failures that retrying can't fix, such as the backup
+// mismatching the target cluster, the restore is marked as Failed instead of RetryFailed for them.
+var unrecoverableReasons = map[string]struct{}{
+	tiflashReplicasMismatchedReason:         {},
+	tikvReplicasMismatchedReason:            {},
+	recoveryModeOffReason:                   {},
+	tikvEncryptionMismatchedReason:          {},
+	tiflashConfigMismatchedReason:           {},
+	tikvStorageEngineMismatchedReason:       {},
+	invalidPitrTimestampReason:              {},
+	targetClusterNotEmptyReason:             {},
+	brVersionTooOldReason:                   {},
+	storageSizeExceedsLimitReason:           {},
+	incompatibleBackupMetaVersionReason:     {},
+	insufficientTiKVCapacityReason:          {},
+	backupMetaDoesnotContainTiKVReason:      {},
+	backuputil.UnsupportedStorageTypeReason: {},
+}
+
+// failedConditionType returns RestoreFailed for the unrecoverable failures and RestoreRetryFailed for the others
+func failedConditionType(reason string) v1alpha1.RestoreConditionType {
+	if _, ok := unrecoverableReasons[reason]; ok {
+		return v1alpha1.RestoreFailed
+	}
+	return v1alpha1.RestoreRetryFailed
+}
+
+// updateFailedCondition records the failure with the condition type classified by the reason, an
+// unrecoverable failure is ignored so the restore is not requeued.
+func (rm *restoreManager) updateFailedCondition(r *v1alpha1.Restore, reason string, err error) error {
+	conditionType := failedConditionType(reason)
+	rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: err.Error(),
+	}, nil)
+	if conditionType == v1alpha1.RestoreFailed {
+		return controller.IgnoreErrorf("restore %s/%s failed, %v", r.Namespace, r.Name, err)
+	}
+	return err
+}
+
 type restoreManager struct {
 	deps          *controller.Dependencies
 	statusUpdater controller.RestoreConditionUpdaterInterface
+	metaCache     *restoreMetaCache
+	// warmupStarted records the restores whose image warmup daemonset is created
+	warmupStarted sync.Map
+	// coldStorageScans records the scans of the cold storage objects running in the background
+	coldStorageScans sync.Map
+	// metaReadFailures records the number of the failed reads of the restore meta of the restores
+	metaReadFailures sync.Map
 }
 
 // NewRestoreManager return restoreManager
 func NewRestoreManager(deps *controller.Dependencies) backup.RestoreManager {
+	metaCache := newRestoreMetaCache()
+	if deps.InformerFactory != nil {
+		deps.InformerFactory.Pingcap().V1alpha1().Restores().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: metaCache.deleteRestore,
+		})
+	}
 	return &restoreManager{
 		deps:          deps,
 		statusUpdater: controller.NewRealRestoreConditionUpdater(deps.Clientset, deps.RestoreLister, deps.Recorder),
+		metaCache:     metaCache,
 	}
 }
 
 func (rm *restoreManager) Sync(restore *v1alpha1.Restore) error {
+	if isJobCleanupCandidate(restore) {
+		return rm.cleanupCrossNamespaceJobs(restore)
+	}
+	if NeedCancel(restore) {
+		return rm.cancelRestore(restore)
+	}
+	if v1alpha1.IsRestoreCanceled(restore) {
+		return nil
+	}
+	if NeedImageWarmupCleanup(restore) {
+		return rm.cleanupFailedImageWarmup(restore)
+	}
+	if NeedRestorePVCCleanup(restore) {
+		return rm.cleanupRestorePVC(restore)
+	}
 	return rm.syncRestoreJob(restore)
 }
 
@@ -63,6 +179,10 @@ func (rm *restoreManager) UpdateCondition(restore *v1alpha1.Restore, condition *
 	return rm.statusUpdater.Update(restore, condition, nil)
 }
 
+func (rm *restoreManager) UpdateStatus(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error {
+	return rm.statusUpdater.Update(restore, condition, newStatus)
+}
+
 func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 	ns := restore.GetNamespace()
 	name := restore.GetName()
@@ -73,6 +193,12 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 		restoreNamespace string
 	)
 
+	rm.metaCache.syncPhase(restore)
+
+	if v1alpha1.IsRestoreComplete(restore) && restore.Spec.PostRestoreHook != nil {
+		return rm.syncPostRestoreHook(restore)
+	}
+
 	if restore.Spec.BR == nil {
 		err = backuputil.ValidateRestore(restore, "", false)
 	} else {
@@ -81,7 +207,10 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 			restoreNamespace = restore.Spec.BR.ClusterNamespace
 		}
 
-		tc, err = rm.deps.TiDBClusterLister.TidbClusters(restoreNamespace).Get(restore.Spec.BR.Cluster)
+		tc, err = rm.getRestoreTC(restore, restoreNamespace)
+		if controller.IsRequeueError(err) {
+			return err
+		}
 		if err != nil {
 			reason := fmt.Sprintf("failed to fetch tidbcluster %s/%s", restoreNamespace, restore.Spec.BR.Cluster)
 			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
@@ -108,36 +237,56 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 		return controller.IgnoreErrorf("invalid restore spec %s/%s", ns, name)
 	}
 
-	if restore.Spec.BR != nil && restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
-		err = rm.validateRestore(restore, tc)
+	if restore.Spec.DryRun {
+		return rm.dryRunRestore(restore, tc)
+	}
 
-		if err != nil {
-			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
-				Type:    v1alpha1.RestoreInvalid,
-				Status:  corev1.ConditionTrue,
-				Reason:  "InvalidSpec",
-				Message: err.Error(),
-			}, nil)
+	if restore.Spec.BR != nil && restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+		if err := rm.checkRestoreDeadline(restore); err != nil {
 			return err
 		}
+		if reason, err := rm.validateRestore(restore, tc); err != nil {
+			return rm.updateFailedCondition(restore, reason, err)
+		}
 		// restore based on volume snapshot for cloud provider
 		reason, err := rm.volumeSnapshotRestore(restore, tc)
-		if err != nil {
-			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
-				Type:    v1alpha1.RestoreRetryFailed,
-				Status:  corev1.ConditionTrue,
-				Reason:  reason,
-				Message: err.Error(),
-			}, nil)
+		if controller.IsRequeueError(err) || controller.IsIgnoreError(err) {
 			return err
 		}
+		if err != nil {
+			return rm.updateFailedCondition(restore, reason, err)
+		}
 		if !tc.PDAllMembersReady() {
-			return controller.RequeueErrorf("restore %s/%s: waiting for all PD members are ready in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
+			if restore.Status.PDWaitStartTime == nil {
+				if err := rm.statusUpdater.Update(restore, nil, &controller.RestoreUpdateStatus{
+					PDWaitStartTime: &metav1.Time{Time: time.Now()},
+				}); err != nil {
+					return err
+				}
+			} else if timeout, waited := rm.pdReadyTimeout(restore); waited > timeout {
+				err := fmt.Errorf("PD members in tidbcluster %s/%s are not ready after %s, timeout is %s", tc.Namespace, tc.Name, waited.Round(time.Second), timeout)
+				rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+					Type:    v1alpha1.RestoreFailed,
+					Status:  corev1.ConditionTrue,
+					Reason:  "PDNeverReady",
+					Message: err.Error(),
+				}, nil)
+				return controller.IgnoreErrorf("restore %s/%s: %v", ns, name, err)
+			}
+			return controller.ClusterWaitErrorf("restore %s/%s: waiting for all PD members are ready in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
+		}
+		if restore.Status.PDWaitStartTime != nil {
+			// the wait is measured again if PD members become not ready later
+			if err := rm.statusUpdater.Update(restore, nil, &controller.RestoreUpdateStatus{
+				PDWaitStartTime: &metav1.Time{},
+			}); err != nil {
+				return err
+			}
 		}
 
 		if v1alpha1.IsRestoreVolumeComplete(restore) && !v1alpha1.IsRestoreTiKVComplete(restore) {
 			if !tc.AllTiKVsAreAvailable() {
-				return controller.RequeueErrorf("restore %s/%s: waiting for all TiKVs are available in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
+				return controller.ClusterWaitErrorf("restore %s/%s: waiting for all TiKVs are available in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
 			} else {
 				sel, err := label.New().Instance(tc.Name).TiKV().Selector()
 				if err != nil {
@@ -161,7 +310,7 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 					return err
 				}
 
-				s, reason, err := snapshotter.NewSnapshotterForRestore(restore.Spec.Mode, rm.deps)
+				s, reason, err := rm.newRestoreSnapshotter(restore, pvs)
 				if err != nil {
 					rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 						Type:    v1alpha1.RestoreRetryFailed,
@@ -172,12 +321,28 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 					return err
 				}
 
-				err = s.AddVolumeTags(pvs)
-				if err != nil {
+				// the volumes of the S3 engine TiKV are not restored from the snapshots, there is nothing to tag
+				if _, ok := s.(*snapshotter.NoneSnapshotter); !ok {
+					err = rm.addVolumeTags(restore, s, pvs)
+					if err != nil {
+						rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+							Type:    v1alpha1.RestoreRetryFailed,
+							Status:  corev1.ConditionTrue,
+							Reason:  "AddVolumeTagFailed",
+							Message: err.Error(),
+						}, nil)
+						return err
+					}
+				}
+
+				if reason, err := rm.syncTiFlashVolumes(restore, tc); err != nil {
+					if controller.IsClusterWaitError(err) {
+						return err
+					}
 					rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 						Type:    v1alpha1.RestoreRetryFailed,
 						Status:  corev1.ConditionTrue,
-						Reason:  "AddVolumeTagFailed",
+						Reason:  reason,
 						Message: err.Error(),
 					}, nil)
 					return err
@@ -200,20 +365,28 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 	}
 
 	restoreJobName := restore.GetRestoreJobName()
-	_, err = rm.deps.JobLister.Jobs(ns).Get(restoreJobName)
+	existingJob, err := rm.deps.JobLister.Jobs(restore.GetRestoreJobNamespace()).Get(restoreJobName)
 	if err == nil {
-		klog.Infof("restore job %s/%s has been created, skip", ns, restoreJobName)
-		return nil
+		if restore.Spec.Mode == v1alpha1.RestoreModePiTR {
+			return rm.syncPiTRRestoreJob(restore, existingJob)
+		}
+		klog.Infof("restore job %s/%s has been created, sync its status", ns, restoreJobName)
+		return rm.syncRestoreJobStatus(restore, existingJob)
 	} else if !errors.IsNotFound(err) {
 		return fmt.Errorf("restore %s/%s get job %s failed, err: %v", ns, name, restoreJobName, err)
 	}
 
-	var (
-		job    *batchv1.Job
-		reason string
-	)
-	if restore.Spec.BR == nil {
-		job, reason, err = rm.makeImportJob(restore)
+	// the job finished and cleaned up by the ttl must not be recreated, the restore is finished by the
+	// status reported from the job
+	if restore.Spec.TTLSecondsAfterFinished != nil && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot && v1alpha1.IsRestoreScheduled(restore) {
+		return controller.IgnoreErrorf("restore %s/%s: job %s is not found, it has been cleaned up after finished", ns, name, restoreJobName)
+	}
+
+	if !v1alpha1.IsRestoreScheduled(restore) && (restore.Spec.CheckColdStorage || restore.Spec.AutoRehydrate != nil) {
+		reason, err := rm.checkColdStorage(restore)
+		if controller.IsRequeueError(err) || controller.IsIgnoreError(err) {
+			return err
+		}
 		if err != nil {
 			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 				Type:    v1alpha1.RestoreRetryFailed,
@@ -223,9 +396,11 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 			}, nil)
 			return err
 		}
+	}
 
-		reason, err = rm.ensureRestorePVCExist(restore)
-		if err != nil {
+	// the snapshots are shared before BR restores the volumes from them in the first job
+	if !v1alpha1.IsRestoreScheduled(restore) && restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+		if reason, err := rm.shareCrossAccountSnapshots(restore); err != nil {
 			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 				Type:    v1alpha1.RestoreRetryFailed,
 				Status:  corev1.ConditionTrue,
@@ -234,8 +409,13 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 			}, nil)
 			return err
 		}
-	} else {
-		job, reason, err = rm.makeRestoreJob(restore)
+	}
+
+	if !v1alpha1.IsRestoreScheduled(restore) {
+		reason, err := rm.checkBandwidthBudget(restore)
+		if controller.IsRequeueError(err) || controller.IsIgnoreError(err) {
+			return err
+		}
 		if err != nil {
 			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
 				Type:    v1alpha1.RestoreRetryFailed,
@@ -247,6 +427,97 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 		}
 	}
 
+	// only the first job is throttled, the later jobs of a started restore such as the restore-finish job of
+	// volume snapshot restore must not be held
+	if !v1alpha1.IsRestoreScheduled(restore) {
+		if reason, err := rm.checkRestoreJobLimit(restore); err != nil {
+			if controller.IsRequeueError(err) {
+				return err
+			}
+			rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreRetryFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: err.Error(),
+			}, nil)
+			return err
+		}
+	}
+
+	if reason, err := rm.checkPriorityClassExist(restore); err != nil {
+		return rm.updateFailedCondition(restore, reason, err)
+	}
+
+	var (
+		job    *batchv1.Job
+		reason string
+	)
+	if restore.Spec.BR == nil {
+		// lightning fails the attempt if it can't connect TiDB
+		if err := rm.waitTiDBReady(restore); err != nil {
+			return err
+		}
+		if restore.Spec.CheckTiKVCapacity {
+			if reason, err := rm.checkImportTiKVCapacity(restore); err != nil {
+				return rm.updateFailedCondition(restore, reason, err)
+			}
+		}
+		job, reason, err = rm.makeImportJob(restore)
+		if err != nil {
+			return rm.updateFailedCondition(restore, reason, err)
+		}
+
+		if restore.Spec.Mode != v1alpha1.RestoreModeLogical {
+			reason, err = rm.ensureRestorePVCExist(restore)
+			if controller.IsRequeueError(err) {
+				return err
+			}
+			if err != nil {
+				return rm.updateFailedCondition(restore, reason, err)
+			}
+		}
+	} else {
+		if restore.Spec.CheckTiKVCapacity && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			if reason, err := rm.checkTiKVCapacity(restore, tc); err != nil {
+				return rm.updateFailedCondition(restore, reason, err)
+			}
+		}
+
+		if restore.Spec.BRVersion != "" && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			if reason, err := rm.checkBRVersion(restore); err != nil {
+				return rm.updateFailedCondition(restore, reason, err)
+			}
+		}
+
+		if restore.Spec.Mode == v1alpha1.RestoreModePiTR {
+			if reason, err := rm.validatePiTRRestoredTs(restore); err != nil {
+				return rm.updateFailedCondition(restore, reason, err)
+			}
+		}
+
+		job, reason, err = rm.makeRestoreJob(restore)
+		if controller.IsRequeueError(err) {
+			return err
+		}
+		if err != nil {
+			return rm.updateFailedCondition(restore, reason, err)
+		}
+	}
+
+	if restrictedSecurityContextEnabled(restore) {
+		applyRestrictedSecurityContext(job)
+	}
+
+	if restore.Spec.Debug {
+		debugRestoreJob(job)
+		rm.deps.Recorder.Eventf(restore, corev1.EventTypeWarning, "DebugRestoreJob",
+			"restore job %s is created in debug mode, it sleeps instead of running the restore", restoreJobName)
+	}
+
+	if err := rm.addJobCleanupFinalizer(restore); err != nil {
+		return err
+	}
+
 	if err := rm.deps.JobControl.CreateJob(restore, job); err != nil {
 		errMsg := fmt.Errorf("create restore %s/%s job %s failed, err: %v", ns, name, restoreJobName, err)
 		rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
@@ -258,52 +529,136 @@ func (rm *restoreManager) syncRestoreJob(restore *v1alpha1.Restore) error {
 		return errMsg
 	}
 
-	// Currently, the restore phase reuses the condition type and is updated when the condition is changed.
-	// However, conditions are only used to describe the detailed status of the restore job. It is not suitable
-	// for describing a state machine.
-	//
-	// Some restore such as volume-snapshot will create multiple jobs, and the phase will be changed to
-	// running when the first job is running. To avoid the phase going back from running to scheduled, we
-	// don't update the condition when the scheduled condition has already been set to true.
-	if !v1alpha1.IsRestoreScheduled(restore) {
-		return rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
-			Type:   v1alpha1.RestoreScheduled,
-			Status: corev1.ConditionTrue,
-		}, nil)
+	correlationID := restore.GetCorrelationID()
+	var volumeAZ *string
+	if restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot && restore.GetVolumeAZ() != "" {
+		// record the target AZ the volumes are restored to, so the later phases use the same AZ
+		az := restore.GetVolumeAZ()
+		volumeAZ = &az
 	}
-	return nil
+	var restorePiTRPhase *v1alpha1.RestorePiTRPhase
+	if restore.Spec.Mode == v1alpha1.RestoreModePiTR {
+		phase := v1alpha1.RestorePiTRFullRestore
+		restorePiTRPhase = &phase
+	}
+	// Some restore such as volume-snapshot will create multiple jobs, each job is recorded in the status,
+	// and the phase is computed from them, so it doesn't go back from running to scheduled when a later
+	// job is scheduled.
+	return rm.statusUpdater.Update(restore, &v1alpha1.RestoreCondition{
+		Type:   v1alpha1.RestoreScheduled,
+		Status: corev1.ConditionTrue,
+	}, &controller.RestoreUpdateStatus{
+		ObservedGeneration: &restore.Generation,
+		CorrelationID:      &correlationID,
+		VolumeAZ:           volumeAZ,
+		PiTRPhase:          restorePiTRPhase,
+		SubJob: &v1alpha1.RestoreSubJobStatus{
+			Type:    restore.GetRestoreSubJobType(),
+			JobName: restoreJobName,
+			Phase:   v1alpha1.RestoreSubJobScheduled,
+		},
+	})
 }
 
+// restoreMetaReadAttempts is the number of the attempts to read the restore meta before the restore fails,
+// the cross region reads are intermittently slow
+const restoreMetaReadAttempts = 3
+
 // read cluster meta from external storage since k8s size limitation on annotation/configMap
 // after volume restore job complete, br output a meta file for controller to reconfig the tikvs
 // since the meta file may big, so we use remote storage as bridge to pass it from restore manager to controller
+// the storages are tried in order if the fallback storages are configured.
+// Every sync reads the storages once, the failed read is retried by requeueing the restore so that the worker
+// is not blocked by the slow reads.
 func (rm *restoreManager) readRestoreMetaFromExternalStorage(r *v1alpha1.Restore) (*snapshotter.CloudSnapBackup, string, error) {
-	// since the restore meta is small (~5M), assume 1 minutes is enough
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(time.Minute*1))
-	defer cancel()
+	var (
+		csb    *snapshotter.CloudSnapBackup
+		reason string
+		err    error
+	)
+	key := fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	providers, _ := backuputil.RestoreStorageProviders(r)
+	for _, provider := range providers {
+		csb, reason, err = rm.readRestoreMetaFromStorage(r, provider)
+		if err != nil {
+			continue
+		}
+		rm.metaReadFailures.Delete(key)
+		if len(r.Spec.FallbackStorageProviders) > 0 {
+			// record the storage which actually serves the restore meta
+			storagePath, _ := backuputil.GetStoragePath(provider)
+			if storagePath != r.Status.StoragePath {
+				klog.Infof("restore %s/%s: the restore meta is read from storage %s", r.Namespace, r.Name, storagePath)
+				rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+					StoragePath: &storagePath,
+				})
+			}
+		}
+		return csb, "", nil
+	}
+
+	// the missing restore meta is not retried, BR failed to write it
+	if reason != "FileNotExists" {
+		value, _ := rm.metaReadFailures.LoadOrStore(key, 0)
+		failures := value.(int) + 1
+		if failures < restoreMetaReadAttempts {
+			rm.metaReadFailures.Store(key, failures)
+			return nil, "", controller.RequeueErrorf("restore %s/%s: read the restore meta failed %d times with reason %s, retry later, %v", r.Namespace, r.Name, failures, reason, err)
+		}
+	}
+	rm.metaReadFailures.Delete(key)
+	return nil, reason, err
+}
+
+func (rm *restoreManager) readRestoreMetaFromStorage(r *v1alpha1.Restore, provider v1alpha1.StorageProvider) (*snapshotter.CloudSnapBackup, string, error) {
+	timeout := backuputil.GetMetaReadTimeout(r)
 
 	// read restore meta from output of BR 1st restore
 	klog.Infof("read the restore meta from external storage")
-	cred := backuputil.GetStorageCredential(r.Namespace, r.Spec.StorageProvider, rm.deps.SecretLister)
-	externalStorage, err := backuputil.NewStorageBackend(r.Spec.StorageProvider, cred)
+	cred := rm.storageCredential(r, provider)
+	externalStorage, err := backuputil.NewStorageBackend(provider, cred)
 	if err != nil {
 		return nil, "NewStorageBackendFailed", err
 	}
+	defer externalStorage.Close()
 
-	// if file doesn't exist, br create volume has problem
-	exist, err := externalStorage.Exists(ctx, constants.ClusterRestoreMeta)
+	storagePath, err := backuputil.GetStoragePath(provider)
 	if err != nil {
-		return nil, "FileExistedInExternalStorageFailed", err
+		return nil, "GetStoragePathFailed", err
 	}
-	if !exist {
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// if file doesn't exist, br create volume has problem
+	var (
+		restoreMeta []byte
+		reason      string
+	)
+	exist, err := externalStorage.Exists(ctx, constants.ClusterRestoreMeta)
+	switch {
+	case err != nil:
+		reason = "FileExistedInExternalStorageFailed"
+	case !exist:
 		return nil, "FileNotExists", fmt.Errorf("%s does not exist", constants.ClusterRestoreMeta)
+	default:
+		restoreMeta, err = rm.metaCache.ReadAll(ctx, externalStorage, storagePath, constants.ClusterRestoreMeta)
+		reason = "ReadAllOnExternalStorageFailed"
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		reason = "ReadRestoreMetaTimeout"
+		err = fmt.Errorf("read %s from %s timed out after %s: %v", constants.ClusterRestoreMeta, storagePath, timeout, err)
 	}
-
-	restoreMeta, err := externalStorage.ReadAll(ctx, constants.ClusterRestoreMeta)
 	if err != nil {
-		return nil, "ReadAllOnExternalStorageFailed", err
+		klog.Warningf("restore %s/%s: read the restore meta failed with reason %s, %v", r.Namespace, r.Name, reason, err)
+		return nil, reason, err
 	}
 
+	// the large restore meta is gzipped by the restore job
+	restoreMeta, err = backuputil.DecompressRestoreMeta(restoreMeta)
+	if err != nil {
+		return nil, "DecompressRestoreMetaFailed", err
+	}
 	csb := &snapshotter.CloudSnapBackup{}
 	err = json.Unmarshal(restoreMeta, csb)
 	if err != nil {
@@ -312,51 +667,465 @@ func (rm *restoreManager) readRestoreMetaFromExternalStorage(r *v1alpha1.Restore
 
 	return csb, "", nil
 }
-func (rm *restoreManager) validateRestore(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) error {
-	// check tiflash and tikv replicas
-	tiflashReplicas, tikvReplicas, reason, err := rm.readTiFlashAndTiKVReplicasFromBackupMeta(r)
+
+// restoreMetaDeleteBackoff is the backoff of the attempts to delete the restore meta, the restore is already
+// complete and not synced again, so the transient failures are retried in place
+var restoreMetaDeleteBackoff = wait.Backoff{
+	Duration: time.Second,
+	Steps:    3,
+	Factor:   2.0,
+}
+
+// deleteRestoreMetaFromExternalStorage deletes the cluster restore meta, it's no error if the meta is already gone.
+// The delete denied by the storage is reported as the missing permission of the storage credentials and not retried.
+func (rm *restoreManager) deleteRestoreMetaFromExternalStorage(r *v1alpha1.Restore) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backuputil.GetMetaReadTimeout(r))
+	defer cancel()
+
+	// the restore meta is written to the storage the restore job restores from
+	providers, _ := backuputil.RestoreStorageProviders(r)
+	provider := providers[0]
+	cred := rm.storageCredential(r, provider)
+	externalStorage, err := backuputil.NewStorageBackend(provider, cred)
 	if err != nil {
-		klog.Errorf("read tiflash replica failure with reason %s", reason)
+		return "NewStorageBackendFailed", err
+	}
+	defer externalStorage.Close()
+
+	var reason string
+	deleteRestoreMeta := func() error {
+		exist, err := externalStorage.Exists(ctx, constants.ClusterRestoreMeta)
+		if err != nil {
+			reason = "FileExistedInExternalStorageFailed"
+			return err
+		}
+		if !exist {
+			return nil
+		}
+
+		klog.Infof("delete the restore meta of %s/%s from external storage", r.Namespace, r.Name)
+		err = externalStorage.Delete(ctx, constants.ClusterRestoreMeta)
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil
+		}
+		reason = "DeleteRestoreMetaFailed"
 		return err
 	}
+	isRetry := func(err error) bool {
+		return gcerrors.Code(err) != gcerrors.PermissionDenied && ctx.Err() == nil
+	}
+	err = retry.OnError(restoreMetaDeleteBackoff, isRetry, deleteRestoreMeta)
+	switch gcerrors.Code(err) {
+	case gcerrors.OK:
+		return "", nil
+	case gcerrors.PermissionDenied:
+		return "DeleteRestoreMetaForbidden", fmt.Errorf("no permission to delete %s from external storage, please grant the delete permission to the storage credentials or delete it manually, err: %v", constants.ClusterRestoreMeta, err)
+	default:
+		return reason, err
+	}
+}
 
-	if tc.Spec.TiFlash == nil {
-		if tiflashReplicas != 0 {
-			klog.Errorf("tiflash is not configured, backupmeta has %d tiflash", tiflashReplicas)
-			return fmt.Errorf("tiflash replica missmatched")
+// coldStorageScan is a scan of the cold storage objects of a restore running in the background
+type coldStorageScan struct {
+	done   chan struct{}
+	objs   *backuputil.ColdStorageObjects
+	reason string
+	err    error
+}
+
+// checkColdStorage checks whether any backup object is archived in the cold storage tier. If so, the restore
+// fails unless AutoRehydrate is set, in which case the archived objects are requested to be rehydrated and the
+// restore is requeued until all of them can be read.
+// Listing and rehydrating the objects of a large backup may take minutes, so they run in the background and
+// the restore is requeued if they don't finish in coldStorageScanWait, the worker is never blocked longer.
+func (rm *restoreManager) checkColdStorage(r *v1alpha1.Restore) (string, error) {
+	ns := r.GetNamespace()
+	name := r.GetName()
+	key := fmt.Sprintf("%s/%s", ns, name)
+
+	value, started := rm.coldStorageScans.LoadOrStore(key, &coldStorageScan{done: make(chan struct{})})
+	scan := value.(*coldStorageScan)
+	if !started {
+		go func() {
+			defer close(scan.done)
+			scan.objs, scan.reason, scan.err = rm.scanColdStorage(r)
+		}()
+	}
+	select {
+	case <-scan.done:
+		rm.coldStorageScans.Delete(key)
+	case <-time.After(coldStorageScanWait):
+		return "", controller.RequeueErrorf("restore %s/%s: waiting for the scan of the cold storage objects", ns, name)
+	}
+	if scan.err != nil {
+		return scan.reason, scan.err
+	}
+
+	objs := scan.objs
+	if objs.Total == 0 {
+		return "", nil
+	}
+	if r.Spec.AutoRehydrate == nil {
+		err := fmt.Errorf("%d objects of the backup are archived in the cold storage tier, set autoRehydrate to rehydrate them", objs.Total)
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BackupInColdStorage",
+			Message: err.Error(),
+		}, nil)
+		return "", controller.IgnoreErrorf("restore %s/%s: %v", ns, name, err)
+	}
+
+	status := &controller.RestoreUpdateStatus{
+		Rehydration: &v1alpha1.RehydrationStatus{
+			Objects:     int32(objs.Total),
+			Rehydrated:  int32(objs.Rehydrated),
+			Rehydrating: int32(objs.Rehydrating),
+		},
+	}
+	if objs.Rehydrated == objs.Total {
+		klog.Infof("restore %s/%s: all %d archived objects are rehydrated", ns, name, objs.Total)
+		if err := rm.statusUpdater.Update(r, nil, status); err != nil {
+			return "UpdateRehydrationStatusFailed", err
 		}
+		return "", nil
+	}
+	rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreWaitingForRehydration,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Rehydrating",
+		Message: fmt.Sprintf("%d of %d archived objects are rehydrated", objs.Rehydrated, objs.Total),
+	}, status)
+	return "", controller.RequeueErrorf("restore %s/%s: waiting for %d archived objects to be rehydrated", ns, name, objs.Total-objs.Rehydrated)
+}
 
-	} else {
-		if tc.Spec.TiFlash.Replicas != tiflashReplicas {
-			klog.Errorf("cluster has %d tiflash configured, backupmeta has %d tiflash", tc.Spec.TiFlash.Replicas, tiflashReplicas)
-			return fmt.Errorf("tiflash replica missmatched")
+// scanColdStorage lists the backup objects in the cold storage tier, and requests to rehydrate the archived
+// ones if AutoRehydrate is set.
+func (rm *restoreManager) scanColdStorage(r *v1alpha1.Restore) (*backuputil.ColdStorageObjects, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), coldStorageScanTimeout)
+	defer cancel()
+
+	cred := rm.storageCredential(r, r.Spec.StorageProvider)
+	externalStorage, err := backuputil.NewStorageBackend(r.Spec.StorageProvider, cred)
+	if err != nil {
+		return nil, "NewStorageBackendFailed", err
+	}
+	defer externalStorage.Close()
+
+	s3cli, ok := externalStorage.AsS3()
+	if !ok {
+		return nil, "NewStorageBackendFailed", fmt.Errorf("storage of restore %s/%s is not S3", r.Namespace, r.Name)
+	}
+	bucket := externalStorage.GetBucket()
+	concurrency := int(v1alpha1.DefaultBatchDeleteOption.RoutineConcurrency)
+	objs, err := backuputil.ListColdStorageObjectsOfS3(ctx, s3cli, bucket, externalStorage.GetPrefix(), concurrency)
+	if err != nil {
+		return nil, "ListColdStorageObjectsFailed", err
+	}
+	if r.Spec.AutoRehydrate == nil || len(objs.Archived) == 0 {
+		return objs, "", nil
+	}
+
+	klog.Infof("restore %s/%s: request to rehydrate %d archived objects", r.Namespace, r.Name, len(objs.Archived))
+	errs := backuputil.RehydrateObjectsOfS3(ctx, s3cli, bucket, objs.Archived, int64(r.GetRehydrationDays()), r.GetRehydrationTier(), concurrency)
+	if len(errs) > 0 {
+		return nil, "RehydrateObjectsFailed", fmt.Errorf("rehydrate %d objects failed, the first is %s, err: %v", len(errs), errs[0].Key, errs[0].Err)
+	}
+	objs.Rehydrating += len(objs.Archived)
+	return objs, "", nil
+}
+
+// pdReadyTimeout returns the timeout to wait for PD members ready and how long the restore has waited,
+// which is measured from the PDWaitStartTime recorded when the restore starts to wait.
+func (rm *restoreManager) pdReadyTimeout(r *v1alpha1.Restore) (time.Duration, time.Duration) {
+	timeout := constants.DefaultPDReadyTimeout
+	if r.Spec.PDReadyTimeout != nil {
+		timeout = r.Spec.PDReadyTimeout.Duration
+	}
+	if r.Status.PDWaitStartTime == nil {
+		return timeout, 0
+	}
+	return timeout, time.Since(r.Status.PDWaitStartTime.Time)
+}
+
+// checkRestoreDeadline fails the volume snapshot restore not complete within RestoreTimeout, which is measured
+// from the TimeStarted recorded when the restore starts, so the restore stuck in waiting for the tidbcluster
+// is not requeued forever.
+func (rm *restoreManager) checkRestoreDeadline(r *v1alpha1.Restore) error {
+	if r.Spec.RestoreTimeout == nil || v1alpha1.IsRestoreComplete(r) {
+		return nil
+	}
+	if r.Status.TimeStarted.IsZero() {
+		return rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+			TimeStarted: &metav1.Time{Time: time.Now()},
+		})
+	}
+
+	timeout := r.Spec.RestoreTimeout.Duration
+	elapsed := time.Since(r.Status.TimeStarted.Time)
+	if elapsed <= timeout {
+		return nil
+	}
+	err := fmt.Errorf("restore is not complete after %s, timeout is %s", elapsed.Round(time.Second), timeout)
+	rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "RestoreDeadlineExceeded",
+		Message: err.Error(),
+	}, nil)
+	return controller.IgnoreErrorf("restore %s/%s: %v", r.Namespace, r.Name, err)
+}
+
+// handleOrphanedVolumes records the volumes restored from the snapshots when preparing the restore metadata fails,
+// and deletes them if CleanupOrphanedVolumesOnFailure is set. The restore is failed after the volumes are deleted.
+func (rm *restoreManager) handleOrphanedVolumes(r *v1alpha1.Restore, s snapshotter.Snapshotter, csb *snapshotter.CloudSnapBackup, reason string, err error) (string, error) {
+	ns := r.Namespace
+	name := r.Name
+	volIDs := snapshotter.RestoredVolumeIDs(csb)
+	if len(volIDs) == 0 {
+		return reason, err
+	}
+
+	orphaned := &v1alpha1.OrphanedVolumesStatus{VolumeIDs: volIDs}
+	if !r.Spec.CleanupOrphanedVolumesOnFailure {
+		klog.Warningf("%s/%s prepare restore metadata failed, volumes %v restored from the snapshots are kept", ns, name, volIDs)
+		if updateErr := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{OrphanedVolumes: orphaned}); updateErr != nil {
+			klog.Errorf("%s/%s record orphaned volumes failed, err: %v", ns, name, updateErr)
 		}
+		return reason, err
 	}
 
-	if tc.Spec.TiKV == nil {
-		if tikvReplicas != 0 {
-			klog.Errorf("tikv is not configured, backupmeta has %d tikv", tikvReplicas)
-			return fmt.Errorf("tikv replica missmatched")
+	klog.Infof("%s/%s prepare restore metadata failed, delete volumes %v restored from the snapshots", ns, name, volIDs)
+	if delErr := s.DeleteVolumes(volIDs); delErr != nil {
+		if updateErr := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{OrphanedVolumes: orphaned}); updateErr != nil {
+			klog.Errorf("%s/%s record orphaned volumes failed, err: %v", ns, name, updateErr)
 		}
+		return "CleanupOrphanedVolumesFailed", fmt.Errorf("%s: %v, delete orphaned volumes failed: %v", reason, err, delErr)
+	}
+
+	orphaned.Cleaned = true
+	if updateErr := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: fmt.Sprintf("%v, %d orphaned volumes are deleted", err, len(volIDs)),
+	}, &controller.RestoreUpdateStatus{OrphanedVolumes: orphaned}); updateErr != nil {
+		return "UpdateRestoreFailedFailed", updateErr
+	}
+	return "", controller.IgnoreErrorf("restore %s/%s failed and orphaned volumes are deleted", ns, name)
+}
+
+// validateRestore checks the backup meta matches the target tidbcluster, a mismatch is reported with one of
+// the unrecoverable reasons, while failing to read the backup meta can be retried.
+func (rm *restoreManager) validateRestore(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	_, reason, err := rm.validateRestoreChecks(r, tc)
+	return reason, err
+}
+
+// validateRestoreChecks runs the checks of validateRestore and returns the descriptions of the checks that are
+// actually performed and passed, the skipped checks and the allowed mismatches are not included.
+func (rm *restoreManager) validateRestoreChecks(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) ([]string, string, error) {
+	// the comparison is recorded before any check fails, so the tidbcluster can be reconciled by it
+	if reason, err := rm.recordValidationResult(r, tc); err != nil {
+		return nil, reason, err
+	}
+
+	var checks []string
+	// check tiflash and tikv replicas
+	tiflashReplicas, tikvReplicas, reason, err := rm.readTiFlashAndTiKVReplicasFromBackupMeta(r)
+	if err != nil {
+		klog.Errorf("read tiflash replica failure with reason %s", reason)
+		return nil, reason, err
+	}
 
+	var clusterTiFlashReplicas, clusterTiKVReplicas int32
+	if tc.Spec.TiFlash != nil {
+		clusterTiFlashReplicas = tc.Spec.TiFlash.Replicas
+	}
+	if tc.Spec.TiKV != nil {
+		clusterTiKVReplicas = tc.Spec.TiKV.Replicas
+	}
+
+	var mismatches []string
+	if clusterTiFlashReplicas != tiflashReplicas {
+		klog.Errorf("cluster has %d tiflash configured, backupmeta has %d tiflash", clusterTiFlashReplicas, tiflashReplicas)
+		if !r.Spec.AllowReplicaMismatch {
+			return nil, tiflashReplicasMismatchedReason, fmt.Errorf("tiflash replica missmatched")
+		}
+		mismatches = append(mismatches, replicaMismatch("TiFlash", clusterTiFlashReplicas, tiflashReplicas))
 	} else {
-		if tc.Spec.TiKV.Replicas != tikvReplicas {
-			klog.Errorf("cluster has %d tikv configured, backupmeta has %d tikv", tc.Spec.TiKV.Replicas, tikvReplicas)
-			return fmt.Errorf("tikv replica missmatched")
+		checks = append(checks, fmt.Sprintf("%d TiFlash replicas of tidbcluster %s/%s match the backup meta", clusterTiFlashReplicas, tc.Namespace, tc.Name))
+	}
+	if clusterTiKVReplicas != tikvReplicas {
+		klog.Errorf("cluster has %d tikv configured, backupmeta has %d tikv", clusterTiKVReplicas, tikvReplicas)
+		if !r.Spec.AllowReplicaMismatch {
+			return nil, tikvReplicasMismatchedReason, fmt.Errorf("tikv replica missmatched")
 		}
+		mismatches = append(mismatches, replicaMismatch("TiKV", clusterTiKVReplicas, tikvReplicas))
+	} else {
+		checks = append(checks, fmt.Sprintf("%d TiKV replicas of tidbcluster %s/%s match the backup meta", clusterTiKVReplicas, tc.Namespace, tc.Name))
+	}
+
+	// the data of the S3 engine is in the object storage, it can't be served by the local engine
+	if reason, err := rm.checkTiKVStorageEngine(r, tc); err != nil {
+		return nil, reason, err
 	}
+	checks = append(checks, fmt.Sprintf("TiKV storage engine of tidbcluster %s/%s matches the backup meta", tc.Namespace, tc.Name))
 
 	// Check recovery mode is on for EBS br across k8s
-	if r.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot && r.Spec.FederalVolumeRestorePhase != v1alpha1.FederalVolumeRestoreFinish && !tc.Spec.RecoveryMode {
-		klog.Errorf("recovery mode is not set for across k8s EBS snapshot restore")
-		return fmt.Errorf("recovery mode is off")
+	if r.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot && r.Spec.FederalVolumeRestorePhase != v1alpha1.FederalVolumeRestoreFinish {
+		if !tc.Spec.RecoveryMode {
+			klog.Errorf("recovery mode is not set for across k8s EBS snapshot restore")
+			return nil, recoveryModeOffReason, fmt.Errorf("recovery mode is off")
+		}
+		checks = append(checks, "recovery mode is on")
 	}
 
 	// check tikv encrypt config
-	if err = rm.checkTiKVEncryption(r, tc); err != nil {
-		return fmt.Errorf("TiKV encryption missmatched with backup with error %v", err)
+	checked, reason, err := rm.checkTiKVEncryption(r, tc)
+	if err != nil {
+		return nil, reason, fmt.Errorf("TiKV encryption missmatched with backup with error %v", err)
 	}
-	return nil
+	if checked {
+		checks = append(checks, "TiKV encryption config is compatible with the backup")
+	}
+
+	// check tiflash encrypt and storage config
+	checked, reason, err = rm.checkTiFlashConfig(r, tc)
+	if err != nil {
+		return nil, reason, err
+	}
+	if checked {
+		checks = append(checks, "TiFlash encryption and storage config is compatible with the backup")
+	}
+
+	// the TiKV volumes are replaced by the restored ones, refuse to destroy the data of a serving cluster
+	if reason, err = rm.checkTargetClusterEmpty(r, tc); err != nil {
+		return nil, reason, err
+	}
+	if !skipTargetClusterEmptyCheck(r, tc) {
+		checks = append(checks, "no TiKV store of the tidbcluster is serving data")
+	}
+
+	if len(mismatches) != 0 {
+		msg := strings.Join(mismatches, "; ")
+		klog.Warningf("restore %s/%s: replica mismatch is allowed, continue the restore and rely on PD to rebalance the regions: %s",
+			r.Namespace, r.Name, msg)
+		rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreReplicasMismatched,
+			Status:  corev1.ConditionTrue,
+			Reason:  "ReplicaMismatchAllowed",
+			Message: msg,
+		}, nil)
+	}
+	return checks, "", nil
+}
+
+// recordValidationResult compares the tidbcluster in the backup meta with the target one and records the
+// result in the status.
+func (rm *restoreManager) recordValidationResult(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
+	if err != nil {
+		return volSnapBackupMetaFailedReason(err), err
+	}
+	result := restoreValidationResult(&metaInfo.KubernetesMeta.TiDBCluster.Spec, &tc.Spec)
+	if err := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{ValidationResult: result}); err != nil {
+		return "UpdateRestoreValidationResultFailed", err
+	}
+	return "", nil
+}
+
+// restoreValidationResult compares the replicas and the encryption config of TiKV and TiFlash of the target
+// tidbcluster with the backup, the same as the checks of validateRestore.
+func restoreValidationResult(backup, restore *v1alpha1.TidbClusterSpec) *v1alpha1.RestoreValidationResult {
+	result := &v1alpha1.RestoreValidationResult{}
+	if backup.TiKV != nil {
+		result.TiKVReplicas.Expected = backup.TiKV.Replicas
+	}
+	if restore.TiKV != nil {
+		result.TiKVReplicas.Actual = restore.TiKV.Replicas
+	}
+	result.TiKVReplicas.Matched = result.TiKVReplicas.Expected == result.TiKVReplicas.Actual
+	if backup.TiFlash != nil {
+		result.TiFlashReplicas.Expected = backup.TiFlash.Replicas
+	}
+	if restore.TiFlash != nil {
+		result.TiFlashReplicas.Actual = restore.TiFlash.Replicas
+	}
+	result.TiFlashReplicas.Matched = result.TiFlashReplicas.Expected == result.TiFlashReplicas.Actual
+
+	if backup.TiKV != nil && backup.TiKV.Config != nil {
+		var restoreConfig *config.GenericConfig
+		if restore.TiKV != nil && restore.TiKV.Config != nil {
+			restoreConfig = restore.TiKV.Config.GenericConfig
+		}
+		result.TiKVEncryption = encryptionValidation(backup.TiKV.Config.GenericConfig, restoreConfig)
+	}
+	if backup.TiFlash != nil && backup.TiFlash.Config != nil && restore.TiFlash != nil && restore.TiFlash.Config != nil {
+		var backupProxy, restoreProxy *config.GenericConfig
+		if backup.TiFlash.Config.Proxy != nil {
+			backupProxy = backup.TiFlash.Config.Proxy.GenericConfig
+		}
+		if restore.TiFlash.Config.Proxy != nil {
+			restoreProxy = restore.TiFlash.Config.Proxy.GenericConfig
+		}
+		result.TiFlashEncryption = encryptionValidation(backupProxy, restoreProxy)
+	}
+	return result
+}
+
+// encryptionValidation compares the data encryption method and the master key id of the restore config with
+// the backup config, they match if the backup isn't encrypted.
+func encryptionValidation(backupConfig, restoreConfig *config.GenericConfig) *v1alpha1.RestoreEncryptionValidation {
+	v := &v1alpha1.RestoreEncryptionValidation{
+		ExpectedMethod:      configString(backupConfig, TiKVConfigEncryptionMethod),
+		ActualMethod:        configString(restoreConfig, TiKVConfigEncryptionMethod),
+		ExpectedMasterKeyID: configString(backupConfig, TiKVConfigEncryptionMasterKeyId),
+		ActualMasterKeyID:   configString(restoreConfig, TiKVConfigEncryptionMasterKeyId),
+	}
+	v.Matched = v.ExpectedMethod == "" || v.ExpectedMethod == "plaintext" ||
+		(v.ExpectedMethod == v.ActualMethod && (v.ExpectedMasterKeyID == "" || v.ExpectedMasterKeyID == v.ActualMasterKeyID))
+	return v
+}
+
+// checkTargetClusterEmpty checks that no TiKV store of the target tidbcluster is up with regions before
+// the TiKV volumes are replaced in volume snapshot restore, unless ForceDestructive is set.
+// It's only checked before the restore job is scheduled, the stores are up with the restored data
+// after that. The check is deferred until PD is ready, the restore job is not created before it.
+func (rm *restoreManager) checkTargetClusterEmpty(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	if skipTargetClusterEmptyCheck(r, tc) {
+		return "", nil
+	}
+
+	storesInfo, err := controller.GetPDClient(rm.deps.PDControl, tc).GetStores()
+	if err != nil {
+		return "GetTiKVStoresFailed", err
+	}
+	var stores []string
+	for _, store := range storesInfo.Stores {
+		if store.Store == nil || store.Status == nil || store.Store.StateName != v1alpha1.TiKVStateUp || store.Status.RegionCount == 0 {
+			continue
+		}
+		stores = append(stores, fmt.Sprintf("store %d (%s) has %d regions", store.Store.GetId(), store.Store.GetAddress(), store.Status.RegionCount))
+	}
+	if len(stores) != 0 {
+		return targetClusterNotEmptyReason, fmt.Errorf("restore %s/%s: tidbcluster %s/%s is serving data, %s, set forceDestructive to replace its TiKV volumes",
+			r.Namespace, r.Name, tc.Namespace, tc.Name, strings.Join(stores, "; "))
+	}
+	return "", nil
+}
+
+// skipTargetClusterEmptyCheck returns true if checkTargetClusterEmpty doesn't check the TiKV stores
+func skipTargetClusterEmptyCheck(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) bool {
+	phase := r.Spec.FederalVolumeRestorePhase
+	return r.Spec.ForceDestructive || (phase != "" && phase != v1alpha1.FederalVolumeRestoreVolume) ||
+		v1alpha1.IsRestoreScheduled(r) || !tc.PDAllMembersReady()
+}
+
+// replicaMismatch describes how the replicas of a component in the target cluster differ from the backup meta.
+func replicaMismatch(component string, clusterReplicas, backupReplicas int32) string {
+	return fmt.Sprintf("tidbcluster has %d %s replicas, backup meta has %d (%+d)",
+		clusterReplicas, component, backupReplicas, clusterReplicas-backupReplicas)
 }
 
 // volume snapshot restore support
@@ -367,34 +1136,34 @@ func (rm *restoreManager) validateRestore(r *v1alpha1.Restore, tc *v1alpha1.Tidb
 // volume snapshot restore does not support
 //
 //	backup has encryption and restore has not
-func (rm *restoreManager) checkTiKVEncryption(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) error {
+func (rm *restoreManager) checkTiKVEncryption(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (bool, string, error) {
 	backupConfig, reason, err := rm.readTiKVConfigFromBackupMeta(r)
 	if err != nil {
 		klog.Errorf("read tiflash replica failure with reason %s", reason)
-		return err
+		return false, reason, err
 	}
 
-	// nothing configured in crd during the backup
+	// nothing configured in crd during the backup, the encryption can't be checked
 	if backupConfig == nil {
-		return nil
+		return false, "", nil
 	}
 
 	// check if encryption is enabled in backup tikv config
 	backupEncryptMethod := backupConfig.Get(TiKVConfigEncryptionMethod)
 	if backupEncryptMethod == nil || backupEncryptMethod.Interface() == "plaintext" {
-		return nil //encryption is disabled
+		return true, "", nil //encryption is disabled
 	}
 
 	// tikv backup encryption is enabled
 	config := tc.Spec.TiKV.Config
 	if config == nil {
-		return fmt.Errorf("TiKV encryption config missmatched, backup configured TiKV encryption, however, restore tc.spec.tikv.config doesn't contains encryption, please check TiKV encryption config. e.g. download s3 backupmeta, check kubernetes.crd_tidb_cluster.spec, and then edit restore tc.")
+		return false, tikvEncryptionMismatchedReason, fmt.Errorf("TiKV encryption config missmatched, backup configured TiKV encryption, however, restore tc.spec.tikv.config doesn't contains encryption, please check TiKV encryption config. e.g. download s3 backupmeta, check kubernetes.crd_tidb_cluster.spec, and then edit restore tc.")
 	}
 
 	restoreEncryptMethod := config.Get(TiKVConfigEncryptionMethod)
 	if backupEncryptMethod.Interface() != restoreEncryptMethod.Interface() {
 		// restore crd must contains data-encryption
-		return fmt.Errorf("TiKV encryption config missmatched, backup data enabled TiKV encryption, restore crd does not enabled TiKV encryption")
+		return false, tikvEncryptionMismatchedReason, fmt.Errorf("TiKV encryption config missmatched, backup data enabled TiKV encryption, restore crd does not enabled TiKV encryption")
 	}
 
 	// if backup tikv configured encryption, restore require tc to have the same encryption configured.
@@ -403,20 +1172,322 @@ func (rm *restoreManager) checkTiKVEncryption(r *v1alpha1.Restore, tc *v1alpha1.
 	if backupMasterKey != nil {
 		restoreMasterKey := config.Get(TiKVConfigEncryptionMasterKeyId)
 		if restoreMasterKey == nil {
-			return fmt.Errorf("TiKV encryption config missmatched, backup data has master key, restore crd have not one")
+			return false, tikvEncryptionMismatchedReason, fmt.Errorf("TiKV encryption config missmatched, backup data has master key, restore crd have not one")
 		}
 
 		if backupMasterKey.Interface() != restoreMasterKey.Interface() {
-			return fmt.Errorf("TiKV encryption config master key missmatched")
+			if !r.Spec.AllowMasterKeyRotation {
+				return false, tikvEncryptionMismatchedReason, fmt.Errorf("TiKV encryption config master key missmatched")
+			}
+			return rm.checkTiKVMasterKeyRotation(r, config, backupMasterKey.Interface(), restoreMasterKey.Interface())
+		}
+	}
+	return true, "", nil
+}
+
+// checkTiKVMasterKeyRotation checks TiKV can rotate the master key of the backup to the one of the restore,
+// which requires the backup master key is configured as the previous master key of TiKV. The allowed
+// rotation is reported by condition MasterKeyRotated.
+func (rm *restoreManager) checkTiKVMasterKeyRotation(r *v1alpha1.Restore, config *v1alpha1.TiKVConfigWraper, backupMasterKey, restoreMasterKey interface{}) (bool, string, error) {
+	previousMasterKey := config.Get(TiKVConfigEncryptionPreviousMasterKeyId)
+	if previousMasterKey == nil || previousMasterKey.Interface() != backupMasterKey {
+		return false, tikvEncryptionMismatchedReason, fmt.Errorf("TiKV encryption config master key missmatched, the master key rotation is allowed, however, restore tc.spec.tikv.config doesn't set %s to the backup master key %v", TiKVConfigEncryptionPreviousMasterKeyId, backupMasterKey)
+	}
+
+	msg := fmt.Sprintf("TiKV encryption master key %v of the backup is rotated to %v, the data keys are re-encrypted when TiKV starts", backupMasterKey, restoreMasterKey)
+	klog.Infof("restore %s/%s: %s", r.Namespace, r.Name, msg)
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreMasterKeyRotated,
+		Status:  corev1.ConditionTrue,
+		Reason:  "MasterKeyRotationAllowed",
+		Message: msg,
+	}, nil); err != nil {
+		return false, "UpdateRestoreMasterKeyRotatedFailed", err
+	}
+	return true, "", nil
+}
+
+// checkTiFlashConfig checks the TiFlash of the tidbcluster can start on the restored TiFlash volumes, the same
+// as TiKV, the encryption of the backup must be configured in the restore, while the restore may enable the
+// encryption the backup hasn't. The data directories are compared if both the backup and the restore set them.
+// It's best-effort, the check is skipped if the backup meta or the tidbcluster has no TiFlash config.
+func (rm *restoreManager) checkTiFlashConfig(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (bool, string, error) {
+	backupConfig, reason, err := rm.readTiFlashConfigFromBackupMeta(r)
+	if err != nil {
+		klog.Errorf("read tiflash config failure with reason %s", reason)
+		return false, reason, err
+	}
+	if backupConfig == nil || tc.Spec.TiFlash == nil || tc.Spec.TiFlash.Config == nil {
+		return false, "", nil
+	}
+	if err := tiflashConfigMismatch(backupConfig, tc.Spec.TiFlash.Config); err != nil {
+		return false, tiflashConfigMismatchedReason, fmt.Errorf("restore %s/%s: %v, please check TiFlash config. e.g. download s3 backupmeta, check kubernetes.crd_tidb_cluster.spec.tiflash.config, and then edit restore tc.", r.Namespace, r.Name, err)
+	}
+	return true, "", nil
+}
+
+// tiflashConfigMismatch returns the first encryption or storage config of TiFlash in the restore that
+// doesn't match the backup
+func tiflashConfigMismatch(backupConfig, restoreConfig *v1alpha1.TiFlashConfigWraper) error {
+	var backupCommon, restoreCommon, backupProxy, restoreProxy *config.GenericConfig
+	if backupConfig.Common != nil {
+		backupCommon = backupConfig.Common.GenericConfig
+	}
+	if restoreConfig.Common != nil {
+		restoreCommon = restoreConfig.Common.GenericConfig
+	}
+	if backupConfig.Proxy != nil {
+		backupProxy = backupConfig.Proxy.GenericConfig
+	}
+	if restoreConfig.Proxy != nil {
+		restoreProxy = restoreConfig.Proxy.GenericConfig
+	}
+
+	mismatch := func(component, key string, backupValue, restoreValue interface{}) error {
+		return fmt.Errorf("TiFlash config mismatched, backup has %s %s = %v, restore tc.spec.tiflash.config has %v",
+			component, key, backupValue, restoreValue)
+	}
+	backupEncryptMethod := configValue(backupProxy, TiKVConfigEncryptionMethod)
+	if backupEncryptMethod != nil && backupEncryptMethod != "plaintext" {
+		restoreEncryptMethod := configValue(restoreProxy, TiKVConfigEncryptionMethod)
+		if !reflect.DeepEqual(backupEncryptMethod, restoreEncryptMethod) {
+			return mismatch("proxy", TiKVConfigEncryptionMethod, backupEncryptMethod, restoreEncryptMethod)
+		}
+		// the master key is unique, checking the key id is enough, the same as TiKV
+		if backupMasterKey := configValue(backupProxy, TiKVConfigEncryptionMasterKeyId); backupMasterKey != nil {
+			restoreMasterKey := configValue(restoreProxy, TiKVConfigEncryptionMasterKeyId)
+			if !reflect.DeepEqual(backupMasterKey, restoreMasterKey) {
+				return mismatch("proxy", TiKVConfigEncryptionMasterKeyId, backupMasterKey, restoreMasterKey)
+			}
 		}
 	}
+
+	// the data directories not set are generated from the storage claims, so they're only compared if both are set
+	backupMainDir := configValue(backupCommon, TiFlashConfigStorageMainDir)
+	restoreMainDir := configValue(restoreCommon, TiFlashConfigStorageMainDir)
+	if backupMainDir != nil && restoreMainDir != nil && !reflect.DeepEqual(backupMainDir, restoreMainDir) {
+		return mismatch("common", TiFlashConfigStorageMainDir, backupMainDir, restoreMainDir)
+	}
 	return nil
 }
 
+// configValue returns the value of the key in the config, it's nil if the key or the config is not set
+func configValue(c *config.GenericConfig, key string) interface{} {
+	v := c.Get(key)
+	if v == nil {
+		return nil
+	}
+	return v.Interface()
+}
+
+// configString returns the value of the key in the config as a string, it's empty if the key or the config is not set
+func configString(c *config.GenericConfig, key string) string {
+	v := configValue(c, key)
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// checkTiKVCapacity checks whether the available capacity of the TiKV stores is enough to hold
+// the restored data, the size of which is read from the backup meta of BR snapshot backup.
+func (rm *restoreManager) checkTiKVCapacity(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	provider := r.Spec.StorageProvider
+	if r.Spec.Mode == v1alpha1.RestoreModePiTR {
+		// the size of log backup is unknown, only check the full backup pitr depends on
+		provider = r.Spec.PitrFullBackupStorageProvider
+	}
+	backupMeta, err := backuputil.GetBRBackupMetaData(provider, rm.storageCredential(r, provider), rm.metaCache.MetaCache, backuputil.GetMetaReadTimeout(r))
+	if err != nil {
+		return "GetBRBackupMetaDataFailed", err
+	}
+	dataSize := backuputil.GetBRBackupDataSize(backupMeta)
+	if dataSize == 0 {
+		msg := "data size is not recorded in the backup meta"
+		if backuputil.IsBRBackupMetaV2(backupMeta) {
+			msg = "data size of the backup meta v2 is not supported"
+		}
+		return rm.skipTiKVCapacityCheck(r, msg)
+	}
+	return rm.checkTiKVAvailableCapacity(r, tc, dataSize)
+}
+
+// checkImportTiKVCapacity checks whether the available capacity of the TiKV stores is enough to hold the data
+// imported by lightning, the size of which is estimated by the size of the dumped data in the storage. The
+// tidbcluster is found by the service of the TiDB host, the check is skipped if the TiDB host isn't the
+// service of a tidbcluster in the kubernetes cluster.
+func (rm *restoreManager) checkImportTiKVCapacity(r *v1alpha1.Restore) (string, error) {
+	if r.Spec.To == nil {
+		return rm.skipTiKVCapacityCheck(r, "the target TiDB is not specified")
+	}
+	ns, svc, ok := tidbService(r.Namespace, r.Spec.To.Host)
+	tcName := strings.TrimSuffix(svc, "-tidb")
+	if !ok || controller.TiDBMemberName(tcName) != svc {
+		return rm.skipTiKVCapacityCheck(r, fmt.Sprintf("TiDB host %s is not the service of a tidbcluster", r.Spec.To.Host))
+	}
+	tc, err := rm.deps.TiDBClusterLister.TidbClusters(ns).Get(tcName)
+	if errors.IsNotFound(err) {
+		return rm.skipTiKVCapacityCheck(r, fmt.Sprintf("tidbcluster %s/%s of TiDB host %s is not found", ns, tcName, r.Spec.To.Host))
+	}
+	if err != nil {
+		return "GetTidbClusterFailed", fmt.Errorf("restore %s/%s get tidbcluster %s/%s failed, err: %v", r.Namespace, r.Name, ns, tcName, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backuputil.GetMetaReadTimeout(r))
+	defer cancel()
+	provider := r.Spec.StorageProvider
+	externalStorage, err := backuputil.NewStorageBackend(provider, rm.storageCredential(r, provider))
+	if err != nil {
+		return "NewStorageBackendFailed", err
+	}
+	defer externalStorage.Close()
+	dataSize, err := externalStorage.TotalObjectSize(ctx, "")
+	if err != nil {
+		return "GetDumpDataSizeFailed", fmt.Errorf("restore %s/%s get the size of the dumped data failed, err: %v", r.Namespace, r.Name, err)
+	}
+	if dataSize == 0 {
+		return rm.skipTiKVCapacityCheck(r, "no dumped data is found in the storage")
+	}
+	return rm.checkTiKVAvailableCapacity(r, tc, dataSize)
+}
+
+// skipTiKVCapacityCheck records why the TiKV capacity can't be checked by condition CheckSkipped,
+// the restore goes on without the check
+func (rm *restoreManager) skipTiKVCapacityCheck(r *v1alpha1.Restore, msg string) (string, error) {
+	klog.Warningf("restore %s/%s: %s, skip checking TiKV capacity", r.Namespace, r.Name, msg)
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreCheckSkipped,
+		Status:  corev1.ConditionTrue,
+		Reason:  "TiKVCapacityCheckSkipped",
+		Message: msg,
+	}, nil); err != nil {
+		return "UpdateRestoreCheckSkippedFailed", err
+	}
+	return "", nil
+}
+
+// checkTiKVAvailableCapacity checks whether the available capacity of the up TiKV stores can hold
+// the data of the size with all its replicas
+func (rm *restoreManager) checkTiKVAvailableCapacity(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster, dataSize uint64) (string, error) {
+	pdClient := controller.GetPDClient(rm.deps.PDControl, tc)
+	config, err := pdClient.GetConfig()
+	if err != nil {
+		return "GetPDConfigFailed", err
+	}
+	maxReplicas := uint64(3)
+	if config.Replication != nil && config.Replication.MaxReplicas != nil {
+		maxReplicas = *config.Replication.MaxReplicas
+	}
+	storesInfo, err := pdClient.GetStores()
+	if err != nil {
+		return "GetTiKVStoresFailed", err
+	}
+
+	var available uint64
+	for _, store := range storesInfo.Stores {
+		if store.Store == nil || store.Status == nil || store.Store.StateName != v1alpha1.TiKVStateUp {
+			continue
+		}
+		available += uint64(store.Status.Available)
+	}
+
+	required := dataSize * maxReplicas
+	if available < required {
+		return insufficientTiKVCapacityReason, fmt.Errorf("restore %s/%s: available capacity %d of TiKV stores in tidbcluster %s/%s is less than the required %d (%d bytes * %d replicas)",
+			r.Namespace, r.Name, available, tc.Namespace, tc.Name, required, dataSize, maxReplicas)
+	}
+	return "", nil
+}
+
+// checkBRVersion checks the BRVersion of the restore is not older than the version of the cluster
+// the backup is taken from, which is read from the backup meta of BR snapshot backup.
+func (rm *restoreManager) checkBRVersion(r *v1alpha1.Restore) (string, error) {
+	provider := r.Spec.StorageProvider
+	if r.Spec.Mode == v1alpha1.RestoreModePiTR {
+		// the version of log backup is unknown, only check the full backup pitr depends on
+		provider = r.Spec.PitrFullBackupStorageProvider
+		if backuputil.GetStorageType(provider) == v1alpha1.BackupStorageTypeUnknown {
+			return "", nil
+		}
+	}
+	backupMeta, err := backuputil.GetBRBackupMetaData(provider, rm.storageCredential(r, provider), rm.metaCache.MetaCache, backuputil.GetMetaReadTimeout(r))
+	if err != nil {
+		// the backup meta may be encrypted or not readable by the controller, BR still checks the version itself
+		klog.Warningf("restore %s/%s: read backup meta failed, skip checking BR version, err: %v", r.Namespace, r.Name, err)
+		return "", nil
+	}
+	backupVersion := backuputil.GetBRBackupClusterVersion(backupMeta)
+	backupSemver, err := semver.NewVersion(backupVersion)
+	if err != nil {
+		klog.Infof("restore %s/%s: cluster version %q in backup meta is not a valid version, skip checking BR version", r.Namespace, r.Name, backupVersion)
+		return "", nil
+	}
+	// brVersion is validated by ValidateRestore before
+	brSemver := semver.MustParse(r.Spec.BRVersion)
+	if brSemver.LessThan(backupSemver) {
+		return brVersionTooOldReason, fmt.Errorf("restore %s/%s: brVersion %s is older than the version %s of the cluster the backup is taken from",
+			r.Namespace, r.Name, r.Spec.BRVersion, backupVersion)
+	}
+	return "", nil
+}
+
+// checkTiKVStoreCount checks the number of Up TiKV stores equals the TiKV replicas recorded in the backup meta,
+// or the TiKV replicas of the cluster if the replica mismatch is allowed,
+// so that a store failing to start after the volume snapshot restore doesn't leave the cluster under-replicated.
+func (rm *restoreManager) checkTiKVStoreCount(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	_, tikvReplicas, reason, err := rm.readTiFlashAndTiKVReplicasFromBackupMeta(r)
+	if err != nil {
+		return reason, err
+	}
+
+	storesInfo, err := controller.GetPDClient(rm.deps.PDControl, tc).GetStores()
+	if err != nil {
+		return "GetTiKVStoresFailed", err
+	}
+	var upStores int32
+	for _, store := range storesInfo.Stores {
+		if store.Store == nil || store.Store.StateName != v1alpha1.TiKVStateUp || isTiFlashStore(store.Store.Store) {
+			continue
+		}
+		upStores++
+	}
+
+	if r.Spec.AllowReplicaMismatch && tc.Spec.TiKV != nil {
+		// the restore goes on with the TiKV replicas of the cluster when the mismatch is allowed
+		tikvReplicas = tc.Spec.TiKV.Replicas
+	}
+	if upStores != tikvReplicas {
+		return "StoreCountMismatchAfterRestore", fmt.Errorf("restore %s/%s: %d TiKV stores are up in tidbcluster %s/%s, backup meta has %d tikv",
+			r.Namespace, r.Name, upStores, tc.Namespace, tc.Name, tikvReplicas)
+	}
+	return "", nil
+}
+
+func isTiFlashStore(store *metapb.Store) bool {
+	if store == nil {
+		return false
+	}
+	for _, l := range store.Labels {
+		if l.Key == "engine" && l.Value == "tiflash" {
+			return true
+		}
+	}
+	return false
+}
+
+// volSnapBackupMetaFailedReason returns the reason of failing to read the volume snapshot backup meta, the meta
+// newer than the operator supports fails the restore instead of being retried
+func volSnapBackupMetaFailedReason(err error) string {
+	if backuputil.IsIncompatibleBackupMetaVersion(err) {
+		return incompatibleBackupMetaVersionReason
+	}
+	return "GetVolSnapBackupMetaData failed"
+}
+
 func (rm *restoreManager) readTiFlashAndTiKVReplicasFromBackupMeta(r *v1alpha1.Restore) (int32, int32, string, error) {
-	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.deps.SecretLister)
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
 	if err != nil {
-		return 0, 0, "GetVolSnapBackupMetaData failed", err
+		return 0, 0, volSnapBackupMetaFailedReason(err), err
 	}
 
 	var tiflashReplicas, tikvReplicas int32
@@ -437,18 +1508,32 @@ func (rm *restoreManager) readTiFlashAndTiKVReplicasFromBackupMeta(r *v1alpha1.R
 }
 
 func (rm *restoreManager) readTiKVConfigFromBackupMeta(r *v1alpha1.Restore) (*v1alpha1.TiKVConfigWraper, string, error) {
-	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.deps.SecretLister)
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
 	if err != nil {
-		return nil, "GetVolSnapBackupMetaData failed", err
+		return nil, volSnapBackupMetaFailedReason(err), err
 	}
 
 	if metaInfo.KubernetesMeta.TiDBCluster.Spec.TiKV == nil {
-		return nil, "BackupMetaDoesnotContainTiKV", fmt.Errorf("TiKV is not configure in backup")
+		return nil, backupMetaDoesnotContainTiKVReason, fmt.Errorf("TiKV is not configure in backup")
 	}
 
 	return metaInfo.KubernetesMeta.TiDBCluster.Spec.TiKV.Config, "", nil
 }
 
+// readTiFlashConfigFromBackupMeta returns the TiFlash config in the backup meta, unlike TiKV it's nil if the
+// backup meta has no TiFlash, the tidbcluster may have no TiFlash.
+func (rm *restoreManager) readTiFlashConfigFromBackupMeta(r *v1alpha1.Restore) (*v1alpha1.TiFlashConfigWraper, string, error) {
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
+	if err != nil {
+		return nil, volSnapBackupMetaFailedReason(err), err
+	}
+
+	if metaInfo.KubernetesMeta.TiDBCluster.Spec.TiFlash == nil {
+		return nil, "", nil
+	}
+	return metaInfo.KubernetesMeta.TiDBCluster.Spec.TiFlash.Config, "", nil
+}
+
 func (rm *restoreManager) volumeSnapshotRestore(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
 	if v1alpha1.IsRestoreComplete(r) {
 		return "", nil
@@ -459,12 +1544,6 @@ func (rm *restoreManager) volumeSnapshotRestore(r *v1alpha1.Restore, tc *v1alpha
 	if r.Spec.FederalVolumeRestorePhase == v1alpha1.FederalVolumeRestoreFinish {
 		klog.Infof("%s/%s restore-manager prepares to deal with the phase restore-finish", ns, name)
 
-		if !tc.Spec.RecoveryMode {
-			klog.Infof("%s/%s recovery mode of tc %s/%s is false, ignore restore-finish phase", ns, name, tc.Namespace, tc.Name)
-			return "", nil
-		}
-		// When restore is based on volume snapshot, we need to restart all TiKV pods
-		// after restore data is complete.
 		sel, err := label.New().Instance(tc.Name).TiKV().Selector()
 		if err != nil {
 			return "BuildTiKVSelectorFailed", err
@@ -473,19 +1552,73 @@ func (rm *restoreManager) volumeSnapshotRestore(r *v1alpha1.Restore, tc *v1alpha
 		if err != nil {
 			return "ListTiKVPodsFailed", err
 		}
-		for _, pod := range pods {
-			if pod.DeletionTimestamp == nil {
-				klog.Infof("%s/%s restore-manager restarts pod %s/%s", ns, name, pod.Namespace, pod.Name)
-				if err := rm.deps.PodControl.DeletePod(tc, pod); err != nil {
-					return "DeleteTiKVPodFailed", err
+		tiflashPods, reason, err := rm.listRestoredTiFlashPods(r, tc)
+		if err != nil {
+			return reason, err
+		}
+
+		if tc.Spec.RecoveryMode {
+			// the TiKV config the restored data depends on is applied before the pods are restarted
+			reconfigured, reason, err := rm.reconfigTiKV(r, tc)
+			if err != nil {
+				return reason, err
+			}
+			tc = reconfigured
+
+			// the placement is patched to tc before the pods are restarted, so they are scheduled with it
+			patched, reason, err := rm.applyRecoveryPlacement(r, tc)
+			if err != nil {
+				return reason, err
+			}
+			tc = patched
+
+			// When restore is based on volume snapshot, we need to restart all TiKV pods
+			// after restore data is complete.
+			if r.Spec.TiKVRestartBatchSize != nil {
+				if reason, err := rm.restartTiKVInBatches(r, tc, pods); err != nil {
+					return reason, err
+				}
+			} else {
+				for _, pod := range pods {
+					if pod.DeletionTimestamp == nil {
+						klog.Infof("%s/%s restore-manager restarts pod %s/%s", ns, name, pod.Namespace, pod.Name)
+						if err := rm.deps.PodControl.DeletePod(tc, pod); err != nil {
+							return "DeleteTiKVPodFailed", err
+						}
+					}
 				}
 			}
+			// the TiFlash restored from the snapshots is restarted after all TiKV pods are restarted
+			if reason, err := rm.restartTiFlash(r, tc, tiflashPods); err != nil {
+				return reason, err
+			}
+
+			tc.Spec.RecoveryMode = false
+			delete(tc.Annotations, label.AnnTiKVVolumesReadyKey)
+			if _, err := rm.deps.TiDBClusterControl.Update(tc); err != nil {
+				return "ClearTCRecoveryMarkFailed", err
+			}
+			return "", controller.ClusterWaitErrorf("restore %s/%s: waiting for TiKV stores up after restart in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
+		}
+		if !v1alpha1.IsRestoreDataComplete(r) {
+			klog.Infof("%s/%s recovery mode of tc %s/%s is false, ignore restore-finish phase", ns, name, tc.Namespace, tc.Name)
+			return "", nil
 		}
 
-		tc.Spec.RecoveryMode = false
-		delete(tc.Annotations, label.AnnTiKVVolumesReadyKey)
-		if _, err := rm.deps.TiDBClusterControl.Update(tc); err != nil {
-			return "ClearTCRecoveryMarkFailed", err
+		// TiKV pods have been restarted, the stores reported by PD are only trusted after all the pods are ready
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil || !podutil.IsPodReady(pod) {
+				return "", controller.ClusterWaitErrorf("restore %s/%s: waiting for TiKV pod %s/%s ready after restart", ns, name, pod.Namespace, pod.Name)
+			}
+		}
+		if err := waitTiFlashReady(r, tiflashPods); err != nil {
+			return "", err
+		}
+		if reason, err := rm.checkTiKVStoreCount(r, tc); err != nil {
+			return reason, err
+		}
+		if reason, err := rm.revertRecoveryPlacement(r, tc); err != nil {
+			return reason, err
 		}
 
 		// restore TidbCluster completed
@@ -495,9 +1628,26 @@ func (rm *restoreManager) volumeSnapshotRestore(r *v1alpha1.Restore, tc *v1alpha
 		}, nil); err != nil {
 			return "UpdateRestoreCompleteFailed", err
 		}
+
+		// the restore meta is only used to prepare the TiKV volumes, failing to delete it should not fail the restore
+		if r.Spec.DeleteRestoreMetaOnComplete && r.Spec.RestoreMetaConfigMap == nil {
+			if reason, err := rm.deleteRestoreMetaFromExternalStorage(r); err != nil {
+				klog.Warningf("%s/%s delete the restore meta from external storage failed, err: %v", ns, name, err)
+				rm.deps.Recorder.Event(r, corev1.EventTypeWarning, reason, err.Error())
+			}
+		}
 		return "", nil
 	}
 
+	if r.Spec.WarmupImages && r.Spec.FederalVolumeRestorePhase == v1alpha1.FederalVolumeRestoreVolume {
+		// the images are pulled while the volumes are restored, the restore doesn't wait for the warmup
+		if v1alpha1.IsRestoreVolumeComplete(r) {
+			rm.finishImageWarmup(r)
+		} else {
+			rm.startImageWarmup(r, tc)
+		}
+	}
+
 	if v1alpha1.IsRestoreVolumeComplete(r) && r.Spec.FederalVolumeRestorePhase == v1alpha1.FederalVolumeRestoreVolume {
 		klog.Infof("%s/%s restore-manager prepares to deal with the phase VolumeComplete", ns, name)
 
@@ -506,19 +1656,41 @@ func (rm *restoreManager) volumeSnapshotRestore(r *v1alpha1.Restore, tc *v1alpha
 			return "", nil
 		}
 
-		s, reason, err := snapshotter.NewSnapshotterForRestore(r.Spec.Mode, rm.deps)
+		// setRestoreVolumeID for all PVs, and reset PVC/PVs,
+		// then commit all PVC/PVs for TiKV restore volumes
+		csb, reason, err := rm.readRestoreMeta(r)
 		if err != nil {
 			return reason, err
 		}
-		// setRestoreVolumeID for all PVs, and reset PVC/PVs,
-		// then commit all PVC/PVs for TiKV restore volumes
-		csb, reason, err := rm.readRestoreMetaFromExternalStorage(r)
+		var backupPVs []*corev1.PersistentVolume
+		if csb.Kubernetes != nil {
+			backupPVs = csb.Kubernetes.PVs
+		}
+		s, reason, err := rm.newRestoreSnapshotter(r, backupPVs)
 		if err != nil {
 			return reason, err
 		}
 
+		// the AZ plan is computed once, the retries place the volumes the same way
+		if r.Status.VolumeAZPlan == nil {
+			plan := snapshotter.GenerateVolumeAZPlan(r, backupPVs)
+			if len(plan) > 0 {
+				if err := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+					VolumeAZPlan: plan,
+				}); err != nil {
+					return "UpdateVolumeAZPlanFailed", err
+				}
+				r.Status.VolumeAZPlan = plan
+			}
+		}
+
 		if reason, err := s.PrepareRestoreMetadata(r, csb); err != nil {
-			return reason, err
+			return rm.handleOrphanedVolumes(r, s, csb, reason, err)
+		}
+
+		// the volumes are torn down in the rehearsal, TiKV must not be started on them
+		if r.Spec.VolumeRehearsal {
+			return rm.volumeRehearsal(r, tc)
 		}
 
 		restoreMark := fmt.Sprintf("%s/%s", r.Namespace, r.Name)
@@ -539,9 +1711,16 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 	ns := restore.GetNamespace()
 	name := restore.GetName()
 
-	envVars, reason, err := backuputil.GenerateTidbPasswordEnv(ns, name, restore.Spec.To.SecretName, restore.Spec.UseKMS, rm.deps.SecretLister)
-	if err != nil {
-		return nil, reason, err
+	var (
+		envVars []corev1.EnvVar
+		reason  string
+		err     error
+	)
+	if !restore.Spec.TiDBPasswordFromFile {
+		envVars, reason, err = backuputil.GenerateTidbPasswordEnv(ns, name, restore.Spec.To.SecretName, restore.Spec.UseKMS, rm.deps.SecretLister)
+		if err != nil {
+			return nil, reason, err
+		}
 	}
 
 	storageEnv, reason, err := backuputil.GenerateStorageCertEnv(ns, restore.Spec.UseKMS, restore.Spec.StorageProvider, rm.deps.SecretLister)
@@ -549,9 +1728,19 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
 	}
 
-	backupPath, reason, err := backuputil.GetBackupDataPath(restore.Spec.StorageProvider)
-	if err != nil {
-		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+	logical := restore.Spec.Mode == v1alpha1.RestoreModeLogical
+	var backupPath string
+	if logical {
+		// lightning reads the dump from the storage directly
+		backupPath, err = backuputil.GenLightningDataSource(restore.Spec.StorageProvider)
+		if err != nil {
+			return nil, backuputil.UnsupportedStorageTypeReason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+		}
+	} else {
+		backupPath, reason, err = backuputil.GetBackupDataPath(restore.Spec.StorageProvider)
+		if err != nil {
+			return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+		}
 	}
 
 	envVars = append(envVars, storageEnv...)
@@ -564,28 +1753,27 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 		fmt.Sprintf("--restoreName=%s", name),
 		fmt.Sprintf("--backupPath=%s", backupPath),
 	}
-
-	volumeMounts := []corev1.VolumeMount{}
-	volumes := []corev1.Volume{}
-	initContainers := []corev1.Container{}
+	if logical {
+		args = append(args, fmt.Sprintf("--mode=%s", restore.Spec.Mode))
+	}
 
 	if restore.Spec.To.TLSClientSecretName != nil {
 		args = append(args, "--client-tls=true")
-		clientSecretName := *restore.Spec.To.TLSClientSecretName
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      "tidb-client-tls",
-			ReadOnly:  true,
-			MountPath: util.TiDBClientTLSPath,
-		})
-		volumes = append(volumes, corev1.Volume{
-			Name: "tidb-client-tls",
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName: clientSecretName,
-				},
-			},
-		})
 	}
+	volumeMounts, volumes, reason, err := rm.makeTLSVolumes(restore, nil)
+	if err != nil {
+		return nil, reason, err
+	}
+	if restore.Spec.TiDBPasswordFromFile {
+		volume, volumeMount, reason, err := backuputil.GenerateTidbPasswordVolume(ns, name, restore.Spec.To.SecretName, rm.deps.SecretLister)
+		if err != nil {
+			return nil, reason, err
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+		args = append(args, fmt.Sprintf("--tidb-password-file=%s", constants.TidbPasswordFile))
+	}
+	initContainers := []corev1.Container{}
 
 	if restore.Spec.ToolImage != "" {
 		lightningVolumeMount := corev1.VolumeMount{
@@ -605,13 +1793,13 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 			Image:           restore.Spec.ToolImage,
 			Command:         []string{"/bin/sh", "-c"},
 			Args:            []string{fmt.Sprintf("cp /tidb-lightning %s/tidb-lightning; echo 'tidb-lightning copy finished'", util.LightningBinPath)},
-			ImagePullPolicy: corev1.PullIfNotPresent,
+			ImagePullPolicy: restore.GetImagePullPolicy(),
 			VolumeMounts:    []corev1.VolumeMount{lightningVolumeMount},
-			Resources:       restore.Spec.ResourceRequirements,
+			Resources:       restore.GetInitContainerResources(),
 		})
 	}
 
-	jobLabels := util.CombineStringMap(label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(name), restore.Labels)
+	jobLabels := util.CombineStringMap(label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(name).RestoreGeneration(restore.Generation).CorrelationID(restore.GetCorrelationID()), restore.Labels)
 	podLabels := jobLabels
 	jobAnnotations := restore.Annotations
 	podAnnotations := jobAnnotations
@@ -620,6 +1808,34 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 	if restore.Spec.ServiceAccount != "" {
 		serviceAccount = restore.Spec.ServiceAccount
 	}
+	if restore.Spec.Azblob != nil && restore.Spec.Azblob.UseWorkloadIdentity {
+		identityEnv, volume, volumeMount, reason, err := rm.azblobWorkloadIdentity(ns, serviceAccount)
+		if err != nil {
+			return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+		}
+		envVars = append(envVars, identityEnv...)
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+	}
+	if restore.Spec.CABundleSecretName != "" {
+		caEnv, volume, volumeMount, reason, err := rm.storageCABundle(restore)
+		if err != nil {
+			return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+		}
+		envVars = append(envVars, caEnv...)
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+	}
+
+	// the dump is downloaded to the restore pvc, except the logical restore which needs no pvc
+	restoreVolumeSource := corev1.VolumeSource{
+		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: restore.GetRestorePVCName(),
+		},
+	}
+	if logical {
+		restoreVolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	}
 
 	podSpec := &corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
@@ -633,9 +1849,9 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 			Containers: []corev1.Container{
 				{
 					Name:            label.RestoreJobLabelVal,
-					Image:           rm.deps.CLIConfig.TiDBBackupManagerImage,
+					Image:           rm.backupManagerImage(restore),
 					Args:            args,
-					ImagePullPolicy: corev1.PullIfNotPresent,
+					ImagePullPolicy: restore.GetImagePullPolicy(),
 					VolumeMounts: append([]corev1.VolumeMount{
 						{Name: label.RestoreJobLabelVal, MountPath: constants.BackupRootPath},
 					}, volumeMounts...),
@@ -647,20 +1863,24 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 			Tolerations:      restore.Spec.Tolerations,
 			ImagePullSecrets: restore.Spec.ImagePullSecrets,
 			Affinity:         restore.Spec.Affinity,
+			NodeSelector:     restore.Spec.NodeSelector,
+			DNSConfig:        restore.Spec.DNSConfig,
+			DNSPolicy:        restore.Spec.DNSPolicy,
+			HostAliases:      restore.Spec.HostAliases,
 			Volumes: append([]corev1.Volume{
 				{
-					Name: label.RestoreJobLabelVal,
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: restore.GetRestorePVCName(),
-						},
-					},
+					Name:         label.RestoreJobLabelVal,
+					VolumeSource: restoreVolumeSource,
 				},
 			}, volumes...),
 			PriorityClassName: restore.Spec.PriorityClassName,
 		},
 	}
 
+	if reason, err := addAdditionalContainers(restore, &podSpec.Spec); err != nil {
+		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+	}
+
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        restore.GetRestoreJobName(),
@@ -672,10 +1892,13 @@ func (rm *restoreManager) makeImportJob(restore *v1alpha1.Restore) (*batchv1.Job
 			},
 		},
 		Spec: batchv1.JobSpec{
-			BackoffLimit: pointer.Int32Ptr(0),
-			Template:     *podSpec,
+			BackoffLimit:            pointer.Int32Ptr(restore.GetBackoffLimit()),
+			ActiveDeadlineSeconds:   restore.Spec.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: restore.Spec.TTLSecondsAfterFinished,
+			Template:                *podSpec,
 		},
 	}
+	shardImportJob(restore, job)
 
 	return job, "", nil
 }
@@ -687,26 +1910,34 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 	if restore.Spec.BR.ClusterNamespace != "" {
 		restoreNamespace = restore.Spec.BR.ClusterNamespace
 	}
-	tc, err := rm.deps.TiDBClusterLister.TidbClusters(restoreNamespace).Get(restore.Spec.BR.Cluster)
+	tc, err := rm.getRestoreTC(restore, restoreNamespace)
 	if err != nil {
 		return nil, fmt.Sprintf("failed to fetch tidbcluster %s/%s", restoreNamespace, restore.Spec.BR.Cluster), err
 	}
+	// the secrets and the service account referenced by the job are in the namespace of the job
+	jobNS := restore.GetRestoreJobNamespace()
 
 	var (
 		envVars []corev1.EnvVar
 		reason  string
 	)
-	if restore.Spec.To != nil {
-		envVars, reason, err = backuputil.GenerateTidbPasswordEnv(ns, name, restore.Spec.To.SecretName, restore.Spec.UseKMS, rm.deps.SecretLister)
+	if restore.Spec.To != nil && !restore.Spec.TiDBPasswordFromFile {
+		envVars, reason, err = backuputil.GenerateTidbPasswordEnv(jobNS, name, restore.Spec.To.SecretName, restore.Spec.UseKMS, rm.deps.SecretLister)
 		if err != nil {
 			return nil, reason, err
 		}
 	}
 
-	storageEnv, reason, err := backuputil.GenerateStorageCertEnv(ns, restore.Spec.UseKMS, restore.Spec.StorageProvider, rm.deps.SecretLister)
+	storageEnv, reason, err := backuputil.GenerateStorageCertEnv(jobNS, restore.Spec.UseKMS, restore.Spec.StorageProvider, rm.deps.SecretLister)
 	if err != nil {
 		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
 	}
+	// the credentials of every storage if the fallback storages are configured
+	fallbackEnv, reason, err := backuputil.GenerateRestoreStorageEnv(jobNS, restore, rm.deps.SecretLister)
+	if err != nil {
+		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+	}
+	storageEnv = append(storageEnv, fallbackEnv...)
 
 	envVars = append(envVars, storageEnv...)
 	envVars = append(envVars, corev1.EnvVar{
@@ -721,7 +1952,7 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 		fmt.Sprintf("--namespace=%s", ns),
 		fmt.Sprintf("--restoreName=%s", name),
 	}
-	tikvImage := tc.TiKVImage()
+	tikvImage := restoreBRTiKVImage(restore, tc.TiKVImage())
 	_, tikvVersion := backuputil.ParseImage(tikvImage)
 	if tikvVersion != "" {
 		args = append(args, fmt.Sprintf("--tikvVersion=%s", tikvVersion))
@@ -733,59 +1964,46 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 		args = append(args, fmt.Sprintf("--pitrRestoredTs=%s", restore.Spec.PitrRestoredTs))
 	case v1alpha1.RestoreModeVolumeSnapshot:
 		args = append(args, fmt.Sprintf("--mode=%s", v1alpha1.RestoreModeVolumeSnapshot))
+		args = append(args, fmt.Sprintf("--volumeType=%s", rm.restoreVolumeType(tc)))
 		if !v1alpha1.IsRestoreVolumeComplete(restore) {
 			args = append(args, "--prepare")
-			if restore.Spec.VolumeAZ != "" {
-				args = append(args, fmt.Sprintf("--target-az=%s", restore.Spec.VolumeAZ))
+			if volumeAZ := restore.GetVolumeAZ(); volumeAZ != "" {
+				args = append(args, fmt.Sprintf("--target-az=%s", volumeAZ))
 			}
 		}
 	default:
 		args = append(args, fmt.Sprintf("--mode=%s", v1alpha1.RestoreModeSnapshot))
+		if restore.Spec.Checksum != nil {
+			args = append(args, fmt.Sprintf("--checksum=%t", *restore.Spec.Checksum))
+		}
 	}
 
-	jobLabels := util.CombineStringMap(label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(name), restore.Labels)
+	jobLabels := util.CombineStringMap(label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(name).RestoreGeneration(restore.Generation).CorrelationID(restore.GetCorrelationID()), restore.Labels)
 	podLabels := jobLabels
 	jobAnnotations := restore.Annotations
 	podAnnotations := jobAnnotations
 
-	volumeMounts := []corev1.VolumeMount{}
-	volumes := []corev1.Volume{}
 	if tc.IsTLSClusterEnabled() {
 		args = append(args, "--cluster-tls=true")
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      util.ClusterClientVolName,
-			ReadOnly:  true,
-			MountPath: util.ClusterClientTLSPath,
-		})
-		volumes = append(volumes, corev1.Volume{
-			Name: util.ClusterClientVolName,
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName: util.ClusterClientTLSSecretName(restore.Spec.BR.Cluster),
-				},
-			},
-		})
 	}
-
-	if restore.Spec.To != nil && tc.Spec.TiDB != nil && tc.Spec.TiDB.TLSClient != nil && tc.Spec.TiDB.TLSClient.Enabled && !tc.SkipTLSWhenConnectTiDB() {
+	if tidbClientTLSEnabled(restore, tc) {
 		args = append(args, "--client-tls=true")
 		if tc.Spec.TiDB.TLSClient.SkipInternalClientCA {
 			args = append(args, "--skipClientCA=true")
 		}
-
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      "tidb-client-tls",
-			ReadOnly:  true,
-			MountPath: util.TiDBClientTLSPath,
-		})
-		volumes = append(volumes, corev1.Volume{
-			Name: "tidb-client-tls",
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName: util.TiDBClientTLSSecretName(restore.Spec.BR.Cluster, restore.Spec.To.TLSClientSecretName),
-				},
-			},
-		})
+	}
+	volumeMounts, volumes, reason, err := rm.makeTLSVolumes(restore, tc)
+	if err != nil {
+		return nil, reason, err
+	}
+	if restore.Spec.To != nil && restore.Spec.TiDBPasswordFromFile {
+		volume, volumeMount, reason, err := backuputil.GenerateTidbPasswordVolume(jobNS, name, restore.Spec.To.SecretName, rm.deps.SecretLister)
+		if err != nil {
+			return nil, reason, err
+		}
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+		args = append(args, fmt.Sprintf("--tidb-password-file=%s", constants.TidbPasswordFile))
 	}
 
 	brVolumeMount := corev1.VolumeMount{
@@ -793,14 +2011,20 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 		ReadOnly:  false,
 		MountPath: util.BRBinPath,
 	}
-	volumeMounts = append(volumeMounts, brVolumeMount)
+	if restore.Spec.BundledBR {
+		args = append(args, "--bundledBR=true")
+	}
+	// the br-bin volume is still needed by volume-snapshot restore to store the cloud snapshot backup meta
+	if !restore.Spec.BundledBR || restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+		volumeMounts = append(volumeMounts, brVolumeMount)
 
-	volumes = append(volumes, corev1.Volume{
-		Name: "br-bin",
-		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
-		},
-	})
+		volumes = append(volumes, corev1.Volume{
+			Name: "br-bin",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
 
 	// mount volumes if specified
 	if restore.Spec.Local != nil {
@@ -812,15 +2036,23 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 	if restore.Spec.ServiceAccount != "" {
 		serviceAccount = restore.Spec.ServiceAccount
 	}
-
-	brImage := "pingcap/br:" + tikvVersion
-	if restore.Spec.ToolImage != "" {
-		toolImage := restore.Spec.ToolImage
-		if !strings.ContainsRune(toolImage, ':') {
-			toolImage = fmt.Sprintf("%s:%s", toolImage, tikvVersion)
+	if restore.Spec.Azblob != nil && restore.Spec.Azblob.UseWorkloadIdentity {
+		identityEnv, volume, volumeMount, reason, err := rm.azblobWorkloadIdentity(jobNS, serviceAccount)
+		if err != nil {
+			return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
 		}
-
-		brImage = toolImage
+		envVars = append(envVars, identityEnv...)
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
+	}
+	if restore.Spec.CABundleSecretName != "" {
+		caEnv, volume, volumeMount, reason, err := rm.storageCABundle(restore)
+		if err != nil {
+			return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+		}
+		envVars = append(envVars, caEnv...)
+		volumes = append(volumes, volume)
+		volumeMounts = append(volumeMounts, volumeMount)
 	}
 
 	podSpec := &corev1.PodTemplateSpec{
@@ -831,23 +2063,12 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 		Spec: corev1.PodSpec{
 			SecurityContext:    restore.Spec.PodSecurityContext,
 			ServiceAccountName: serviceAccount,
-			InitContainers: []corev1.Container{
-				{
-					Name:            "br",
-					Image:           brImage,
-					Command:         []string{"/bin/sh", "-c"},
-					Args:            []string{fmt.Sprintf("cp /br %s/br; echo 'BR copy finished'", util.BRBinPath)},
-					ImagePullPolicy: corev1.PullIfNotPresent,
-					VolumeMounts:    []corev1.VolumeMount{brVolumeMount},
-					Resources:       restore.Spec.ResourceRequirements,
-				},
-			},
 			Containers: []corev1.Container{
 				{
 					Name:            label.RestoreJobLabelVal,
-					Image:           rm.deps.CLIConfig.TiDBBackupManagerImage,
+					Image:           rm.backupManagerImage(restore),
 					Args:            args,
-					ImagePullPolicy: corev1.PullIfNotPresent,
+					ImagePullPolicy: restore.GetImagePullPolicy(),
 					VolumeMounts:    volumeMounts,
 					Env:             util.AppendEnvIfPresent(envVars, "TZ"),
 					Resources:       restore.Spec.ResourceRequirements,
@@ -857,30 +2078,178 @@ func (rm *restoreManager) makeRestoreJob(restore *v1alpha1.Restore) (*batchv1.Jo
 			Tolerations:       restore.Spec.Tolerations,
 			ImagePullSecrets:  restore.Spec.ImagePullSecrets,
 			Affinity:          restore.Spec.Affinity,
+			NodeSelector:      restore.Spec.NodeSelector,
+			DNSConfig:         restore.Spec.DNSConfig,
+			DNSPolicy:         restore.Spec.DNSPolicy,
+			HostAliases:       restore.Spec.HostAliases,
 			Volumes:           volumes,
 			PriorityClassName: restore.Spec.PriorityClassName,
 		},
 	}
 
+	if !restore.Spec.BundledBR {
+		brImage := restoreBRImage(restore, tikvImage)
+		if err := backuputil.ValidateImage(brImage); err != nil {
+			return nil, "InvalidBRImage", fmt.Errorf("restore %s/%s: %v", ns, name, err)
+		}
+
+		podSpec.Spec.InitContainers = []corev1.Container{
+			{
+				Name:            "br",
+				Image:           brImage,
+				Command:         []string{"/bin/sh", "-c"},
+				Args:            []string{fmt.Sprintf("cp /br %s/br; echo 'BR copy finished'", util.BRBinPath)},
+				ImagePullPolicy: restore.GetImagePullPolicy(),
+				VolumeMounts:    []corev1.VolumeMount{brVolumeMount},
+				Resources:       restore.GetInitContainerResources(),
+			},
+		}
+	}
+
+	if reason, err := addAdditionalContainers(restore, &podSpec.Spec); err != nil {
+		return nil, reason, fmt.Errorf("restore %s/%s, %v", ns, name, err)
+	}
+
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        restore.GetRestoreJobName(),
-			Namespace:   ns,
-			Labels:      jobLabels,
-			Annotations: jobAnnotations,
-			OwnerReferences: []metav1.OwnerReference{
-				controller.GetRestoreOwnerRef(restore),
-			},
+			Name:            restore.GetRestoreJobName(),
+			Namespace:       jobNS,
+			Labels:          jobLabels,
+			Annotations:     jobAnnotations,
+			OwnerReferences: restoreJobOwnerRefs(restore),
 		},
 		Spec: batchv1.JobSpec{
-			BackoffLimit: pointer.Int32Ptr(0),
-			Template:     *podSpec,
+			BackoffLimit:            pointer.Int32Ptr(restore.GetBackoffLimit()),
+			ActiveDeadlineSeconds:   restore.Spec.ActiveDeadlineSeconds,
+			TTLSecondsAfterFinished: restore.Spec.TTLSecondsAfterFinished,
+			Template:                *podSpec,
 		},
 	}
 
 	return job, "", nil
 }
 
+// checkTLSSecretExist checks whether the TLS secret mounted into the restore pod exists, the pod
+// can't start with an opaque mount error if it is missing
+func (rm *restoreManager) checkTLSSecretExist(ns, name, secretName string) (string, error) {
+	_, err := rm.deps.SecretLister.Secrets(ns).Get(secretName)
+	if errors.IsNotFound(err) {
+		return "TLSSecretNotFound", fmt.Errorf("restore %s/%s, TLS secret %s/%s is not found", ns, name, ns, secretName)
+	}
+	if err != nil {
+		return "GetTLSSecretFailed", fmt.Errorf("restore %s/%s, get TLS secret %s/%s failed, err: %v", ns, name, ns, secretName, err)
+	}
+	return "", nil
+}
+
+// tidbClientTLSEnabled returns whether the BR restore connects to TiDB with TLS
+func tidbClientTLSEnabled(restore *v1alpha1.Restore, tc *v1alpha1.TidbCluster) bool {
+	return restore.Spec.To != nil && tc.Spec.TiDB != nil && tc.Spec.TiDB.TLSClient != nil && tc.Spec.TiDB.TLSClient.Enabled && !tc.SkipTLSWhenConnectTiDB()
+}
+
+// makeTLSVolumes returns the mounts and the volumes of the TLS secrets used to connect to the tidbcluster and TiDB,
+// tc is nil for the restore by lightning, which only connects to TiDB. The secrets must exist.
+func (rm *restoreManager) makeTLSVolumes(restore *v1alpha1.Restore, tc *v1alpha1.TidbCluster) ([]corev1.VolumeMount, []corev1.Volume, string, error) {
+	ns := restore.GetRestoreJobNamespace()
+	name := restore.GetName()
+	volumeMounts := []corev1.VolumeMount{}
+	volumes := []corev1.Volume{}
+	addSecret := func(volumeName, mountPath, secretName string) (string, error) {
+		if reason, err := rm.checkTLSSecretExist(ns, name, secretName); err != nil {
+			return reason, err
+		}
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			ReadOnly:  true,
+			MountPath: mountPath,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+				},
+			},
+		})
+		return "", nil
+	}
+
+	if tc == nil {
+		if restore.Spec.To != nil && restore.Spec.To.TLSClientSecretName != nil {
+			if reason, err := addSecret("tidb-client-tls", util.TiDBClientTLSPath, *restore.Spec.To.TLSClientSecretName); err != nil {
+				return nil, nil, reason, err
+			}
+		}
+		return volumeMounts, volumes, "", nil
+	}
+
+	if tc.IsTLSClusterEnabled() {
+		if reason, err := addSecret(util.ClusterClientVolName, util.ClusterClientTLSPath, util.ClusterClientTLSSecretName(restore.Spec.BR.Cluster)); err != nil {
+			return nil, nil, reason, err
+		}
+	}
+	if tidbClientTLSEnabled(restore, tc) {
+		clientSecretName := util.TiDBClientTLSSecretName(restore.Spec.BR.Cluster, restore.Spec.To.TLSClientSecretName)
+		if reason, err := addSecret("tidb-client-tls", util.TiDBClientTLSPath, clientSecretName); err != nil {
+			return nil, nil, reason, err
+		}
+	}
+	return volumeMounts, volumes, "", nil
+}
+
+// restoreBRTiKVImage returns the TiKV image whose tag is the version of BR used by the restore,
+// it's the TiKV image of the cluster with the tag replaced by BRVersion if it's set.
+func restoreBRTiKVImage(restore *v1alpha1.Restore, tikvImage string) string {
+	if restore.Spec.BRVersion == "" {
+		return tikvImage
+	}
+	return backuputil.GetImageWithTag(tikvImage, restore.Spec.BRVersion)
+}
+
+// backupManagerImage returns the backup-manager image of the jobs of the restore, BackupManagerImage of the restore
+// takes precedence over the one of the operator
+func (rm *restoreManager) backupManagerImage(r *v1alpha1.Restore) string {
+	if r.Spec.BackupManagerImage != "" {
+		return r.Spec.BackupManagerImage
+	}
+	return rm.deps.CLIConfig.TiDBBackupManagerImage
+}
+
+// restoreBRImage returns the BR image of the restore job, the precedence is ToolImage > BRImageRegistry > the registry of TiKV
+func restoreBRImage(restore *v1alpha1.Restore, tikvImage string) string {
+	if toolImage := restore.Spec.ToolImage; toolImage != "" {
+		if !strings.ContainsRune(toolImage, ':') {
+			_, tikvVersion := backuputil.ParseImage(tikvImage)
+			toolImage = fmt.Sprintf("%s:%s", toolImage, tikvVersion)
+		}
+		return toolImage
+	}
+	if restore.Spec.BRImageRegistry != "" {
+		return backuputil.GetBRImageInRegistry(restore.Spec.BRImageRegistry, tikvImage)
+	}
+	return backuputil.GetBRImage(tikvImage)
+}
+
+// addAdditionalContainers adds the AdditionalContainers and AdditionalVolumes of the restore to the pod spec,
+// the containers with the same names as the generated ones are merged into them by strategic merge patch.
+func addAdditionalContainers(restore *v1alpha1.Restore, podSpec *corev1.PodSpec) (string, error) {
+	containers, err := util.MergePatchContainers(podSpec.Containers, restore.Spec.AdditionalContainers)
+	if err != nil {
+		return "MergeAdditionalContainersFailed", err
+	}
+	podSpec.Containers = containers
+
+	for _, vol := range restore.Spec.AdditionalVolumes {
+		for _, existing := range podSpec.Volumes {
+			if vol.Name == existing.Name {
+				return "AdditionalVolumeConflict", fmt.Errorf("additional volume %s conflicts with the volume generated by the operator", vol.Name)
+			}
+		}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, restore.Spec.AdditionalVolumes...)
+	return "", nil
+}
+
 func (rm *restoreManager) ensureRestorePVCExist(restore *v1alpha1.Restore) (string, error) {
 	ns := restore.GetNamespace()
 	name := restore.GetName()
@@ -894,17 +2263,27 @@ func (rm *restoreManager) ensureRestorePVCExist(restore *v1alpha1.Restore) (stri
 		errMsg := fmt.Errorf("backup %s/%s parse storage size %s failed, err: %v", ns, name, constants.DefaultStorageSize, err)
 		return "ParseStorageSizeFailed", errMsg
 	}
+	if reason, err := rm.checkMaxRestoreStorageSize(restore, rs); err != nil {
+		return reason, err
+	}
 
 	restorePVCName := restore.GetRestorePVCName()
 	pvc, err := rm.deps.PVCLister.PersistentVolumeClaims(ns).Get(restorePVCName)
 	if err != nil {
 		// get the object from the local cache, the error can only be IsNotFound,
 		// so we need to create PVC for restore job
+		storageClassName, reason, err := rm.restoreStorageClassName(restore)
+		if err != nil {
+			return reason, err
+		}
 		pvc := &corev1.PersistentVolumeClaim{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      restorePVCName,
 				Namespace: ns,
-				Labels:    label.NewRestore().Instance(restore.GetInstanceName()),
+				Labels:    label.NewRestore().Instance(restore.GetInstanceName()).Restore(name).CorrelationID(restore.GetCorrelationID()),
+				Annotations: map[string]string{
+					label.AnnRestoreUIDKey: string(restore.UID),
+				},
 			},
 			Spec: corev1.PersistentVolumeClaimSpec{
 				AccessModes: []corev1.PersistentVolumeAccessMode{
@@ -915,19 +2294,265 @@ func (rm *restoreManager) ensureRestorePVCExist(restore *v1alpha1.Restore) (stri
 						corev1.ResourceStorage: rs,
 					},
 				},
-				StorageClassName: restore.Spec.StorageClassName,
+				StorageClassName: storageClassName,
 			},
 		}
 		if err := rm.deps.GeneralPVCControl.CreatePVC(restore, pvc); err != nil {
 			errMsg := fmt.Errorf(" %s/%s create restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
 			return "CreatePVCFailed", errMsg
 		}
+	} else if owner, owned := restorePVCOwner(pvc, restore); !owned {
+		if !restore.Spec.RecreateStaleRestorePVC {
+			return "PVCOwnedByAnotherRestore", fmt.Errorf("%s/%s's restore pvc %s is owned by restore %s, please delete it or set recreateStaleRestorePVC to continue", ns, name, pvc.GetName(), owner)
+		}
+		if pvc.DeletionTimestamp == nil {
+			klog.Infof("%s/%s's restore pvc %s is owned by restore %s, delete it to recreate", ns, name, pvc.GetName(), owner)
+			if err := rm.deps.PVCControl.DeletePVC(restore, pvc); err != nil && !errors.IsNotFound(err) {
+				return "DeleteStalePVCFailed", fmt.Errorf("%s/%s delete stale restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+			}
+		}
+		return "", controller.RequeueErrorf("%s/%s waiting for stale restore pvc %s deleted", ns, name, pvc.GetName())
 	} else if pvcRs := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; pvcRs.Cmp(rs) == -1 {
-		return "PVCStorageSizeTooSmall", fmt.Errorf("%s/%s's restore pvc %s's storage size %s is less than expected storage size %s, please delete old pvc to continue", ns, name, pvc.GetName(), pvcRs.String(), rs.String())
+		return rm.resizeRestorePVC(restore, pvc, rs)
+	} else if isRestorePVCResizing(pvc) {
+		return "", controller.RequeueErrorf("%s/%s waiting for restore pvc %s resized to %s", ns, name, pvc.GetName(), pvcRs.String())
+	}
+	return "", nil
+}
+
+// checkMaxRestoreStorageSize checks the storage size of the restore pvc against the max storage size configured
+// for tidb-operator, so a restore can't exhaust the storage pool by an oversized pvc
+func (rm *restoreManager) checkMaxRestoreStorageSize(restore *v1alpha1.Restore, rs resource.Quantity) (string, error) {
+	if rm.deps.CLIConfig == nil || rm.deps.CLIConfig.MaxRestoreStorageSize == "" {
+		return "", nil
+	}
+	limit, err := resource.ParseQuantity(rm.deps.CLIConfig.MaxRestoreStorageSize)
+	if err != nil {
+		return "ParseMaxRestoreStorageSizeFailed", fmt.Errorf("parse the max restore storage size %s failed, err: %v", rm.deps.CLIConfig.MaxRestoreStorageSize, err)
+	}
+	if rs.Cmp(limit) > 0 {
+		return storageSizeExceedsLimitReason, fmt.Errorf("%s/%s storage size %s exceeds the limit %s, please request a smaller restore pvc", restore.Namespace, restore.Name, rs.String(), limit.String())
 	}
 	return "", nil
 }
 
+// restoreStorageClassName returns the storage class of the restore pvc, which is the one specified in the restore
+// or the default of tidb-operator. If neither is set, the default storage class of the kubernetes cluster is used
+// and the restore fails with NoStorageClassAvailable if there is none, instead of creating a pvc never bound.
+func (rm *restoreManager) restoreStorageClassName(restore *v1alpha1.Restore) (*string, string, error) {
+	if restore.Spec.StorageClassName != nil {
+		return restore.Spec.StorageClassName, "", nil
+	}
+	if rm.deps.CLIConfig != nil && rm.deps.CLIConfig.RestoreStorageClassName != "" {
+		return pointer.StringPtr(rm.deps.CLIConfig.RestoreStorageClassName), "", nil
+	}
+	// the default storage class can't be checked without the permission for storage classes
+	if rm.deps.StorageClassLister == nil {
+		return nil, "", nil
+	}
+	scs, err := rm.deps.StorageClassLister.List(labels.Everything())
+	if err != nil {
+		return nil, "ListStorageClassFailed", fmt.Errorf("%s/%s list storage classes failed, err: %v", restore.Namespace, restore.Name, err)
+	}
+	for _, sc := range scs {
+		if sc.Annotations[isDefaultStorageClassAnnotation] == "true" || sc.Annotations[betaIsDefaultStorageClassAnnotation] == "true" {
+			return nil, "", nil
+		}
+	}
+	return nil, "NoStorageClassAvailable", fmt.Errorf("%s/%s storageClassName of the restore is not set and there is no default storage class in the kubernetes cluster, please set storageClassName", restore.Namespace, restore.Name)
+}
+
+// resizeRestorePVC expands the restore pvc smaller than the expected storage size in place if its storage class
+// allows volume expansion, otherwise the pvc has to be deleted by the user.
+func (rm *restoreManager) resizeRestorePVC(restore *v1alpha1.Restore, pvc *corev1.PersistentVolumeClaim, rs resource.Quantity) (string, error) {
+	ns := restore.GetNamespace()
+	name := restore.GetName()
+	pvcRs := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+
+	expandable, err := rm.isVolumeExpansionSupported(pvc)
+	if err != nil {
+		return "GetStorageClassFailed", fmt.Errorf("%s/%s get storage class of restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+	}
+	if !expandable {
+		if !restore.Spec.RecreateStaleRestorePVC {
+			return "PVCStorageSizeTooSmall", fmt.Errorf("%s/%s's restore pvc %s's storage size %s is less than expected storage size %s, please delete old pvc or set recreateStaleRestorePVC to continue", ns, name, pvc.GetName(), pvcRs.String(), rs.String())
+		}
+		if pvc.DeletionTimestamp == nil {
+			klog.Infof("%s/%s's restore pvc %s's storage size %s is less than %s and can't be expanded, delete it to recreate", ns, name, pvc.GetName(), pvcRs.String(), rs.String())
+			if err := rm.deps.PVCControl.DeletePVC(restore, pvc); err != nil && !errors.IsNotFound(err) {
+				return "DeleteStalePVCFailed", fmt.Errorf("%s/%s delete stale restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+			}
+		}
+		return "", controller.RequeueErrorf("%s/%s waiting for stale restore pvc %s deleted", ns, name, pvc.GetName())
+	}
+
+	mergePatch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: rs,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "ResizePVCFailed", fmt.Errorf("%s/%s resize restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+	}
+	_, err = rm.deps.KubeClientset.CoreV1().PersistentVolumeClaims(ns).Patch(context.TODO(), pvc.GetName(), types.MergePatchType, mergePatch, metav1.PatchOptions{})
+	if err != nil {
+		return "ResizePVCFailed", fmt.Errorf("%s/%s resize restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+	}
+	klog.Infof("%s/%s resize restore pvc %s: storage request is updated from %s to %s", ns, name, pvc.GetName(), pvcRs.String(), rs.String())
+	return "", controller.RequeueErrorf("%s/%s waiting for restore pvc %s resized to %s", ns, name, pvc.GetName(), rs.String())
+}
+
+// isVolumeExpansionSupported returns whether the storage class of the pvc allows volume expansion.
+// The pvc without storage class is not expanded, the same as the pvc resizer of the tidb cluster.
+func (rm *restoreManager) isVolumeExpansionSupported(pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" || rm.deps.StorageClassLister == nil {
+		return false, nil
+	}
+	sc, err := rm.deps.StorageClassLister.Get(*pvc.Spec.StorageClassName)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
+
+// restoreVolumeType returns the volume type of the volume snapshot restore passed to BR, which is inferred from
+// the provisioner of the TiKV storage class or the default storage class. AWS EBS is used if it's unknown.
+func (rm *restoreManager) restoreVolumeType(tc *v1alpha1.TidbCluster) string {
+	if rm.deps.StorageClassLister == nil {
+		return snapshotter.VolumeTypeAWSEBS
+	}
+	if tc.Spec.TiKV != nil && tc.Spec.TiKV.StorageClassName != nil && *tc.Spec.TiKV.StorageClassName != "" {
+		sc, err := rm.deps.StorageClassLister.Get(*tc.Spec.TiKV.StorageClassName)
+		if err != nil {
+			klog.Warningf("get storage class %s of tidbcluster %s/%s failed, err: %v", *tc.Spec.TiKV.StorageClassName, tc.Namespace, tc.Name, err)
+			return snapshotter.VolumeTypeAWSEBS
+		}
+		return snapshotter.VolumeTypeOfProvisioner(sc.Provisioner)
+	}
+	scs, err := rm.deps.StorageClassLister.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("list storage classes failed, err: %v", err)
+		return snapshotter.VolumeTypeAWSEBS
+	}
+	for _, sc := range scs {
+		if sc.Annotations[isDefaultStorageClassAnnotation] == "true" || sc.Annotations[betaIsDefaultStorageClassAnnotation] == "true" {
+			return snapshotter.VolumeTypeOfProvisioner(sc.Provisioner)
+		}
+	}
+	return snapshotter.VolumeTypeAWSEBS
+}
+
+// isRestorePVCResizing returns true if the volume of the restore pvc is still being expanded. The file system
+// is expanded when the volume is mounted by the restore job, so the pvc waiting for it is not resizing.
+func isRestorePVCResizing(pvc *corev1.PersistentVolumeClaim) bool {
+	request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+	if !ok || capacity.Cmp(request) >= 0 {
+		return false
+	}
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Type == corev1.PersistentVolumeClaimFileSystemResizePending && condition.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
+
+// NeedRestorePVCCleanup returns true if the restore pvc of the finished TiDB Lightning restore is deleted
+// after its job is cleaned up by the ttl, or the restore pvc of the failed one is deleted right away if
+// CleanupRestorePVCOnFailure is set
+func NeedRestorePVCCleanup(restore *v1alpha1.Restore) bool {
+	if restore.Spec.BR != nil || restore.Spec.Mode == v1alpha1.RestoreModeLogical || restore.DeletionTimestamp != nil {
+		return false
+	}
+	if v1alpha1.IsRestoreFailed(restore) {
+		return restore.Spec.TTLSecondsAfterFinished != nil || restore.Spec.CleanupRestorePVCOnFailure
+	}
+	if restore.Spec.TTLSecondsAfterFinished == nil {
+		return false
+	}
+	return v1alpha1.IsRestoreComplete(restore) && (restore.Spec.PostRestoreHook == nil || v1alpha1.IsRestorePostHookFinished(restore))
+}
+
+// cleanupRestorePVC deletes the restore pvc after the restore job is cleaned up by the ttl. The pvc is shared
+// by the restores to the same TiDB, so it's not owned by the job but deleted explicitly, and only if it's
+// still used by this restore. The pvc of the failed restore with CleanupRestorePVCOnFailure is deleted once
+// the pods of the job are stopped, the job is kept for troubleshooting.
+func (rm *restoreManager) cleanupRestorePVC(restore *v1alpha1.Restore) error {
+	ns := restore.GetNamespace()
+	name := restore.GetName()
+	jobName := restore.GetRestoreJobName()
+	cleanupOnFailure := restore.Spec.CleanupRestorePVCOnFailure && v1alpha1.IsRestoreFailed(restore)
+	job, err := rm.deps.JobLister.Jobs(restore.GetRestoreJobNamespace()).Get(jobName)
+	if err == nil {
+		if !cleanupOnFailure {
+			return controller.RequeueErrorf("restore %s/%s: waiting for job %s cleaned up after the ttl", ns, name, jobName)
+		}
+		// the pvc used by a running pod is not deleted until the pod stops
+		if job.Status.Active > 0 {
+			return controller.RequeueErrorf("restore %s/%s: waiting for the pods of job %s stopped", ns, name, jobName)
+		}
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("restore %s/%s get job %s failed, err: %v", ns, name, jobName, err)
+	}
+
+	deleted, err := rm.deleteRestorePVC(restore)
+	if err != nil {
+		return err
+	}
+	if deleted && cleanupOnFailure {
+		klog.Infof("restore %s/%s restore pvc %s is deleted after the restore failed", ns, name, restore.GetRestorePVCName())
+	} else if deleted {
+		klog.Infof("restore %s/%s restore pvc %s is deleted after job %s is cleaned up", ns, name, restore.GetRestorePVCName(), jobName)
+	}
+	return nil
+}
+
+// deleteRestorePVC deletes the restore pvc if it's still used by the restore, and returns whether it's deleted
+func (rm *restoreManager) deleteRestorePVC(restore *v1alpha1.Restore) (bool, error) {
+	ns := restore.GetNamespace()
+	name := restore.GetName()
+	pvc, err := rm.deps.PVCLister.PersistentVolumeClaims(ns).Get(restore.GetRestorePVCName())
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("restore %s/%s get restore pvc failed, err: %v", ns, name, err)
+	}
+	// the pvc without the restore label may be created by others and is never deleted
+	if _, owned := restorePVCOwner(pvc, restore); pvc.DeletionTimestamp != nil || !owned || pvc.Labels[label.RestoreLabelKey] != name {
+		return false, nil
+	}
+	if err := rm.deps.PVCControl.DeletePVC(restore, pvc); err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("restore %s/%s delete restore pvc %s failed, err: %v", ns, name, pvc.GetName(), err)
+	}
+	return true, nil
+}
+
+// restorePVCOwner returns the restore the restore pvc is created for and whether it's the given restore.
+// The pvc is owned by the restore of the recorded UID, so the restore recreated with the same name doesn't
+// reuse or delete the pvc of the deleted one. The pvc created before the UID is recorded is recognized by
+// the restore label, and the pvc created before the restore label is added by the instance label.
+func restorePVCOwner(pvc *corev1.PersistentVolumeClaim, restore *v1alpha1.Restore) (string, bool) {
+	if uid, ok := pvc.Annotations[label.AnnRestoreUIDKey]; ok {
+		return fmt.Sprintf("%s with uid %s", pvc.Labels[label.RestoreLabelKey], uid), uid == string(restore.UID)
+	}
+	if owner, ok := pvc.Labels[label.RestoreLabelKey]; ok {
+		return owner, owner == restore.Name
+	}
+	if owner, ok := pvc.Labels[label.InstanceLabelKey]; ok {
+		return owner, owner == restore.GetInstanceName()
+	}
+	return "", true
+}
+
 var _ backup.RestoreManager = &restoreManager{}
 
 type FakeRestoreManager struct {
@@ -950,4 +2575,8 @@ func (frm *FakeRestoreManager) UpdateCondition(_ *v1alpha1.Restore, _ *v1alpha1.
 	return nil
 }
 
+func (frm *FakeRestoreManager) UpdateStatus(_ *v1alpha1.Restore, _ *v1alpha1.RestoreCondition, _ *controller.RestoreUpdateStatus) error {
+	return nil
+}
+
 var _ backup.RestoreManager = &FakeRestoreManager{}
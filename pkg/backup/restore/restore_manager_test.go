@@ -15,19 +15,42 @@ package restore
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	gomonkey "github.com/agiledragon/gomonkey/v2"
+	"github.com/gogo/protobuf/proto"
 	"github.com/onsi/gomega"
 	. "github.com/onsi/gomega"
+	kvbackup "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
 	"github.com/pingcap/tidb-operator/pkg/backup/testutils"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"github.com/pingcap/tidb-operator/pkg/pdapi"
+	"github.com/pingcap/tidb-operator/pkg/util"
+	"github.com/tikv/pd/pkg/typeutil"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/gcerrors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	errorutils "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/utils/pointer"
 )
 
@@ -119,11 +142,6 @@ func genValidBRRestores() []*v1alpha1.Restore {
 						Name:  fmt.Sprintf("env_name_%d", i),
 						Value: fmt.Sprintf("env_value_%d", i),
 					},
-					// existing env name will be overwritten for restore
-					{
-						Name:  "BR_LOG_TO_TERM",
-						Value: "value",
-					},
 					// existing env name will be overwritten for cleaner
 					{
 						Name:  "S3_PROVIDER",
@@ -169,8 +187,24 @@ func TestLightningRestore(t *testing.T) {
 	restore := validDumpRestore.DeepCopy()
 	restore.Namespace = "ns"
 	restore.Name = "name"
+	restore.Generation = 2
+	restore.Spec.CorrelationID = "dr-event-1"
+	restore.Spec.BackoffLimit = pointer.Int32Ptr(2)
+	restore.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(7200)
+	restore.Spec.NodeSelector = map[string]string{"node-pool": "restore"}
+	restore.Spec.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{Weight: 1, PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: corev1.LabelHostname}},
+			},
+		},
+	}
+	restore.Spec.DNSPolicy = corev1.DNSNone
+	restore.Spec.DNSConfig = &corev1.PodDNSConfig{Nameservers: []string{"10.0.0.10"}}
+	restore.Spec.HostAliases = []corev1.HostAlias{{IP: "10.0.0.100", Hostnames: []string{"s3.internal"}}}
 	helper.createRestore(restore)
 	helper.CreateSecret(restore)
+	addDefaultStorageClass(g, deps)
 
 	m := NewRestoreManager(deps)
 	err = m.Sync(restore)
@@ -195,6 +229,305 @@ func TestLightningRestore(t *testing.T) {
 	g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env1))
 	g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env2Yes))
 	g.Expect(job.Spec.Template.Spec.Containers[0].Env).NotTo(gomega.ContainElement(env2No))
+	g.Expect(*job.Spec.BackoffLimit).To(Equal(int32(2)))
+	g.Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64(7200)))
+
+	// the node selector is applied together with the affinity
+	g.Expect(job.Spec.Template.Spec.NodeSelector).To(Equal(restore.Spec.NodeSelector))
+	g.Expect(job.Spec.Template.Spec.Affinity).To(Equal(restore.Spec.Affinity))
+
+	// the storage endpoint is resolved by the dns config and the host aliases
+	g.Expect(job.Spec.Template.Spec.DNSPolicy).To(Equal(corev1.DNSNone))
+	g.Expect(job.Spec.Template.Spec.DNSConfig).To(Equal(restore.Spec.DNSConfig))
+	g.Expect(job.Spec.Template.Spec.HostAliases).To(Equal(restore.Spec.HostAliases))
+
+	// check the generation of the restore is propagated to the job
+	g.Expect(job.Labels[label.RestoreGenerationLabelKey]).To(Equal("2"))
+	g.Expect(job.Spec.Template.Labels[label.RestoreGenerationLabelKey]).To(Equal("2"))
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(get.Status.ObservedGeneration).To(Equal(int64(2)))
+
+	// check the correlation id is propagated to the job, pod, pvc and status
+	g.Expect(job.Labels[label.CorrelationIDLabelKey]).To(Equal("dr-event-1"))
+	g.Expect(job.Spec.Template.Labels[label.CorrelationIDLabelKey]).To(Equal("dr-event-1"))
+	pvc, err := deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).Should(BeNil())
+	g.Expect(pvc.Labels[label.CorrelationIDLabelKey]).To(Equal("dr-event-1"))
+	g.Expect(get.Status.CorrelationID).To(Equal("dr-event-1"))
+
+	// check the job is recorded as scheduled
+	g.Expect(get.Status.SubJobs).To(HaveLen(1))
+	g.Expect(get.Status.SubJobs[0].Type).To(Equal(v1alpha1.RestoreSubJobRestore))
+	g.Expect(get.Status.SubJobs[0].JobName).To(Equal(job.Name))
+	g.Expect(get.Status.SubJobs[0].Phase).To(Equal(v1alpha1.RestoreSubJobScheduled))
+}
+
+func TestLightningRestoreTTLSecondsAfterFinished(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.Spec.TTLSecondsAfterFinished = pointer.Int32Ptr(0)
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+
+	// create the restore pvc in both the api server and the cache
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.GetRestorePVCName(),
+			Namespace: restore.Namespace,
+			Labels:    label.NewRestore().Instance(restore.GetInstanceName()).Restore(restore.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(restore.Spec.StorageSize),
+				},
+			},
+		},
+	}
+	_, err := deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(deps.KubeInformerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Add(pvc)).To(Succeed())
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).Should(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreScheduled, "")
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(*job.Spec.TTLSecondsAfterFinished).To(Equal(int32(0)))
+
+	// the restore pvc shared by the restores is not owned by the job
+	pvc, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Get(context.TODO(), restore.GetRestorePVCName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(pvc.OwnerReferences).To(BeEmpty())
+
+	// the job cleaned up by the ttl is not recreated
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreScheduled, Status: corev1.ConditionTrue}}
+	g.Expect(deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Delete(context.TODO(), job.Name, metav1.DeleteOptions{})).To(Succeed())
+	g.Eventually(func() bool {
+		_, err := deps.JobLister.Jobs(restore.Namespace).Get(job.Name)
+		return errors.IsNotFound(err)
+	}, time.Second*10).Should(BeTrue())
+	err = m.Sync(restore)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	_, err = deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), job.Name, metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the restore pvc is deleted after the restore finishes and the job is cleaned up
+	g.Expect(NeedRestorePVCCleanup(restore)).To(BeFalse())
+	restore.Status.Conditions = append(restore.Status.Conditions, v1alpha1.RestoreCondition{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue})
+	g.Expect(NeedRestorePVCCleanup(restore)).To(BeTrue())
+	g.Expect(m.Sync(restore)).Should(BeNil())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestCleanupRestorePVCOnFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreFailed, Status: corev1.ConditionTrue}}
+	g.Expect(NeedRestorePVCCleanup(restore)).To(BeFalse())
+	restore.Spec.CleanupRestorePVCOnFailure = true
+	g.Expect(NeedRestorePVCCleanup(restore)).To(BeTrue())
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.GetRestorePVCName(),
+			Namespace: restore.Namespace,
+			Labels:    label.NewRestore().Instance(restore.GetInstanceName()).Restore(restore.Name),
+		},
+	}
+	g.Expect(deps.KubeInformerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Add(pvc)).To(Succeed())
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: restore.GetRestoreJobName(), Namespace: restore.Namespace},
+		Status:     batchv1.JobStatus{Active: 1},
+	}
+	jobIndexer := deps.KubeInformerFactory.Batch().V1().Jobs().Informer().GetIndexer()
+	g.Expect(jobIndexer.Add(job)).To(Succeed())
+
+	// the pvc is used by the running pod of the job
+	m := NewRestoreManager(deps)
+	err := m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).To(Succeed())
+
+	// the failed job is kept, only the pvc is deleted
+	job.Status.Active = 0
+	g.Expect(jobIndexer.Update(job)).To(Succeed())
+	g.Expect(m.Sync(restore)).To(Succeed())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	_, err = deps.JobLister.Jobs(restore.Namespace).Get(job.Name)
+	g.Expect(err).To(Succeed())
+
+	// the cleanup is idempotent
+	g.Expect(m.Sync(restore)).To(Succeed())
+}
+
+func TestLogicalLightningRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.Spec.Mode = v1alpha1.RestoreModeLogical
+	restore.Spec.StorageSize = ""
+	restore.Spec.S3.Prefix = "dump"
+	restore.Spec.ToolImage = "pingcap/tidb-lightning:v6.5.0"
+	restore.Spec.TTLSecondsAfterFinished = pointer.Int32Ptr(0)
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).Should(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreScheduled, "")
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+
+	// lightning reads the dump from the storage directly
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElements(
+		"--backupPath=s3://bname/dump?endpoint=s3%3A%2F%2Fpingcap%2F&force-path-style=true",
+		"--mode=logical",
+	))
+	g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "S3_PROVIDER", Value: "fake_provider"}))
+	g.Expect(job.Spec.Template.Spec.InitContainers).To(HaveLen(1))
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal(restore.Spec.ToolImage))
+
+	// no restore pvc is needed
+	g.Expect(job.Spec.Template.Spec.Volumes[0].Name).To(Equal(label.RestoreJobLabelVal))
+	g.Expect(job.Spec.Template.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+	g.Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim).To(BeNil())
+	_, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Get(context.TODO(), restore.GetRestorePVCName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue}}
+	g.Expect(NeedRestorePVCCleanup(restore)).To(BeFalse())
+}
+
+func TestBRRestoreAzblobWorkloadIdentity(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.ServiceAccount = "restore-identity"
+	restore.Spec.StorageProvider = v1alpha1.StorageProvider{
+		Azblob: &v1alpha1.AzblobStorageProvider{
+			Container:           "backup",
+			Path:                "backup/full",
+			StorageAccount:      "tidbbackup",
+			UseWorkloadIdentity: true,
+		},
+	}
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the service account must be annotated with the identity
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.Spec.ServiceAccount,
+			Namespace: restore.Namespace,
+		},
+	}
+	sa, err := deps.KubeClientset.CoreV1().ServiceAccounts(restore.Namespace).Create(context.TODO(), sa, metav1.CreateOptions{})
+	g.Expect(err).Should(BeNil())
+	_, reason, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(reason).To(Equal("ServiceAccountNotAnnotated"))
+
+	sa.Annotations = map[string]string{
+		"azure.workload.identity/client-id": "client",
+		"azure.workload.identity/tenant-id": "tenant",
+	}
+	_, err = deps.KubeClientset.CoreV1().ServiceAccounts(restore.Namespace).Update(context.TODO(), sa, metav1.UpdateOptions{})
+	g.Expect(err).Should(BeNil())
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+
+	// the identity is used instead of the keys in the secret
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.ServiceAccountName).To(Equal("restore-identity"))
+	g.Expect(podSpec.Containers[0].Env).To(ContainElements(
+		corev1.EnvVar{Name: "AZURE_STORAGE_ACCOUNT", Value: "tidbbackup"},
+		corev1.EnvVar{Name: "AZURE_CLIENT_ID", Value: "client"},
+		corev1.EnvVar{Name: "AZURE_TENANT_ID", Value: "tenant"},
+		corev1.EnvVar{Name: "AZURE_FEDERATED_TOKEN_FILE", Value: "/var/run/secrets/azure/tokens/azure-identity-token"},
+	))
+	g.Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+		Name:      "azure-identity-token",
+		ReadOnly:  true,
+		MountPath: "/var/run/secrets/azure/tokens",
+	}))
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == "azure-identity-token" {
+			g.Expect(volume.Projected.Sources[0].ServiceAccountToken.Audience).To(Equal("api://AzureADTokenExchange"))
+		}
+	}
+}
+
+func TestBRRestoreCABundle(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.CABundleSecretName = "minio-ca"
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the secret must exist before the job is created
+	_, reason, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(reason).To(Equal("CABundleSecretNotFound"))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.Spec.CABundleSecretName,
+			Namespace: restore.Namespace,
+		},
+		Data: map[string][]byte{"ca.crt": []byte("ca")},
+	}
+	_, err = deps.KubeClientset.CoreV1().Secrets(restore.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Eventually(func() error {
+		_, err := deps.SecretLister.Secrets(restore.Namespace).Get(restore.Spec.CABundleSecretName)
+		return err
+	}, time.Second*10).Should(BeNil())
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+
+	podSpec := job.Spec.Template.Spec
+	// the entrypoint combines the CA bundle with the system roots
+	g.Expect(podSpec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "STORAGE_CA_BUNDLE", Value: "/var/lib/storage-ca/ca.crt"}))
+	g.Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+		Name:      "storage-ca-bundle",
+		ReadOnly:  true,
+		MountPath: "/var/lib/storage-ca",
+	}))
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == "storage-ca-bundle" {
+			g.Expect(volume.Secret.SecretName).To(Equal("minio-ca"))
+		}
+	}
 }
 
 func TestBRRestore(t *testing.T) {
@@ -205,6 +538,8 @@ func TestBRRestore(t *testing.T) {
 	var err error
 
 	for i, restore := range genValidBRRestores() {
+		restore.Spec.NodeSelector = map[string]string{"node-pool": "restore"}
+		restore.Spec.HostAliases = []corev1.HostAlias{{IP: "10.0.0.100", Hostnames: []string{"s3.internal"}}}
 		helper.createRestore(restore)
 		helper.CreateSecret(restore)
 		helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
@@ -221,17 +556,173 @@ func TestBRRestore(t *testing.T) {
 			Name:  fmt.Sprintf("env_name_%d", i),
 			Value: fmt.Sprintf("env_value_%d", i),
 		}
-		env2Yes := corev1.EnvVar{
-			Name:  "BR_LOG_TO_TERM",
-			Value: "value",
-		}
-		env2No := corev1.EnvVar{
+		env2 := corev1.EnvVar{
 			Name:  "BR_LOG_TO_TERM",
 			Value: string(rune(1)),
 		}
+		env3Yes := corev1.EnvVar{
+			Name:  "S3_PROVIDER",
+			Value: "value",
+		}
 		g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env1))
-		g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env2Yes))
-		g.Expect(job.Spec.Template.Spec.Containers[0].Env).NotTo(gomega.ContainElement(env2No))
+		g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env2))
+		g.Expect(job.Spec.Template.Spec.Containers[0].Env).To(gomega.ContainElement(env3Yes))
+		g.Expect(job.Spec.Template.Spec.NodeSelector).To(Equal(restore.Spec.NodeSelector))
+		g.Expect(job.Spec.Template.Spec.HostAliases).To(Equal(restore.Spec.HostAliases))
+		// the dns policy of kubernetes is kept if it's not set
+		g.Expect(job.Spec.Template.Spec.DNSPolicy).To(BeEmpty())
+		g.Expect(job.Spec.Template.Spec.DNSConfig).To(BeNil())
+	}
+}
+
+func TestBRRestoreWithBundledBR(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.BundledBR = true
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	err := m.Sync(restore)
+	g.Expect(err).Should(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreScheduled, "")
+	job, err := helper.Deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.InitContainers).To(BeEmpty())
+	g.Expect(podSpec.Containers[0].Args).To(ContainElement("--bundledBR=true"))
+	for _, volume := range podSpec.Volumes {
+		g.Expect(volume.Name).NotTo(Equal("br-bin"))
+	}
+}
+
+func TestBRRestoreWithChecksum(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.Checksum = pointer.BoolPtr(false)
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	err := m.Sync(restore)
+	g.Expect(err).Should(BeNil())
+	job, err := helper.Deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--checksum=false"))
+}
+
+func TestBRRestoreWithTiDBPasswordFromFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.TiDBPasswordFromFile = true
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	err := m.Sync(restore)
+	g.Expect(err).Should(BeNil())
+	job, err := helper.Deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+
+	podSpec := job.Spec.Template.Spec
+	g.Expect(podSpec.Containers[0].Args).To(ContainElement("--tidb-password-file=" + constants.TidbPasswordFile))
+	for _, env := range podSpec.Containers[0].Env {
+		g.Expect(env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil || env.ValueFrom.SecretKeyRef.Name != restore.Spec.To.SecretName).To(BeTrue())
+	}
+	var passwordVolume *corev1.Volume
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Secret != nil && podSpec.Volumes[i].Secret.SecretName == restore.Spec.To.SecretName {
+			passwordVolume = &podSpec.Volumes[i]
+		}
+	}
+	g.Expect(passwordVolume).NotTo(BeNil())
+	g.Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: passwordVolume.Name, ReadOnly: true, MountPath: constants.TidbPasswordPath}))
+}
+
+func TestBRRestoreWithTiKVRegistry(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Spec.TiKV.BaseImage = "registry.local/pingcap/tikv"
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() string {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		if err != nil {
+			return ""
+		}
+		return tc.TiKVImage()
+	}, time.Second*10).Should(Equal("registry.local/pingcap/tikv:v6.5.0"))
+
+	m := NewRestoreManager(deps)
+	err = m.Sync(restore)
+	g.Expect(err).Should(BeNil())
+	job, err := helper.Deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal("registry.local/pingcap/br:v6.5.0"))
+}
+
+func TestRestoreTLSSecretNotFound(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	// lightning restore without the TiDB client TLS secret
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "lightning"
+	restore.Spec.To.TLSClientSecretName = pointer.StringPtr("tidb-client-tls")
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	err := NewRestoreManager(deps).Sync(restore)
+	g.Expect(err).Should(MatchError(ContainSubstring("TLS secret ns/tidb-client-tls is not found")))
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreRetryFailed, "TLSSecretNotFound")
+
+	// BR restore without the cluster client TLS secret or the TiDB client TLS secret
+	restores := genValidBRRestores()
+	for i, secretName := range []string{
+		util.ClusterClientTLSSecretName(restores[0].Spec.BR.Cluster),
+		util.TiDBClientTLSSecretName(restores[1].Spec.BR.Cluster, nil),
+	} {
+		restore := restores[i]
+		helper.createRestore(restore)
+		helper.CreateSecret(restore)
+		helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+		err := deps.KubeClientset.CoreV1().Secrets(restore.Namespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
+		g.Expect(err).Should(BeNil())
+		g.Eventually(func() bool {
+			_, err := deps.SecretLister.Secrets(restore.Namespace).Get(secretName)
+			return errors.IsNotFound(err)
+		}, time.Second*10).Should(BeTrue())
+
+		err = NewRestoreManager(deps).Sync(restore)
+		g.Expect(err).Should(MatchError(ContainSubstring(fmt.Sprintf("TLS secret %s/%s is not found", restore.Namespace, secretName))))
+		helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreRetryFailed, "TLSSecretNotFound")
 	}
 }
 
@@ -253,8 +744,9 @@ func TestBRRestoreByEBS(t *testing.T) {
 					Namespace: "ns-1",
 				},
 				Spec: v1alpha1.RestoreSpec{
-					Type: v1alpha1.BackupTypeFull,
-					Mode: v1alpha1.RestoreModeVolumeSnapshot,
+					Type:     v1alpha1.BackupTypeFull,
+					Mode:     v1alpha1.RestoreModeVolumeSnapshot,
+					VolumeAZ: "us-west-1a",
 					BR: &v1alpha1.BRConfig{
 						ClusterNamespace: "ns-1",
 						Cluster:          "cluster-1",
@@ -444,9 +936,24 @@ func TestBRRestoreByEBS(t *testing.T) {
 
 			helper.CreateTC(tt.restore.Spec.BR.ClusterNamespace, tt.restore.Spec.BR.Cluster, true, true)
 			helper.CreateRestore(tt.restore)
+			helper.CreateTLSSecrets(tt.restore)
 			m := NewRestoreManager(deps)
 			err := m.Sync(tt.restore)
 			g.Expect(err).Should(BeNil())
+
+			if tt.restore.Spec.VolumeAZ != "" {
+				// the target AZ is recorded and not affected by the later changes of the spec
+				get, err := deps.Clientset.PingcapV1alpha1().Restores(tt.restore.Namespace).Get(context.TODO(), tt.restore.Name, metav1.GetOptions{})
+				g.Expect(err).Should(BeNil())
+				g.Expect(get.Status.VolumeAZ).To(Equal(tt.restore.Spec.VolumeAZ))
+				get.Spec.VolumeAZ = "us-west-1b"
+				g.Expect(get.GetVolumeAZ()).To(Equal(tt.restore.Spec.VolumeAZ))
+				job, err := deps.KubeClientset.BatchV1().Jobs(tt.restore.Namespace).Get(context.TODO(), tt.restore.GetRestoreJobName(), metav1.GetOptions{})
+				g.Expect(err).Should(BeNil())
+				g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--target-az=us-west-1a"))
+				// the volume type is inferred from the TiKV storage class, which is AWS EBS by default
+				g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--volumeType=aws-ebs"))
+			}
 		})
 	}
 }
@@ -521,60 +1028,343 @@ func TestInvalidReplicasBRRestoreByEBS(t *testing.T) {
 		helper.CreateRestore(cases[0].restore)
 		m := NewRestoreManager(deps)
 		err := m.Sync(cases[0].restore)
-		g.Expect(err).Should(MatchError("tikv replica missmatched"))
+		g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+		g.Expect(err.Error()).To(ContainSubstring("tikv replica missmatched"))
+		helper.hasCondition(cases[0].restore.Namespace, cases[0].restore.Name, v1alpha1.RestoreFailed, "TiKVReplicasMismatched")
+
+		// the mismatch is recorded in the status
+		get, err := deps.Clientset.PingcapV1alpha1().Restores(cases[0].restore.Namespace).Get(context.TODO(), cases[0].restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		g.Expect(get.Status.ValidationResult).To(Equal(&v1alpha1.RestoreValidationResult{
+			TiKVReplicas:    v1alpha1.RestoreReplicasValidation{Expected: 2, Actual: 3},
+			TiFlashReplicas: v1alpha1.RestoreReplicasValidation{Matched: true},
+		}))
 	})
 }
 
-func TestInvalidModeBRRestoreByEBS(t *testing.T) {
+func TestAllowReplicaMismatchBRRestoreByEBS(t *testing.T) {
 	g := NewGomegaWithT(t)
 	helper := newHelper(t)
 	defer helper.Close()
 	deps := helper.Deps
 
-	cases := []struct {
-		name    string
-		restore *v1alpha1.Restore
-	}{
-		{
-			name: "restore-volume",
-			restore: &v1alpha1.Restore{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test-1",
-					Namespace: "ns-1",
-				},
-				Spec: v1alpha1.RestoreSpec{
-					Type: v1alpha1.BackupTypeFull,
-					Mode: v1alpha1.RestoreModeVolumeSnapshot,
-					BR: &v1alpha1.BRConfig{
-						ClusterNamespace: "ns-1",
-						Cluster:          "cluster-1",
-					},
-					StorageProvider: v1alpha1.StorageProvider{
-						Local: &v1alpha1.LocalStorageProvider{
-							//	Prefix: "prefix",
-							Volume: corev1.Volume{
-								Name: "nfs",
-								VolumeSource: corev1.VolumeSource{
-									NFS: &corev1.NFSVolumeSource{
-										Server:   "fake-server",
-										Path:     "/tmp",
-										ReadOnly: true,
-									},
-								},
-							},
-							VolumeMount: corev1.VolumeMount{
-								Name:      "nfs",
-								MountPath: "/tmp",
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1",
+			Namespace: "ns-1",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type:                 v1alpha1.BackupTypeFull,
+			Mode:                 v1alpha1.RestoreModeVolumeSnapshot,
+			AllowReplicaMismatch: true,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns-1",
+				Cluster:          "cluster-1",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
 							},
 						},
 					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
 				},
-				Status: v1alpha1.RestoreStatus{},
 			},
 		},
 	}
 
-	// Verify invalid tc with mismatch tikv replicas
+	// the backup meta has 2 tikv replicas while the tc has 3
+	err := os.WriteFile("/tmp/backupmeta", []byte(testutils.ConstructRestore2TiKVMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		g.Expect(os.Remove("/tmp/backupmeta")).To(Succeed())
+	}()
+
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, true, true)
+	helper.CreateRestore(restore)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	reason, err := m.validateRestore(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreReplicasMismatched, "ReplicaMismatchAllowed")
+	updated, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, cond := v1alpha1.GetRestoreCondition(&updated.Status, v1alpha1.RestoreReplicasMismatched)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Message).To(Equal("tidbcluster has 3 TiKV replicas, backup meta has 2 (+1)"))
+
+	// the mismatch still fails the restore by default
+	restore.Spec.AllowReplicaMismatch = false
+	reason, err = m.validateRestore(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal(tikvReplicasMismatchedReason))
+}
+
+func TestAllowMasterKeyRotationBRRestoreByEBS(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1",
+			Namespace: "ns-1",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns-1",
+				Cluster:          "cluster-1",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+		},
+	}
+
+	// the backup is encrypted with master key old-key
+	backupConfig := `[security.encryption]
+data-encryption-method = "aes128-ctr"
+[security.encryption.master-key]
+type = "kms"
+key-id = "old-key"
+`
+	meta := strings.Replace(testutils.ConstructRestoreMetaStr(), `"maxFailoverCount": 0,`,
+		fmt.Sprintf(`"config": %q, "maxFailoverCount": 0,`, backupConfig), 1)
+	err := os.WriteFile("/tmp/backupmeta", []byte(meta), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		g.Expect(os.Remove("/tmp/backupmeta")).To(Succeed())
+	}()
+
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, true, true)
+	helper.CreateRestore(restore)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Spec.TiKV.Config = v1alpha1.NewTiKVConfig()
+	tc.Spec.TiKV.Config.Set(TiKVConfigEncryptionMethod, "aes128-ctr")
+	tc.Spec.TiKV.Config.Set(TiKVConfigEncryptionMasterKeyId, "new-key")
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the different master key fails the restore by default
+	reason, err := m.validateRestore(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal(tikvEncryptionMismatchedReason))
+
+	// the rotation requires the backup master key as the previous master key
+	restore.Spec.AllowMasterKeyRotation = true
+	reason, err = m.validateRestore(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(TiKVConfigEncryptionPreviousMasterKeyId))
+	g.Expect(reason).To(Equal(tikvEncryptionMismatchedReason))
+
+	tc.Spec.TiKV.Config.Set(TiKVConfigEncryptionPreviousMasterKeyId, "old-key")
+	reason, err = m.validateRestore(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreMasterKeyRotated, "MasterKeyRotationAllowed")
+}
+
+func TestTiFlashConfigMismatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	encrypted := func(method, keyID string) *v1alpha1.TiFlashConfigWraper {
+		c := v1alpha1.NewTiFlashConfig()
+		c.Proxy.Set(TiKVConfigEncryptionMethod, method)
+		if keyID != "" {
+			c.Proxy.Set(TiKVConfigEncryptionMasterKeyId, keyID)
+		}
+		return c
+	}
+	withMainDir := func(c *v1alpha1.TiFlashConfigWraper, dirs ...string) *v1alpha1.TiFlashConfigWraper {
+		c.Common.Set(TiFlashConfigStorageMainDir, dirs)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		backup  *v1alpha1.TiFlashConfigWraper
+		restore *v1alpha1.TiFlashConfigWraper
+		errSub  string
+	}{
+		{
+			name:    "backup without encryption",
+			backup:  v1alpha1.NewTiFlashConfig(),
+			restore: encrypted("aes128-ctr", "key"),
+		},
+		{
+			name:    "plaintext backup",
+			backup:  encrypted("plaintext", ""),
+			restore: v1alpha1.NewTiFlashConfig(),
+		},
+		{
+			name:    "same encryption",
+			backup:  encrypted("aes128-ctr", "key"),
+			restore: encrypted("aes128-ctr", "key"),
+		},
+		{
+			name:    "encrypted backup restored without encryption",
+			backup:  encrypted("aes128-ctr", "key"),
+			restore: &v1alpha1.TiFlashConfigWraper{},
+			errSub:  "proxy security.encryption.data-encryption-method = aes128-ctr",
+		},
+		{
+			name:    "different encryption method",
+			backup:  encrypted("aes128-ctr", "key"),
+			restore: encrypted("aes256-ctr", "key"),
+			errSub:  "proxy security.encryption.data-encryption-method = aes128-ctr, restore tc.spec.tiflash.config has aes256-ctr",
+		},
+		{
+			name:    "different master key",
+			backup:  encrypted("aes128-ctr", "key"),
+			restore: encrypted("aes128-ctr", "another"),
+			errSub:  "proxy security.encryption.master-key.key-id = key",
+		},
+		{
+			name:    "main dir set by the backup only",
+			backup:  withMainDir(v1alpha1.NewTiFlashConfig(), "/data0/db"),
+			restore: v1alpha1.NewTiFlashConfig(),
+		},
+		{
+			name:    "same main dir",
+			backup:  withMainDir(v1alpha1.NewTiFlashConfig(), "/data0/db"),
+			restore: withMainDir(v1alpha1.NewTiFlashConfig(), "/data0/db"),
+		},
+		{
+			name:    "different main dir",
+			backup:  withMainDir(v1alpha1.NewTiFlashConfig(), "/data0/db"),
+			restore: withMainDir(v1alpha1.NewTiFlashConfig(), "/data0/db", "/data1/db"),
+			errSub:  "common storage.main.dir",
+		},
+	}
+	for _, tt := range tests {
+		err := tiflashConfigMismatch(tt.backup, tt.restore)
+		if tt.errSub == "" {
+			g.Expect(err).To(Succeed(), tt.name)
+			continue
+		}
+		g.Expect(err).To(HaveOccurred(), tt.name)
+		g.Expect(err.Error()).To(ContainSubstring(tt.errSub), tt.name)
+	}
+	g.Expect(failedConditionType(tiflashConfigMismatchedReason)).To(Equal(v1alpha1.RestoreFailed))
+}
+
+func TestRestoreValidationResult(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tikvConfig := func(method, keyID string) *v1alpha1.TiKVConfigWraper {
+		c := v1alpha1.NewTiKVConfig()
+		c.Set(TiKVConfigEncryptionMethod, method)
+		c.Set(TiKVConfigEncryptionMasterKeyId, keyID)
+		return c
+	}
+	backup := &v1alpha1.TidbClusterSpec{
+		TiKV:    &v1alpha1.TiKVSpec{Replicas: 3, Config: tikvConfig("aes128-ctr", "key")},
+		TiFlash: &v1alpha1.TiFlashSpec{Replicas: 1, Config: v1alpha1.NewTiFlashConfig()},
+	}
+	restore := &v1alpha1.TidbClusterSpec{
+		TiKV: &v1alpha1.TiKVSpec{Replicas: 3, Config: tikvConfig("aes128-ctr", "another")},
+	}
+	g.Expect(restoreValidationResult(backup, restore)).To(Equal(&v1alpha1.RestoreValidationResult{
+		TiKVReplicas:    v1alpha1.RestoreReplicasValidation{Expected: 3, Actual: 3, Matched: true},
+		TiFlashReplicas: v1alpha1.RestoreReplicasValidation{Expected: 1},
+		TiKVEncryption: &v1alpha1.RestoreEncryptionValidation{
+			ExpectedMethod:      "aes128-ctr",
+			ActualMethod:        "aes128-ctr",
+			ExpectedMasterKeyID: "key",
+			ActualMasterKeyID:   "another",
+		},
+	}))
+
+	// the TiFlash encryption is compared if both have TiFlash config, and any encryption matches a plaintext backup
+	backup.TiFlash.Config.Proxy.Set(TiKVConfigEncryptionMethod, "plaintext")
+	restore.TiFlash = &v1alpha1.TiFlashSpec{Replicas: 1, Config: v1alpha1.NewTiFlashConfig()}
+	restore.TiKV.Config = tikvConfig("aes128-ctr", "key")
+	result := restoreValidationResult(backup, restore)
+	g.Expect(result.TiFlashReplicas.Matched).To(BeTrue())
+	g.Expect(result.TiKVEncryption.Matched).To(BeTrue())
+	g.Expect(result.TiFlashEncryption).To(Equal(&v1alpha1.RestoreEncryptionValidation{ExpectedMethod: "plaintext", Matched: true}))
+}
+
+func TestInvalidModeBRRestoreByEBS(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	cases := []struct {
+		name    string
+		restore *v1alpha1.Restore
+	}{
+		{
+			name: "restore-volume",
+			restore: &v1alpha1.Restore{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-1",
+					Namespace: "ns-1",
+				},
+				Spec: v1alpha1.RestoreSpec{
+					Type: v1alpha1.BackupTypeFull,
+					Mode: v1alpha1.RestoreModeVolumeSnapshot,
+					BR: &v1alpha1.BRConfig{
+						ClusterNamespace: "ns-1",
+						Cluster:          "cluster-1",
+					},
+					StorageProvider: v1alpha1.StorageProvider{
+						Local: &v1alpha1.LocalStorageProvider{
+							//	Prefix: "prefix",
+							Volume: corev1.Volume{
+								Name: "nfs",
+								VolumeSource: corev1.VolumeSource{
+									NFS: &corev1.NFSVolumeSource{
+										Server:   "fake-server",
+										Path:     "/tmp",
+										ReadOnly: true,
+									},
+								},
+							},
+							VolumeMount: corev1.VolumeMount{
+								Name:      "nfs",
+								MountPath: "/tmp",
+							},
+						},
+					},
+				},
+				Status: v1alpha1.RestoreStatus{},
+			},
+		},
+	}
+
+	// Verify invalid tc with mismatch tikv replicas
 	//generate the restore meta in local nfs, with only 2 tikv replicas
 	err := os.WriteFile("/tmp/restoremeta", []byte(testutils.ConstructRestoreMetaStr()), 0644) //nolint:gosec
 	g.Expect(err).To(Succeed())
@@ -595,6 +1385,2041 @@ func TestInvalidModeBRRestoreByEBS(t *testing.T) {
 		helper.CreateRestore(cases[0].restore)
 		m := NewRestoreManager(deps)
 		err := m.Sync(cases[0].restore)
-		g.Expect(err).Should(MatchError("recovery mode is off"))
+		g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+		g.Expect(err.Error()).To(ContainSubstring("recovery mode is off"))
+		helper.hasCondition(cases[0].restore.Namespace, cases[0].restore.Name, v1alpha1.RestoreFailed, "RecoveryModeOff")
 	})
 }
+
+func TestBRRestoreCheckTiKVCapacity(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-capacity",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+			CheckTiKVCapacity: true,
+		},
+	}
+
+	// generate the BR backup meta with 100 bytes data in local nfs
+	backupMeta := &kvbackup.BackupMeta{
+		Files: []*kvbackup.File{
+			{Name: "1.sst", TotalBytes: 60},
+			{Name: "2.sst", TotalBytes: 40},
+		},
+	}
+	data, err := proto.Marshal(backupMeta)
+	g.Expect(err).To(Succeed())
+	err = os.WriteFile("/tmp/backupmeta", data, 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		err = os.Remove("/tmp/backupmeta")
+		g.Expect(err).To(Succeed())
+	}()
+
+	var available typeutil.ByteSize
+	createTCWithTiKVStores(g, helper, restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, &available)
+	helper.CreateRestore(restore)
+
+	m := NewRestoreManager(deps)
+
+	// 3 stores * 50 bytes is less than 100 bytes * 3 replicas, the restore fails without retrying
+	available = 50
+	err = m.Sync(restore)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "InsufficientTiKVCapacity")
+
+	restore.Name = "test-capacity-enough"
+	helper.CreateRestore(restore)
+	available = 100
+	err = m.Sync(restore)
+	g.Expect(err).Should(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreScheduled, "")
+
+	// the check is skipped for the backup meta v2, whose files are in other meta files referred by the file index
+	data, err = proto.Marshal(&kvbackup.BackupMeta{EndVersion: 1})
+	g.Expect(err).To(Succeed())
+	data = append(data, 13<<3|2, 0)
+	err = os.WriteFile("/tmp/backupmeta", data, 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	restore.Name = "test-capacity-v2"
+	helper.CreateRestore(restore)
+	available = 0
+	err = NewRestoreManager(deps).Sync(restore)
+	g.Expect(err).Should(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCheckSkipped, "TiKVCapacityCheckSkipped")
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreScheduled, "")
+}
+
+func TestImportRestoreCheckTiKVCapacity(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	// the dumped data of 100 bytes in local storage
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "db.t1.000000000.sql"), make([]byte, 60), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "db.t2.000000000.sql"), make([]byte, 40), 0644)).To(Succeed())
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "test-import-capacity"
+	restore.Spec.CheckTiKVCapacity = true
+	restore.Spec.StorageProvider = v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume:      corev1.Volume{Name: "local"},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+		},
+	}
+	helper.CreateRestore(restore)
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the TiDB host isn't the service of a tidbcluster
+	reason, err := m.checkImportTiKVCapacity(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreCheckSkipped, "TiKVCapacityCheckSkipped")
+
+	var available typeutil.ByteSize
+	createTCWithTiKVStores(g, helper, "ns", "cluster", &available)
+	restore.Spec.To.Host = "cluster-tidb"
+
+	// 3 stores * 50 bytes is less than 100 bytes * 3 replicas
+	available = 50
+	reason, err = m.checkImportTiKVCapacity(restore)
+	g.Expect(err).To(MatchError(ContainSubstring("is less than the required 300 (100 bytes * 3 replicas)")))
+	g.Expect(reason).To(Equal(insufficientTiKVCapacityReason))
+	g.Expect(failedConditionType(reason)).To(Equal(v1alpha1.RestoreFailed))
+
+	available = 100
+	reason, err = m.checkImportTiKVCapacity(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+// createTCWithTiKVStores creates the tidbcluster without tls, whose fake PD has 3 up TiKV stores and 3 max
+// replicas, the available capacity of every store is read from available
+func createTCWithTiKVStores(g *GomegaWithT, h *helper, ns, name string, available *typeutil.ByteSize) {
+	deps := h.Deps
+	h.CreateTC(ns, name, false, false)
+	// the fake pd control doesn't support tls
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Spec.TLSCluster = nil
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() bool {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		return err == nil && !tc.IsTLSClusterEnabled()
+	}, time.Second*10).Should(BeTrue())
+
+	maxReplicas := uint64(3)
+	pdClient := controller.NewFakePDClient(deps.PDControl.(*pdapi.FakePDControl), tc)
+	pdClient.AddReaction(pdapi.GetConfigActionType, func(action *pdapi.Action) (interface{}, error) {
+		return &pdapi.PDConfigFromAPI{
+			Replication: &pdapi.PDReplicationConfig{MaxReplicas: &maxReplicas},
+		}, nil
+	})
+	pdClient.AddReaction(pdapi.GetStoresActionType, func(action *pdapi.Action) (interface{}, error) {
+		storesInfo := &pdapi.StoresInfo{}
+		for i := 1; i <= 3; i++ {
+			storesInfo.Stores = append(storesInfo.Stores, &pdapi.StoreInfo{
+				Store: &pdapi.MetaStore{
+					Store:     &metapb.Store{Id: uint64(i)},
+					StateName: v1alpha1.TiKVStateUp,
+				},
+				Status: &pdapi.StoreStatus{Available: *available},
+			})
+		}
+		return storesInfo, nil
+	})
+}
+
+func TestDeleteRestoreMetaFromExternalStorage(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-delete-meta",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+			DeleteRestoreMetaOnComplete: true,
+		},
+	}
+
+	err := os.WriteFile("/tmp/restoremeta", []byte(testutils.ConstructRestoreMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+
+	m := NewRestoreManager(helper.Deps).(*restoreManager)
+	reason, err := m.deleteRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	_, err = os.Stat("/tmp/restoremeta")
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	// delete again, it's no error if the restore meta is already gone
+	reason, err = m.deleteRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// the delete denied by the storage is reported as the missing permission, and it's not retried
+	bucket := &forbiddenBucket{}
+	patches := gomonkey.ApplyFunc(backuputil.NewStorageBackend, func(provider v1alpha1.StorageProvider, cred *backuputil.StorageCredential) (*backuputil.StorageBackend, error) {
+		return &backuputil.StorageBackend{Bucket: blob.NewBucket(bucket)}, nil
+	})
+	defer patches.Reset()
+	reason, err = m.deleteRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(MatchError(ContainSubstring("no permission to delete restoremeta")))
+	g.Expect(reason).To(Equal("DeleteRestoreMetaForbidden"))
+	g.Expect(bucket.writes).To(Equal(0))
+	g.Expect(bucket.deletes).To(Equal(1))
+}
+
+// forbiddenBucket is a storage bucket holding the restore meta which can't be written or deleted
+type forbiddenBucket struct {
+	driver.Bucket
+	writes  int
+	deletes int
+}
+
+func (b *forbiddenBucket) Attributes(ctx context.Context, key string) (*driver.Attributes, error) {
+	return &driver.Attributes{}, nil
+}
+
+func (b *forbiddenBucket) NewTypedWriter(ctx context.Context, key, contentType string, opts *driver.WriterOptions) (driver.Writer, error) {
+	b.writes++
+	return nil, errForbidden
+}
+
+func (b *forbiddenBucket) Delete(ctx context.Context, key string) error {
+	b.deletes++
+	return errForbidden
+}
+
+func (b *forbiddenBucket) ErrorCode(err error) gcerrors.ErrorCode {
+	if err == errForbidden {
+		return gcerrors.PermissionDenied
+	}
+	return gcerrors.Unknown
+}
+
+func (b *forbiddenBucket) Close() error {
+	return nil
+}
+
+var errForbidden = fmt.Errorf("access denied")
+
+// addDefaultStorageClass adds the default storage class of the kubernetes cluster for the restore pvc
+func addDefaultStorageClass(g *GomegaWithT, deps *controller.Dependencies) {
+	scIndexer := deps.KubeInformerFactory.Storage().V1().StorageClasses().Informer().GetIndexer()
+	g.Expect(scIndexer.Add(&storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "standard",
+			Annotations: map[string]string{isDefaultStorageClassAnnotation: "true"},
+		},
+	})).To(Succeed())
+}
+
+func TestRestoreStorageClassName(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// no storage class is available for the pvc
+	_, reason, err := m.restoreStorageClassName(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("NoStorageClassAvailable"))
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("NoStorageClassAvailable"))
+	_, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Get(context.TODO(), restore.GetRestorePVCName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the default of tidb-operator is used
+	deps.CLIConfig.RestoreStorageClassName = "restore"
+	sc, _, err := m.restoreStorageClassName(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(sc).To(Equal(pointer.StringPtr("restore")))
+
+	// the storage class of the restore takes precedence
+	restore.Spec.StorageClassName = pointer.StringPtr("fast")
+	sc, _, err = m.restoreStorageClassName(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(sc).To(Equal(pointer.StringPtr("fast")))
+
+	// the default storage class of the kubernetes cluster is used
+	deps.CLIConfig.RestoreStorageClassName = ""
+	restore.Spec.StorageClassName = nil
+	addDefaultStorageClass(g, deps)
+	sc, _, err = m.restoreStorageClassName(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(sc).To(BeNil())
+}
+
+func TestMaxRestoreStorageSize(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.Spec.StorageSize = "1Ti"
+	m := NewRestoreManager(deps).(*restoreManager)
+	addDefaultStorageClass(g, deps)
+
+	// the pvc larger than the limit is not created
+	deps.CLIConfig.MaxRestoreStorageSize = "500Gi"
+	reason, err := m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(MatchError(ContainSubstring("storage size 1Ti exceeds the limit 500Gi")))
+	g.Expect(reason).To(Equal(storageSizeExceedsLimitReason))
+	g.Expect(failedConditionType(reason)).To(Equal(v1alpha1.RestoreFailed))
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the pvc within the limit is created
+	restore.Spec.StorageSize = "500Gi"
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).To(Succeed())
+
+	// no limit by default
+	deps.CLIConfig.MaxRestoreStorageSize = ""
+	restore.Spec.StorageSize = "1Ti"
+	_, err = m.checkMaxRestoreStorageSize(restore, resource.MustParse(restore.Spec.StorageSize))
+	g.Expect(err).To(Succeed())
+}
+
+func TestEnsureRestorePVCExist(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := validDumpRestore.DeepCopy()
+	restore.Namespace = "ns"
+	restore.Name = "name"
+	restore.UID = "uid"
+	m := NewRestoreManager(deps).(*restoreManager)
+	addDefaultStorageClass(g, deps)
+	pvcIndexer := deps.KubeInformerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer()
+	newPVC := func(labels map[string]string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      restore.GetRestorePVCName(),
+				Namespace: restore.Namespace,
+				Labels:    labels,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("100Gi"),
+					},
+				},
+			},
+		}
+	}
+
+	// pvc created for the same restore is reused
+	g.Expect(pvcIndexer.Add(newPVC(label.NewRestore().Instance(restore.Name).Restore(restore.Name)))).To(Succeed())
+	reason, err := m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).To(Succeed())
+
+	// pvc created before the restore label is added is recognized by the instance label
+	g.Expect(pvcIndexer.Update(newPVC(label.NewRestore().Instance(restore.Name)))).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// pvc owned by another restore fails the restore by default
+	g.Expect(pvcIndexer.Update(newPVC(label.NewRestore().Instance("stale").Restore("stale")))).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("PVCOwnedByAnotherRestore"))
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).To(Succeed())
+
+	g.Expect(pvcIndexer.Update(newPVC(label.NewRestore().Instance("stale")))).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("PVCOwnedByAnotherRestore"))
+
+	// pvc created for the deleted restore of the same name is owned by another restore
+	stale := newPVC(label.NewRestore().Instance(restore.Name).Restore(restore.Name))
+	stale.Annotations = map[string]string{label.AnnRestoreUIDKey: "stale-uid"}
+	g.Expect(pvcIndexer.Update(stale)).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(MatchError(ContainSubstring("is owned by restore name with uid stale-uid")))
+	g.Expect(reason).To(Equal("PVCOwnedByAnotherRestore"))
+	deleted, err := m.deleteRestorePVC(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(deleted).To(BeFalse())
+
+	// pvc owned by another restore is deleted and recreated with policy
+	restore.Spec.RecreateStaleRestorePVC = true
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	g.Expect(reason).To(BeEmpty())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	pvc, err := deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(err).To(Succeed())
+	g.Expect(pvc.Labels[label.RestoreLabelKey]).To(Equal(restore.Name))
+	g.Expect(pvc.Annotations[label.AnnRestoreUIDKey]).To(Equal(string(restore.UID)))
+
+	// pvc smaller than the storage size can't be resized without an expandable storage class
+	restore.Spec.RecreateStaleRestorePVC = false
+	restore.Spec.StorageSize = "200Gi"
+	pvc = newPVC(label.NewRestore().Instance(restore.Name).Restore(restore.Name))
+	g.Expect(pvcIndexer.Update(pvc)).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("PVCStorageSizeTooSmall"))
+
+	// pvc smaller than the storage size is recreated with policy if it can't be resized
+	restore.Spec.RecreateStaleRestorePVC = true
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	g.Expect(reason).To(BeEmpty())
+	_, err = deps.PVCLister.PersistentVolumeClaims(restore.Namespace).Get(restore.GetRestorePVCName())
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	restore.Spec.RecreateStaleRestorePVC = false
+
+	// pvc is resized in place with an expandable storage class
+	scIndexer := deps.KubeInformerFactory.Storage().V1().StorageClasses().Informer().GetIndexer()
+	g.Expect(scIndexer.Add(&storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: "expandable"},
+		AllowVolumeExpansion: pointer.BoolPtr(true),
+	})).To(Succeed())
+	pvc.Spec.StorageClassName = pointer.StringPtr("expandable")
+	pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("100Gi")}
+	g.Expect(pvcIndexer.Update(pvc)).To(Succeed())
+	_, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	g.Expect(err).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	g.Expect(reason).To(BeEmpty())
+	pvc, err = deps.KubeClientset.CoreV1().PersistentVolumeClaims(restore.Namespace).Get(context.TODO(), restore.GetRestorePVCName(), metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(pvc.Spec.Resources.Requests.Storage().String()).To(Equal("200Gi"))
+
+	// wait for the volume expanded, the file system is expanded when the job mounts it
+	g.Expect(pvcIndexer.Update(pvc)).To(Succeed())
+	_, err = m.ensureRestorePVCExist(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	pvc.Status.Conditions = []corev1.PersistentVolumeClaimCondition{
+		{Type: corev1.PersistentVolumeClaimFileSystemResizePending, Status: corev1.ConditionTrue},
+	}
+	g.Expect(pvcIndexer.Update(pvc)).To(Succeed())
+	reason, err = m.ensureRestorePVCExist(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+func TestCheckTiKVStoreCount(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-store-count",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+			FederalVolumeRestorePhase: v1alpha1.FederalVolumeRestoreFinish,
+		},
+	}
+	tc := &v1alpha1.TidbCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster",
+			Namespace: "ns",
+		},
+	}
+
+	// generate the backup meta with 2 tikv replicas in local nfs
+	err := os.WriteFile("/tmp/backupmeta", []byte(testutils.ConstructRestore2TiKVMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		err = os.Remove("/tmp/backupmeta")
+		g.Expect(err).To(Succeed())
+	}()
+
+	var tikvStates []string
+	pdClient := controller.NewFakePDClient(deps.PDControl.(*pdapi.FakePDControl), tc)
+	pdClient.AddReaction(pdapi.GetStoresActionType, func(action *pdapi.Action) (interface{}, error) {
+		storesInfo := &pdapi.StoresInfo{
+			Stores: []*pdapi.StoreInfo{
+				{
+					Store: &pdapi.MetaStore{
+						Store: &metapb.Store{
+							Id:     100,
+							Labels: []*metapb.StoreLabel{{Key: "engine", Value: "tiflash"}},
+						},
+						StateName: v1alpha1.TiKVStateUp,
+					},
+				},
+			},
+		}
+		for i, state := range tikvStates {
+			storesInfo.Stores = append(storesInfo.Stores, &pdapi.StoreInfo{
+				Store: &pdapi.MetaStore{
+					Store:     &metapb.Store{Id: uint64(i + 1)},
+					StateName: state,
+				},
+			})
+		}
+		return storesInfo, nil
+	})
+
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// one of the TiKV stores fails to start after restart
+	tikvStates = []string{v1alpha1.TiKVStateUp, v1alpha1.TiKVStateDown}
+	reason, err := m.checkTiKVStoreCount(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("StoreCountMismatchAfterRestore"))
+
+	// the TiFlash store is not counted
+	tikvStates = []string{v1alpha1.TiKVStateUp, v1alpha1.TiKVStateUp}
+	reason, err = m.checkTiKVStoreCount(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+func TestCheckTargetClusterEmpty(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-target-empty",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			FederalVolumeRestorePhase: v1alpha1.FederalVolumeRestoreVolume,
+		},
+	}
+	tc := &v1alpha1.TidbCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.TidbClusterSpec{
+			PD: &v1alpha1.PDSpec{Replicas: 1},
+		},
+		Status: v1alpha1.TidbClusterStatus{
+			PD: v1alpha1.PDStatus{
+				Members: map[string]v1alpha1.PDMember{"pd-0": {Name: "pd-0", Health: true}},
+			},
+		},
+	}
+
+	var regionCounts []int
+	pdClient := controller.NewFakePDClient(deps.PDControl.(*pdapi.FakePDControl), tc)
+	pdClient.AddReaction(pdapi.GetStoresActionType, func(action *pdapi.Action) (interface{}, error) {
+		storesInfo := &pdapi.StoresInfo{}
+		for i, count := range regionCounts {
+			storesInfo.Stores = append(storesInfo.Stores, &pdapi.StoreInfo{
+				Store: &pdapi.MetaStore{
+					Store:     &metapb.Store{Id: uint64(i + 1), Address: fmt.Sprintf("tikv-%d:20160", i)},
+					StateName: v1alpha1.TiKVStateUp,
+				},
+				Status: &pdapi.StoreStatus{RegionCount: count},
+			})
+		}
+		return storesInfo, nil
+	})
+
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the stores of a new cluster have no regions
+	regionCounts = []int{0, 0}
+	reason, err := m.checkTargetClusterEmpty(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// the cluster is serving data
+	regionCounts = []int{0, 20}
+	reason, err = m.checkTargetClusterEmpty(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("store 2 (tikv-1:20160) has 20 regions"))
+	g.Expect(reason).To(Equal(targetClusterNotEmptyReason))
+	g.Expect(failedConditionType(reason)).To(Equal(v1alpha1.RestoreFailed))
+
+	// the restore goes on when it's forced
+	restore.Spec.ForceDestructive = true
+	reason, err = m.checkTargetClusterEmpty(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// the stores are up with the restored data after the restore job is scheduled
+	restore.Spec.ForceDestructive = false
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreScheduled, Status: corev1.ConditionTrue}}
+	reason, err = m.checkTargetClusterEmpty(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+type fakeVolumeSnapshotter struct {
+	snapshotter.NoneSnapshotter
+	deleted   []string
+	deleteErr error
+	tagged    []string
+	tagErrs   map[string]error
+}
+
+func (s *fakeVolumeSnapshotter) DeleteVolumes(volumeIDs []string) error {
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	s.deleted = append(s.deleted, volumeIDs...)
+	return nil
+}
+
+func (s *fakeVolumeSnapshotter) AddVolumeTags(pvs []*corev1.PersistentVolume) error {
+	var errs []error
+	for _, pv := range pvs {
+		id := pv.Spec.CSI.VolumeHandle
+		if err, ok := s.tagErrs[id]; ok {
+			errs = append(errs, &backuputil.TagResourceError{ResourceID: id, Op: "create tags", Err: err})
+			continue
+		}
+		s.tagged = append(s.tagged, id)
+	}
+	return errorutils.NewAggregate(errs)
+}
+
+func TestHandleOrphanedVolumes(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-orphaned",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+		},
+	}
+	helper.createRestore(restore)
+	csb := &snapshotter.CloudSnapBackup{
+		TiKV: &snapshotter.TiKVBackup{
+			Stores: []*snapshotter.StoresBackup{
+				{StoreID: 1, Volumes: []*snapshotter.VolumeBackup{{VolumeID: "vol-1", RestoreVolumeID: "vol-new-1"}}},
+				{StoreID: 2, Volumes: []*snapshotter.VolumeBackup{{VolumeID: "vol-2"}}},
+			},
+		},
+	}
+	prepareErr := fmt.Errorf("commit pvs failed")
+	getRestore := func() *v1alpha1.Restore {
+		r, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		return r
+	}
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	s := &fakeVolumeSnapshotter{}
+
+	// the volumes are only recorded by default
+	reason, err := m.handleOrphanedVolumes(restore, s, csb, "CommitPVsFailed", prepareErr)
+	g.Expect(err).To(Equal(prepareErr))
+	g.Expect(reason).To(Equal("CommitPVsFailed"))
+	g.Expect(s.deleted).To(BeEmpty())
+	g.Expect(getRestore().Status.OrphanedVolumes).To(Equal(&v1alpha1.OrphanedVolumesStatus{VolumeIDs: []string{"vol-new-1"}}))
+
+	// the restore is retried if deleting the volumes fails
+	restore.Spec.CleanupOrphanedVolumesOnFailure = true
+	s.deleteErr = fmt.Errorf("permission denied")
+	reason, err = m.handleOrphanedVolumes(restore, s, csb, "CommitPVsFailed", prepareErr)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(controller.IsIgnoreError(err)).To(BeFalse())
+	g.Expect(reason).To(Equal("CleanupOrphanedVolumesFailed"))
+	g.Expect(getRestore().Status.OrphanedVolumes.Cleaned).To(BeFalse())
+
+	// the restore is failed after the volumes are deleted
+	s.deleteErr = nil
+	reason, err = m.handleOrphanedVolumes(restore, s, csb, "CommitPVsFailed", prepareErr)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(s.deleted).To(Equal([]string{"vol-new-1"}))
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "CommitPVsFailed")
+	g.Expect(getRestore().Status.OrphanedVolumes).To(Equal(&v1alpha1.OrphanedVolumesStatus{VolumeIDs: []string{"vol-new-1"}, Cleaned: true}))
+}
+
+func TestBRRestoreByEBSPDReadyTimeout(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pd-timeout",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+			PDReadyTimeout: &metav1.Duration{Duration: time.Hour},
+		},
+		Status: v1alpha1.RestoreStatus{
+			// the time before waiting for PD doesn't count
+			TimeStarted: metav1.Time{Time: time.Now().Add(-2 * time.Hour)},
+		},
+	}
+
+	err := os.WriteFile("/tmp/backupmeta", []byte(testutils.ConstructRestoreMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		err = os.Remove("/tmp/backupmeta")
+		g.Expect(err).To(Succeed())
+	}()
+
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, true, true)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	tc.Status.PD.Members["pd-0"] = v1alpha1.PDMember{Name: "pd-0", Health: false}
+	_, err = deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Eventually(func() bool {
+		tc, err := deps.TiDBClusterLister.TidbClusters(tc.Namespace).Get(tc.Name)
+		return err == nil && !tc.PDAllMembersReady()
+	}, time.Second*10).Should(BeTrue())
+	helper.CreateRestore(restore)
+
+	m := NewRestoreManager(deps)
+	err = m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	restore, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(restore.Status.PDWaitStartTime).NotTo(BeNil())
+	err = m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+
+	restore.Status.PDWaitStartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+	err = m.Sync(restore)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "PDNeverReady")
+}
+
+func TestBRRestoreByEBSRestoreTimeout(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-restore-timeout",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+			RestoreTimeout: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	helper.CreateRestore(restore)
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the start of the restore is recorded
+	g.Expect(m.checkRestoreDeadline(restore)).To(Succeed())
+	restore, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(restore.Status.TimeStarted.IsZero()).To(BeFalse())
+	g.Expect(m.checkRestoreDeadline(restore)).To(Succeed())
+
+	// the completed restore is not failed
+	restore.Status.TimeStarted = metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue}}
+	g.Expect(m.checkRestoreDeadline(restore)).To(Succeed())
+
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreVolumeComplete, Status: corev1.ConditionTrue}}
+	err = m.checkRestoreDeadline(restore)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreFailed, "RestoreDeadlineExceeded")
+	restore, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, condition := v1alpha1.GetRestoreCondition(&restore.Status, v1alpha1.RestoreFailed)
+	g.Expect(condition.Message).To(ContainSubstring("restore is not complete after 2h0m0s, timeout is 1h0m0s"))
+}
+
+func TestBRRestoreDryRun(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	newRestore := func(name string) *v1alpha1.Restore {
+		return &v1alpha1.Restore{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "ns",
+			},
+			Spec: v1alpha1.RestoreSpec{
+				Type:   v1alpha1.BackupTypeFull,
+				Mode:   v1alpha1.RestoreModeVolumeSnapshot,
+				DryRun: true,
+				BR: &v1alpha1.BRConfig{
+					ClusterNamespace: "ns",
+					Cluster:          "cluster",
+				},
+				StorageProvider: v1alpha1.StorageProvider{
+					Local: &v1alpha1.LocalStorageProvider{
+						Volume: corev1.Volume{
+							Name: "nfs",
+							VolumeSource: corev1.VolumeSource{
+								NFS: &corev1.NFSVolumeSource{
+									Server:   "fake-server",
+									Path:     "/tmp",
+									ReadOnly: true,
+								},
+							},
+						},
+						VolumeMount: corev1.VolumeMount{
+							Name:      "nfs",
+							MountPath: "/tmp",
+						},
+					},
+				},
+			},
+		}
+	}
+	helper.CreateTC("ns", "cluster", true, true)
+	m := NewRestoreManager(deps)
+
+	// the checks pass, no job is created
+	err := os.WriteFile("/tmp/backupmeta", []byte(testutils.ConstructRestoreMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		err = os.Remove("/tmp/backupmeta")
+		g.Expect(err).To(Succeed())
+	}()
+	restore := newRestore("test-dry-run")
+	helper.CreateRestore(restore)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreDryRunComplete, "DryRunPassed")
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, condition := v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreDryRunComplete)
+	g.Expect(condition.Message).To(ContainSubstring("3 TiKV replicas of tidbcluster ns/cluster match the backup meta"))
+	g.Expect(condition.Message).To(ContainSubstring("recovery mode is on"))
+	g.Expect(condition.Message).To(ContainSubstring("no TiKV store of the tidbcluster is serving data"))
+	// the backup meta has no TiKV config, so the encryption is not checked
+	g.Expect(condition.Message).NotTo(ContainSubstring("TiKV encryption"))
+	g.Expect(v1alpha1.IsRestoreScheduled(get)).To(BeFalse())
+	_, err = deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the mismatched tikv replicas fail the dry run
+	err = os.WriteFile("/tmp/backupmeta", []byte(testutils.ConstructRestore2TiKVMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	restore = newRestore("test-dry-run-mismatch")
+	helper.CreateRestore(restore)
+	err = m.Sync(restore)
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreInvalid, "DryRunFailed")
+}
+
+func TestRecoveryPlacement(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-placement",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			RecoveryPlacement: &v1alpha1.RecoveryPlacement{
+				NodeSelector: map[string]string{"zone": "recovery"},
+			},
+		},
+	}
+	helper.createRestore(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	getTC := func() *v1alpha1.TidbCluster {
+		tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		return tc
+	}
+	getRestore := func() *v1alpha1.Restore {
+		r, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		return r
+	}
+	tc := getTC()
+	tc.Spec.TiKV.NodeSelector = map[string]string{"zone": "origin", "disk": "ssd"}
+	_, err := deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Update(context.TODO(), tc, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	applied := map[string]string{"zone": "recovery", "disk": "ssd"}
+	original := map[string]string{"zone": "origin", "disk": "ssd"}
+	// the keys only in the recovery placement are removed when it's reverted
+	restore.Spec.RecoveryPlacement.NodeSelector["pool"] = "restore"
+	applied["pool"] = "restore"
+
+	// the placement is patched to the TiKV spec and the original node selector is recorded
+	tc, reason, err := m.applyRecoveryPlacement(restore, getTC())
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(tc.Spec.TiKV.NodeSelector).To(Equal(applied))
+	g.Expect(getTC().Spec.TiKV.NodeSelector).To(Equal(applied))
+	g.Expect(getRestore().Status.RecoveryPlacement).To(Equal(&v1alpha1.RecoveryPlacementStatus{
+		NodeSelector:         applied,
+		OriginalNodeSelector: original,
+	}))
+
+	// applying again keeps the recorded original node selector
+	tc, reason, err = m.applyRecoveryPlacement(getRestore(), getTC())
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(tc.Spec.TiKV.NodeSelector).To(Equal(applied))
+	g.Expect(getRestore().Status.RecoveryPlacement.OriginalNodeSelector).To(Equal(original))
+
+	// the original node selector is restored after the stores are up
+	reason, err = m.revertRecoveryPlacement(getRestore(), getTC())
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(getTC().Spec.TiKV.NodeSelector).To(Equal(original))
+	g.Expect(getRestore().Status.RecoveryPlacement.Reverted).To(BeTrue())
+}
+
+func TestRestoreBandwidthBudget(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+	deps.CLIConfig.RestoreBandwidthBudget = 300
+
+	// the target clusters have 3 TiKV stores, so the bandwidth of the restores is 180, 150, 120 and 360 MB/s
+	restores := genValidBRRestores()[:4]
+	for i, rateLimit := range []uint{60, 50, 40, 120} {
+		rateLimit := rateLimit
+		restore := restores[i]
+		restore.Spec.BR.RateLimit = &rateLimit
+		helper.createRestore(restore)
+		helper.CreateSecret(restore)
+		helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	}
+	waitScheduled := func(restore *v1alpha1.Restore) {
+		g.Eventually(func() bool {
+			r, err := deps.RestoreLister.Restores(restore.Namespace).Get(restore.Name)
+			return err == nil && v1alpha1.IsRestoreScheduled(r)
+		}, time.Second*10).Should(BeTrue())
+	}
+	m := NewRestoreManager(deps)
+
+	// the first restore is never throttled
+	g.Expect(m.Sync(restores[0])).Should(Succeed())
+	waitScheduled(restores[0])
+
+	// 180 + 150 MB/s exceeds the budget
+	err := m.Sync(restores[1])
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	helper.hasCondition(restores[1].Namespace, restores[1].Name, v1alpha1.RestoreThrottled, "BandwidthBudgetExceeded")
+	usage, err := ActiveRestoresBandwidth(deps.RestoreLister, deps.TiDBClusterLister)
+	g.Expect(err).Should(BeNil())
+	g.Expect(usage).To(Equal(uint(180)))
+
+	// 360 MB/s exceeds the budget by itself
+	err = m.Sync(restores[3])
+	g.Expect(controller.IsIgnoreError(err)).To(BeTrue())
+	helper.hasCondition(restores[3].Namespace, restores[3].Name, v1alpha1.RestoreFailed, "BandwidthBudgetExceeded")
+
+	// 180 + 120 MB/s fits in the budget
+	g.Expect(m.Sync(restores[2])).Should(Succeed())
+	waitScheduled(restores[2])
+
+	// the throttled restore is scheduled after the active restores complete
+	for _, restore := range []*v1alpha1.Restore{restores[0], restores[2]} {
+		g.Expect(m.UpdateCondition(restore, &v1alpha1.RestoreCondition{
+			Type:   v1alpha1.RestoreComplete,
+			Status: corev1.ConditionTrue,
+		})).Should(Succeed())
+	}
+	g.Eventually(func() (uint, error) {
+		return ActiveRestoresBandwidth(deps.RestoreLister, deps.TiDBClusterLister)
+	}, time.Second*10).Should(Equal(uint(0)))
+	g.Eventually(func() bool {
+		r, err := deps.RestoreLister.Restores(restores[1].Namespace).Get(restores[1].Name)
+		if err != nil {
+			return false
+		}
+		_, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreThrottled)
+		return cond != nil && cond.Status == corev1.ConditionTrue
+	}, time.Second*10).Should(BeTrue())
+	throttled, err := deps.RestoreLister.Restores(restores[1].Namespace).Get(restores[1].Name)
+	g.Expect(err).Should(BeNil())
+	g.Expect(m.Sync(throttled)).Should(Succeed())
+	helper.hasCondition(restores[1].Namespace, restores[1].Name, v1alpha1.RestoreScheduled, "")
+	helper.hasCondition(restores[1].Namespace, restores[1].Name, v1alpha1.RestoreThrottled, "BandwidthBudgetAvailable")
+}
+
+func TestRestoreBandwidthWithoutClusterNamespace(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	// the target cluster with 3 TiKV stores is in the namespace of the restore
+	rateLimit := uint(60)
+	restore := genValidBRRestores()[0]
+	restore.Spec.BR.ClusterNamespace = ""
+	restore.Spec.BR.RateLimit = &rateLimit
+	g.Expect(restoreBandwidth(restore, deps.TiDBClusterLister)).To(Equal(uint(60)))
+	helper.CreateTC(restore.Namespace, restore.Spec.BR.Cluster, false, false)
+	g.Eventually(func() uint {
+		return restoreBandwidth(restore, deps.TiDBClusterLister)
+	}, time.Second*10).Should(Equal(uint(180)))
+}
+
+func TestRestoreJobLimit(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+	deps.CLIConfig.MaxConcurrentRestoreJobs = 1
+
+	restores := genValidBRRestores()[:2]
+	for _, restore := range restores {
+		helper.createRestore(restore)
+		helper.CreateSecret(restore)
+		helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	}
+	m := NewRestoreManager(deps)
+
+	g.Expect(m.Sync(restores[0])).Should(Succeed())
+	g.Eventually(func() (int, error) {
+		return RunningRestoreJobs(deps.JobLister)
+	}, time.Second*10).Should(Equal(1))
+
+	// the running job reaches the limit
+	err := m.Sync(restores[1])
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	helper.hasCondition(restores[1].Namespace, restores[1].Name, v1alpha1.RestoreThrottled, "RestoreJobLimitReached")
+
+	// only the first job of a restore is throttled, the later jobs of the scheduled restore are created
+	scheduled := restores[1].DeepCopy()
+	scheduled.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreScheduled, Status: corev1.ConditionTrue}}
+	g.Expect(m.Sync(scheduled)).Should(Succeed())
+	g.Expect(deps.KubeClientset.BatchV1().Jobs(scheduled.Namespace).Delete(context.TODO(), scheduled.GetRestoreJobName(), metav1.DeleteOptions{})).To(Succeed())
+	g.Eventually(func() (int, error) {
+		return RunningRestoreJobs(deps.JobLister)
+	}, time.Second*10).Should(Equal(1))
+
+	// the throttled restore creates its job after the running one finishes
+	job, err := deps.KubeClientset.BatchV1().Jobs(restores[0].Namespace).Get(context.TODO(), restores[0].GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	_, err = deps.KubeClientset.BatchV1().Jobs(job.Namespace).UpdateStatus(context.TODO(), job, metav1.UpdateOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Eventually(func() (int, error) {
+		return RunningRestoreJobs(deps.JobLister)
+	}, time.Second*10).Should(Equal(0))
+
+	// condition Throttled is cleared once the restore is admitted
+	throttled, err := deps.Clientset.PingcapV1alpha1().Restores(restores[1].Namespace).Get(context.TODO(), restores[1].Name, metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	reason, err := m.(*restoreManager).checkRestoreJobLimit(throttled)
+	g.Expect(err).Should(BeNil())
+	g.Expect(reason).To(BeEmpty())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restores[1].Namespace).Get(context.TODO(), restores[1].Name, metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	_, cond := v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreThrottled)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal("RestoreJobLimitAvailable"))
+
+	g.Expect(m.Sync(restores[1])).Should(Succeed())
+	helper.hasCondition(restores[1].Namespace, restores[1].Name, v1alpha1.RestoreScheduled, "")
+}
+
+func TestRestorePriorityClassNotFound(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.PriorityClassName = "restore-high"
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+	m := NewRestoreManager(deps)
+
+	// the job is not created if the priority class doesn't exist
+	err := m.Sync(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("priority class restore-high"))
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreRetryFailed, priorityClassNotFoundReason)
+	_, err = deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the job is created after the priority class is created
+	_, err = deps.KubeClientset.SchedulingV1().PriorityClasses().Create(context.TODO(), &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore-high"},
+		Value:      1000,
+	}, metav1.CreateOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(m.Sync(restore)).To(Succeed())
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(job.Spec.Template.Spec.PriorityClassName).To(Equal("restore-high"))
+}
+
+func TestFailedConditionType(t *testing.T) {
+	g := NewGomegaWithT(t)
+	g.Expect(failedConditionType(tikvReplicasMismatchedReason)).To(Equal(v1alpha1.RestoreFailed))
+	g.Expect(failedConditionType(tikvEncryptionMismatchedReason)).To(Equal(v1alpha1.RestoreFailed))
+	g.Expect(failedConditionType(backuputil.UnsupportedStorageTypeReason)).To(Equal(v1alpha1.RestoreFailed))
+	g.Expect(failedConditionType("GetVolSnapBackupMetaData failed")).To(Equal(v1alpha1.RestoreRetryFailed))
+	g.Expect(failedConditionType(volSnapBackupMetaFailedReason(&backuputil.IncompatibleBackupMetaVersionError{Version: 2, MaxSupportedVersion: 1}))).To(Equal(v1alpha1.RestoreFailed))
+	g.Expect(failedConditionType("ListTiKVPodsFailed")).To(Equal(v1alpha1.RestoreRetryFailed))
+}
+
+// slowBucket is a storage bucket whose reads never finish before the context is done
+type slowBucket struct {
+	driver.Bucket
+	attempts int
+}
+
+func (b *slowBucket) Attributes(ctx context.Context, key string) (*driver.Attributes, error) {
+	b.attempts++
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *slowBucket) ErrorCode(err error) gcerrors.ErrorCode {
+	return gcerrors.Unknown
+}
+
+func (b *slowBucket) Close() error {
+	return nil
+}
+
+func TestReadRestoreMetaTimeout(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+
+	bucket := &slowBucket{}
+	patches := gomonkey.ApplyFunc(backuputil.NewStorageBackend, func(provider v1alpha1.StorageProvider, cred *backuputil.StorageCredential) (*backuputil.StorageBackend, error) {
+		return &backuputil.StorageBackend{Bucket: blob.NewBucket(bucket)}, nil
+	})
+	defer patches.Reset()
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-meta-timeout",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:            v1alpha1.RestoreModeVolumeSnapshot,
+			MetaReadTimeout: &metav1.Duration{Duration: 10 * time.Millisecond},
+			StorageProvider: v1alpha1.StorageProvider{
+				S3: &v1alpha1.S3StorageProvider{
+					Bucket: "bucket",
+					Prefix: "prefix",
+				},
+			},
+		},
+	}
+	m := NewRestoreManager(helper.Deps).(*restoreManager)
+	// every sync reads the restore meta once, the failed read is retried by requeueing the restore
+	for i := 1; i < restoreMetaReadAttempts; i++ {
+		_, _, err := m.readRestoreMetaFromExternalStorage(restore)
+		g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+		g.Expect(err.Error()).To(ContainSubstring("ReadRestoreMetaTimeout"))
+		g.Expect(bucket.attempts).To(Equal(i))
+	}
+	_, reason, err := m.readRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(controller.IsRequeueError(err)).To(BeFalse())
+	g.Expect(err.Error()).To(ContainSubstring("timed out after 10ms"))
+	g.Expect(reason).To(Equal("ReadRestoreMetaTimeout"))
+	g.Expect(bucket.attempts).To(Equal(restoreMetaReadAttempts))
+}
+
+func TestSyncPiTRRestoreJob(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	// the restore left by the controller before it restarts, BR has started to restore the log backup
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pitr"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:           v1alpha1.RestoreModePiTR,
+			PitrRestoredTs: "443123456789",
+		},
+		Status: v1alpha1.RestoreStatus{
+			Phase:     v1alpha1.RestoreRunning,
+			PiTRPhase: v1alpha1.RestorePiTRFullRestore,
+			Conditions: []v1alpha1.RestoreCondition{
+				{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue},
+			},
+			Progresses: []v1alpha1.Progress{
+				{Step: "Full Restore", Progress: 100},
+				{Step: "Restore KV Files", Progress: 10},
+			},
+		},
+	}
+	helper.createRestore(restore)
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: restore.GetRestoreJobName()}}
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	g.Expect(m.syncPiTRRestoreJob(restore, job)).Should(Succeed())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores("ns").Get(context.TODO(), "pitr", metav1.GetOptions{})
+	g.Expect(err).Should(Succeed())
+	g.Expect(get.Status.PiTRPhase).Should(Equal(v1alpha1.RestorePiTRLogRestore))
+
+	// the job fails without the backup-manager reporting it
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"},
+	}
+	err = m.syncPiTRRestoreJob(restore, job)
+	g.Expect(controller.IsIgnoreError(err)).Should(BeTrue())
+	helper.hasCondition("ns", "pitr", v1alpha1.RestoreFailed, "PiTRJobFailed")
+}
+
+func TestValidatePiTRRestoredTs(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+
+	localProvider := func(dir string) v1alpha1.StorageProvider {
+		return v1alpha1.StorageProvider{
+			Local: &v1alpha1.LocalStorageProvider{
+				Volume:      corev1.Volume{Name: "local"},
+				VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+			},
+		}
+	}
+	fullBackupDir := t.TempDir()
+	meta, err := proto.Marshal(&kvbackup.BackupMeta{EndVersion: 1000})
+	g.Expect(err).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(fullBackupDir, constants.MetaFile), meta, 0644)).To(Succeed())
+
+	logBackupDir := t.TempDir()
+	checkpointDir := filepath.Join(logBackupDir, constants.LogBackupCheckpointDir)
+	g.Expect(os.MkdirAll(checkpointDir, 0755)).To(Succeed())
+	for storeID, ts := range map[string]uint64{"1": 2000, "2": 3000} {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, ts)
+		g.Expect(os.WriteFile(filepath.Join(checkpointDir, storeID+".ts"), data, 0644)).To(Succeed())
+	}
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pitr"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:                          v1alpha1.RestoreModePiTR,
+			StorageProvider:               localProvider(logBackupDir),
+			PitrFullBackupStorageProvider: localProvider(fullBackupDir),
+		},
+	}
+	m := NewRestoreManager(helper.Deps).(*restoreManager)
+	for _, c := range []struct {
+		ts     string
+		reason string
+		errSub string
+	}{
+		{ts: ""},
+		{ts: "1000"},
+		{ts: "3000"},
+		{ts: "999", reason: invalidPitrTimestampReason, errSub: "before the full backup ends at 1000"},
+		{ts: "3001", reason: invalidPitrTimestampReason, errSub: "after the checkpoint 3000 of the log backup"},
+	} {
+		restore.Spec.PitrRestoredTs = c.ts
+		reason, err := m.validatePiTRRestoredTs(restore)
+		g.Expect(reason).To(Equal(c.reason), "ts %s", c.ts)
+		if c.errSub == "" {
+			g.Expect(err).To(Succeed(), "ts %s", c.ts)
+		} else {
+			g.Expect(err).To(MatchError(ContainSubstring(c.errSub)), "ts %s", c.ts)
+		}
+	}
+	g.Expect(failedConditionType(invalidPitrTimestampReason)).To(Equal(v1alpha1.RestoreFailed))
+
+	// the upper bound is not checked before log backup uploads any checkpoint
+	g.Expect(os.RemoveAll(checkpointDir)).To(Succeed())
+	restore.Spec.PitrRestoredTs = "3001"
+	reason, err := m.validatePiTRRestoredTs(restore)
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(err).To(Succeed())
+}
+
+func TestBRRestoreWithBRImageRegistry(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.BRImageRegistry = "mirror.local/pingcap"
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal("mirror.local/pingcap/br:v6.5.0"))
+
+	// ToolImage takes precedence over BRImageRegistry
+	restore.Spec.ToolImage = "tools.local/br"
+	job, _, err = m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal("tools.local/br:v6.5.0"))
+}
+
+func TestBRRestoreWithBRVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.BRVersion = "v7.1.0"
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	// BRVersion overrides the version of the BR image and the TiKV version passed to BR
+	m := NewRestoreManager(deps).(*restoreManager)
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal("pingcap/br:v7.1.0"))
+	g.Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--tikvVersion=v7.1.0"))
+
+	restore.Spec.ToolImage = "tools.local/br"
+	job, _, err = m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Image).To(Equal("tools.local/br:v7.1.0"))
+
+	// BRVersion must not be older than the version of the cluster the backup is taken from
+	dir := t.TempDir()
+	restore.Spec.StorageProvider = v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume: corev1.Volume{
+				Name:         "local",
+				VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: dir}},
+			},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+		},
+	}
+	writeBackupMeta := func(clusterVersion string) {
+		data, err := proto.Marshal(&kvbackup.BackupMeta{ClusterVersion: clusterVersion})
+		g.Expect(err).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(dir, "backupmeta"), data, 0644)).To(Succeed()) //nolint:gosec
+		m.metaCache.MetaCache = backuputil.NewMetaCache()
+	}
+
+	writeBackupMeta(`"v7.5.0"`)
+	reason, err := m.checkBRVersion(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal(brVersionTooOldReason))
+	g.Expect(failedConditionType(reason)).To(Equal(v1alpha1.RestoreFailed))
+
+	writeBackupMeta(`"v6.5.0"`)
+	reason, err = m.checkBRVersion(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// the check is skipped if the version is not recorded
+	writeBackupMeta("")
+	_, err = m.checkBRVersion(restore)
+	g.Expect(err).To(Succeed())
+
+	// the check is skipped if the backup meta can't be read
+	g.Expect(os.WriteFile(filepath.Join(dir, "backupmeta"), []byte("not a backup meta"), 0644)).To(Succeed()) //nolint:gosec
+	m.metaCache.MetaCache = backuputil.NewMetaCache()
+	reason, err = m.checkBRVersion(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+func TestRestoreInitContainerResources(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.ResourceRequirements = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("16Gi")},
+	}
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	// the init container has the resource requirements of the restore container by default
+	m := NewRestoreManager(deps).(*restoreManager)
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Resources).To(Equal(restore.Spec.ResourceRequirements))
+
+	restore.Spec.InitContainerResources = &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+	}
+	job, _, err = m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.InitContainers[0].Resources).To(Equal(*restore.Spec.InitContainerResources))
+	g.Expect(job.Spec.Template.Spec.Containers[0].Resources).To(Equal(restore.Spec.ResourceRequirements))
+}
+
+func TestRestoreBackupManagerImage(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal(deps.CLIConfig.TiDBBackupManagerImage))
+
+	// the image of the restore overrides the one of the operator
+	restore.Spec.BackupManagerImage = "registry.local/pingcap/tidb-backup-manager:v1.5.0-fix"
+	job, _, err = m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal(restore.Spec.BackupManagerImage))
+}
+
+func TestBRRestoreDebug(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Spec.Debug = true
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+
+	// the restore container sleeps and the original args are kept in the env
+	container := job.Spec.Template.Spec.Containers[0]
+	g.Expect(container.Args).To(Equal([]string{"sleep", "infinity"}))
+	g.Expect(container.Env).To(ContainElement(corev1.EnvVar{
+		Name:  debugRestoreArgsEnv,
+		Value: fmt.Sprintf("'restore' '--namespace=%s' '--restoreName=%s' '--tikvVersion=v6.5.0' '--mode=snapshot' '--cluster-tls=true' '--client-tls=true'", restore.Namespace, restore.Name),
+	}))
+	g.Expect(shellQuote("it's")).To(Equal(`'it'\''s'`))
+}
+
+func TestBRRestoreAdditionalContainers(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	logsMount := corev1.VolumeMount{Name: "logs", MountPath: "/var/log/restore"}
+	restore.Spec.AdditionalContainers = []corev1.Container{
+		{Name: "log-shipper", Image: "fluent-bit", VolumeMounts: []corev1.VolumeMount{logsMount}},
+		{Name: label.RestoreJobLabelVal, VolumeMounts: []corev1.VolumeMount{logsMount}},
+	}
+	restore.Spec.AdditionalVolumes = []corev1.Volume{
+		{Name: "logs", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	job, _, err := m.makeRestoreJob(restore)
+	g.Expect(err).Should(BeNil())
+	// the sidecar is appended and the restore container is patched
+	containers := job.Spec.Template.Spec.Containers
+	g.Expect(containers).To(HaveLen(2))
+	g.Expect(containers[0].Name).To(Equal(label.RestoreJobLabelVal))
+	g.Expect(containers[0].Args).NotTo(BeEmpty())
+	g.Expect(containers[0].VolumeMounts).To(ContainElement(logsMount))
+	g.Expect(containers[1].Name).To(Equal("log-shipper"))
+	g.Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(restore.Spec.AdditionalVolumes[0]))
+
+	// the additional volumes can't override the generated ones
+	restore.Spec.AdditionalVolumes[0].Name = "br-bin"
+	_, reason, err := m.makeRestoreJob(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("AdditionalVolumeConflict"))
+}
+
+func TestBRRestoreImagePullPolicy(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	for _, policy := range []corev1.PullPolicy{corev1.PullIfNotPresent, corev1.PullAlways} {
+		if policy != corev1.PullIfNotPresent {
+			restore.Spec.ImagePullPolicy = &policy
+		}
+		job, _, err := m.makeRestoreJob(restore)
+		g.Expect(err).Should(BeNil())
+		podSpec := job.Spec.Template.Spec
+		g.Expect(podSpec.InitContainers).NotTo(BeEmpty())
+		for _, c := range append(podSpec.InitContainers, podSpec.Containers...) {
+			g.Expect(c.ImagePullPolicy).To(Equal(policy), "container %s", c.Name)
+		}
+	}
+}
+
+func TestBRRestoreRestrictedSecurityContext(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	helper.createRestore(restore)
+	helper.CreateSecret(restore)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+
+	// the pod runs as non-root with a read-only root filesystem, and /tmp is writable
+	podSpec := job.Spec.Template.Spec
+	g.Expect(*podSpec.SecurityContext.RunAsNonRoot).To(BeTrue())
+	g.Expect(podSpec.SecurityContext.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+	g.Expect(podSpec.InitContainers).NotTo(BeEmpty())
+	for _, c := range append(podSpec.InitContainers, podSpec.Containers...) {
+		g.Expect(*c.SecurityContext.ReadOnlyRootFilesystem).To(BeTrue(), "container %s", c.Name)
+		g.Expect(c.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")), "container %s", c.Name)
+		g.Expect(c.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: restoreTmpVolumeName, MountPath: "/tmp"}), "container %s", c.Name)
+	}
+
+	// it is not applied if the user sets the pod security context or opts out
+	restore.Spec.PodSecurityContext = &corev1.PodSecurityContext{RunAsUser: pointer.Int64Ptr(0)}
+	g.Expect(restrictedSecurityContextEnabled(restore)).To(BeFalse())
+	restore.Spec.PodSecurityContext = nil
+	restore.Spec.RestrictedSecurityContext = pointer.BoolPtr(false)
+	g.Expect(restrictedSecurityContextEnabled(restore)).To(BeFalse())
+
+	// it is not applied by default to the restore with the local storage, unless it's enabled explicitly
+	restore.Spec.RestrictedSecurityContext = nil
+	restore.Spec.Local = &v1alpha1.LocalStorageProvider{}
+	g.Expect(restrictedSecurityContextEnabled(restore)).To(BeFalse())
+	restore.Spec.RestrictedSecurityContext = pointer.BoolPtr(true)
+	g.Expect(restrictedSecurityContextEnabled(restore)).To(BeTrue())
+}
+
+func TestBRRestoreJobNamespace(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.Namespace = "ops"
+	restore.Spec.JobNamespace = restore.Spec.BR.ClusterNamespace
+	helper.createRestore(restore)
+	// the secrets are referenced from the namespace of the job
+	inJobNS := restore.DeepCopy()
+	inJobNS.Namespace = restore.Spec.JobNamespace
+	helper.CreateSecret(inJobNS)
+	helper.CreateTLSSecrets(inJobNS)
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, false, false)
+
+	m := NewRestoreManager(deps)
+	g.Expect(m.Sync(restore)).To(Succeed())
+	job, err := deps.KubeClientset.BatchV1().Jobs(restore.Spec.JobNamespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(job.OwnerReferences).To(BeEmpty())
+
+	// the job is cleaned up by the finalizer instead of the owner reference
+	r, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(r.Finalizers).To(ContainElement(label.RestoreJobCleanupFinalizer))
+
+	g.Eventually(func() error {
+		_, err := deps.JobLister.Jobs(restore.Spec.JobNamespace).Get(restore.GetRestoreJobName())
+		return err
+	}, time.Second*10).Should(BeNil())
+	now := metav1.Now()
+	r.DeletionTimestamp = &now
+	g.Expect(m.Sync(r)).To(Succeed())
+	_, err = deps.KubeClientset.BatchV1().Jobs(restore.Spec.JobNamespace).Get(context.TODO(), restore.GetRestoreJobName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	r, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).Should(BeNil())
+	g.Expect(r.Finalizers).NotTo(ContainElement(label.RestoreJobCleanupFinalizer))
+}
+
+func TestReadRestoreMetaFromFallbackStorage(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	localProvider := func(dir string) v1alpha1.StorageProvider {
+		return v1alpha1.StorageProvider{
+			Local: &v1alpha1.LocalStorageProvider{
+				Volume:      corev1.Volume{Name: "local"},
+				VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+			},
+		}
+	}
+	primaryDir, fallbackDir := t.TempDir(), t.TempDir()
+	err := os.WriteFile(filepath.Join(fallbackDir, constants.ClusterRestoreMeta), []byte(testutils.ConstructRestoreMetaStr()), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "fallback"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:                     v1alpha1.RestoreModeVolumeSnapshot,
+			StorageProvider:          localProvider(primaryDir),
+			FallbackStorageProviders: []v1alpha1.StorageProvider{localProvider(fallbackDir)},
+		},
+	}
+	helper.createRestore(restore)
+
+	// the restore meta is not in the primary storage, it's read from the fallback storage
+	m := NewRestoreManager(deps).(*restoreManager)
+	csb, reason, err := m.readRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(csb).NotTo(BeNil())
+	fallbackPath, err := backuputil.GetStoragePath(restore.Spec.FallbackStorageProviders[0])
+	g.Expect(err).To(Succeed())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores("ns").Get(context.TODO(), "fallback", metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(get.Status.StoragePath).To(Equal(fallbackPath))
+
+	// the storage recorded in the status is tried first
+	restore.Status.StoragePath = fallbackPath
+	providers, indexes := backuputil.RestoreStorageProviders(restore)
+	g.Expect(providers).To(Equal([]v1alpha1.StorageProvider{localProvider(fallbackDir), localProvider(primaryDir)}))
+	g.Expect(indexes).To(Equal([]int{1, 0}))
+
+	// none of the storages has the restore meta
+	g.Expect(os.Remove(filepath.Join(fallbackDir, constants.ClusterRestoreMeta))).To(Succeed())
+	_, reason, err = m.readRestoreMetaFromExternalStorage(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("FileNotExists"))
+}
+
+func TestRestartTiKVInBatches(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "restart-in-batches"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:                      v1alpha1.RestoreModeVolumeSnapshot,
+			FederalVolumeRestorePhase: v1alpha1.FederalVolumeRestoreFinish,
+			TiKVRestartBatchSize:      pointer.Int32Ptr(2),
+			TiKVRestartBatchInterval:  &metav1.Duration{Duration: time.Minute},
+		},
+	}
+	helper.createRestore(restore)
+	tc := &v1alpha1.TidbCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cluster"},
+		Spec: v1alpha1.TidbClusterSpec{
+			TiKV: &v1alpha1.TiKVSpec{Replicas: 3},
+		},
+		Status: v1alpha1.TidbClusterStatus{
+			TiKV: v1alpha1.TiKVStatus{Stores: map[string]v1alpha1.TiKVStore{
+				"1": {State: v1alpha1.TiKVStateUp},
+				"2": {State: v1alpha1.TiKVStateUp},
+				"3": {State: v1alpha1.TiKVStateUp},
+			}},
+		},
+	}
+
+	podIndexer := deps.KubeInformerFactory.Core().V1().Pods().Informer().GetIndexer()
+	newPod := func(name string, created time.Time, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: status, LastTransitionTime: metav1.NewTime(created)},
+			}},
+		}
+		g.Expect(podIndexer.Add(pod)).To(Succeed())
+		return pod
+	}
+	exists := func(name string) bool {
+		_, ok, err := podIndexer.GetByKey("ns/" + name)
+		g.Expect(err).To(Succeed())
+		return ok
+	}
+	created := time.Now().Add(-time.Hour)
+	pods := []*corev1.Pod{
+		newPod("cluster-tikv-2", created, true),
+		newPod("cluster-tikv-0", created, true),
+		newPod("cluster-tikv-1", created, true),
+	}
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	syncStatus := func() {
+		get, err := deps.Clientset.PingcapV1alpha1().Restores("ns").Get(context.TODO(), restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		restore.Status = get.Status
+	}
+
+	// the first wave restarts the first 2 pods
+	_, err := m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring("restarted a wave of 2 TiKV pods, 1 pods left"))
+	g.Expect(exists("cluster-tikv-0")).To(BeFalse())
+	g.Expect(exists("cluster-tikv-1")).To(BeFalse())
+	g.Expect(exists("cluster-tikv-2")).To(BeTrue())
+	syncStatus()
+	g.Expect(restore.Status.TiKVRestartStartTime).NotTo(BeNil())
+
+	// the pods of the first wave are not ready yet
+	pods = []*corev1.Pod{pods[0], newPod("cluster-tikv-0", time.Now(), false), newPod("cluster-tikv-1", time.Now(), true)}
+	_, err = m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(err).To(MatchError(ContainSubstring("waiting for 1 TiKV pods of the last wave ready")))
+
+	// wait for the interval after the pods of the first wave are ready
+	pods[1] = newPod("cluster-tikv-0", time.Now(), true)
+	_, err = m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(err).To(MatchError(ContainSubstring("before restarting the next wave of TiKV pods")))
+	g.Expect(exists("cluster-tikv-2")).To(BeTrue())
+
+	// the TiKV stores are not all available
+	restore.Spec.TiKVRestartBatchInterval = nil
+	tc.Status.TiKV.Stores["1"] = v1alpha1.TiKVStore{State: v1alpha1.TiKVStateDown}
+	_, err = m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(err).To(MatchError(ContainSubstring("waiting for all TiKVs are available")))
+
+	// the last wave
+	tc.Status.TiKV.Stores["1"] = v1alpha1.TiKVStore{State: v1alpha1.TiKVStateUp}
+	_, err = m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(err).To(MatchError(ContainSubstring("restarted a wave of 1 TiKV pods, 0 pods left")))
+	g.Expect(exists("cluster-tikv-2")).To(BeFalse())
+
+	// all the pods are restarted
+	pods[0] = newPod("cluster-tikv-2", time.Now(), true)
+	reason, err := m.restartTiKVInBatches(restore, tc, pods)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+}
+
+func TestAddVolumeTags(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "add-volume-tags"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+		},
+	}
+	helper.createRestore(restore)
+	getRestore := func() *v1alpha1.Restore {
+		r, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		return r
+	}
+	newPV := func(volumeID string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + volumeID},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{VolumeHandle: volumeID},
+				},
+			},
+		}
+	}
+	pvs := []*corev1.PersistentVolume{newPV("vol-1"), newPV("vol-2"), newPV("vol-3")}
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	s := &fakeVolumeSnapshotter{tagErrs: map[string]error{"vol-2": fmt.Errorf("request limit exceeded")}}
+
+	// the volumes tagged successfully are recorded even if some volumes fail
+	err := m.addVolumeTags(restore, s, pvs)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("vol-2"))
+	g.Expect(s.tagged).To(Equal([]string{"vol-1", "vol-3"}))
+	g.Expect(getRestore().Status.TaggedVolumes).To(Equal([]string{"vol-1", "vol-3"}))
+
+	// only the volumes failed are tagged when retrying
+	restore = getRestore()
+	s.tagged = nil
+	s.tagErrs = nil
+	g.Expect(m.addVolumeTags(restore, s, pvs)).To(Succeed())
+	g.Expect(s.tagged).To(Equal([]string{"vol-2"}))
+	g.Expect(getRestore().Status.TaggedVolumes).To(Equal([]string{"vol-1", "vol-2", "vol-3"}))
+
+	// nothing is tagged again after all the volumes are tagged
+	restore = getRestore()
+	s.tagged = nil
+	g.Expect(m.addVolumeTags(restore, s, pvs)).To(Succeed())
+	g.Expect(s.tagged).To(BeEmpty())
+}
+
+func TestWarmupImages(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "warmup-images"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:                      v1alpha1.RestoreModeVolumeSnapshot,
+			FederalVolumeRestorePhase: v1alpha1.FederalVolumeRestoreVolume,
+			WarmupImages:              true,
+			NodeSelector:              map[string]string{"node-pool": "restore"},
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+		},
+	}
+	helper.createRestore(restore)
+	tc := &v1alpha1.TidbCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cluster"},
+		Spec: v1alpha1.TidbClusterSpec{
+			Version: "v6.5.0",
+			TiKV:    &v1alpha1.TiKVSpec{BaseImage: "registry.local/pingcap/tikv"},
+		},
+	}
+	getRestore := func() *v1alpha1.Restore {
+		r, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		return r
+	}
+	dsClient := deps.KubeClientset.AppsV1().DaemonSets(restore.Namespace)
+	updateDSStatus := func(desired, ready int32) {
+		ds, err := dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: ds.Generation, DesiredNumberScheduled: desired, NumberReady: ready}
+		_, err = dsClient.UpdateStatus(context.TODO(), ds, metav1.UpdateOptions{})
+		g.Expect(err).To(Succeed())
+	}
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the daemonset is created to pull the images onto the nodes of the restore pods
+	m.startImageWarmup(restore, tc)
+	ds, err := dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(ds.Spec.Template.Spec.NodeSelector).To(Equal(restore.Spec.NodeSelector))
+	g.Expect(ds.Spec.Template.Spec.InitContainers[0].Image).To(Equal("registry.local/pingcap/br:v6.5.0"))
+	g.Expect(ds.Spec.Template.Spec.Containers[0].Image).To(Equal(deps.CLIConfig.TiDBBackupManagerImage))
+
+	// the daemonset is not looked up again once it's created
+	g.Expect(dsClient.Delete(context.TODO(), restore.GetImageWarmupName(), metav1.DeleteOptions{})).To(Succeed())
+	m.startImageWarmup(restore, tc)
+	_, err = dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	m.warmupStarted.Delete(fmt.Sprintf("%s/%s", restore.Namespace, restore.Name))
+	m.startImageWarmup(restore, tc)
+
+	// the daemonset is deleted after all its pods are ready
+	updateDSStatus(2, 2)
+	m.finishImageWarmup(restore)
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreImageWarmupComplete, "")
+	_, err = dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the restore doesn't wait for the images pulled onto all the nodes
+	restore.Name = "warmup-incomplete"
+	helper.createRestore(restore)
+	m.startImageWarmup(restore, tc)
+	updateDSStatus(2, 1)
+	m.finishImageWarmup(restore)
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreImageWarmupComplete, "ImageWarmupIncomplete")
+	_, cond := v1alpha1.GetRestoreCondition(&getRestore().Status, v1alpha1.RestoreImageWarmupComplete)
+	g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+	_, err = dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the daemonset of the failed restore is deleted when the restore is synced
+	restore.Name = "warmup-failed"
+	helper.createRestore(restore)
+	m.startImageWarmup(restore, tc)
+	g.Expect(NeedImageWarmupCleanup(restore)).To(BeFalse())
+	failed := getRestore()
+	failed.Status.Phase = v1alpha1.RestoreFailed
+	failed.Status.Conditions = append(failed.Status.Conditions, v1alpha1.RestoreCondition{Type: v1alpha1.RestoreFailed, Status: corev1.ConditionTrue})
+	g.Expect(NeedImageWarmupCleanup(failed)).To(BeTrue())
+	g.Expect(m.Sync(failed)).To(Succeed())
+	_, err = dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreImageWarmupComplete, "ImageWarmupAborted")
+	_, cond = v1alpha1.GetRestoreCondition(&getRestore().Status, v1alpha1.RestoreImageWarmupComplete)
+	g.Expect(cond.Message).To(Equal(fmt.Sprintf("the image warmup daemonset %s is deleted after the restore failed", restore.GetImageWarmupName())))
+
+	// the invalid restore is cleaned up the same way
+	restore.Name = "warmup-invalid"
+	helper.createRestore(restore)
+	m.startImageWarmup(restore, tc)
+	invalid := getRestore()
+	invalid.Status.Phase = v1alpha1.RestoreInvalid
+	invalid.Status.Conditions = append(invalid.Status.Conditions, v1alpha1.RestoreCondition{Type: v1alpha1.RestoreInvalid, Status: corev1.ConditionTrue})
+	g.Expect(m.Sync(invalid)).To(Succeed())
+	_, err = dsClient.Get(context.TODO(), restore.GetImageWarmupName(), metav1.GetOptions{})
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreImageWarmupComplete, "ImageWarmupAborted")
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// readRestoreMeta reads the restore meta from the ConfigMap referenced by RestoreMetaConfigMap if it's set,
+// otherwise from the external storage
+func (rm *restoreManager) readRestoreMeta(r *v1alpha1.Restore) (*snapshotter.CloudSnapBackup, string, error) {
+	if r.Spec.RestoreMetaConfigMap == nil {
+		return rm.readRestoreMetaFromExternalStorage(r)
+	}
+	return rm.readRestoreMetaFromConfigMap(r)
+}
+
+// readRestoreMetaFromConfigMap reads the restore meta from the ConfigMap in the namespace of the restore, the
+// meta is the same JSON as the file in the external storage and keyed by the file name in Data or BinaryData,
+// the gzipped meta in BinaryData is decompressed.
+// The ConfigMap is got from the API server since it's created by the user without the labels of the informer.
+func (rm *restoreManager) readRestoreMetaFromConfigMap(r *v1alpha1.Restore) (*snapshotter.CloudSnapBackup, string, error) {
+	name := r.Spec.RestoreMetaConfigMap.Name
+	klog.Infof("restore %s/%s: read the restore meta from configmap %s", r.Namespace, r.Name, name)
+	cm, err := rm.deps.KubeClientset.CoreV1().ConfigMaps(r.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, "RestoreMetaConfigMapNotFound", err
+	}
+	if err != nil {
+		return nil, "GetRestoreMetaConfigMapFailed", err
+	}
+
+	var restoreMeta []byte
+	if data, ok := cm.Data[constants.ClusterRestoreMeta]; ok {
+		restoreMeta = []byte(data)
+	} else if data, ok := cm.BinaryData[constants.ClusterRestoreMeta]; ok {
+		restoreMeta = data
+	} else {
+		return nil, "FileNotExists", fmt.Errorf("%s does not exist in configmap %s/%s", constants.ClusterRestoreMeta, r.Namespace, name)
+	}
+	restoreMeta, err = backuputil.DecompressRestoreMeta(restoreMeta)
+	if err != nil {
+		return nil, "DecompressRestoreMetaFailed", err
+	}
+
+	csb := &snapshotter.CloudSnapBackup{}
+	if err := json.Unmarshal(restoreMeta, csb); err != nil {
+		return nil, "ParseCloudSnapBackupFailed", err
+	}
+	return csb, "", nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	"github.com/pingcap/tidb-operator/pkg/backup/testutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadRestoreMetaFromConfigMap(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-meta-configmap", Namespace: "ns"},
+		Spec: v1alpha1.RestoreSpec{
+			Mode:                 v1alpha1.RestoreModeVolumeSnapshot,
+			RestoreMetaConfigMap: &corev1.LocalObjectReference{Name: "restore-meta"},
+		},
+	}
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	_, reason, err := m.readRestoreMeta(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("RestoreMetaConfigMapNotFound"))
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "restore-meta", Namespace: "ns"},
+		Data:       map[string]string{"other": "{}"},
+	}
+	cm, err = deps.KubeClientset.CoreV1().ConfigMaps("ns").Create(context.TODO(), cm, metav1.CreateOptions{})
+	g.Expect(err).To(Succeed())
+	_, reason, err = m.readRestoreMeta(restore)
+	g.Expect(err).To(MatchError(ContainSubstring("restoremeta does not exist in configmap ns/restore-meta")))
+	g.Expect(reason).To(Equal("FileNotExists"))
+
+	cm.BinaryData = map[string][]byte{constants.ClusterRestoreMeta: []byte("invalid")}
+	cm, err = deps.KubeClientset.CoreV1().ConfigMaps("ns").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	_, reason, err = m.readRestoreMeta(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("ParseCloudSnapBackupFailed"))
+
+	cm.Data[constants.ClusterRestoreMeta] = testutils.ConstructRestoreMetaStr()
+	_, err = deps.KubeClientset.CoreV1().ConfigMaps("ns").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	csb, _, err := m.readRestoreMeta(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(csb.TiKV).NotTo(BeNil())
+	g.Expect(csb.Kubernetes).NotTo(BeNil())
+
+	// the gzipped meta in binaryData
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write([]byte(testutils.ConstructRestoreMetaStr()))
+	g.Expect(err).To(Succeed())
+	g.Expect(w.Close()).To(Succeed())
+	delete(cm.Data, constants.ClusterRestoreMeta)
+	cm.BinaryData[constants.ClusterRestoreMeta] = buf.Bytes()[:buf.Len()/2]
+	cm, err = deps.KubeClientset.CoreV1().ConfigMaps("ns").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	_, reason, err = m.readRestoreMeta(restore)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(reason).To(Equal("DecompressRestoreMetaFailed"))
+
+	cm.BinaryData[constants.ClusterRestoreMeta] = buf.Bytes()
+	_, err = deps.KubeClientset.CoreV1().ConfigMaps("ns").Update(context.TODO(), cm, metav1.UpdateOptions{})
+	g.Expect(err).To(Succeed())
+	csb, _, err = m.readRestoreMeta(restore)
+	g.Expect(err).To(Succeed())
+	g.Expect(csb.TiKV).NotTo(BeNil())
+	g.Expect(csb.Kubernetes).NotTo(BeNil())
+}
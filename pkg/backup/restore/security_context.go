@@ -0,0 +1,108 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// restoreRunAsUser is the uid the restore pod runs as with the restricted security context,
+	// the tools in the backup manager and BR images are readable and executable by any user
+	restoreRunAsUser int64 = 65534
+
+	// restoreTmpVolumeName is the writable volume mounted at /tmp in the restore containers with the read-only root,
+	// the entrypoint writes the rclone config and the lightning config there
+	restoreTmpVolumeName = "tmp"
+)
+
+// restrictedSecurityContextEnabled returns whether to apply the restricted security context to the restore pod,
+// it is only applied if the user doesn't set the pod security context. It's enabled by default unless the
+// restore uses the volumes which may not be writable by the non-root user, e.g. the NFS of the `local` storage,
+// the existing restores with them keep working after the operator is upgraded.
+func restrictedSecurityContextEnabled(restore *v1alpha1.Restore) bool {
+	if restore.Spec.PodSecurityContext != nil {
+		return false
+	}
+	if enabled := restore.Spec.RestrictedSecurityContext; enabled != nil {
+		return *enabled
+	}
+	return restore.Spec.Local == nil && len(restore.Spec.AdditionalVolumes) == 0
+}
+
+// applyRestrictedSecurityContext sets a security context satisfying the `restricted` Pod Security Standard
+// to the restore pod and the containers without one. The root filesystem is read-only, so an emptyDir
+// is mounted at /tmp, the other paths written by BR and lightning are already emptyDir or the restore PVC,
+// which is writable by the fsGroup.
+func applyRestrictedSecurityContext(job *batchv1.Job) {
+	podSpec := &job.Spec.Template.Spec
+	podSpec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsNonRoot: pointer.BoolPtr(true),
+		RunAsUser:    pointer.Int64Ptr(restoreRunAsUser),
+		RunAsGroup:   pointer.Int64Ptr(restoreRunAsUser),
+		FSGroup:      pointer.Int64Ptr(restoreRunAsUser),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	tmpMount := corev1.VolumeMount{Name: restoreTmpVolumeName, MountPath: constants.LocalTmp}
+	hasTmpVolume := false
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == restoreTmpVolumeName {
+			hasTmpVolume = true
+			break
+		}
+	}
+	if !hasTmpVolume {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: restoreTmpVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			c := &containers[i]
+			if c.SecurityContext != nil {
+				continue
+			}
+			c.SecurityContext = &corev1.SecurityContext{
+				AllowPrivilegeEscalation: pointer.BoolPtr(false),
+				ReadOnlyRootFilesystem:   pointer.BoolPtr(true),
+				Capabilities: &corev1.Capabilities{
+					Drop: []corev1.Capability{"ALL"},
+				},
+			}
+			if !hasMountPath(c.VolumeMounts, constants.LocalTmp) {
+				c.VolumeMounts = append(c.VolumeMounts, tmpMount)
+			}
+		}
+	}
+}
+
+func hasMountPath(mounts []corev1.VolumeMount, path string) bool {
+	for _, m := range mounts {
+		if m.MountPath == path {
+			return true
+		}
+	}
+	return false
+}
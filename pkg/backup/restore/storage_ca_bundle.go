@@ -0,0 +1,82 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+const storageCABundleVolName = "storage-ca-bundle"
+
+// storageCABundle returns the env vars, volume and volume mount for the job pod to trust the private CA of the
+// S3 compatible storage endpoint. The CA bundle in the secret is mounted at a stable path, the entrypoint of the
+// backup manager combines it with the system roots, as AWS_CA_BUNDLE and SSL_CERT_FILE replace the system roots.
+func (rm *restoreManager) storageCABundle(restore *v1alpha1.Restore) ([]corev1.EnvVar, corev1.Volume, corev1.VolumeMount, string, error) {
+	ns := restore.GetRestoreJobNamespace()
+	secretName := restore.Spec.CABundleSecretName
+	_, err := rm.deps.SecretLister.Secrets(ns).Get(secretName)
+	if errors.IsNotFound(err) {
+		return nil, corev1.Volume{}, corev1.VolumeMount{}, "CABundleSecretNotFound", fmt.Errorf("CA bundle secret %s/%s is not found", ns, secretName)
+	}
+	if err != nil {
+		return nil, corev1.Volume{}, corev1.VolumeMount{}, "GetCABundleSecretFailed", fmt.Errorf("get CA bundle secret %s/%s failed, err: %v", ns, secretName, err)
+	}
+
+	caFile := path.Join(constants.StorageCABundlePath, constants.StorageCABundleKey)
+	envVars := []corev1.EnvVar{
+		{Name: constants.StorageCABundleEnv, Value: caFile},
+	}
+	volume := corev1.Volume{
+		Name: storageCABundleVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				Items: []corev1.KeyToPath{
+					{Key: constants.StorageCABundleKey, Path: constants.StorageCABundleKey},
+				},
+			},
+		},
+	}
+	volumeMount := corev1.VolumeMount{
+		Name:      storageCABundleVolName,
+		ReadOnly:  true,
+		MountPath: constants.StorageCABundlePath,
+	}
+	return envVars, volume, volumeMount, "", nil
+}
+
+// storageCredential returns the credential for the controller to access the storage of the restore, the CA
+// bundle of the restore is trusted in addition to the system roots.
+func (rm *restoreManager) storageCredential(restore *v1alpha1.Restore, provider v1alpha1.StorageProvider) *backuputil.StorageCredential {
+	cred := backuputil.GetStorageCredential(restore.Namespace, provider, rm.deps.SecretLister)
+	if restore.Spec.CABundleSecretName == "" {
+		return cred
+	}
+	ns := restore.GetRestoreJobNamespace()
+	secret, err := rm.deps.SecretLister.Secrets(ns).Get(restore.Spec.CABundleSecretName)
+	if err != nil {
+		klog.Warningf("restore %s/%s get CA bundle secret %s/%s failed, only the system roots are trusted, err: %v",
+			restore.Namespace, restore.Name, ns, restore.Spec.CABundleSecretName, err)
+		return cred
+	}
+	return cred.WithCABundle(secret.Data[constants.StorageCABundleKey])
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// TiKVConfigStorageEngine is the storage engine of TiKV
+	TiKVConfigStorageEngine = "storage.engine"
+	// TiKVStorageEngineRaftKV is the default storage engine of TiKV which keeps the data in the local volumes
+	TiKVStorageEngineRaftKV = "raft-kv"
+	// TiKVStorageEngineS3 is the storage engine of TiKV which keeps the data in the object storage, the local
+	// volumes only cache the data
+	TiKVStorageEngineS3 = "s3"
+
+	tikvStorageEngineMismatchedReason = "TiKVStorageEngineMismatched"
+)
+
+// tikvStorageEngine returns the storage engine configured for TiKV, it's raft-kv if not configured
+func tikvStorageEngine(tikv *v1alpha1.TiKVSpec) string {
+	if tikv == nil || tikv.Config == nil {
+		return TiKVStorageEngineRaftKV
+	}
+	engine := configString(tikv.Config.GenericConfig, TiKVConfigStorageEngine)
+	if engine == "" {
+		return TiKVStorageEngineRaftKV
+	}
+	return engine
+}
+
+// readTiKVStorageEngineFromBackupMeta returns the storage engine of TiKV recorded in the backup meta
+func (rm *restoreManager) readTiKVStorageEngineFromBackupMeta(r *v1alpha1.Restore) (string, string, error) {
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
+	if err != nil {
+		return "", volSnapBackupMetaFailedReason(err), err
+	}
+	return tikvStorageEngine(metaInfo.KubernetesMeta.TiDBCluster.Spec.TiKV), "", nil
+}
+
+// checkTiKVStorageEngine checks the TiKV of the tidbcluster uses the same storage engine as the backup, the
+// data of the S3 engine can't be served by the local engine and vice versa.
+func (rm *restoreManager) checkTiKVStorageEngine(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	backupEngine, reason, err := rm.readTiKVStorageEngineFromBackupMeta(r)
+	if err != nil {
+		return reason, err
+	}
+	if restoreEngine := tikvStorageEngine(tc.Spec.TiKV); restoreEngine != backupEngine {
+		return tikvStorageEngineMismatchedReason, fmt.Errorf("restore %s/%s: TiKV storage engine mismatched, backup TiKV uses %s, tidbcluster %s/%s uses %s, please set %s of tc.spec.tikv.config to %s",
+			r.Namespace, r.Name, backupEngine, tc.Namespace, tc.Name, restoreEngine, TiKVConfigStorageEngine, backupEngine)
+	}
+	return "", nil
+}
+
+// newRestoreSnapshotter returns the snapshotter of the volume snapshot restore. The TiKV with the S3 engine is
+// restored from the object storage its data is kept in, so its volumes are neither restored from the snapshots
+// nor tagged.
+func (rm *restoreManager) newRestoreSnapshotter(r *v1alpha1.Restore, pvs []*corev1.PersistentVolume) (snapshotter.Snapshotter, string, error) {
+	engine, reason, err := rm.readTiKVStorageEngineFromBackupMeta(r)
+	if err != nil {
+		return nil, reason, err
+	}
+	if engine == TiKVStorageEngineS3 {
+		return &snapshotter.NoneSnapshotter{}, "", nil
+	}
+	return snapshotter.NewSnapshotterForRestore(r, pvs, rm.deps)
+}
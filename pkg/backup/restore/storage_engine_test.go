@@ -0,0 +1,113 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
+	"github.com/pingcap/tidb-operator/pkg/backup/testutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTiKVStorageEngine(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(tikvStorageEngine(nil)).To(Equal(TiKVStorageEngineRaftKV))
+	tikv := &v1alpha1.TiKVSpec{}
+	g.Expect(tikvStorageEngine(tikv)).To(Equal(TiKVStorageEngineRaftKV))
+	tikv.Config = v1alpha1.NewTiKVConfig()
+	g.Expect(tikvStorageEngine(tikv)).To(Equal(TiKVStorageEngineRaftKV))
+	tikv.Config.Set(TiKVConfigStorageEngine, TiKVStorageEngineS3)
+	g.Expect(tikvStorageEngine(tikv)).To(Equal(TiKVStorageEngineS3))
+}
+
+func TestS3EngineBRRestoreByEBS(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1",
+			Namespace: "ns-1",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns-1",
+				Cluster:          "cluster-1",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+		},
+	}
+
+	// the backup TiKV uses the S3 engine
+	meta := strings.Replace(testutils.ConstructRestoreMetaStr(), `"maxFailoverCount": 0,`,
+		`"config": "[storage]\nengine = \"s3\"\n", "maxFailoverCount": 0,`, 1)
+	err := os.WriteFile("/tmp/backupmeta", []byte(meta), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		g.Expect(os.Remove("/tmp/backupmeta")).To(Succeed())
+	}()
+
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, true, true)
+	helper.CreateRestore(restore)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the tidbcluster with the default engine can't serve the data of the S3 engine
+	reason, err := m.validateRestore(restore, tc)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("backup TiKV uses s3, tidbcluster ns-1/cluster-1 uses raft-kv"))
+	g.Expect(reason).To(Equal(tikvStorageEngineMismatchedReason))
+
+	tc.Spec.TiKV.Config = v1alpha1.NewTiKVConfig()
+	tc.Spec.TiKV.Config.Set(TiKVConfigStorageEngine, TiKVStorageEngineS3)
+	reason, err = m.validateRestore(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+
+	// the volumes of the S3 engine are not restored from the snapshots
+	s, reason, err := m.newRestoreSnapshotter(restore, nil)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(s).To(BeAssignableToTypeOf(&snapshotter.NoneSnapshotter{}))
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+// tidbService returns the namespace and the name of the service of the TiDB host, which is the name of the
+// service in the namespace of the restore or the DNS name of the service in the cluster. False is returned
+// if the host is not a service in the cluster, e.g. an IP or an external DNS name.
+func tidbService(ns, host string) (string, string, bool) {
+	if host == "" || net.ParseIP(host) != nil {
+		return "", "", false
+	}
+	labels := strings.Split(host, ".")
+	switch {
+	case len(labels) == 1:
+		return ns, labels[0], true
+	case len(labels) == 2 || labels[2] == "svc":
+		return labels[1], labels[0], true
+	}
+	return "", "", false
+}
+
+// waitTiDBReady requeues the restore until the service of the target TiDB has ready endpoints before the import
+// job is created, so lightning doesn't fail to connect TiDB starting up. The TiDB not in the cluster isn't
+// waited, and the job is created after RestoreTiDBReadyTimeout since the restore is created even if TiDB is not
+// ready, the endpoints may not be observed by the operator, e.g. the service has no selector.
+func (rm *restoreManager) waitTiDBReady(r *v1alpha1.Restore) error {
+	timeout := rm.deps.CLIConfig.RestoreTiDBReadyTimeout
+	if r.Spec.To == nil || timeout <= 0 {
+		return nil
+	}
+	ns, svc, ok := tidbService(r.Namespace, r.Spec.To.Host)
+	if !ok {
+		return nil
+	}
+
+	endpoints, err := rm.deps.EndpointLister.Endpoints(ns).Get(svc)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("restore %s/%s get endpoints %s/%s failed, err: %v", r.Namespace, r.Name, ns, svc, err)
+	}
+	if err == nil && hasReadyAddress(endpoints) {
+		return nil
+	}
+
+	if waited := time.Since(r.CreationTimestamp.Time); waited > timeout {
+		klog.Warningf("restore %s/%s: service %s/%s of TiDB has no ready endpoints after %s, create the import job anyway",
+			r.Namespace, r.Name, ns, svc, waited.Round(time.Second))
+		return nil
+	}
+	return controller.ClusterWaitErrorf("restore %s/%s: waiting for service %s/%s of TiDB to have ready endpoints", r.Namespace, r.Name, ns, svc)
+}
+
+// hasReadyAddress returns true if any address of the endpoints is ready
+func hasReadyAddress(endpoints *corev1.Endpoints) bool {
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTiDBService(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type result struct {
+		ns   string
+		name string
+		ok   bool
+	}
+	for host, expect := range map[string]result{
+		"basic-tidb":                        {ns: "ns-1", name: "basic-tidb", ok: true},
+		"basic-tidb.tidb":                   {ns: "tidb", name: "basic-tidb", ok: true},
+		"basic-tidb.tidb.svc":               {ns: "tidb", name: "basic-tidb", ok: true},
+		"basic-tidb.tidb.svc.cluster.local": {ns: "tidb", name: "basic-tidb", ok: true},
+		"tidb.example.com":                  {},
+		"10.0.0.1":                          {},
+		"":                                  {},
+		"basic-tidb-peer.tidb.svc.cluster.local.": {ns: "tidb", name: "basic-tidb-peer", ok: true},
+	} {
+		ns, name, ok := tidbService("ns-1", host)
+		g.Expect(result{ns: ns, name: name, ok: ok}).To(Equal(expect), host)
+	}
+}
+
+func TestWaitTiDBReady(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-1",
+			Namespace:         "ns-1",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: v1alpha1.RestoreSpec{
+			To: &v1alpha1.TiDBAccessConfig{Host: "basic-tidb.tidb"},
+		},
+	}
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the service has no endpoints yet
+	err := m.waitTiDBReady(restore)
+	g.Expect(controller.IsClusterWaitError(err)).To(BeTrue())
+
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "basic-tidb", Namespace: "tidb"},
+		Subsets: []corev1.EndpointSubset{{
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+		}},
+	}
+	indexer := deps.KubeInformerFactory.Core().V1().Endpoints().Informer().GetIndexer()
+	g.Expect(indexer.Add(endpoints)).To(Succeed())
+	err = m.waitTiDBReady(restore)
+	g.Expect(controller.IsClusterWaitError(err)).To(BeTrue())
+
+	// the job is created anyway after the timeout
+	restore.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	g.Expect(m.waitTiDBReady(restore)).To(Succeed())
+
+	// the wait is disabled
+	restore.CreationTimestamp = metav1.Now()
+	deps.CLIConfig.RestoreTiDBReadyTimeout = 0
+	g.Expect(m.waitTiDBReady(restore)).To(Succeed())
+	deps.CLIConfig.RestoreTiDBReadyTimeout = 10 * time.Minute
+
+	restore.CreationTimestamp = metav1.Now()
+	endpoints.Subsets[0].Addresses = []corev1.EndpointAddress{{IP: "10.0.0.2"}}
+	g.Expect(indexer.Update(endpoints)).To(Succeed())
+	g.Expect(m.waitTiDBReady(restore)).To(Succeed())
+
+	// the TiDB not in the cluster is not waited
+	restore.Spec.To.Host = "tidb.example.com"
+	g.Expect(m.waitTiDBReady(restore)).To(Succeed())
+}
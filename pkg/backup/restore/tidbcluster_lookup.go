@@ -0,0 +1,41 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// isTCNotFoundTransient returns true if the tidbcluster of the restore not found in the cache may be a lag of
+// the informer, which is the case within the grace period after the restore is created, since the tidbcluster
+// and the restore are often created together.
+func isTCNotFoundTransient(r *v1alpha1.Restore, gracePeriod time.Duration) bool {
+	return gracePeriod > 0 && time.Since(r.CreationTimestamp.Time) < gracePeriod
+}
+
+// getRestoreTC gets the tidbcluster of the BR restore from the cache. The tidbcluster not found within the
+// grace period is not reported as a failure, a requeue error is returned to retry later. After the grace period
+// the tidbcluster is taken as absent and the not found error is returned.
+func (rm *restoreManager) getRestoreTC(r *v1alpha1.Restore, tcNamespace string) (*v1alpha1.TidbCluster, error) {
+	tc, err := rm.deps.TiDBClusterLister.TidbClusters(tcNamespace).Get(r.Spec.BR.Cluster)
+	if err != nil && errors.IsNotFound(err) && isTCNotFoundTransient(r, rm.deps.CLIConfig.RestoreTCGracePeriod) {
+		return nil, controller.RequeueErrorf("restore %s/%s: tidbcluster %s/%s is not found in the cache yet, wait for it",
+			r.Namespace, r.Name, tcNamespace, r.Spec.BR.Cluster)
+	}
+	return tc, err
+}
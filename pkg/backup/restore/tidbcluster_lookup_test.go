@@ -0,0 +1,59 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetRestoreTCNotFound(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := genValidBRRestores()[0]
+	restore.CreationTimestamp = metav1.Now()
+	helper.createRestore(restore)
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	// the tidbcluster not found right after the restore is created may be a lag of the cache
+	_, err := m.getRestoreTC(restore, restore.Spec.BR.ClusterNamespace)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	err = m.Sync(restore)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	get, err := deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	_, condition := v1alpha1.GetRestoreCondition(&get.Status, v1alpha1.RestoreRetryFailed)
+	g.Expect(condition).To(BeNil())
+
+	// the tidbcluster still not found after the grace period is absent
+	restore.CreationTimestamp = metav1.NewTime(time.Now().Add(-deps.CLIConfig.RestoreTCGracePeriod))
+	_, err = m.getRestoreTC(restore, restore.Spec.BR.ClusterNamespace)
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+	// the retry is disabled by the zero grace period
+	restore.CreationTimestamp = metav1.Now()
+	deps.CLIConfig.RestoreTCGracePeriod = 0
+	_, err = m.getRestoreTC(restore, restore.Spec.BR.ClusterNamespace)
+	g.Expect(errors.IsNotFound(err)).To(BeTrue())
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+)
+
+// backupHasTiFlashSnapshots returns true if the backup meta records the volume snapshots of TiFlash, then
+// the TiFlash volumes are restored from the snapshots together with the TiKV volumes
+func (rm *restoreManager) backupHasTiFlashSnapshots(r *v1alpha1.Restore) (bool, string, error) {
+	metaInfo, err := backuputil.GetVolSnapBackupMetaData(r, rm.storageCredential(r, r.Spec.StorageProvider), rm.metaCache.MetaCache)
+	if err != nil {
+		return false, volSnapBackupMetaFailedReason(err), err
+	}
+	return metaInfo.TiFlashComponent != nil && len(metaInfo.TiFlashComponent.Stores) > 0, "", nil
+}
+
+// syncTiFlashVolumes tags the TiFlash volumes restored from the snapshots after all the TiFlash pods are started,
+// then marks the restore with condition TiFlashComplete. It's a no-op if the backup doesn't include TiFlash.
+func (rm *restoreManager) syncTiFlashVolumes(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	if v1alpha1.IsRestoreTiFlashComplete(r) {
+		return "", nil
+	}
+	hasTiFlash, reason, err := rm.backupHasTiFlashSnapshots(r)
+	if err != nil || !hasTiFlash {
+		return reason, err
+	}
+	if !tc.TiFlashAllPodsStarted() {
+		return "", controller.ClusterWaitErrorf("restore %s/%s: waiting for all TiFlash pods are started in tidbcluster %s/%s", r.Namespace, r.Name, tc.Namespace, tc.Name)
+	}
+
+	sel, err := label.New().Instance(tc.Name).TiFlash().Selector()
+	if err != nil {
+		return "BuildTiFlashSelectorFailed", err
+	}
+	pvs, err := rm.deps.PVLister.List(sel)
+	if err != nil {
+		return "ListPVsFailed", err
+	}
+	// the TiFlash volumes are always restored from the snapshots whatever the storage engine of TiKV is
+	s, reason, err := snapshotter.NewSnapshotterForRestore(r, pvs, rm.deps)
+	if err != nil {
+		return reason, err
+	}
+	if err := rm.addVolumeTags(r, s, pvs); err != nil {
+		return "AddVolumeTagFailed", err
+	}
+
+	klog.Infof("restore %s/%s: %d TiFlash volumes are restored from the snapshots", r.Namespace, r.Name, len(pvs))
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:   v1alpha1.RestoreTiFlashComplete,
+		Status: corev1.ConditionTrue,
+	}, nil); err != nil {
+		return "UpdateTiFlashCompleteFailed", err
+	}
+	return "", nil
+}
+
+// listRestoredTiFlashPods returns the TiFlash pods which are restarted in the restore-finish phase together with
+// the TiKV pods, they are the pods of the TiFlash restored from the snapshots
+func (rm *restoreManager) listRestoredTiFlashPods(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) ([]*corev1.Pod, string, error) {
+	if !v1alpha1.IsRestoreTiFlashComplete(r) {
+		return nil, "", nil
+	}
+	sel, err := label.New().Instance(tc.Name).TiFlash().Selector()
+	if err != nil {
+		return nil, "BuildTiFlashSelectorFailed", err
+	}
+	pods, err := rm.deps.PodLister.Pods(tc.Namespace).List(sel)
+	if err != nil {
+		return nil, "ListTiFlashPodsFailed", err
+	}
+	return pods, "", nil
+}
+
+// restartTiFlash restarts the restored TiFlash pods after the TiKV pods are restarted
+func (rm *restoreManager) restartTiFlash(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster, pods []*corev1.Pod) (string, error) {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			klog.Infof("%s/%s restore-manager restarts pod %s/%s", r.Namespace, r.Name, pod.Namespace, pod.Name)
+			if err := rm.deps.PodControl.DeletePod(tc, pod); err != nil {
+				return "DeleteTiFlashPodFailed", err
+			}
+		}
+	}
+	return "", nil
+}
+
+// waitTiFlashReady waits for the restored TiFlash pods ready after they are restarted
+func waitTiFlashReady(r *v1alpha1.Restore, pods []*corev1.Pod) error {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !podutil.IsPodReady(pod) {
+			return controller.ClusterWaitErrorf("restore %s/%s: waiting for TiFlash pod %s/%s ready after restart", r.Namespace, r.Name, pod.Namespace, pod.Name)
+		}
+	}
+	return nil
+}
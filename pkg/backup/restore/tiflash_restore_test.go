@@ -0,0 +1,64 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWaitTiFlashReady(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	restore := genValidBRRestores()[0]
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-1-tiflash-0", Namespace: "ns-1"},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}},
+		},
+	}
+	g.Expect(waitTiFlashReady(restore, nil)).To(Succeed())
+	g.Expect(controller.IsClusterWaitError(waitTiFlashReady(restore, []*corev1.Pod{pod}))).To(BeTrue())
+
+	pod.Status.Conditions[0].Status = corev1.ConditionTrue
+	g.Expect(waitTiFlashReady(restore, []*corev1.Pod{pod})).To(Succeed())
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+	g.Expect(controller.IsClusterWaitError(waitTiFlashReady(restore, []*corev1.Pod{pod}))).To(BeTrue())
+}
+
+func TestListRestoredTiFlashPods(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	m := NewRestoreManager(helper.Deps).(*restoreManager)
+
+	restore := genValidBRRestores()[0]
+	tc := &v1alpha1.TidbCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster-1", Namespace: "ns-1"}}
+
+	// the TiFlash isn't restored from the snapshots, its pods are not restarted
+	pods, _, err := m.listRestoredTiFlashPods(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(pods).To(BeEmpty())
+
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{{Type: v1alpha1.RestoreTiFlashComplete, Status: corev1.ConditionTrue}}
+	g.Expect(v1alpha1.IsRestoreTiFlashComplete(restore)).To(BeTrue())
+	_, _, err = m.listRestoredTiFlashPods(restore, tc)
+	g.Expect(err).To(Succeed())
+}
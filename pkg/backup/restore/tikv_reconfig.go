@@ -0,0 +1,95 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// tikvReconfigKeys are the TiKV config the restored data depends on, e.g. the store labels matched by the
+// placement rules of the restored tables and the API version of the restored keys.
+var tikvReconfigKeys = []string{
+	"server.labels",
+	"storage.api-version",
+	"storage.enable-ttl",
+	"security.encryption",
+}
+
+// reconfigTiKV copies the TiKV config in tikvReconfigKeys from the tidbcluster in the backup meta to tc before
+// TiKV is restarted in the restore-finish phase. Only the config not set in tc is copied, the config set in tc
+// takes precedence, e.g. the rotated master key. The result is reported by condition TiKVReconfigured, and the
+// updated tc is returned.
+func (rm *restoreManager) reconfigTiKV(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (*v1alpha1.TidbCluster, string, error) {
+	if v1alpha1.IsRestoreTiKVReconfigured(r) || tc.Spec.TiKV == nil {
+		return tc, "", nil
+	}
+
+	backupConfig, reason, err := rm.readTiKVConfigFromBackupMeta(r)
+	if err != nil {
+		return tc, reason, err
+	}
+
+	reason = "TiKVConfigMatched"
+	msg := fmt.Sprintf("TiKV config of tc %s/%s matches the backup", tc.Namespace, tc.Name)
+	updated := tc.DeepCopy()
+	if keys := reconcileTiKVConfig(backupConfig, updated.Spec.TiKV); len(keys) > 0 {
+		klog.Infof("%s/%s copy TiKV config %v of the backup to tc %s/%s", r.Namespace, r.Name, keys, tc.Namespace, tc.Name)
+		if tc, err = rm.deps.TiDBClusterControl.Update(updated); err != nil {
+			return tc, "ReconfigTiKVFailed", err
+		}
+		reason = "TiKVConfigCopied"
+		msg = fmt.Sprintf("TiKV config %s of the backup is copied to tc %s/%s", strings.Join(keys, ", "), tc.Namespace, tc.Name)
+	}
+
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreTiKVReconfigured,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	}, nil); err != nil {
+		return tc, "UpdateRestoreTiKVReconfiguredFailed", err
+	}
+	return tc, "", nil
+}
+
+// reconcileTiKVConfig sets the TiKV config in tikvReconfigKeys of the backup to the TiKV spec if the spec
+// doesn't set it, and returns the keys set.
+func reconcileTiKVConfig(backupConfig *v1alpha1.TiKVConfigWraper, spec *v1alpha1.TiKVSpec) []string {
+	if backupConfig == nil {
+		return nil
+	}
+	// the backup meta is cached, the config set to the spec must not share the maps with it
+	backup := backupConfig.GenericConfig.DeepCopy()
+	var keys []string
+	for _, key := range tikvReconfigKeys {
+		value := backup.Get(key)
+		if value == nil {
+			continue
+		}
+		if spec.Config == nil || spec.Config.GenericConfig == nil {
+			spec.Config = v1alpha1.NewTiKVConfig()
+		}
+		if spec.Config.Get(key) != nil {
+			continue
+		}
+		spec.Config.Set(key, value.Interface())
+		keys = append(keys, key)
+	}
+	return keys
+}
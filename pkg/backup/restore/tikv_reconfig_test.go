@@ -0,0 +1,128 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/testutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileTiKVConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	backupConfig := v1alpha1.NewTiKVConfig()
+	backupConfig.Set("server.labels", map[string]interface{}{"zone": "us-west-2a"})
+	backupConfig.Set("storage.api-version", int64(2))
+	backupConfig.Set("raftstore.capacity", "100GiB")
+
+	// nothing is set if the backup meta has no TiKV config
+	spec := &v1alpha1.TiKVSpec{}
+	g.Expect(reconcileTiKVConfig(nil, spec)).To(BeEmpty())
+	g.Expect(spec.Config).To(BeNil())
+
+	// the config set in the spec takes precedence, the config not depended on by the data is not copied
+	spec.Config = v1alpha1.NewTiKVConfig()
+	spec.Config.Set("storage.api-version", int64(1))
+	g.Expect(reconcileTiKVConfig(backupConfig, spec)).To(Equal([]string{"server.labels"}))
+	g.Expect(spec.Config.Get("server.labels.zone").Interface()).To(Equal("us-west-2a"))
+	g.Expect(spec.Config.Get("storage.api-version").Interface()).To(Equal(int64(1)))
+	g.Expect(spec.Config.Get("raftstore.capacity")).To(BeNil())
+
+	// the copied config doesn't share the maps with the backup meta
+	spec.Config.Set("server.labels.zone", "us-west-2b")
+	g.Expect(backupConfig.Get("server.labels.zone").Interface()).To(Equal("us-west-2a"))
+	g.Expect(reconcileTiKVConfig(backupConfig, spec)).To(BeEmpty())
+}
+
+func TestReconfigTiKV(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1",
+			Namespace: "ns-1",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Type: v1alpha1.BackupTypeFull,
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns-1",
+				Cluster:          "cluster-1",
+			},
+			StorageProvider: v1alpha1.StorageProvider{
+				Local: &v1alpha1.LocalStorageProvider{
+					Volume: corev1.Volume{
+						Name: "nfs",
+						VolumeSource: corev1.VolumeSource{
+							NFS: &corev1.NFSVolumeSource{
+								Server:   "fake-server",
+								Path:     "/tmp",
+								ReadOnly: true,
+							},
+						},
+					},
+					VolumeMount: corev1.VolumeMount{
+						Name:      "nfs",
+						MountPath: "/tmp",
+					},
+				},
+			},
+		},
+	}
+
+	// the TiKV of the backup cluster sets the store labels
+	backupConfig := `[server.labels]
+zone = "us-west-2a"
+`
+	meta := strings.Replace(testutils.ConstructRestoreMetaStr(), `"maxFailoverCount": 0,`,
+		fmt.Sprintf(`"config": %q, "maxFailoverCount": 0,`, backupConfig), 1)
+	err := os.WriteFile("/tmp/backupmeta", []byte(meta), 0644) //nolint:gosec
+	g.Expect(err).To(Succeed())
+	defer func() {
+		g.Expect(os.Remove("/tmp/backupmeta")).To(Succeed())
+	}()
+
+	helper.CreateTC(restore.Spec.BR.ClusterNamespace, restore.Spec.BR.Cluster, true, true)
+	helper.CreateRestore(restore)
+	tc, err := deps.Clientset.PingcapV1alpha1().TidbClusters(restore.Spec.BR.ClusterNamespace).Get(context.TODO(), restore.Spec.BR.Cluster, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	m := NewRestoreManager(deps).(*restoreManager)
+
+	reconfigured, reason, err := m.reconfigTiKV(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(reconfigured.Spec.TiKV.Config.Get("server.labels.zone").Interface()).To(Equal("us-west-2a"))
+	g.Expect(tc.Spec.TiKV.Config).To(BeNil())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreTiKVReconfigured, "TiKVConfigCopied")
+
+	// the TiKV config is reconfigured once
+	restore, err = deps.Clientset.PingcapV1alpha1().Restores(restore.Namespace).Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	again, reason, err := m.reconfigTiKV(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	g.Expect(again).To(Equal(tc))
+}
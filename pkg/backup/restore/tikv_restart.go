@@ -0,0 +1,103 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+)
+
+// restartTiKVInBatches restarts the TiKV pods in waves of TiKVRestartBatchSize pods in the restore-finish phase.
+// A wave is started after the pods of the former waves are ready, all the TiKV stores are available and
+// TiKVRestartBatchInterval has passed. The pods created after TiKVRestartStartTime have been restarted, so
+// the waves are resumed correctly across reconciles. It returns nil once all the pods are restarted.
+func (rm *restoreManager) restartTiKVInBatches(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster, pods []*corev1.Pod) (string, error) {
+	ns := r.Namespace
+	name := r.Name
+
+	startTime := r.Status.TiKVRestartStartTime
+	if startTime == nil {
+		now := metav1.Now().Rfc3339Copy()
+		startTime = &now
+		if err := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+			TiKVRestartStartTime: startTime,
+		}); err != nil {
+			return "UpdateTiKVRestartStartTimeFailed", err
+		}
+	}
+
+	var (
+		pending    []*corev1.Pod
+		restarting int
+		restarted  int
+		lastReady  time.Time
+	)
+	for _, pod := range pods {
+		switch {
+		case !pod.CreationTimestamp.Before(startTime):
+			if pod.DeletionTimestamp != nil || !podutil.IsPodReady(pod) {
+				restarting++
+				continue
+			}
+			restarted++
+			if c := podutil.GetPodReadyCondition(pod.Status); c != nil && c.LastTransitionTime.After(lastReady) {
+				lastReady = c.LastTransitionTime.Time
+			}
+		case pod.DeletionTimestamp != nil:
+			restarting++
+		default:
+			pending = append(pending, pod)
+		}
+	}
+
+	if restarting > 0 {
+		return "", controller.ClusterWaitErrorf("restore %s/%s: waiting for %d TiKV pods of the last wave ready after restart", ns, name, restarting)
+	}
+	if len(pending) == 0 {
+		klog.Infof("%s/%s restore-manager restarted all the %d TiKV pods in waves", ns, name, restarted)
+		return "", nil
+	}
+	if restarted > 0 {
+		if !tc.AllTiKVsAreAvailable() {
+			return "", controller.ClusterWaitErrorf("restore %s/%s: waiting for all TiKVs are available before restarting the next wave in tidbcluster %s/%s", ns, name, tc.Namespace, tc.Name)
+		}
+		if interval := r.Spec.TiKVRestartBatchInterval; interval != nil {
+			if wait := interval.Duration - time.Since(lastReady); wait > 0 {
+				return "", controller.RequeueErrorf("restore %s/%s: waiting %s before restarting the next wave of TiKV pods", ns, name, wait.Round(time.Second))
+			}
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Name < pending[j].Name
+	})
+	batchSize := int(*r.Spec.TiKVRestartBatchSize)
+	if batchSize > len(pending) {
+		batchSize = len(pending)
+	}
+	for _, pod := range pending[:batchSize] {
+		klog.Infof("%s/%s restore-manager restarts pod %s/%s", ns, name, pod.Namespace, pod.Name)
+		if err := rm.deps.PodControl.DeletePod(tc, pod); err != nil {
+			return "DeleteTiKVPodFailed", err
+		}
+	}
+	return "", controller.RequeueErrorf("restore %s/%s: restarted a wave of %d TiKV pods, %d pods left", ns, name, batchSize, len(pending)-batchSize)
+}
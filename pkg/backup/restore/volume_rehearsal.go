@@ -0,0 +1,200 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// volumeRehearsalLabelVal is the component label value of the volume rehearsal jobs
+	volumeRehearsalLabelVal = "volume-rehearsal"
+	// volumeRehearsalMountPath is the path the restored volume is mounted to in the volume rehearsal job
+	volumeRehearsalMountPath = "/var/lib/volume-rehearsal"
+)
+
+// volumeRehearsal verifies the TiKV volumes restored from the snapshots can be attached by running
+// a job for each volume, then tears the volumes down and completes the restore without starting TiKV.
+func (rm *restoreManager) volumeRehearsal(r *v1alpha1.Restore, tc *v1alpha1.TidbCluster) (string, error) {
+	ns := r.Namespace
+	name := r.Name
+
+	sel, err := label.New().Instance(tc.Name).TiKV().Selector()
+	if err != nil {
+		return "BuildTiKVSelectorFailed", err
+	}
+	pvcs, err := rm.deps.PVCLister.PersistentVolumeClaims(tc.Namespace).List(sel)
+	if err != nil {
+		return "ListPVCsFailed", err
+	}
+	if len(pvcs) == 0 {
+		return "RestoredVolumesNotFound", fmt.Errorf("no TiKV pvc found in tidbcluster %s/%s", tc.Namespace, tc.Name)
+	}
+	sort.Slice(pvcs, func(i, j int) bool {
+		return pvcs[i].Name < pvcs[j].Name
+	})
+
+	// the rehearsal jobs may be in another namespace than the restore, they are deleted by the finalizer
+	// instead of the owner reference if the restore is deleted before the volumes are torn down
+	if err := rm.addJobCleanupFinalizer(r); err != nil {
+		return "AddJobCleanupFinalizerFailed", err
+	}
+
+	jobs := make([]*batchv1.Job, 0, len(pvcs))
+	pending := 0
+	for i, pvc := range pvcs {
+		jobName := fmt.Sprintf("%s-rehearsal-%d", r.GetRestoreJobName(), i)
+		job, err := rm.deps.JobLister.Jobs(tc.Namespace).Get(jobName)
+		if errors.IsNotFound(err) {
+			job = rm.makeVolumeRehearsalJob(r, jobName, pvc)
+			if err := rm.deps.JobControl.CreateJob(r, job); err != nil {
+				return "CreateVolumeRehearsalJobFailed", err
+			}
+			pending++
+			continue
+		}
+		if err != nil {
+			return "GetVolumeRehearsalJobFailed", err
+		}
+		if job.Status.Failed > 0 {
+			return "VolumeAttachFailed", fmt.Errorf("volume rehearsal job %s/%s for pvc %s failed", job.Namespace, job.Name, pvc.Name)
+		}
+		if job.Status.Succeeded == 0 {
+			pending++
+		}
+		jobs = append(jobs, job)
+	}
+	if pending > 0 {
+		return "", controller.RequeueErrorf("restore %s/%s: waiting for %d volumes attached in volume rehearsal", ns, name, pending)
+	}
+
+	now := time.Now()
+	rehearsalStatus := &v1alpha1.VolumeRehearsalStatus{
+		Volumes: int32(len(pvcs)),
+	}
+	if _, cond := v1alpha1.GetRestoreCondition(&r.Status, v1alpha1.RestoreVolumeComplete); cond != nil {
+		volumeCompleted := cond.LastTransitionTime.Time
+		if !r.Status.TimeStarted.IsZero() {
+			rehearsalStatus.ProvisionDuration = volumeCompleted.Sub(r.Status.TimeStarted.Time).Round(time.Second).String()
+		}
+		rehearsalStatus.AttachDuration = now.Sub(volumeCompleted).Round(time.Second).String()
+	}
+	klog.Infof("%s/%s volume rehearsal attached %d volumes, tear them down", ns, name, len(pvcs))
+
+	if reason, err := rm.tearDownRehearsalVolumes(r, jobs, pvcs); err != nil {
+		return reason, err
+	}
+
+	if err := rm.statusUpdater.Update(r, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreComplete,
+		Status:  corev1.ConditionTrue,
+		Reason:  "VolumeRehearsalComplete",
+		Message: fmt.Sprintf("%d volumes restored from snapshots are attached and torn down", len(pvcs)),
+	}, &controller.RestoreUpdateStatus{
+		TimeCompleted:   &metav1.Time{Time: now},
+		VolumeRehearsal: rehearsalStatus,
+	}); err != nil {
+		return "UpdateRestoreCompleteFailed", err
+	}
+	return "", nil
+}
+
+// tearDownRehearsalVolumes deletes the rehearsal jobs and the restored PVCs, the reclaim policy of
+// the PVs is changed to Delete so that the cloud volumes are deleted together with the PVCs.
+func (rm *restoreManager) tearDownRehearsalVolumes(r *v1alpha1.Restore, jobs []*batchv1.Job, pvcs []*corev1.PersistentVolumeClaim) (string, error) {
+	for _, job := range jobs {
+		if err := rm.deps.JobControl.DeleteJob(r, job); err != nil && !errors.IsNotFound(err) {
+			return "DeleteVolumeRehearsalJobFailed", err
+		}
+	}
+	for _, pvc := range pvcs {
+		if pvc.Spec.VolumeName != "" {
+			pv, err := rm.deps.PVLister.Get(pvc.Spec.VolumeName)
+			if err != nil && !errors.IsNotFound(err) {
+				return "GetPVFailed", err
+			}
+			if err == nil && pv.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimDelete {
+				if err := rm.deps.PVControl.PatchPVReclaimPolicy(r, pv, corev1.PersistentVolumeReclaimDelete); err != nil {
+					return "PatchPVReclaimPolicyFailed", err
+				}
+			}
+		}
+		if err := rm.deps.PVCControl.DeletePVC(r, pvc); err != nil && !errors.IsNotFound(err) {
+			return "DeletePVCFailed", err
+		}
+	}
+	return "", nil
+}
+
+func (rm *restoreManager) makeVolumeRehearsalJob(r *v1alpha1.Restore, jobName string, pvc *corev1.PersistentVolumeClaim) *batchv1.Job {
+	labels := label.NewRestore().Instance(r.GetInstanceName()).Component(volumeRehearsalLabelVal).Restore(r.Name)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: pvc.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: pointer.Int32Ptr(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: r.Spec.PodSecurityContext,
+					Containers: []corev1.Container{
+						{
+							Name:            volumeRehearsalLabelVal,
+							Image:           rm.backupManagerImage(r),
+							Command:         []string{"/bin/sh", "-c"},
+							Args:            []string{fmt.Sprintf("ls %s > /dev/null && echo 'volume %s attached'", volumeRehearsalMountPath, pvc.Name)},
+							ImagePullPolicy: r.GetImagePullPolicy(),
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "restored-volume", MountPath: volumeRehearsalMountPath, ReadOnly: true},
+							},
+						},
+					},
+					RestartPolicy:     corev1.RestartPolicyNever,
+					Tolerations:       r.Spec.Tolerations,
+					ImagePullSecrets:  r.Spec.ImagePullSecrets,
+					PriorityClassName: r.Spec.PriorityClassName,
+					Volumes: []corev1.Volume{
+						{
+							Name: "restored-volume",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvc.Name,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVolumeRehearsal(t *testing.T) {
+	g := NewGomegaWithT(t)
+	helper := newHelper(t)
+	defer helper.Close()
+	deps := helper.Deps
+
+	restore := &v1alpha1.Restore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-rehearsal",
+			Namespace: "ns",
+		},
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			BR: &v1alpha1.BRConfig{
+				ClusterNamespace: "ns",
+				Cluster:          "cluster",
+			},
+			FederalVolumeRestorePhase: v1alpha1.FederalVolumeRestoreVolume,
+			VolumeRehearsal:           true,
+		},
+		Status: v1alpha1.RestoreStatus{
+			TimeStarted: metav1.Time{Time: time.Now().Add(-10 * time.Minute)},
+			Conditions: []v1alpha1.RestoreCondition{
+				{
+					Type:               v1alpha1.RestoreVolumeComplete,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.Time{Time: time.Now().Add(-time.Minute)},
+				},
+			},
+		},
+	}
+	helper.createRestore(restore)
+	tc := &v1alpha1.TidbCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster",
+			Namespace: "ns",
+		},
+	}
+
+	pvcIndexer := deps.KubeInformerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer()
+	pvIndexer := deps.KubeInformerFactory.Core().V1().PersistentVolumes().Informer().GetIndexer()
+	for i := 0; i < 2; i++ {
+		pvName := fmt.Sprintf("pv-%d", i)
+		g.Expect(pvIndexer.Add(&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: pvName},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			},
+		})).To(Succeed())
+		g.Expect(pvcIndexer.Add(&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("tikv-cluster-tikv-%d", i),
+				Namespace: "ns",
+				Labels:    label.New().Instance("cluster").TiKV(),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				VolumeName: pvName,
+			},
+		})).To(Succeed())
+	}
+
+	m := NewRestoreManager(deps).(*restoreManager)
+	// the first round creates the rehearsal jobs
+	reason, err := m.volumeRehearsal(restore, tc)
+	g.Expect(controller.IsRequeueError(err)).To(BeTrue())
+	g.Expect(reason).To(BeEmpty())
+	for i := 0; i < 2; i++ {
+		jobName := fmt.Sprintf("%s-rehearsal-%d", restore.GetRestoreJobName(), i)
+		job, err := deps.KubeClientset.BatchV1().Jobs("ns").Get(context.TODO(), jobName, metav1.GetOptions{})
+		g.Expect(err).To(Succeed())
+		g.Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(fmt.Sprintf("tikv-cluster-tikv-%d", i)))
+		// the job is cleaned up by the finalizer of the restore rather than the owner reference
+		g.Expect(job.OwnerReferences).To(BeEmpty())
+
+		job.Status.Succeeded = 1
+		_, err = deps.KubeClientset.BatchV1().Jobs("ns").UpdateStatus(context.TODO(), job, metav1.UpdateOptions{})
+		g.Expect(err).To(Succeed())
+		g.Eventually(func() int32 {
+			job, err := deps.JobLister.Jobs("ns").Get(jobName)
+			if err != nil {
+				return 0
+			}
+			return job.Status.Succeeded
+		}, time.Second*10).Should(Equal(int32(1)))
+	}
+
+	updated, err := deps.Clientset.PingcapV1alpha1().Restores("ns").Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(updated.Finalizers).To(ContainElement(label.RestoreJobCleanupFinalizer))
+
+	// all volumes are attached, tear them down and complete the restore
+	reason, err = m.volumeRehearsal(restore, tc)
+	g.Expect(err).To(Succeed())
+	g.Expect(reason).To(BeEmpty())
+	helper.hasCondition(restore.Namespace, restore.Name, v1alpha1.RestoreComplete, "VolumeRehearsalComplete")
+
+	sel, err := label.New().Instance("cluster").TiKV().Selector()
+	g.Expect(err).To(Succeed())
+	pvcs, err := deps.PVCLister.PersistentVolumeClaims("ns").List(sel)
+	g.Expect(err).To(Succeed())
+	g.Expect(pvcs).To(BeEmpty())
+	pv, err := deps.PVLister.Get("pv-0")
+	g.Expect(err).To(Succeed())
+	g.Expect(pv.Spec.PersistentVolumeReclaimPolicy).To(Equal(corev1.PersistentVolumeReclaimDelete))
+
+	updated, err = deps.Clientset.PingcapV1alpha1().Restores("ns").Get(context.TODO(), restore.Name, metav1.GetOptions{})
+	g.Expect(err).To(Succeed())
+	g.Expect(updated.Status.VolumeRehearsal).NotTo(BeNil())
+	g.Expect(updated.Status.VolumeRehearsal.Volumes).To(Equal(int32(2)))
+	g.Expect(updated.Status.VolumeRehearsal.ProvisionDuration).To(Equal("9m0s"))
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/backup/snapshotter"
+	backuputil "github.com/pingcap/tidb-operator/pkg/backup/util"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// addVolumeTags tags the volumes of the PVs which are not recorded as tagged in the status of the restore,
+// then records the volumes tagged successfully. So the volumes are not tagged again when the reconcile is
+// retried after a partial failure or after failing to update the restore condition.
+func (rm *restoreManager) addVolumeTags(r *v1alpha1.Restore, s snapshotter.Snapshotter, pvs []*corev1.PersistentVolume) error {
+	tagged := sets.NewString(r.Status.TaggedVolumes...)
+	var untagged []*corev1.PersistentVolume
+	for _, pv := range pvs {
+		if pv.Spec.CSI != nil && tagged.Has(pv.Spec.CSI.VolumeHandle) {
+			continue
+		}
+		untagged = append(untagged, pv)
+	}
+	if len(untagged) == 0 {
+		klog.Infof("restore %s/%s: all the %d volumes are already tagged", r.Namespace, r.Name, len(pvs))
+		return nil
+	}
+	klog.Infof("restore %s/%s: tag %d volumes, %d volumes are already tagged", r.Namespace, r.Name, len(untagged), len(pvs)-len(untagged))
+
+	err := s.AddVolumeTags(untagged)
+	failed := map[string]struct{}{}
+	if err != nil {
+		var ok bool
+		if failed, ok = backuputil.FailedTagResources(err); !ok {
+			return err
+		}
+	}
+	for _, pv := range untagged {
+		if pv.Spec.CSI == nil {
+			continue
+		}
+		if _, ok := failed[pv.Spec.CSI.VolumeHandle]; !ok {
+			tagged.Insert(pv.Spec.CSI.VolumeHandle)
+		}
+	}
+	if tagged.Len() > len(r.Status.TaggedVolumes) {
+		if uerr := rm.statusUpdater.Update(r, nil, &controller.RestoreUpdateStatus{
+			TaggedVolumes: tagged.List(),
+		}); uerr != nil {
+			klog.Warningf("restore %s/%s: record the tagged volumes failed, %v", r.Namespace, r.Name, uerr)
+		}
+	}
+	return err
+}
@@ -59,6 +59,45 @@ type Snapshotter interface {
 
 	// AddVolumeTags add operator related tags to volumes
 	AddVolumeTags(pvs []*corev1.PersistentVolume) error
+
+	// DeleteVolumes deletes the volumes restored from the snapshots
+	DeleteVolumes(volumeIDs []string) error
+}
+
+const (
+	// VolumeTypeAWSEBS is the type of the volume snapshot restore passed to BR for AWS EBS volumes
+	VolumeTypeAWSEBS = "aws-ebs"
+	// VolumeTypeGCPPD is the type of the volume snapshot restore passed to BR for GCP persistent disks
+	VolumeTypeGCPPD = "gcp-pd"
+
+	// the in-tree provisioner of GCP persistent disks
+	gcePDProvisioner = "kubernetes.io/gce-pd"
+)
+
+// VolumeTypeOfProvisioner returns the volume type of the volumes provisioned by the CSI driver or the in-tree
+// provisioner, the volumes are AWS EBS volumes unless they are provisioned on GCP.
+func VolumeTypeOfProvisioner(provisioner string) string {
+	switch provisioner {
+	case constants.PdCSIDriver, gcePDProvisioner:
+		return VolumeTypeGCPPD
+	default:
+		return VolumeTypeAWSEBS
+	}
+}
+
+// VolumeTypeOfPVs returns the volume type of the PVs from their CSI driver or in-tree volume source
+func VolumeTypeOfPVs(pvs []*corev1.PersistentVolume) string {
+	for _, pv := range pvs {
+		switch {
+		case pv.Spec.CSI != nil:
+			return VolumeTypeOfProvisioner(pv.Spec.CSI.Driver)
+		case pv.Spec.GCEPersistentDisk != nil:
+			return VolumeTypeGCPPD
+		case pv.Spec.AWSElasticBlockStore != nil:
+			return VolumeTypeAWSEBS
+		}
+	}
+	return VolumeTypeAWSEBS
 }
 
 type BaseSnapshotter struct {
@@ -92,13 +131,18 @@ func NewSnapshotterForBackup(m v1alpha1.BackupMode, d *controller.Dependencies)
 	return s, "", nil
 }
 
-func NewSnapshotterForRestore(m v1alpha1.RestoreMode, d *controller.Dependencies) (Snapshotter, string, error) {
+// NewSnapshotterForRestore returns the snapshotter of the restore, the cloud provider of the volume snapshot
+// restore is inferred from the CSI driver or the in-tree volume source of the PVs, which are the PVs recorded
+// in the backup before the volumes are restored and the restored PVs after.
+func NewSnapshotterForRestore(r *v1alpha1.Restore, pvs []*corev1.PersistentVolume, d *controller.Dependencies) (Snapshotter, string, error) {
 	var s Snapshotter
-	switch m {
+	switch r.Spec.Mode {
 	case v1alpha1.RestoreModeVolumeSnapshot:
-		// Currently, we only support aws volume snapshot. If gcp volume snapshot is supported
-		// in the future, we can infer the provider from the storage class.
-		s = &AWSSnapshotter{}
+		if VolumeTypeOfPVs(pvs) == VolumeTypeGCPPD {
+			s = &GCPSnapshotter{}
+		} else {
+			s = &AWSSnapshotter{}
+		}
 	default:
 		s = &NoneSnapshotter{}
 	}
@@ -215,6 +259,15 @@ func commitPVsAndPVCsToK8S(
 	if err != nil {
 		return "ListPVsFailed", err
 	}
+	tiflashSel, err := label.New().Instance(r.Spec.BR.Cluster).TiFlash().Namespace(r.Namespace).Selector()
+	if err != nil {
+		return "BuildTiFlashSelectorFailed", err
+	}
+	existingTiFlashPVs, err := deps.PVLister.List(tiflashSel)
+	if err != nil {
+		return "ListPVsFailed", err
+	}
+	existingPVs = append(existingPVs, existingTiFlashPVs...)
 	refPVCMap := make(map[string]struct{})
 	for _, pv := range existingPVs {
 		if pv.Spec.ClaimRef != nil {
@@ -249,6 +302,7 @@ func commitPVsAndPVCsToK8S(
 
 type CloudSnapBackup struct {
 	TiKV       *TiKVBackup            `json:"tikv"`
+	TiFlash    *TiFlashBackup         `json:"tiflash,omitempty"`
 	PD         Component              `json:"pd"`
 	TiDB       Component              `json:"tidb"`
 	Kubernetes *KubernetesBackup      `json:"kubernetes"`
@@ -271,6 +325,17 @@ type TiKVBackup struct {
 	Stores []*StoresBackup `json:"stores"`
 }
 
+// TiFlashBackup is the volume snapshots of the TiFlash stores, it's only recorded if the backup includes TiFlash
+type TiFlashBackup struct {
+	Component
+	Stores []*StoresBackup `json:"stores"`
+}
+
+// HasTiFlashSnapshots returns true if the backup includes the volume snapshots of TiFlash
+func (csb *CloudSnapBackup) HasTiFlashSnapshots() bool {
+	return csb.TiFlash != nil && len(csb.TiFlash.Stores) > 0
+}
+
 type StoresBackup struct {
 	StoreID uint64          `json:"store_id"`
 	Volumes []*VolumeBackup `json:"volumes"`
@@ -455,8 +520,62 @@ func (m *StoresMixture) PrepareCSBStoresMeta(csb *CloudSnapBackup, pods []*corev
 	return "", nil
 }
 
+// pvAvailableZone returns the AZ of the PV from its node affinity, or from its zone labels if it has no node affinity
+func pvAvailableZone(pv *corev1.PersistentVolume) string {
+	zoneKeys := append([]string{constants.NodeAffinityCsiEbsAzKey}, gcpZoneKeys...)
+	isZoneKey := func(key string) bool {
+		for _, k := range zoneKeys {
+			if key == k {
+				return true
+			}
+		}
+		return false
+	}
+	if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+		for _, nodeSelector := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+			for _, field := range nodeSelector.MatchFields {
+				if isZoneKey(field.Key) && len(field.Values) > 0 {
+					return field.Values[0]
+				}
+			}
+			for _, expr := range nodeSelector.MatchExpressions {
+				if isZoneKey(expr.Key) && expr.Operator == corev1.NodeSelectorOpIn && len(expr.Values) > 0 {
+					return expr.Values[0]
+				}
+			}
+		}
+	}
+	for _, key := range zoneKeys {
+		if zone := pv.Labels[key]; zone != "" {
+			return zone
+		}
+	}
+	return ""
+}
+
+// GenerateVolumeAZPlan maps the AZ of every backup PV to the AZ it restores to, which is the AZ the volume
+// snapshots restore to if it's set, or the AZ of the PV itself.
+func GenerateVolumeAZPlan(r *v1alpha1.Restore, pvs []*corev1.PersistentVolume) map[string]string {
+	plan := make(map[string]string)
+	for _, pv := range pvs {
+		sourceAZ := pvAvailableZone(pv)
+		if sourceAZ == "" {
+			continue
+		}
+		targetAZ := r.GetVolumeAZ()
+		if targetAZ == "" {
+			targetAZ = sourceAZ
+		}
+		plan[sourceAZ] = targetAZ
+	}
+	return plan
+}
+
 func (m *StoresMixture) ProcessCSBPVCsAndPVs(r *v1alpha1.Restore, csb *CloudSnapBackup) (string, error) {
 	m.generateRestoreVolumeIDMap(csb.TiKV.Stores)
+	if csb.HasTiFlashSnapshots() {
+		m.generateRestoreVolumeIDMap(csb.TiFlash.Stores)
+	}
 
 	backupClusterName := csb.Kubernetes.TiDBCluster.Name
 	pvcMap := make(map[string]*corev1.PersistentVolumeClaim)
@@ -471,6 +590,10 @@ func (m *StoresMixture) ProcessCSBPVCsAndPVs(r *v1alpha1.Restore, csb *CloudSnap
 		}
 	}
 
+	if reason, err := overrideStoreVolumeMapping(r.Spec.StoreVolumeMapping, csb, volID2PV); err != nil {
+		return reason, err
+	}
+
 	pvs, pvcs := make([]*corev1.PersistentVolume, 0, len(m.rsVolIDMap)), make([]*corev1.PersistentVolumeClaim, 0, len(m.rsVolIDMap))
 	for backupVolID, restoreVolID := range m.rsVolIDMap {
 		pv, ok := volID2PV[backupVolID]
@@ -502,18 +625,51 @@ func (m *StoresMixture) ProcessCSBPVCsAndPVs(r *v1alpha1.Restore, csb *CloudSnap
 		pvcs = append(pvcs, pvc)
 	}
 
-	restoreSTSName := controller.TiKVMemberName(r.Spec.BR.Cluster)
-	sequentialPVCs, sequentialPVs, err := resetPVCSequence(restoreSTSName, pvcs, pvs)
+	// the PVCs of TiKV and TiFlash are named after their own statefulsets, they are made sequential separately
+	var tikvPVCs, tiflashPVCs []*corev1.PersistentVolumeClaim
+	var tikvPVs, tiflashPVs []*corev1.PersistentVolume
+	for i, pvc := range pvcs {
+		if isTiFlashPVC(pvc) {
+			tiflashPVCs = append(tiflashPVCs, pvc)
+			tiflashPVs = append(tiflashPVs, pvs[i])
+		} else {
+			tikvPVCs = append(tikvPVCs, pvc)
+			tikvPVs = append(tikvPVs, pvs[i])
+		}
+	}
+	sequentialPVCs, sequentialPVs, err := resetPVCSequence(controller.TiKVMemberName(r.Spec.BR.Cluster), tikvPVCs, tikvPVs)
 	if err != nil {
 		klog.Errorf("reset pvcs to sequential error: %s", err.Error())
 		return "InvalidPVCName", err
 	}
+	if len(tiflashPVCs) > 0 {
+		sequentialTiFlashPVCs, sequentialTiFlashPVs, err := resetPVCSequence(controller.TiFlashMemberName(r.Spec.BR.Cluster), tiflashPVCs, tiflashPVs)
+		if err != nil {
+			klog.Errorf("reset tiflash pvcs to sequential error: %s", err.Error())
+			return "InvalidPVCName", err
+		}
+		sequentialPVCs = append(sequentialPVCs, sequentialTiFlashPVCs...)
+		sequentialPVs = append(sequentialPVs, sequentialTiFlashPVs...)
+	}
 
 	csb.Kubernetes.PVCs = sequentialPVCs
 	csb.Kubernetes.PVs = sequentialPVs
 	return "", nil
 }
 
+// isTiFlashPVC returns true if the PVC is of TiFlash, the other PVCs in the backup are of TiKV
+func isTiFlashPVC(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc.Labels[label.ComponentLabelKey] == label.TiFlashLabelVal
+}
+
+// memberNameOfPVC returns the name of the statefulset of the cluster which the PVC belongs to
+func memberNameOfPVC(pvc *corev1.PersistentVolumeClaim, clusterName string) string {
+	if isTiFlashPVC(pvc) {
+		return controller.TiFlashMemberName(clusterName)
+	}
+	return controller.TiKVMemberName(clusterName)
+}
+
 // If a backup cluster has scaled in and the tidb-operator enabled advanced-statefulset(ref: https://docs.pingcap.com/zh/tidb-in-kubernetes/stable/advanced-statefulset)
 // the name of pvc can be not sequential, and every tikv pod can have multiple pvc, eg:
 // [tikv-db-tikv-0, tikv-db-tikv-2, tikv-db-tikv-3, tikv-raft-db-tikv-0, tikv-raft-db-tikv-2, tikv-raft-db-tikv-3]
@@ -594,6 +750,81 @@ func resetPVCSequence(stsName string, pvcs []*corev1.PersistentVolumeClaim, pvs
 	return sequentialPVCs, sequentialPVs, nil
 }
 
+// overrideStoreVolumeMapping overrides the PVs of the store volumes in volID2PV according to the
+// mapping specified by user, each volume of the stores should be mapped to a different PV after overriding.
+func overrideStoreVolumeMapping(mapping []v1alpha1.StoreVolumeMap, csb *CloudSnapBackup, volID2PV map[string]*corev1.PersistentVolume) (string, error) {
+	if len(mapping) == 0 {
+		return "", nil
+	}
+
+	storeMap := make(map[uint64]*StoresBackup, len(csb.TiKV.Stores))
+	for _, store := range csb.TiKV.Stores {
+		storeMap[store.StoreID] = store
+	}
+	pvMap := make(map[string]*corev1.PersistentVolume, len(csb.Kubernetes.PVs))
+	for _, pv := range csb.Kubernetes.PVs {
+		pvMap[pv.Name] = pv
+	}
+
+	for _, svm := range mapping {
+		store, ok := storeMap[svm.StoreID]
+		if !ok {
+			return "StoreNotFoundInBackupMeta", fmt.Errorf("store %d of storeVolumeMapping not found in backup meta", svm.StoreID)
+		}
+		var vol *VolumeBackup
+		for _, v := range store.Volumes {
+			if v.SnapshotID == svm.SnapshotID {
+				vol = v
+				break
+			}
+		}
+		if vol == nil {
+			return "SnapshotNotFoundInBackupMeta", fmt.Errorf("snapshot %s of store %d not found in backup meta", svm.SnapshotID, svm.StoreID)
+		}
+		if vol.RestoreVolumeID == "" {
+			return "SnapshotNotRestored", fmt.Errorf("snapshot %s of store %d has no restored volume", svm.SnapshotID, svm.StoreID)
+		}
+		pv, ok := pvMap[svm.TargetPVName]
+		if !ok {
+			return "PVNotFoundInBackupMeta", fmt.Errorf("pv %s of storeVolumeMapping not found in backup meta", svm.TargetPVName)
+		}
+		klog.Infof("override the pv of volume %s in store %d from snapshot %s to %s", vol.VolumeID, svm.StoreID, svm.SnapshotID, pv.Name)
+		volID2PV[vol.VolumeID] = pv
+	}
+
+	mappedPVs := make(map[string]string)
+	for _, store := range csb.TiKV.Stores {
+		for _, vol := range store.Volumes {
+			pv, ok := volID2PV[vol.VolumeID]
+			if !ok {
+				continue
+			}
+			if volID, ok := mappedPVs[pv.Name]; ok {
+				return "DuplicatedPVMapping", fmt.Errorf("pv %s is mapped by both volume %s and %s, please specify the mapping of all the affected volumes", pv.Name, volID, vol.VolumeID)
+			}
+			mappedPVs[pv.Name] = vol.VolumeID
+		}
+	}
+	return "", nil
+}
+
+// RestoredVolumeIDs returns the ids of the volumes restored from the snapshots in the restore metadata.
+func RestoredVolumeIDs(csb *CloudSnapBackup) []string {
+	if csb == nil || csb.TiKV == nil {
+		return nil
+	}
+	volIDs := []string{}
+	for _, store := range csb.TiKV.Stores {
+		for _, vol := range store.Volumes {
+			if vol.RestoreVolumeID != "" {
+				volIDs = append(volIDs, vol.RestoreVolumeID)
+			}
+		}
+	}
+	sort.Strings(volIDs)
+	return volIDs
+}
+
 func (m *StoresMixture) generateRestoreVolumeIDMap(stores []*StoresBackup) {
 	vols := []*VolumeBackup{}
 	for _, store := range stores {
@@ -641,10 +872,11 @@ func resetMetadataAndStatus(
 	// The restore cluster is not the same as the backup cluster, we need to reset the
 	// pvc/pv namespace and name to the restore cluster's namespace and name.
 	if restoreClusterNamespace != pvc.Namespace || restoreClusterName != backupClusterName {
-		// The PVC name format is tikv[-${additionalVolumeName}]-${statefulSetName}-${ordinal}.
+		// The PVC name format is tikv[-${additionalVolumeName}]-${statefulSetName}-${ordinal}, or
+		// data${index}-${statefulSetName}-${ordinal} for TiFlash.
 		// We need to replace the statefulSetName with the restore cluster's statefulSetName.
-		backupStatefulSetName := controller.TiKVMemberName(backupClusterName)
-		restoreStatefulSetName := controller.TiKVMemberName(restoreClusterName)
+		backupStatefulSetName := memberNameOfPVC(pvc, backupClusterName)
+		restoreStatefulSetName := memberNameOfPVC(pvc, restoreClusterName)
 		newPVCName := regexp.MustCompile(fmt.Sprintf("%s-([0-9]+)$", backupStatefulSetName)).
 			ReplaceAllString(pvc.Name, fmt.Sprintf("%s-$1", restoreStatefulSetName))
 		klog.Infof("reset PVC %s/%s to %s/%s", pvc.Namespace, pvc.Name, restoreClusterNamespace, newPVCName)
@@ -112,7 +112,11 @@ func (s *AWSSnapshotter) AddVolumeTags(pvs []*corev1.PersistentVolume) error {
 
 		resourcesTags[volId] = tags
 	}
-	ec2Session, err := util.NewEC2Session(CloudAPIConcurrency)
+	concurrency := uint(CloudAPIConcurrency)
+	if s.deps != nil && s.deps.CLIConfig.VolumeTagConcurrency > 0 {
+		concurrency = s.deps.CLIConfig.VolumeTagConcurrency
+	}
+	ec2Session, err := util.NewEC2Session(concurrency)
 	if err != nil {
 		return err
 	}
@@ -124,12 +128,20 @@ func (s *AWSSnapshotter) AddVolumeTags(pvs []*corev1.PersistentVolume) error {
 
 }
 
+func (s *AWSSnapshotter) DeleteVolumes(volumeIDs []string) error {
+	ec2Session, err := util.NewEC2Session(CloudAPIConcurrency)
+	if err != nil {
+		return err
+	}
+	return ec2Session.DeleteVolumes(volumeIDs)
+}
+
 func (s *AWSSnapshotter) ResetPvAvailableZone(r *v1alpha1.Restore, pv *corev1.PersistentVolume) {
-	if r.Spec.VolumeAZ == "" {
+	restoreAZ := r.GetVolumeTargetAZ(pvAvailableZone(pv))
+	if restoreAZ == "" {
 		return
 	}
 
-	restoreAZ := r.Spec.VolumeAZ
 	if pv.Spec.NodeAffinity == nil {
 		return
 	}
@@ -19,16 +19,31 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/pingcap/tidb-operator/pkg/apis/label"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	"github.com/pingcap/tidb-operator/pkg/backup/util"
 	"github.com/pingcap/tidb-operator/pkg/controller"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 )
 
+const (
+	// the GCP labels only allow lowercase letters, digits, underscores and dashes
+	GCPPVLabelKey  = "csi-volume-name"
+	GCPPodLabelKey = "created-for-pod-name"
+)
+
+// gcpZoneKeys are the keys of the zone in the node affinity and the labels of the PVs on GCP
+var gcpZoneKeys = []string{constants.NodeAffinityCsiPdZoneKey, corev1.LabelTopologyZone, corev1.LabelFailureDomainBetaZone}
+
 // The GCPSnapshotter for creating snapshots from volumes (during a backup)
 // and volumes from snapshots (during a restore) on Google Compute Engine Disks.
 type GCPSnapshotter struct {
 	BaseSnapshotter
+	// restoreDisks maps the names of the disks restored from the snapshots to their volume handles,
+	// the disk name alone can't locate a disk to delete
+	restoreDisks map[string]string
 }
 
 func (s *GCPSnapshotter) Init(deps *controller.Dependencies, conf map[string]string) error {
@@ -96,14 +111,134 @@ func (s *GCPSnapshotter) SetVolumeID(pv *corev1.PersistentVolume, volumeID strin
 }
 
 func (s *GCPSnapshotter) PrepareRestoreMetadata(r *v1alpha1.Restore, csb *CloudSnapBackup) (string, error) {
+	s.restoreDisks = restoreDiskHandles(r, csb)
 	return s.BaseSnapshotter.prepareRestoreMetadata(r, csb, s)
 }
 
+// restoreDiskHandles returns the volume handles of the disks restored from the snapshots, the disks are created
+// in the project of the backup disks, and in the zone planned for the zone of the backup disks.
+func restoreDiskHandles(r *v1alpha1.Restore, csb *CloudSnapBackup) map[string]string {
+	handles := make(map[string]string)
+	if csb == nil || csb.Kubernetes == nil || csb.TiKV == nil {
+		return handles
+	}
+
+	backupDisks := make(map[string]string)
+	for _, pv := range csb.Kubernetes.PVs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != constants.PdCSIDriver {
+			continue
+		}
+		if _, _, disk, err := util.ParseGCPDiskHandle(pv.Spec.CSI.VolumeHandle); err == nil {
+			backupDisks[disk] = pv.Spec.CSI.VolumeHandle
+		}
+	}
+	for _, store := range csb.TiKV.Stores {
+		for _, vol := range store.Volumes {
+			handle, ok := backupDisks[vol.VolumeID]
+			if !ok || vol.RestoreVolumeID == "" {
+				continue
+			}
+			project, zone, _, _ := util.ParseGCPDiskHandle(handle)
+			if restoreZone := r.GetVolumeTargetAZ(zone); restoreZone != "" {
+				zone = restoreZone
+			}
+			handles[vol.RestoreVolumeID] = fmt.Sprintf("projects/%s/zones/%s/disks/%s", project, zone, vol.RestoreVolumeID)
+		}
+	}
+	return handles
+}
+
+// ResetPvAvailableZone moves the disk of the PV to the zone the volumes are restored to, including the zone in
+// the volume handle of the PD CSI driver, the node affinity and the zone labels.
 func (s *GCPSnapshotter) ResetPvAvailableZone(r *v1alpha1.Restore, pv *corev1.PersistentVolume) {
-	// TODO implement it if support to restore snapshots to another az on GCP
+	restoreZone := r.GetVolumeTargetAZ(pvAvailableZone(pv))
+	if restoreZone == "" {
+		return
+	}
+
+	if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == constants.PdCSIDriver {
+		if project, _, disk, err := util.ParseGCPDiskHandle(pv.Spec.CSI.VolumeHandle); err == nil {
+			pv.Spec.CSI.VolumeHandle = fmt.Sprintf("projects/%s/zones/%s/disks/%s", project, restoreZone, disk)
+		}
+	}
+	for _, key := range gcpZoneKeys {
+		if _, ok := pv.Labels[key]; ok {
+			pv.Labels[key] = restoreZone
+		}
+	}
+
+	if pv.Spec.NodeAffinity == nil {
+		return
+	}
+	if pv.Spec.NodeAffinity.Required == nil {
+		return
+	}
+	for i, nodeSelector := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for j, field := range nodeSelector.MatchFields {
+			if isGCPZoneKey(field.Key) {
+				pv.Spec.NodeAffinity.Required.NodeSelectorTerms[i].MatchFields[j].Values = []string{restoreZone}
+			}
+		}
+		for j, expr := range nodeSelector.MatchExpressions {
+			if isGCPZoneKey(expr.Key) && expr.Operator == corev1.NodeSelectorOpIn {
+				pv.Spec.NodeAffinity.Required.NodeSelectorTerms[i].MatchExpressions[j].Values = []string{restoreZone}
+			}
+		}
+	}
 }
 
+func isGCPZoneKey(key string) bool {
+	for _, k := range gcpZoneKeys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// AddVolumeTags adds the labels to the persistent disks of the PVs, only the disks provisioned by
+// the PD CSI driver are labeled.
 func (s *GCPSnapshotter) AddVolumeTags(pvs []*corev1.PersistentVolume) error {
-	// TODO implement it if support to restore snapshots to another az on GCP
-	return nil
+	disksLabels := make(map[string]util.TagMap)
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != constants.PdCSIDriver {
+			klog.Warningf("pv %s is not provisioned by %s, skip labeling its disk", pv.GetName(), constants.PdCSIDriver)
+			continue
+		}
+		disksLabels[pv.Spec.CSI.VolumeHandle] = util.TagMap{
+			GCPPVLabelKey:  util.GCPLabelValue(pv.GetName()),
+			GCPPodLabelKey: util.GCPLabelValue(pv.GetAnnotations()[label.AnnPodNameKey]),
+		}
+	}
+	if len(disksLabels) == 0 {
+		return nil
+	}
+
+	concurrency := uint(CloudAPIConcurrency)
+	if s.deps != nil && s.deps.CLIConfig.VolumeTagConcurrency > 0 {
+		concurrency = s.deps.CLIConfig.VolumeTagConcurrency
+	}
+	gcpSession, err := util.NewGCPSession(concurrency)
+	if err != nil {
+		return err
+	}
+	return gcpSession.AddLabels(disksLabels)
+}
+
+// DeleteVolumes deletes the disks restored from the snapshots, the volume handles of the disks are resolved
+// in PrepareRestoreMetadata.
+func (s *GCPSnapshotter) DeleteVolumes(volumeIDs []string) error {
+	handles := make([]string, 0, len(volumeIDs))
+	for _, id := range volumeIDs {
+		handle, ok := s.restoreDisks[id]
+		if !ok {
+			return fmt.Errorf("the volume handle of disk %s is unknown", id)
+		}
+		handles = append(handles, handle)
+	}
+	gcpSession, err := util.NewGCPSession(CloudAPIConcurrency)
+	if err != nil {
+		return err
+	}
+	return gcpSession.DeleteDisks(handles)
 }
@@ -859,7 +859,7 @@ func TestPrepareRestoreMetadata(t *testing.T) {
 		},
 	}
 
-	s, _, err := NewSnapshotterForRestore(restore.Spec.Mode, deps)
+	s, _, err := NewSnapshotterForRestore(restore, nil, deps)
 	require.NoError(t, err)
 
 	// missing .annotation["tidb.pingcap.com/backup-cloud-snapshot"] as metadata
@@ -876,6 +876,164 @@ func TestPrepareRestoreMetadata(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestNewSnapshotterForRestoreOnGCP(t *testing.T) {
+	helper := newHelper(t)
+	defer helper.Close()
+
+	// the cloud is inferred from the PVs rather than the storage of the backup
+	restore := &v1alpha1.Restore{
+		Spec: v1alpha1.RestoreSpec{
+			Mode: v1alpha1.RestoreModeVolumeSnapshot,
+			StorageProvider: v1alpha1.StorageProvider{
+				S3: &v1alpha1.S3StorageProvider{Bucket: "bucket"},
+			},
+		},
+	}
+	newPV := func(source corev1.PersistentVolumeSource) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: source}}
+	}
+	gcpPVs := []*corev1.PersistentVolume{newPV(corev1.PersistentVolumeSource{
+		CSI: &corev1.CSIPersistentVolumeSource{Driver: constants.PdCSIDriver},
+	})}
+	s, _, err := NewSnapshotterForRestore(restore, gcpPVs, helper.Deps)
+	require.NoError(t, err)
+	require.IsType(t, &GCPSnapshotter{}, s)
+
+	inTreePVs := []*corev1.PersistentVolume{newPV(corev1.PersistentVolumeSource{
+		GCEPersistentDisk: &corev1.GCEPersistentDiskVolumeSource{PDName: "disk-1"},
+	})}
+	require.Equal(t, VolumeTypeGCPPD, VolumeTypeOfPVs(inTreePVs))
+
+	awsPVs := []*corev1.PersistentVolume{newPV(corev1.PersistentVolumeSource{
+		CSI: &corev1.CSIPersistentVolumeSource{Driver: constants.EbsCSIDriver},
+	})}
+	s, _, err = NewSnapshotterForRestore(restore, awsPVs, helper.Deps)
+	require.NoError(t, err)
+	require.IsType(t, &AWSSnapshotter{}, s)
+
+	// AWS EBS by default
+	s, _, err = NewSnapshotterForRestore(restore, nil, helper.Deps)
+	require.NoError(t, err)
+	require.IsType(t, &AWSSnapshotter{}, s)
+	require.Equal(t, VolumeTypeGCPPD, VolumeTypeOfProvisioner("kubernetes.io/gce-pd"))
+	require.Equal(t, VolumeTypeAWSEBS, VolumeTypeOfProvisioner("kubernetes.io/aws-ebs"))
+}
+
+func TestRestoreDiskHandlesOnGCP(t *testing.T) {
+	csb := &CloudSnapBackup{
+		Kubernetes: &KubernetesBackup{
+			PVs: []*corev1.PersistentVolume{{
+				Spec: corev1.PersistentVolumeSpec{
+					PersistentVolumeSource: corev1.PersistentVolumeSource{
+						CSI: &corev1.CSIPersistentVolumeSource{
+							Driver:       constants.PdCSIDriver,
+							VolumeHandle: "projects/p/zones/us-central1-a/disks/disk-1",
+						},
+					},
+				},
+			}},
+		},
+		TiKV: &TiKVBackup{
+			Stores: []*StoresBackup{{
+				Volumes: []*VolumeBackup{{VolumeID: "disk-1", RestoreVolumeID: "restored-1"}},
+			}},
+		},
+	}
+
+	restore := &v1alpha1.Restore{}
+	require.Equal(t, map[string]string{"restored-1": "projects/p/zones/us-central1-a/disks/restored-1"}, restoreDiskHandles(restore, csb))
+
+	restore.Spec.VolumeAZ = "us-central1-b"
+	require.Equal(t, map[string]string{"restored-1": "projects/p/zones/us-central1-b/disks/restored-1"}, restoreDiskHandles(restore, csb))
+
+	// the disks not restored by the snapshotter can't be deleted
+	s := &GCPSnapshotter{}
+	require.Error(t, s.DeleteVolumes([]string{"restored-1"}))
+}
+
+func TestResetPvAvailableZoneOnGCP(t *testing.T) {
+	s := &GCPSnapshotter{}
+	require.NoError(t, s.Init(nil, nil))
+
+	newPV := func() *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{corev1.LabelTopologyZone: "us-central1-a"},
+			},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       constants.PdCSIDriver,
+						VolumeHandle: "projects/p/zones/us-central1-a/disks/disk-1",
+					},
+				},
+				NodeAffinity: &corev1.VolumeNodeAffinity{
+					Required: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{
+								Key:      constants.NodeAffinityCsiPdZoneKey,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"us-central1-a"},
+							}},
+						}},
+					},
+				},
+			},
+		}
+	}
+
+	// the zone is kept if the restore zone is not set
+	restore := &v1alpha1.Restore{}
+	pv := newPV()
+	s.ResetPvAvailableZone(restore, pv)
+	require.Equal(t, newPV(), pv)
+
+	restore.Spec.VolumeAZ = "us-central1-b"
+	s.ResetPvAvailableZone(restore, pv)
+	require.Equal(t, "projects/p/zones/us-central1-b/disks/disk-1", pv.Spec.CSI.VolumeHandle)
+	require.Equal(t, "us-central1-b", pv.Labels[corev1.LabelTopologyZone])
+	require.Equal(t, []string{"us-central1-b"}, pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values)
+
+	// the recorded AZ plan takes precedence over the restore zone
+	restore.Status.VolumeAZPlan = map[string]string{"us-central1-a": "us-central1-c"}
+	pv = newPV()
+	s.ResetPvAvailableZone(restore, pv)
+	require.Equal(t, "projects/p/zones/us-central1-c/disks/disk-1", pv.Spec.CSI.VolumeHandle)
+	require.Equal(t, []string{"us-central1-c"}, pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values)
+}
+
+func TestGenerateVolumeAZPlan(t *testing.T) {
+	newPV := func(key, zone string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			Spec: corev1.PersistentVolumeSpec{
+				NodeAffinity: &corev1.VolumeNodeAffinity{
+					Required: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{
+								Key:      key,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{zone},
+							}},
+						}},
+					},
+				},
+			},
+		}
+	}
+	pvs := []*corev1.PersistentVolume{
+		newPV(constants.NodeAffinityCsiEbsAzKey, "us-west-2a"),
+		newPV(constants.NodeAffinityCsiEbsAzKey, "us-west-2b"),
+		{},
+	}
+
+	// the volumes restore to their own AZ if the restore AZ is not set
+	restore := &v1alpha1.Restore{}
+	require.Equal(t, map[string]string{"us-west-2a": "us-west-2a", "us-west-2b": "us-west-2b"}, GenerateVolumeAZPlan(restore, pvs))
+
+	restore.Spec.VolumeAZ = "us-west-2c"
+	require.Equal(t, map[string]string{"us-west-2a": "us-west-2c", "us-west-2b": "us-west-2c"}, GenerateVolumeAZPlan(restore, pvs))
+}
+
 func TestProcessCSBPVCsAndPVs(t *testing.T) {
 	sAWS := &AWSSnapshotter{}
 	err := sAWS.Init(nil, nil)
@@ -2027,3 +2185,90 @@ func TestResetPVCSequence(t *testing.T) {
 	}
 
 }
+
+func TestOverrideStoreVolumeMapping(t *testing.T) {
+	newPV := func(name, volID string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: map[string]string{constants.AnnTemporaryVolumeID: volID},
+			},
+		}
+	}
+	newCSB := func() (*CloudSnapBackup, map[string]*corev1.PersistentVolume) {
+		pvs := []*corev1.PersistentVolume{newPV("pv-1", "vol-1"), newPV("pv-2", "vol-2")}
+		csb := &CloudSnapBackup{
+			TiKV: &TiKVBackup{
+				Stores: []*StoresBackup{
+					{StoreID: 1, Volumes: []*VolumeBackup{{VolumeID: "vol-1", SnapshotID: "snap-1", RestoreVolumeID: "vol-r1"}}},
+					{StoreID: 2, Volumes: []*VolumeBackup{{VolumeID: "vol-2", SnapshotID: "snap-2", RestoreVolumeID: "vol-r2"}}},
+				},
+			},
+			Kubernetes: &KubernetesBackup{PVs: pvs},
+		}
+		volID2PV := map[string]*corev1.PersistentVolume{"vol-1": pvs[0], "vol-2": pvs[1]}
+		return csb, volID2PV
+	}
+
+	// no mapping
+	csb, volID2PV := newCSB()
+	reason, err := overrideStoreVolumeMapping(nil, csb, volID2PV)
+	require.NoError(t, err)
+	require.Empty(t, reason)
+	require.Equal(t, "pv-1", volID2PV["vol-1"].Name)
+
+	// swap the pvs of the two stores
+	csb, volID2PV = newCSB()
+	reason, err = overrideStoreVolumeMapping([]v1alpha1.StoreVolumeMap{
+		{StoreID: 1, SnapshotID: "snap-1", TargetPVName: "pv-2"},
+		{StoreID: 2, SnapshotID: "snap-2", TargetPVName: "pv-1"},
+	}, csb, volID2PV)
+	require.NoError(t, err)
+	require.Empty(t, reason)
+	require.Equal(t, "pv-2", volID2PV["vol-1"].Name)
+	require.Equal(t, "pv-1", volID2PV["vol-2"].Name)
+
+	// only one side of the swap is specified
+	csb, volID2PV = newCSB()
+	reason, err = overrideStoreVolumeMapping([]v1alpha1.StoreVolumeMap{
+		{StoreID: 1, SnapshotID: "snap-1", TargetPVName: "pv-2"},
+	}, csb, volID2PV)
+	require.Error(t, err)
+	require.Equal(t, "DuplicatedPVMapping", reason)
+
+	tests := []struct {
+		mapping v1alpha1.StoreVolumeMap
+		reason  string
+	}{
+		{v1alpha1.StoreVolumeMap{StoreID: 3, SnapshotID: "snap-1", TargetPVName: "pv-1"}, "StoreNotFoundInBackupMeta"},
+		{v1alpha1.StoreVolumeMap{StoreID: 1, SnapshotID: "snap-2", TargetPVName: "pv-1"}, "SnapshotNotFoundInBackupMeta"},
+		{v1alpha1.StoreVolumeMap{StoreID: 1, SnapshotID: "snap-1", TargetPVName: "pv-3"}, "PVNotFoundInBackupMeta"},
+	}
+	for _, tt := range tests {
+		csb, volID2PV = newCSB()
+		reason, err = overrideStoreVolumeMapping([]v1alpha1.StoreVolumeMap{tt.mapping}, csb, volID2PV)
+		require.Error(t, err)
+		require.Equal(t, tt.reason, reason)
+	}
+}
+
+func TestMemberNameOfPVC(t *testing.T) {
+	tikvPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "tikv-db-tikv-0",
+		Labels: map[string]string{label.ComponentLabelKey: label.TiKVLabelVal},
+	}}
+	tiflashPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:   "data0-db-tiflash-0",
+		Labels: map[string]string{label.ComponentLabelKey: label.TiFlashLabelVal},
+	}}
+	require.False(t, isTiFlashPVC(tikvPVC))
+	require.True(t, isTiFlashPVC(tiflashPVC))
+	require.Equal(t, "db-tikv", memberNameOfPVC(tikvPVC, "db"))
+	require.Equal(t, "db-tiflash", memberNameOfPVC(tiflashPVC, "db"))
+
+	// the backup without TiFlash has no TiFlash snapshots
+	csb := &CloudSnapBackup{TiKV: &TiKVBackup{}}
+	require.False(t, csb.HasTiFlashSnapshots())
+	csb.TiFlash = &TiFlashBackup{Stores: []*StoresBackup{{StoreID: 10}}}
+	require.True(t, csb.HasTiFlashSnapshots())
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
 	"github.com/pingcap/tidb-operator/pkg/controller"
+	"github.com/pingcap/tidb-operator/pkg/pdapi"
+	"github.com/pingcap/tidb-operator/pkg/util"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -120,6 +122,27 @@ func (h *Helper) CreateSecret(obj interface{}) {
 				return err
 			}, time.Second*10).Should(BeNil())
 		}
+		if obj2.Spec.BR != nil {
+			h.CreateTLSSecrets(obj2)
+		}
+	}
+}
+
+// CreateTLSSecrets creates the TLS secrets mounted into the BR restore pod of a TLS enabled cluster
+func (h *Helper) CreateTLSSecrets(restore *v1alpha1.Restore) {
+	h.T.Helper()
+	g := NewGomegaWithT(h.T)
+	secretNames := []string{util.ClusterClientTLSSecretName(restore.Spec.BR.Cluster)}
+	if restore.Spec.To != nil {
+		secretNames = append(secretNames, util.TiDBClientTLSSecretName(restore.Spec.BR.Cluster, restore.Spec.To.TLSClientSecretName))
+	}
+	for _, secretName := range secretNames {
+		secretName := secretName
+		h.createSecret(restore.Namespace, secretName)
+		g.Eventually(func() error {
+			_, err := h.Deps.SecretLister.Secrets(restore.Namespace).Get(secretName)
+			return err
+		}, time.Second*10).Should(BeNil())
 	}
 }
 
@@ -134,6 +157,7 @@ func (h *Helper) CreateTC(namespace, clusterName string, acrossK8s, recoverMode
 			AcrossK8s:    acrossK8s,
 			RecoveryMode: recoverMode,
 			TLSCluster:   &v1alpha1.TLSCluster{Enabled: true},
+			Version:      "v6.5.0",
 			TiKV: &v1alpha1.TiKVSpec{
 				BaseImage: "pingcap/tikv",
 				Replicas:  3,
@@ -166,6 +190,11 @@ func (h *Helper) CreateTC(namespace, clusterName string, acrossK8s, recoverMode
 	}
 	tc.Namespace = namespace
 	tc.Name = clusterName
+	// the cluster is empty before the restore, the tests checking the stores override the pd client
+	pdClient := controller.NewFakePDClient(h.Deps.PDControl.(*pdapi.FakePDControl), tc)
+	pdClient.AddReaction(pdapi.GetStoresActionType, func(action *pdapi.Action) (interface{}, error) {
+		return &pdapi.StoresInfo{}, nil
+	})
 	_, err = h.Deps.Clientset.PingcapV1alpha1().TidbClusters(tc.Namespace).Create(context.TODO(), tc, metav1.CreateOptions{})
 	g.Expect(err).Should(BeNil())
 	// make sure can read tc from lister
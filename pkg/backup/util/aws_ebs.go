@@ -14,15 +14,20 @@
 package util
 
 import (
+	"fmt"
 	"os"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ebs"
 	"github.com/aws/aws-sdk-go/service/ebs/ebsiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
@@ -30,6 +35,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	errorutils "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 )
 
@@ -41,6 +47,9 @@ const (
 	IO1Volume           EBSVolumeType = "io1"
 	IO2Volume           EBSVolumeType = "io2"
 	CloudAPIConcurrency               = 3
+
+	// describeTagsFilterSize is the max number of resource ids in a filter of DescribeTags
+	describeTagsFilterSize = 200
 )
 
 func (t EBSVolumeType) Valid() bool {
@@ -85,6 +94,12 @@ type TiKVComponent struct {
 	Stores   []*EBSStore `json:"stores"`
 }
 
+// TiFlashComponent is the volume snapshots of the TiFlash stores, it's only recorded if the backup includes TiFlash
+type TiFlashComponent struct {
+	Replicas int         `json:"replicas"`
+	Stores   []*EBSStore `json:"stores"`
+}
+
 type PDComponent struct {
 	Replicas int `json:"replicas"`
 }
@@ -93,14 +108,69 @@ type TiDBComponent struct {
 	Replicas int `json:"replicas"`
 }
 
+// MaxSupportedVolSnapBackupMetaVersion is the newest version of the volume snapshot backup meta the operator can
+// read, the meta written before the version is recorded is of version 1
+const MaxSupportedVolSnapBackupMetaVersion = 1
+
 type EBSBasedBRMeta struct {
-	ClusterInfo    *ClusterInfo           `json:"cluster_info" toml:"cluster_info"`
-	TiKVComponent  *TiKVComponent         `json:"tikv" toml:"tikv"`
-	TiDBComponent  *TiDBComponent         `json:"tidb" toml:"tidb"`
-	PDComponent    *PDComponent           `json:"pd" toml:"pd"`
-	KubernetesMeta *KubernetesBackup      `json:"kubernetes" toml:"kubernetes"`
-	Options        map[string]interface{} `json:"options" toml:"options"`
-	Region         string                 `json:"region" toml:"region"`
+	// MetaVersion is the version of the schema of the backup meta, it's bumped when the meta can't be read
+	// correctly by the operator reading the older version
+	MetaVersion      int                    `json:"meta_version,omitempty" toml:"meta_version"`
+	ClusterInfo      *ClusterInfo           `json:"cluster_info" toml:"cluster_info"`
+	TiKVComponent    *TiKVComponent         `json:"tikv" toml:"tikv"`
+	TiFlashComponent *TiFlashComponent      `json:"tiflash,omitempty" toml:"tiflash"`
+	TiDBComponent    *TiDBComponent         `json:"tidb" toml:"tidb"`
+	PDComponent      *PDComponent           `json:"pd" toml:"pd"`
+	KubernetesMeta   *KubernetesBackup      `json:"kubernetes" toml:"kubernetes"`
+	Options          map[string]interface{} `json:"options" toml:"options"`
+	Region           string                 `json:"region" toml:"region"`
+}
+
+// GetMetaVersion returns the version of the backup meta, the meta without the version is of version 1
+func (m *EBSBasedBRMeta) GetMetaVersion() int {
+	if m.MetaVersion == 0 {
+		return 1
+	}
+	return m.MetaVersion
+}
+
+// IncompatibleBackupMetaVersionError is the error of reading the backup meta newer than the operator supports,
+// the meta may be misread by the operator so the restore must not go on
+type IncompatibleBackupMetaVersionError struct {
+	Version             int
+	MaxSupportedVersion int
+}
+
+func (e *IncompatibleBackupMetaVersionError) Error() string {
+	return fmt.Sprintf("backup meta version %d is newer than the max version %d supported by the operator, upgrade the operator to restore it", e.Version, e.MaxSupportedVersion)
+}
+
+// CheckMetaVersion returns IncompatibleBackupMetaVersionError if the backup meta is newer than the operator supports
+func (m *EBSBasedBRMeta) CheckMetaVersion() error {
+	if version := m.GetMetaVersion(); version > MaxSupportedVolSnapBackupMetaVersion {
+		return &IncompatibleBackupMetaVersionError{Version: version, MaxSupportedVersion: MaxSupportedVolSnapBackupMetaVersion}
+	}
+	return nil
+}
+
+// SnapshotIDs returns the IDs of the volume snapshots of TiKV and TiFlash in the backup meta
+func (m *EBSBasedBRMeta) SnapshotIDs() []string {
+	var stores []*EBSStore
+	if m.TiKVComponent != nil {
+		stores = append(stores, m.TiKVComponent.Stores...)
+	}
+	if m.TiFlashComponent != nil {
+		stores = append(stores, m.TiFlashComponent.Stores...)
+	}
+	var ids []string
+	for _, store := range stores {
+		for _, vol := range store.Volumes {
+			if vol.SnapshotID != "" {
+				ids = append(ids, vol.SnapshotID)
+			}
+		}
+	}
+	return ids
 }
 
 type EC2Session struct {
@@ -111,6 +181,40 @@ type EC2Session struct {
 
 type TagMap map[string]string
 
+// TagResourceError is the error of tagging a single resource, the errors aggregated by AddTags and AddLabels
+// are of this type so the caller knows which resources are not tagged.
+type TagResourceError struct {
+	ResourceID string
+	Op         string
+	Err        error
+}
+
+func (e *TagResourceError) Error() string {
+	return fmt.Sprintf("%s for resource %s: %v", e.Op, e.ResourceID, e.Err)
+}
+
+func (e *TagResourceError) Unwrap() error {
+	return e.Err
+}
+
+// FailedTagResources returns the resources failed to be tagged reported by the error of AddTags or AddLabels.
+// ok is false if the failures are not reported per resource, then none of the resources is known to be tagged.
+func FailedTagResources(err error) (failed map[string]struct{}, ok bool) {
+	agg, ok := err.(errorutils.Aggregate)
+	if !ok {
+		return nil, false
+	}
+	failed = make(map[string]struct{}, len(agg.Errors()))
+	for _, e := range agg.Errors() {
+		tagErr, ok := e.(*TagResourceError)
+		if !ok {
+			return nil, false
+		}
+		failed[tagErr.ResourceID] = struct{}{}
+	}
+	return failed, true
+}
+
 func NewEC2Session(concurrency uint) (*EC2Session, error) {
 	// aws-sdk has builtin exponential backoff retry mechanism, see:
 	// https://github.com/aws/aws-sdk-go/blob/db4388e8b9b19d34dcde76c492b17607cd5651e2/aws/client/default_retryer.go#L12-L16
@@ -137,6 +241,81 @@ func NewEC2Session(concurrency uint) (*EC2Session, error) {
 	return &EC2Session{EC2: ec2Session, concurrency: concurrency}, nil
 }
 
+// NewEC2SessionWithRole creates the EC2 session with the credentials of the assumed role, e.g. the role in the
+// AWS account owning the snapshots of a cross-account restore. The region is the same as NewEC2Session.
+func NewEC2SessionWithRole(concurrency uint, roleARN string) (*EC2Session, error) {
+	awsConfig := aws.NewConfig().WithMaxRetries(9)
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *awsConfig})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	region := os.Getenv(constants.AWSRegionEnv)
+	if region == "" {
+		ec2Metadata := ec2metadata.New(sess)
+		region, err = ec2Metadata.Region()
+		if err != nil {
+			return nil, errors.Annotate(err, "get ec2 region")
+		}
+	}
+
+	creds := stscreds.NewCredentials(sess, roleARN)
+	ec2Session := ec2.New(sess, aws.NewConfig().WithRegion(region).WithCredentials(creds))
+	return &EC2Session{EC2: ec2Session, concurrency: concurrency}, nil
+}
+
+// GetAWSAccountID returns the ID of the AWS account of the credentials of the operator
+func GetAWSAccountID() (string, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *aws.NewConfig().WithMaxRetries(9)})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	output, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errors.Annotate(err, "get caller identity")
+	}
+	return aws.StringValue(output.Account), nil
+}
+
+// ShareSnapshots shares the snapshots with the AWS account by granting it the permission to create volumes from
+// them, at most e.concurrency snapshots are shared at the same time. Sharing a snapshot already shared with the
+// account is a no-op, so a partially failed call can be retried. It returns the number of the shared snapshots
+// and the aggregated errors of the others.
+func (e *EC2Session) ShareSnapshots(snapIDs []string, accountID string) (int, error) {
+	var (
+		mu     sync.Mutex
+		errs   []error
+		shared atomic.Int32
+	)
+	pool := NewWorkerPool(e.concurrency, "share snapshots")
+	eg := new(errgroup.Group)
+	for _, snapID := range snapIDs {
+		id := snapID
+		pool.ApplyOnErrorGroup(eg, func() error {
+			_, err := e.EC2.ModifySnapshotAttribute(&ec2.ModifySnapshotAttributeInput{
+				SnapshotId: aws.String(id),
+				Attribute:  aws.String(ec2.SnapshotAttributeNameCreateVolumePermission),
+				CreateVolumePermission: &ec2.CreateVolumePermissionModifications{
+					Add: []*ec2.CreateVolumePermission{{UserId: aws.String(accountID)}},
+				},
+			})
+			if err != nil {
+				klog.Errorf("failed to share snapshot id=%s with account %s, %v", id, accountID, err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("share snapshot %s: %v", id, err))
+				mu.Unlock()
+			} else {
+				shared.Inc()
+			}
+			// don't return the error to make sure all snapshots get the chance to be shared
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+	return int(shared.Load()), errorutils.NewAggregate(errs)
+}
+
 func (e *EC2Session) DeleteSnapshots(snapIDMap map[string]string) error {
 
 	var deletedCnt atomic.Int32
@@ -165,12 +344,52 @@ func (e *EC2Session) DeleteSnapshots(snapIDMap map[string]string) error {
 	return nil
 }
 
+// DeleteVolumes deletes the volumes, the volumes already deleted are ignored.
+func (e *EC2Session) DeleteVolumes(volIDs []string) error {
+	eg := new(errgroup.Group)
+	for _, volID := range volIDs {
+		id := volID
+		eg.Go(func() error {
+			_, err := e.EC2.DeleteVolume(&ec2.DeleteVolumeInput{
+				VolumeId: aws.String(id),
+			})
+			if err != nil {
+				if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidVolume.NotFound" {
+					return nil
+				}
+				klog.Errorf("failed to delete volume id=%s, %v", id, err)
+				return err
+			}
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
+
+// AddTags adds the tags to the resources, at most e.concurrency resources are tagged at the same time.
+// The resources already having all of their tags are skipped, so a partially failed call can be retried
+// without tagging the resources again. The errors of all resources are aggregated.
 func (e *EC2Session) AddTags(resourcesTags map[string]TagMap) error {
+	existingTags, err := e.describeTags(resourcesTags)
+	if err != nil {
+		// tagging is idempotent, just tag all of the resources
+		klog.Warningf("failed to describe tags of resources, all resources will be tagged, %v", err)
+	}
 
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	pool := NewWorkerPool(e.concurrency, "add tags")
 	eg := new(errgroup.Group)
 	for resourceID := range resourcesTags {
 		id := resourceID
 		tagMap := resourcesTags[resourceID]
+		if existingTags[id].contains(tagMap) {
+			klog.V(4).Infof("resource id=%s is already tagged, skip it", id)
+			continue
+		}
 		var tags []*ec2.Tag
 		for tag := range tagMap {
 			tagKey := tag
@@ -184,23 +403,80 @@ func (e *EC2Session) AddTags(resourcesTags map[string]TagMap) error {
 			Tags:      tags,
 		}
 
-		eg.Go(func() error {
+		pool.ApplyOnErrorGroup(eg, func() error {
 			_, err := e.EC2.CreateTags(input)
 			if err != nil {
 				klog.Errorf("failed to create tags for resource id=%s, %v", id, err)
-				return err
+				mu.Lock()
+				errs = append(errs, &TagResourceError{ResourceID: id, Op: "create tags", Err: err})
+				mu.Unlock()
 			}
+			// don't return the error to make sure all resources get the chance to be tagged
 			return nil
 		})
 	}
 
-	if err := eg.Wait(); err != nil {
-		klog.Errorf("failed to create tags for all resources")
-		return err
+	_ = eg.Wait()
+	if len(errs) > 0 {
+		klog.Errorf("failed to create tags for %d of %d resources", len(errs), len(resourcesTags))
+		return errorutils.NewAggregate(errs)
 	}
 	return nil
 }
 
+// describeTags returns the existing tags of the resources whose keys are in resourcesTags
+func (e *EC2Session) describeTags(resourcesTags map[string]TagMap) (map[string]TagMap, error) {
+	var ids, keys []*string
+	keySet := make(map[string]struct{})
+	for id, tagMap := range resourcesTags {
+		ids = append(ids, aws.String(id))
+		for key := range tagMap {
+			if _, ok := keySet[key]; !ok {
+				keySet[key] = struct{}{}
+				keys = append(keys, aws.String(key))
+			}
+		}
+	}
+
+	existingTags := make(map[string]TagMap)
+	for start := 0; start < len(ids); start += describeTagsFilterSize {
+		end := start + describeTagsFilterSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		input := &ec2.DescribeTagsInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("resource-id"), Values: ids[start:end]},
+				{Name: aws.String("key"), Values: keys},
+			},
+		}
+		err := e.EC2.DescribeTagsPages(input, func(output *ec2.DescribeTagsOutput, _ bool) bool {
+			for _, tag := range output.Tags {
+				id := aws.StringValue(tag.ResourceId)
+				if existingTags[id] == nil {
+					existingTags[id] = make(TagMap)
+				}
+				existingTags[id][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return existingTags, nil
+}
+
+// contains returns true if m has all of the tags with the same values
+func (m TagMap) contains(tags TagMap) bool {
+	for key, value := range tags {
+		if v, ok := m[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
 type EBSSession struct {
 	EBS ebsiface.EBSAPI
 	// aws operation concurrency
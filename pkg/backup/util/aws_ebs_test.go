@@ -0,0 +1,167 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	. "github.com/onsi/gomega"
+)
+
+type fakeEC2 struct {
+	ec2iface.EC2API
+
+	mu         sync.Mutex
+	tags       map[string]TagMap
+	failed     map[string]bool
+	created    []string
+	running    int
+	maxRunning int
+}
+
+func (f *fakeEC2) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	id := aws.StringValue(input.Resources[0])
+	f.mu.Lock()
+	f.running++
+	if f.running > f.maxRunning {
+		f.maxRunning = f.running
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, id)
+	if f.failed[id] {
+		return nil, fmt.Errorf("request limit exceeded")
+	}
+	if f.tags[id] == nil {
+		f.tags[id] = make(TagMap)
+	}
+	for _, tag := range input.Tags {
+		f.tags[id][aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (f *fakeEC2) DescribeTagsPages(input *ec2.DescribeTagsInput, fn func(*ec2.DescribeTagsOutput, bool) bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	output := &ec2.DescribeTagsOutput{}
+	for _, id := range input.Filters[0].Values {
+		for key, value := range f.tags[aws.StringValue(id)] {
+			output.Tags = append(output.Tags, &ec2.TagDescription{
+				ResourceId: id,
+				Key:        aws.String(key),
+				Value:      aws.String(value),
+			})
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func (f *fakeEC2) ModifySnapshotAttribute(input *ec2.ModifySnapshotAttributeInput) (*ec2.ModifySnapshotAttributeOutput, error) {
+	id := aws.StringValue(input.SnapshotId)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed[id] {
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	}
+	f.created = append(f.created, id+"@"+aws.StringValue(input.CreateVolumePermission.Add[0].UserId))
+	return &ec2.ModifySnapshotAttributeOutput{}, nil
+}
+
+func TestEC2SessionAddTags(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	resourcesTags := make(map[string]TagMap)
+	for i := 0; i < 50; i++ {
+		resourcesTags[fmt.Sprintf("vol-%d", i)] = TagMap{"CSIVolumeName": fmt.Sprintf("pv-%d", i)}
+	}
+	fake := &fakeEC2{
+		tags:   map[string]TagMap{"vol-0": {"CSIVolumeName": "pv-0"}},
+		failed: map[string]bool{"vol-1": true, "vol-2": true},
+	}
+	session := &EC2Session{EC2: fake, concurrency: 4}
+
+	// the errors of all failed resources are returned, the tagged resource is skipped
+	err := session.AddTags(resourcesTags)
+	g.Expect(err).Should(HaveOccurred())
+	g.Expect(err.Error()).Should(ContainSubstring("vol-1"))
+	g.Expect(err.Error()).Should(ContainSubstring("vol-2"))
+	g.Expect(fake.created).Should(HaveLen(49))
+	g.Expect(fake.created).ShouldNot(ContainElement("vol-0"))
+	g.Expect(fake.maxRunning).Should(BeNumerically("<=", 4))
+
+	// only the failed resources are tagged in retry
+	fake.failed = nil
+	fake.created = nil
+	g.Expect(session.AddTags(resourcesTags)).Should(Succeed())
+	g.Expect(fake.created).Should(ConsistOf("vol-1", "vol-2"))
+	g.Expect(fake.tags).Should(HaveLen(50))
+}
+
+func TestEC2SessionShareSnapshots(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	meta := &EBSBasedBRMeta{
+		TiKVComponent: &TiKVComponent{Stores: []*EBSStore{
+			{StoreID: 1, Volumes: []*EBSVolume{{ID: "vol-1", SnapshotID: "snap-1"}, {ID: "vol-2", SnapshotID: "snap-2"}}},
+		}},
+		TiFlashComponent: &TiFlashComponent{Stores: []*EBSStore{
+			{StoreID: 10, Volumes: []*EBSVolume{{ID: "vol-10", SnapshotID: "snap-10"}}},
+		}},
+	}
+	snapIDs := meta.SnapshotIDs()
+	g.Expect(snapIDs).Should(Equal([]string{"snap-1", "snap-2", "snap-10"}))
+
+	fake := &fakeEC2{failed: map[string]bool{"snap-2": true}}
+	session := &EC2Session{EC2: fake, concurrency: 2}
+	shared, err := session.ShareSnapshots(snapIDs, "123456789012")
+	g.Expect(err).Should(MatchError(ContainSubstring("share snapshot snap-2")))
+	g.Expect(shared).Should(Equal(2))
+	g.Expect(fake.created).Should(ConsistOf("snap-1@123456789012", "snap-10@123456789012"))
+
+	fake.failed = nil
+	shared, err = session.ShareSnapshots(snapIDs, "123456789012")
+	g.Expect(err).Should(Succeed())
+	g.Expect(shared).Should(Equal(3))
+}
+
+func TestEBSBasedBRMetaCheckMetaVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// the meta without the version is of version 1
+	meta := &EBSBasedBRMeta{}
+	g.Expect(json.Unmarshal([]byte(`{"cluster_info": {"cluster_version": "v7.1.0"}}`), meta)).Should(Succeed())
+	g.Expect(meta.GetMetaVersion()).Should(Equal(1))
+	g.Expect(meta.CheckMetaVersion()).Should(Succeed())
+
+	meta.MetaVersion = MaxSupportedVolSnapBackupMetaVersion + 1
+	err := meta.CheckMetaVersion()
+	g.Expect(err).Should(MatchError(ContainSubstring("backup meta version 2 is newer than the max version 1")))
+	g.Expect(IsIncompatibleBackupMetaVersion(fmt.Errorf("read backup meta from backupmeta: %w", err))).Should(BeTrue())
+	g.Expect(IsIncompatibleBackupMetaVersion(fmt.Errorf("read backup meta timeout"))).Should(BeFalse())
+}
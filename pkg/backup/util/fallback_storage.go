@@ -0,0 +1,74 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	corelisterv1 "k8s.io/client-go/listers/core/v1"
+)
+
+// RestoreStorageProviders returns the primary storage and the fallback storages of the restore in the order they
+// are tried, together with their indexes, which are 0 for the primary storage and i+1 for the ith fallback storage.
+// The storage recorded in the status, which the restore job has restored the backup data from, goes first so the
+// rest of the restore keeps using it.
+func RestoreStorageProviders(r *v1alpha1.Restore) ([]v1alpha1.StorageProvider, []int) {
+	providers := make([]v1alpha1.StorageProvider, 0, len(r.Spec.FallbackStorageProviders)+1)
+	providers = append(providers, r.Spec.StorageProvider)
+	providers = append(providers, r.Spec.FallbackStorageProviders...)
+	indexes := make([]int, 0, len(providers))
+	for i := range providers {
+		indexes = append(indexes, i)
+	}
+	if r.Status.StoragePath == "" {
+		return providers, indexes
+	}
+	for i, provider := range providers {
+		if storagePath, err := GetStoragePath(provider); err == nil && storagePath == r.Status.StoragePath {
+			orderedProviders := append([]v1alpha1.StorageProvider{provider}, providers[:i]...)
+			orderedIndexes := append([]int{i}, indexes[:i]...)
+			return append(orderedProviders, providers[i+1:]...), append(orderedIndexes, indexes[i+1:]...)
+		}
+	}
+	return providers, indexes
+}
+
+// StorageEnvPrefix returns the prefix of the storage env of the storage with the index in the restore job,
+// every storage gets its own credentials since the fallback storages may be in other regions or accounts
+func StorageEnvPrefix(index int) string {
+	return fmt.Sprintf("STORAGE_%d_", index)
+}
+
+// GenerateRestoreStorageEnv generates the storage env of the primary storage and the fallback storages of the
+// restore, each prefixed by StorageEnvPrefix, the backup manager switches to the env of the storage it selects
+func GenerateRestoreStorageEnv(ns string, r *v1alpha1.Restore, secretLister corelisterv1.SecretLister) ([]corev1.EnvVar, string, error) {
+	if len(r.Spec.FallbackStorageProviders) == 0 {
+		return nil, "", nil
+	}
+	providers := append([]v1alpha1.StorageProvider{r.Spec.StorageProvider}, r.Spec.FallbackStorageProviders...)
+	var envVars []corev1.EnvVar
+	for i, provider := range providers {
+		storageEnv, reason, err := GenerateStorageCertEnv(ns, r.Spec.UseKMS, provider, secretLister)
+		if err != nil {
+			return nil, reason, fmt.Errorf("storage %d: %v", i, err)
+		}
+		for _, env := range storageEnv {
+			env.Name = StorageEnvPrefix(i) + env.Name
+			envVars = append(envVars, env)
+		}
+	}
+	return envVars, "", nil
+}
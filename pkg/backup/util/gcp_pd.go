@@ -0,0 +1,190 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	errorutils "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// gcpLabelMaxLength is the max length of the key and the value of a GCP label
+const gcpLabelMaxLength = 63
+
+var (
+	// the volume handle of a zonal persistent disk provisioned by the PD CSI driver
+	gcpDiskHandleRegexp = regexp.MustCompile(`^projects/([^/]+)/zones/([^/]+)/disks/([^/]+)$`)
+	// the characters not allowed in a GCP label
+	gcpLabelInvalidCharRegexp = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+// GCPDisksAPI is the subset of the compute disks API used to label and delete the persistent disks
+type GCPDisksAPI interface {
+	Get(ctx context.Context, project, zone, disk string) (*compute.Disk, error)
+	SetLabels(ctx context.Context, project, zone, disk string, req *compute.ZoneSetLabelsRequest) error
+	Delete(ctx context.Context, project, zone, disk string) error
+}
+
+type gcpDisks struct {
+	disks *compute.DisksService
+}
+
+func (d *gcpDisks) Get(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	return d.disks.Get(project, zone, disk).Context(ctx).Do()
+}
+
+func (d *gcpDisks) SetLabels(ctx context.Context, project, zone, disk string, req *compute.ZoneSetLabelsRequest) error {
+	_, err := d.disks.SetLabels(project, zone, disk, req).Context(ctx).Do()
+	return err
+}
+
+func (d *gcpDisks) Delete(ctx context.Context, project, zone, disk string) error {
+	_, err := d.disks.Delete(project, zone, disk).Context(ctx).Do()
+	return err
+}
+
+type GCPSession struct {
+	Disks GCPDisksAPI
+	// gcp operation concurrency
+	concurrency uint
+}
+
+func NewGCPSession(concurrency uint) (*GCPSession, error) {
+	// TiDB Operator need make sure we have the correct permission to call gcp api
+	// through the application default credentials
+	svc, err := compute.NewService(context.Background())
+	if err != nil {
+		return nil, errors.Annotate(err, "create gcp compute service")
+	}
+	return &GCPSession{Disks: &gcpDisks{disks: svc.Disks}, concurrency: concurrency}, nil
+}
+
+// ParseGCPDiskHandle parses the project, zone and name of a zonal persistent disk from its volume handle
+// projects/{project}/zones/{zone}/disks/{name}
+func ParseGCPDiskHandle(handle string) (project, zone, disk string, err error) {
+	m := gcpDiskHandleRegexp.FindStringSubmatch(handle)
+	if m == nil {
+		return "", "", "", fmt.Errorf("invalid volume handle %s, expected projects/{project}/zones/{zone}/disks/{name}", handle)
+	}
+	return m[1], m[2], m[3], nil
+}
+
+// GCPLabelValue converts s to a valid GCP label value, which only contains lowercase letters, digits,
+// underscores and dashes, and is at most 63 characters.
+func GCPLabelValue(s string) string {
+	v := gcpLabelInvalidCharRegexp.ReplaceAllString(strings.ToLower(s), "-")
+	if len(v) > gcpLabelMaxLength {
+		v = v[:gcpLabelMaxLength]
+	}
+	return v
+}
+
+// AddLabels adds the labels to the persistent disks, the disks are keyed by their volume handle.
+// The existing labels of the disks are kept.
+func (g *GCPSession) AddLabels(disksLabels map[string]TagMap) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	addErr := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	pool := NewWorkerPool(g.concurrency, "add labels")
+	eg := new(errgroup.Group)
+	for handle := range disksLabels {
+		handle := handle
+		labels := disksLabels[handle]
+		pool.ApplyOnErrorGroup(eg, func() error {
+			// don't return the error to make sure all disks get the chance to be labeled
+			if err := g.addDiskLabels(handle, labels); err != nil {
+				klog.Errorf("failed to add labels for disk %s, %v", handle, err)
+				addErr(&TagResourceError{ResourceID: handle, Op: "add labels", Err: err})
+			}
+			return nil
+		})
+	}
+
+	_ = eg.Wait()
+	if len(errs) > 0 {
+		klog.Errorf("failed to add labels for %d of %d disks", len(errs), len(disksLabels))
+		return errorutils.NewAggregate(errs)
+	}
+	return nil
+}
+
+func (g *GCPSession) addDiskLabels(handle string, labels TagMap) error {
+	project, zone, name, err := ParseGCPDiskHandle(handle)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	disk, err := g.Disks.Get(ctx, project, zone, name)
+	if err != nil {
+		return err
+	}
+	if TagMap(disk.Labels).contains(labels) {
+		klog.V(4).Infof("disk %s is already labeled, skip it", handle)
+		return nil
+	}
+
+	merged := make(map[string]string, len(disk.Labels)+len(labels))
+	for k, v := range disk.Labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	// the fingerprint makes the update fail if the labels are changed by others in the meantime
+	return g.Disks.SetLabels(ctx, project, zone, name, &compute.ZoneSetLabelsRequest{
+		Labels:           merged,
+		LabelFingerprint: disk.LabelFingerprint,
+	})
+}
+
+// DeleteDisks deletes the persistent disks by their volume handles, the disks already deleted are ignored.
+func (g *GCPSession) DeleteDisks(handles []string) error {
+	pool := NewWorkerPool(g.concurrency, "delete disks")
+	eg := new(errgroup.Group)
+	for _, handle := range handles {
+		handle := handle
+		pool.ApplyOnErrorGroup(eg, func() error {
+			project, zone, name, err := ParseGCPDiskHandle(handle)
+			if err != nil {
+				return err
+			}
+			err = g.Disks.Delete(context.Background(), project, zone, name)
+			if err != nil {
+				if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusNotFound {
+					return nil
+				}
+				return fmt.Errorf("delete disk %s failed, err: %v", handle, err)
+			}
+			klog.Infof("disk %s is deleted", handle)
+			return nil
+		})
+	}
+	return eg.Wait()
+}
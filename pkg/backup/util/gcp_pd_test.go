@@ -0,0 +1,128 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+type fakeGCPDisks struct {
+	mu     sync.Mutex
+	disks  map[string]*compute.Disk
+	set    map[string]*compute.ZoneSetLabelsRequest
+	failed map[string]bool
+}
+
+func (f *fakeGCPDisks) Delete(ctx context.Context, project, zone, disk string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.disks[disk]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound}
+	}
+	delete(f.disks, disk)
+	return nil
+}
+
+func (f *fakeGCPDisks) Get(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.disks[disk]
+	if !ok {
+		return nil, fmt.Errorf("disk %s not found", disk)
+	}
+	return d, nil
+}
+
+func (f *fakeGCPDisks) SetLabels(ctx context.Context, project, zone, disk string, req *compute.ZoneSetLabelsRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed[disk] {
+		return fmt.Errorf("set labels of %s failed", disk)
+	}
+	f.set[disk] = req
+	return nil
+}
+
+func TestGCPSessionAddLabels(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	disks := &fakeGCPDisks{
+		disks: map[string]*compute.Disk{
+			"disk-1": {Labels: map[string]string{"team": "db"}, LabelFingerprint: "fp-1"},
+			"disk-2": {Labels: map[string]string{"csi-volume-name": "pv-2"}, LabelFingerprint: "fp-2"},
+			"disk-3": {LabelFingerprint: "fp-3"},
+		},
+		set:    map[string]*compute.ZoneSetLabelsRequest{},
+		failed: map[string]bool{"disk-3": true},
+	}
+	session := &GCPSession{Disks: disks, concurrency: 2}
+
+	err := session.AddLabels(map[string]TagMap{
+		"projects/p/zones/us-central1-a/disks/disk-1": {"csi-volume-name": "pv-1"},
+		"projects/p/zones/us-central1-a/disks/disk-2": {"csi-volume-name": "pv-2"},
+		"projects/p/zones/us-central1-a/disks/disk-3": {"csi-volume-name": "pv-3"},
+		"projects/p/regions/us-central1/disks/disk-4": {"csi-volume-name": "pv-4"},
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("set labels of disk-3 failed"))
+	g.Expect(err.Error()).To(ContainSubstring("invalid volume handle projects/p/regions/us-central1/disks/disk-4"))
+
+	// the existing labels are kept, and the already labeled disk is skipped
+	g.Expect(disks.set).To(HaveLen(1))
+	g.Expect(disks.set["disk-1"].Labels).To(Equal(map[string]string{"team": "db", "csi-volume-name": "pv-1"}))
+	g.Expect(disks.set["disk-1"].LabelFingerprint).To(Equal("fp-1"))
+}
+
+func TestGCPSessionDeleteDisks(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	disks := &fakeGCPDisks{
+		disks: map[string]*compute.Disk{
+			"disk-1": {},
+			"disk-2": {},
+		},
+	}
+	session := &GCPSession{Disks: disks, concurrency: 2}
+
+	// the disk already deleted is ignored
+	g.Expect(session.DeleteDisks([]string{
+		"projects/p/zones/us-central1-a/disks/disk-1",
+		"projects/p/zones/us-central1-a/disks/disk-3",
+	})).To(Succeed())
+	g.Expect(disks.disks).To(HaveLen(1))
+	g.Expect(disks.disks).To(HaveKey("disk-2"))
+
+	g.Expect(session.DeleteDisks([]string{"disk-2"})).To(HaveOccurred())
+}
+
+func TestGCPLabelValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(GCPLabelValue("basic-tikv-0")).To(Equal("basic-tikv-0"))
+	g.Expect(GCPLabelValue("PVC.Name/1")).To(Equal("pvc-name-1"))
+	g.Expect(GCPLabelValue(strings.Repeat("a", 70))).To(HaveLen(63))
+
+	project, zone, disk, err := ParseGCPDiskHandle("projects/p/zones/us-central1-a/disks/d")
+	g.Expect(err).To(Succeed())
+	g.Expect([]string{project, zone, disk}).To(Equal([]string{"p", "us-central1-a", "d"}))
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gocloud.dev/blob"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// metaCacheMaxEntries is the max number of the cached files, the least recently used one is evicted
+	// when the cache is full, since a backup meta may be hundreds of MB
+	metaCacheMaxEntries = 32
+	// metaCacheTTL is how long a cached file is kept since it's cached
+	metaCacheTTL = 30 * time.Minute
+)
+
+// MetaCache caches the meta files read from the external storage by their storage path. A cached file is
+// reused as long as its version, the ETag or the last modified time and size, is unchanged, so reading it
+// again only costs a HEAD request instead of downloading the whole file. At most metaCacheMaxEntries files
+// are cached, each of them for metaCacheTTL at most.
+// A nil MetaCache reads the files without caching.
+type MetaCache struct {
+	entries *utilcache.LRUExpireCache
+}
+
+type metaCacheEntry struct {
+	version string
+	data    []byte
+}
+
+// NewMetaCache returns an empty MetaCache
+func NewMetaCache() *MetaCache {
+	return &MetaCache{entries: utilcache.NewLRUExpireCache(metaCacheMaxEntries)}
+}
+
+// ReadAll reads the file key under the storage path from the storage backend, the cached content is returned
+// if the file is not changed since it's cached.
+func (c *MetaCache) ReadAll(ctx context.Context, s *StorageBackend, storagePath, key string) ([]byte, error) {
+	if c == nil {
+		return s.ReadAll(ctx, key)
+	}
+	attrs, err := s.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := metaCacheKey(storagePath, key)
+	version := blobVersion(attrs)
+
+	if cached, ok := c.entries.Get(cacheKey); ok {
+		if entry := cached.(metaCacheEntry); entry.version == version {
+			klog.V(4).Infof("read %s from the meta cache, version %s", cacheKey, version)
+			return entry.data, nil
+		}
+	}
+
+	data, err := s.ReadAll(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.entries.Add(cacheKey, metaCacheEntry{version: version, data: data}, metaCacheTTL)
+	return data, nil
+}
+
+// Invalidate drops all the cached files under the storage path
+func (c *MetaCache) Invalidate(storagePath string) {
+	if c == nil {
+		return
+	}
+	prefix := metaCacheKey(storagePath, "")
+	for _, k := range c.entries.Keys() {
+		if strings.HasPrefix(k.(string), prefix) {
+			c.entries.Remove(k)
+		}
+	}
+}
+
+func metaCacheKey(storagePath, key string) string {
+	return strings.TrimSuffix(storagePath, "/") + "/" + key
+}
+
+// blobVersion identifies the content of a blob by the ETag of S3, or the MD5 if the backend provides it,
+// together with the last modified time and the size.
+func blobVersion(attrs *blob.Attributes) string {
+	var etag string
+	var head s3.HeadObjectOutput
+	if attrs.As(&head) && head.ETag != nil {
+		etag = *head.ETag
+	} else if len(attrs.MD5) != 0 {
+		etag = hex.EncodeToString(attrs.MD5)
+	}
+	return fmt.Sprintf("%s-%d-%d", etag, attrs.ModTime.UnixNano(), attrs.Size)
+}
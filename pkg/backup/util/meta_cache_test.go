@@ -0,0 +1,92 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMetaCache(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	provider := v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume:      corev1.Volume{Name: "local"},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+		},
+	}
+	s, err := NewStorageBackend(provider, &StorageCredential{})
+	g.Expect(err).Should(gomega.Succeed())
+	defer s.Close()
+	storagePath, err := GetStoragePath(provider)
+	g.Expect(err).Should(gomega.Succeed())
+
+	file := filepath.Join(dir, "backupmeta")
+	g.Expect(os.WriteFile(file, []byte("meta-1"), 0644)).Should(gomega.Succeed())
+	modTime := time.Now().Add(-time.Hour)
+	g.Expect(os.Chtimes(file, modTime, modTime)).Should(gomega.Succeed())
+
+	cache := NewMetaCache()
+	data, err := cache.ReadAll(ctx, s, storagePath, "backupmeta")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(string(data)).Should(gomega.Equal("meta-1"))
+
+	// the content is changed behind the same version, the cached content is returned
+	g.Expect(os.WriteFile(file, []byte("meta-2"), 0644)).Should(gomega.Succeed())
+	g.Expect(os.Chtimes(file, modTime, modTime)).Should(gomega.Succeed())
+	data, err = cache.ReadAll(ctx, s, storagePath, "backupmeta")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(string(data)).Should(gomega.Equal("meta-1"))
+
+	// invalidate the storage path
+	cache.Invalidate(storagePath)
+	data, err = cache.ReadAll(ctx, s, storagePath, "backupmeta")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(string(data)).Should(gomega.Equal("meta-2"))
+
+	// the file is rewritten
+	g.Expect(os.WriteFile(file, []byte("meta-3 rewritten"), 0644)).Should(gomega.Succeed())
+	data, err = cache.ReadAll(ctx, s, storagePath, "backupmeta")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(string(data)).Should(gomega.Equal("meta-3 rewritten"))
+
+	// a nil cache reads the file directly
+	var nilCache *MetaCache
+	data, err = nilCache.ReadAll(ctx, s, storagePath, "backupmeta")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(string(data)).Should(gomega.Equal("meta-3 rewritten"))
+	nilCache.Invalidate(storagePath)
+
+	// the least recently used files are evicted if the cache is full
+	for i := 0; i <= metaCacheMaxEntries; i++ {
+		key := fmt.Sprintf("backupmeta.%d", i)
+		g.Expect(os.WriteFile(filepath.Join(dir, key), []byte(key), 0644)).Should(gomega.Succeed())
+		_, err = cache.ReadAll(ctx, s, storagePath, key)
+		g.Expect(err).Should(gomega.Succeed())
+	}
+	g.Expect(cache.entries.Keys()).Should(gomega.HaveLen(metaCacheMaxEntries))
+	_, ok := cache.entries.Get(metaCacheKey(storagePath, "backupmeta.0"))
+	g.Expect(ok).Should(gomega.BeFalse())
+}
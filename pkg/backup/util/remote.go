@@ -15,9 +15,13 @@ package util
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -28,6 +32,7 @@ import (
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -57,6 +62,15 @@ const (
 type StorageCredential struct {
 	//TODO: currently, we do not have better way to unify storage credentials, temp solution using s3 credentials
 	awsCred *credentials.Credentials
+	// caBundle is the PEM encoded CA bundle trusted by the S3 client in addition to the system roots
+	caBundle []byte
+}
+
+// WithCABundle sets the CA bundle trusted in addition to the system roots when connecting to
+// the S3 compatible storage endpoint
+func (c *StorageCredential) WithCABundle(caBundle []byte) *StorageCredential {
+	c.caBundle = caBundle
+	return c
 }
 
 type s3Config struct {
@@ -66,6 +80,7 @@ type s3Config struct {
 	prefix         string
 	provider       string
 	sse            string
+	sseKMSKeyID    string
 	acl            string
 	storageClass   string
 	forcePathStyle bool
@@ -80,6 +95,7 @@ type gcsConfig struct {
 	bucketAcl    string
 	secretName   string
 	prefix       string
+	endpoint     string
 }
 
 type azblobConfig struct {
@@ -151,6 +167,35 @@ func (b *StorageBackend) StorageType() v1alpha1.BackupStorageType {
 	return v1alpha1.BackupStorageTypeUnknown
 }
 
+// CheckAvailable checks whether the storage can be accessed and holds the backup data, which is the object
+// with the key prefix, e.g. the backupmeta of a snapshot backup or the checkpoint dir of a log backup
+func (b *StorageBackend) CheckAvailable(ctx context.Context, keyPrefix string) error {
+	_, err := b.Bucket.List(&blob.ListOptions{Prefix: keyPrefix}).Next(ctx)
+	if err == io.EOF {
+		return fmt.Errorf("%s is not found under bucket %s and prefix %s", keyPrefix, b.GetBucket(), b.GetPrefix())
+	}
+	return err
+}
+
+// TotalObjectSize returns the total size of the objects with the key prefix, e.g. the size of the data dumped
+// by dumpling under the prefix of the storage
+func (b *StorageBackend) TotalObjectSize(ctx context.Context, keyPrefix string) (uint64, error) {
+	var size uint64
+	iter := b.Bucket.List(&blob.ListOptions{Prefix: keyPrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !obj.IsDir {
+			size += uint64(obj.Size)
+		}
+	}
+}
+
 func (b *StorageBackend) ListPage(opts *blob.ListOptions) *PageIterator {
 	return &PageIterator{
 		iter: b.Bucket.List(opts),
@@ -325,6 +370,117 @@ func BatchDeleteObjectsConcurrently(ctx context.Context, bucket *blob.Bucket, ob
 	return result
 }
 
+// ColdStorageObjects is the state of the objects archived in the cold storage tier of S3
+type ColdStorageObjects struct {
+	// Total is the number of the objects in the cold storage tier
+	Total int
+	// Rehydrated is the number of the objects whose temporary copies can be read
+	Rehydrated int
+	// Rehydrating is the number of the objects that are being rehydrated
+	Rehydrating int
+	// Archived are the keys of the objects which are neither rehydrated nor being rehydrated
+	Archived []string
+}
+
+// isS3ColdStorageClass returns true if the objects of the storage class must be rehydrated before they can be read
+func isS3ColdStorageClass(storageClass string) bool {
+	return storageClass == s3.ObjectStorageClassGlacier || storageClass == s3.ObjectStorageClassDeepArchive
+}
+
+// ListColdStorageObjectsOfS3 lists the objects under the prefix which are in the cold storage tier,
+// and checks the rehydration state of them by the `x-amz-restore` header.
+func ListColdStorageObjectsOfS3(ctx context.Context, s3cli s3iface.S3API, bucket string, prefix string, concurrency int) (*ColdStorageObjects, error) {
+	if prefix != "" {
+		prefix = strings.Trim(prefix, "/") + "/"
+	}
+
+	var keys []string
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	err := s3cli.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			if isS3ColdStorageClass(aws.StringValue(obj.StorageClass)) {
+				keys = append(keys, aws.StringValue(obj.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list objects of s3://%s/%s failed, err: %v", bucket, prefix, err)
+	}
+
+	mu := &sync.Mutex{}
+	result := &ColdStorageObjects{Total: len(keys)}
+	var errs []error
+	workqueue.ParallelizeUntil(ctx, concurrency, len(keys), func(piece int) {
+		key := keys[piece]
+		resp, err := s3cli.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("head object s3://%s/%s failed, err: %v", bucket, key, err))
+			return
+		}
+		// the header is absent if the rehydration is never requested or the temporary copy has expired
+		restore := aws.StringValue(resp.Restore)
+		switch {
+		case restore == "":
+			result.Archived = append(result.Archived, key)
+		case strings.Contains(restore, `ongoing-request="true"`):
+			result.Rehydrating++
+		default:
+			result.Rehydrated++
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return result, nil
+}
+
+// RehydrateObjectsOfS3 requests to rehydrate the objects in the cold storage tier, the temporary copies
+// of the objects are kept for the given days. It returns the objects failed to be requested.
+func RehydrateObjectsOfS3(ctx context.Context, s3cli s3iface.S3API, bucket string, keys []string, days int64, tier string, concurrency int) []ObjectError {
+	mu := &sync.Mutex{}
+	var errs []ObjectError
+
+	workqueue.ParallelizeUntil(ctx, concurrency, len(keys), func(piece int) {
+		key := keys[piece]
+		_, err := s3cli.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			RestoreRequest: &s3.RestoreRequest{
+				Days: aws.Int64(days),
+				GlacierJobParameters: &s3.GlacierJobParameters{
+					Tier: aws.String(tier),
+				},
+			},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RestoreAlreadyInProgress" {
+			err = nil
+		}
+		if err == nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, ObjectError{
+			Key: key,
+			Err: err,
+		})
+	})
+
+	return errs
+}
+
 func GetStorageCredential(ns string, provider v1alpha1.StorageProvider, secretLister corelisterv1.SecretLister) *StorageCredential {
 	var err error
 	var secret *corev1.Secret
@@ -390,6 +546,38 @@ func GenStorageArgsForFlag(provider v1alpha1.StorageProvider, flag string) ([]st
 	}
 }
 
+// GenLightningDataSource returns the url of the dump in the storage which lightning reads the data from,
+// the options of the s3 storage are set in the query of the url
+func GenLightningDataSource(provider v1alpha1.StorageProvider) (string, error) {
+	st := GetStorageType(provider)
+	switch st {
+	case v1alpha1.BackupStorageTypeS3:
+		conf := makeS3Config(provider.S3, false)
+		query := url.Values{}
+		if conf.region != "" {
+			query.Set("region", conf.region)
+		}
+		if conf.provider != "" {
+			query.Set("provider", conf.provider)
+		}
+		if conf.endpoint != "" {
+			query.Set("endpoint", conf.endpoint)
+		}
+		query.Set("force-path-style", strconv.FormatBool(conf.forcePathStyle))
+		return fmt.Sprintf("s3://%s?%s", path.Join(conf.bucket, conf.prefix), query.Encode()), nil
+	case v1alpha1.BackupStorageTypeGcs:
+		conf := makeGcsConfig(provider.Gcs, false)
+		if conf.endpoint != "" {
+			query := url.Values{}
+			query.Set("endpoint", conf.endpoint)
+			return fmt.Sprintf("gcs://%s/?%s", path.Join(conf.bucket, conf.prefix), query.Encode()), nil
+		}
+		return fmt.Sprintf("gcs://%s/", path.Join(conf.bucket, conf.prefix)), nil
+	default:
+		return "", fmt.Errorf("storage %s is not supported by lightning", st)
+	}
+}
+
 // newLocalStorageOption constructs `--flag local://$PATH` arg for br
 func newLocalStorageOptionForFlag(conf *localConfig, flag string) ([]string, error) {
 	if flag != "" && flag != defaultStorageFlag {
@@ -422,6 +610,9 @@ func newS3StorageOptionForFlag(conf *s3Config, flag string) []string {
 	if conf.sse != "" {
 		s3options = append(s3options, fmt.Sprintf("--s3.sse=%s", conf.sse))
 	}
+	if conf.sseKMSKeyID != "" {
+		s3options = append(s3options, fmt.Sprintf("--s3.sse-kms-key-id=%s", conf.sseKMSKeyID))
+	}
 	if conf.acl != "" {
 		s3options = append(s3options, fmt.Sprintf("--s3.acl=%s", conf.acl))
 	}
@@ -450,6 +641,13 @@ func newS3Storage(conf *s3Config, cred *StorageCredential) (*blob.Bucket, error)
 
 	if cred != nil {
 		awsConfig.WithCredentials(cred.awsCred)
+		if len(cred.caBundle) > 0 {
+			client, err := newCABundleHTTPClient(cred.caBundle)
+			if err != nil {
+				return nil, err
+			}
+			awsConfig.WithHTTPClient(client)
+		}
 	}
 
 	// awsConfig.WithLogLevel(aws.LogDebugWithSigning)
@@ -470,6 +668,22 @@ func newS3Storage(conf *s3Config, cred *StorageCredential) (*blob.Bucket, error)
 
 }
 
+// newCABundleHTTPClient returns the http client trusting the CA bundle together with the system roots,
+// unlike AWS_CA_BUNDLE which replaces the system roots
+func newCABundleHTTPClient(caBundle []byte) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		klog.Warningf("load the system root CAs failed, only the CA bundle is trusted, err: %v", err)
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caBundle) {
+		return nil, errors.New("no certificate is found in the CA bundle")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Transport: transport}, nil
+}
+
 // newGcsStorage initialize a new gcs storage
 func newGcsStorage(conf *gcsConfig) (*blob.Bucket, error) {
 	ctx := context.Background()
@@ -627,6 +841,9 @@ func newGcsStorageOptionForFlag(conf *gcsConfig, flag string) []string {
 	if conf.objectAcl != "" {
 		gcsoptions = append(gcsoptions, fmt.Sprintf("--gcs.predefined-acl=%s", conf.objectAcl))
 	}
+	if conf.endpoint != "" {
+		gcsoptions = append(gcsoptions, fmt.Sprintf("--gcs.endpoint=%s", conf.endpoint))
+	}
 	return gcsoptions
 }
 
@@ -660,6 +877,7 @@ func makeS3Config(s3 *v1alpha1.S3StorageProvider, fakeRegion bool) *s3Config {
 	conf.prefix = fields[1]
 	conf.endpoint = s3.Endpoint
 	conf.sse = s3.SSE
+	conf.sseKMSKeyID = s3.SSEKMSKeyID
 	conf.acl = s3.Acl
 	conf.storageClass = s3.StorageClass
 	conf.forcePathStyle = true
@@ -691,6 +909,7 @@ func makeGcsConfig(gcs *v1alpha1.GcsStorageProvider, fakeRegion bool) *gcsConfig
 	conf.bucketAcl = gcs.BucketAcl
 	conf.secretName = gcs.SecretName
 	conf.prefix = fields[1]
+	conf.endpoint = gcs.Endpoint
 
 	return &conf
 }
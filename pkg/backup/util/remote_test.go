@@ -15,9 +15,14 @@ package util
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,6 +30,7 @@ import (
 
 	gomonkey "github.com/agiledragon/gomonkey/v2"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
@@ -33,18 +39,39 @@ import (
 	"gocloud.dev/blob/driver"
 
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 )
 
 type mockS3Client struct {
 	s3iface.S3API
 
 	deleteObjects func(*s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error)
+	listObjects   func(*s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	headObject    func(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	restoreObject func(*s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error)
 }
 
 func (c *mockS3Client) DeleteObjectsWithContext(_ aws.Context, input *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
 	return c.deleteObjects(input)
 }
 
+func (c *mockS3Client) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	output, err := c.listObjects(input)
+	if err != nil {
+		return err
+	}
+	fn(output, true)
+	return nil
+}
+
+func (c *mockS3Client) HeadObjectWithContext(_ aws.Context, input *s3.HeadObjectInput, _ ...request.Option) (*s3.HeadObjectOutput, error) {
+	return c.headObject(input)
+}
+
+func (c *mockS3Client) RestoreObjectWithContext(_ aws.Context, input *s3.RestoreObjectInput, _ ...request.Option) (*s3.RestoreObjectOutput, error) {
+	return c.restoreObject(input)
+}
+
 func TestPageIterator(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 
@@ -550,6 +577,73 @@ func TestBatchDeleteObjectsOfS3(t *testing.T) {
 	}
 }
 
+func TestColdStorageObjectsOfS3(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	bucket := "test"
+	cli := &mockS3Client{}
+	cli.listObjects = func(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+		g.Expect(*input.Bucket).To(gomega.Equal(bucket))
+		g.Expect(*input.Prefix).To(gomega.Equal("backup/"))
+		return &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				{Key: aws.String("backup/backupmeta"), StorageClass: aws.String(s3.ObjectStorageClassStandard)},
+				{Key: aws.String("backup/1.sst"), StorageClass: aws.String(s3.ObjectStorageClassGlacier)},
+				{Key: aws.String("backup/2.sst"), StorageClass: aws.String(s3.ObjectStorageClassDeepArchive)},
+				{Key: aws.String("backup/3.sst"), StorageClass: aws.String(s3.ObjectStorageClassGlacier)},
+				{Key: aws.String("backup/4.sst"), StorageClass: aws.String(s3.ObjectStorageClassGlacierIr)},
+			},
+		}, nil
+	}
+	cli.headObject = func(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		switch *input.Key {
+		case "backup/1.sst":
+			return &s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)}, nil
+		case "backup/2.sst":
+			return &s3.HeadObjectOutput{Restore: aws.String(`ongoing-request="true"`)}, nil
+		case "backup/3.sst":
+			return &s3.HeadObjectOutput{}, nil
+		}
+		return nil, fmt.Errorf("unexpected key %s", *input.Key)
+	}
+
+	objs, err := ListColdStorageObjectsOfS3(context.Background(), cli, bucket, "/backup/", 2)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(objs).To(gomega.Equal(&ColdStorageObjects{
+		Total:       3,
+		Rehydrated:  1,
+		Rehydrating: 1,
+		Archived:    []string{"backup/3.sst"},
+	}))
+
+	cli.listObjects = func(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+		return nil, fmt.Errorf("access denied")
+	}
+	_, err = ListColdStorageObjectsOfS3(context.Background(), cli, bucket, "backup", 2)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	mu := &sync.Mutex{}
+	requested := map[string]*s3.RestoreRequest{}
+	cli.restoreObject = func(input *s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested[*input.Key] = input.RestoreRequest
+		switch *input.Key {
+		case "backup/2.sst":
+			return nil, awserr.New("RestoreAlreadyInProgress", "in progress", nil)
+		case "backup/3.sst":
+			return nil, fmt.Errorf("access denied")
+		}
+		return &s3.RestoreObjectOutput{}, nil
+	}
+	errs := RehydrateObjectsOfS3(context.Background(), cli, bucket, []string{"backup/1.sst", "backup/2.sst", "backup/3.sst"}, 7, s3.TierBulk, 2)
+	g.Expect(errs).To(gomega.HaveLen(1))
+	g.Expect(errs[0].Key).To(gomega.Equal("backup/3.sst"))
+	g.Expect(requested).To(gomega.HaveLen(3))
+	g.Expect(*requested["backup/1.sst"].Days).To(gomega.Equal(int64(7)))
+	g.Expect(*requested["backup/1.sst"].GlacierJobParameters.Tier).To(gomega.Equal(s3.TierBulk))
+}
+
 func TestBatchDeleteObjectsConcurrently(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 
@@ -629,3 +723,119 @@ func objects(size int) []*blob.ListObject {
 	}
 	return objs
 }
+
+func TestStorageBackendCheckAvailable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	s, err := NewStorageBackend(v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume:      corev1.Volume{Name: "local"},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+		},
+	}, &StorageCredential{})
+	g.Expect(err).Should(gomega.Succeed())
+	defer s.Close()
+
+	g.Expect(s.CheckAvailable(ctx, "backupmeta")).Should(gomega.MatchError(gomega.ContainSubstring("backupmeta is not found")))
+	// the storage holding other data than the backup is not available
+	g.Expect(os.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0644)).Should(gomega.Succeed())
+	g.Expect(s.CheckAvailable(ctx, "backupmeta")).Should(gomega.MatchError(gomega.ContainSubstring("backupmeta is not found")))
+	g.Expect(os.WriteFile(filepath.Join(dir, "backupmeta"), []byte("meta"), 0644)).Should(gomega.Succeed())
+	g.Expect(s.CheckAvailable(ctx, "backupmeta")).Should(gomega.Succeed())
+}
+
+func TestStorageBackendTotalObjectSize(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	s, err := NewStorageBackend(v1alpha1.StorageProvider{
+		Local: &v1alpha1.LocalStorageProvider{
+			Volume:      corev1.Volume{Name: "local"},
+			VolumeMount: corev1.VolumeMount{Name: "local", MountPath: dir},
+		},
+	}, &StorageCredential{})
+	g.Expect(err).Should(gomega.Succeed())
+	defer s.Close()
+
+	size, err := s.TotalObjectSize(ctx, "")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(size).Should(gomega.BeZero())
+	g.Expect(os.WriteFile(filepath.Join(dir, "db.t1.000000000.sql"), make([]byte, 60), 0644)).Should(gomega.Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "db.t2.000000000.sql"), make([]byte, 40), 0644)).Should(gomega.Succeed())
+	size, err = s.TotalObjectSize(ctx, "")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(size).Should(gomega.Equal(uint64(100)))
+	size, err = s.TotalObjectSize(ctx, "db.t1.")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(size).Should(gomega.Equal(uint64(60)))
+}
+
+func TestGenLightningDataSource(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	source, err := GenLightningDataSource(v1alpha1.StorageProvider{
+		S3: &v1alpha1.S3StorageProvider{
+			Provider: v1alpha1.S3StorageProviderTypeCeph,
+			Region:   "us-west-2",
+			Endpoint: "http://10.0.0.1:7480",
+			Bucket:   "dump",
+			Prefix:   "/tidb/2024-01-01/",
+		},
+	})
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(source).Should(gomega.Equal("s3://dump/tidb/2024-01-01?endpoint=http%3A%2F%2F10.0.0.1%3A7480&force-path-style=true&provider=ceph&region=us-west-2"))
+
+	source, err = GenLightningDataSource(v1alpha1.StorageProvider{
+		Gcs: &v1alpha1.GcsStorageProvider{ProjectId: "project", Bucket: "dump", Prefix: "tidb"},
+	})
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(source).Should(gomega.Equal("gcs://dump/tidb/"))
+
+	source, err = GenLightningDataSource(v1alpha1.StorageProvider{
+		Gcs: &v1alpha1.GcsStorageProvider{ProjectId: "project", Bucket: "dump", Prefix: "tidb", Endpoint: "https://storage-vpc.p.googleapis.com"},
+	})
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(source).Should(gomega.Equal("gcs://dump/tidb/?endpoint=https%3A%2F%2Fstorage-vpc.p.googleapis.com"))
+
+	_, err = GenLightningDataSource(v1alpha1.StorageProvider{
+		Azblob: &v1alpha1.AzblobStorageProvider{Container: "dump"},
+	})
+	g.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("storage azblob is not supported by lightning")))
+}
+
+func TestGenGcsStorageArgs(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	provider := v1alpha1.StorageProvider{
+		Gcs: &v1alpha1.GcsStorageProvider{ProjectId: "project", Bucket: "backup", Prefix: "tidb", Endpoint: "https://storage-vpc.p.googleapis.com"},
+	}
+	args, err := GenStorageArgsForFlag(provider, "")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(args).Should(gomega.Equal([]string{"--storage=gcs://backup/tidb/", "--gcs.endpoint=https://storage-vpc.p.googleapis.com"}))
+
+	// only the path is set to the special flag
+	args, err = GenStorageArgsForFlag(provider, "full-backup-storage")
+	g.Expect(err).Should(gomega.Succeed())
+	g.Expect(args).Should(gomega.Equal([]string{"--full-backup-storage=gcs://backup/tidb/"}))
+}
+
+func TestNewCABundleHTTPClient(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	// the server signed by the private CA is trusted
+	client, err := newCABundleHTTPClient(caBundle)
+	g.Expect(err).Should(gomega.Succeed())
+	resp, err := client.Get(srv.URL)
+	g.Expect(err).Should(gomega.Succeed())
+	resp.Body.Close()
+
+	_, err = newCABundleHTTPClient([]byte("not a certificate"))
+	g.Expect(err).Should(gomega.MatchError(gomega.ContainSubstring("no certificate is found")))
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// restoreMetaCompressThreshold is the size from which the restore meta is gzipped before it's written to the
+// external storage, the smaller metas are kept as the plain JSON so they can be read by the older operators
+const restoreMetaCompressThreshold = 1 << 20
+
+// gzipMagic is the header of the gzip stream, the plain JSON restore meta never starts with it
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressRestoreMeta gzips the restore meta output by BR if it's not smaller than restoreMetaCompressThreshold,
+// the restore meta of the clusters with thousands of volumes is large and it's read by the operator many times.
+func CompressRestoreMeta(meta []byte) ([]byte, error) {
+	if len(meta) < restoreMetaCompressThreshold {
+		return meta, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(meta); err != nil {
+		return nil, fmt.Errorf("gzip the restore meta failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("gzip the restore meta failed: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressRestoreMeta returns the JSON of the restore meta, the gzipped meta is detected by its magic bytes
+// and decompressed, the uncompressed meta is returned as it is.
+func DecompressRestoreMeta(meta []byte) ([]byte, error) {
+	if !bytes.HasPrefix(meta, gzipMagic) {
+		return meta, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(meta))
+	if err != nil {
+		return nil, fmt.Errorf("gunzip the restore meta failed: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("gunzip the restore meta failed: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestRestoreMetaCompression(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// the small meta is kept as it is
+	small := []byte(`{"kubernetes":{"pvcs":[]}}`)
+	data, err := CompressRestoreMeta(small)
+	g.Expect(err).To(gomega.Succeed())
+	g.Expect(data).To(gomega.Equal(small))
+	data, err = DecompressRestoreMeta(data)
+	g.Expect(err).To(gomega.Succeed())
+	g.Expect(data).To(gomega.Equal(small))
+
+	// the large meta is gzipped and decompressed transparently
+	large := append([]byte(`{"volumes":"`), bytes.Repeat([]byte("vol-0123456789abcdef,"), restoreMetaCompressThreshold/20)...)
+	large = append(large, []byte(`"}`)...)
+	compressed, err := CompressRestoreMeta(large)
+	g.Expect(err).To(gomega.Succeed())
+	g.Expect(bytes.HasPrefix(compressed, gzipMagic)).To(gomega.BeTrue())
+	g.Expect(len(compressed)).To(gomega.BeNumerically("<", len(large)))
+	data, err = DecompressRestoreMeta(compressed)
+	g.Expect(err).To(gomega.Succeed())
+	g.Expect(data).To(gomega.Equal(large))
+
+	// the corrupted gzip stream
+	_, err = DecompressRestoreMeta(compressed[:len(compressed)/2])
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("gunzip the restore meta failed"))
+}
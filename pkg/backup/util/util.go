@@ -15,20 +15,31 @@ package util
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/Masterminds/semver"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/docker/distribution/reference"
+	"github.com/gogo/protobuf/proto"
+	kvbackup "github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/apis/util/config"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
+	"gocloud.dev/blob"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/wait"
 	corelisterv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/util/retry"
@@ -41,6 +52,27 @@ var (
 	tikvLessThanV408, _ = semver.NewConstraint("<v4.0.8-0")
 	// the first version which supports log backup
 	tikvLessThanV610, _ = semver.NewConstraint("<v6.1.0-0")
+	// the first version of lightning which reads the dump from both s3 and gcs with the storage options in the url
+	lightningLessThanV500, _ = semver.NewConstraint("<v5.0.0-0")
+
+	// kmsKeyARNPattern matches the ARN of an AWS KMS key or alias, e.g.
+	// arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab
+	kmsKeyARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:(key|alias)/[a-zA-Z0-9/_+=,.@-]+$`)
+	// iamRoleARNPattern matches the ARN of an AWS IAM role and captures its account, e.g.
+	// arn:aws:iam::123456789012:role/tidb-backup
+	iamRoleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::([0-9]{12}):role/[a-zA-Z0-9/_+=,.@-]+$`)
+	// awsAccountIDPattern matches the 12 digits ID of an AWS account
+	awsAccountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+)
+
+const (
+	// sseAWSKMS is the server-side encryption with the AWS KMS keys
+	sseAWSKMS = "aws:kms"
+
+	tidbPasswordVolName = "tidb-password"
+
+	// UnsupportedStorageTypeReason is the reason of the storage provider of the type not supported
+	UnsupportedStorageTypeReason = "UnsupportedStorageType"
 )
 
 // CheckAllKeysExistInSecret check if all keys are included in the specific secret
@@ -73,6 +105,9 @@ func generateS3CertEnvVar(s3 *v1alpha1.S3StorageProvider, useKMS bool) ([]corev1
 			return envVars, "InvalidS3Endpoint", fmt.Errorf("ceph endpoint URI %s must start with http://", s3.Endpoint)
 		}
 	case v1alpha1.S3StorageProviderTypeAWS:
+		if reason, err := validateSSEKMSKeyID(s3); err != nil {
+			return envVars, reason, err
+		}
 		// TODO: Check the storage class, if it is not a legal storage class, use the default storage class instead
 		if len(s3.StorageClass) == 0 {
 			// The optional storage class reference https://rclone.org/s3
@@ -105,6 +140,14 @@ func generateS3CertEnvVar(s3 *v1alpha1.S3StorageProvider, useKMS bool) ([]corev1
 			Name:  "AWS_STORAGE_CLASS",
 			Value: s3.StorageClass,
 		},
+		{
+			Name:  "AWS_SSE",
+			Value: s3.SSE,
+		},
+		{
+			Name:  "AWS_SSE_KMS_KEY_ID",
+			Value: s3.SSEKMSKeyID,
+		},
 	}
 
 	if useKMS {
@@ -142,6 +185,21 @@ func generateS3CertEnvVar(s3 *v1alpha1.S3StorageProvider, useKMS bool) ([]corev1
 	return envVars, "", nil
 }
 
+// validateSSEKMSKeyID checks the KMS key of the server-side encryption is a valid key ARN used with aws:kms,
+// so that a malformed key fails the job before BR gets the access denied from the bucket policy
+func validateSSEKMSKeyID(s3 *v1alpha1.S3StorageProvider) (string, error) {
+	if s3.SSEKMSKeyID == "" {
+		return "", nil
+	}
+	if s3.SSE != sseAWSKMS {
+		return "InvalidSSEKMSKeyID", fmt.Errorf("sseKmsKeyId requires sse to be %s, got %q", sseAWSKMS, s3.SSE)
+	}
+	if !kmsKeyARNPattern.MatchString(s3.SSEKMSKeyID) {
+		return "InvalidSSEKMSKeyID", fmt.Errorf("sseKmsKeyId %s is not a valid AWS KMS key ARN", s3.SSEKMSKeyID)
+	}
+	return "", nil
+}
+
 // generateGcsCertEnvVar generate the env info in order to access google cloud storage
 func generateGcsCertEnvVar(gcs *v1alpha1.GcsStorageProvider) ([]corev1.EnvVar, string, error) {
 	if len(gcs.ProjectId) == 0 {
@@ -169,6 +227,19 @@ func generateGcsCertEnvVar(gcs *v1alpha1.GcsStorageProvider) ([]corev1.EnvVar, s
 			Value: gcs.StorageClass,
 		},
 	}
+	if gcs.Endpoint != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "GCS_ENDPOINT",
+			Value: gcs.Endpoint,
+		})
+	}
+	if gcs.RequesterPays {
+		// the requests to the requester pays bucket are billed to the project of GCS_PROJECT_ID
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "GCS_REQUESTER_PAYS",
+			Value: "true",
+		})
+	}
 	if gcs.SecretName != "" {
 		envVars = append(envVars, corev1.EnvVar{
 			Name: "GCS_SERVICE_ACCOUNT_JSON_KEY",
@@ -194,7 +265,13 @@ func generateAzblobCertEnvVar(azblob *v1alpha1.AzblobStorageProvider, useAAD boo
 			Value: azblob.AccessTier,
 		},
 	}
-	if azblob.SecretName != "" {
+	if azblob.UseWorkloadIdentity {
+		// the identity is set by the job builder which mounts the service account token
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "AZURE_STORAGE_ACCOUNT",
+			Value: azblob.StorageAccount,
+		})
+	} else if azblob.SecretName != "" {
 		envVars = append(envVars, []corev1.EnvVar{
 			{
 				Name: "AZURE_STORAGE_ACCOUNT",
@@ -305,7 +382,7 @@ func GenerateStorageCertEnv(ns string, useKMS bool, provider v1alpha1.StoragePro
 	case v1alpha1.BackupStorageTypeAzblob:
 		useAAD := true
 		azblobSecretName := provider.Azblob.SecretName
-		if azblobSecretName != "" {
+		if azblobSecretName != "" && !provider.Azblob.UseWorkloadIdentity {
 			secret, err := secretLister.Secrets(ns).Get(azblobSecretName)
 			if err != nil {
 				err := fmt.Errorf("get azblob secret %s/%s failed, err: %v", ns, azblobSecretName, err)
@@ -332,7 +409,7 @@ func GenerateStorageCertEnv(ns string, useKMS bool, provider v1alpha1.StoragePro
 		return []corev1.EnvVar{}, "", nil
 	default:
 		err := fmt.Errorf("unsupported storage type %s", storageType)
-		return certEnv, "UnsupportedStorageType", err
+		return certEnv, UnsupportedStorageTypeReason, err
 	}
 	return certEnv, reason, nil
 }
@@ -345,20 +422,29 @@ func getPasswordKey(useKMS bool) string {
 	return fmt.Sprintf("%s_%s", constants.BackupManagerEnvVarPrefix, strings.ToUpper(constants.TidbPasswordKey))
 }
 
+// reservedRestoreEnvNames are the env vars set by the operator in the restore job which the env of the restore
+// can't overwrite, overwriting them silently disables the logging of BR or breaks the password of TiDB
+var reservedRestoreEnvNames = []string{"BR_LOG_TO_TERM", getPasswordKey(false), getPasswordKey(true)}
+
+// validateReservedEnv checks the env of the restore doesn't set the reserved env vars
+func validateReservedEnv(ns, name string, env []corev1.EnvVar) error {
+	for _, e := range env {
+		for _, reserved := range reservedRestoreEnvNames {
+			if e.Name == reserved {
+				return fmt.Errorf("env %s is reserved by the operator in spec of %s/%s, the reserved env vars are %s",
+					e.Name, ns, name, strings.Join(reservedRestoreEnvNames, ", "))
+			}
+		}
+	}
+	return nil
+}
+
 // GenerateTidbPasswordEnv generate the password EnvVar
 func GenerateTidbPasswordEnv(ns, tcName, tidbSecretName string, useKMS bool, secretLister corelisterv1.SecretLister) ([]corev1.EnvVar, string, error) {
 	var certEnv []corev1.EnvVar
 	var passwordKey string
-	secret, err := secretLister.Secrets(ns).Get(tidbSecretName)
-	if err != nil {
-		err = fmt.Errorf("backup %s/%s get tidb secret %s failed, err: %v", ns, tcName, tidbSecretName, err)
-		return certEnv, "GetTidbSecretFailed", err
-	}
-
-	keyStr, exist := CheckAllKeysExistInSecret(secret, constants.TidbPasswordKey)
-	if !exist {
-		err = fmt.Errorf("backup %s/%s, tidb secret %s missing password key %s", ns, tcName, tidbSecretName, keyStr)
-		return certEnv, "KeyNotExist", err
+	if reason, err := checkTidbSecret(ns, tcName, tidbSecretName, secretLister); err != nil {
+		return certEnv, reason, err
 	}
 
 	passwordKey = getPasswordKey(useKMS)
@@ -377,6 +463,47 @@ func GenerateTidbPasswordEnv(ns, tcName, tidbSecretName string, useKMS bool, sec
 	return certEnv, "", nil
 }
 
+// GenerateTidbPasswordVolume generates the volume projecting the password of the tidb secret as the file
+// constants.TidbPasswordFile, so that the password doesn't appear in the env of the pod
+func GenerateTidbPasswordVolume(ns, tcName, tidbSecretName string, secretLister corelisterv1.SecretLister) (corev1.Volume, corev1.VolumeMount, string, error) {
+	if reason, err := checkTidbSecret(ns, tcName, tidbSecretName, secretLister); err != nil {
+		return corev1.Volume{}, corev1.VolumeMount{}, reason, err
+	}
+	volume := corev1.Volume{
+		Name: tidbPasswordVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: tidbSecretName,
+				Items: []corev1.KeyToPath{
+					{Key: constants.TidbPasswordKey, Path: constants.TidbPasswordKey},
+				},
+			},
+		},
+	}
+	volumeMount := corev1.VolumeMount{
+		Name:      tidbPasswordVolName,
+		ReadOnly:  true,
+		MountPath: constants.TidbPasswordPath,
+	}
+	return volume, volumeMount, "", nil
+}
+
+// checkTidbSecret checks the tidb secret exists with the password key
+func checkTidbSecret(ns, tcName, tidbSecretName string, secretLister corelisterv1.SecretLister) (string, error) {
+	secret, err := secretLister.Secrets(ns).Get(tidbSecretName)
+	if err != nil {
+		err = fmt.Errorf("backup %s/%s get tidb secret %s failed, err: %v", ns, tcName, tidbSecretName, err)
+		return "GetTidbSecretFailed", err
+	}
+
+	keyStr, exist := CheckAllKeysExistInSecret(secret, constants.TidbPasswordKey)
+	if !exist {
+		err = fmt.Errorf("backup %s/%s, tidb secret %s missing password key %s", ns, tcName, tidbSecretName, keyStr)
+		return "KeyNotExist", err
+	}
+	return "", nil
+}
+
 // GetBackupBucketName return the bucket name for remote storage
 func GetBackupBucketName(backup *v1alpha1.Backup) (string, string, error) {
 	ns := backup.GetNamespace()
@@ -390,7 +517,7 @@ func GetBackupBucketName(backup *v1alpha1.Backup) (string, string, error) {
 	case v1alpha1.BackupStorageTypeGcs:
 		bucketName = backup.Spec.Gcs.Bucket
 	default:
-		return bucketName, "UnsupportedStorageType", fmt.Errorf("backup %s/%s unsupported storage type %s", ns, name, storageType)
+		return bucketName, UnsupportedStorageTypeReason, fmt.Errorf("backup %s/%s unsupported storage type %s", ns, name, storageType)
 	}
 	return bucketName, "", nil
 }
@@ -408,7 +535,7 @@ func GetBackupPrefixName(backup *v1alpha1.Backup) (string, string, error) {
 	case v1alpha1.BackupStorageTypeGcs:
 		prefix = backup.Spec.Gcs.Prefix
 	default:
-		return prefix, "UnsupportedStorageType", fmt.Errorf("backup %s/%s unsupported storage type %s", ns, name, storageType)
+		return prefix, UnsupportedStorageTypeReason, fmt.Errorf("backup %s/%s unsupported storage type %s", ns, name, storageType)
 	}
 	return prefix, "", nil
 }
@@ -442,7 +569,7 @@ func GetBackupDataPath(provider v1alpha1.StorageProvider) (string, string, error
 	case v1alpha1.BackupStorageTypeGcs:
 		backupPath = provider.Gcs.Path
 	default:
-		return backupPath, "UnsupportedStorageType", fmt.Errorf("unsupported storage type %s", storageType)
+		return backupPath, UnsupportedStorageTypeReason, fmt.Errorf("unsupported storage type %s", storageType)
 	}
 	protocolPrefix := fmt.Sprintf("%s://", string(storageType))
 	if strings.HasPrefix(backupPath, protocolPrefix) {
@@ -472,6 +599,10 @@ func ValidateBackup(backup *v1alpha1.Backup, tikvImage string, acrossK8s bool) e
 	ns := backup.Namespace
 	name := backup.Name
 
+	if backup.Spec.Azblob != nil && backup.Spec.Azblob.UseWorkloadIdentity {
+		return fmt.Errorf("azblob useWorkloadIdentity is only supported by restore in spec of %s/%s", ns, name)
+	}
+
 	if backup.Spec.BR == nil {
 		if reason := validateAccessConfig(backup.Spec.From); reason != "" {
 			return fmt.Errorf(reason, ns, name)
@@ -568,14 +699,79 @@ func ValidateRestore(restore *v1alpha1.Restore, tikvImage string, acrossK8s bool
 	ns := restore.Namespace
 	name := restore.Name
 
+	if restore.Spec.TiDBPasswordFromFile && restore.Spec.UseKMS {
+		return fmt.Errorf("tidbPasswordFromFile can't be used together with useKMS in spec of %s/%s", ns, name)
+	}
+
+	if err := validateReservedEnv(ns, name, restore.Spec.Env); err != nil {
+		return err
+	}
+
+	if restore.Spec.BackupManagerImage != "" {
+		if err := ValidateImage(restore.Spec.BackupManagerImage); err != nil {
+			return fmt.Errorf("backupManagerImage is invalid in spec of %s/%s, %v", ns, name, err)
+		}
+	}
+
 	if restore.Spec.BR == nil {
 		if reason := validateAccessConfig(restore.Spec.To); reason != "" {
 			return fmt.Errorf(reason, ns, name)
 		}
-		if restore.Spec.StorageSize == "" {
+		if restore.Spec.Mode == v1alpha1.RestoreModeLogical {
+			if err := validateLogicalRestore(ns, name, restore); err != nil {
+				return err
+			}
+		} else if restore.Spec.StorageSize == "" {
 			return fmt.Errorf("missing StorageSize config in spec of %s/%s", ns, name)
 		}
+		if err := validateTableConcurrency(ns, name, restore); err != nil {
+			return err
+		}
+		if err := validateSessionVariables(ns, name, restore); err != nil {
+			return err
+		}
+		if err := validateImportParallelism(ns, name, restore); err != nil {
+			return err
+		}
+		if len(restore.Spec.FallbackStorageProviders) != 0 {
+			return fmt.Errorf("fallbackStorageProviders is only supported by BR restore in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.Checksum != nil {
+			return fmt.Errorf("checksum is only supported by BR restore in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.JobNamespace != "" && restore.Spec.JobNamespace != ns {
+			return fmt.Errorf("jobNamespace is only supported by BR restore in spec of %s/%s", ns, name)
+		}
+		if len(restore.Spec.PDAddresses) != 0 {
+			return fmt.Errorf("pdAddresses is only supported by BR restore in spec of %s/%s", ns, name)
+		}
+		for _, f := range restoreModeFields {
+			if f.isSet(&restore.Spec) {
+				return fmt.Errorf("%s is only supported by BR restore in spec of %s/%s", f.field, ns, name)
+			}
+		}
 	} else {
+		if len(restore.Spec.TableConcurrency) != 0 {
+			return fmt.Errorf("tableConcurrency is only supported by lightning import, not by BR in spec of %s/%s", ns, name)
+		}
+		if len(restore.Spec.SessionVariables) != 0 {
+			return fmt.Errorf("sessionVariables is only supported by lightning import, not by BR in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.CleanupRestorePVCOnFailure {
+			return fmt.Errorf("cleanupRestorePVCOnFailure is only supported by lightning import, not by BR in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.LightningCheckpoint != nil {
+			return fmt.Errorf("lightningCheckpoint is only supported by lightning import, not by BR in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.ImportParallelism != nil {
+			return fmt.Errorf("importParallelism is only supported by lightning import, not by BR in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.Mode == v1alpha1.RestoreModeLogical {
+			return fmt.Errorf("restoreMode %s is only supported by lightning import, not by BR in spec of %s/%s", restore.Spec.Mode, ns, name)
+		}
+		if err := validateRestoreModeFields(ns, name, restore); err != nil {
+			return err
+		}
 		if !canSkipSetGCLifeTime(tikvImage) {
 			if reason := validateAccessConfig(restore.Spec.To); reason != "" {
 				return fmt.Errorf(reason, ns, name)
@@ -584,6 +780,9 @@ func ValidateRestore(restore *v1alpha1.Restore, tikvImage string, acrossK8s bool
 		if restore.Spec.BR.Cluster == "" {
 			return fmt.Errorf("cluster should be configured for BR in spec of %s/%s", ns, name)
 		}
+		if jobNS := restore.Spec.JobNamespace; jobNS != "" && jobNS != ns && jobNS != restore.Spec.BR.ClusterNamespace {
+			return fmt.Errorf("jobNamespace %s should be the namespace of the restore or the cluster in spec of %s/%s", jobNS, ns, name)
+		}
 
 		if restore.Spec.Type != "" &&
 			restore.Spec.Type != v1alpha1.BackupTypeFull &&
@@ -601,19 +800,20 @@ func ValidateRestore(restore *v1alpha1.Restore, tikvImage string, acrossK8s bool
 		}
 
 		// validate storage providers
-		if restore.Spec.S3 != nil {
-			if err := validateS3(ns, name, restore.Spec.S3); err != nil {
-				return err
-			}
-		} else if restore.Spec.Gcs != nil {
-			if err := validateGcs(ns, name, restore.Spec.Gcs); err != nil {
-				return err
+		if err := validateStorageProvider(ns, name, restore.Spec.StorageProvider); err != nil {
+			return err
+		}
+		for i, provider := range restore.Spec.FallbackStorageProviders {
+			if GetStorageType(provider) == v1alpha1.BackupStorageTypeUnknown {
+				return fmt.Errorf("storage of fallbackStorageProviders[%d] is not configured in spec of %s/%s", i, ns, name)
 			}
-		} else if restore.Spec.Local != nil {
-			if err := validateLocal(ns, name, restore.Spec.Local); err != nil {
-				return err
+			if err := validateStorageProvider(ns, name, provider); err != nil {
+				return fmt.Errorf("fallbackStorageProviders[%d]: %v", i, err)
 			}
 		}
+		if err := validatePDAddresses(ns, name, restore.Spec.PDAddresses); err != nil {
+			return err
+		}
 
 		if restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
 			// only support across k8s now. TODO compatible for single k8s
@@ -621,6 +821,505 @@ func ValidateRestore(restore *v1alpha1.Restore, tikvImage string, acrossK8s bool
 				return errors.New("only support volume snapshot restore across k8s clusters")
 			}
 		}
+
+		if err := validateStoreVolumeMapping(ns, name, restore); err != nil {
+			return err
+		}
+
+		if restore.Spec.VolumeRehearsal && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("volumeRehearsal is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+
+		// the rehearsal only takes place in the restore-volume phase, the other phases would restore the data
+		if restore.Spec.VolumeRehearsal && restore.Spec.FederalVolumeRestorePhase != v1alpha1.FederalVolumeRestoreVolume {
+			return fmt.Errorf("volumeRehearsal is only supported by the %s phase in spec of %s/%s", v1alpha1.FederalVolumeRestoreVolume, ns, name)
+		}
+
+		if restore.Spec.CleanupOrphanedVolumesOnFailure && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("cleanupOrphanedVolumesOnFailure is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+
+		if restore.Spec.Checksum != nil {
+			if restore.Spec.Mode != "" && restore.Spec.Mode != v1alpha1.RestoreModeSnapshot {
+				return fmt.Errorf("checksum is only supported by snapshot restore in spec of %s/%s", ns, name)
+			}
+			if restore.Spec.BR.Checksum != nil {
+				return fmt.Errorf("checksum can't be set together with br.checksum in spec of %s/%s", ns, name)
+			}
+		}
+
+		if restore.Spec.AllowReplicaMismatch && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("allowReplicaMismatch is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+
+		if restore.Spec.AllowMasterKeyRotation && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("allowMasterKeyRotation is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+
+		if restore.Spec.RecoveryPlacement != nil && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("recoveryPlacement is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+
+		if restore.Spec.PDReadyTimeout != nil && restore.Spec.PDReadyTimeout.Duration <= 0 {
+			return fmt.Errorf("pdReadyTimeout %s must be positive in spec of %s/%s", restore.Spec.PDReadyTimeout.Duration, ns, name)
+		}
+
+		if restore.Spec.RestoreTimeout != nil {
+			if restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+				return fmt.Errorf("restoreTimeout is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+			}
+			if restore.Spec.RestoreTimeout.Duration <= 0 {
+				return fmt.Errorf("restoreTimeout %s must be positive in spec of %s/%s", restore.Spec.RestoreTimeout.Duration, ns, name)
+			}
+		}
+
+		if restore.Spec.MetaReadTimeout != nil && restore.Spec.MetaReadTimeout.Duration <= 0 {
+			return fmt.Errorf("metaReadTimeout %s must be positive in spec of %s/%s", restore.Spec.MetaReadTimeout.Duration, ns, name)
+		}
+
+		if restore.Spec.BRVersion != "" {
+			if _, err := semver.NewVersion(restore.Spec.BRVersion); err != nil {
+				return fmt.Errorf("brVersion %s is not a valid version in spec of %s/%s", restore.Spec.BRVersion, ns, name)
+			}
+		}
+
+		if restore.Spec.Mode == v1alpha1.RestoreModePiTR && restore.Spec.PitrRestoredTs != "" {
+			if _, err := config.ParseTSString(restore.Spec.PitrRestoredTs); err != nil {
+				return fmt.Errorf("pitrRestoredTs %s should be a TSO or a timestamp like '2006-01-02 15:04:05' or RFC3339 in spec of %s/%s", restore.Spec.PitrRestoredTs, ns, name)
+			}
+		}
+
+		if size := restore.Spec.TiKVRestartBatchSize; size != nil && *size <= 0 {
+			return fmt.Errorf("tikvRestartBatchSize %d must be positive in spec of %s/%s", *size, ns, name)
+		}
+		if interval := restore.Spec.TiKVRestartBatchInterval; interval != nil && interval.Duration < 0 {
+			return fmt.Errorf("tikvRestartBatchInterval %s must not be negative in spec of %s/%s", interval.Duration, ns, name)
+		}
+		if (restore.Spec.TiKVRestartBatchSize != nil || restore.Spec.TiKVRestartBatchInterval != nil) && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("tikvRestartBatchSize and tikvRestartBatchInterval are only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+		if restore.Spec.WarmupImages && restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("warmupImages is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+		}
+		if len(restore.Spec.TableFilter) != 0 && restore.Spec.Mode == v1alpha1.RestoreModeVolumeSnapshot {
+			return fmt.Errorf("tableFilter is not supported by volume snapshot restore, which restores the whole volumes, in spec of %s/%s", ns, name)
+		}
+
+		if err := validateCanaryChecks(ns, name, restore); err != nil {
+			return err
+		}
+	}
+
+	if err := validateColdStorage(ns, name, restore); err != nil {
+		return err
+	}
+	if err := validateAzblobWorkloadIdentity(ns, name, restore.Spec.Azblob, restore.Spec.Env); err != nil {
+		return err
+	}
+	for _, rule := range restore.Spec.TableFilter {
+		if err := validateTableFilterRule(rule); err != nil {
+			return fmt.Errorf("invalid tableFilter %q in spec of %s/%s, %v", rule, ns, name, err)
+		}
+	}
+	if id := restore.GetCorrelationID(); id != "" {
+		if errs := validation.IsValidLabelValue(id); len(errs) > 0 {
+			return fmt.Errorf("correlation id %s is invalid, %s in spec of %s/%s", id, strings.Join(errs, ", "), ns, name)
+		}
+	}
+	if restore.GetBackoffLimit() < 0 {
+		return fmt.Errorf("backoffLimit %d must not be negative in spec of %s/%s", restore.GetBackoffLimit(), ns, name)
+	}
+	if hook := restore.Spec.PostRestoreHook; hook != nil && hook.Image == "" {
+		return fmt.Errorf("image of postRestoreHook should be configured in spec of %s/%s", ns, name)
+	}
+	if d := restore.Spec.ActiveDeadlineSeconds; d != nil && *d <= 0 {
+		return fmt.Errorf("activeDeadlineSeconds %d should be greater than 0 in spec of %s/%s", *d, ns, name)
+	}
+	if ttl := restore.Spec.TTLSecondsAfterFinished; ttl != nil && *ttl < 0 {
+		return fmt.Errorf("ttlSecondsAfterFinished %d must not be negative in spec of %s/%s", *ttl, ns, name)
+	}
+	return nil
+}
+
+// validateColdStorage validates the configuration to check and rehydrate the backup objects in the cold storage tier
+func validateColdStorage(ns, name string, restore *v1alpha1.Restore) error {
+	if !restore.Spec.CheckColdStorage && restore.Spec.AutoRehydrate == nil {
+		return nil
+	}
+	if restore.Spec.S3 == nil {
+		return fmt.Errorf("checkColdStorage and autoRehydrate are only supported by S3 storage in spec of %s/%s", ns, name)
+	}
+	if rehydrate := restore.Spec.AutoRehydrate; rehydrate != nil {
+		if rehydrate.Days < 0 {
+			return fmt.Errorf("days %d of autoRehydrate must be positive in spec of %s/%s", rehydrate.Days, ns, name)
+		}
+		switch rehydrate.Tier {
+		case "", s3.TierExpedited, s3.TierStandard, s3.TierBulk:
+		default:
+			return fmt.Errorf("tier %s of autoRehydrate is invalid in spec of %s/%s", rehydrate.Tier, ns, name)
+		}
+	}
+	return nil
+}
+
+// validatePDAddresses validates the PD endpoints passed to BR are in the format of host:port
+func validatePDAddresses(ns, name string, addresses []string) error {
+	for i, addr := range addresses {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("pdAddresses[%d] %s should be in the format of host:port in spec of %s/%s, %v", i, addr, ns, name, err)
+		}
+		if net.ParseIP(host) == nil {
+			if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+				return fmt.Errorf("host of pdAddresses[%d] %s is invalid, %s in spec of %s/%s", i, addr, strings.Join(errs, ", "), ns, name)
+			}
+		}
+		portNum, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("port of pdAddresses[%d] %s is not a number in spec of %s/%s", i, addr, ns, name)
+		}
+		if errs := validation.IsValidPortNum(portNum); len(errs) > 0 {
+			return fmt.Errorf("port of pdAddresses[%d] %s is invalid, %s in spec of %s/%s", i, addr, strings.Join(errs, ", "), ns, name)
+		}
+	}
+	return nil
+}
+
+// validateCanaryChecks validates the definitions of the canary checks, whether the tables are present
+// in the backup is checked by the restore job because the backup meta is only read there
+func validateCanaryChecks(ns, name string, restore *v1alpha1.Restore) error {
+	if len(restore.Spec.CanaryChecks) == 0 {
+		return nil
+	}
+	if restore.Spec.Mode != "" && restore.Spec.Mode != v1alpha1.RestoreModeSnapshot {
+		return fmt.Errorf("canaryChecks is only supported by snapshot restore in spec of %s/%s", ns, name)
+	}
+	if restore.Spec.To == nil {
+		return fmt.Errorf("canaryChecks needs `to` to be set in spec of %s/%s", ns, name)
+	}
+	tables := make(map[string]struct{}, len(restore.Spec.CanaryChecks))
+	for _, check := range restore.Spec.CanaryChecks {
+		if check.Database == "" || check.Table == "" {
+			return fmt.Errorf("database and table of canary check must be set in spec of %s/%s", ns, name)
+		}
+		switch check.Type {
+		case "", v1alpha1.CanaryCheckTypeChecksum, v1alpha1.CanaryCheckTypeKVCount:
+		default:
+			return fmt.Errorf("canary check type %s of table %s.%s is invalid in spec of %s/%s", check.Type, check.Database, check.Table, ns, name)
+		}
+		table := strings.ToLower(check.Database + "." + check.Table)
+		if _, ok := tables[table]; ok {
+			return fmt.Errorf("canary check of table %s.%s is duplicated in spec of %s/%s", check.Database, check.Table, ns, name)
+		}
+		tables[table] = struct{}{}
+	}
+	return nil
+}
+
+// restoreModeFields are the fields of the BR restore which are only valid for some restore modes, the valid
+// field sets of the restore modes are:
+//   - snapshot: none of the fields
+//   - pitr: pitrRestoredTs, logRestoreStartTs and pitrFullBackupStorageProvider
+//   - volume-snapshot: volumeAZ, federalVolumeRestorePhase, crossAccountSnapshot and restoreMetaConfigMap
+//
+// The fields set for the other restore modes would be passed to BR as the nonsensical args or ignored silently.
+var restoreModeFields = []struct {
+	field string
+	mode  v1alpha1.RestoreMode
+	isSet func(spec *v1alpha1.RestoreSpec) bool
+}{
+	{"pitrRestoredTs", v1alpha1.RestoreModePiTR, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.PitrRestoredTs != ""
+	}},
+	{"logRestoreStartTs", v1alpha1.RestoreModePiTR, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.LogRestoreStartTs != ""
+	}},
+	{"pitrFullBackupStorageProvider", v1alpha1.RestoreModePiTR, func(spec *v1alpha1.RestoreSpec) bool {
+		return GetStorageType(spec.PitrFullBackupStorageProvider) != v1alpha1.BackupStorageTypeUnknown
+	}},
+	{"volumeAZ", v1alpha1.RestoreModeVolumeSnapshot, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.VolumeAZ != ""
+	}},
+	{"federalVolumeRestorePhase", v1alpha1.RestoreModeVolumeSnapshot, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.FederalVolumeRestorePhase != ""
+	}},
+	{"crossAccountSnapshot", v1alpha1.RestoreModeVolumeSnapshot, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.CrossAccountSnapshot != nil
+	}},
+	{"restoreMetaConfigMap", v1alpha1.RestoreModeVolumeSnapshot, func(spec *v1alpha1.RestoreSpec) bool {
+		return spec.RestoreMetaConfigMap != nil
+	}},
+}
+
+// validateRestoreModeFields rejects the BR restore with the fields which are not valid for its restore mode
+func validateRestoreModeFields(ns, name string, restore *v1alpha1.Restore) error {
+	mode := restore.Spec.Mode
+	switch mode {
+	case "":
+		mode = v1alpha1.RestoreModeSnapshot
+	case v1alpha1.RestoreModeSnapshot, v1alpha1.RestoreModePiTR, v1alpha1.RestoreModeVolumeSnapshot:
+	default:
+		return fmt.Errorf("invalid restoreMode %s for BR in spec of %s/%s", mode, ns, name)
+	}
+
+	for _, f := range restoreModeFields {
+		if f.mode != mode && f.isSet(&restore.Spec) {
+			return fmt.Errorf("%s is only supported by %s restore, not by %s restore in spec of %s/%s", f.field, f.mode, mode, ns, name)
+		}
+	}
+
+	// the restore meta of the volume snapshot backup is read by the operator, which can't access the local volume
+	if mode == v1alpha1.RestoreModeVolumeSnapshot && restore.Spec.Local != nil {
+		return fmt.Errorf("local storage is not supported by volume snapshot restore in spec of %s/%s", ns, name)
+	}
+	if conf := restore.Spec.CrossAccountSnapshot; conf != nil {
+		return validateCrossAccountSnapshot(ns, name, conf)
+	}
+	return nil
+}
+
+// validateCrossAccountSnapshot validates the role and the account to share the snapshots owned by another account
+func validateCrossAccountSnapshot(ns, name string, conf *v1alpha1.CrossAccountSnapshot) error {
+	match := iamRoleARNPattern.FindStringSubmatch(conf.SourceRoleARN)
+	if match == nil {
+		return fmt.Errorf("sourceRoleARN %q of crossAccountSnapshot should be the ARN of an IAM role in spec of %s/%s", conf.SourceRoleARN, ns, name)
+	}
+	if conf.TargetAccountID == "" {
+		return nil
+	}
+	if !awsAccountIDPattern.MatchString(conf.TargetAccountID) {
+		return fmt.Errorf("targetAccountID %q of crossAccountSnapshot should be 12 digits in spec of %s/%s", conf.TargetAccountID, ns, name)
+	}
+	if conf.TargetAccountID == match[1] {
+		return fmt.Errorf("targetAccountID %s of crossAccountSnapshot is the account of sourceRoleARN in spec of %s/%s", conf.TargetAccountID, ns, name)
+	}
+	return nil
+}
+
+func validateStoreVolumeMapping(ns, name string, restore *v1alpha1.Restore) error {
+	if len(restore.Spec.StoreVolumeMapping) == 0 {
+		return nil
+	}
+	if restore.Spec.Mode != v1alpha1.RestoreModeVolumeSnapshot {
+		return fmt.Errorf("storeVolumeMapping is only supported by volume snapshot restore in spec of %s/%s", ns, name)
+	}
+	snapshots := make(map[string]struct{}, len(restore.Spec.StoreVolumeMapping))
+	pvs := make(map[string]struct{}, len(restore.Spec.StoreVolumeMapping))
+	for _, m := range restore.Spec.StoreVolumeMapping {
+		if m.StoreID == 0 || m.SnapshotID == "" || m.TargetPVName == "" {
+			return fmt.Errorf("storeID, snapshotID and targetPVName should be configured for storeVolumeMapping in spec of %s/%s", ns, name)
+		}
+		if _, ok := snapshots[m.SnapshotID]; ok {
+			return fmt.Errorf("snapshot %s is mapped more than once in storeVolumeMapping in spec of %s/%s", m.SnapshotID, ns, name)
+		}
+		snapshots[m.SnapshotID] = struct{}{}
+		if _, ok := pvs[m.TargetPVName]; ok {
+			return fmt.Errorf("pv %s is mapped more than once in storeVolumeMapping in spec of %s/%s", m.TargetPVName, ns, name)
+		}
+		pvs[m.TargetPVName] = struct{}{}
+	}
+	return nil
+}
+
+func validateTableConcurrency(ns, name string, restore *v1alpha1.Restore) error {
+	if len(restore.Spec.TableConcurrency) == 0 {
+		return nil
+	}
+	if len(restore.Spec.TableFilter) != 0 {
+		return fmt.Errorf("tableConcurrency can not be used together with tableFilter in spec of %s/%s", ns, name)
+	}
+	for glob, concurrency := range restore.Spec.TableConcurrency {
+		if strings.HasPrefix(glob, "!") || strings.Count(glob, ".") != 1 {
+			return fmt.Errorf("invalid tableConcurrency glob %q, it should be in the form of 'db.table' in spec of %s/%s", glob, ns, name)
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid tableConcurrency glob %q in spec of %s/%s, %v", glob, ns, name, err)
+		}
+		if concurrency <= 0 {
+			return fmt.Errorf("tableConcurrency of glob %q should be greater than 0 in spec of %s/%s", glob, ns, name)
+		}
+	}
+	return nil
+}
+
+// validateImportParallelism checks the import is sharded across the pods only in logical restore, the pods can't
+// share the restore pvc
+func validateImportParallelism(ns, name string, restore *v1alpha1.Restore) error {
+	if restore.Spec.ImportParallelism == nil {
+		return nil
+	}
+	if restore.GetImportParallelism() < 1 {
+		return fmt.Errorf("importParallelism should be greater than 0 in spec of %s/%s", ns, name)
+	}
+	if restore.GetImportParallelism() == 1 {
+		return nil
+	}
+	if restore.Spec.Mode != v1alpha1.RestoreModeLogical {
+		return fmt.Errorf("importParallelism is only supported by logical restore in spec of %s/%s", ns, name)
+	}
+	// the shards would share the checkpoints in the target cluster
+	if restore.Spec.LightningCheckpoint != nil {
+		return fmt.Errorf("lightningCheckpoint can not be used together with importParallelism in spec of %s/%s", ns, name)
+	}
+	return nil
+}
+
+// validateTableFilterRule checks the syntax of a table filter rule of BR and TiDB Lightning, which is in the form of
+// '[!]schema.table'. Each part is a wildcard pattern, a name quoted by '`', '"' or "'", or a regular expression
+// between '/'. Importing the rules from a file by '@' is not supported because the file is not in the job pod.
+func validateTableFilterRule(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return fmt.Errorf("empty rule")
+	}
+	if strings.HasPrefix(rule, "@") {
+		return fmt.Errorf("importing rules from a file is not supported")
+	}
+	rest, err := parseTableFilterPattern(strings.TrimPrefix(rule, "!"))
+	if err != nil {
+		return fmt.Errorf("invalid schema pattern, %v", err)
+	}
+	if !strings.HasPrefix(rest, ".") {
+		return fmt.Errorf("the schema and the table should be separated by '.'")
+	}
+	rest, err = parseTableFilterPattern(rest[1:])
+	if err != nil {
+		return fmt.Errorf("invalid table pattern, %v", err)
+	}
+	if rest != "" {
+		return fmt.Errorf("unexpected %q after the table pattern", rest)
+	}
+	return nil
+}
+
+// parseTableFilterPattern parses a pattern at the beginning of s and returns the rest of s
+func parseTableFilterPattern(s string) (string, error) {
+	if s == "" || s[0] == '.' {
+		return "", fmt.Errorf("empty pattern")
+	}
+	switch q := s[0]; q {
+	case '/':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '/':
+				if _, err := regexp.Compile(s[1:i]); err != nil {
+					return "", err
+				}
+				return s[i+1:], nil
+			}
+		}
+		return "", fmt.Errorf("unterminated regular expression")
+	case '`', '"', '\'':
+		for i := 1; i < len(s); i++ {
+			if s[i] != q {
+				continue
+			}
+			// the quote is escaped by doubling it
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+			return s[i+1:], nil
+		}
+		return "", fmt.Errorf("unterminated quoted name")
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '.':
+			return s[i:], nil
+		case '\\':
+			if i++; i >= len(s) {
+				return "", fmt.Errorf("dangling escape")
+			}
+		case '[':
+			// ']' right after '[' or '[!' is a literal character in the class
+			j := i + 1
+			if j < len(s) && s[j] == '!' {
+				j++
+			}
+			if j < len(s) && s[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(s[j:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			i = j + end
+		}
+	}
+	return "", nil
+}
+
+// importSessionVariables are the session variables allowed to be set on the import connection of lightning,
+// they only affect the import session and can't change the global behavior of the target cluster or skip
+// the integrity checks of the imported data. The names are matched case-insensitively as TiDB does.
+var importSessionVariables = map[string]struct{}{
+	"tidb_enable_noop_functions":      {},
+	"tidb_dml_batch_size":             {},
+	"tidb_batch_insert":               {},
+	"tidb_distsql_scan_concurrency":   {},
+	"tidb_build_stats_concurrency":    {},
+	"tidb_checksum_table_concurrency": {},
+	"tidb_mem_quota_query":            {},
+	"tidb_constraint_check_in_place":  {},
+	"tidb_skip_utf8_check":            {},
+	"tidb_skip_ascii_check":           {},
+	"time_zone":                       {},
+}
+
+func validateSessionVariables(ns, name string, restore *v1alpha1.Restore) error {
+	seen := make(map[string]string, len(restore.Spec.SessionVariables))
+	for variable := range restore.Spec.SessionVariables {
+		lower := strings.ToLower(variable)
+		if _, ok := importSessionVariables[lower]; !ok {
+			return fmt.Errorf("session variable %s is not allowed to be set for lightning import in spec of %s/%s", variable, ns, name)
+		}
+		if other, ok := seen[lower]; ok {
+			return fmt.Errorf("session variable %s is set twice as %s and %s in spec of %s/%s", lower, other, variable, ns, name)
+		}
+		seen[lower] = variable
+	}
+	return nil
+}
+
+// validateStorageProvider validates the storage configured in the storage provider
+// validateLogicalRestore validates the logical restore, lightning reads the dump from the storage directly,
+// so both the storage and the lightning in the tool image must support it
+func validateLogicalRestore(ns, name string, restore *v1alpha1.Restore) error {
+	st := GetStorageType(restore.Spec.StorageProvider)
+	if st != v1alpha1.BackupStorageTypeS3 && st != v1alpha1.BackupStorageTypeGcs {
+		return fmt.Errorf("storage %s is not supported by logical restore, only s3 and gcs are supported in spec of %s/%s", st, ns, name)
+	}
+	if err := validateStorageProvider(ns, name, restore.Spec.StorageProvider); err != nil {
+		return err
+	}
+	// the lightning checkpoints of the file driver are stored in the restore pvc
+	if cp := restore.Spec.LightningCheckpoint; cp != nil && cp.GetDriver() == v1alpha1.LightningCheckpointDriverFile {
+		return fmt.Errorf("lightningCheckpoint driver %s is not supported by logical restore, only mysql is supported in spec of %s/%s", cp.GetDriver(), ns, name)
+	}
+	if restore.Spec.ToolImage == "" {
+		return nil
+	}
+	if err := ValidateImage(restore.Spec.ToolImage); err != nil {
+		return fmt.Errorf("toolImage is invalid in spec of %s/%s, %v", ns, name, err)
+	}
+	// the version of the image without a semantic version tag, e.g. nightly, can't be checked
+	_, tag := parseTiKVImage(restore.Spec.ToolImage)
+	if v, err := semver.NewVersion(tag); err == nil && lightningLessThanV500.Check(v) {
+		return fmt.Errorf("toolImage %s is not compatible with logical restore, lightning v5.0.0 or later is required in spec of %s/%s", restore.Spec.ToolImage, ns, name)
+	}
+	return nil
+}
+
+func validateStorageProvider(ns, name string, provider v1alpha1.StorageProvider) error {
+	if provider.S3 != nil {
+		return validateS3(ns, name, provider.S3)
+	} else if provider.Gcs != nil {
+		return validateGcs(ns, name, provider.Gcs)
+	} else if provider.Local != nil {
+		return validateLocal(ns, name, provider.Local)
 	}
 	return nil
 }
@@ -654,6 +1353,38 @@ func validateGcs(ns, name string, gcs *v1alpha1.GcsStorageProvider) error {
 	if gcs.Bucket == "" {
 		return fmt.Errorf("bucket should be %s", configuredForBR)
 	}
+
+	if gcs.Endpoint != "" {
+		u, err := url.Parse(gcs.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid gcs endpoint %s is %s", gcs.Endpoint, configuredForBR)
+		}
+		if u.Scheme == "" {
+			return fmt.Errorf("scheme not found in gcs endpoint %s %s", gcs.Endpoint, configuredForBR)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("host not found in gcs endpoint %s %s", gcs.Endpoint, configuredForBR)
+		}
+	}
+	return nil
+}
+
+// validateAzblobWorkloadIdentity validates the workload identity is not configured together with the static keys
+func validateAzblobWorkloadIdentity(ns, name string, azblob *v1alpha1.AzblobStorageProvider, env []corev1.EnvVar) error {
+	if azblob == nil || !azblob.UseWorkloadIdentity {
+		return nil
+	}
+	if azblob.SecretName != "" {
+		return fmt.Errorf("azblob secretName can not be used together with useWorkloadIdentity in spec of %s/%s", ns, name)
+	}
+	for _, e := range env {
+		if e.Name == constants.AzblobAccountKey || e.Name == constants.AzblobClientScrt {
+			return fmt.Errorf("env %s can not be used together with azblob useWorkloadIdentity in spec of %s/%s", e.Name, ns, name)
+		}
+	}
+	if azblob.StorageAccount == "" {
+		return fmt.Errorf("azblob storageAccount should be configured for useWorkloadIdentity in spec of %s/%s", ns, name)
+	}
 	return nil
 }
 
@@ -684,6 +1415,53 @@ func ParseImage(image string) (string, string) {
 	return name, tag
 }
 
+// GetBRImage returns the BR image in the same registry and repository as the TiKV image with the same tag,
+// e.g. `registry.local/pingcap/br:v6.5.0` for `registry.local/pingcap/tikv:v6.5.0`.
+func GetBRImage(tikvImage string) string {
+	name, tag := parseTiKVImage(tikvImage)
+	prefix := "pingcap"
+	if idx := strings.LastIndexByte(name, '/'); idx >= 0 {
+		prefix = name[:idx]
+	}
+	return fmt.Sprintf("%s/br:%s", prefix, tag)
+}
+
+// GetBRImageInRegistry returns the BR image under the registry with the same tag as the TiKV image,
+// e.g. `mirror.local/pingcap/br:v6.5.0` for `mirror.local/pingcap` and `pingcap/tikv:v6.5.0`.
+func GetBRImageInRegistry(registry, tikvImage string) string {
+	_, tag := parseTiKVImage(tikvImage)
+	return fmt.Sprintf("%s/br:%s", strings.TrimSuffix(registry, "/"), tag)
+}
+
+// GetImageWithTag returns the image with its tag or digest replaced by the tag,
+// e.g. `registry.local/pingcap/tikv:v6.5.0` for `registry.local/pingcap/tikv:v6.1.0` and `v6.5.0`.
+func GetImageWithTag(image, tag string) string {
+	name, _ := parseTiKVImage(image)
+	return fmt.Sprintf("%s:%s", name, tag)
+}
+
+// parseTiKVImage returns the name and the tag of the TiKV image, the tag is empty if it can't be derived
+func parseTiKVImage(tikvImage string) (string, string) {
+	name, tag := ParseImage(tikvImage)
+	if strings.ContainsRune(tag, '/') {
+		// the colon is the port of the registry
+		name, tag = tikvImage, ""
+	}
+	if idx := strings.IndexByte(name, '@'); idx >= 0 {
+		// the tag can't be derived from the digest
+		name, tag = name[:idx], ""
+	}
+	return name, tag
+}
+
+// ValidateImage validates the image is a valid docker image reference
+func ValidateImage(image string) error {
+	if _, err := reference.ParseNormalizedNamed(image); err != nil {
+		return fmt.Errorf("invalid image %q: %v", image, err)
+	}
+	return nil
+}
+
 // canSkipSetGCLifeTime returns if setting tikv_gc_life_time can be skipped based on the TiKV version
 func canSkipSetGCLifeTime(image string) bool {
 	_, version := ParseImage(image)
@@ -766,19 +1544,176 @@ func GetOptions(provider v1alpha1.StorageProvider) []string {
 	}
 }
 
-// getVolSnapBackupMetaData get backup metadata from cloud storage
-func GetVolSnapBackupMetaData(r *v1alpha1.Restore, secretLister corelisterv1.SecretLister) (*EBSBasedBRMeta, error) {
-	// since the restore meta is small (~5M), assume 1 minutes is enough
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(time.Minute*1))
+// getVolSnapBackupMetaData get backup metadata from cloud storage, the meta file is read through the cache if it's not nil
+func GetVolSnapBackupMetaData(r *v1alpha1.Restore, cred *StorageCredential, cache *MetaCache) (*EBSBasedBRMeta, error) {
+	metaInfo, location, err := readBackupMeta(r.Spec.StorageProvider, cred, cache, GetMetaReadTimeout(r))
+	if err != nil {
+		return nil, err
+	}
+
+	backupMeta := &EBSBasedBRMeta{}
+	err = json.Unmarshal(metaInfo, backupMeta)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal backup meta from %s, err: %v", location, err)
+	}
+	// the fields of the newer meta may be changed in meaning, so it's refused instead of being read partially
+	if err := backupMeta.CheckMetaVersion(); err != nil {
+		klog.Errorf("restore %s/%s: backup meta version %d from %s is incompatible, the max supported version is %d",
+			r.Namespace, r.Name, backupMeta.GetMetaVersion(), location, MaxSupportedVolSnapBackupMetaVersion)
+		return nil, fmt.Errorf("read backup meta from %s: %w", location, err)
+	}
+	return backupMeta, nil
+}
+
+// IsIncompatibleBackupMetaVersion returns true if the error is caused by the backup meta newer than the operator
+// supports
+func IsIncompatibleBackupMetaVersion(err error) bool {
+	var versionErr *IncompatibleBackupMetaVersionError
+	return errors.As(err, &versionErr)
+}
+
+// GetBRBackupMetaData reads the backup meta written by BR snapshot backup from the storage provider in the timeout,
+// the meta file is read through the cache if it's not nil
+func GetBRBackupMetaData(provider v1alpha1.StorageProvider, cred *StorageCredential, cache *MetaCache, timeout time.Duration) (*kvbackup.BackupMeta, error) {
+	metaInfo, location, err := readBackupMeta(provider, cred, cache, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	backupMeta := &kvbackup.BackupMeta{}
+	err = proto.Unmarshal(metaInfo, backupMeta)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal backup meta from %s, err: %v", location, err)
+	}
+	return backupMeta, nil
+}
+
+// GetLogBackupCheckpointTs reads the global checkpoint ts of the log backup from the storage provider, the log
+// backup can be restored up to it. 0 is returned if log backup hasn't uploaded any checkpoint yet.
+func GetLogBackupCheckpointTs(provider v1alpha1.StorageProvider, cred *StorageCredential) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s, err := NewStorageBackend(provider, cred)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	// every TiKV uploads its checkpoint to {store id}.ts, the global checkpoint is the max of them
+	var checkpoint uint64
+	iter := s.List(&blob.ListOptions{Prefix: constants.LogBackupCheckpointDir + "/"})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("list %s under bucket %s and prefix %s, err: %v", constants.LogBackupCheckpointDir, s.GetBucket(), s.GetPrefix(), err)
+		}
+		if obj.IsDir || !strings.HasSuffix(obj.Key, ".ts") {
+			continue
+		}
+		data, err := s.ReadAll(ctx, obj.Key)
+		if err != nil {
+			return 0, fmt.Errorf("read %s under bucket %s and prefix %s, err: %v", obj.Key, s.GetBucket(), s.GetPrefix(), err)
+		}
+		if len(data) != 8 {
+			return 0, fmt.Errorf("invalid checkpoint file %s with %d bytes, expected 8 bytes", obj.Key, len(data))
+		}
+		if ts := binary.LittleEndian.Uint64(data); ts > checkpoint {
+			checkpoint = ts
+		}
+	}
+	return checkpoint, nil
+}
+
+const (
+	// the field numbers of the file index and the schema index of the backup meta, they are only set in the
+	// backup meta v2 and unknown to the vendored kvproto
+	backupMetaFileIndexField   = 13
+	backupMetaSchemaIndexField = 14
+)
+
+// IsBRBackupMetaV2 returns whether the backup meta is in the v2 format, which stores the files and the
+// schemas in other meta files referred by the indexes, so they are empty in the backup meta itself
+func IsBRBackupMetaV2(meta *kvbackup.BackupMeta) bool {
+	b := meta.XXX_unrecognized
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return false
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&0x7
+		if field == backupMetaFileIndexField || field == backupMetaSchemaIndexField {
+			return true
+		}
+		switch wireType {
+		case 0: // varint
+			_, n = binary.Uvarint(b)
+		case 1: // 64-bit
+			n = 8
+		case 2: // length-delimited
+			l, m := binary.Uvarint(b)
+			if m <= 0 {
+				return false
+			}
+			n = m + int(l)
+		case 5: // 32-bit
+			n = 4
+		default:
+			return false
+		}
+		if n <= 0 || n > len(b) {
+			return false
+		}
+		b = b[n:]
+	}
+	return false
+}
+
+// GetBRBackupDataSize returns the total size of the kv data recorded in the BR backup meta,
+// it is the size of data written into one replica after restore.
+func GetBRBackupDataSize(meta *kvbackup.BackupMeta) uint64 {
+	var total uint64
+	for _, file := range meta.Files {
+		total += file.TotalBytes
+	}
+	return total
+}
+
+// GetBRBackupClusterVersion returns the version of the cluster the BR backup is taken from,
+// it is empty if the version is not recorded in the backup meta.
+func GetBRBackupClusterVersion(meta *kvbackup.BackupMeta) string {
+	return strings.Trim(strings.TrimSpace(meta.ClusterVersion), `"`)
+}
+
+// GetMetaReadTimeout returns the timeout of reading the backup meta and the restore meta of the restore
+func GetMetaReadTimeout(r *v1alpha1.Restore) time.Duration {
+	if r.Spec.MetaReadTimeout != nil {
+		return r.Spec.MetaReadTimeout.Duration
+	}
+	return constants.DefaultMetaReadTimeout
+}
+
+// readBackupMeta reads the raw backup meta file from the storage provider, the retries of the read are bounded
+// by the timeout, it also returns the location of the meta file for logging.
+func readBackupMeta(provider v1alpha1.StorageProvider, cred *StorageCredential, cache *MetaCache, timeout time.Duration) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	klog.Infof("read the backup meta from external storage")
-	cred := GetStorageCredential(r.Namespace, r.Spec.StorageProvider, secretLister)
-	s, err := NewStorageBackend(r.Spec.StorageProvider, cred)
+	s, err := NewStorageBackend(provider, cred)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer s.Close()
+	location := fmt.Sprintf("bucket %s and prefix %s", s.GetBucket(), s.GetPrefix())
+	storagePath, err := GetStoragePath(provider)
+	if err != nil {
+		return nil, location, err
+	}
 
 	var metaInfo []byte
 	// use exponential backoff, every retry duration is duration * factor ^ (used_step - 1)
@@ -796,7 +1731,7 @@ func GetVolSnapBackupMetaData(r *v1alpha1.Restore, secretLister corelisterv1.Sec
 		if !exist {
 			return fmt.Errorf("%s not exist", constants.MetaFile)
 		}
-		metaInfo, err = s.ReadAll(ctx, constants.MetaFile)
+		metaInfo, err = cache.ReadAll(ctx, s, storagePath, constants.MetaFile)
 		if err != nil {
 			return err
 		}
@@ -807,13 +1742,7 @@ func GetVolSnapBackupMetaData(r *v1alpha1.Restore, secretLister corelisterv1.Sec
 	}
 	err = retry.OnError(backoff, isRetry, readBackupMeta)
 	if err != nil {
-		return nil, fmt.Errorf("read backup meta from bucket %s and prefix %s, err: %v", s.GetBucket(), s.GetPrefix(), err)
+		return nil, location, fmt.Errorf("read backup meta from %s, err: %v", location, err)
 	}
-
-	backupMeta := &EBSBasedBRMeta{}
-	err = json.Unmarshal(metaInfo, backupMeta)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal backup meta from bucket %s and prefix %s, err: %v", s.GetBucket(), s.GetPrefix(), err)
-	}
-	return backupMeta, nil
+	return metaInfo, location, nil
 }
@@ -15,16 +15,21 @@ package util
 
 import (
 	"context"
+	"path"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gogo/protobuf/proto"
 	. "github.com/onsi/gomega"
+	kvbackup "github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/backup/constants"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
 )
 
 func TestCheckAllKeysExistInSecret(t *testing.T) {
@@ -114,6 +119,24 @@ func TestGenerateS3CertEnvVar(t *testing.T) {
 	s3.Provider = v1alpha1.S3StorageProviderTypeAWS
 	_, _, err = generateS3CertEnvVar(s3, true)
 	g.Expect(err).Should(BeNil())
+
+	// test the KMS key of the server-side encryption
+	s3.SSEKMSKeyID = "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	_, reason, err := generateS3CertEnvVar(s3, false)
+	g.Expect(err).ShouldNot(BeNil())
+	g.Expect(reason).Should(Equal("InvalidSSEKMSKeyID"))
+	s3.SSE = "aws:kms"
+	envs, _, err = generateS3CertEnvVar(s3, false)
+	g.Expect(err).Should(BeNil())
+	contains(envs, "AWS_SSE", "aws:kms")
+	contains(envs, "AWS_SSE_KMS_KEY_ID", s3.SSEKMSKeyID)
+	s3.SSEKMSKeyID = "arn:aws-cn:kms:cn-north-1:123456789012:alias/backup"
+	_, _, err = generateS3CertEnvVar(s3, false)
+	g.Expect(err).Should(BeNil())
+	s3.SSEKMSKeyID = "1234abcd-12ab-34cd-56ef-1234567890ab"
+	_, reason, err = generateS3CertEnvVar(s3, false)
+	g.Expect(err).ShouldNot(BeNil())
+	g.Expect(reason).Should(Equal("InvalidSSEKMSKeyID"))
 }
 
 func TestGetPasswordKey(t *testing.T) {
@@ -147,6 +170,17 @@ func TestGenerateGcsCertEnvVar(t *testing.T) {
 	envs, _, err := generateGcsCertEnvVar(gcs)
 	g.Expect(err).Should(BeNil())
 	g.Expect(len(envs)).ShouldNot(Equal(0))
+	g.Expect(envs).ShouldNot(ContainElement(corev1.EnvVar{Name: "GCS_REQUESTER_PAYS", Value: "true"}))
+
+	// test requester pays bucket behind a custom endpoint
+	gcs.Endpoint = "https://storage-vpc.p.googleapis.com"
+	gcs.RequesterPays = true
+	envs, _, err = generateGcsCertEnvVar(gcs)
+	g.Expect(err).Should(BeNil())
+	g.Expect(envs).Should(ContainElements(
+		corev1.EnvVar{Name: "GCS_ENDPOINT", Value: "https://storage-vpc.p.googleapis.com"},
+		corev1.EnvVar{Name: "GCS_REQUESTER_PAYS", Value: "true"},
+	))
 }
 
 func TestGenerateAzblobCertEnvVar(t *testing.T) {
@@ -349,6 +383,30 @@ func TestGenerateTidbPasswordEnv(t *testing.T) {
 	g.Expect(len(envs)).ShouldNot(Equal(0))
 }
 
+func TestGenerateTidbPasswordVolume(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ns := "ns"
+	secretName := "secretName"
+	client := fake.NewSimpleClientset()
+	informer := kubeinformers.NewSharedInformerFactory(client, 0)
+	_, _, reason, err := GenerateTidbPasswordVolume(ns, "tctest", secretName, informer.Core().V1().Secrets().Lister())
+	g.Expect(err).ShouldNot(BeNil())
+	g.Expect(reason).Should(Equal("GetTidbSecretFailed"))
+
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: secretName},
+		Data:       map[string][]byte{constants.TidbPasswordKey: []byte("dummy")},
+	}
+	err = informer.Core().V1().Secrets().Informer().GetIndexer().Add(s)
+	g.Expect(err).Should(BeNil())
+	volume, volumeMount, _, err := GenerateTidbPasswordVolume(ns, "tctest", secretName, informer.Core().V1().Secrets().Lister())
+	g.Expect(err).Should(BeNil())
+	g.Expect(volume.Secret.SecretName).Should(Equal(secretName))
+	g.Expect(volume.Secret.Items).Should(Equal([]corev1.KeyToPath{{Key: constants.TidbPasswordKey, Path: constants.TidbPasswordKey}}))
+	g.Expect(volumeMount.Name).Should(Equal(volume.Name))
+	g.Expect(path.Join(volumeMount.MountPath, constants.TidbPasswordKey)).Should(Equal(constants.TidbPasswordFile))
+}
+
 func TestGetBackupBucketAdnPrefixName(t *testing.T) {
 	g := NewGomegaWithT(t)
 
@@ -521,6 +579,10 @@ func TestValidateBackup(t *testing.T) {
 
 	backup.Spec.S3.Endpoint = "s3://localhost:80"
 	match("")
+
+	backup.Spec.Azblob = &v1alpha1.AzblobStorageProvider{UseWorkloadIdentity: true}
+	match("azblob useWorkloadIdentity is only supported by restore")
+	backup.Spec.Azblob = nil
 }
 
 func TestValidateRestore(t *testing.T) {
@@ -538,6 +600,24 @@ func TestValidateRestore(t *testing.T) {
 		}
 	}
 
+	restore.Spec.TiDBPasswordFromFile = true
+	restore.Spec.UseKMS = true
+	match("tidbPasswordFromFile can't be used together with useKMS")
+	restore.Spec.TiDBPasswordFromFile = false
+	restore.Spec.UseKMS = false
+
+	restore.Spec.Env = []corev1.EnvVar{{Name: "S3_PROVIDER", Value: "ceph"}, {Name: "BR_LOG_TO_TERM", Value: "0"}}
+	match("env BR_LOG_TO_TERM is reserved by the operator")
+	restore.Spec.Env = []corev1.EnvVar{{Name: "KMS_ENCRYPTED_BACKUP_MANAGER_PASSWORD", Value: "pass"}}
+	match("env KMS_ENCRYPTED_BACKUP_MANAGER_PASSWORD is reserved by the operator")
+	restore.Spec.Env = nil
+
+	restore.Spec.BackupManagerImage = "pingcap/tidb-backup-manager:v1.5.0:fix"
+	match("backupManagerImage is invalid")
+	restore.Spec.BackupManagerImage = "registry.local/pingcap/tidb-backup-manager:v1.5.0-fix"
+	match("missing cluster config in spec of")
+	restore.Spec.BackupManagerImage = ""
+
 	// BR == nil case
 	match("missing cluster config in spec of")
 
@@ -550,8 +630,139 @@ func TestValidateRestore(t *testing.T) {
 	restore.Spec.StorageSize = "1m"
 	match("")
 
+	restore.Spec.TableConcurrency = map[string]int{"db": 8}
+	match("invalid tableConcurrency glob")
+	restore.Spec.TableConcurrency = map[string]int{"db.[": 8}
+	match("invalid tableConcurrency glob")
+	restore.Spec.TableConcurrency = map[string]int{"db.big_*": 0}
+	match("should be greater than 0")
+	restore.Spec.TableConcurrency = map[string]int{"db.big_*": 8}
+	restore.Spec.TableFilter = []string{"db.*"}
+	match("can not be used together with tableFilter")
+	restore.Spec.TableFilter = nil
+	match("")
+
+	restore.Spec.SessionVariables = map[string]string{"tidb_dml_batch_size": "100", "tidb_gc_life_time": "72h"}
+	match("session variable tidb_gc_life_time is not allowed to be set")
+	delete(restore.Spec.SessionVariables, "tidb_gc_life_time")
+	match("")
+	restore.Spec.SessionVariables["FOREIGN_KEY_CHECKS"] = "OFF"
+	match("session variable FOREIGN_KEY_CHECKS is not allowed to be set")
+	delete(restore.Spec.SessionVariables, "FOREIGN_KEY_CHECKS")
+	restore.Spec.SessionVariables["TiDB_DML_Batch_Size"] = "200"
+	match("session variable tidb_dml_batch_size is set twice")
+	delete(restore.Spec.SessionVariables, "TiDB_DML_Batch_Size")
+	restore.Spec.SessionVariables["Time_Zone"] = "UTC"
+	match("")
+	delete(restore.Spec.SessionVariables, "Time_Zone")
+
+	restore.Annotations = map[string]string{"tidb.pingcap.com/correlation-id": "dr/2024-01"}
+	match("correlation id dr/2024-01 is invalid")
+	restore.Spec.CorrelationID = "dr-2024-01"
+	match("")
+	restore.Annotations = nil
+	restore.Spec.CorrelationID = strings.Repeat("a", 64)
+	match("correlation id " + restore.Spec.CorrelationID + " is invalid")
+	restore.Spec.CorrelationID = ""
+
+	restore.Spec.BackoffLimit = pointer.Int32Ptr(-1)
+	match("backoffLimit -1 must not be negative")
+	restore.Spec.BackoffLimit = pointer.Int32Ptr(3)
+	match("")
+	restore.Spec.BackoffLimit = nil
+	restore.Spec.PostRestoreHook = &corev1.Container{Name: "analyze"}
+	match("image of postRestoreHook should be configured")
+	restore.Spec.PostRestoreHook.Image = "mysql:8.0"
+	match("")
+	restore.Spec.PostRestoreHook = nil
+	restore.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(0)
+	match("activeDeadlineSeconds 0 should be greater than 0")
+	restore.Spec.ActiveDeadlineSeconds = nil
+	restore.Spec.TTLSecondsAfterFinished = pointer.Int32Ptr(-1)
+	match("ttlSecondsAfterFinished -1 must not be negative")
+	restore.Spec.TTLSecondsAfterFinished = nil
+
+	restore.Spec.Azblob = &v1alpha1.AzblobStorageProvider{SecretName: "azblob", UseWorkloadIdentity: true}
+	match("azblob secretName can not be used together with useWorkloadIdentity")
+	restore.Spec.Azblob.SecretName = ""
+	match("azblob storageAccount should be configured for useWorkloadIdentity")
+	restore.Spec.Azblob.StorageAccount = "tidbbackup"
+	restore.Spec.Env = []corev1.EnvVar{{Name: "AZURE_STORAGE_KEY", Value: "key"}}
+	match("env AZURE_STORAGE_KEY can not be used together with azblob useWorkloadIdentity")
+	restore.Spec.Env = nil
+	match("")
+	restore.Spec.Azblob = nil
+	restore.Spec.FallbackStorageProviders = []v1alpha1.StorageProvider{{S3: &v1alpha1.S3StorageProvider{Bucket: "fallback"}}}
+	match("fallbackStorageProviders is only supported by BR restore")
+	restore.Spec.FallbackStorageProviders = nil
+	restore.Spec.JobNamespace = "tidb"
+	match("jobNamespace is only supported by BR restore")
+	restore.Spec.JobNamespace = ""
+	restore.Spec.PDAddresses = []string{"pd.example.com:2379"}
+	match("pdAddresses is only supported by BR restore")
+	restore.Spec.PDAddresses = nil
+	restore.Spec.Checksum = pointer.BoolPtr(false)
+	match("checksum is only supported by BR restore")
+	restore.Spec.Checksum = nil
+	restore.Spec.VolumeAZ = "us-west-2a"
+	match("volumeAZ is only supported by BR restore")
+	restore.Spec.VolumeAZ = ""
+
+	// the logical restore reads the dump from s3 or gcs without a restore pvc
+	restore.Spec.Mode = v1alpha1.RestoreModeLogical
+	restore.Spec.StorageSize = ""
+	match("storage unknown is not supported by logical restore")
+	restore.Spec.Azblob = &v1alpha1.AzblobStorageProvider{Container: "dump"}
+	match("storage azblob is not supported by logical restore")
+	restore.Spec.Azblob = nil
+	restore.Spec.S3 = &v1alpha1.S3StorageProvider{}
+	match("bucket should be configured")
+	restore.Spec.S3.Bucket = "dump"
+	match("")
+	restore.Spec.LightningCheckpoint = &v1alpha1.LightningCheckpoint{}
+	match("lightningCheckpoint driver file is not supported by logical restore")
+	restore.Spec.LightningCheckpoint.Driver = v1alpha1.LightningCheckpointDriverMySQL
+	match("")
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(4)
+	match("lightningCheckpoint can not be used together with importParallelism")
+	restore.Spec.LightningCheckpoint = nil
+	match("")
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(0)
+	match("importParallelism should be greater than 0")
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(4)
+	restore.Spec.ToolImage = "pingcap/tidb-lightning:v4.0.16"
+	match("toolImage pingcap/tidb-lightning:v4.0.16 is not compatible with logical restore")
+	restore.Spec.ToolImage = "pingcap/tidb-lightning:v5.4.0"
+	match("")
+	restore.Spec.ToolImage = "pingcap/tidb-lightning:nightly"
+	match("")
+	restore.Spec.ToolImage = ""
+	restore.Spec.S3 = nil
+	restore.Spec.Mode = ""
+	match("missing StorageSize config in spec of")
+	restore.Spec.StorageSize = "1m"
+	match("importParallelism is only supported by logical restore")
+	restore.Spec.ImportParallelism = nil
+
 	// start BR != nil case
 	restore.Spec.BR = &v1alpha1.BRConfig{}
+	match("only supported by lightning import")
+
+	restore.Spec.TableConcurrency = nil
+	match("sessionVariables is only supported by lightning import")
+	restore.Spec.SessionVariables = nil
+	restore.Spec.CleanupRestorePVCOnFailure = true
+	match("cleanupRestorePVCOnFailure is only supported by lightning import")
+	restore.Spec.CleanupRestorePVCOnFailure = false
+	restore.Spec.LightningCheckpoint = &v1alpha1.LightningCheckpoint{}
+	match("lightningCheckpoint is only supported by lightning import")
+	restore.Spec.LightningCheckpoint = nil
+	restore.Spec.ImportParallelism = pointer.Int32Ptr(4)
+	match("importParallelism is only supported by lightning import")
+	restore.Spec.ImportParallelism = nil
+	restore.Spec.Mode = v1alpha1.RestoreModeLogical
+	match("restoreMode logical is only supported by lightning import")
+	restore.Spec.Mode = ""
 	match("cluster should be configured for BR in spec")
 
 	restore.Spec.BR.Cluster = "tidb"
@@ -581,6 +792,269 @@ func TestValidateRestore(t *testing.T) {
 
 	restore.Spec.S3.Endpoint = "s3://localhost:80"
 	match("")
+
+	restore.Spec.JobNamespace = "tidb"
+	match("jobNamespace tidb should be the namespace of the restore or the cluster")
+	restore.Spec.BR.ClusterNamespace = "tidb"
+	match("")
+	restore.Spec.JobNamespace = ""
+	restore.Spec.BR.ClusterNamespace = ""
+
+	restore.Spec.FallbackStorageProviders = []v1alpha1.StorageProvider{{}}
+	match(`storage of fallbackStorageProviders\[0\] is not configured`)
+
+	restore.Spec.FallbackStorageProviders[0].S3 = &v1alpha1.S3StorageProvider{Bucket: "fallback", Endpoint: "localhost"}
+	match(`fallbackStorageProviders\[0\]: scheme not found in endpoint`)
+
+	restore.Spec.FallbackStorageProviders[0].S3.Endpoint = "s3://localhost:81"
+	match("")
+
+	restore.Spec.FallbackStorageProviders = nil
+
+	restore.Spec.PDAddresses = []string{"http://pd.example.com:2379"}
+	match(`pdAddresses\[0\] http://pd.example.com:2379 should be in the format of host:port`)
+	restore.Spec.PDAddresses = []string{"pd.example.com:2379", "PD_LB:2379"}
+	match(`host of pdAddresses\[1\] PD_LB:2379 is invalid`)
+	restore.Spec.PDAddresses = []string{"10.0.0.1:pd"}
+	match(`port of pdAddresses\[0\] 10.0.0.1:pd is not a number`)
+	restore.Spec.PDAddresses = []string{"10.0.0.1:65536"}
+	match(`port of pdAddresses\[0\] 10.0.0.1:65536 is invalid`)
+	restore.Spec.PDAddresses = []string{"pd.example.com:2379", "[fd00::1]:2379"}
+	match("")
+	restore.Spec.PDAddresses = nil
+
+	restore.Spec.Mode = v1alpha1.RestoreMode("full")
+	match("invalid restoreMode full for BR")
+	restore.Spec.Mode = ""
+	restore.Spec.PitrRestoredTs = "439873921245790211"
+	match("pitrRestoredTs is only supported by pitr restore, not by snapshot restore")
+	restore.Spec.PitrRestoredTs = ""
+	restore.Spec.PitrFullBackupStorageProvider.S3 = &v1alpha1.S3StorageProvider{Bucket: "full"}
+	match("pitrFullBackupStorageProvider is only supported by pitr restore")
+	restore.Spec.PitrFullBackupStorageProvider.S3 = nil
+	restore.Spec.Mode = v1alpha1.RestoreModePiTR
+	restore.Spec.VolumeAZ = "us-west-2a"
+	match("volumeAZ is only supported by volume-snapshot restore, not by pitr restore")
+	restore.Spec.VolumeAZ = ""
+	restore.Spec.FederalVolumeRestorePhase = v1alpha1.FederalVolumeRestoreData
+	match("federalVolumeRestorePhase is only supported by volume-snapshot restore")
+	restore.Spec.FederalVolumeRestorePhase = ""
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	restore.Spec.LogRestoreStartTs = "439873921245790211"
+	g.Expect(ValidateRestore(restore, "tikv:v4.0.8", true)).To(MatchError(ContainSubstring("logRestoreStartTs is only supported by pitr restore")))
+	restore.Spec.LogRestoreStartTs = ""
+	restore.Spec.Local = &v1alpha1.LocalStorageProvider{}
+	g.Expect(validateRestoreModeFields("ns", "name", restore)).To(MatchError(ContainSubstring("local storage is not supported by volume snapshot restore")))
+	restore.Spec.Local = nil
+	restore.Spec.CrossAccountSnapshot = &v1alpha1.CrossAccountSnapshot{SourceRoleARN: "arn:aws:iam::123456789012:user/backup"}
+	g.Expect(validateRestoreModeFields("ns", "name", restore)).To(MatchError(ContainSubstring("should be the ARN of an IAM role")))
+	restore.Spec.CrossAccountSnapshot.SourceRoleARN = "arn:aws:iam::123456789012:role/backup"
+	restore.Spec.CrossAccountSnapshot.TargetAccountID = "1234"
+	g.Expect(validateRestoreModeFields("ns", "name", restore)).To(MatchError(ContainSubstring("targetAccountID \"1234\" of crossAccountSnapshot should be 12 digits")))
+	restore.Spec.CrossAccountSnapshot.TargetAccountID = "123456789012"
+	g.Expect(validateRestoreModeFields("ns", "name", restore)).To(MatchError(ContainSubstring("is the account of sourceRoleARN")))
+	restore.Spec.CrossAccountSnapshot.TargetAccountID = "210987654321"
+	g.Expect(validateRestoreModeFields("ns", "name", restore)).To(Succeed())
+	restore.Spec.Mode = ""
+	match("crossAccountSnapshot is only supported by volume-snapshot restore")
+	restore.Spec.CrossAccountSnapshot = nil
+	restore.Spec.RestoreMetaConfigMap = &corev1.LocalObjectReference{Name: "restore-meta"}
+	match("restoreMetaConfigMap is only supported by volume-snapshot restore")
+	restore.Spec.RestoreMetaConfigMap = nil
+	match("")
+
+	restore.Spec.StoreVolumeMapping = []v1alpha1.StoreVolumeMap{
+		{StoreID: 1, SnapshotID: "snap-1", TargetPVName: "pv-1"},
+	}
+	match("only supported by volume snapshot restore")
+
+	// volume snapshot restore is only valid across k8s, validate the mapping directly
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	g.Expect(validateStoreVolumeMapping("ns", "name", restore)).To(Succeed())
+	restore.Spec.StoreVolumeMapping = append(restore.Spec.StoreVolumeMapping, v1alpha1.StoreVolumeMap{StoreID: 2, SnapshotID: "snap-2"})
+	g.Expect(validateStoreVolumeMapping("ns", "name", restore)).To(MatchError(ContainSubstring("should be configured for storeVolumeMapping")))
+	restore.Spec.StoreVolumeMapping[1].TargetPVName = "pv-1"
+	g.Expect(validateStoreVolumeMapping("ns", "name", restore)).To(MatchError(ContainSubstring("pv pv-1 is mapped more than once")))
+	restore.Spec.StoreVolumeMapping[1].SnapshotID = "snap-1"
+	g.Expect(validateStoreVolumeMapping("ns", "name", restore)).To(MatchError(ContainSubstring("snapshot snap-1 is mapped more than once")))
+
+	restore.Spec.StoreVolumeMapping = nil
+	restore.Spec.Mode = v1alpha1.RestoreModeSnapshot
+	restore.Spec.VolumeRehearsal = true
+	match("volumeRehearsal is only supported by volume snapshot restore")
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	restore.Spec.FederalVolumeRestorePhase = v1alpha1.FederalVolumeRestoreFinish
+	match("volumeRehearsal is only supported by the restore-volume phase")
+	restore.Spec.Mode = v1alpha1.RestoreModeSnapshot
+	restore.Spec.FederalVolumeRestorePhase = ""
+
+	restore.Spec.VolumeRehearsal = false
+	restore.Spec.CleanupOrphanedVolumesOnFailure = true
+	match("cleanupOrphanedVolumesOnFailure is only supported by volume snapshot restore")
+
+	restore.Spec.CleanupOrphanedVolumesOnFailure = false
+	restore.Spec.AllowReplicaMismatch = true
+	match("allowReplicaMismatch is only supported by volume snapshot restore")
+
+	restore.Spec.AllowReplicaMismatch = false
+	restore.Spec.AllowMasterKeyRotation = true
+	match("allowMasterKeyRotation is only supported by volume snapshot restore")
+
+	restore.Spec.AllowMasterKeyRotation = false
+	restore.Spec.RestoreTimeout = &metav1.Duration{Duration: time.Hour}
+	match("restoreTimeout is only supported by volume snapshot restore")
+
+	restore.Spec.RestoreTimeout = nil
+	restore.Spec.PDReadyTimeout = &metav1.Duration{Duration: -time.Minute}
+	match("pdReadyTimeout -1m0s must be positive")
+
+	restore.Spec.PDReadyTimeout = nil
+	restore.Spec.MetaReadTimeout = &metav1.Duration{Duration: 0}
+	match("metaReadTimeout 0s must be positive")
+
+	restore.Spec.MetaReadTimeout = nil
+	restore.Spec.BRVersion = "latest"
+	match("brVersion latest is not a valid version")
+
+	restore.Spec.BRVersion = "v7.1.0"
+	match("")
+
+	restore.Spec.Checksum = pointer.BoolPtr(false)
+	match("")
+	restore.Spec.BR.Checksum = pointer.BoolPtr(true)
+	match("checksum can't be set together with br.checksum")
+	restore.Spec.BR.Checksum = nil
+	restore.Spec.Mode = v1alpha1.RestoreModePiTR
+	match("checksum is only supported by snapshot restore")
+	restore.Spec.Mode = v1alpha1.RestoreModeSnapshot
+	restore.Spec.Checksum = nil
+
+	restore.Spec.BRVersion = ""
+	restore.Spec.TiKVRestartBatchSize = pointer.Int32Ptr(0)
+	match("tikvRestartBatchSize 0 must be positive")
+
+	restore.Spec.TiKVRestartBatchSize = pointer.Int32Ptr(2)
+	restore.Spec.TiKVRestartBatchInterval = &metav1.Duration{Duration: -time.Second}
+	match("tikvRestartBatchInterval -1s must not be negative")
+
+	restore.Spec.TiKVRestartBatchInterval = nil
+	match("tikvRestartBatchSize and tikvRestartBatchInterval are only supported by volume snapshot restore")
+
+	restore.Spec.TiKVRestartBatchSize = nil
+	restore.Spec.WarmupImages = true
+	match("warmupImages is only supported by volume snapshot restore")
+
+	restore.Spec.WarmupImages = false
+	restore.Spec.TableFilter = []string{"db.*", "!db.tmp_*", "db"}
+	match(`invalid tableFilter "db" in spec of .*, the schema and the table should be separated by '\.'`)
+	restore.Spec.TableFilter = restore.Spec.TableFilter[:2]
+	match("")
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	g.Expect(ValidateRestore(restore, "tikv:v4.0.8", true)).To(MatchError(ContainSubstring("tableFilter is not supported by volume snapshot restore")))
+
+	restore.Spec.TableFilter = nil
+	restore.Spec.Mode = v1alpha1.RestoreModePiTR
+	restore.Spec.PitrRestoredTs = "2023-02-30 10:00:00"
+	match("pitrRestoredTs 2023-02-30 10:00:00 should be a TSO or a timestamp")
+
+	for _, ts := range []string{"439873921245790211", "2023-02-13 10:00:00", "2023-02-13T10:00:00+08:00"} {
+		restore.Spec.PitrRestoredTs = ts
+		match("")
+	}
+
+	restore.Spec.Mode = v1alpha1.RestoreModeSnapshot
+	restore.Spec.PitrRestoredTs = ""
+	restore.Spec.RecoveryPlacement = &v1alpha1.RecoveryPlacement{NodeSelector: map[string]string{"zone": "us-west-2a"}}
+	match("recoveryPlacement is only supported by volume snapshot restore")
+
+	restore.Spec.RecoveryPlacement = nil
+	restore.Spec.CanaryChecks = []v1alpha1.CanaryCheck{{Database: "db"}}
+	to := restore.Spec.To
+	restore.Spec.To = nil
+	match("canaryChecks needs `to` to be set")
+
+	restore.Spec.To = to
+	match("database and table of canary check must be set")
+
+	restore.Spec.CanaryChecks[0].Table = "t1"
+	restore.Spec.CanaryChecks[0].Type = v1alpha1.CanaryCheckType("RowCount")
+	match("canary check type RowCount of table db.t1 is invalid")
+
+	restore.Spec.CanaryChecks[0].Type = v1alpha1.CanaryCheckTypeKVCount
+	restore.Spec.CanaryChecks = append(restore.Spec.CanaryChecks, v1alpha1.CanaryCheck{Database: "DB", Table: "T1"})
+	match("canary check of table DB.T1 is duplicated")
+
+	restore.Spec.CanaryChecks[1].Table = "t2"
+	match("")
+
+	restore.Spec.Mode = v1alpha1.RestoreModePiTR
+	match("canaryChecks is only supported by snapshot restore")
+
+	restore.Spec.Mode = v1alpha1.RestoreModeSnapshot
+	restore.Spec.CanaryChecks = nil
+	restore.Spec.AutoRehydrate = &v1alpha1.RehydrationConfig{Days: -1}
+	match("days -1 of autoRehydrate must be positive")
+
+	restore.Spec.AutoRehydrate = &v1alpha1.RehydrationConfig{Tier: "Fast"}
+	match("tier Fast of autoRehydrate is invalid")
+
+	restore.Spec.AutoRehydrate.Tier = "Bulk"
+	match("")
+
+	s3 := restore.Spec.S3
+	restore.Spec.S3 = nil
+	restore.Spec.Gcs = &v1alpha1.GcsStorageProvider{ProjectId: "project", Bucket: "bucket"}
+	match("checkColdStorage and autoRehydrate are only supported by S3 storage")
+	restore.Spec.CheckColdStorage = false
+	restore.Spec.AutoRehydrate = nil
+	restore.Spec.Gcs.Endpoint = "storage-vpc.p.googleapis.com"
+	match("scheme not found in gcs endpoint storage-vpc.p.googleapis.com")
+	restore.Spec.Gcs.Endpoint = "https://storage-vpc.p.googleapis.com"
+	restore.Spec.Gcs.RequesterPays = true
+	match("")
+	restore.Spec.Gcs = nil
+	restore.Spec.S3 = s3
+}
+
+func TestValidateTableFilterRule(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, rule := range []string{
+		"db.*",
+		"!db.tmp_*",
+		"*.*",
+		"db?.t[0-9]",
+		"db.[!a-z]*",
+		"db.[]]",
+		`db\.name.table`,
+		"`db.name`.`t``1`",
+		`"db"."t"`,
+		"'db'.*",
+		`/^db\d+$/.*`,
+		`db./^t\/\d+$/`,
+	} {
+		g.Expect(validateTableFilterRule(rule)).To(Succeed(), rule)
+	}
+
+	for rule, msg := range map[string]string{
+		"":             "empty rule",
+		"@rules.txt":   "importing rules from a file is not supported",
+		"db":           "the schema and the table should be separated by '.'",
+		".t":           "invalid schema pattern, empty pattern",
+		"db.":          "invalid table pattern, empty pattern",
+		"db.[a-z":      "invalid table pattern, unterminated character class",
+		`db.t\`:        "invalid table pattern, dangling escape",
+		"`db.t":        "invalid schema pattern, unterminated quoted name",
+		"/db.t":        "invalid schema pattern, unterminated regular expression",
+		"/db(/.t":      "invalid schema pattern, error parsing regexp",
+		"db.t.x":       `unexpected ".x" after the table pattern`,
+		"`db`x.t":      "the schema and the table should be separated by '.'",
+		"'db'.'t'.'x'": `unexpected ".'x'" after the table pattern`,
+	} {
+		err := validateTableFilterRule(rule)
+		g.Expect(err).To(HaveOccurred(), rule)
+		g.Expect(err.Error()).To(ContainSubstring(msg), rule)
+	}
 }
 
 func TestGetImageTag(t *testing.T) {
@@ -640,3 +1114,167 @@ func TestGetImageTag(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBRImage(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	type testcase struct {
+		name      string
+		tikvImage string
+		brImage   string
+		valid     bool
+	}
+
+	tests := []*testcase{
+		{
+			name:      "default registry",
+			tikvImage: "pingcap/tikv:v6.5.0",
+			brImage:   "pingcap/br:v6.5.0",
+			valid:     true,
+		},
+		{
+			name:      "private registry",
+			tikvImage: "registry.local/pingcap/tikv:v6.5.0",
+			brImage:   "registry.local/pingcap/br:v6.5.0",
+			valid:     true,
+		},
+		{
+			name:      "private registry with port",
+			tikvImage: "localhost:5000/mirror/pingcap/tikv:v6.5.0",
+			brImage:   "localhost:5000/mirror/pingcap/br:v6.5.0",
+			valid:     true,
+		},
+		{
+			name:      "no repo",
+			tikvImage: "tikv:v6.5.0",
+			brImage:   "pingcap/br:v6.5.0",
+			valid:     true,
+		},
+		{
+			name:      "no tag",
+			tikvImage: "localhost:5000/pingcap/tikv",
+			brImage:   "localhost:5000/pingcap/br:",
+			valid:     false,
+		},
+		{
+			name:      "digest",
+			tikvImage: "registry.local/pingcap/tikv@sha256:1dd7f3fe4c58f67ba6a64ff3f1f3c8f6d18e5cf6d0b3e4e8ab77a4b4c0e9e1a0",
+			brImage:   "registry.local/pingcap/br:",
+			valid:     false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			brImage := GetBRImage(test.tikvImage)
+			g.Expect(brImage).To(Equal(test.brImage))
+			if test.valid {
+				g.Expect(ValidateImage(brImage)).To(Succeed())
+			} else {
+				g.Expect(ValidateImage(brImage)).NotTo(Succeed())
+			}
+		})
+	}
+}
+
+func TestGetImageWithTag(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tests := []struct {
+		image  string
+		tag    string
+		expect string
+	}{
+		{image: "pingcap/tikv:v6.5.0", tag: "v7.1.0", expect: "pingcap/tikv:v7.1.0"},
+		{image: "localhost:5000/pingcap/tikv:v6.5.0", tag: "v7.1.0", expect: "localhost:5000/pingcap/tikv:v7.1.0"},
+		{image: "localhost:5000/pingcap/tikv", tag: "v7.1.0", expect: "localhost:5000/pingcap/tikv:v7.1.0"},
+		{image: "pingcap/tikv@sha256:1dd7f3fe4c58f67ba6a64ff3f1f3c8f6d18e5cf6d0b3e4e8ab77a4b4c0e9e1a0", tag: "v7.1.0", expect: "pingcap/tikv:v7.1.0"},
+	}
+	for _, test := range tests {
+		g.Expect(GetImageWithTag(test.image, test.tag)).To(Equal(test.expect), "image %s", test.image)
+	}
+}
+
+func TestGetBRImageInRegistry(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tests := []struct {
+		registry  string
+		tikvImage string
+		brImage   string
+	}{
+		{registry: "mirror.local/pingcap", tikvImage: "pingcap/tikv:v6.5.0", brImage: "mirror.local/pingcap/br:v6.5.0"},
+		{registry: "mirror.local/pingcap/", tikvImage: "registry.local/pingcap/tikv:v6.5.0", brImage: "mirror.local/pingcap/br:v6.5.0"},
+		{registry: "localhost:5000", tikvImage: "localhost:5001/pingcap/tikv:v6.5.0", brImage: "localhost:5000/br:v6.5.0"},
+		{registry: "mirror.local/pingcap", tikvImage: "localhost:5000/pingcap/tikv", brImage: "mirror.local/pingcap/br:"},
+	}
+	for _, test := range tests {
+		g.Expect(GetBRImageInRegistry(test.registry, test.tikvImage)).To(Equal(test.brImage), "registry %s, tikv image %s", test.registry, test.tikvImage)
+	}
+}
+
+func TestGenerateRestoreStorageEnv(t *testing.T) {
+	g := NewGomegaWithT(t)
+	ns := "ns"
+
+	client := fake.NewSimpleClientset()
+	informer := kubeinformers.NewSharedInformerFactory(client, 0)
+	for _, name := range []string{"primary", "fallback"} {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Data: map[string][]byte{
+				constants.S3AccessKey: []byte("access"),
+				constants.S3SecretKey: []byte("secret"),
+			},
+		}
+		g.Expect(informer.Core().V1().Secrets().Informer().GetIndexer().Add(s)).Should(Succeed())
+	}
+	lister := informer.Core().V1().Secrets().Lister()
+
+	restore := &v1alpha1.Restore{}
+	restore.Spec.S3 = &v1alpha1.S3StorageProvider{Bucket: "primary", Region: "us-west-2", SecretName: "primary"}
+	envs, _, err := GenerateRestoreStorageEnv(ns, restore, lister)
+	g.Expect(err).Should(BeNil())
+	g.Expect(envs).Should(BeEmpty())
+
+	// every storage gets its own credentials and region
+	restore.Spec.FallbackStorageProviders = []v1alpha1.StorageProvider{
+		{S3: &v1alpha1.S3StorageProvider{Bucket: "fallback", Region: "us-east-1", SecretName: "fallback"}},
+	}
+	envs, _, err = GenerateRestoreStorageEnv(ns, restore, lister)
+	g.Expect(err).Should(BeNil())
+	envMap := map[string]corev1.EnvVar{}
+	for _, env := range envs {
+		envMap[env.Name] = env
+	}
+	g.Expect(envMap["STORAGE_0_AWS_REGION"].Value).Should(Equal("us-west-2"))
+	g.Expect(envMap["STORAGE_1_AWS_REGION"].Value).Should(Equal("us-east-1"))
+	g.Expect(envMap["STORAGE_0_AWS_ACCESS_KEY_ID"].ValueFrom.SecretKeyRef.Name).Should(Equal("primary"))
+	g.Expect(envMap["STORAGE_1_AWS_ACCESS_KEY_ID"].ValueFrom.SecretKeyRef.Name).Should(Equal("fallback"))
+
+	// the storage recorded in the status is tried first
+	fallbackPath, err := GetStoragePath(restore.Spec.FallbackStorageProviders[0])
+	g.Expect(err).Should(BeNil())
+	restore.Status.StoragePath = fallbackPath
+	providers, indexes := RestoreStorageProviders(restore)
+	g.Expect(providers[0]).Should(Equal(restore.Spec.FallbackStorageProviders[0]))
+	g.Expect(indexes).Should(Equal([]int{1, 0}))
+}
+
+func TestIsBRBackupMetaV2(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	v1 := &kvbackup.BackupMeta{EndVersion: 1, Schemas: []*kvbackup.Schema{{Db: []byte("{}")}}}
+	data, err := proto.Marshal(v1)
+	g.Expect(err).Should(BeNil())
+	meta := &kvbackup.BackupMeta{}
+	g.Expect(proto.Unmarshal(data, meta)).Should(Succeed())
+	g.Expect(IsBRBackupMetaV2(meta)).Should(BeFalse())
+
+	// append an unknown varint field and an empty schema index, which is field 14 of length-delimited type
+	data = append(data, 11<<3, 1, 14<<3|2, 0)
+	meta = &kvbackup.BackupMeta{}
+	g.Expect(proto.Unmarshal(data, meta)).Should(Succeed())
+	g.Expect(meta.EndVersion).Should(Equal(uint64(1)))
+	g.Expect(IsBRBackupMetaV2(meta)).Should(BeTrue())
+}
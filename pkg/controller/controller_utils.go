@@ -96,6 +96,28 @@ func IsRequeueError(err error) bool {
 	return stderrs.As(err, &rerr)
 }
 
+// ClusterWaitError is a RequeueError returned while waiting for the components of the tidb cluster, e.g. PD
+// members or TiKV stores being ready, the wait may take long so the time of the next retry is recorded
+type ClusterWaitError struct {
+	RequeueError
+}
+
+// Unwrap returns the RequeueError, so the ClusterWaitError is also a RequeueError
+func (e *ClusterWaitError) Unwrap() error {
+	return &e.RequeueError
+}
+
+// ClusterWaitErrorf returns a ClusterWaitError
+func ClusterWaitErrorf(format string, a ...interface{}) error {
+	return &ClusterWaitError{RequeueError{fmt.Sprintf(format, a...)}}
+}
+
+// IsClusterWaitError returns whether err is a ClusterWaitError
+func IsClusterWaitError(err error) bool {
+	cerr := &ClusterWaitError{}
+	return stderrs.As(err, &cerr)
+}
+
 // IgnoreError is used to ignore this item, this error type shouldn't be considered as a real error, no need to requeue
 type IgnoreError struct {
 	s string
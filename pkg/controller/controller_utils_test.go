@@ -39,6 +39,16 @@ func TestRequeueError(t *testing.T) {
 	g.Expect(IsRequeueError(fmt.Errorf("i am not a requeue error"))).To(BeFalse())
 }
 
+func TestClusterWaitError(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	err := ClusterWaitErrorf("i am a cluster wait %s", "error")
+	g.Expect(IsClusterWaitError(err)).To(BeTrue())
+	g.Expect(IsRequeueError(err)).To(BeTrue())
+	g.Expect(err.Error()).To(Equal("i am a cluster wait error"))
+	g.Expect(IsClusterWaitError(RequeueErrorf("i am not a cluster wait error"))).To(BeFalse())
+}
+
 func TestIgnoreError(t *testing.T) {
 	g := NewGomegaWithT(t)
 
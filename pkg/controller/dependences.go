@@ -95,30 +95,65 @@ type CLIConfig struct {
 	// KubeClientQPS indicates the maximum QPS to the kubenetes API server from client.
 	KubeClientQPS   float64
 	KubeClientBurst int
+
+	// RestoreBandwidthBudget is the aggregate rate limit in MB/s of the active restores, which is the rate limit
+	// of a restore multiplied by the TiKV stores of its target cluster, a new restore is throttled if it would
+	// exceed the budget, 0 means no budget.
+	RestoreBandwidthBudget uint
+
+	// MaxConcurrentRestoreJobs is the max number of the running restore jobs, a restore waits to create its job
+	// until the running ones are under the limit, 0 means no limit.
+	MaxConcurrentRestoreJobs int
+
+	// VolumeTagConcurrency is the max number of volumes tagged concurrently in a volume snapshot restore.
+	VolumeTagConcurrency uint
+
+	// RestoreStorageClassName is the storage class of the restore pvc if it's not specified in the restore,
+	// the default storage class of the kubernetes cluster is used if it's empty.
+	RestoreStorageClassName string
+
+	// MaxRestoreStorageSize is the max storage size of the restore pvc, a restore requesting a larger one fails
+	// without creating the pvc, empty means no limit.
+	MaxRestoreStorageSize string
+
+	// RestoreStatusAddr is the address of the read-only endpoint listing the active restores at /restores, it's
+	// served on its own listener instead of the unauthenticated pprof and metrics one, empty disables it.
+	RestoreStatusAddr string
+
+	// RestoreTCGracePeriod is the period after a restore is created in which its tidbcluster not found in the
+	// informer cache is retried instead of being reported as a failure, 0 disables the retry.
+	RestoreTCGracePeriod time.Duration
+
+	// RestoreTiDBReadyTimeout is the period after a restore is created in which the import job is not created
+	// until the service of the target TiDB has ready endpoints, 0 disables the wait.
+	RestoreTiDBReadyTimeout time.Duration
 }
 
 // DefaultCLIConfig returns the default command line configuration
 func DefaultCLIConfig() *CLIConfig {
 	return &CLIConfig{
-		Workers:                5,
-		ClusterScoped:          true,
-		AutoFailover:           true,
-		PDFailoverPeriod:       5 * time.Minute,
-		TiKVFailoverPeriod:     5 * time.Minute,
-		TiDBFailoverPeriod:     5 * time.Minute,
-		TiFlashFailoverPeriod:  5 * time.Minute,
-		MasterFailoverPeriod:   5 * time.Minute,
-		WorkerFailoverPeriod:   5 * time.Minute,
-		LeaseDuration:          15 * time.Second,
-		RenewDeadline:          10 * time.Second,
-		RetryPeriod:            2 * time.Second,
-		WaitDuration:           5 * time.Second,
-		ResyncDuration:         30 * time.Second,
-		PodHardRecoveryPeriod:  24 * time.Hour,
-		DetectNodeFailure:      false,
-		TiDBBackupManagerImage: "pingcap/tidb-backup-manager:latest",
-		TiDBDiscoveryImage:     "pingcap/tidb-operator:latest",
-		Selector:               "",
+		Workers:                 5,
+		ClusterScoped:           true,
+		AutoFailover:            true,
+		PDFailoverPeriod:        5 * time.Minute,
+		TiKVFailoverPeriod:      5 * time.Minute,
+		TiDBFailoverPeriod:      5 * time.Minute,
+		TiFlashFailoverPeriod:   5 * time.Minute,
+		MasterFailoverPeriod:    5 * time.Minute,
+		WorkerFailoverPeriod:    5 * time.Minute,
+		LeaseDuration:           15 * time.Second,
+		RenewDeadline:           10 * time.Second,
+		RetryPeriod:             2 * time.Second,
+		WaitDuration:            5 * time.Second,
+		ResyncDuration:          30 * time.Second,
+		PodHardRecoveryPeriod:   24 * time.Hour,
+		DetectNodeFailure:       false,
+		TiDBBackupManagerImage:  "pingcap/tidb-backup-manager:latest",
+		TiDBDiscoveryImage:      "pingcap/tidb-operator:latest",
+		Selector:                "",
+		VolumeTagConcurrency:    10,
+		RestoreTCGracePeriod:    30 * time.Second,
+		RestoreTiDBReadyTimeout: 10 * time.Minute,
 	}
 }
 
@@ -153,6 +188,14 @@ func (c *CLIConfig) AddFlag(_ *flag.FlagSet) {
 	flag.DurationVar(&c.RetryPeriod, "leader-retry-period", c.RetryPeriod, "leader-retry-period is the duration the LeaderElector clients should wait between tries of actions")
 	flag.Float64Var(&c.KubeClientQPS, "kube-client-qps", c.KubeClientQPS, "The maximum QPS to the kubenetes API server from client")
 	flag.IntVar(&c.KubeClientBurst, "kube-client-burst", c.KubeClientBurst, "The maximum burst for throttle to the kubenetes API server from client")
+	flag.UintVar(&c.RestoreBandwidthBudget, "restore-bandwidth-budget", c.RestoreBandwidthBudget, "The aggregate rate limit in MB/s of the active restores, which is the rate limit of a restore multiplied by the TiKV stores of its target cluster, a new restore is throttled if it would exceed the budget, 0 means no budget")
+	flag.IntVar(&c.MaxConcurrentRestoreJobs, "max-concurrent-restore-jobs", c.MaxConcurrentRestoreJobs, "The max number of the running restore jobs, a restore waits to create its job until the running ones are under the limit, 0 means no limit")
+	flag.UintVar(&c.VolumeTagConcurrency, "volume-tag-concurrency", c.VolumeTagConcurrency, "The max number of volumes tagged concurrently in a volume snapshot restore")
+	flag.StringVar(&c.RestoreStorageClassName, "restore-storage-class-name", c.RestoreStorageClassName, "The storage class of the restore pvc if it's not specified in the restore, the default storage class of the kubernetes cluster is used if it's empty")
+	flag.StringVar(&c.MaxRestoreStorageSize, "max-restore-storage-size", c.MaxRestoreStorageSize, "The max storage size of the restore pvc, e.g. 500Gi, a restore requesting a larger one fails without creating the pvc, empty means no limit")
+	flag.StringVar(&c.RestoreStatusAddr, "restore-status-addr", c.RestoreStatusAddr, "The address of the read-only endpoint listing the active restores at /restores, which is served on its own plain HTTP listener to the bearer tokens allowed to list the restores, empty disables it")
+	flag.DurationVar(&c.RestoreTCGracePeriod, "restore-tc-grace-period", c.RestoreTCGracePeriod, "The period after a restore is created in which its tidbcluster not found in the informer cache is retried instead of being reported as a failure, 0 disables the retry")
+	flag.DurationVar(&c.RestoreTiDBReadyTimeout, "restore-tidb-ready-timeout", c.RestoreTiDBReadyTimeout, "The period after a restore is created in which its import job waits for the service of the target TiDB to have ready endpoints, 0 disables the wait")
 }
 
 // HasNodePermission returns whether the user has permission for node operations.
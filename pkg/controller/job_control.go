@@ -94,15 +94,19 @@ func (c *realJobControl) recordJobEvent(verb string, obj runtime.Object, job *ba
 	ns := job.GetNamespace()
 	instanceName := job.GetLabels()[label.InstanceLabelKey]
 	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	var correlation string
+	if id := job.GetLabels()[label.CorrelationIDLabelKey]; id != "" {
+		correlation = fmt.Sprintf(", correlation id %s", id)
+	}
 	if err == nil {
 		reason := fmt.Sprintf("Successful%s", strings.Title(verb))
-		msg := fmt.Sprintf("%s job %s/%s for cluster %s %s successful",
-			strings.ToLower(verb), ns, jobName, instanceName, strings.ToLower(kind))
+		msg := fmt.Sprintf("%s job %s/%s for cluster %s %s successful%s",
+			strings.ToLower(verb), ns, jobName, instanceName, strings.ToLower(kind), correlation)
 		c.recorder.Event(obj, corev1.EventTypeNormal, reason, msg)
 	} else {
 		reason := fmt.Sprintf("Failed%s", strings.Title(verb))
-		msg := fmt.Sprintf("%s job %s/%s for cluster %s %s failed error: %s",
-			strings.ToLower(verb), ns, jobName, instanceName, strings.ToLower(kind), err)
+		msg := fmt.Sprintf("%s job %s/%s for cluster %s %s failed%s error: %s",
+			strings.ToLower(verb), ns, jobName, instanceName, strings.ToLower(kind), correlation, err)
 		c.recorder.Event(obj, corev1.EventTypeWarning, reason, msg)
 	}
 }
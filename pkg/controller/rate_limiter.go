@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/wait"
 	wq "k8s.io/client-go/util/workqueue"
 )
 
@@ -29,3 +30,33 @@ func NewControllerRateLimiter(baseDelay, maxDelay time.Duration) wq.RateLimiter
 		&wq.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
 	)
 }
+
+// NewJitteredControllerRateLimiter returns a RateLimiter like NewControllerRateLimiter, but the exponential delay of
+// an item is jittered by up to maxFactor of it, so the items failing together are not retried in lockstep.
+// The jittered delay is still capped at maxDelay.
+func NewJitteredControllerRateLimiter(baseDelay, maxDelay time.Duration, maxFactor float64) wq.RateLimiter {
+	return wq.NewMaxOfRateLimiter(
+		&jitteredRateLimiter{
+			RateLimiter: wq.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			maxDelay:    maxDelay,
+			maxFactor:   maxFactor,
+		},
+		// 10 qps, 100 bucket size.  This is only for retry speed and its only the overall factor (not per item)
+		&wq.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// jitteredRateLimiter jitters the delay of the wrapped RateLimiter
+type jitteredRateLimiter struct {
+	wq.RateLimiter
+	maxDelay  time.Duration
+	maxFactor float64
+}
+
+func (r *jitteredRateLimiter) When(item interface{}) time.Duration {
+	delay := wait.Jitter(r.RateLimiter.When(item), r.maxFactor)
+	if delay > r.maxDelay {
+		return r.maxDelay
+	}
+	return delay
+}
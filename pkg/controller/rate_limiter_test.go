@@ -0,0 +1,42 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestJitteredControllerRateLimiter(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	limiter := NewJitteredControllerRateLimiter(time.Second, 10*time.Second, 0.5)
+	for i, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		delay := limiter.When("restore")
+		g.Expect(delay).To(BeNumerically(">=", base), "retry %d", i)
+		g.Expect(delay).To(BeNumerically("<=", base+base/2), "retry %d", i)
+	}
+	g.Expect(limiter.NumRequeues("restore")).To(Equal(4))
+
+	// the jittered delay is capped at the max delay
+	for i := 0; i < 3; i++ {
+		g.Expect(limiter.When("restore")).To(Equal(10 * time.Second))
+	}
+
+	// the delay starts over after the item is forgotten
+	limiter.Forget("restore")
+	g.Expect(limiter.When("restore")).To(BeNumerically("<=", 1500*time.Millisecond))
+}
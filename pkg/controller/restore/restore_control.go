@@ -29,6 +29,8 @@ type ControlInterface interface {
 	UpdateRestore(restore *v1alpha1.Restore) error
 	// UpdateCondition updates the condition for a Restore.
 	UpdateCondition(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition) error
+	// UpdateStatus updates the status for a Restore.
+	UpdateStatus(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error
 }
 
 // NewDefaultRestoreControl returns a new instance of the default implementation RestoreControlInterface that
@@ -56,11 +58,16 @@ func (c *defaultRestoreControl) UpdateCondition(restore *v1alpha1.Restore, condi
 	return c.restoreManager.UpdateCondition(restore, condition)
 }
 
+func (c *defaultRestoreControl) UpdateStatus(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error {
+	return c.restoreManager.UpdateStatus(restore, condition, newStatus)
+}
+
 // FakeRestoreControl is a fake RestoreControlInterface
 type FakeRestoreControl struct {
 	backupIndexer        cache.Indexer
 	updateRestoreTracker controller.RequestTracker
 	condition            *v1alpha1.RestoreCondition
+	status               *controller.RestoreUpdateStatus
 }
 
 // NewFakeRestoreControl returns a FakeRestoreControl
@@ -69,6 +76,7 @@ func NewFakeRestoreControl(restoreInformer informers.RestoreInformer) *FakeResto
 		restoreInformer.Informer().GetIndexer(),
 		controller.RequestTracker{},
 		nil,
+		nil,
 	}
 }
 
@@ -94,4 +102,11 @@ func (c *FakeRestoreControl) UpdateCondition(_ *v1alpha1.Restore, condition *v1a
 	return nil
 }
 
+// UpdateStatus updates the status for a Restore.
+func (c *FakeRestoreControl) UpdateStatus(_ *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *controller.RestoreUpdateStatus) error {
+	c.condition = condition
+	c.status = newStatus
+	return nil
+}
+
 var _ ControlInterface = &FakeRestoreControl{}
@@ -23,13 +23,34 @@ import (
 	"github.com/pingcap/tidb-operator/pkg/backup/restore"
 	"github.com/pingcap/tidb-operator/pkg/controller"
 	"github.com/pingcap/tidb-operator/pkg/metrics"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/util/slice"
+)
+
+const (
+	// jobDeadlineExceededReason is the reason of the Failed condition set by the job controller
+	// when the job is active longer than its ActiveDeadlineSeconds
+	jobDeadlineExceededReason = "DeadlineExceeded"
+	// restoreTimeoutReason is the reason of the Failed condition of a restore whose job exceeded the deadline
+	restoreTimeoutReason = "RestoreTimeout"
+	// jobNameLabelKey is the label set by the job controller on the pods of a job
+	jobNameLabelKey = "job-name"
+
+	// the restore waiting for a condition is retried with exponential backoff from restoreRetryBaseDelay
+	// up to restoreRetryMaxDelay, the delay is jittered by up to restoreRetryJitterFactor of it
+	restoreRetryBaseDelay    = 1 * time.Second
+	restoreRetryMaxDelay     = 100 * time.Second
+	restoreRetryJitterFactor = 0.2
 )
 
 // Controller controls restore.
@@ -38,29 +59,41 @@ type Controller struct {
 	// control returns an interface capable of syncing a restore.
 	// Abstracted out for testing.
 	control ControlInterface
+	// rateLimiter decides the delay of requeuing a restore, it's shared with the queue.
+	rateLimiter workqueue.RateLimiter
 	// restores that need to be synced.
 	queue workqueue.RateLimitingInterface
 }
 
 // NewController creates a restore controller.
 func NewController(deps *controller.Dependencies) *Controller {
+	rateLimiter := controller.NewJitteredControllerRateLimiter(restoreRetryBaseDelay, restoreRetryMaxDelay, restoreRetryJitterFactor)
 	c := &Controller{
-		deps:    deps,
-		control: NewDefaultRestoreControl(restore.NewRestoreManager(deps)),
-		queue: workqueue.NewNamedRateLimitingQueue(
-			controller.NewControllerRateLimiter(1*time.Second, 100*time.Second),
-			"restore",
-		),
+		deps:        deps,
+		control:     NewDefaultRestoreControl(restore.NewRestoreManager(deps)),
+		rateLimiter: rateLimiter,
+		queue:       workqueue.NewNamedRateLimitingQueue(rateLimiter, "restore"),
 	}
 
 	restoreInformer := deps.InformerFactory.Pingcap().V1alpha1().Restores()
 	restoreInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: c.updateRestore,
+		AddFunc: c.addRestore,
 		UpdateFunc: func(old, cur interface{}) {
+			restore.RecordRestoreFinished(old.(*v1alpha1.Restore), cur.(*v1alpha1.Restore))
+			// the next retry time is recorded by the controller itself, syncing the restore for it
+			// would defeat the backoff
+			if isOnlyNextRetryTimeUpdated(old.(*v1alpha1.Restore), cur.(*v1alpha1.Restore)) {
+				return
+			}
 			c.updateRestore(cur)
 		},
 		DeleteFunc: c.enqueueRestore,
 	})
+	// the pods of a restore job may fail without the backup-manager reporting it, the restore is synced to
+	// report the failure when its job has a new failed pod
+	deps.KubeInformerFactory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.updateJob,
+	})
 	return c
 }
 
@@ -80,10 +113,30 @@ func (c *Controller) Run(workers int, stopCh <-chan struct{}) {
 	for i := 0; i < workers; i++ {
 		go wait.Until(c.worker, time.Second, stopCh)
 	}
+	go wait.Until(c.updateBandwidthMetrics, 30*time.Second, stopCh)
+	go wait.Until(c.updateInFlightMetrics, 30*time.Second, stopCh)
 
 	<-stopCh
 }
 
+// updateBandwidthMetrics updates the metrics of the bandwidth used by the active restores
+func (c *Controller) updateBandwidthMetrics() {
+	usage, err := restore.ActiveRestoresBandwidth(c.deps.RestoreLister, c.deps.TiDBClusterLister)
+	if err != nil {
+		klog.Errorf("Fail to get the bandwidth of the active restores, %v", err)
+		return
+	}
+	metrics.RestoreBandwidthUsage.Set(float64(usage))
+	metrics.RestoreBandwidthBudget.Set(float64(c.deps.CLIConfig.RestoreBandwidthBudget))
+}
+
+// updateInFlightMetrics updates the metrics of the number of the in-flight restores
+func (c *Controller) updateInFlightMetrics() {
+	if err := restore.UpdateInFlightRestoresMetrics(c.deps.RestoreLister); err != nil {
+		klog.Errorf("Fail to get the in-flight restores, %v", err)
+	}
+}
+
 // worker runs a worker goroutine that invokes processNextWorkItem until the the controller's queue is closed
 func (c *Controller) worker() {
 	for c.processNextWorkItem() {
@@ -104,19 +157,68 @@ func (c *Controller) processNextWorkItem() bool {
 	if err := c.sync(key.(string)); err != nil {
 		if perrors.Find(err, controller.IsRequeueError) != nil {
 			klog.Infof("Restore: %v, still need sync: %v, requeuing", key.(string), err)
-			c.queue.AddRateLimited(key)
+			c.requeueRestore(key.(string), perrors.Find(err, controller.IsClusterWaitError) != nil)
 		} else if perrors.Find(err, controller.IsIgnoreError) != nil {
 			klog.V(4).Infof("Restore: %v, ignore err: %v", key.(string), err)
+			c.recordNextRetryTime(key.(string), &metav1.Time{})
 		} else {
 			utilruntime.HandleError(fmt.Errorf("Restore: %v, sync failed, err: %v, requeuing", key.(string), err))
 			c.queue.AddRateLimited(key)
+			c.recordNextRetryTime(key.(string), &metav1.Time{})
 		}
 	} else {
 		c.queue.Forget(key)
+		c.recordNextRetryTime(key.(string), &metav1.Time{})
 	}
 	return true
 }
 
+// requeueRestore requeues the restore waiting for a condition with exponential backoff and jitter, the next
+// retry time is only recorded for the wait for the cluster, which may take long
+func (c *Controller) requeueRestore(key string, waitingForCluster bool) {
+	delay := c.rateLimiter.When(key)
+	c.queue.AddAfter(key, delay)
+	nextRetryTime := &metav1.Time{}
+	if waitingForCluster {
+		*nextRetryTime = metav1.NewTime(time.Now().Add(delay).Truncate(time.Second))
+	}
+	c.recordNextRetryTime(key, nextRetryTime)
+}
+
+// recordNextRetryTime records the next retry time in the status of the restore waiting for PD and TiKV being
+// ready. The zero time clears the recorded one after the wait is over, the status is not updated if there is
+// none recorded.
+func (c *Controller) recordNextRetryTime(key string, nextRetryTime *metav1.Time) {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+	r, err := c.deps.RestoreLister.Restores(ns).Get(name)
+	if err != nil {
+		return
+	}
+	if nextRetryTime.IsZero() && r.Status.NextRetryTime == nil {
+		return
+	}
+	err = c.control.UpdateStatus(r.DeepCopy(), nil, &controller.RestoreUpdateStatus{NextRetryTime: nextRetryTime})
+	if err != nil {
+		klog.Errorf("Fail to record the next retry time of restore %s/%s, %v", ns, name, err)
+	}
+}
+
+// isOnlyNextRetryTimeUpdated returns true if the update of the restore only changes its next retry time
+func isOnlyNextRetryTimeUpdated(old, cur *v1alpha1.Restore) bool {
+	if apiequality.Semantic.DeepEqual(old.Status.NextRetryTime, cur.Status.NextRetryTime) {
+		return false
+	}
+	oldStatus, curStatus := old.Status.DeepCopy(), cur.Status.DeepCopy()
+	oldStatus.NextRetryTime, curStatus.NextRetryTime = nil, nil
+	return apiequality.Semantic.DeepEqual(old.Spec, cur.Spec) &&
+		apiequality.Semantic.DeepEqual(old.Labels, cur.Labels) &&
+		apiequality.Semantic.DeepEqual(old.Annotations, cur.Annotations) &&
+		apiequality.Semantic.DeepEqual(oldStatus, curStatus)
+}
+
 // sync syncs the given restore.
 func (c *Controller) sync(key string) error {
 	startTime := time.Now()
@@ -146,24 +248,93 @@ func (c *Controller) syncRestore(restore *v1alpha1.Restore) error {
 	return c.control.UpdateRestore(restore)
 }
 
+// addRestore handles the restore added to the informer, which includes all the restores when the controller
+// starts, so a PiTR restore in progress is synced to resume observing its job.
+func (c *Controller) addRestore(obj interface{}) {
+	c.handleRestore(obj.(*v1alpha1.Restore), true)
+}
+
 func (c *Controller) updateRestore(cur interface{}) {
-	newRestore := cur.(*v1alpha1.Restore)
+	c.handleRestore(cur.(*v1alpha1.Restore), false)
+}
+
+func (c *Controller) handleRestore(newRestore *v1alpha1.Restore, added bool) {
 	klog.V(4).Infof("restore-manager update %v", newRestore)
 
 	ns := newRestore.GetNamespace()
 	name := newRestore.GetName()
 
+	// the restore with the job in another namespace is synced to clean up the job when it's deleted
+	if newRestore.DeletionTimestamp != nil && slice.ContainsString(newRestore.Finalizers, label.RestoreJobCleanupFinalizer, nil) {
+		c.enqueueRestore(newRestore)
+		return
+	}
+
+	// the canceled restore is synced to clean up its jobs whatever phase it's in
+	if restore.NeedCancel(newRestore) {
+		c.enqueueRestore(newRestore)
+		return
+	}
+
+	if v1alpha1.IsRestoreCanceled(newRestore) {
+		klog.V(4).Infof("restore %s/%s is Canceled, skipping.", ns, name)
+		return
+	}
+
+	// the image warmup daemonset of the failed or invalid restore is deleted, whatever failed the restore
+	if restore.NeedImageWarmupCleanup(newRestore) {
+		c.enqueueRestore(newRestore)
+		return
+	}
+
 	if v1alpha1.IsRestoreInvalid(newRestore) {
 		klog.V(4).Infof("restore %s/%s is Invalid, skipping.", ns, name)
 		return
 	}
 
 	if v1alpha1.IsRestoreComplete(newRestore) {
+		if newRestore.Spec.PostRestoreHook != nil && !v1alpha1.IsRestorePostHookFinished(newRestore) {
+			c.enqueueRestore(newRestore)
+			return
+		}
+		// the restore pvc of the finished restore is deleted after the job is cleaned up by the ttl
+		if restore.NeedRestorePVCCleanup(newRestore) {
+			c.enqueueRestore(newRestore)
+			return
+		}
 		klog.V(4).Infof("restore %s/%s is Complete, skipping.", ns, name)
 		return
 	}
 
+	if v1alpha1.IsRestoreDryRunComplete(newRestore) {
+		klog.V(4).Infof("restore %s/%s is DryRunComplete, skipping.", ns, name)
+		return
+	}
+
+	// the job exceeding the deadline is checked before the Failed condition, because the backup-manager
+	// may report a generic failure when its pod is terminated
+	if c.isRestoreJobDeadlineExceeded(newRestore) {
+		_, condition := v1alpha1.GetRestoreCondition(&newRestore.Status, v1alpha1.RestoreFailed)
+		if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != restoreTimeoutReason {
+			klog.Infof("restore %s/%s job exceeded the active deadline.", ns, name)
+			err := c.control.UpdateCondition(newRestore, &v1alpha1.RestoreCondition{
+				Type:    v1alpha1.RestoreFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  restoreTimeoutReason,
+				Message: fmt.Sprintf("Job %s was active longer than %d seconds", newRestore.GetRestoreJobName(), *newRestore.Spec.ActiveDeadlineSeconds),
+			})
+			if err != nil {
+				klog.Errorf("Fail to update the condition of restore %s/%s, %v", ns, name, err)
+			}
+		}
+		return
+	}
+
 	if v1alpha1.IsRestoreFailed(newRestore) {
+		if restore.NeedRestorePVCCleanup(newRestore) {
+			c.enqueueRestore(newRestore)
+			return
+		}
 		klog.V(4).Infof("restore %s/%s is Failed, skipping.", ns, name)
 		return
 	}
@@ -216,26 +387,43 @@ func (c *Controller) updateRestore(cur interface{}) {
 			klog.Errorf("Fail to generate selector for restore %s/%s, %v", ns, name, err)
 			return
 		}
-		pods, err := c.deps.PodLister.Pods(ns).List(selector)
+		pods, err := c.deps.PodLister.Pods(newRestore.GetRestoreJobNamespace()).List(selector)
 		if err != nil {
 			klog.Errorf("Fail to list pod for restore %s/%s with selector %s, %v", ns, name, selector, err)
 			return
 		}
+		// every job retries its failed pods until the backoff limit is exceeded, so the failed pods are counted
+		// per job, the volume snapshot restore runs several jobs in turn
+		failedPods := make(map[string]int32)
+		failed := false
 		for _, pod := range pods {
-			if pod.Status.Phase == corev1.PodFailed {
-				klog.Infof("restore %s/%s has failed pod %s.", ns, name, pod.Name)
+			if pod.Status.Phase != corev1.PodFailed {
+				continue
+			}
+			jobName := pod.Labels[jobNameLabelKey]
+			failedPods[jobName]++
+			klog.Infof("restore %s/%s has failed pod %s of job %s, %d failed pods of backoff limit %d.", ns, name, pod.Name, jobName, failedPods[jobName], newRestore.GetBackoffLimit())
+			if failedPods[jobName] > newRestore.GetBackoffLimit() {
 				err = c.control.UpdateCondition(newRestore, &v1alpha1.RestoreCondition{
 					Type:    v1alpha1.RestoreFailed,
 					Status:  corev1.ConditionTrue,
 					Reason:  "AlreadyFailed",
-					Message: fmt.Sprintf("Pod %s has failed", pod.Name),
+					Message: fmt.Sprintf("Pod %s has failed, %s", pod.Name, restore.DescribePodStatus(pod)),
 				})
 				if err != nil {
 					klog.Errorf("Fail to update the condition of restore %s/%s, %v", ns, name, err)
 				}
+				failed = true
 				break
 			}
 		}
+		// the job of a PiTR restore is observed by the restore manager to track the phase of the restore, it's
+		// synced when the progress moves it to another phase, and when it's added after the controller restarts
+		if newRestore.Spec.Mode == v1alpha1.RestoreModePiTR && !failed && !v1alpha1.IsRestoreFailed(newRestore) &&
+			(added || restore.PiTRPhaseChanged(newRestore)) {
+			c.enqueueRestore(newRestore)
+			return
+		}
 		klog.V(4).Infof("restore %s/%s is already Scheduled, Running or Failed, skipping.", ns, name)
 		return
 	}
@@ -244,6 +432,62 @@ func (c *Controller) updateRestore(cur interface{}) {
 	c.enqueueRestore(newRestore)
 }
 
+// updateJob enqueues the restore whose job has a new failed pod or has failed. The job in another namespace
+// than the restore is not owned by it, so the restore is found by the name in the label and the job namespace.
+func (c *Controller) updateJob(old, cur interface{}) {
+	oldJob, curJob := old.(*batchv1.Job), cur.(*batchv1.Job)
+	if curJob.Status.Failed == oldJob.Status.Failed && isJobFailed(curJob) == isJobFailed(oldJob) {
+		return
+	}
+	name, ok := curJob.Labels[label.RestoreLabelKey]
+	if !ok {
+		return
+	}
+	restores, err := c.deps.RestoreLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Fail to list restores for job %s/%s, %v", curJob.Namespace, curJob.Name, err)
+		return
+	}
+	for _, r := range restores {
+		if r.Name == name && r.GetRestoreJobNamespace() == curJob.Namespace && !v1alpha1.IsRestoreFailed(r) {
+			klog.Infof("restore %s/%s job %s has %d failed pods", r.Namespace, r.Name, curJob.Name, curJob.Status.Failed)
+			c.enqueueRestore(r)
+		}
+	}
+}
+
+// isJobFailed returns true if the job has failed
+func isJobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// isRestoreJobDeadlineExceeded returns true if the job of the restore is terminated by the job controller
+// for exceeding the ActiveDeadlineSeconds of the restore
+func (c *Controller) isRestoreJobDeadlineExceeded(r *v1alpha1.Restore) bool {
+	if r.Spec.ActiveDeadlineSeconds == nil {
+		return false
+	}
+	job, err := c.deps.JobLister.Jobs(r.GetRestoreJobNamespace()).Get(r.GetRestoreJobName())
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("Fail to get job %s for restore %s/%s, %v", r.GetRestoreJobName(), r.GetNamespace(), r.GetName(), err)
+		}
+		return false
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue &&
+			condition.Reason == jobDeadlineExceededReason {
+			return true
+		}
+	}
+	return false
+}
+
 // enqueueRestore enqueues the given restore in the work queue.
 func (c *Controller) enqueueRestore(obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
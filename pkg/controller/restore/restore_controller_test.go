@@ -18,11 +18,13 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/pingcap/tidb-operator/pkg/apis/label"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/controller"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
@@ -47,13 +49,15 @@ func TestRestoreControllerEnqueueRestoreFailed(t *testing.T) {
 func TestRestoreControllerUpdateRestore(t *testing.T) {
 	g := NewGomegaWithT(t)
 
-	// create a pod with failed status in the pod informer.
-	createFailedPod := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+	// create a pod of the job with failed status in the pod informer.
+	createFailedJobPod := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore, podName, jobName string) {
+		podLabels := label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(restore.Name)
+		podLabels[jobNameLabelKey] = jobName
 		pod := &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      restore.Name,
+				Name:      podName,
 				Namespace: restore.Namespace,
-				Labels:    label.NewRestore().Instance(restore.GetInstanceName()).RestoreJob().Restore(restore.Name),
+				Labels:    podLabels,
 			},
 			Status: corev1.PodStatus{
 				Phase: corev1.PodFailed,
@@ -64,6 +68,41 @@ func TestRestoreControllerUpdateRestore(t *testing.T) {
 		rtc.deps.KubeInformerFactory.Start(context.TODO().Done())
 		cache.WaitForCacheSync(context.TODO().Done(), rtc.deps.KubeInformerFactory.Core().V1().Pods().Informer().HasSynced)
 	}
+	createFailedPod := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+		createFailedJobPod(g, rtc, restore, restore.Name, restore.GetRestoreJobName())
+	}
+
+	// create a job terminated for exceeding the active deadline in the job informer.
+	createDeadlineExceededJob := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+		restore.Spec.ActiveDeadlineSeconds = pointer.Int64Ptr(3600)
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      restore.GetRestoreJobName(),
+				Namespace: restore.Namespace,
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{
+					{
+						Type:   batchv1.JobFailed,
+						Status: corev1.ConditionTrue,
+						Reason: "DeadlineExceeded",
+					},
+				},
+			},
+		}
+		_, err := rtc.deps.KubeClientset.BatchV1().Jobs(restore.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+		g.Expect(err).To(Succeed())
+		rtc.deps.KubeInformerFactory.Start(context.TODO().Done())
+		cache.WaitForCacheSync(context.TODO().Done(), rtc.deps.KubeInformerFactory.Batch().V1().Jobs().Informer().HasSynced)
+	}
+
+	updatingToTimeout := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+		control := rtc.control.(*FakeRestoreControl)
+		condition := control.condition
+		g.Expect(condition).NotTo(BeNil())
+		g.Expect(condition.Type).To(Equal(v1alpha1.RestoreFailed))
+		g.Expect(condition.Reason).To(Equal("RestoreTimeout"))
+	}
 
 	updatingToFail := func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
 		control := rtc.control.(*FakeRestoreControl)
@@ -94,6 +133,36 @@ func TestRestoreControllerUpdateRestore(t *testing.T) {
 				g.Expect(rtc.queue.Len()).To(Equal(0))
 			},
 		},
+		{
+			name:          "restore has been canceled",
+			conditionType: v1alpha1.RestoreCanceled,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Cancel = true
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+		},
+		{
+			name:          "restore has been running and is asked to be canceled",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Cancel = true
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(1))
+			},
+		},
+		{
+			name:          "restore has been completed with post restore hook not finished",
+			conditionType: v1alpha1.RestoreComplete,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.PostRestoreHook = &corev1.Container{Name: "hook", Image: "busybox"}
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(1))
+			},
+		},
 		{
 			name:          "restore has been scheduled",
 			conditionType: v1alpha1.RestoreScheduled,
@@ -115,6 +184,32 @@ func TestRestoreControllerUpdateRestore(t *testing.T) {
 				g.Expect(rtc.queue.Len()).To(Equal(0))
 			},
 		},
+		{
+			name:          "restore has been failed with the image warmup to clean up",
+			conditionType: v1alpha1.RestoreFailed,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+				restore.Spec.WarmupImages = true
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(1))
+			},
+		},
+		{
+			name:          "restore has been invalid with the image warmup cleaned up",
+			conditionType: v1alpha1.RestoreInvalid,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+				restore.Spec.WarmupImages = true
+				restore.Status.Conditions = append(restore.Status.Conditions, v1alpha1.RestoreCondition{
+					Type:   v1alpha1.RestoreImageWarmupComplete,
+					Status: corev1.ConditionFalse,
+				})
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+		},
 		{
 			name:           "restore has been scheduled with failed pod",
 			conditionType:  v1alpha1.RestoreScheduled,
@@ -133,6 +228,101 @@ func TestRestoreControllerUpdateRestore(t *testing.T) {
 			},
 			afterUpdateFn: updatingToFail,
 		},
+		{
+			name:           "restore has been running with job exceeded the deadline",
+			conditionType:  v1alpha1.RestoreRunning,
+			beforeUpdateFn: createDeadlineExceededJob,
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: updatingToTimeout,
+		},
+		{
+			name:           "restore has been failed with job exceeded the deadline",
+			conditionType:  v1alpha1.RestoreFailed,
+			beforeUpdateFn: createDeadlineExceededJob,
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: updatingToTimeout,
+		},
+		{
+			name:          "PiTR restore has been running",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Mode = v1alpha1.RestoreModePiTR
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(1))
+			},
+		},
+		{
+			name:          "PiTR restore has been running in the recorded phase",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Mode = v1alpha1.RestoreModePiTR
+				restore.Status.PiTRPhase = v1alpha1.RestorePiTRFullRestore
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+		},
+		{
+			name:          "PiTR restore has been running with failed pod",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.Mode = v1alpha1.RestoreModePiTR
+				createFailedPod(g, rtc, restore)
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: updatingToFail,
+		},
+		{
+			name:          "restore has been running with failed pod to retry",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.BackoffLimit = pointer.Int32Ptr(1)
+				createFailedPod(g, rtc, restore)
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				control := rtc.control.(*FakeRestoreControl)
+				g.Expect(control.condition).To(BeNil())
+			},
+		},
+		{
+			name:          "restore has been running with failed pods of different jobs to retry",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.BackoffLimit = pointer.Int32Ptr(1)
+				createFailedJobPod(g, rtc, restore, "prepare-pod", "prepare-job")
+				createFailedJobPod(g, rtc, restore, "finish-pod", "finish-job")
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				control := rtc.control.(*FakeRestoreControl)
+				g.Expect(control.condition).To(BeNil())
+			},
+		},
+		{
+			name:          "restore has been running with failed pods of a job exceeded the backoff limit",
+			conditionType: v1alpha1.RestoreRunning,
+			beforeUpdateFn: func(g *GomegaWithT, rtc *Controller, restore *v1alpha1.Restore) {
+				restore.Spec.BackoffLimit = pointer.Int32Ptr(1)
+				createFailedJobPod(g, rtc, restore, "prepare-pod-1", "prepare-job")
+				createFailedJobPod(g, rtc, restore, "prepare-pod-2", "prepare-job")
+			},
+			expectFn: func(g *GomegaWithT, rtc *Controller) {
+				g.Expect(rtc.queue.Len()).To(Equal(0))
+			},
+			afterUpdateFn: updatingToFail,
+		},
 	}
 
 	for _, tt := range tests {
@@ -166,6 +356,115 @@ func TestRestoreControllerUpdateRestore(t *testing.T) {
 	}
 }
 
+func TestRestoreControllerAddRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	restore := newRestore()
+	restore.Spec.Mode = v1alpha1.RestoreModePiTR
+	restore.Status.PiTRPhase = v1alpha1.RestorePiTRFullRestore
+	restore.Status.Conditions = []v1alpha1.RestoreCondition{
+		{
+			Type:   v1alpha1.RestoreRunning,
+			Status: corev1.ConditionTrue,
+		},
+	}
+
+	// the update in the same phase doesn't sync the restore
+	rtc, _, _ := newFakeRestoreController()
+	rtc.updateRestore(restore)
+	g.Expect(rtc.queue.Len()).To(Equal(0))
+
+	// the restore added after the controller restarts is synced to resume it
+	rtc.addRestore(restore)
+	g.Expect(rtc.queue.Len()).To(Equal(1))
+}
+
+func TestRestoreControllerUpdateJob(t *testing.T) {
+	g := NewGomegaWithT(t)
+	restore := newRestore()
+	restore.Spec.JobNamespace = "jobs"
+	rtc, restoreIndexer, _ := newFakeRestoreController()
+	g.Expect(restoreIndexer.Add(restore)).To(Succeed())
+
+	old := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "jobs",
+			Name:      restore.GetRestoreJobName(),
+			Labels:    label.NewRestore().Restore(restore.Name),
+		},
+	}
+	// the job without a new failed pod doesn't sync the restore
+	cur := old.DeepCopy()
+	rtc.updateJob(old, cur)
+	g.Expect(rtc.queue.Len()).To(Equal(0))
+
+	// the restore of the job in another namespace is synced for the new failed pod
+	cur.Status.Failed = 1
+	rtc.updateJob(old, cur)
+	g.Expect(rtc.queue.Len()).To(Equal(1))
+}
+
+func TestRestoreControllerRequeueRestore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	restore := newRestore()
+	restore.Spec.Mode = v1alpha1.RestoreModeVolumeSnapshot
+	rtc, restoreIndexer, restoreControl := newFakeRestoreController()
+	g.Expect(restoreIndexer.Add(restore)).To(Succeed())
+	key, err := cache.MetaNamespaceKeyFunc(restore)
+	g.Expect(err).To(Succeed())
+
+	// the waiting restore is requeued with backoff and its next retry time is recorded
+	restoreControl.SetUpdateRestoreError(controller.ClusterWaitErrorf("waiting for tikv ready"), 0)
+	rtc.queue.Add(key)
+	start := time.Now()
+	g.Expect(rtc.processNextWorkItem()).To(BeTrue())
+	g.Expect(rtc.queue.NumRequeues(key)).To(Equal(1))
+	g.Expect(rtc.queue.Len()).To(Equal(0))
+	g.Expect(restoreControl.status).NotTo(BeNil())
+	nextRetryTime := restoreControl.status.NextRetryTime
+	g.Expect(nextRetryTime).NotTo(BeNil())
+	g.Expect(nextRetryTime.Time).To(BeTemporally(">=", start.Add(restoreRetryBaseDelay).Truncate(time.Second)))
+	g.Expect(nextRetryTime.Time).To(BeTemporally("<=", time.Now().Add(restoreRetryBaseDelay*2)))
+
+	// the next retry time is cleared after the wait is over
+	restore.Status.NextRetryTime = nextRetryTime
+	g.Expect(restoreIndexer.Update(restore)).To(Succeed())
+	restoreControl.status = nil
+	rtc.queue.Add(key)
+	g.Expect(rtc.processNextWorkItem()).To(BeTrue())
+	g.Expect(rtc.queue.NumRequeues(key)).To(Equal(0))
+	g.Expect(restoreControl.status).NotTo(BeNil())
+	g.Expect(restoreControl.status.NextRetryTime.IsZero()).To(BeTrue())
+
+	// the next retry time is not recorded for the other waits
+	restore.Status.NextRetryTime = nil
+	g.Expect(restoreIndexer.Update(restore)).To(Succeed())
+	restoreControl.status = nil
+	restoreControl.SetUpdateRestoreError(controller.RequeueErrorf("waiting for job"), 0)
+	rtc.queue.Add(key)
+	g.Expect(rtc.processNextWorkItem()).To(BeTrue())
+	g.Expect(rtc.queue.NumRequeues(key)).To(Equal(1))
+	g.Expect(restoreControl.status).To(BeNil())
+}
+
+func TestIsOnlyNextRetryTimeUpdated(t *testing.T) {
+	g := NewGomegaWithT(t)
+	old := newRestore()
+	cur := old.DeepCopy()
+	g.Expect(isOnlyNextRetryTimeUpdated(old, cur)).To(BeFalse())
+
+	nextRetryTime := metav1.Now()
+	cur.Status.NextRetryTime = &nextRetryTime
+	g.Expect(isOnlyNextRetryTimeUpdated(old, cur)).To(BeTrue())
+
+	cur.Status.Phase = v1alpha1.RestoreVolumeComplete
+	g.Expect(isOnlyNextRetryTimeUpdated(old, cur)).To(BeFalse())
+
+	cur = old.DeepCopy()
+	cur.Status.NextRetryTime = &nextRetryTime
+	cur.Spec.FederalVolumeRestorePhase = v1alpha1.FederalVolumeRestoreFinish
+	g.Expect(isOnlyNextRetryTimeUpdated(old, cur)).To(BeFalse())
+}
+
 func TestRestoreControllerSync(t *testing.T) {
 	g := NewGomegaWithT(t)
 	tests := []struct {
@@ -0,0 +1,215 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// ActiveRestore is the JSON shape of an active restore returned by the status handler
+type ActiveRestore struct {
+	Namespace      string                        `json:"namespace"`
+	Name           string                        `json:"name"`
+	Phase          v1alpha1.RestoreConditionType `json:"phase"`
+	ProgressStep   string                        `json:"progressStep,omitempty"`
+	Progress       float64                       `json:"progress"`
+	ElapsedSeconds int64                         `json:"elapsedSeconds"`
+	TargetCluster  string                        `json:"targetCluster,omitempty"`
+}
+
+// StatusHandler serves the active restores from the informer cache.
+// It only reads the restores the operator is already allowed to watch, and the namespace other than the
+// one of the operator is rejected if the operator is not cluster scoped. The bearer token of the request is
+// authenticated by TokenReview, and its user must be allowed to list the restores by SubjectAccessReview.
+type StatusHandler struct {
+	lister    listers.RestoreLister
+	hasSynced cache.InformerSynced
+	kubeCli   kubernetes.Interface
+	// namespace is the only namespace the operator watches, it's empty if the operator is cluster scoped
+	namespace string
+	now       func() time.Time
+}
+
+// NewStatusHandler creates a restore status handler of the operator running in the namespace.
+func NewStatusHandler(deps *controller.Dependencies, ns string) *StatusHandler {
+	h := &StatusHandler{
+		lister:    deps.RestoreLister,
+		hasSynced: deps.InformerFactory.Pingcap().V1alpha1().Restores().Informer().HasSynced,
+		kubeCli:   deps.KubeClientset,
+		now:       time.Now,
+	}
+	if !deps.CLIConfig.ClusterScoped {
+		h.namespace = ns
+	}
+	return h
+}
+
+// ServeHTTP lists the active restores, an optional `namespace` query parameter filters the result.
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	ns := r.URL.Query().Get("namespace")
+	if h.namespace != "" {
+		if ns != "" && ns != h.namespace {
+			http.Error(w, fmt.Sprintf("namespace %s is not managed by tidb-operator", ns), http.StatusForbidden)
+			return
+		}
+		ns = h.namespace
+	}
+	if code, err := h.authorize(r, ns); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	// the informers are only started by the leader
+	if !h.hasSynced() {
+		http.Error(w, "restore cache is not synced", http.StatusServiceUnavailable)
+		return
+	}
+
+	var (
+		restores []*v1alpha1.Restore
+		err      error
+	)
+	if ns != "" {
+		restores, err = h.lister.Restores(ns).List(labels.Everything())
+	} else {
+		restores, err = h.lister.List(labels.Everything())
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := []ActiveRestore{}
+	for _, restore := range restores {
+		if v1alpha1.IsRestoreComplete(restore) || v1alpha1.IsRestoreFailed(restore) || v1alpha1.IsRestoreCanceled(restore) ||
+			v1alpha1.IsRestoreInvalid(restore) || v1alpha1.IsRestoreDryRunComplete(restore) {
+			continue
+		}
+		result = append(result, h.activeRestore(restore))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		klog.Errorf("failed to encode active restores, err: %v", err)
+	}
+}
+
+// authorize authenticates the bearer token of the request by TokenReview, and checks whether its user can list
+// the restores in the namespace, or in all namespaces if it's empty, by SubjectAccessReview. The status code of
+// the response is returned with the error if the request is not allowed.
+func (h *StatusHandler) authorize(r *http.Request, ns string) (int, error) {
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	if !strings.HasPrefix(auth, "Bearer ") || token == "" {
+		return http.StatusUnauthorized, fmt.Errorf("bearer token is required")
+	}
+
+	tr, err := h.kubeCli.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		klog.Errorf("failed to review the token of the restore status request, err: %v", err)
+		return http.StatusInternalServerError, fmt.Errorf("failed to authenticate the request")
+	}
+	if !tr.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("bearer token is not authenticated")
+	}
+
+	user := tr.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := h.kubeCli.AuthorizationV1().SubjectAccessReviews().Create(r.Context(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "list",
+				Group:     v1alpha1.SchemeGroupVersion.Group,
+				Resource:  "restores",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		klog.Errorf("failed to review the access of user %s to the restores, err: %v", user.Username, err)
+		return http.StatusInternalServerError, fmt.Errorf("failed to authorize the request")
+	}
+	if !sar.Status.Allowed {
+		scope := "all namespaces"
+		if ns != "" {
+			scope = fmt.Sprintf("namespace %s", ns)
+		}
+		return http.StatusForbidden, fmt.Errorf("user %s is not allowed to list restores in %s", user.Username, scope)
+	}
+	return 0, nil
+}
+
+func (h *StatusHandler) activeRestore(restore *v1alpha1.Restore) ActiveRestore {
+	ar := ActiveRestore{
+		Namespace: restore.Namespace,
+		Name:      restore.Name,
+		Phase:     restore.Status.Phase,
+	}
+	if n := len(restore.Status.Progresses); n > 0 {
+		ar.ProgressStep = restore.Status.Progresses[n-1].Step
+		ar.Progress = restore.Status.Progresses[n-1].Progress
+	}
+
+	started := restore.CreationTimestamp.Time
+	if !restore.Status.TimeStarted.IsZero() {
+		started = restore.Status.TimeStarted.Time
+	}
+	ar.ElapsedSeconds = int64(h.now().Sub(started).Seconds())
+
+	if restore.Spec.BR != nil {
+		clusterNamespace := restore.Spec.BR.ClusterNamespace
+		if clusterNamespace == "" {
+			clusterNamespace = restore.Namespace
+		}
+		ar.TargetCluster = fmt.Sprintf("%s/%s", clusterNamespace, restore.Spec.BR.Cluster)
+	} else if restore.Spec.To != nil {
+		ar.TargetCluster = restore.Spec.To.Host
+	}
+	return ar
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/controller"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	now := time.Now()
+	deps := controller.NewSimpleClientDependencies()
+	indexer := deps.InformerFactory.Pingcap().V1alpha1().Restores().Informer().GetIndexer()
+
+	running := newRestore()
+	running.Namespace = "ns-1"
+	running.Name = "running"
+	running.Spec.BR = &v1alpha1.BRConfig{Cluster: "demo", ClusterNamespace: "tidb"}
+	running.Status.Phase = v1alpha1.RestoreRunning
+	running.Status.TimeStarted = metav1.Time{Time: now.Add(-time.Minute)}
+	running.Status.Progresses = []v1alpha1.Progress{
+		{Step: "Full Restore", Progress: 42},
+	}
+	g.Expect(indexer.Add(running)).To(Succeed())
+
+	scheduled := newRestore()
+	scheduled.Namespace = "ns-2"
+	scheduled.Name = "scheduled"
+	scheduled.CreationTimestamp = metav1.Time{Time: now.Add(-10 * time.Second)}
+	scheduled.Spec.To = &v1alpha1.TiDBAccessConfig{Host: "demo-tidb.ns-2"}
+	scheduled.Status.Phase = v1alpha1.RestoreScheduled
+	g.Expect(indexer.Add(scheduled)).To(Succeed())
+
+	complete := newRestore()
+	complete.Namespace = "ns-1"
+	complete.Name = "complete"
+	complete.Status.Phase = v1alpha1.RestoreComplete
+	complete.Status.Conditions = []v1alpha1.RestoreCondition{
+		{Type: v1alpha1.RestoreComplete, Status: corev1.ConditionTrue},
+	}
+	g.Expect(indexer.Add(complete)).To(Succeed())
+
+	// the token "admin" can list the restores in all namespaces, the token "dev" can only list them in ns-2
+	kubeCli := deps.KubeClientset.(*kubefake.Clientset)
+	kubeCli.PrependReactor("create", "tokenreviews", func(action core.Action) (bool, runtime.Object, error) {
+		tr := action.(core.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if tr.Spec.Token == "admin" || tr.Spec.Token == "dev" {
+			tr.Status.Authenticated = true
+			tr.Status.User.Username = tr.Spec.Token
+		}
+		return true, tr, nil
+	})
+	kubeCli.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+		sar := action.(core.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		sar.Status.Allowed = attrs.Verb == "list" && attrs.Group == "pingcap.com" && attrs.Resource == "restores" &&
+			(sar.Spec.User == "admin" || (sar.Spec.User == "dev" && attrs.Namespace == "ns-2"))
+		return true, sar, nil
+	})
+
+	synced := false
+	h := &StatusHandler{
+		lister:    deps.RestoreLister,
+		hasSynced: func() bool { return synced },
+		kubeCli:   kubeCli,
+		now:       func() time.Time { return now },
+	}
+
+	request := func(method, url, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(method, url string) *httptest.ResponseRecorder {
+		return request(method, url, "admin")
+	}
+
+	// the request without an authenticated token or not allowed to list the restores is rejected
+	g.Expect(request(http.MethodGet, "/restores", "").Code).To(Equal(http.StatusUnauthorized))
+	g.Expect(request(http.MethodGet, "/restores", "unknown").Code).To(Equal(http.StatusUnauthorized))
+	g.Expect(request(http.MethodGet, "/restores", "dev").Code).To(Equal(http.StatusForbidden))
+	g.Expect(request(http.MethodGet, "/restores?namespace=ns-1", "dev").Code).To(Equal(http.StatusForbidden))
+
+	g.Expect(get(http.MethodGet, "/restores").Code).To(Equal(http.StatusServiceUnavailable))
+	synced = true
+	g.Expect(get(http.MethodDelete, "/restores").Code).To(Equal(http.StatusMethodNotAllowed))
+
+	rec := get(http.MethodGet, "/restores")
+	g.Expect(rec.Code).To(Equal(http.StatusOK))
+	var result []ActiveRestore
+	g.Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+	g.Expect(result).To(Equal([]ActiveRestore{
+		{
+			Namespace:      "ns-1",
+			Name:           "running",
+			Phase:          v1alpha1.RestoreRunning,
+			ProgressStep:   "Full Restore",
+			Progress:       42,
+			ElapsedSeconds: 60,
+			TargetCluster:  "tidb/demo",
+		},
+		{
+			Namespace:      "ns-2",
+			Name:           "scheduled",
+			Phase:          v1alpha1.RestoreScheduled,
+			ElapsedSeconds: 10,
+			TargetCluster:  "demo-tidb.ns-2",
+		},
+	}))
+
+	rec = get(http.MethodGet, "/restores?namespace=ns-2")
+	g.Expect(rec.Code).To(Equal(http.StatusOK))
+	g.Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+	g.Expect(result).To(HaveLen(1))
+	g.Expect(result[0].Name).To(Equal("scheduled"))
+
+	rec = request(http.MethodGet, "/restores?namespace=ns-2", "dev")
+	g.Expect(rec.Code).To(Equal(http.StatusOK))
+	g.Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+	g.Expect(result).To(HaveLen(1))
+	g.Expect(result[0].Name).To(Equal("scheduled"))
+
+	// the operator not cluster scoped only serves the restores in its namespace
+	h.namespace = "ns-2"
+	g.Expect(get(http.MethodGet, "/restores?namespace=ns-1").Code).To(Equal(http.StatusForbidden))
+	rec = request(http.MethodGet, "/restores", "dev")
+	g.Expect(rec.Code).To(Equal(http.StatusOK))
+	g.Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+	g.Expect(result).To(HaveLen(1))
+	g.Expect(result[0].Name).To(Equal("scheduled"))
+}
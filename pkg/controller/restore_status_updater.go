@@ -16,12 +16,16 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
 	"github.com/pingcap/tidb-operator/pkg/client/clientset/versioned"
 	informers "github.com/pingcap/tidb-operator/pkg/client/informers/externalversions/pingcap/v1alpha1"
 	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
@@ -40,14 +44,57 @@ type RestoreUpdateStatus struct {
 	TimeCompleted *metav1.Time
 	// CommitTs is the snapshot time point of tidb cluster.
 	CommitTs *string
+	// RestoredTs is the ts the data of tidb cluster is restored to.
+	RestoredTs *string
 	// ProgressStep the step name of progress.
 	ProgressStep *string
 	// Progress is the step's progress value.
 	Progress *float64
 	// ProgressUpdateTime is the progress update time.
 	ProgressUpdateTime *metav1.Time
+	// VolumeRehearsal is the result of the volume rehearsal.
+	VolumeRehearsal *v1alpha1.VolumeRehearsalStatus
+	// OrphanedVolumes records the volumes left by a failed volume snapshot restore.
+	OrphanedVolumes *v1alpha1.OrphanedVolumesStatus
+	// ResourceUsage is the resource consumed by the restore job.
+	ResourceUsage *v1alpha1.RestoreResourceUsage
+	// RecoveryPlacement records the placement constraints applied to TiKV in the restore-finish phase.
+	RecoveryPlacement *v1alpha1.RecoveryPlacementStatus
+	// ObservedGeneration is the generation of the restore spec that the latest restore job is created from.
+	ObservedGeneration *int64
+	// Rehydration is the progress of rehydrating the backup objects archived in the cold storage tier.
+	Rehydration *v1alpha1.RehydrationStatus
+	// CorrelationID is the correlation id of the restore used for tracing.
+	CorrelationID *string
+	// VolumeAZ is the AZ the volume snapshots restore to.
+	VolumeAZ *string
+	// VolumeAZPlan maps the AZ of every backup volume to the AZ it restores to.
+	VolumeAZPlan map[string]string
+	// SubJob is the state of a job created by the restore.
+	SubJob *v1alpha1.RestoreSubJobStatus
+	// PiTRPhase is the phase of a PiTR restore.
+	PiTRPhase *v1alpha1.RestorePiTRPhase
+	// StoragePath is the path of the storage the backup data is restored from.
+	StoragePath *string
+	// PDWaitStartTime is the time at which the restore starts to wait for all the PD members ready, the zero time clears it.
+	PDWaitStartTime *metav1.Time
+	// TiKVRestartStartTime is the time at which the TiKV pods start to be restarted in waves.
+	TiKVRestartStartTime *metav1.Time
+	// TaggedVolumes are the IDs of the volumes tagged in volume snapshot restore, they replace the recorded ones.
+	TaggedVolumes []string
+	// NextRetryTime is the time at which the waiting restore is synced again, the zero time clears it.
+	NextRetryTime *metav1.Time
+	// ValidationResult is the result of comparing the backup meta with the target tidbcluster.
+	ValidationResult *v1alpha1.RestoreValidationResult
 }
 
+// maxRestoreEventMessageLength is the max length of the condition message in a restore event
+const maxRestoreEventMessageLength = 256
+
+// restoreConditionDebounceWindow is the window in which the identical consecutive conditions of a restore,
+// with the same type, status and reason, are collapsed into the first write
+const restoreConditionDebounceWindow = 10 * time.Second
+
 // RestoreConditionUpdaterInterface enables updating Restore conditions.
 type RestoreConditionUpdaterInterface interface {
 	Update(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *RestoreUpdateStatus) error
@@ -57,6 +104,20 @@ type realRestoreConditionUpdater struct {
 	cli           versioned.Interface
 	restoreLister listers.RestoreLister
 	recorder      record.EventRecorder
+
+	mu sync.Mutex
+	// lastConditions are the last conditions written to the restores, keyed by the namespace, name and uid
+	lastConditions map[string]*writtenRestoreCondition
+}
+
+// writtenRestoreCondition is a condition written to a restore at the time, with the phase of the restore after it.
+// The message changed within the debounce window is pending and written when the window ends.
+type writtenRestoreCondition struct {
+	condition v1alpha1.RestoreCondition
+	phase     v1alpha1.RestoreConditionType
+	time      time.Time
+	pending   *v1alpha1.RestoreCondition
+	timer     *time.Timer
 }
 
 // returns a RestoreConditionUpdaterInterface that updates the Status of a Restore,
@@ -65,17 +126,28 @@ func NewRealRestoreConditionUpdater(
 	restoreLister listers.RestoreLister,
 	recorder record.EventRecorder) RestoreConditionUpdaterInterface {
 	return &realRestoreConditionUpdater{
-		cli:           cli,
-		restoreLister: restoreLister,
-		recorder:      recorder,
+		cli:            cli,
+		restoreLister:  restoreLister,
+		recorder:       recorder,
+		lastConditions: map[string]*writtenRestoreCondition{},
 	}
 }
 
 func (u *realRestoreConditionUpdater) Update(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *RestoreUpdateStatus) error {
+	if newStatus == nil && u.isDebounced(restore, condition) {
+		klog.V(4).Infof("Restore: [%s/%s] condition %s is written within %s, skip updating", restore.GetNamespace(), restore.GetName(), condition.Type, restoreConditionDebounceWindow)
+		return nil
+	}
+	return u.update(restore, condition, newStatus)
+}
+
+func (u *realRestoreConditionUpdater) update(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, newStatus *RestoreUpdateStatus) error {
 	ns := restore.GetNamespace()
 	restoreName := restore.GetName()
+	debounceKey := restoreDebounceKey(restore)
 	var isStatusUpdate bool
 	var isConditionUpdate bool
+	var isConditionTransition bool
 	// try best effort to guarantee restore is updated.
 	err := retry.OnError(retry.DefaultRetry, func(e error) bool { return e != nil }, func() error {
 		// Always get the latest restore before update.
@@ -86,6 +158,7 @@ func (u *realRestoreConditionUpdater) Update(restore *v1alpha1.Restore, conditio
 			utilruntime.HandleError(fmt.Errorf("error getting updated restore %s/%s from lister: %v", ns, restoreName, err))
 			return err
 		}
+		isConditionTransition = isRestoreConditionTransition(&restore.Status, condition)
 		isStatusUpdate = updateRestoreStatus(&restore.Status, newStatus)
 		isConditionUpdate = v1alpha1.UpdateRestoreCondition(&restore.Status, condition)
 		if isStatusUpdate || isConditionUpdate {
@@ -99,9 +172,160 @@ func (u *realRestoreConditionUpdater) Update(restore *v1alpha1.Restore, conditio
 		}
 		return nil
 	})
+	if err == nil && condition != nil {
+		u.recordWrittenCondition(debounceKey, condition, restore.Status.Phase)
+	}
+	if err == nil && isConditionTransition {
+		u.recordRestoreConditionEvent(restore, condition)
+	}
 	return err
 }
 
+// isDebounced returns true if the condition has the same type, status and reason as the last one written to the
+// restore within restoreConditionDebounceWindow and the restore is not changed by others since then. Writing it
+// again only changes the message at most, the LastTransitionTime is kept as the condition status is unchanged.
+// The changed message is not dropped but written when the window ends, so the latest message is shown.
+func (u *realRestoreConditionUpdater) isDebounced(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition) bool {
+	if condition == nil {
+		return false
+	}
+	key := restoreDebounceKey(restore)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	last, ok := u.lastConditions[key]
+	if !ok || !u.isSameAsCurrent(restore, &last.condition, last.phase) {
+		return false
+	}
+	elapsed := time.Since(last.time)
+	if elapsed >= restoreConditionDebounceWindow ||
+		last.condition.Type != condition.Type ||
+		last.condition.Status != condition.Status ||
+		last.condition.Reason != condition.Reason {
+		return false
+	}
+	if condition.Message == last.condition.Message {
+		last.pending = nil
+		return true
+	}
+	pending := *condition
+	last.pending = &pending
+	if last.timer == nil {
+		restore := restore.DeepCopy()
+		last.timer = time.AfterFunc(restoreConditionDebounceWindow-elapsed, func() {
+			u.flushPendingCondition(key, restore)
+		})
+	}
+	return true
+}
+
+// isSameAsCurrent returns true if the restore in the lister is in the phase and has the condition with the same
+// status and reason
+func (u *realRestoreConditionUpdater) isSameAsCurrent(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition, phase v1alpha1.RestoreConditionType) bool {
+	current, err := u.restoreLister.Restores(restore.GetNamespace()).Get(restore.GetName())
+	if err != nil || current.UID != restore.GetUID() || current.Status.Phase != phase {
+		return false
+	}
+	_, currentCondition := v1alpha1.GetRestoreCondition(&current.Status, condition.Type)
+	return currentCondition != nil && currentCondition.Status == condition.Status && currentCondition.Reason == condition.Reason
+}
+
+// flushPendingCondition writes the message of the condition debounced in the window that just ended, it's skipped
+// if the condition or the phase of the restore is changed since the window started.
+func (u *realRestoreConditionUpdater) flushPendingCondition(key string, restore *v1alpha1.Restore) {
+	u.mu.Lock()
+	last, ok := u.lastConditions[key]
+	if !ok {
+		u.mu.Unlock()
+		return
+	}
+	if last.timer != nil {
+		last.timer.Stop()
+	}
+	pending, phase := last.pending, last.phase
+	last.pending, last.timer = nil, nil
+	if pending == nil {
+		u.mu.Unlock()
+		return
+	}
+	isSame := u.isSameAsCurrent(restore, pending, phase)
+	u.mu.Unlock()
+	if !isSame {
+		return
+	}
+	if err := u.update(restore, pending, nil); err != nil {
+		klog.Warningf("Restore: [%s/%s] failed to write the debounced condition %s, %v", restore.GetNamespace(), restore.GetName(), pending.Type, err)
+	}
+}
+
+// recordWrittenCondition records the last condition written to the restore, it supersedes the pending message.
+// The expired records of the other restores are dropped by the way.
+func (u *realRestoreConditionUpdater) recordWrittenCondition(key string, condition *v1alpha1.RestoreCondition, phase v1alpha1.RestoreConditionType) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	for k, last := range u.lastConditions {
+		if now.Sub(last.time) >= restoreConditionDebounceWindow && last.timer == nil {
+			delete(u.lastConditions, k)
+		}
+	}
+	if last, ok := u.lastConditions[key]; ok && last.timer != nil {
+		last.timer.Stop()
+	}
+	u.lastConditions[key] = &writtenRestoreCondition{
+		condition: *condition,
+		phase:     phase,
+		time:      now,
+	}
+}
+
+// restoreDebounceKey returns the key of the restore, the uid distinguishes the restore recreated with the same name
+func restoreDebounceKey(restore *v1alpha1.Restore) string {
+	return fmt.Sprintf("%s/%s/%s", restore.GetNamespace(), restore.GetName(), restore.GetUID())
+}
+
+// isRestoreConditionTransition returns true if the condition is new or its status, reason or message is changed,
+// so the repeated identical conditions don't emit events again.
+func isRestoreConditionTransition(status *v1alpha1.RestoreStatus, condition *v1alpha1.RestoreCondition) bool {
+	if condition == nil {
+		return false
+	}
+	_, oldCondition := v1alpha1.GetRestoreCondition(status, condition.Type)
+	return oldCondition == nil ||
+		oldCondition.Status != condition.Status ||
+		oldCondition.Reason != condition.Reason ||
+		oldCondition.Message != condition.Message
+}
+
+// recordRestoreConditionEvent emits an event for the condition, the failures and the allowed replica mismatch
+// are warnings and the others are normal.
+func (u *realRestoreConditionUpdater) recordRestoreConditionEvent(restore *v1alpha1.Restore, condition *v1alpha1.RestoreCondition) {
+	if u.recorder == nil || condition.Status != corev1.ConditionTrue {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	switch condition.Type {
+	case v1alpha1.RestoreRetryFailed, v1alpha1.RestoreInvalid, v1alpha1.RestoreFailed, v1alpha1.RestoreReplicasMismatched:
+		eventType = corev1.EventTypeWarning
+	}
+	reason := condition.Reason
+	if reason == "" {
+		reason = string(condition.Type)
+	}
+	message := fmt.Sprintf("restore condition %s", condition.Type)
+	if condition.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, truncateEventMessage(condition.Message, maxRestoreEventMessageLength))
+	}
+	u.recorder.Event(restore, eventType, reason, message)
+}
+
+// truncateEventMessage truncates the message to at most maxLen bytes
+func truncateEventMessage(message string, maxLen int) string {
+	if len(message) <= maxLen {
+		return message
+	}
+	return message[:maxLen-3] + "..."
+}
+
 // updateRestoreStatus updates existing Restore status
 // from the fields in RestoreUpdateStatus.
 func updateRestoreStatus(status *v1alpha1.RestoreStatus, newStatus *RestoreUpdateStatus) bool {
@@ -122,17 +346,112 @@ func updateRestoreStatus(status *v1alpha1.RestoreStatus, newStatus *RestoreUpdat
 		status.CommitTs = *newStatus.CommitTs
 		isUpdate = true
 	}
+	if newStatus.RestoredTs != nil && status.RestoredTs != *newStatus.RestoredTs {
+		status.RestoredTs = *newStatus.RestoredTs
+		isUpdate = true
+	}
 	if newStatus.ProgressStep != nil {
 		progresses, updated := updateBRProgress(status.Progresses, newStatus.ProgressStep, newStatus.Progress, newStatus.ProgressUpdateTime)
 		if updated {
 			status.Progresses = progresses
+			status.CurrentProgress = currentRestoreProgress(progresses)
+			isUpdate = true
+		}
+	}
+	if newStatus.VolumeRehearsal != nil && !apiequality.Semantic.DeepEqual(status.VolumeRehearsal, newStatus.VolumeRehearsal) {
+		status.VolumeRehearsal = newStatus.VolumeRehearsal
+		isUpdate = true
+	}
+	if newStatus.OrphanedVolumes != nil && !apiequality.Semantic.DeepEqual(status.OrphanedVolumes, newStatus.OrphanedVolumes) {
+		status.OrphanedVolumes = newStatus.OrphanedVolumes
+		isUpdate = true
+	}
+	if newStatus.ResourceUsage != nil && !apiequality.Semantic.DeepEqual(status.ResourceUsage, newStatus.ResourceUsage) {
+		status.ResourceUsage = newStatus.ResourceUsage
+		isUpdate = true
+	}
+	if newStatus.RecoveryPlacement != nil && !apiequality.Semantic.DeepEqual(status.RecoveryPlacement, newStatus.RecoveryPlacement) {
+		status.RecoveryPlacement = newStatus.RecoveryPlacement
+		isUpdate = true
+	}
+	if newStatus.ObservedGeneration != nil && status.ObservedGeneration != *newStatus.ObservedGeneration {
+		status.ObservedGeneration = *newStatus.ObservedGeneration
+		isUpdate = true
+	}
+	if newStatus.Rehydration != nil && !apiequality.Semantic.DeepEqual(status.Rehydration, newStatus.Rehydration) {
+		status.Rehydration = newStatus.Rehydration
+		isUpdate = true
+	}
+	if newStatus.CorrelationID != nil && status.CorrelationID != *newStatus.CorrelationID {
+		status.CorrelationID = *newStatus.CorrelationID
+		isUpdate = true
+	}
+	if newStatus.VolumeAZ != nil && status.VolumeAZ != *newStatus.VolumeAZ {
+		status.VolumeAZ = *newStatus.VolumeAZ
+		isUpdate = true
+	}
+	if newStatus.VolumeAZPlan != nil && !apiequality.Semantic.DeepEqual(status.VolumeAZPlan, newStatus.VolumeAZPlan) {
+		status.VolumeAZPlan = newStatus.VolumeAZPlan
+		isUpdate = true
+	}
+	if v1alpha1.UpdateRestoreSubJob(status, newStatus.SubJob) {
+		isUpdate = true
+	}
+	if newStatus.PiTRPhase != nil && status.PiTRPhase != *newStatus.PiTRPhase {
+		status.PiTRPhase = *newStatus.PiTRPhase
+		isUpdate = true
+	}
+	if newStatus.StoragePath != nil && status.StoragePath != *newStatus.StoragePath {
+		status.StoragePath = *newStatus.StoragePath
+		isUpdate = true
+	}
+	if newStatus.PDWaitStartTime != nil {
+		if newStatus.PDWaitStartTime.IsZero() {
+			if status.PDWaitStartTime != nil {
+				status.PDWaitStartTime = nil
+				isUpdate = true
+			}
+		} else if status.PDWaitStartTime == nil || !status.PDWaitStartTime.Equal(newStatus.PDWaitStartTime) {
+			status.PDWaitStartTime = newStatus.PDWaitStartTime
+			isUpdate = true
+		}
+	}
+	if newStatus.TiKVRestartStartTime != nil && (status.TiKVRestartStartTime == nil || !status.TiKVRestartStartTime.Equal(newStatus.TiKVRestartStartTime)) {
+		status.TiKVRestartStartTime = newStatus.TiKVRestartStartTime
+		isUpdate = true
+	}
+	if newStatus.TaggedVolumes != nil && !apiequality.Semantic.DeepEqual(status.TaggedVolumes, newStatus.TaggedVolumes) {
+		status.TaggedVolumes = newStatus.TaggedVolumes
+		isUpdate = true
+	}
+	if newStatus.NextRetryTime != nil {
+		if newStatus.NextRetryTime.IsZero() {
+			if status.NextRetryTime != nil {
+				status.NextRetryTime = nil
+				isUpdate = true
+			}
+		} else if status.NextRetryTime == nil || !status.NextRetryTime.Equal(newStatus.NextRetryTime) {
+			status.NextRetryTime = newStatus.NextRetryTime
 			isUpdate = true
 		}
 	}
+	if newStatus.ValidationResult != nil && !apiequality.Semantic.DeepEqual(status.ValidationResult, newStatus.ValidationResult) {
+		status.ValidationResult = newStatus.ValidationResult
+		isUpdate = true
+	}
 
 	return isUpdate
 }
 
+// currentRestoreProgress returns the step and percent of the latest progress, which is shown by `kubectl get restore`
+func currentRestoreProgress(progresses []v1alpha1.Progress) string {
+	if len(progresses) == 0 {
+		return ""
+	}
+	p := progresses[len(progresses)-1]
+	return fmt.Sprintf("%s %s%%", p.Step, strconv.FormatFloat(p.Progress, 'f', 1, 64))
+}
+
 var _ RestoreConditionUpdaterInterface = &realRestoreConditionUpdater{}
 
 // FakeRestoreConditionUpdater is a fake RestoreConditionUpdaterInterface
@@ -14,12 +14,20 @@
 package controller
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/pingcap/tidb-operator/pkg/apis/pingcap/v1alpha1"
+	"github.com/pingcap/tidb-operator/pkg/client/clientset/versioned/fake"
+	listers "github.com/pingcap/tidb-operator/pkg/client/listers/pingcap/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestUpdateRestoreStatus(t *testing.T) {
@@ -57,12 +65,72 @@ func TestUpdateRestoreStatus(t *testing.T) {
 	}
 }
 
+func TestRestoreConditionUpdaterEvents(t *testing.T) {
+	g := NewGomegaWithT(t)
+	recorder := record.NewFakeRecorder(10)
+	fakeClient := &fake.Clientset{}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	fakeClient.AddReactor("update", "restores", func(action core.Action) (bool, runtime.Object, error) {
+		update := action.(core.UpdateAction)
+		return true, update.GetObject(), indexer.Update(update.GetObject())
+	})
+	rs := newRestore()
+	g.Expect(indexer.Add(rs)).To(Succeed())
+	updater := NewRealRestoreConditionUpdater(fakeClient, listers.NewRestoreLister(indexer), recorder)
+
+	expectEvent := func(event string) {
+		select {
+		case e := <-recorder.Events:
+			g.Expect(e).To(Equal(event))
+		default:
+			t.Fatalf("expect event %q", event)
+		}
+	}
+	expectNoEvent := func() {
+		select {
+		case e := <-recorder.Events:
+			t.Fatalf("unexpected event %q", e)
+		default:
+		}
+	}
+
+	g.Expect(updater.Update(rs, &v1alpha1.RestoreCondition{
+		Type:   v1alpha1.RestoreScheduled,
+		Status: corev1.ConditionTrue,
+	}, nil)).To(Succeed())
+	expectEvent("Normal Scheduled restore condition Scheduled")
+
+	// the repeated identical condition doesn't emit an event
+	g.Expect(updater.Update(rs, &v1alpha1.RestoreCondition{
+		Type:   v1alpha1.RestoreScheduled,
+		Status: corev1.ConditionTrue,
+	}, nil)).To(Succeed())
+	expectNoEvent()
+
+	g.Expect(updater.Update(rs, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreRetryFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "AddVolumeTagFailed",
+		Message: strings.Repeat("x", 300),
+	}, nil)).To(Succeed())
+	expectEvent("Warning AddVolumeTagFailed restore condition RetryFailed: " + strings.Repeat("x", 253) + "...")
+
+	g.Expect(updater.Update(rs, &v1alpha1.RestoreCondition{
+		Type:    v1alpha1.RestoreInvalid,
+		Status:  corev1.ConditionTrue,
+		Reason:  "InvalidSpec",
+		Message: "invalid",
+	}, nil)).To(Succeed())
+	expectEvent("Warning InvalidSpec restore condition Invalid: invalid")
+}
+
 func newUpdateRestoreStatus() *RestoreUpdateStatus {
 	ts := "421762809912885269"
 	start, _ := time.Parse(time.RFC3339, "2020-12-25T21:46:59Z")
 	end, _ := time.Parse(time.RFC3339, "2020-12-25T21:50:59Z")
 	return &RestoreUpdateStatus{
 		CommitTs:      &ts,
+		RestoredTs:    &ts,
 		TimeCompleted: &metav1.Time{Time: end},
 		TimeStarted:   &metav1.Time{Time: start},
 	}
@@ -99,8 +167,125 @@ func newExpectRestoreStatus() *v1alpha1.RestoreStatus {
 	end, _ := time.Parse(time.RFC3339, "2020-12-25T21:50:59Z")
 	s := newRestoreStatus()
 	s.CommitTs = ts
+	s.RestoredTs = ts
 	s.TimeStarted = metav1.Time{Time: start}
 	s.TimeCompleted = metav1.Time{Time: end}
 	s.TimeTaken = "4m0s"
 	return s
 }
+
+func TestRestoreConditionUpdaterDebounce(t *testing.T) {
+	g := NewGomegaWithT(t)
+	fakeClient := &fake.Clientset{}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	updates := 0
+	fakeClient.AddReactor("update", "restores", func(action core.Action) (bool, runtime.Object, error) {
+		updates++
+		update := action.(core.UpdateAction)
+		return true, update.GetObject(), indexer.Update(update.GetObject())
+	})
+	rs := newRestore()
+	g.Expect(indexer.Add(rs)).To(Succeed())
+	updater := NewRealRestoreConditionUpdater(fakeClient, listers.NewRestoreLister(indexer), nil).(*realRestoreConditionUpdater)
+	retryFailed := func(reason, message string) *v1alpha1.RestoreCondition {
+		return &v1alpha1.RestoreCondition{
+			Type:    v1alpha1.RestoreRetryFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  reason,
+			Message: message,
+		}
+	}
+	getCondition := func() *v1alpha1.RestoreCondition {
+		obj, _, err := indexer.Get(rs)
+		g.Expect(err).To(Succeed())
+		_, condition := v1alpha1.GetRestoreCondition(&obj.(*v1alpha1.Restore).Status, v1alpha1.RestoreRetryFailed)
+		return condition
+	}
+	key := restoreDebounceKey(rs)
+
+	g.Expect(updater.Update(rs, retryFailed("GetTiKVStoresFailed", "timeout 1"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(1))
+	transitionTime := getCondition().LastTransitionTime
+
+	// the identical condition is collapsed within the window
+	g.Expect(updater.Update(rs, retryFailed("GetTiKVStoresFailed", "timeout 1"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(1))
+
+	// the changed message is pending until the window ends, then the latest one is written
+	g.Expect(updater.Update(rs, retryFailed("GetTiKVStoresFailed", "timeout 2"), nil)).To(Succeed())
+	g.Expect(updater.Update(rs, retryFailed("GetTiKVStoresFailed", "timeout 3"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(1))
+	g.Expect(getCondition().Message).To(Equal("timeout 1"))
+	updater.flushPendingCondition(key, rs)
+	g.Expect(updates).To(Equal(2))
+	g.Expect(getCondition().Message).To(Equal("timeout 3"))
+	g.Expect(getCondition().LastTransitionTime).To(Equal(transitionTime))
+
+	// the condition with another reason is written and supersedes the pending message
+	g.Expect(updater.Update(rs, retryFailed("GetTiKVStoresFailed", "timeout 4"), nil)).To(Succeed())
+	g.Expect(updater.Update(rs, retryFailed("GetPDConfigFailed", "timeout 5"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(3))
+	g.Expect(getCondition().Reason).To(Equal("GetPDConfigFailed"))
+	g.Expect(getCondition().LastTransitionTime).To(Equal(transitionTime))
+	updater.flushPendingCondition(key, rs)
+	g.Expect(updates).To(Equal(3))
+	g.Expect(getCondition().Message).To(Equal("timeout 5"))
+
+	// the update of the status is not debounced
+	ts := "421762809912885269"
+	g.Expect(updater.Update(rs, retryFailed("GetPDConfigFailed", "timeout 5"), &RestoreUpdateStatus{CommitTs: &ts})).To(Succeed())
+	g.Expect(updates).To(Equal(4))
+
+	// the condition changed by others is written again
+	obj, _, err := indexer.Get(rs)
+	g.Expect(err).To(Succeed())
+	changed := obj.(*v1alpha1.Restore).DeepCopy()
+	v1alpha1.UpdateRestoreCondition(&changed.Status, &v1alpha1.RestoreCondition{Type: v1alpha1.RestoreRunning, Status: corev1.ConditionTrue})
+	g.Expect(indexer.Update(changed)).To(Succeed())
+	g.Expect(updater.Update(rs, retryFailed("GetPDConfigFailed", "timeout 6"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(5))
+
+	// the same condition is written again after the window
+	updater.mu.Lock()
+	updater.lastConditions[key].time = time.Now().Add(-restoreConditionDebounceWindow)
+	updater.mu.Unlock()
+	g.Expect(updater.Update(rs, retryFailed("GetPDConfigFailed", "timeout 7"), nil)).To(Succeed())
+	g.Expect(updates).To(Equal(6))
+	g.Expect(getCondition().Message).To(Equal("timeout 7"))
+}
+
+func TestUpdateRestoreStatusCurrentProgress(t *testing.T) {
+	g := NewGomegaWithT(t)
+	status := &v1alpha1.RestoreStatus{}
+	update := func(step string, progress float64) bool {
+		return updateRestoreStatus(status, &RestoreUpdateStatus{
+			ProgressStep:       &step,
+			Progress:           &progress,
+			ProgressUpdateTime: &metav1.Time{Time: time.Now()},
+		})
+	}
+
+	g.Expect(update("Full Restore", 45.23)).To(BeTrue())
+	g.Expect(status.CurrentProgress).To(Equal("Full Restore 45.2%"))
+
+	// a new step finishes the previous one
+	g.Expect(update("Checksum", 10)).To(BeTrue())
+	g.Expect(status.CurrentProgress).To(Equal("Checksum 10.0%"))
+	g.Expect(status.Progresses).To(HaveLen(2))
+	g.Expect(status.Progresses[0].Progress).To(Equal(100.0))
+}
+
+func TestUpdateRestoreStatusNextRetryTime(t *testing.T) {
+	g := NewGomegaWithT(t)
+	status := &v1alpha1.RestoreStatus{}
+	nextRetryTime := metav1.NewTime(time.Now().Truncate(time.Second))
+
+	g.Expect(updateRestoreStatus(status, &RestoreUpdateStatus{NextRetryTime: &nextRetryTime})).To(BeTrue())
+	g.Expect(status.NextRetryTime).To(Equal(&nextRetryTime))
+	g.Expect(updateRestoreStatus(status, &RestoreUpdateStatus{NextRetryTime: &nextRetryTime})).To(BeFalse())
+
+	// the zero time clears the next retry time
+	g.Expect(updateRestoreStatus(status, &RestoreUpdateStatus{NextRetryTime: &metav1.Time{}})).To(BeTrue())
+	g.Expect(status.NextRetryTime).To(BeNil())
+	g.Expect(updateRestoreStatus(status, &RestoreUpdateStatus{NextRetryTime: &metav1.Time{}})).To(BeFalse())
+}
@@ -692,7 +692,7 @@ func getNewMasterSetForDMCluster(dc *v1alpha1.DMCluster, cm *corev1.ConfigMap) (
 	masterContainer.EnvFrom = baseMasterSpec.EnvFrom()
 	podSpec.Volumes = append(vols, baseMasterSpec.AdditionalVolumes()...)
 
-	podSpec.Containers, err = MergePatchContainers([]corev1.Container{masterContainer}, baseMasterSpec.AdditionalContainers())
+	podSpec.Containers, err = util.MergePatchContainers([]corev1.Container{masterContainer}, baseMasterSpec.AdditionalContainers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to merge containers spec for DC [%s/%s], error: %v", dc.Namespace, dc.Name, err)
 	}
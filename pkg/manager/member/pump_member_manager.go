@@ -496,7 +496,7 @@ func getNewPumpStatefulSet(tc *v1alpha1.TidbCluster, cm *corev1.ConfigMap) (*app
 	}
 
 	podSpec := spec.BuildPodSpec()
-	podSpec.Containers, err = MergePatchContainers(containers, tc.Spec.Pump.AdditionalContainers)
+	podSpec.Containers, err = util.MergePatchContainers(containers, tc.Spec.Pump.AdditionalContainers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to merge containers spec for Pump of [%s/%s], error: %v", objMeta.Namespace, objMeta.Name, err)
 	}
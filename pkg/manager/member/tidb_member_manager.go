@@ -1007,7 +1007,7 @@ func getNewTiDBSetForTidbCluster(tc *v1alpha1.TidbCluster, cm *corev1.ConfigMap)
 	podSpec := baseTiDBSpec.BuildPodSpec()
 
 	var err error
-	podSpec.Containers, err = MergePatchContainers(containers, baseTiDBSpec.AdditionalContainers())
+	podSpec.Containers, err = util.MergePatchContainers(containers, baseTiDBSpec.AdditionalContainers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to merge containers spec for TiDB of [%s/%s], error: %v", ns, tcName, err)
 	}
@@ -612,7 +612,7 @@ func getNewStatefulSet(tc *v1alpha1.TidbCluster, cm *corev1.ConfigMap) (*apps.St
 	}
 	podSpec.Containers = append([]corev1.Container{tiflashContainer}, containers...)
 
-	podSpec.Containers, err = MergePatchContainers(podSpec.Containers, baseTiFlashSpec.AdditionalContainers())
+	podSpec.Containers, err = util.MergePatchContainers(podSpec.Containers, baseTiFlashSpec.AdditionalContainers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to merge containers spec for TiFlash of [%s/%s], err: %v", ns, tcName, err)
 	}
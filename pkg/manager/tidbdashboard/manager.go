@@ -331,7 +331,7 @@ func generateTiDBDashboardStatefulSet(td *v1alpha1.TidbDashboard, tc *v1alpha1.T
 	builder.PodTemplateSpecBuilder().ContainerBuilder(memberName).AddVolumeMounts(spec.AdditionalVolumeMounts()...)
 	builder.PodTemplateSpecBuilder().AddVolumes(spec.AdditionalVolumes()...)
 	// Additional containers.
-	builder.PodTemplateSpecBuilder().Get().Spec.Containers, err = member.MergePatchContainers(builder.PodTemplateSpecBuilder().Get().Spec.Containers, spec.AdditionalContainers())
+	builder.PodTemplateSpecBuilder().Get().Spec.Containers, err = util.MergePatchContainers(builder.PodTemplateSpecBuilder().Get().Spec.Containers, spec.AdditionalContainers())
 	if err != nil {
 		return nil, fmt.Errorf("failed to merge containers spec for tidb dashboard of [%s/%s], error: %v", td.Namespace, td.Name, err)
 	}
@@ -75,5 +75,11 @@ func init() {
 
 		ClusterSpecReplicas,
 		ClusterUpdateErrors,
+
+		RestoreBandwidthUsage,
+		RestoreBandwidthBudget,
+		RestoreTotal,
+		RestoreDurationSeconds,
+		RestoreInFlight,
 	)
 }
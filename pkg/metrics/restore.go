@@ -0,0 +1,72 @@
+// Copyright 2023 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label constants of the restore metrics.
+const (
+	LabelMode   = "mode"
+	LabelResult = "result"
+)
+
+var (
+	// RestoreTotal is the number of the finished restores, the result label is one of complete, failed,
+	// invalid and canceled.
+	RestoreTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "tidb_operator",
+			Subsystem: "restore",
+			Name:      "total",
+			Help:      "Total number of the finished restores per mode and result",
+		}, []string{LabelMode, LabelResult})
+
+	// RestoreDurationSeconds is the time the completed restores take, from being started to being completed.
+	RestoreDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "tidb_operator",
+			Subsystem: "restore",
+			Name:      "duration_seconds",
+			Help:      "Time taken by the completed restores per mode",
+			// 1 minute to about 34 hours
+			Buckets: prometheus.ExponentialBuckets(60, 2, 12),
+		}, []string{LabelMode})
+
+	// RestoreInFlight is the number of the restores which have created their jobs and not finished yet.
+	RestoreInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_operator",
+			Subsystem: "restore",
+			Name:      "in_flight",
+			Help:      "Number of the in-flight restores per mode",
+		}, []string{LabelMode})
+
+	RestoreBandwidthUsage = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_operator",
+			Subsystem: "restore",
+			Name:      "bandwidth_usage_mbps",
+			Help:      "Sum of the rate limits of the active restores in MB/s",
+		})
+
+	RestoreBandwidthBudget = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "tidb_operator",
+			Subsystem: "restore",
+			Name:      "bandwidth_budget_mbps",
+			Help:      "Aggregate rate limit budget of the active restores in MB/s, 0 means no budget",
+		})
+)
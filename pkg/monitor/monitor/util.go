@@ -1243,7 +1243,7 @@ func getMonitorStatefulSet(sa *core.ServiceAccount, secret *core.Secret, monitor
 	additionalContainers := monitor.Spec.AdditionalContainers
 	if len(additionalContainers) > 0 {
 		var err error
-		statefulSet.Spec.Template.Spec.Containers, err = member.MergePatchContainers(statefulSet.Spec.Template.Spec.Containers, additionalContainers)
+		statefulSet.Spec.Template.Spec.Containers, err = util.MergePatchContainers(statefulSet.Spec.Template.Spec.Containers, additionalContainers)
 		if err != nil {
 			return nil, fmt.Errorf("failed to merge containers spec for TiDBMonitor of [%s/%s], error: %v", monitor.Namespace, monitor.Name, err)
 		}
@@ -294,6 +294,22 @@ func NewFakePDControl(secretLister corelisterv1.SecretLister) *FakePDControl {
 	}
 }
 
+// GetPDClient returns the fake pd client set for the tidbcluster even if TLS is enabled,
+// defaultPDControl never caches the clients of the tidbclusters with TLS enabled.
+func (fpc *FakePDControl) GetPDClient(namespace Namespace, tcName string, tlsEnabled bool, opts ...Option) PDClient {
+	if tlsEnabled {
+		config := &clientConfig{}
+		config.applyOptions(opts...)
+		fpc.mutex.Lock()
+		pdclient, ok := fpc.pdClients[genClientKey("http", namespace, tcName, config.clusterDomain)]
+		fpc.mutex.Unlock()
+		if ok {
+			return pdclient
+		}
+	}
+	return fpc.defaultPDControl.GetPDClient(namespace, tcName, tlsEnabled, opts...)
+}
+
 func (fpc *FakePDControl) SetPDClient(namespace Namespace, tcName string, pdclient PDClient) {
 	fpc.defaultPDControl.pdClients[genClientKey("http", namespace, tcName, "")] = pdclient
 }
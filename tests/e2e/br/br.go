@@ -41,6 +41,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kubernetes/test/e2e/framework"
+	"k8s.io/utils/pointer"
 )
 
 var (
@@ -77,6 +78,15 @@ func enableXK8sMode(t *testcase) {
 	t.enableXK8sMode = true
 }
 
+// enableRestrictedSecurityContext runs the restore pod as non-root with a read-only root filesystem,
+// which checks BR and lightning only write to the mounted volumes
+func enableRestrictedSecurityContext(t *testcase) {
+	t.restrictedSecurityContext = true
+	t.configureRestore = func(restore *v1alpha1.Restore) {
+		restore.Spec.RestrictedSecurityContext = pointer.BoolPtr(true)
+	}
+}
+
 type testcase struct {
 	backupVersion  string
 	restoreVersion string
@@ -85,9 +95,12 @@ type testcase struct {
 	skipCA         bool
 	enableXK8sMode bool
 
+	restrictedSecurityContext bool
+
 	// hooks
-	configureBackup func(backup *v1alpha1.Backup)
-	postBackup      func(backup *v1alpha1.Backup)
+	configureBackup  func(backup *v1alpha1.Backup)
+	postBackup       func(backup *v1alpha1.Backup)
+	configureRestore func(restore *v1alpha1.Restore)
 }
 
 func newTestCase(backupVersion, restoreVersion string, typ string, opts ...option) *testcase {
@@ -115,6 +128,9 @@ func (t *testcase) description() string {
 	if t.enableXK8sMode {
 		builder.WriteString("[X-K8s TidbCluster]")
 	}
+	if t.restrictedSecurityContext {
+		builder.WriteString("[Restricted Security Context]")
+	}
 
 	return builder.String()
 }
@@ -149,6 +165,9 @@ var _ = ginkgo.Describe("Backup and Restore", func() {
 		// latest version Dumper and enable TLS
 		newTestCase(utilimage.TiDBLatest, utilimage.TiDBLatest, typeDumper, enableTLS),
 		newTestCase(utilimage.TiDBLatest, utilimage.TiDBLatest, typeDumper, enableTLSInsecure),
+		// latest version BR and Dumper with the restricted security context
+		newTestCase(utilimage.TiDBLatest, utilimage.TiDBLatest, typeBR, enableRestrictedSecurityContext),
+		newTestCase(utilimage.TiDBLatest, utilimage.TiDBLatest, typeDumper, enableRestrictedSecurityContext),
 	}
 	for _, prevVersion := range utilimage.TiDBPreviousVersions {
 		cases = append(cases,
@@ -231,7 +250,7 @@ var _ = ginkgo.Describe("Backup and Restore", func() {
 		}
 
 		ginkgo.By("Create restore")
-		err = createRestoreAndWaitForComplete(f, restoreName, restoreClusterName, typ, backupName, nil)
+		err = createRestoreAndWaitForComplete(f, restoreName, restoreClusterName, typ, backupName, tcase.configureRestore)
 		framework.ExpectNoError(err)
 
 		ginkgo.By("Forward restore TiDB cluster service")